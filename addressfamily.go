@@ -0,0 +1,61 @@
+package mercure
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+)
+
+// AddressFamily is the network family a subscriber connected through.
+type AddressFamily string
+
+const (
+	AddressFamilyIPv4 AddressFamily = "ipv4"
+	AddressFamilyIPv6 AddressFamily = "ipv6"
+	AddressFamilyUnix AddressFamily = "unix"
+	// AddressFamilyInProcess is the family of the subscribers registered with
+	// Hub.Subscribe.
+	AddressFamilyInProcess AddressFamily = "in_process"
+	AddressFamilyUnknown   AddressFamily = "unknown"
+)
+
+// requestAddressFamily returns the family of the connection a request was
+// received on. IPv4 clients connecting to a dual-stack IPv6 socket appear as
+// IPv4-mapped IPv6 addresses and are reported as IPv4, matching the family
+// they actually use.
+func requestAddressFamily(r *http.Request) AddressFamily {
+	if ap, err := netip.ParseAddrPort(r.RemoteAddr); err == nil {
+		if ap.Addr().Unmap().Is4() {
+			return AddressFamilyIPv4
+		}
+
+		return AddressFamilyIPv6
+	}
+
+	if a, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok && a.Network() == "unix" {
+		return AddressFamilyUnix
+	}
+
+	return AddressFamilyUnknown
+}
+
+// addrFamily returns the family of the remote address of a connection.
+func addrFamily(a net.Addr) AddressFamily {
+	if a == nil {
+		return AddressFamilyUnknown
+	}
+
+	if a.Network() == "unix" {
+		return AddressFamilyUnix
+	}
+
+	if ap, err := netip.ParseAddrPort(a.String()); err == nil {
+		if ap.Addr().Unmap().Is4() {
+			return AddressFamilyIPv4
+		}
+
+		return AddressFamilyIPv6
+	}
+
+	return AddressFamilyUnknown
+}
@@ -0,0 +1,33 @@
+package mercure
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestAddressFamily(t *testing.T) {
+	t.Parallel()
+
+	for remoteAddr, expected := range map[string]AddressFamily{
+		"192.0.2.1:1234":        AddressFamilyIPv4,
+		"[::ffff:192.0.2.1]:80": AddressFamilyIPv4,
+		"[2001:db8::1]:1234":    AddressFamilyIPv6,
+		"@":                     AddressFamilyUnknown,
+	} {
+		r := httptest.NewRequest(http.MethodGet, defaultHubURL, nil)
+		r.RemoteAddr = remoteAddr
+
+		assert.Equal(t, expected, requestAddressFamily(r), remoteAddr)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, defaultHubURL, nil)
+	r.RemoteAddr = "@"
+	r = r.WithContext(context.WithValue(r.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/run/mercure.sock", Net: "unix"}))
+
+	assert.Equal(t, AddressFamilyUnix, requestAddressFamily(r))
+}
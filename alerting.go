@@ -0,0 +1,250 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AlertEvent is a hub event alert rules can count.
+type AlertEvent string
+
+const (
+	// AlertConnectionDrop is recorded every time a subscriber disconnects.
+	AlertConnectionDrop AlertEvent = "connection_drop"
+	// AlertDispatchError is recorded every time the transport fails to
+	// dispatch an update.
+	AlertDispatchError AlertEvent = "dispatch_error"
+	// AlertHistoryPurgeFailure is recorded every time the transport fails to
+	// remove old updates from the history (see ErrHistoryPurge).
+	AlertHistoryPurgeFailure AlertEvent = "history_purge_failure"
+)
+
+// defaultAlertWebhookTimeout bounds the delivery of an alert to a webhook.
+const defaultAlertWebhookTimeout = 10 * time.Second
+
+var (
+	// ErrInvalidAlertRule is returned by WithAlerts when a rule has an
+	// unknown event, or a threshold or window that is not strictly positive.
+	ErrInvalidAlertRule = errors.New("invalid alert rule")
+	// ErrHistoryPurge is wrapped by the errors transports return when they fail
+	// to remove old updates from the history.
+	ErrHistoryPurge = errors.New("unable to purge the history")
+	// errAlertWebhookStatus is returned by WebhookAlertNotifier when the
+	// webhook answers with a non-2xx status code.
+	errAlertWebhookStatus = errors.New("unexpected alert webhook status")
+)
+
+// AlertRule fires an alert when Event is recorded at least Threshold times
+// within Window. Once fired, a rule stays silent for Window, so a sustained
+// problem does not flood the notifiers.
+type AlertRule struct {
+	Event     AlertEvent
+	Threshold int
+	Window    time.Duration
+}
+
+// Alert describes a fired alert rule.
+type Alert struct {
+	Event     AlertEvent
+	Threshold int
+	Window    time.Duration
+	FiredAt   time.Time
+}
+
+// alertJSON is the document WebhookAlertNotifier sends.
+type alertJSON struct {
+	Event     AlertEvent `json:"event"`
+	Threshold int        `json:"threshold"`
+	Window    string     `json:"window"`
+	FiredAt   time.Time  `json:"fired_at"`
+}
+
+// AlertNotifier is notified of fired alerts.
+type AlertNotifier interface {
+	// Notify delivers the alert. It is called from its own goroutine.
+	Notify(ctx context.Context, a Alert) error
+}
+
+// WebhookAlertNotifier POSTs fired alerts as JSON documents to a URL.
+type WebhookAlertNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookAlertNotifier creates an AlertNotifier POSTing alerts to url. A nil
+// client uses a client with a 10 seconds timeout.
+func NewWebhookAlertNotifier(url string, client *http.Client) *WebhookAlertNotifier {
+	if client == nil {
+		client = &http.Client{Timeout: defaultAlertWebhookTimeout}
+	}
+
+	return &WebhookAlertNotifier{url: url, client: client}
+}
+
+// Notify POSTs the alert to the webhook.
+func (n *WebhookAlertNotifier) Notify(ctx context.Context, a Alert) error {
+	body, err := json.Marshal(alertJSON{a.Event, a.Threshold, a.Window.String(), a.FiredAt})
+	if err != nil {
+		return fmt.Errorf("unable to marshal alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to create alert webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to call alert webhook: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: %d", errAlertWebhookStatus, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// WithAlerts sets alert rules evaluated by the hub itself, for deployments
+// without a metrics pipeline. Fired alerts are logged at the warning level and
+// delivered to the given notifiers.
+func WithAlerts(rules []AlertRule, notifiers ...AlertNotifier) Option {
+	return func(o *opt) error {
+		for _, r := range rules {
+			switch r.Event {
+			case AlertConnectionDrop, AlertDispatchError, AlertHistoryPurgeFailure:
+			default:
+				return fmt.Errorf("%w: unknown event %q", ErrInvalidAlertRule, r.Event)
+			}
+
+			if r.Threshold <= 0 || r.Window <= 0 {
+				return fmt.Errorf("%w: the threshold and the window of %q must be positive", ErrInvalidAlertRule, r.Event)
+			}
+		}
+
+		o.alertRules = rules
+		o.alertNotifiers = notifiers
+
+		return nil
+	}
+}
+
+// alertRuleState holds the recent occurrences of the event of a rule.
+type alertRuleState struct {
+	AlertRule
+
+	sync.Mutex
+
+	// occurrences holds at most Threshold timestamps, oldest first.
+	occurrences []time.Time
+	silentUntil time.Time
+}
+
+// alerter evaluates the alert rules. A nil alerter records nothing.
+type alerter struct {
+	ctx       context.Context //nolint:containedctx
+	logger    *slog.Logger
+	rules     []*alertRuleState
+	notifiers []AlertNotifier
+}
+
+func newAlerter(ctx context.Context, logger *slog.Logger, rules []AlertRule, notifiers []AlertNotifier) *alerter {
+	if len(rules) == 0 {
+		return nil
+	}
+
+	a := &alerter{ctx: ctx, logger: logger, notifiers: notifiers}
+	for _, r := range rules {
+		a.rules = append(a.rules, &alertRuleState{AlertRule: r, occurrences: make([]time.Time, 0, r.Threshold)})
+	}
+
+	return a
+}
+
+// record counts an occurrence of e and fires the rules reaching their
+// threshold.
+func (a *alerter) record(e AlertEvent) {
+	if a == nil {
+		return
+	}
+
+	now := time.Now()
+
+	for _, r := range a.rules {
+		if r.Event != e {
+			continue
+		}
+
+		if alert, ok := r.record(now); ok {
+			a.fire(alert)
+		}
+	}
+}
+
+func (r *alertRuleState) record(now time.Time) (Alert, bool) {
+	r.Lock()
+	defer r.Unlock()
+
+	// Drop the occurrences that left the window, then the oldest one if the
+	// buffer is full: only the last Threshold occurrences matter.
+	since := now.Add(-r.Window)
+
+	i := 0
+	for i < len(r.occurrences) && !r.occurrences[i].After(since) {
+		i++
+	}
+
+	if i == 0 && len(r.occurrences) == r.Threshold {
+		i = 1
+	}
+
+	r.occurrences = append(r.occurrences[:0], r.occurrences[i:]...)
+	r.occurrences = append(r.occurrences, now)
+
+	if len(r.occurrences) < r.Threshold || now.Before(r.silentUntil) {
+		return Alert{}, false
+	}
+
+	r.silentUntil = now.Add(r.Window)
+	r.occurrences = r.occurrences[:0]
+
+	return Alert{Event: r.Event, Threshold: r.Threshold, Window: r.Window, FiredAt: now}, true
+}
+
+func (a *alerter) fire(alert Alert) {
+	if a.logger.Enabled(a.ctx, slog.LevelWarn) {
+		a.logger.LogAttrs(a.ctx, slog.LevelWarn, "Alert fired",
+			slog.String("event", string(alert.Event)),
+			slog.Int("threshold", alert.Threshold),
+			slog.Duration("window", alert.Window),
+		)
+	}
+
+	for _, n := range a.notifiers {
+		go func() {
+			if err := n.Notify(a.ctx, alert); err != nil && a.logger.Enabled(a.ctx, slog.LevelError) {
+				a.logger.LogAttrs(a.ctx, slog.LevelError, "Failed to notify alert", slog.String("event", string(alert.Event)), slog.Any("error", err))
+			}
+		}()
+	}
+}
+
+// recordDispatchError feeds a dispatch failure to the alerting engine.
+func (h *Hub) recordDispatchError(err error) {
+	h.alerter.record(AlertDispatchError)
+
+	if errors.Is(err, ErrHistoryPurge) {
+		h.alerter.record(AlertHistoryPurgeFailure)
+	}
+}
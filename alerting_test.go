@@ -0,0 +1,130 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chanAlertNotifier chan Alert
+
+func (n chanAlertNotifier) Notify(_ context.Context, a Alert) error {
+	n <- a
+
+	return nil
+}
+
+func TestAlertRuleWindow(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		r := &alertRuleState{AlertRule: AlertRule{Event: AlertDispatchError, Threshold: 3, Window: time.Minute}}
+
+		_, fired := r.record(time.Now())
+		assert.False(t, fired)
+
+		// The first occurrence leaves the window.
+		time.Sleep(time.Minute)
+
+		_, fired = r.record(time.Now())
+		assert.False(t, fired)
+		_, fired = r.record(time.Now())
+		assert.False(t, fired)
+
+		a, fired := r.record(time.Now())
+		require.True(t, fired)
+		assert.Equal(t, AlertDispatchError, a.Event)
+		assert.Equal(t, 3, a.Threshold)
+
+		// Silent for a window once fired.
+		for range 3 {
+			_, fired = r.record(time.Now())
+			assert.False(t, fired)
+		}
+
+		time.Sleep(time.Minute)
+
+		for range 2 {
+			_, fired = r.record(time.Now())
+			assert.False(t, fired)
+		}
+
+		_, fired = r.record(time.Now())
+		assert.True(t, fired)
+	})
+}
+
+func TestAlertsHub(t *testing.T) {
+	t.Parallel()
+
+	alerts := make(chanAlertNotifier, 2)
+	hub := createDummy(t, WithAlerts([]AlertRule{
+		{Event: AlertDispatchError, Threshold: 1, Window: time.Hour},
+		{Event: AlertHistoryPurgeFailure, Threshold: 1, Window: time.Hour},
+	}, alerts))
+
+	require.NoError(t, hub.Stop(t.Context()))
+	require.ErrorIs(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/foo"}), ErrClosedTransport)
+
+	a := <-alerts
+	assert.Equal(t, AlertDispatchError, a.Event)
+
+	hub.recordDispatchError(fmt.Errorf("bolt error: %w", ErrHistoryPurge))
+
+	a = <-alerts
+	assert.Equal(t, AlertHistoryPurgeFailure, a.Event)
+}
+
+func TestWithAlertsInvalidRule(t *testing.T) {
+	t.Parallel()
+
+	for _, r := range []AlertRule{
+		{Event: "foo", Threshold: 1, Window: time.Second},
+		{Event: AlertConnectionDrop, Window: time.Second},
+		{Event: AlertConnectionDrop, Threshold: 1},
+	} {
+		_, err := NewHub(t.Context(), WithAlerts([]AlertRule{r}))
+		assert.ErrorIs(t, err, ErrInvalidAlertRule)
+	}
+}
+
+func TestWebhookAlertNotifier(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	n := NewWebhookAlertNotifier(srv.URL, nil)
+	require.NoError(t, n.Notify(t.Context(), Alert{Event: AlertConnectionDrop, Threshold: 10, Window: time.Minute, FiredAt: time.Now()}))
+
+	body := <-received
+	assert.Equal(t, "connection_drop", body["event"])
+	assert.InDelta(t, 10, body["threshold"], 0)
+	assert.Equal(t, "1m0s", body["window"])
+}
+
+func TestWebhookAlertNotifierError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	require.ErrorIs(t, NewWebhookAlertNotifier(srv.URL, nil).Notify(t.Context(), Alert{}), errAlertWebhookStatus)
+}
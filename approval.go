@@ -0,0 +1,370 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// approvalsURL is the endpoint allowing moderators to approve or reject the
+// subscriptions awaiting approval.
+const approvalsURL = defaultHubURL + "/approvals"
+
+// defaultApprovalTimeout is how long a subscription awaits approval when
+// SubscriptionApproval.Timeout is not set.
+const defaultApprovalTimeout = 5 * time.Minute
+
+var (
+	// ErrInvalidSubscriptionApproval is returned by NewHub when the
+	// subscription approval configuration is not valid.
+	ErrInvalidSubscriptionApproval = errors.New("invalid subscription approval")
+	// ErrApprovalRequestNotFound is returned by DecideSubscription when no
+	// subscription awaits approval with this ID, on this node.
+	ErrApprovalRequestNotFound = errors.New("approval request not found")
+	// ErrSubscriptionRejected is returned by Subscribe when the subscription
+	// requires approval and is rejected, or isn't approved in time.
+	ErrSubscriptionRejected = errors.New("subscription rejected")
+
+	errApprovalTimeout = fmt.Errorf("%w: approval timed out", ErrSubscriptionRejected)
+)
+
+// SubscriptionApproval requires moderators to approve the subscriptions to
+// some topic selectors before the subscribers receive anything: the hub
+// parks the subscription, sends an approval request, and activates or rejects
+// the subscription according to the decision (see Hub.DecideSubscription).
+//
+// The approval request is a private update whose data is a JSON document of
+// type "SubscriptionApprovalRequest", holding the ID of the request, the ID of
+// the subscriber, the subscribed topic selectors requiring approval, the
+// subject of the token of the subscriber if any, and the expiration date of
+// the request.
+type SubscriptionApproval struct {
+	// Matchers selects the topics requiring approval: a subscription
+	// requires approval when one of its topic selectors can match a topic
+	// one of these matchers matches. Selectors such as "*", or URL patterns
+	// broader than the moderated ones, require approval too.
+	Matchers []TopicMatcher
+	// Topic is the topic the approval requests are published on, privately.
+	Topic string
+	// Target receives the approval requests, such as an HTTP webhook. At
+	// least one of Topic and Target must be set.
+	Target PublishHookTarget
+	// Timeout is how long a subscription awaits approval before being
+	// rejected, 5 minutes by default.
+	Timeout time.Duration
+}
+
+// approvalRequest is the data of the update sent to the approvers.
+type approvalRequest struct {
+	Type       string    `json:"type"`
+	ID         string    `json:"id"`
+	Subscriber string    `json:"subscriber"`
+	Topics     []string  `json:"topics"`
+	Subject    string    `json:"sub,omitempty"`
+	Expires    time.Time `json:"expires"`
+}
+
+// pendingApproval is a subscription awaiting approval.
+type pendingApproval struct {
+	// topics are the subscribed topic selectors requiring approval.
+	topics []string
+	// decision receives the decision, once.
+	decision chan bool
+}
+
+// subscriptionApprover holds the state of the approval workflow of a hub.
+type subscriptionApprover struct {
+	SubscriptionApproval
+
+	worker  *publishHookWorker
+	pending sync.Map // map[string]*pendingApproval
+}
+
+// WithSubscriptionApproval requires approval for the subscriptions to some
+// topic selectors, useful for operator-moderated channels.
+//
+// Subscriptions await approval on the node they are connected to: in a
+// cluster, the decisions must be sent to all the nodes.
+func WithSubscriptionApproval(a SubscriptionApproval) Option {
+	return func(o *opt) error {
+		o.subscriptionApproval = &subscriptionApprover{SubscriptionApproval: a}
+
+		return nil
+	}
+}
+
+// validateSubscriptionApproval checks the approval configuration once the
+// topic matcher store is configured.
+func (o *opt) validateSubscriptionApproval() error {
+	a := o.subscriptionApproval
+	if a == nil {
+		return nil
+	}
+
+	if len(a.Matchers) == 0 {
+		return fmt.Errorf("%w: missing matchers", ErrInvalidSubscriptionApproval)
+	}
+
+	for _, m := range a.Matchers {
+		if err := validateProtocolMatcher(o.topicMatcherStore, m); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrInvalidSubscriptionApproval, m.Pattern, err)
+		}
+	}
+
+	if a.Topic == "" && a.Target == nil {
+		return fmt.Errorf("%w: missing topic or target", ErrInvalidSubscriptionApproval)
+	}
+
+	if !validProtocolString(a.Topic) {
+		return fmt.Errorf("%w: invalid topic %q", ErrInvalidSubscriptionApproval, a.Topic)
+	}
+
+	if a.Timeout == 0 {
+		a.Timeout = defaultApprovalTimeout
+	}
+
+	return nil
+}
+
+// startSubscriptionApproval starts the worker sending the approval requests
+// to the target, stopped when ctx is done.
+func (o *opt) startSubscriptionApproval(ctx context.Context) {
+	if a := o.subscriptionApproval; a != nil && a.Target != nil {
+		a.worker = startPublishHooks(ctx, o.logger, []PublishHook{{Private: true, Target: a.Target}})[0]
+	}
+}
+
+// moderatedTopics returns the topic selectors of the subscriber requiring
+// approval: the ones that can overlap a moderated matcher.
+func (a *subscriptionApprover) moderatedTopics(tms *TopicMatcherStore, s *Subscriber) []string {
+	var topics []string
+
+	for _, sm := range s.SubscribedMatchers {
+		for _, m := range a.Matchers {
+			if tms.overlaps(sm, m) {
+				topics = append(topics, sm.Pattern)
+
+				break
+			}
+		}
+	}
+
+	return topics
+}
+
+// DecideSubscription approves, or rejects, the subscription awaiting approval
+// with the ID of the approval request. ErrApprovalRequestNotFound is returned
+// when no subscription awaits approval with this ID on this node, because it
+// has already been decided, has expired, or has been abandoned by the
+// subscriber. Authorization is the caller's responsibility.
+func (h *Hub) DecideSubscription(ctx context.Context, id string, approved bool) error {
+	if h.subscriptionApproval == nil {
+		return ErrApprovalRequestNotFound
+	}
+
+	p, ok := h.subscriptionApproval.pending.LoadAndDelete(id)
+	if !ok {
+		return ErrApprovalRequestNotFound
+	}
+
+	// Buffered, and only sent to by the caller having removed the entry.
+	p.(*pendingApproval).decision <- approved
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Subscription decided", slog.String("approval_request", id), slog.Bool("approved", approved))
+	}
+
+	return nil
+}
+
+// awaitApproval parks the subscription until it is approved when it requires
+// approval. ErrSubscriptionRejected is returned when it is rejected or not
+// approved in time, and the error of ctx when it is done first. All the
+// subscribe paths must call it before the subscriber gets anything.
+func (h *Hub) awaitApproval(ctx context.Context, s *Subscriber) error {
+	a := h.subscriptionApproval
+	if a == nil {
+		return nil
+	}
+
+	topics := a.moderatedTopics(h.topicMatcherStore, s)
+	if len(topics) == 0 {
+		return nil
+	}
+
+	id := "urn:uuid:" + uuid.Must(uuid.NewV4()).String()
+	p := &pendingApproval{topics: topics, decision: make(chan bool, 1)}
+
+	a.pending.Store(id, p)
+	defer a.pending.Delete(id)
+
+	h.requestApproval(ctx, id, s, topics)
+
+	timer := time.NewTimer(a.Timeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-p.decision:
+		if approved {
+			return nil
+		}
+
+		return ErrSubscriptionRejected
+	case <-timer.C:
+		if h.logger.Enabled(ctx, slog.LevelInfo) {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, "Subscription approval timed out", slog.String("approval_request", id))
+		}
+
+		return errApprovalTimeout
+	case <-ctx.Done():
+		return ctx.Err() //nolint:wrapcheck
+	}
+}
+
+// writeApprovalError writes the response of a subscription awaitApproval
+// refused. Nothing is written when the client is gone.
+func writeApprovalError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errApprovalTimeout):
+		http.Error(w, "Subscription approval timed out", http.StatusForbidden)
+	case errors.Is(err, ErrSubscriptionRejected):
+		http.Error(w, "Subscription rejected", http.StatusForbidden)
+	}
+}
+
+// requestApproval sends the approval request of a parked subscription.
+func (h *Hub) requestApproval(ctx context.Context, id string, s *Subscriber, topics []string) {
+	a := h.subscriptionApproval
+
+	r := approvalRequest{
+		Type:       "SubscriptionApprovalRequest",
+		ID:         id,
+		Subscriber: s.ID,
+		Topics:     topics,
+		Expires:    time.Now().Add(a.Timeout).UTC(),
+	}
+	if s.Claims != nil {
+		r.Subject = s.Claims.Subject
+	}
+
+	j, err := json.Marshal(r)
+	if err != nil {
+		panic(err)
+	}
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Subscription awaiting approval", slog.String("approval_request", id), slog.Any("topics", topics))
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	if a.Topic != "" {
+		if err := h.Publish(ctx, &Update{Topic: a.Topic, Private: true, Event: Event{Data: string(j)}}); err != nil && h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to publish approval request", slog.String("approval_request", id), slog.Any("error", err))
+		}
+	}
+
+	if a.worker == nil {
+		return
+	}
+
+	u := &Update{Private: true, Event: Event{ID: id, Data: string(j)}}
+	u.setTopics(topics)
+
+	select {
+	case a.worker.queue <- u:
+	default:
+		if h.logger.Enabled(ctx, slog.LevelWarn) {
+			h.logger.LogAttrs(ctx, slog.LevelWarn, "Approval queue full, approval request dropped", slog.String("approval_request", id))
+		}
+	}
+}
+
+// ApprovalsHandler allows moderators to decide on the subscriptions awaiting
+// approval. The ID of the approval request is read from the "id" form field,
+// and the decision from the "decision" one: "approve" or "reject".
+//
+// The token must grant publishing, privately, on the topic selectors
+// requiring approval.
+func (h *Hub) ApprovalsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "mercure.approval.request", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	r = r.WithContext(ctx)
+
+	var claims *claims
+
+	if h.publisherConfigured {
+		var err error
+
+		claims, err = h.authorize(r, true)
+		if err != nil || claims == nil {
+			h.writeAuthError(w, r, err)
+
+			if err != nil {
+				recordSpanError(span, err)
+			}
+
+			return
+		}
+	}
+
+	h.limitRequestBody(w, r)
+
+	if err := r.ParseForm(); err != nil {
+		status := http.StatusBadRequest
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, http.StatusText(status), status)
+
+		return
+	}
+
+	id := r.PostForm.Get("id")
+	if id == "" {
+		http.Error(w, `Missing "id" parameter`, http.StatusBadRequest)
+
+		return
+	}
+
+	var approved bool
+
+	switch r.PostForm.Get("decision") {
+	case "approve":
+		approved = true
+	case "reject":
+	default:
+		http.Error(w, `Invalid "decision" parameter`, http.StatusBadRequest)
+
+		return
+	}
+
+	// The existence of the approval requests the moderator is not allowed to
+	// decide on is not disclosed.
+	p, ok := h.subscriptionApproval.pending.Load(id)
+	if !ok || !h.canPublish(ctx, claims, p.(*pendingApproval).topics, true) {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	if err := h.DecideSubscription(ctx, id, approved); err != nil {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
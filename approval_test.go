@@ -0,0 +1,287 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testApprovalTopic = "https://example.com/approvals"
+
+func testSubscriptionApproval(target PublishHookTarget) SubscriptionApproval {
+	return SubscriptionApproval{
+		Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/rooms/*"}},
+		Topic:    testApprovalTopic,
+		Target:   target,
+	}
+}
+
+// subscribeAwaitingApproval subscribes to the topic in the background, and
+// returns the recorder and a channel closed once the handler returned.
+func subscribeAwaitingApproval(t *testing.T, hub *Hub, topic string) (*subscribeRecorder, <-chan struct{}) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match="+url.QueryEscape(topic), nil).WithContext(t.Context())
+	w := newSubscribeRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	return w, done
+}
+
+func decodeApprovalRequest(t *testing.T, u *Update) approvalRequest {
+	t.Helper()
+
+	var r approvalRequest
+	require.NoError(t, json.Unmarshal([]byte(u.Data), &r))
+
+	return r
+}
+
+func TestSubscriptionApprovalApproved(t *testing.T) {
+	t.Parallel()
+
+	target := make(chanPublishHookTarget, 1)
+	hub := createAnonymousDummy(t, WithSubscriptionApproval(testSubscriptionApproval(target)))
+
+	approvals, err := hub.Subscribe(t.Context(), []TopicMatcher{{Type: MatcherTypeExact, Pattern: testApprovalTopic}}, []TopicMatcher{{Type: MatcherTypeExact, Pattern: testApprovalTopic}})
+	require.NoError(t, err)
+
+	w, done := subscribeAwaitingApproval(t, hub, "https://example.com/rooms/1")
+
+	published := <-approvals
+	assert.True(t, published.Private)
+
+	sent := <-target
+	assert.True(t, sent.Private)
+	assert.Equal(t, []string{"https://example.com/rooms/1"}, sent.topics())
+
+	r := decodeApprovalRequest(t, published)
+	assert.Equal(t, "SubscriptionApprovalRequest", r.Type)
+	assert.Equal(t, []string{"https://example.com/rooms/1"}, r.Topics)
+	assert.NotEmpty(t, r.Subscriber)
+	assert.WithinDuration(t, time.Now().Add(defaultApprovalTimeout), r.Expires, time.Minute)
+	assert.Equal(t, r, decodeApprovalRequest(t, sent))
+
+	// Parked subscriptions receive nothing.
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+	require.NoError(t, hub.DecideSubscription(t.Context(), r.ID, true))
+	require.ErrorIs(t, hub.DecideSubscription(t.Context(), r.ID, true), ErrApprovalRequestNotFound)
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 2)
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/rooms/1", Event: Event{Data: "welcome"}}))
+
+	_, err = hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Topics: []string{"https://example.com/rooms/1"}}, false)
+	require.NoError(t, err)
+	<-done
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "data: welcome\n")
+}
+
+func TestSubscriptionApprovalRejected(t *testing.T) {
+	t.Parallel()
+
+	target := make(chanPublishHookTarget, 1)
+	hub := createDummy(t, WithAnonymous(), WithSubscriptionApproval(testSubscriptionApproval(target)))
+
+	w, done := subscribeAwaitingApproval(t, hub, "https://example.com/rooms/1")
+	r := decodeApprovalRequest(t, <-target)
+
+	decide := func(token, id, decision string) int {
+		form := url.Values{"id": {id}, "decision": {decision}}
+		req := httptest.NewRequest(http.MethodPost, approvalsURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+token)
+
+		rec := httptest.NewRecorder()
+		hub.handler.ServeHTTP(rec, req)
+
+		return rec.Code
+	}
+
+	token := createDummyAuthorizedJWT(rolePublisher, []string{"https://example.com/rooms/1"})
+
+	assert.Equal(t, http.StatusBadRequest, decide(token, r.ID, "maybe"))
+	assert.Equal(t, http.StatusNotFound, decide(token, "urn:uuid:unknown", "reject"))
+	assert.Equal(t, http.StatusNotFound, decide(createDummyAuthorizedJWT(rolePublisher, []string{"https://example.com/rooms/2"}), r.ID, "reject"))
+	assert.Equal(t, http.StatusNoContent, decide(token, r.ID, "reject"))
+
+	<-done
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+}
+
+func TestSubscriptionApprovalTimeout(t *testing.T) {
+	t.Parallel()
+
+	a := testSubscriptionApproval(nil)
+	a.Timeout = 50 * time.Millisecond
+	hub := createAnonymousDummy(t, WithSubscriptionApproval(a))
+
+	w, done := subscribeAwaitingApproval(t, hub, "https://example.com/rooms/1")
+	<-done
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestSubscriptionApprovalNotRequired(t *testing.T) {
+	t.Parallel()
+
+	target := make(chanPublishHookTarget, 1)
+	hub := createAnonymousDummy(t, WithSubscriptionApproval(testSubscriptionApproval(target)))
+
+	body := subscribeUntilDisconnected(t, hub, func(context.CancelFunc) {
+		_, err := hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Topics: []string{"https://example.com/books/1"}}, false)
+		require.NoError(t, err)
+	})
+
+	assert.NotContains(t, body, "Subscription")
+	assert.Empty(t, target)
+}
+
+func TestSubscriptionApprovalInvalid(t *testing.T) {
+	t.Parallel()
+
+	for name, a := range map[string]SubscriptionApproval{
+		"no matchers": {Topic: testApprovalTopic},
+		"no approver": {Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/rooms/1"}}},
+		"invalid matcher": {
+			Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/{"}},
+			Topic:    testApprovalTopic,
+		},
+	} {
+		_, err := NewHub(t.Context(), WithSubscriptionApproval(a))
+		require.ErrorIs(t, err, ErrInvalidSubscriptionApproval, name)
+	}
+}
+
+// rejectApprovalRequest rejects the next approval request sent to the target,
+// and returns it.
+func rejectApprovalRequest(t *testing.T, hub *Hub, target chanPublishHookTarget) approvalRequest {
+	t.Helper()
+
+	r := decodeApprovalRequest(t, <-target)
+	require.NoError(t, hub.DecideSubscription(t.Context(), r.ID, false))
+
+	return r
+}
+
+func TestSubscriptionApprovalModeratedTopics(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithSubscriptionApproval(testSubscriptionApproval(nil)))
+
+	for _, tc := range []struct {
+		matcher   TopicMatcher
+		moderated bool
+	}{
+		{TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/rooms/1"}, true},
+		{TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/books/1"}, false},
+		{TopicMatcher{Type: MatcherTypeExact, Pattern: "*"}, true},
+		{TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "*"}, true},
+		{TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/*"}, true},
+		{TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/rooms/1/*"}, true},
+		{TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://:host.example.com/*"}, true},
+		{TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/*"}, false},
+		{TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.org/*"}, false},
+	} {
+		s := NewSubscriber(hub.logger, hub.topicMatcherStore)
+		s.setMatchers([]TopicMatcher{tc.matcher}, nil)
+
+		assert.Equal(t, tc.moderated, len(hub.subscriptionApproval.moderatedTopics(hub.topicMatcherStore, s)) == 1, tc.matcher.Pattern)
+	}
+}
+
+func TestSubscriptionApprovalWildcard(t *testing.T) {
+	t.Parallel()
+
+	target := make(chanPublishHookTarget, 1)
+	hub := createAnonymousDummy(t, WithSubscriptionApproval(testSubscriptionApproval(target)))
+
+	w, done := subscribeAwaitingApproval(t, hub, "*")
+
+	assert.Equal(t, []string{"*"}, rejectApprovalRequest(t, hub, target).Topics)
+	<-done
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+}
+
+func TestSubscriptionApprovalInProcess(t *testing.T) {
+	t.Parallel()
+
+	target := make(chanPublishHookTarget, 1)
+	hub := createAnonymousDummy(t, WithSubscriptionApproval(testSubscriptionApproval(target)))
+
+	errs := make(chan error, 1)
+
+	go func() {
+		_, err := hub.Subscribe(t.Context(), []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/*"}}, nil)
+		errs <- err
+	}()
+
+	rejectApprovalRequest(t, hub, target)
+
+	require.ErrorIs(t, <-errs, ErrSubscriptionRejected)
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+}
+
+func TestSubscriptionApprovalHistory(t *testing.T) {
+	t.Parallel()
+
+	target := make(chanPublishHookTarget, 1)
+	hub := createAnonymousDummy(t, WithSubscriptionApproval(testSubscriptionApproval(target)))
+
+	codes := make(chan int, 1)
+
+	go func() {
+		code, _ := historyRequest(t, hub, "", url.Values{"match": {"https://example.com/rooms/1"}})
+		codes <- code
+	}()
+
+	rejectApprovalRequest(t, hub, target)
+
+	assert.Equal(t, http.StatusForbidden, <-codes)
+}
+
+func TestSubscriptionApprovalCapability(t *testing.T) {
+	t.Parallel()
+
+	target := make(chanPublishHookTarget, 1)
+	hub := createDummy(t, WithCapabilityURLs(testCapabilityKey, 0), WithSubscriptionApproval(testSubscriptionApproval(target)))
+
+	u, err := hub.CapabilityURL([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/rooms/1"}}, time.Minute)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, u, nil).WithContext(t.Context())
+	w := newSubscribeRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	r := rejectApprovalRequest(t, hub, target)
+	<-done
+
+	assert.Equal(t, []string{"https://example.com/rooms/1"}, r.Topics)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
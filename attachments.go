@@ -0,0 +1,292 @@
+package mercure
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// attachmentURL is the endpoint serving the attachments of multipart
+	// publications.
+	attachmentURL = defaultHubURL + "/attachments/{key}"
+	// attachmentScheme prefixes the references to attachments in the data of
+	// multipart publications, as in emails (RFC 2392).
+	attachmentScheme = "cid:"
+	// maxAttachmentMemory is the part of a multipart publication kept in
+	// memory, the rest is buffered in temporary files.
+	maxAttachmentMemory = 1 << 20
+	// minAttachmentPruneInterval and maxAttachmentPruneInterval bound the
+	// interval between two prunings of the expired attachments.
+	minAttachmentPruneInterval = time.Minute
+	maxAttachmentPruneInterval = time.Hour
+)
+
+// DefaultAttachmentURLTTL is the default validity of the signed URLs of
+// attachments.
+const DefaultAttachmentURLTTL = time.Hour
+
+// ErrAttachmentsNotSupported is returned when a publication has attachments
+// but the hub has no blob store.
+var ErrAttachmentsNotSupported = errors.New("publishing attachments is not supported")
+
+// WithAttachments allows publishing multipart/form-data requests with file
+// attachments. Attachments are stored in store, and every "cid:<field name>"
+// reference in the data of the update is replaced by a URL of the hub serving
+// the attachment, signed with signingKey and valid for urlTTL.
+//
+// A nil signingKey uses a random key: URLs are then invalidated when the hub
+// restarts. A zero urlTTL uses DefaultAttachmentURLTTL. URLs are absolute when
+// the public URL is set (see WithPublicURL), and relative to the hub origin
+// otherwise.
+//
+// The attachments of the publications that fail are deleted when store
+// implements BlobDeleter, and the ones older than urlTTL, that can't be
+// downloaded anymore, periodically when it implements BlobPruner. The updates
+// replayed from the history after urlTTL reference expired URLs: set a urlTTL
+// at least as long as the history retention for the attachments to remain
+// available to the reconnecting subscribers.
+func WithAttachments(store BlobStore, signingKey []byte, urlTTL time.Duration) Option {
+	return func(o *opt) error {
+		if signingKey == nil {
+			signingKey = make([]byte, 32)
+			_, _ = rand.Read(signingKey)
+		}
+
+		if urlTTL == 0 {
+			urlTTL = DefaultAttachmentURLTTL
+		}
+
+		o.blobStore = store
+		o.attachmentSigningKey = signingKey
+		o.attachmentURLTTL = urlTTL
+
+		return nil
+	}
+}
+
+// parsePublishForm parses the publish form, including multipart/form-data
+// bodies. The returned attachments are the file parts, by field name.
+func parsePublishForm(r *http.Request) (map[string][]*multipart.FileHeader, error) {
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "multipart/form-data" {
+		return nil, r.ParseForm() //nolint:wrapcheck
+	}
+
+	if err := r.ParseMultipartForm(maxAttachmentMemory); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return r.MultipartForm.File, nil
+}
+
+// storeAttachments stores the attachments and replaces their references in
+// data with their signed URLs. It returns the keys of the stored blobs, to be
+// deleted if the publication fails.
+func (h *Hub) storeAttachments(ctx context.Context, data string, attachments map[string][]*multipart.FileHeader) (string, []string, error) {
+	if h.blobStore == nil {
+		return "", nil, ErrAttachmentsNotSupported
+	}
+
+	// Longest names first, so "cid:thumb" doesn't replace the beginning of
+	// "cid:thumbnail".
+	names := make([]string, 0, len(attachments))
+	for name := range attachments {
+		names = append(names, name)
+	}
+
+	slices.SortFunc(names, func(a, b string) int { return len(b) - len(a) })
+
+	expires := time.Now().Add(h.attachmentURLTTL).Unix()
+	oldnew := make([]string, 0, 2*len(names))
+	keys := make([]string, 0, len(names))
+
+	for _, name := range names {
+		// A field is a single attachment: only the first file is referenced.
+		fh := attachments[name][0]
+
+		key, err := h.putAttachment(ctx, fh)
+		if err != nil {
+			h.deleteAttachments(ctx, keys)
+
+			return "", nil, err
+		}
+
+		keys = append(keys, key)
+		oldnew = append(oldnew, attachmentScheme+name, h.attachmentSignedURL(key, expires))
+	}
+
+	return strings.NewReplacer(oldnew...).Replace(data), keys, nil
+}
+
+// deleteAttachments deletes the attachments of a publication that failed,
+// when the blob store supports it.
+func (h *Hub) deleteAttachments(ctx context.Context, keys []string) {
+	d, ok := h.blobStore.(BlobDeleter)
+	if !ok {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+
+	for _, key := range keys {
+		if err := d.DeleteBlob(ctx, key); err != nil && h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to delete attachment", slog.String("key", key), slog.Any("error", err))
+		}
+	}
+}
+
+// startAttachmentPruning deletes the expired attachments periodically, until
+// the context of the hub is done, when the blob store supports it.
+func (h *Hub) startAttachmentPruning() {
+	if _, ok := h.blobStore.(BlobPruner); !ok {
+		return
+	}
+
+	interval := min(max(h.attachmentURLTTL/2, minAttachmentPruneInterval), maxAttachmentPruneInterval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.ctx.Done():
+				return
+			case <-ticker.C:
+				h.pruneAttachments(h.ctx)
+			}
+		}
+	}()
+}
+
+// pruneAttachments deletes the attachments stored before the signed URLs
+// handed out now were created, which have all expired.
+func (h *Hub) pruneAttachments(ctx context.Context) {
+	n, err := h.blobStore.(BlobPruner).PruneBlobs(ctx, time.Now().Add(-h.attachmentURLTTL))
+	if err != nil && h.logger.Enabled(ctx, slog.LevelError) {
+		h.logger.LogAttrs(ctx, slog.LevelError, "Failed to prune the expired attachments", slog.Any("error", err))
+	}
+
+	if n > 0 && h.logger.Enabled(ctx, slog.LevelDebug) {
+		h.logger.LogAttrs(ctx, slog.LevelDebug, "Expired attachments pruned", slog.Int("count", n))
+	}
+}
+
+func (h *Hub) putAttachment(ctx context.Context, fh *multipart.FileHeader) (string, error) {
+	f, err := fh.Open()
+	if err != nil {
+		return "", fmt.Errorf("unable to read attachment: %w", err)
+	}
+	defer f.Close()
+
+	contentType := fh.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	key, err := h.blobStore.PutBlob(ctx, contentType, f)
+	if err != nil {
+		return "", fmt.Errorf("unable to store attachment: %w", err)
+	}
+
+	return key, nil
+}
+
+// attachmentSignature signs the key and the expiration date of an attachment
+// URL.
+func (h *Hub) attachmentSignature(key string, expires int64) string {
+	mac := hmac.New(sha256.New, h.attachmentSigningKey)
+	mac.Write([]byte(key + "\n" + strconv.FormatInt(expires, 10)))
+
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// attachmentSignedURL builds the URL serving an attachment until expires.
+func (h *Hub) attachmentSignedURL(key string, expires int64) string {
+	q := url.Values{"expires": {strconv.FormatInt(expires, 10)}, "signature": {h.attachmentSignature(key, expires)}}
+
+	return h.absoluteURL(strings.Replace(attachmentURL, "{key}", url.PathEscape(key), 1)) + "?" + q.Encode()
+}
+
+// absoluteURL resolves a path of the hub against the origin of the public
+// URL, for the URLs the hub hands out. Like the protected resource metadata
+// URL, it is only made absolute from the configured public URL, never from
+// request headers a client could forge: without one, the path is returned.
+func (h *Hub) absoluteURL(path string) string {
+	if u, err := url.Parse(h.publicURL); err == nil && u.IsAbs() && u.Host != "" {
+		return u.Scheme + "://" + u.Host + path
+	}
+
+	return path
+}
+
+// AttachmentHandler serves the attachments of multipart publications, to the
+// holders of a valid signed URL.
+func (h *Hub) AttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := url.PathUnescape(mux.Vars(r)["key"])
+	if err != nil {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	q := r.URL.Query()
+
+	expires, err := strconv.ParseInt(q.Get("expires"), 10, 64)
+	if err != nil ||
+		!hmac.Equal([]byte(q.Get("signature")), []byte(h.attachmentSignature(key, expires))) ||
+		time.Now().Unix() > expires {
+		http.Error(w, "Invalid or expired attachment URL", http.StatusForbidden)
+
+		return
+	}
+
+	rc, contentType, err := h.blobStore.OpenBlob(r.Context(), key)
+	if err != nil {
+		if errors.Is(err, ErrBlobNotFound) {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		if h.logger.Enabled(r.Context(), slog.LevelError) {
+			h.logger.LogAttrs(r.Context(), slog.LevelError, "Failed to open attachment", slog.String("key", key), slog.Any("error", err))
+		}
+
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+	defer rc.Close()
+
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("Cache-Control", "private, max-age="+strconv.FormatInt(expires-time.Now().Unix(), 10))
+	// Attachments are publisher-supplied: never let them run scripts in the
+	// origin of the hub.
+	header.Set("Content-Security-Policy", "sandbox")
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, rc); err != nil && h.logger.Enabled(r.Context(), slog.LevelInfo) {
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "Failed to write attachment", slog.String("key", key), slog.Any("error", err))
+	}
+}
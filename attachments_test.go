@@ -0,0 +1,181 @@
+package mercure
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func multipartPublishRequest(t *testing.T, data string, attachments map[string]string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+
+	mw := multipart.NewWriter(&body)
+	require.NoError(t, mw.WriteField("topic", "https://example.com/books/1"))
+	require.NoError(t, mw.WriteField("data", data))
+
+	for name, content := range attachments {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="`+name+`"; filename="`+name+`.png"`)
+		h.Set("Content-Type", "image/png")
+
+		pw, err := mw.CreatePart(h)
+		require.NoError(t, err)
+
+		_, err = io.WriteString(pw, content)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, defaultHubURL, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+	return req
+}
+
+func TestPublishAttachments(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewFileBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	hub := createDummy(t, WithAttachments(store, []byte("key"), 0), WithPublicURL("https://hub.example.com"+defaultHubURL))
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/books/1"}), nil)
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, multipartPublishRequest(t, `{"thumb":"cid:thumb","thumbnail":"cid:thumbnail"}`, map[string]string{
+		"thumb":     "small",
+		"thumbnail": "large",
+	}))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var data map[string]string
+	require.NoError(t, json.Unmarshal([]byte((<-s.Receive()).Data), &data))
+
+	for name, content := range map[string]string{"thumb": "small", "thumbnail": "large"} {
+		u, ok := strings.CutPrefix(data[name], "https://hub.example.com"+defaultHubURL+"/attachments/")
+		require.True(t, ok, data[name])
+
+		w := httptest.NewRecorder()
+		hub.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultHubURL+"/attachments/"+u, nil))
+
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "image/png", w.Header().Get("Content-Type"))
+		assert.Equal(t, "sandbox", w.Header().Get("Content-Security-Policy"))
+		assert.Equal(t, content, w.Body.String())
+
+		// Tampering with the expiration date invalidates the signature.
+		w = httptest.NewRecorder()
+		hub.ServeHTTP(w, httptest.NewRequest(http.MethodGet, defaultHubURL+"/attachments/"+strings.Replace(u, "expires=", "expires=9", 1), nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	}
+}
+
+func TestAttachmentHandlerExpired(t *testing.T) {
+	t.Parallel()
+
+	store, err := NewFileBlobStore(t.TempDir())
+	require.NoError(t, err)
+
+	hub := createDummy(t, WithAttachments(store, nil, 0))
+
+	key, err := store.PutBlob(t.Context(), "text/plain", strings.NewReader("foo"))
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, httptest.NewRequest(http.MethodGet, hub.attachmentSignedURL(key, time.Now().Add(-time.Second).Unix()), nil))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = httptest.NewRecorder()
+	hub.ServeHTTP(w, httptest.NewRequest(http.MethodGet, hub.attachmentSignedURL(key, time.Now().Add(time.Minute).Unix()), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "foo", w.Body.String())
+
+	w = httptest.NewRecorder()
+	hub.ServeHTTP(w, httptest.NewRequest(http.MethodGet, hub.attachmentSignedURL("../foo", time.Now().Add(time.Minute).Unix()), nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestPublishAttachmentsNotSupported(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, multipartPublishRequest(t, "cid:thumb", map[string]string{"thumb": "small"}))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), ErrAttachmentsNotSupported.Error())
+}
+
+func TestPublishAttachmentsDeletedOnFailure(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewFileBlobStore(dir)
+	require.NoError(t, err)
+
+	hub := createDummy(t, WithAttachments(store, []byte("key"), 0))
+	require.NoError(t, hub.transport.Close(t.Context()))
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, multipartPublishRequest(t, `{"thumb":"cid:thumb"}`, map[string]string{"thumb": "small"}))
+	require.NotEqual(t, http.StatusOK, w.Code)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestPruneAttachments(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	store, err := NewFileBlobStore(dir)
+	require.NoError(t, err)
+
+	hub := createDummy(t, WithAttachments(store, []byte("key"), time.Minute))
+
+	expired, err := store.PutBlob(t.Context(), "text/plain", strings.NewReader("expired"))
+	require.NoError(t, err)
+
+	past := time.Now().Add(-2 * time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, expired), past, past))
+
+	valid, err := store.PutBlob(t.Context(), "text/plain", strings.NewReader("valid"))
+	require.NoError(t, err)
+
+	hub.pruneAttachments(t.Context())
+
+	_, _, err = store.OpenBlob(t.Context(), expired)
+	require.ErrorIs(t, err, ErrBlobNotFound)
+
+	rc, _, err := store.OpenBlob(t.Context(), valid)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+
+	require.NoError(t, store.DeleteBlob(t.Context(), valid))
+	require.NoError(t, store.DeleteBlob(t.Context(), valid))
+
+	_, _, err = store.OpenBlob(t.Context(), valid)
+	require.ErrorIs(t, err, ErrBlobNotFound)
+}
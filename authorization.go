@@ -1,6 +1,7 @@
 package mercure
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
@@ -20,12 +21,49 @@ type claims struct {
 	// AuthorizationDetails carries the RFC 9396 authorization_details claim.
 	AuthorizationDetails []authorizationDetail `json:"authorization_details,omitempty"`
 
+	// Locale is the OpenID Connect locale claim, the BCP 47 language tag
+	// selecting the variant of the localized updates.
+	Locale string `json:"locale,omitempty"`
+
 	// authz holds the validated mercure authorization details (and, under the
 	// deprecated_claim tag in compatibility mode, the legacy mercure claim
 	// resolved into the same shape). Unexported, so it is never (un)marshaled.
 	authz *mercureAuthz
 }
 
+// unmarshalNamespaced replaces the claims specific to the hub with the ones
+// prefixed with the namespace in the payload of the verified token.
+func (c *claims) unmarshalNamespaced(encodedToken, namespace string) error {
+	parts := strings.Split(encodedToken, ".")
+
+	payload, err := jwt.NewParser().DecodeSegment(parts[1])
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	c.AuthorizationDetails = nil
+	c.Locale = ""
+
+	if v, ok := raw[namespace+"authorization_details"]; ok {
+		if err := json.Unmarshal(v, &c.AuthorizationDetails); err != nil {
+			return fmt.Errorf("%q claim: %w", namespace+"authorization_details", err)
+		}
+	}
+
+	if v, ok := raw[namespace+"locale"]; ok {
+		if err := json.Unmarshal(v, &c.Locale); err != nil {
+			return fmt.Errorf("%q claim: %w", namespace+"locale", err)
+		}
+	}
+
+	return nil
+}
+
 type role int
 
 const (
@@ -84,14 +122,21 @@ func (w wildcard) match(s string) bool {
 func (h *Hub) authorize(r *http.Request, publish bool) (*claims, error) { //nolint:funlen
 	authorizationHeaders, authorizationHeaderExists := r.Header["Authorization"]
 	if authorizationHeaderExists {
-		// The token must be at least minCompactJWSLen bytes after the prefix.
-		// The auth scheme is matched case-insensitively per RFC 9110 §11.1.
-		if len(authorizationHeaders) != 1 || len(authorizationHeaders[0]) < len(bearerPrefix)+minCompactJWSLen ||
-			!strings.EqualFold(authorizationHeaders[0][:len(bearerPrefix)], bearerPrefix) {
-			return nil, ErrInvalidAuthorizationHeader
+		token, err := bearerToken(authorizationHeaders)
+		if err != nil {
+			return nil, err
 		}
 
-		return h.validateJWT(authorizationHeaders[0][len(bearerPrefix):], publish)
+		c, err := h.validateJWT(token, publish)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := h.checkQueryToken(r, c, publish); err != nil {
+			return nil, err
+		}
+
+		return c, nil
 	}
 
 	// The deprecated "authorization" query parameter is honored only in
@@ -113,52 +158,86 @@ func (h *Hub) authorize(r *http.Request, publish bool) (*claims, error) { //noli
 		return h.validateJWT(cookie.Value, publish)
 	}
 
+	if err := h.checkPublishOrigin(r); err != nil {
+		return nil, err
+	}
+
+	return h.validateJWT(cookie.Value, publish)
+}
+
+// authorizedWithCookie reports whether authorize reads the token of the
+// request from the authorization cookie.
+func (h *Hub) authorizedWithCookie(r *http.Request) bool {
+	if _, ok := r.Header["Authorization"]; ok {
+		return false
+	}
+
+	if _, ok := h.legacyAuthQueryParam(r); ok {
+		return false
+	}
+
+	_, err := h.readCookie(r)
+
+	return err == nil
+}
+
+// checkPublishOrigin checks that the origin of a request authorized with the
+// cookie is allowed to publish, to prevent CSRF attacks.
+func (h *Hub) checkPublishOrigin(r *http.Request) error {
 	origin := r.Header.Get("Origin")
 	if origin == "" {
 		// Try to extract the origin from the Referer, or return an error
 		referer := r.Header.Get("Referer")
 		if referer == "" {
-			return nil, ErrNoOrigin
+			return ErrNoOrigin
 		}
 
 		u, err := url.Parse(referer)
 		if err != nil {
-			return nil, fmt.Errorf("unable to parse referer: %w", err)
+			return fmt.Errorf("unable to parse referer: %w", err)
 		}
 
 		origin = fmt.Sprintf("%s://%s", u.Scheme, u.Host)
 	}
 
-	if h.publishOriginsAll {
-		return h.validateJWT(cookie.Value, publish)
-	}
-
-	if slices.Contains(h.publishOrigins, origin) {
-		return h.validateJWT(cookie.Value, publish)
+	if h.publishOriginsAll || slices.Contains(h.publishOrigins, origin) {
+		return nil
 	}
 
 	for _, allowedOrigin := range h.publishWOrigins {
 		if allowedOrigin.match(origin) {
-			return h.validateJWT(cookie.Value, publish)
+			return nil
 		}
 	}
 
-	return nil, fmt.Errorf("%q: %w", origin, ErrOriginNotAllowed)
+	return fmt.Errorf("%q: %w", origin, ErrOriginNotAllowed)
+}
+
+// bearerToken extracts the token from the values of an Authorization header.
+// The token must be at least minCompactJWSLen bytes after the prefix. The auth
+// scheme is matched case-insensitively per RFC 9110 §11.1.
+func bearerToken(authorizationHeaders []string) (string, error) {
+	if len(authorizationHeaders) != 1 || len(authorizationHeaders[0]) < len(bearerPrefix)+minCompactJWSLen ||
+		!strings.EqualFold(authorizationHeaders[0][:len(bearerPrefix)], bearerPrefix) {
+		return "", ErrInvalidAuthorizationHeader
+	}
+
+	return authorizationHeaders[0][len(bearerPrefix):], nil
 }
 
 // jwtParserOptions returns the RFC 9068 parser checks enforced in modern mode:
-// a required audience matching the hub's resource identifier and a required
-// exp. In compatibility mode (deprecated_claim builds with
+// a required audience matching the hub's resource identifier, or one of the
+// audiences of the issuer, and a required exp. In compatibility mode (deprecated_claim builds with
 // WithProtocolVersionCompatibility) these checks are relaxed. The accepted
 // algorithms are pinned here (RFC 8725) so the algorithm can never be taken
 // from the token header: they come from the selected issuer's Verifier (a
 // Static pins its one algorithm, a KeyFunc its allowlist, defaulting to the
 // asymmetric algorithms), so algs is only empty in compatibility mode.
-func (h *Hub) jwtParserOptions(algs []string) []jwt.ParserOption {
+func (h *Hub) jwtParserOptions(rv roleVerifier) []jwt.ParserOption {
 	var opts []jwt.ParserOption
 
-	if len(algs) > 0 {
-		opts = append(opts, jwt.WithValidMethods(algs))
+	if len(rv.algorithms) > 0 {
+		opts = append(opts, jwt.WithValidMethods(rv.algorithms))
 	}
 
 	if h.compatClaimsEnabled() {
@@ -167,6 +246,10 @@ func (h *Hub) jwtParserOptions(algs []string) []jwt.ParserOption {
 
 	opts = append(opts, jwt.WithExpirationRequired())
 
+	if len(rv.audiences) > 0 {
+		return append(opts, jwt.WithAudience(rv.audiences...))
+	}
+
 	// Enforce the audience only when a resource identifier is configured.
 	// Compatibility mode on a build without the deprecated_claim tag still
 	// reaches this path (compatClaimsEnabled is a no-op stub there) with an
@@ -214,14 +297,19 @@ func (h *Hub) selectVerifier(encodedToken string, publish bool) (roleVerifier, e
 }
 
 // validateJWT parses and validates an access token, returning its claims with
-// the mercure authorization details resolved into c.authz.
+// the mercure authorization details resolved into c.authz. The opaque tokens
+// are validated by the introspection endpoint, see WithTokenIntrospection.
 func (h *Hub) validateJWT(encodedToken string, publish bool) (*claims, error) {
+	if h.introspector != nil && !isJWS(encodedToken) {
+		return h.introspectToken(encodedToken)
+	}
+
 	rv, err := h.selectVerifier(encodedToken, publish)
 	if err != nil {
 		return nil, err
 	}
 
-	token, err := jwt.ParseWithClaims(encodedToken, &claims{}, rv.keyfunc, h.jwtParserOptions(rv.algorithms)...)
+	token, err := jwt.ParseWithClaims(encodedToken, &claims{}, rv.keyfunc, h.jwtParserOptions(rv)...)
 	if err != nil {
 		// Signature, audience, expiration and algorithm failures are all
 		// invalid-token conditions; classify them as such for RFC 6750.
@@ -233,6 +321,12 @@ func (h *Hub) validateJWT(encodedToken string, publish bool) (*claims, error) {
 		return nil, ErrInvalidJWT
 	}
 
+	if rv.claimNamespace != "" {
+		if err := c.unmarshalNamespaced(encodedToken, rv.claimNamespace); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidJWT, err)
+		}
+	}
+
 	// RFC 9068: reject tokens not issued as JWT access tokens, so a token
 	// minted for another purpose (e.g. an OpenID Connect ID Token) is not
 	// accepted. The media type is matched case-insensitively, including the
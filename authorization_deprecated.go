@@ -100,32 +100,37 @@ func (h *Hub) resolveLegacyClaims(c *claims) error {
 }
 
 // mercureAuthzFromLegacy builds a mercureAuthz from a resolved legacy claim,
-// one subscribe detail per claim so per-claim payloads are preserved.
+// one detail per claim so per-claim payloads and rates are preserved.
 func mercureAuthzFromLegacy(mc mercureClaim) *mercureAuthz {
 	authz := &mercureAuthz{}
 
-	if len(mc.Publish) > 0 {
-		authz.details = append(authz.details, validatedDetail{publish: true, topics: matcherClaimTopics(mc.Publish)})
+	for _, pc := range mc.Publish {
+		authz.details = append(authz.details, legacyDetail(pc, true))
 	}
 
 	for _, sc := range mc.Subscribe {
-		authz.details = append(authz.details, validatedDetail{
-			subscribe: true,
-			topics:    []TopicMatcher{sc.TopicMatcher},
-			payload:   sc.Payload,
-		})
+		authz.details = append(authz.details, legacyDetail(sc, false))
 	}
 
 	return authz
 }
 
-func matcherClaimTopics(claims []matcherClaim) []TopicMatcher {
-	topics := make([]TopicMatcher, len(claims))
-	for i := range claims {
-		topics[i] = claims[i].TopicMatcher
+func legacyDetail(c matcherClaim, publish bool) validatedDetail {
+	d := validatedDetail{
+		publish:   publish,
+		subscribe: !publish,
+		topics:    []TopicMatcher{c.TopicMatcher},
 	}
 
-	return topics
+	if !publish {
+		d.payload = c.Payload
+	}
+
+	if c.MaxRate != nil {
+		d.maxRate = *c.MaxRate
+	}
+
+	return d
 }
 
 // legacyPayloadFallback returns the global mercure.payload, used when no
@@ -515,3 +515,92 @@ func TestMultiIssuerRoleWithoutVerifier(t *testing.T) {
 	require.ErrorIs(t, err, ErrInvalidJWT)
 	require.Nil(t, claims)
 }
+
+// An issuer with its own audiences and claim namespace accepts the tokens
+// minted for its audiences, reading the namespaced claims only, while the
+// other issuers keep the resource identifier of the hub.
+func TestMultiIssuerAudiencesAndClaimNamespace(t *testing.T) {
+	t.Parallel()
+
+	const (
+		issuerA, issuerB = "https://a.example", "https://b.example"
+		namespace        = "https://mercure.example.com/"
+	)
+
+	keyA, keyB := []byte("key-a"), []byte("key-b")
+
+	tms, err := NewTopicMatcherStore(0)
+	require.NoError(t, err)
+
+	h, err := NewHub(t.Context(),
+		WithResourceIdentifier(testResourceIdentifier),
+		WithTopicMatcherStore(tms),
+		WithIssuers([]Issuer{
+			{Identifier: issuerA, Subscriber: Static{Key: keyA, Algorithm: "HS256"}},
+			{
+				Identifier:     issuerB,
+				Audiences:      []string{"mercure-app"},
+				ClaimNamespace: namespace,
+				Subscriber:     Static{Key: keyB, Algorithm: "HS256"},
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	details := subscribeDetailsFromMatchers(nil, TopicMatcher{Type: MatcherTypeExact, Pattern: "foo"})
+
+	sign := func(key []byte, issuer, audience string, namespaced bool) string {
+		c := jwt.MapClaims{
+			"iss": issuer,
+			"aud": audience,
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+
+		if namespaced {
+			c[namespace+"authorization_details"] = details
+			c[namespace+"locale"] = "fr"
+		} else {
+			c["authorization_details"] = details
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, c)
+		token.Header["typ"] = atJWTType
+
+		s, err := token.SignedString(key)
+		require.NoError(t, err)
+
+		return s
+	}
+
+	for name, tc := range map[string]struct {
+		token   string
+		granted bool
+		locale  string
+		wantErr bool
+	}{
+		"issuer A, resource identifier": {sign(keyA, issuerA, testResourceIdentifier, false), true, "", false},
+		"issuer A, audience of B":       {sign(keyA, issuerA, "mercure-app", false), false, "", true},
+		"issuer A, namespaced claims":   {sign(keyA, issuerA, testResourceIdentifier, true), false, "", false},
+		"issuer B, namespaced claims":   {sign(keyB, issuerB, "mercure-app", true), true, "fr", false},
+		"issuer B, unnamespaced claims": {sign(keyB, issuerB, "mercure-app", false), false, "", false},
+		"issuer B, resource identifier": {sign(keyB, issuerB, testResourceIdentifier, true), false, "", true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			r, _ := http.NewRequest(http.MethodGet, defaultHubURL, nil)
+			r.Header.Add("Authorization", bearerPrefix+tc.token)
+
+			claims, err := h.authorize(r, false)
+			if tc.wantErr {
+				require.ErrorIs(t, err, ErrInvalidJWT)
+
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tc.granted, claims.authz.grants(h.topicMatcherStore, actionSubscribe, "foo"))
+			assert.Equal(t, tc.locale, claims.Locale)
+		})
+	}
+}
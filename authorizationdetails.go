@@ -44,6 +44,7 @@ type authorizationDetail struct {
 	Actions []mercureAction `json:"actions"`
 	Topics  []detailTopic   `json:"topics"`
 	Payload any             `json:"payload,omitempty"`
+	MaxRate *float64        `json:"max_rate,omitempty"`
 }
 
 // UnmarshalJSON decodes the type of every entry but the mercure-specific
@@ -69,6 +70,7 @@ func (ad *authorizationDetail) UnmarshalJSON(data []byte) error {
 		Actions []mercureAction `json:"actions"`
 		Topics  []detailTopic   `json:"topics"`
 		Payload any             `json:"payload"`
+		MaxRate *float64        `json:"max_rate"`
 	}
 
 	if err := json.Unmarshal(data, &body); err != nil {
@@ -78,6 +80,7 @@ func (ad *authorizationDetail) UnmarshalJSON(data []byte) error {
 	ad.Actions = body.Actions
 	ad.Topics = body.Topics
 	ad.Payload = body.Payload
+	ad.MaxRate = body.MaxRate
 
 	return nil
 }
@@ -144,6 +147,10 @@ type validatedDetail struct {
 	subscribe bool
 	topics    []TopicMatcher
 	payload   any
+	// maxRate is the number of updates per second the detail allows, on the
+	// topics it is the first to grant: published by the publisher, or
+	// delivered to each subscription. 0 means unlimited.
+	maxRate float64
 }
 
 // mercureAuthz holds the validated mercure authorization details of a token.
@@ -204,7 +211,7 @@ func validateProtocolMatcher(tms *TopicMatcherStore, m TopicMatcher) error {
 		return err
 	}
 
-	if !knownMatcherType(m.Type) {
+	if !tms.supportsMatcherType(m.Type) {
 		return ErrUnsupportedMatcherType
 	}
 
@@ -231,6 +238,11 @@ func validateMatcherValue(pattern string) error {
 func validateMercureDetail(tms *TopicMatcherStore, d authorizationDetail) (validatedDetail, error) {
 	vd := validatedDetail{payload: d.Payload}
 
+	var err error
+	if vd.maxRate, err = validateMaxRate(d.MaxRate); err != nil {
+		return vd, fmt.Errorf("%w: %w", errInvalidAuthorizationDetail, err)
+	}
+
 	if len(d.Actions) == 0 {
 		return vd, fmt.Errorf("%w: a mercure detail must declare at least one action", errInvalidAuthorizationDetail)
 	}
@@ -295,8 +307,36 @@ func (a *mercureAuthz) hasPayload() bool {
 
 // grants reports whether the token authorizes the given action on the topic.
 func (a *mercureAuthz) grants(tms *TopicMatcherStore, action mercureAction, topic string) bool {
+	_, ok := a.grantingMatcher(tms, action, topic)
+
+	return ok
+}
+
+// grantingMatcher returns the first topic matcher of a detail carrying the
+// given action that matches the topic. The boolean reports whether one was
+// found.
+func (a *mercureAuthz) grantingMatcher(tms *TopicMatcherStore, action mercureAction, topic string) (TopicMatcher, bool) {
+	i, j := a.granting(tms, action, topic)
+	if i < 0 {
+		return TopicMatcher{}, false
+	}
+
+	return a.details[i].topics[j], true
+}
+
+// grantingDetail returns the index of the first detail carrying the given
+// action that matches the topic, or -1.
+func (a *mercureAuthz) grantingDetail(tms *TopicMatcherStore, action mercureAction, topic string) int {
+	i, _ := a.granting(tms, action, topic)
+
+	return i
+}
+
+// granting returns the indexes of the first detail carrying the given action
+// that matches the topic and of its matching matcher, or -1.
+func (a *mercureAuthz) granting(tms *TopicMatcherStore, action mercureAction, topic string) (int, int) {
 	if a == nil {
-		return false
+		return -1, -1
 	}
 
 	single := []string{topic}
@@ -306,14 +346,14 @@ func (a *mercureAuthz) grants(tms *TopicMatcherStore, action mercureAction, topi
 			continue
 		}
 
-		for _, m := range a.details[i].topics {
+		for j, m := range a.details[i].topics {
 			if tms.matches(single, m) {
-				return true
+				return i, j
 			}
 		}
 	}
 
-	return false
+	return -1, -1
 }
 
 // grantsAll reports whether the token authorizes the action on every topic.
@@ -1,9 +1,14 @@
 package mercure
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"slices"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -213,3 +218,71 @@ func TestMercureAuthzSubscribePayload(t *testing.T) {
 	// Matchers carrying every subscribe topic.
 	assert.Len(t, authz.subscribeMatchers(), 2)
 }
+
+func FuzzValidateAuthorizationDetails(f *testing.F) {
+	tms := newTestTSS(f)
+
+	for _, seed := range []string{
+		`[{"type": "mercure", "actions": ["subscribe"], "topics": ["https://example.com/books/1"]}]`,
+		`[{"type": "mercure", "actions": ["publish", "subscribe"], "topics": [{"match": "https://example.com/*", "match_type": "urlpattern"}], "payload": {"foo": "bar"}}]`,
+		`[{"type": "mercure", "actions": ["subscribe"], "topics": ["*"]}, {"type": "other"}]`,
+		`[{"type": "mercure", "actions": [], "topics": []}]`,
+		`[{"type": "mercure", "actions": ["subscribe"], "topics": [{"match": "(", "match_type": "urlpattern"}]}]`,
+	} {
+		f.Add(seed, "https://example.com/books/1")
+	}
+
+	f.Fuzz(func(t *testing.T, raw, topic string) {
+		var details []authorizationDetail
+		if json.Unmarshal([]byte(raw), &details) != nil {
+			return
+		}
+
+		authz, err := validateAuthorizationDetails(tms, details)
+		if err != nil {
+			return
+		}
+
+		// A granted topic is granted by the matchers the subscriber gets.
+		if authz.grants(tms, actionSubscribe, topic) {
+			assert.True(t, slices.ContainsFunc(authz.subscribeMatchers(), func(m TopicMatcher) bool {
+				return tms.matches([]string{topic}, m)
+			}))
+		}
+	})
+}
+
+func FuzzValidateJWT(f *testing.F) {
+	hub := createDummy(f)
+	exp := time.Now().Add(time.Hour).Unix()
+
+	for _, seed := range [][2]string{
+		{`{"alg": "HS256", "typ": "at+jwt"}`, `{"iss": "` + testIssuer + `", "aud": "` + testResourceIdentifier + `", "exp": ` + strconv.FormatInt(exp, 10) + `, "authorization_details": [{"type": "mercure", "actions": ["publish"], "topics": ["*"]}]}`},
+		{`{"alg": "HS256", "typ": "application/AT+JWT"}`, `{"iss": "` + testIssuer + `", "aud": ["` + testResourceIdentifier + `"], "exp": ` + strconv.FormatInt(exp, 10) + `}`},
+		{`{"alg": "none"}`, `{"iss": "` + testIssuer + `"}`},
+		{`{"alg": "HS256", "typ": "at+jwt"}`, `{"iss": "https://other.example.com", "aud": "` + testResourceIdentifier + `", "exp": 0}`},
+		{`{}`, `[]`},
+	} {
+		f.Add(seed[0], seed[1])
+	}
+
+	f.Fuzz(func(t *testing.T, header, payload string) {
+		signingString := base64.RawURLEncoding.EncodeToString([]byte(header)) + "." + base64.RawURLEncoding.EncodeToString([]byte(payload))
+
+		signature, err := jwt.SigningMethodHS256.Sign(signingString, []byte("publisher"))
+		require.NoError(t, err)
+
+		c, err := hub.validateJWT(signingString+"."+base64.RawURLEncoding.EncodeToString(signature), true)
+		if err != nil {
+			assert.Nil(t, c)
+
+			return
+		}
+
+		// Accepted tokens are trusted access tokens for this hub.
+		require.NotNil(t, c)
+		assert.Equal(t, testIssuer, c.Issuer)
+		assert.Contains(t, c.Audience, testResourceIdentifier)
+		assert.NotNil(t, c.ExpiresAt)
+	})
+}
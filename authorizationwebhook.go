@@ -0,0 +1,473 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/maypok86/otter/v2"
+)
+
+const (
+	defaultAuthorizationWebhookTimeout   = 5 * time.Second
+	defaultAuthorizationWebhookCacheTTL  = 10 * time.Second
+	defaultAuthorizationWebhookCacheSize = 10_000
+	defaultAuthorizationWebhookFailures  = 5
+	defaultAuthorizationWebhookOpen      = 30 * time.Second
+	// maxAuthorizationWebhookResponseSize bounds the size of the responses of
+	// the authorization webhook.
+	maxAuthorizationWebhookResponseSize = 1 << 20
+)
+
+var (
+	// ErrInvalidAuthorizationWebhook is returned by WithAuthorizationWebhook
+	// when the configuration is not valid.
+	ErrInvalidAuthorizationWebhook = errors.New("invalid authorization webhook configuration")
+	// ErrAuthorizationWebhookUnavailable is returned when the authorization
+	// webhook can't be reached, doesn't answer with a valid decision, or when
+	// its circuit breaker is open.
+	ErrAuthorizationWebhookUnavailable = errors.New("authorization webhook unavailable")
+
+	// errAuthorizationDenied is returned when the authorization webhook denies
+	// a request, or when the claims don't grant it.
+	errAuthorizationDenied = errors.New("authorization denied")
+	// errAuthorizationWebhookStatus is returned when the authorization webhook
+	// answers with a status code other than 200.
+	errAuthorizationWebhookStatus = errors.New("unexpected authorization webhook status")
+	// errMissingAllow is returned when the decision of the authorization
+	// webhook has no allow member.
+	errMissingAllow = errors.New(`missing "allow" member`)
+)
+
+// AuthorizationWebhook configures the external service authorizing the
+// subscriptions and the publications, see WithAuthorizationWebhook.
+type AuthorizationWebhook struct {
+	// URL is the endpoint of the service.
+	URL string
+	// Client is the HTTP client calling the service, a client with a timeout
+	// of 5 seconds by default. Custom clients must have a timeout too.
+	Client *http.Client
+	// CacheTTL is how long the decisions are cached, 10 seconds by default,
+	// never past the expiration time of the token. A negative value disables
+	// the cache.
+	CacheTTL time.Duration
+	// CacheSize is the maximum number of decisions cached, 10000 by default.
+	CacheSize int
+	// FailureThreshold is the number of consecutive failures of the service
+	// opening the circuit breaker, 5 by default.
+	FailureThreshold int
+	// OpenDuration is how long the circuit breaker stays open, refusing the
+	// requests without calling the service, before letting a request try it
+	// again, 30 seconds by default.
+	OpenDuration time.Duration
+}
+
+// authorizationWebhook calls the authorization webhook.
+type authorizationWebhook struct {
+	AuthorizationWebhook
+
+	cache   *otter.Cache[string, *authorizationDecision]
+	breaker circuitBreaker
+}
+
+// authorizationRequest is the document POSTed to the webhook.
+type authorizationRequest struct {
+	Action mercureAction `json:"action"`
+	// Token is the access token of the request, empty for the anonymous
+	// subscribers.
+	Token string `json:"token,omitempty"`
+	// Topics are the topics of the update, for the publications.
+	Topics []string `json:"topics,omitempty"`
+	// Private is true for the private updates.
+	Private bool `json:"private,omitempty"`
+	// Matchers are the topic selectors of the subscriptions.
+	Matchers []detailTopic       `json:"matchers,omitempty"`
+	Client   authorizationClient `json:"client"`
+}
+
+// authorizationClient is the metadata of the client sent to the webhook.
+type authorizationClient struct {
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	UserAgent  string `json:"user_agent,omitempty"`
+	Origin     string `json:"origin,omitempty"`
+}
+
+// authorizationDecision is the decision of the webhook.
+type authorizationDecision struct {
+	allow bool
+	// authz replaces the grants of the token for the action, when the
+	// webhook returned topic selectors.
+	authz   *mercureAuthz
+	expires time.Time
+}
+
+// WithAuthorizationWebhook delegates the authorization of the subscriptions
+// and the publications to an external service: once the token of a request
+// has been validated, the hub POSTs a JSON document with the action
+// ("subscribe" or "publish"), the token, the requested topic selectors or the
+// topics of the update, and metadata of the client, to the URL of the
+// service. It answers with a JSON document whose allow member tells whether
+// the request is authorized, and whose optional topics member holds the topic
+// selectors replacing the grants of the token for the action: exact topics as
+// strings, or objects with the match and match_type members of the topics of
+// the authorization details. Without topics, the grants of the token apply.
+//
+// The decisions are cached. Requests are refused when the service is
+// unavailable and, after FailureThreshold consecutive failures, a circuit
+// breaker refuses them without calling the service during OpenDuration, to
+// let it recover. All the subscriptions and the publications are authorized
+// by the service, whatever the API: the SSE, WebSocket, long-polling, history
+// and capability endpoints, the publish, group and retract endpoints, the
+// publications over WebSocket, and the gRPC API.
+func WithAuthorizationWebhook(aw AuthorizationWebhook) Option {
+	return func(o *opt) error {
+		u, err := url.Parse(aw.URL)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidAuthorizationWebhook, err)
+		}
+
+		if !u.IsAbs() {
+			return fmt.Errorf("%w: the URL must be absolute", ErrInvalidAuthorizationWebhook)
+		}
+
+		if aw.CacheSize < 0 || aw.FailureThreshold < 0 || aw.OpenDuration < 0 {
+			return fmt.Errorf("%w: negative value", ErrInvalidAuthorizationWebhook)
+		}
+
+		if aw.Client == nil {
+			aw.Client = &http.Client{Timeout: defaultAuthorizationWebhookTimeout}
+		}
+
+		if aw.CacheTTL == 0 {
+			aw.CacheTTL = defaultAuthorizationWebhookCacheTTL
+		}
+
+		if aw.CacheSize == 0 {
+			aw.CacheSize = defaultAuthorizationWebhookCacheSize
+		}
+
+		if aw.FailureThreshold == 0 {
+			aw.FailureThreshold = defaultAuthorizationWebhookFailures
+		}
+
+		if aw.OpenDuration == 0 {
+			aw.OpenDuration = defaultAuthorizationWebhookOpen
+		}
+
+		w := &authorizationWebhook{AuthorizationWebhook: aw}
+		w.breaker.threshold = aw.FailureThreshold
+		w.breaker.openDuration = aw.OpenDuration
+
+		if aw.CacheTTL > 0 {
+			if w.cache, err = otter.New(&otter.Options[string, *authorizationDecision]{
+				MaximumSize: aw.CacheSize,
+				ExpiryCalculator: otter.ExpiryCreatingFunc(func(e otter.Entry[string, *authorizationDecision]) time.Duration {
+					return time.Until(e.Value.expires)
+				}),
+			}); err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidAuthorizationWebhook, err)
+			}
+		}
+
+		o.authorizationWebhook = w
+
+		return nil
+	}
+}
+
+// authorizationCaller is what the authorization webhook is told about the
+// caller of a request.
+type authorizationCaller struct {
+	token  string
+	client authorizationClient
+}
+
+// httpCaller returns the caller of an HTTP request.
+func (h *Hub) httpCaller(r *http.Request) authorizationCaller {
+	caller := authorizationCaller{
+		token:  h.requestToken(r),
+		client: authorizationClient{UserAgent: r.UserAgent(), Origin: r.Header.Get("Origin")},
+	}
+
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		caller.client.RemoteAddr = host
+	}
+
+	return caller
+}
+
+// authorizePublication is the authorization step of all the publications:
+// the authorization webhook, if any, decides first, then the claims must
+// grant publishing the update. It returns the claims to use, see
+// authorizeWithWebhook. The error is errAuthorizationDenied when the
+// publication is not allowed.
+func (h *Hub) authorizePublication(ctx context.Context, caller authorizationCaller, c *claims, topics []string, private bool) (*claims, error) {
+	if h.authorizationWebhook != nil {
+		var err error
+		if c, err = h.authorizeWithWebhook(ctx, caller, c, authorizationRequest{Action: actionPublish, Topics: topics, Private: private}); err != nil {
+			return nil, err
+		}
+	}
+
+	if !h.canPublish(ctx, c, topics, private) {
+		return nil, errAuthorizationDenied
+	}
+
+	return c, nil
+}
+
+// authorizeSubscription is the authorization step of all the subscriptions,
+// asking the authorization webhook, if any. It returns the claims to use, see
+// authorizeWithWebhook.
+func (h *Hub) authorizeSubscription(ctx context.Context, caller authorizationCaller, c *claims, matchers []TopicMatcher) (*claims, error) {
+	if h.authorizationWebhook == nil {
+		return c, nil
+	}
+
+	return h.authorizeWithWebhook(ctx, caller, c, authorizationRequest{Action: actionSubscribe, Matchers: detailTopics(matchers)})
+}
+
+// authorizeWithWebhook asks the webhook to authorize the request, and returns
+// the claims to use: the ones of the token, with the grants for the action
+// replaced by the ones returned by the webhook, if any.
+func (h *Hub) authorizeWithWebhook(ctx context.Context, caller authorizationCaller, c *claims, ar authorizationRequest) (*claims, error) {
+	ar.Token = caller.token
+	ar.Client = caller.client
+
+	body, err := json.Marshal(ar)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrAuthorizationWebhookUnavailable, err)
+	}
+
+	aw := h.authorizationWebhook
+	ctx = context.WithoutCancel(ctx)
+
+	var d *authorizationDecision
+
+	if aw.cache == nil {
+		d, err = h.callAuthorizationWebhook(ctx, c, ar.Action, body)
+	} else {
+		sum := sha256.Sum256(body)
+		d, err = aw.cache.Get(ctx, base64.RawURLEncoding.EncodeToString(sum[:]), otter.LoaderFunc[string, *authorizationDecision](func(ctx context.Context, _ string) (*authorizationDecision, error) {
+			return h.callAuthorizationWebhook(ctx, c, ar.Action, body)
+		}))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !d.allow {
+		return nil, errAuthorizationDenied
+	}
+
+	if d.authz == nil {
+		return c, nil
+	}
+
+	var authorized claims
+	if c != nil {
+		authorized = *c
+	}
+
+	authorized.authz = d.authz
+
+	return &authorized, nil
+}
+
+// writeAuthorizationError answers a request authorizePublication or
+// authorizeSubscription didn't authorize.
+func (h *Hub) writeAuthorizationError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errAuthorizationDenied) {
+		h.writeBearerError(w, bearerErrInsufficientScope, http.StatusForbidden)
+
+		return
+	}
+
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+	if ctx := r.Context(); h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Authorization error", slog.Any("error", err))
+	}
+}
+
+// detailTopics converts topic matchers to the topics of authorization
+// details.
+func detailTopics(matchers []TopicMatcher) []detailTopic {
+	topics := make([]detailTopic, len(matchers))
+	for i, m := range matchers {
+		topics[i] = detailTopic{m}
+	}
+
+	return topics
+}
+
+// requestToken returns the access token of the request, if any.
+func (h *Hub) requestToken(r *http.Request) string {
+	if v, ok := r.Header["Authorization"]; ok {
+		if token, err := bearerToken(v); err == nil {
+			return token
+		}
+	}
+
+	if cookie, err := h.readCookie(r); err == nil {
+		return cookie.Value
+	}
+
+	return ""
+}
+
+// callAuthorizationWebhook POSTs the authorization request to the webhook,
+// unless the circuit breaker is open.
+func (h *Hub) callAuthorizationWebhook(ctx context.Context, c *claims, action mercureAction, body []byte) (*authorizationDecision, error) {
+	aw := h.authorizationWebhook
+
+	if !aw.breaker.allow(time.Now()) {
+		return nil, fmt.Errorf("%w: circuit breaker open", ErrAuthorizationWebhookUnavailable)
+	}
+
+	d, err := aw.decide(ctx, h.topicMatcherStore, action, body)
+	if err != nil {
+		if aw.breaker.failure(time.Now()) && h.logger.Enabled(ctx, slog.LevelWarn) {
+			h.logger.LogAttrs(ctx, slog.LevelWarn, "Authorization webhook circuit breaker opened", slog.Any("error", err))
+		} else if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Authorization webhook failed", slog.Any("error", err))
+		}
+
+		return nil, fmt.Errorf("%w: %w", ErrAuthorizationWebhookUnavailable, err)
+	}
+
+	aw.breaker.success()
+
+	d.expires = time.Now().Add(aw.CacheTTL)
+	if c != nil && c.ExpiresAt != nil && c.ExpiresAt.Before(d.expires) {
+		d.expires = c.ExpiresAt.Time
+	}
+
+	return d, nil
+}
+
+// decide calls the webhook.
+func (aw *authorizationWebhook) decide(ctx context.Context, tms *TopicMatcherStore, action mercureAction, body []byte) (*authorizationDecision, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, aw.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := aw.Client.Do(req)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %d", errAuthorizationWebhookStatus, resp.StatusCode)
+	}
+
+	var decision struct {
+		Allow  *bool           `json:"allow"`
+		Topics json.RawMessage `json:"topics"`
+	}
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxAuthorizationWebhookResponseSize)).Decode(&decision); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if decision.Allow == nil {
+		return nil, errMissingAllow
+	}
+
+	d := &authorizationDecision{allow: *decision.Allow}
+	if !d.allow || len(decision.Topics) == 0 || string(decision.Topics) == "null" {
+		return d, nil
+	}
+
+	topics, err := parseTopicSelectors(decision.Topics)
+	if err != nil {
+		return nil, fmt.Errorf(`"topics" member: %w`, err)
+	}
+
+	if d.authz, err = validateAuthorizationDetails(tms, []authorizationDetail{{
+		Type:    authorizationDetailTypeMercure,
+		Actions: []mercureAction{action},
+		Topics:  topics,
+	}}); err != nil {
+		return nil, fmt.Errorf(`"topics" member: %w`, err)
+	}
+
+	return d, nil
+}
+
+// circuitBreaker stops calling a failing service for a while.
+type circuitBreaker struct {
+	threshold    int
+	openDuration time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	// probing is true while a request tries the service again, after the
+	// breaker has been open.
+	probing bool
+}
+
+// allow reports whether the service can be called.
+func (b *circuitBreaker) allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+
+	if now.Before(b.openUntil) || b.probing {
+		return false
+	}
+
+	b.probing = true
+
+	return true
+}
+
+// failure records a failure of the service, and reports whether it opened
+// the breaker.
+func (b *circuitBreaker) failure(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+
+	if !b.probing && (!b.openUntil.IsZero() || b.failures < b.threshold) {
+		return false
+	}
+
+	wasClosed := b.openUntil.IsZero()
+	b.openUntil = now.Add(b.openDuration)
+	b.probing = false
+
+	return wasClosed
+}
+
+// success records a success of the service, closing the breaker.
+func (b *circuitBreaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.openUntil = time.Time{}
+	b.probing = false
+}
@@ -0,0 +1,274 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dunglas/mercure/mercurepb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// newAuthorizationWebhookServer starts a webhook allowing the requests for
+// https://example.com/books/1, granting it to the subscribers, and counting
+// the requests.
+func newAuthorizationWebhookServer(t *testing.T, requests chan<- authorizationRequest) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		var ar authorizationRequest
+		if !assert.NoError(t, json.NewDecoder(r.Body).Decode(&ar)) {
+			return
+		}
+
+		if requests != nil {
+			requests <- ar
+		}
+
+		var decision map[string]any
+
+		switch {
+		case ar.Action == actionSubscribe && len(ar.Matchers) == 1 && ar.Matchers[0].Pattern == "https://example.com/books/1":
+			decision = map[string]any{"allow": true, "topics": []string{"https://example.com/books/1"}}
+		case ar.Action == actionPublish && len(ar.Topics) == 1 && ar.Topics[0] == "https://example.com/books/1":
+			decision = map[string]any{"allow": true}
+		default:
+			decision = map[string]any{"allow": false}
+		}
+
+		assert.NoError(t, json.NewEncoder(w).Encode(decision))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &calls
+}
+
+func TestWithAuthorizationWebhookInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, aw := range []AuthorizationWebhook{
+		{URL: "/authorize"},
+		{URL: "https://example.com/authorize", FailureThreshold: -1},
+	} {
+		_, err := NewHub(t.Context(), WithAuthorizationWebhook(aw))
+		require.ErrorIs(t, err, ErrInvalidAuthorizationWebhook)
+	}
+}
+
+func TestAuthorizationWebhookSubscribe(t *testing.T) {
+	t.Parallel()
+
+	requests := make(chan authorizationRequest, 10)
+	srv, _ := newAuthorizationWebhookServer(t, requests)
+	hub := createAnonymousDummy(t, WithAuthorizationWebhook(AuthorizationWebhook{URL: srv.URL}))
+
+	// The webhook grants the private updates of the topic to an anonymous
+	// subscriber.
+	body := subscribeUntilDisconnected(t, hub, func(cancel context.CancelFunc) {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Private: true, Event: Event{Data: "private"}}))
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	})
+	assert.Contains(t, body, "data: private\n")
+
+	ar := <-requests
+	assert.Equal(t, actionSubscribe, ar.Action)
+	assert.Empty(t, ar.Token)
+	assert.Equal(t, []detailTopic{{TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/books/1"}}}, ar.Matchers)
+	assert.Equal(t, "192.0.2.1", ar.Client.RemoteAddr)
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/2", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuthorizationWebhookPublish(t *testing.T) {
+	t.Parallel()
+
+	requests := make(chan authorizationRequest, 10)
+	srv, calls := newAuthorizationWebhookServer(t, requests)
+	hub := createDummy(t, WithAuthorizationWebhook(AuthorizationWebhook{URL: srv.URL}))
+	token := mintAccessToken([]byte("publisher"), testResourceIdentifier, publishAllDetails())
+
+	publish := func(topic string) int {
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(url.Values{"topic": {topic}, "data": {"hello"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", bearerPrefix+token)
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, publish("https://example.com/books/1"))
+	assert.Equal(t, http.StatusOK, publish("https://example.com/books/1"))
+	assert.Equal(t, http.StatusForbidden, publish("https://example.com/books/2"))
+
+	// The decisions are cached.
+	assert.Equal(t, int32(2), calls.Load())
+
+	ar := <-requests
+	assert.Equal(t, actionPublish, ar.Action)
+	assert.Equal(t, token, ar.Token)
+	assert.Equal(t, []string{"https://example.com/books/1"}, ar.Topics)
+}
+
+func TestAuthorizationWebhookUnavailable(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(srv.Close)
+
+	hub := createAnonymousDummy(t, WithAuthorizationWebhook(AuthorizationWebhook{URL: srv.URL, FailureThreshold: 2}))
+
+	for range 3 {
+		req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1", nil)
+		w := httptest.NewRecorder()
+		hub.SubscribeHandler(w, req)
+
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	}
+
+	// The breaker opened after 2 failures.
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	b := circuitBreaker{threshold: 2, openDuration: time.Minute}
+	now := time.Now()
+
+	assert.True(t, b.allow(now))
+	assert.False(t, b.failure(now))
+	assert.True(t, b.failure(now))
+	assert.False(t, b.allow(now))
+
+	// Half-open: a single request tries the service again.
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(now))
+	assert.False(t, b.allow(now))
+	assert.False(t, b.failure(now))
+	assert.False(t, b.allow(now))
+
+	now = now.Add(time.Minute)
+	assert.True(t, b.allow(now))
+	b.success()
+	assert.True(t, b.allow(now))
+	assert.True(t, b.allow(now))
+}
+
+func TestAuthorizationWebhookPublicationEndpoints(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newAuthorizationWebhookServer(t, nil)
+	hub := createDummy(t, WithTransport(createBoltTransport(t, 0, 0)), WithAuthorizationWebhook(AuthorizationWebhook{URL: srv.URL}))
+	token := createDummyAuthorizedJWT(rolePublisher, []string{"*"})
+
+	resp := publishGroupRequest(t, hub, token, `[{"topic": "https://example.com/books/1"}, {"topic": "https://example.com/books/2"}]`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// The retraction denied by the webhook is not disclosed.
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/2", Event: Event{ID: "b2"}}))
+
+	resp = retractRequest(t, hub, token, "b2")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestAuthorizationWebhookSubscriptionEndpoints(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newAuthorizationWebhookServer(t, nil)
+	hub := createDummy(t,
+		WithTransport(createBoltTransport(t, 0, 0)),
+		WithCapabilityURLs(testCapabilityKey, 0),
+		WithAuthorizationWebhook(AuthorizationWebhook{URL: srv.URL}),
+	)
+	token := createDummyAuthorizedJWT(roleSubscriber, []string{"*"})
+
+	code, _ := historyRequest(t, hub, token, url.Values{"match": {"https://example.com/books/2"}})
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = historyRequest(t, hub, token, url.Values{"match": {"https://example.com/books/1"}})
+	assert.Equal(t, http.StatusOK, code)
+
+	req := httptest.NewRequest(http.MethodPost, capabilitiesURL, strings.NewReader(url.Values{"match": {"https://example.com/books/2"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", bearerPrefix+token)
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAuthorizationWebhookWebSocketPublishing(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newAuthorizationWebhookServer(t, nil)
+	key := Static{Key: []byte("chat"), Algorithm: "HS256"}
+
+	hub, err := NewHub(t.Context(),
+		WithIssuers([]Issuer{{Identifier: testIssuer, Publisher: key, Subscriber: key}}),
+		WithResourceIdentifier(testResourceIdentifier),
+		WithWebSocketPublishing(),
+		WithAuthorizationWebhook(AuthorizationWebhook{URL: srv.URL}),
+	)
+	require.NoError(t, err)
+
+	hubSrv := httptest.NewServer(hub)
+	defer hubSrv.Close()
+
+	token := mintAccessToken([]byte("chat"), testResourceIdentifier, []authorizationDetail{{
+		Type:    authorizationDetailTypeMercure,
+		Actions: []mercureAction{actionSubscribe, actionPublish},
+		Topics:  stringsToDetailTopics([]string{"*"}),
+	}})
+
+	c, resp := dialWebSocket(t, hubSrv, webSocketURL+"?match=https://example.com/books/1", http.Header{"Authorization": {bearerPrefix + token}})
+	require.NotNil(t, c, resp.Status)
+
+	c.writeFrame(t, wsOpText, []byte(`{"jsonrpc":"2.0","id":1,"method":"publish","params":{"topic":"https://example.com/books/2"}}`))
+
+	var updates []historyUpdate
+
+	rpcResp := c.readRPCResponse(t, &updates)
+	require.NotNil(t, rpcResp.Error)
+	assert.Equal(t, sidecarUnauthorized, rpcResp.Error.Code)
+}
+
+func TestAuthorizationWebhookGRPC(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newAuthorizationWebhookServer(t, nil)
+	_, client := createGRPCClient(t, WithAuthorizationWebhook(AuthorizationWebhook{URL: srv.URL}))
+
+	_, err := client.Publish(withToken(t.Context(), createDummyAuthorizedJWT(rolePublisher, []string{"*"})), &mercurepb.PublishRequest{Topic: "https://example.com/books/2"})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err := client.Subscribe(withToken(t.Context(), createDummyAuthorizedJWT(roleSubscriber, []string{"*"})), &mercurepb.SubscribeRequest{Match: []string{"https://example.com/books/2"}})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,175 @@
+package mercure
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// dispatchWatermarkSampleInterval is how often the queues of the subscribers
+// are measured when a watermark is set.
+const dispatchWatermarkSampleInterval = 100 * time.Millisecond
+
+// DispatchQueueStats are the statistics of the queues of the subscribers
+// connected to a hub, see DispatchQueues.Stats.
+type DispatchQueueStats struct {
+	// Subscribers is the number of connected subscribers.
+	Subscribers int
+	// Depth is the number of updates waiting to be sent, all subscribers
+	// included.
+	Depth int
+	// MaxDepth is the number of updates waiting to be sent to the most
+	// lagging subscriber.
+	MaxDepth int
+	// Shedding reports whether Depth is above the watermark, see
+	// WithDispatchWatermark.
+	Shedding bool
+	// Shed is the number of updates shed since the hub started.
+	Shed uint64
+}
+
+// DispatchQueues tracks the queues of the subscribers connected to a hub.
+//
+// Every subscriber has its own bounded queue, its buffer (see
+// WithSubscriberBuffer), consumed by the goroutine writing to its connection.
+// Dispatching an update to a subscriber queues it under the lock of the
+// subscriber, or applies the overflow policy when the queue is full: it never
+// waits for the connection, and a slow subscriber only fills its own queue.
+// The queues can still hold a lot of updates with many slow subscribers: above
+// the watermark, the hub sheds the live updates of the subscribers lagging the
+// most.
+//
+// The updates are deliberately not handed to a dispatch goroutine per
+// subscriber, with a queue of its own in front of the buffer: the connection
+// goroutine already plays this role, and a second goroutine and queue per
+// subscriber would double the memory and the scheduling cost of every
+// connection without removing any wait from the dispatch. What a subscriber
+// still costs to the dispatch, its overflow policy and its callbacks (see
+// SubscriberCallbacks), doesn't depend on the speed of its connection.
+type DispatchQueues struct {
+	watermark int
+
+	mu          sync.Mutex
+	subscribers map[*LocalSubscriber]struct{}
+
+	shedding  atomic.Bool
+	threshold atomic.Int64
+	shed      atomic.Uint64
+}
+
+// DispatchQueueMetrics may be implemented by the Metrics collecting the
+// statistics of the queues of the subscribers.
+type DispatchQueueMetrics interface {
+	// ObserveDispatchQueues is called by NewHub with the queues of the hub.
+	// The statistics are read from the queues, see DispatchQueues.Stats.
+	ObserveDispatchQueues(q *DispatchQueues)
+}
+
+// WithDispatchWatermark sets the number of updates waiting to be sent, all
+// subscribers included, above which the hub sheds load: the live updates are
+// dropped for the subscribers having at least as many updates waiting as the
+// average, the others being still served. The subscribers stay connected, the
+// shed updates are reported like the ones dropped by the overflow policy (see
+// SubscriberCallbacks.OnDrop). 0, the default, disables shedding.
+func WithDispatchWatermark(watermark int) Option {
+	return func(o *opt) error {
+		if watermark < 0 {
+			return fmt.Errorf("%w: negative dispatch watermark %d", ErrInvalidSubscriberBuffer, watermark)
+		}
+
+		o.dispatchWatermark = watermark
+
+		return nil
+	}
+}
+
+func newDispatchQueues(watermark int) *DispatchQueues {
+	return &DispatchQueues{watermark: watermark, subscribers: make(map[*LocalSubscriber]struct{})}
+}
+
+// Stats measures the queues of the subscribers.
+func (q *DispatchQueues) Stats() DispatchQueueStats {
+	q.mu.Lock()
+	stats := DispatchQueueStats{Subscribers: len(q.subscribers)}
+
+	for s := range q.subscribers {
+		d := len(s.out)
+		stats.Depth += d
+		stats.MaxDepth = max(stats.MaxDepth, d)
+	}
+	q.mu.Unlock()
+
+	stats.Shedding = q.shedding.Load()
+	stats.Shed = q.shed.Load()
+
+	return stats
+}
+
+func (q *DispatchQueues) add(s *LocalSubscriber) {
+	q.mu.Lock()
+	q.subscribers[s] = struct{}{}
+	q.mu.Unlock()
+}
+
+func (q *DispatchQueues) remove(s *LocalSubscriber) {
+	q.mu.Lock()
+	delete(q.subscribers, s)
+	q.mu.Unlock()
+}
+
+// sample switches shedding on or off, depending on the depth of the queues
+// compared to the watermark.
+func (q *DispatchQueues) sample() {
+	stats := q.Stats()
+	if stats.Depth <= q.watermark {
+		q.shedding.Store(false)
+
+		return
+	}
+
+	// Ceiling of the average, a queue holding at least one update.
+	q.threshold.Store(int64(max(1, (stats.Depth+stats.Subscribers-1)/stats.Subscribers)))
+	q.shedding.Store(true)
+}
+
+// sheds reports whether a live update must be shed for a subscriber whose
+// queue holds depth updates, and counts it.
+func (q *DispatchQueues) sheds(depth int) bool {
+	if !q.shedding.Load() || int64(depth) < q.threshold.Load() {
+		return false
+	}
+
+	q.shed.Add(1)
+
+	return true
+}
+
+// startDispatchQueues measures the queues periodically when a watermark is
+// set, until ctx is done, and passes them to the metrics supporting it.
+func (o *opt) startDispatchQueues(ctx context.Context) {
+	o.dispatchQueues = newDispatchQueues(o.dispatchWatermark)
+
+	if m, ok := o.metrics.(DispatchQueueMetrics); ok {
+		m.ObserveDispatchQueues(o.dispatchQueues)
+	}
+
+	if o.dispatchWatermark == 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(dispatchWatermarkSampleInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				o.dispatchQueues.sample()
+			}
+		}
+	}()
+}
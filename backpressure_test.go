@@ -0,0 +1,105 @@
+package mercure
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithDispatchWatermark(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithDispatchWatermark(-1))
+	require.ErrorIs(t, err, ErrInvalidSubscriberBuffer)
+}
+
+func TestDispatchQueuesShedding(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	q := newDispatchQueues(2)
+
+	var dropped []*LocalSubscriber
+
+	newSubscriber := func() *LocalSubscriber {
+		s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+		s.shedding = q
+		s.SetCallbacks(SubscriberCallbacks{OnDrop: func(s *LocalSubscriber, _ *Update) {
+			dropped = append(dropped, s)
+		}})
+		s.Ready(ctx)
+		q.add(s)
+
+		return s
+	}
+
+	slow, fast := newSubscriber(), newSubscriber()
+
+	for range 3 {
+		require.True(t, slow.Dispatch(ctx, &Update{}, false))
+	}
+
+	q.sample()
+	assert.Equal(t, DispatchQueueStats{Subscribers: 2, Depth: 3, MaxDepth: 3, Shedding: true}, q.Stats())
+
+	// Only the lagging subscriber is shed, and stays connected.
+	assert.True(t, slow.Dispatch(ctx, &Update{}, false))
+	assert.True(t, fast.Dispatch(ctx, &Update{}, false))
+	assert.Equal(t, []*LocalSubscriber{slow}, dropped)
+	assert.Equal(t, SubscriberStats{Delivered: 3, Dropped: 1}, slow.Stats())
+	assert.Equal(t, SubscriberStats{Delivered: 1}, fast.Stats())
+
+	// The history is never shed.
+	assert.True(t, slow.Dispatch(ctx, &Update{}, true))
+	assert.Equal(t, SubscriberStats{Delivered: 4, Dropped: 1, Replayed: 1}, slow.Stats())
+
+	for range 4 {
+		<-slow.Receive()
+	}
+
+	q.sample()
+	assert.Equal(t, DispatchQueueStats{Subscribers: 2, Depth: 1, MaxDepth: 1, Shed: 1}, q.Stats())
+
+	assert.True(t, slow.Dispatch(ctx, &Update{}, false))
+	assert.Equal(t, SubscriberStats{Delivered: 5, Dropped: 1, Replayed: 1}, slow.Stats())
+
+	q.remove(slow)
+	assert.Equal(t, 1, q.Stats().Subscribers)
+}
+
+func TestDispatchQueueMetrics(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	hub := createDummy(t, WithMetrics(NewPrometheusMetrics(registry)), WithDispatchWatermark(1000))
+
+	matchers := []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/queues"}}
+	_, err := hub.Subscribe(t.Context(), matchers, nil)
+	require.NoError(t, err)
+
+	for range 2 {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/queues"}))
+	}
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+
+	for _, f := range families {
+		if strings.HasPrefix(f.GetName(), "mercure_subscriber_queue_") {
+			values[f.GetName()] = f.GetMetric()[0].GetCounter().GetValue() + f.GetMetric()[0].GetGauge().GetValue()
+		}
+	}
+
+	assert.Equal(t, map[string]float64{
+		"mercure_subscriber_queue_depth":      2,
+		"mercure_subscriber_queue_depth_max":  2,
+		"mercure_subscriber_queue_shedding":   0,
+		"mercure_subscriber_queue_shed_total": 0,
+	}, values)
+}
@@ -0,0 +1,267 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrInvalidBandwidthLimits is returned by WithSubscriberBandwidth for
+// negative limits, or when both are 0.
+var ErrInvalidBandwidthLimits = errors.New("invalid subscriber bandwidth limits")
+
+// BandwidthLimits caps the number of bytes per second written to the
+// subscribers. A zero value means no limit.
+type BandwidthLimits struct {
+	// PerConnection is the number of bytes per second written to each
+	// subscriber.
+	PerConnection int64
+	// PerSubject is the number of bytes per second written to all the
+	// subscribers whose tokens have the same subject (sub claim). The
+	// subscribers without subject are only limited by PerConnection.
+	PerSubject int64
+}
+
+// SubscriberBandwidthMetrics may be implemented by the Metrics counting the
+// bytes written to the subscribers, by tenant (an empty string when the
+// subscriber has none, see WithTenancy).
+type SubscriberBandwidthMetrics interface {
+	// SubscriberBytesSent collects the bytes written to a subscriber.
+	SubscriberBytesSent(tenant string, n int)
+	// SubscriberThrottled collects the time a subscriber waited before an
+	// event was written, because of the bandwidth limits.
+	SubscriberThrottled(tenant string, d time.Duration)
+}
+
+// WithSubscriberBandwidth caps the bandwidth of the subscribers, to keep
+// data-hungry clients from saturating the egress of the hub: when a
+// subscriber exceeds the limits, the hub waits before writing the next
+// events. Bursts of one second of bytes are allowed. The updates waiting to
+// be written are buffered, a subscriber limited for too long ends up
+// overflowing its buffer (see WithSubscriberBuffer).
+//
+// The events and heartbeats written to the SSE connections, and the messages
+// sent to the WebSocket ones, are counted. The subject limits are enforced by
+// each hub: the nodes of a cluster don't share them.
+func WithSubscriberBandwidth(l BandwidthLimits) Option {
+	return func(o *opt) error {
+		if l.PerConnection < 0 || l.PerSubject < 0 || (l.PerConnection == 0 && l.PerSubject == 0) {
+			return ErrInvalidBandwidthLimits
+		}
+
+		o.bandwidth = &bandwidth{BandwidthLimits: l, subjects: make(map[string]*subjectBandwidth)}
+
+		return nil
+	}
+}
+
+// bandwidth holds the bandwidth budgets of the subjects.
+type bandwidth struct {
+	BandwidthLimits
+
+	sync.Mutex
+	subjects map[string]*subjectBandwidth
+}
+
+// subjectBandwidth is the budget shared by the subscribers of a subject.
+type subjectBandwidth struct {
+	byteBucket
+
+	// subscribers is the number of subscribers using the budget, guarded by
+	// the lock of bandwidth.
+	subscribers int
+}
+
+// byteBucket is a token bucket of bytes, refilled with rate bytes per second
+// and holding at most one second of them. Its number of bytes gets negative
+// when an event larger than what is left is written.
+type byteBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	bytes  float64
+	refill time.Time
+}
+
+func newByteBucket(rate int64, now time.Time) byteBucket {
+	return byteBucket{rate: float64(rate), bytes: float64(rate), refill: now}
+}
+
+// take consumes n bytes, and returns how long to wait before writing them:
+// the time needed to pay the bytes written previously in excess.
+func (b *byteBucket) take(n int, now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.bytes = min(b.rate, b.bytes+now.Sub(b.refill).Seconds()*b.rate)
+	b.refill = now
+
+	var wait time.Duration
+	if b.bytes < 0 {
+		wait = time.Duration(-b.bytes / b.rate * float64(time.Second))
+	}
+
+	b.bytes -= float64(n)
+
+	return wait
+}
+
+// untilFull returns how long the bucket takes to refill completely.
+func (b *byteBucket) untilFull(now time.Time) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	missing := b.rate - b.bytes - now.Sub(b.refill).Seconds()*b.rate
+	if missing <= 0 {
+		return 0
+	}
+
+	return time.Duration(missing / b.rate * float64(time.Second))
+}
+
+// subscriberBandwidth holds the bandwidth budgets and the tenant of a
+// subscriber.
+type subscriberBandwidth struct {
+	connection *byteBucket
+	subject    *subjectBandwidth
+	subjectID  string
+	tenant     string
+}
+
+// BytesSent returns the number of bytes written to the subscriber since it
+// connected.
+func (s *LocalSubscriber) BytesSent() uint64 {
+	return s.counters.bytesSent.Load()
+}
+
+// subscriberBandwidth returns the budgets of the subscriber, creating them on
+// first use. It must be called from the goroutine writing to the subscriber.
+func (h *Hub) subscriberBandwidth(s *LocalSubscriber) *subscriberBandwidth {
+	if s.bandwidth != nil {
+		return s.bandwidth
+	}
+
+	sb := &subscriberBandwidth{tenant: h.tenantName(s.Claims)}
+	s.bandwidth = sb
+
+	bw := h.bandwidth
+	if bw == nil {
+		return sb
+	}
+
+	now := time.Now()
+
+	if bw.PerConnection != 0 {
+		b := newByteBucket(bw.PerConnection, now)
+		sb.connection = &b
+	}
+
+	if bw.PerSubject != 0 && s.Claims != nil && s.Claims.Subject != "" {
+		sb.subjectID = s.Claims.Subject
+
+		bw.Lock()
+		sub, ok := bw.subjects[sb.subjectID]
+		if !ok {
+			sub = &subjectBandwidth{byteBucket: newByteBucket(bw.PerSubject, now)}
+			bw.subjects[sb.subjectID] = sub
+		}
+
+		sub.subscribers++
+		bw.Unlock()
+
+		sb.subject = sub
+	}
+
+	return sb
+}
+
+// throttleWrite waits until the bandwidth limits of the subscriber allow
+// writing n bytes, and reports whether they can be written: false when ctx is
+// done first.
+func (h *Hub) throttleWrite(ctx context.Context, s *LocalSubscriber, n int) bool {
+	if h.bandwidth == nil {
+		return true
+	}
+
+	sb := h.subscriberBandwidth(s)
+	now := time.Now()
+
+	var wait time.Duration
+	if sb.connection != nil {
+		wait = sb.connection.take(n, now)
+	}
+
+	if sb.subject != nil {
+		wait = max(wait, sb.subject.take(n, now))
+	}
+
+	if wait <= 0 {
+		return true
+	}
+
+	if m, ok := h.metrics.(SubscriberBandwidthMetrics); ok {
+		m.SubscriberThrottled(sb.tenant, wait)
+	}
+
+	t := time.NewTimer(wait)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// countWritten accounts the bytes written to the subscriber.
+func (h *Hub) countWritten(s *LocalSubscriber, n int) {
+	s.counters.bytesSent.Add(uint64(n))
+
+	if m, ok := h.metrics.(SubscriberBandwidthMetrics); ok {
+		m.SubscriberBytesSent(h.subscriberBandwidth(s).tenant, n)
+	}
+}
+
+// releaseBandwidth stops counting the subscriber among the ones sharing the
+// budget of its subject. The budget is forgotten once the last of them is gone
+// and it has refilled, so that reconnecting doesn't restore a full burst.
+func (h *Hub) releaseBandwidth(s *LocalSubscriber) {
+	bw := h.bandwidth
+	if bw == nil || s.bandwidth == nil || s.bandwidth.subject == nil {
+		return
+	}
+
+	bw.Lock()
+	defer bw.Unlock()
+
+	s.bandwidth.subject.subscribers--
+	if s.bandwidth.subject.subscribers == 0 {
+		bw.evict(s.bandwidth.subjectID, s.bandwidth.subject)
+	}
+
+	s.bandwidth.subject = nil
+}
+
+// evict forgets the budget of a subject without subscribers when it has
+// refilled, and checks again when it will have otherwise. It must be called
+// with the lock held.
+func (bw *bandwidth) evict(subjectID string, sub *subjectBandwidth) {
+	if sub.subscribers != 0 || bw.subjects[subjectID] != sub {
+		return
+	}
+
+	wait := sub.untilFull(time.Now())
+	if wait <= 0 {
+		delete(bw.subjects, subjectID)
+
+		return
+	}
+
+	time.AfterFunc(wait, func() {
+		bw.Lock()
+		defer bw.Unlock()
+
+		bw.evict(subjectID, sub)
+	})
+}
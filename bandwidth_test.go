@@ -0,0 +1,152 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSubscriberBandwidthInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, l := range []BandwidthLimits{{}, {PerConnection: -1}, {PerConnection: 10, PerSubject: -1}} {
+		_, err := NewHub(t.Context(), WithSubscriberBandwidth(l))
+		require.ErrorIs(t, err, ErrInvalidBandwidthLimits, l)
+	}
+}
+
+func TestByteBucket(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	b := newByteBucket(100, now)
+
+	assert.Zero(t, b.take(150, now))
+	assert.Equal(t, 500*time.Millisecond, b.take(10, now))
+	assert.Equal(t, 100*time.Millisecond, b.take(10, now.Add(500*time.Millisecond)))
+	assert.Zero(t, b.take(10, now.Add(10*time.Second)))
+	assert.InDelta(t, 90, b.bytes, 0)
+}
+
+func TestThrottleWrite(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		hub := createDummy(t, WithSubscriberBandwidth(BandwidthLimits{PerConnection: 10_000}))
+		s := NewLocalSubscriber("", slog.Default(), hub.topicMatcherStore)
+
+		assert.True(t, hub.throttleWrite(t.Context(), s, 11_000))
+
+		// The 1,000 bytes written in excess are paid before writing.
+		start := time.Now()
+		assert.True(t, hub.throttleWrite(t.Context(), s, 10))
+		assert.Equal(t, 100*time.Millisecond, time.Since(start))
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		assert.False(t, hub.throttleWrite(ctx, s, 10))
+	})
+}
+
+func TestSubjectBandwidth(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithSubscriberBandwidth(BandwidthLimits{PerSubject: 100}))
+
+	newSubscriber := func(subject string) *LocalSubscriber {
+		s := NewLocalSubscriber("", slog.Default(), hub.topicMatcherStore)
+		s.Claims = &claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject}}
+
+		return s
+	}
+
+	s1, s2, s3 := newSubscriber("alice"), newSubscriber("alice"), newSubscriber("")
+
+	assert.Same(t, hub.subscriberBandwidth(s1).subject, hub.subscriberBandwidth(s2).subject)
+	assert.Nil(t, hub.subscriberBandwidth(s3).subject)
+	assert.Nil(t, hub.subscriberBandwidth(s1).connection)
+
+	hub.releaseBandwidth(s1)
+	assert.Len(t, hub.bandwidth.subjects, 1)
+
+	hub.releaseBandwidth(s2)
+	hub.releaseBandwidth(s3)
+	assert.Empty(t, hub.bandwidth.subjects)
+}
+
+func TestSubjectBandwidthEviction(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		hub := createDummy(t, WithSubscriberBandwidth(BandwidthLimits{PerSubject: 100}))
+
+		newSubscriber := func() *LocalSubscriber {
+			s := NewLocalSubscriber("", slog.Default(), hub.topicMatcherStore)
+			s.Claims = &claims{RegisteredClaims: jwt.RegisteredClaims{Subject: "alice"}}
+
+			return s
+		}
+
+		s := newSubscriber()
+		assert.True(t, hub.throttleWrite(t.Context(), s, 150))
+		hub.releaseBandwidth(s)
+
+		// Reconnecting doesn't restore a full burst: the 50 bytes written in
+		// excess are still to be paid.
+		s = newSubscriber()
+		start := time.Now()
+		assert.True(t, hub.throttleWrite(t.Context(), s, 10))
+		assert.Equal(t, 500*time.Millisecond, time.Since(start))
+		hub.releaseBandwidth(s)
+
+		hub.bandwidth.Lock()
+		assert.Len(t, hub.bandwidth.subjects, 1)
+		hub.bandwidth.Unlock()
+
+		// The budget is forgotten once refilled.
+		time.Sleep(2 * time.Second)
+		synctest.Wait()
+
+		hub.bandwidth.Lock()
+		assert.Empty(t, hub.bandwidth.subjects)
+		hub.bandwidth.Unlock()
+	})
+}
+
+func TestSubscribeBytesSent(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	hub := createAnonymousDummy(t, WithMetrics(NewPrometheusMetrics(registry)))
+
+	body := subscribeUntilDisconnected(t, hub, func(cancel context.CancelFunc) {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{Data: "hello"}}))
+		time.Sleep(100 * time.Millisecond)
+		cancel()
+	})
+	require.Contains(t, body, "data: hello\n")
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	var sent float64
+
+	for _, f := range families {
+		if f.GetName() == "mercure_subscriber_bytes_sent_total" {
+			sent = f.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+
+	// The first comment is flushed when the headers are sent, and isn't
+	// written by the hub.
+	assert.InDelta(t, float64(len(strings.TrimPrefix(body, ":\n"))), sent, 0)
+}
@@ -54,6 +54,8 @@ func (h *Hub) writeAuthError(w http.ResponseWriter, r *http.Request, err error)
 		errors.Is(err, ErrNoOrigin),
 		errors.Is(err, ErrOriginNotAllowed):
 		h.writeBearerError(w, bearerErrInvalidRequest, http.StatusBadRequest)
+	case errors.Is(err, ErrIntrospectionFailed):
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 	default:
 		h.writeBearerError(w, bearerErrInvalidToken, http.StatusUnauthorized)
 	}
@@ -0,0 +1,192 @@
+package mercure
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// ErrBlobNotFound is returned by BlobStore.OpenBlob when the blob does not
+// exist.
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores the attachments of multipart publications, which the hub
+// serves through signed URLs instead of embedding them in updates.
+type BlobStore interface {
+	// PutBlob stores the content of r and returns the key identifying it. Keys
+	// end up in URLs: they must be URL path segments.
+	PutBlob(ctx context.Context, contentType string, r io.Reader) (key string, err error)
+	// OpenBlob returns the content and the content type of a stored blob, or
+	// ErrBlobNotFound.
+	OpenBlob(ctx context.Context, key string) (io.ReadCloser, string, error)
+}
+
+// BlobDeleter may be implemented by blob stores to delete blobs, such as the
+// attachments of the publications that failed.
+type BlobDeleter interface {
+	// DeleteBlob deletes a blob. Deleting a blob that doesn't exist is not an
+	// error.
+	DeleteBlob(ctx context.Context, key string) error
+}
+
+// BlobPruner may be implemented by blob stores to delete the blobs that can't
+// be downloaded anymore, their signed URLs having expired.
+type BlobPruner interface {
+	// PruneBlobs deletes the blobs stored before the given time, and returns
+	// their count.
+	PruneBlobs(ctx context.Context, before time.Time) (int, error)
+}
+
+// FileBlobStore is a BlobStore keeping every blob in its own file in a
+// directory. The content type is stored on the first line of the file.
+type FileBlobStore struct {
+	dir string
+}
+
+// NewFileBlobStore creates a FileBlobStore storing blobs in dir, creating the
+// directory if needed.
+func NewFileBlobStore(dir string) (*FileBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("unable to create the blob directory: %w", err)
+	}
+
+	return &FileBlobStore{dir: dir}, nil
+}
+
+// PutBlob writes the blob to a temporary file, then renames it, so OpenBlob
+// never sees a partial blob.
+func (s *FileBlobStore) PutBlob(_ context.Context, contentType string, r io.Reader) (string, error) {
+	f, err := os.CreateTemp(s.dir, ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("unable to create blob: %w", err)
+	}
+
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	// The content type comes from a multipart header: it can't contain a
+	// line break, but don't let a BlobStore user rely on that.
+	contentType = strings.NewReplacer("\r", "", "\n", "").Replace(contentType)
+
+	if _, err := io.WriteString(f, contentType+"\n"); err != nil {
+		_ = f.Close()
+
+		return "", fmt.Errorf("unable to write blob: %w", err)
+	}
+
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+
+		return "", fmt.Errorf("unable to write blob: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("unable to write blob: %w", err)
+	}
+
+	key := uuid.Must(uuid.NewV4()).String()
+	if err := os.Rename(f.Name(), filepath.Join(s.dir, key)); err != nil {
+		return "", fmt.Errorf("unable to write blob: %w", err)
+	}
+
+	return key, nil
+}
+
+// validBlobKey reports whether key is a key created by PutBlob. Keys are
+// UUIDs: anything else is rejected before touching the file system.
+func validBlobKey(key string) bool {
+	u, err := uuid.FromString(key)
+
+	return err == nil && u.String() == key
+}
+
+// OpenBlob opens the file of the blob.
+func (s *FileBlobStore) OpenBlob(_ context.Context, key string) (io.ReadCloser, string, error) {
+	if !validBlobKey(key) {
+		return nil, "", ErrBlobNotFound
+	}
+
+	f, err := os.Open(filepath.Join(s.dir, key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, "", ErrBlobNotFound
+		}
+
+		return nil, "", fmt.Errorf("unable to open blob: %w", err)
+	}
+
+	br := bufio.NewReader(f)
+
+	contentType, err := br.ReadString('\n')
+	if err != nil {
+		_ = f.Close()
+
+		return nil, "", fmt.Errorf("unable to read blob: %w", err)
+	}
+
+	return struct {
+		io.Reader
+		io.Closer
+	}{br, f}, strings.TrimSuffix(contentType, "\n"), nil
+}
+
+// DeleteBlob removes the file of the blob.
+func (s *FileBlobStore) DeleteBlob(_ context.Context, key string) error {
+	if !validBlobKey(key) {
+		return nil
+	}
+
+	if err := os.Remove(filepath.Join(s.dir, key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("unable to delete blob: %w", err)
+	}
+
+	return nil
+}
+
+// PruneBlobs removes the files of the blobs, and the temporary files left by
+// interrupted writes, modified before the given time.
+func (s *FileBlobStore) PruneBlobs(ctx context.Context, before time.Time) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0, fmt.Errorf("unable to list blobs: %w", err)
+	}
+
+	var n int
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return n, err //nolint:wrapcheck
+		}
+
+		if !validBlobKey(e.Name()) && !strings.HasPrefix(e.Name(), ".tmp-") {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(before) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(s.dir, e.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return n, fmt.Errorf("unable to delete blob: %w", err)
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// Interface guards.
+var (
+	_ BlobStore   = (*FileBlobStore)(nil)
+	_ BlobDeleter = (*FileBlobStore)(nil)
+	_ BlobPruner  = (*FileBlobStore)(nil)
+)
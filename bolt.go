@@ -5,12 +5,16 @@ import (
 	"context"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/rand"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	bolt "go.etcd.io/bbolt"
@@ -33,16 +37,29 @@ const maxHistoryScan = 10000
 type BoltTransport struct {
 	sync.RWMutex
 
-	subscribers      *SubscriberList
-	logger           *slog.Logger
-	db               *bolt.DB
-	bucketName       string
-	size             uint64
-	cleanupFrequency float64
-	closed           chan struct{}
-	closedOnce       sync.Once
-	lastSeq          uint64
-	lastEventID      string
+	subscribers       *SubscriberList
+	logger            *slog.Logger
+	db                *bolt.DB
+	bucketName        string
+	size              uint64
+	cleanupFrequency  float64
+	compaction        bool
+	compactionTail    uint64
+	retention         []BoltRetentionPolicy
+	exemptions        RetentionExemptions
+	eventTTL          time.Duration
+	hashChain         bool
+	topicSequences    bool
+	topicMatcherStore *TopicMatcherStore
+	closed            chan struct{}
+	closedOnce        sync.Once
+	closeErr          error
+	lastSeq           uint64
+	lastEventID       string
+	// openedAt and modified (Unix nanoseconds) version the history, see
+	// HistoryVersion.
+	openedAt int64
+	modified atomic.Int64
 }
 
 // NewBoltTransport creates a new BoltTransport.
@@ -69,26 +86,48 @@ func NewBoltTransport(
 		}
 	}
 
+	if bucketName == boltSchemaBucketName {
+		return nil, &TransportError{msg: fmt.Sprintf("the %q bucket is reserved", boltSchemaBucketName)}
+	}
+
 	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
 		return nil, &TransportError{err: err}
 	}
 
+	applied, err := migrateBoltSchema(db, bucketName, boltMigrations)
+	if err != nil {
+		_ = db.Close()
+
+		return nil, &TransportError{err: err}
+	}
+
+	for _, m := range applied {
+		if logger.Enabled(context.Background(), slog.LevelInfo) {
+			logger.LogAttrs(context.Background(), slog.LevelInfo, "Bolt schema migrated", slog.Int("version", m.Version), slog.String("description", m.Description))
+		}
+	}
+
 	lastEventID, err := getDBLastEventID(db, bucketName)
 	if err != nil {
 		return nil, &TransportError{err: err}
 	}
 
-	return &BoltTransport{
-		logger:           logger,
-		db:               db,
-		bucketName:       bucketName,
-		size:             size,
-		cleanupFrequency: cleanupFrequency,
-		subscribers:      subscriberList,
-		closed:           make(chan struct{}),
-		lastEventID:      lastEventID,
-	}, nil
+	t := &BoltTransport{
+		logger:            logger,
+		db:                db,
+		bucketName:        bucketName,
+		size:              size,
+		cleanupFrequency:  cleanupFrequency,
+		topicMatcherStore: &TopicMatcherStore{},
+		subscribers:       subscriberList,
+		closed:            make(chan struct{}),
+		lastEventID:       lastEventID,
+		openedAt:          time.Now().UnixNano(),
+	}
+	t.modified.Store(t.openedAt)
+
+	return t, nil
 }
 
 func getDBLastEventID(db *bolt.DB, bucketName string) (string, error) {
@@ -115,44 +154,97 @@ func getDBLastEventID(db *bolt.DB, bucketName string) (string, error) {
 
 // Dispatch dispatches an update to all subscribers and persists it in Bolt DB.
 func (t *BoltTransport) Dispatch(ctx context.Context, update *Update) error {
-	select {
-	case <-t.closed:
+	return t.DispatchGroup(ctx, []*Update{update})
+}
+
+// DispatchGroup persists a group of updates in a single Bolt DB transaction,
+// then dispatches them to all subscribers. If persisting any update fails, none
+// of them is stored nor dispatched.
+func (t *BoltTransport) DispatchGroup(ctx context.Context, updates []*Update) error {
+	if isClosed(t.closed) {
 		return ErrClosedTransport
-	default:
 	}
 
-	update.AssignUUID()
+	var updateJSONs [][]byte
+	now := time.Now()
 
-	// Marshal through the pointer so Update's custom MarshalJSON applies.
-	updateJSON, err := json.Marshal(update)
-	if err != nil {
-		return fmt.Errorf("error when marshaling update: %w", err)
+	for _, update := range updates {
+		update.AssignUUID()
+	}
+
+	// The numbered updates are marshaled once numbered, in the transaction
+	// storing them.
+	if !t.topicSequences {
+		var err error
+		if updateJSONs, err = t.marshalUpdates(updates, now); err != nil {
+			return err
+		}
 	}
 
 	// We cannot use RLock() because Bolt allows only one read-write transaction at a time
 	t.Lock()
 	defer t.Unlock()
 
-	if err := t.persist(update.ID, updateJSON); err != nil {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	var err error
+	if t.topicSequences {
+		err = t.persistNumbered(updates, now)
+	} else {
+		err = t.persist(t.persisted(updates, updateJSONs))
+	}
+
+	if err != nil {
 		return err
 	}
 
-	for _, s := range t.subscribers.MatchAny(update) {
-		s.Dispatch(ctx, update, false)
+	for _, update := range updates {
+		for _, s := range t.subscribers.MatchAny(update) {
+			s.Dispatch(ctx, update, false)
+		}
 	}
 
 	return nil
 }
 
+// marshalUpdates returns the JSON documents the updates are stored as.
+func (t *BoltTransport) marshalUpdates(updates []*Update, now time.Time) ([][]byte, error) {
+	updateJSONs := make([][]byte, len(updates))
+
+	for i, update := range updates {
+		// Marshal through the pointer so Update's custom MarshalJSON applies.
+		updateJSON, err := json.Marshal(update)
+		if err != nil {
+			return nil, fmt.Errorf("error when marshaling update: %w", err)
+		}
+
+		if t.eventTTL > 0 {
+			updateJSON = withStoredAt(updateJSON, now)
+		}
+
+		updateJSONs[i] = updateJSON
+	}
+
+	return updateJSONs, nil
+}
+
 // AddSubscriber adds a new subscriber to the transport.
 func (t *BoltTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
-	select {
-	case <-t.closed:
+	if isClosed(t.closed) {
 		return ErrClosedTransport
-	default:
 	}
 
 	t.Lock()
+	// Checked again under the lock: a subscriber added after Close would never
+	// be disconnected.
+	if isClosed(t.closed) {
+		t.Unlock()
+
+		return ErrClosedTransport
+	}
+
 	t.subscribers.Add(s)
 	toSeq := t.lastSeq
 	t.Unlock()
@@ -170,15 +262,13 @@ func (t *BoltTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) e
 
 // RemoveSubscriber removes a new subscriber from the transport.
 func (t *BoltTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber) error {
-	select {
-	case <-t.closed:
-		return ErrClosedTransport
-	default:
-	}
-
 	t.Lock()
 	defer t.Unlock()
 
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
 	t.subscribers.Remove(s)
 
 	return nil
@@ -192,8 +282,38 @@ func (t *BoltTransport) GetSubscribers(_ context.Context) (string, []*Subscriber
 	return t.lastEventID, getSubscribers(t.subscribers), nil
 }
 
-// Close closes the Transport.
-func (t *BoltTransport) Close(_ context.Context) (err error) {
+// SetSubscriberShards splits the subscribers in n shards.
+func (t *BoltTransport) SetSubscriberShards(n int) {
+	t.subscribers.SetShards(n)
+}
+
+// DisconnectSubscribers disconnects the subscribers matching the selector.
+func (t *BoltTransport) DisconnectSubscribers(_ context.Context, sel *SubscriberSelector, dryRun bool) (int, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	if isClosed(t.closed) {
+		return 0, ErrClosedTransport
+	}
+
+	return disconnectSubscribers(t.subscribers, sel, dryRun), nil
+}
+
+// Redeliver dispatches the update to the subscribers matching the selector.
+func (t *BoltTransport) Redeliver(ctx context.Context, sel *SubscriberSelector, u *Update) (int, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	if isClosed(t.closed) {
+		return 0, ErrClosedTransport
+	}
+
+	return redeliver(ctx, t.subscribers, sel, u), nil
+}
+
+// Close closes the Transport, once the in-flight dispatches are done,
+// disconnects all the subscribers and closes the database.
+func (t *BoltTransport) Close(_ context.Context) error {
 	t.closedOnce.Do(func() {
 		close(t.closed)
 
@@ -201,18 +321,30 @@ func (t *BoltTransport) Close(_ context.Context) (err error) {
 		defer t.Unlock()
 
 		t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
-			s.Disconnect()
+			s.DisconnectWithReason(DisconnectReasonTransportClosed)
 
 			return true
 		})
-		err = t.db.Close()
+		t.subscribers.Close()
+
+		// Bolt waits for the running read transactions, replaying history.
+		if err := t.db.Close(); err != nil {
+			t.closeErr = fmt.Errorf("unable to close Bolt DB: %w", err)
+		}
 	})
 
-	if err == nil {
-		return nil
+	return t.closeErr
+}
+
+// view runs a read-only transaction, failing with ErrClosedTransport once the
+// database is closed.
+func (t *BoltTransport) view(fn func(tx *bolt.Tx) error) error {
+	err := t.db.View(fn)
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return ErrClosedTransport
 	}
 
-	return fmt.Errorf("unable to close Bolt DB: %w", err)
+	return err //nolint:wrapcheck
 }
 
 // pastSeqBound reports whether the BoltDB key k was written strictly after
@@ -235,7 +367,7 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 		))
 	defer span.End()
 
-	err := t.db.View(func(tx *bolt.Tx) error {
+	err := t.view(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(t.bucketName))
 		if b == nil {
 			s.HistoryDispatched(EarliestLastEventID)
@@ -247,6 +379,8 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 		responseLastEventID := EarliestLastEventID
 		afterFromID := s.RequestLastEventID == EarliestLastEventID
 		scanned := 0
+		window := replayWindow{s: s}
+		now := time.Now()
 
 		for k, v := c.First(); k != nil; k, v = c.Next() {
 			// Keys written after the subscribe snapshot (concurrent Dispatch
@@ -277,6 +411,12 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 					continue
 				}
 
+				// The topics of a retracted update are gone, so whether
+				// the subscriber may learn its id cannot be checked.
+				if isRetracted(v) {
+					continue
+				}
+
 				// Only disclose the id of an event the subscriber is
 				// authorized to read. We must deserialize to evaluate
 				// Match against the update's topics and Private flag.
@@ -293,6 +433,11 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 				continue
 			}
 
+			// Expired, but not removed by a cleanup yet.
+			if isRetracted(v) || t.expired(k, v, now) {
+				continue
+			}
+
 			var update *Update
 			if err := json.Unmarshal(v, &update); err != nil {
 				s.HistoryDispatched(responseLastEventID)
@@ -306,13 +451,18 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 				return err
 			}
 
-			if s.Match(update) && !s.Dispatch(ctx, update, true) {
+			if !s.Match(update) || window.skip(update) {
+				continue
+			}
+
+			if !window.flush(ctx) || !s.Dispatch(ctx, update, true) {
 				s.HistoryDispatched(responseLastEventID)
 
 				return nil
 			}
 		}
 
+		window.flush(ctx)
 		s.HistoryDispatched(responseLastEventID)
 
 		if !afterFromID {
@@ -333,70 +483,454 @@ func (t *BoltTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber,
 	return nil
 }
 
-// persist stores update in the database.
-func (t *BoltTransport) persist(updateID string, updateJSON []byte) error {
+// persist stores updates in the database, in a single transaction.
+func (t *BoltTransport) persist(updates []*Update, updateJSONs [][]byte) error {
+	if len(updates) == 0 {
+		return nil
+	}
+
+	var lastSeq uint64
+
 	if err := t.db.Update(func(tx *bolt.Tx) error {
 		bucket, err := tx.CreateBucketIfNotExists([]byte(t.bucketName))
 		if err != nil {
 			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
 		}
 
+		lastSeq, err = t.store(tx, bucket, updates, updateJSONs)
+
+		return err
+	}); err != nil {
+		return fmt.Errorf("bolt error: %w", err)
+	}
+
+	t.advance(updates, lastSeq)
+
+	return nil
+}
+
+// appendUpdates writes updates at the end of the bucket and returns the
+// sequence of the last one.
+func appendUpdates(bucket *bolt.Bucket, updates []*Update, updateJSONs [][]byte) (lastSeq uint64, err error) {
+	// The DB is append-only
+	bucket.FillPercent = 1
+
+	for i, update := range updates {
 		seq, err := bucket.NextSequence()
 		if err != nil {
-			return fmt.Errorf("error when generating Bolt DB sequence: %w", err)
+			return 0, fmt.Errorf("error when generating Bolt DB sequence: %w", err)
 		}
 
 		prefix := make([]byte, 8)
 		binary.BigEndian.PutUint64(prefix, seq)
 
 		// The sequence value is prepended to the update id to create an ordered list
-		key := bytes.Join([][]byte{prefix, []byte(updateID)}, []byte{})
+		key := bytes.Join([][]byte{prefix, []byte(update.ID)}, []byte{})
+
+		if err := bucket.Put(key, updateJSONs[i]); err != nil {
+			return 0, fmt.Errorf("unable to put value in Bolt DB: %w", err)
+		}
+
+		lastSeq = seq
+	}
+
+	return lastSeq, nil
+}
+
+// advance moves the in-memory cursor past updates. It must only be called
+// once the transaction storing them has committed, so a rolled back group
+// leaves no trace.
+func (t *BoltTransport) advance(updates []*Update, lastSeq uint64) {
+	t.modified.Store(time.Now().UnixNano())
+
+	if len(updates) > 0 {
+		t.lastSeq = lastSeq
+		t.lastEventID = updates[len(updates)-1].ID
+	}
+}
+
+// findHistoryKey walks the history backwards, most recent first, looking for
+// the entry of the update with the given ID. Like history replay, the walk is
+// capped by maxHistoryScan.
+func findHistoryKey(c *bolt.Cursor, id string) (k, v []byte) {
+	scanned := 0
+	for k, v = c.Last(); k != nil && scanned < maxHistoryScan; k, v = c.Prev() {
+		if string(k[8:]) == id {
+			return k, v
+		}
+
+		scanned++
+	}
+
+	return nil, nil
+}
+
+// RetractableUpdate returns the update with the given ID from the history.
+func (t *BoltTransport) RetractableUpdate(_ context.Context, id string) (*Update, error) {
+	var update *Update
+
+	err := t.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.bucketName))
+		if b == nil {
+			return ErrUpdateNotFound
+		}
+
+		k, v := findHistoryKey(b.Cursor(), id)
+		if k == nil || isRetracted(v) {
+			return ErrUpdateNotFound
+		}
+
+		if err := json.Unmarshal(v, &update); err != nil {
+			return fmt.Errorf("unable to unmarshal update: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt error: %w", err)
+	}
+
+	return update, nil
+}
+
+// Retract replaces the stored update with a tombstone and appends the
+// retraction update in the same transaction, then dispatches the retraction.
+// The tombstone keeps the key, so a subscriber reconnecting with the retracted
+// ID as Last-Event-ID still resumes from the right position.
+func (t *BoltTransport) Retract(ctx context.Context, id string, retraction *Update) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	retraction.AssignUUID()
+
+	retractionJSON, err := json.Marshal(retraction)
+	if err != nil {
+		return fmt.Errorf("error when marshaling update: %w", err)
+	}
+
+	if t.eventTTL > 0 {
+		retractionJSON = withStoredAt(retractionJSON, time.Now())
+	}
+
+	updates := []*Update{retraction}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
 
-		// The DB is append-only
-		bucket.FillPercent = 1
+	var lastSeq uint64
 
-		t.lastSeq = seq
-		t.lastEventID = updateID
+	if err := t.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(t.bucketName))
+		if bucket == nil {
+			return ErrUpdateNotFound
+		}
+
+		k, v := findHistoryKey(bucket.Cursor(), id)
+		if k == nil || isRetracted(v) {
+			return ErrUpdateNotFound
+		}
 
-		if err := bucket.Put(key, updateJSON); err != nil {
+		if err := bucket.Put(k, []byte{}); err != nil {
 			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
 		}
 
-		return t.cleanup(bucket, seq)
+		lastSeq, err = t.store(tx, bucket, updates, [][]byte{retractionJSON})
+
+		return err
 	}); err != nil {
 		return fmt.Errorf("bolt error: %w", err)
 	}
 
+	t.advance(updates, lastSeq)
+
+	for _, s := range t.subscribers.MatchAny(retraction) {
+		s.Dispatch(ctx, retraction, false)
+	}
+
 	return nil
 }
 
-// cleanup removes entries in the history above the size limit, triggered probabilistically.
+// PurgeHistory replaces the updates of the history matching the selector with
+// tombstones, in a single transaction, exempt ones included.
+func (t *BoltTransport) PurgeHistory(ctx context.Context, sel *HistoryPurgeSelector, dryRun bool) (int, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	if isClosed(t.closed) {
+		return 0, ErrClosedTransport
+	}
+
+	var n int
+
+	if err := t.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(t.bucketName))
+		if bucket == nil {
+			return nil // No data
+		}
+
+		var purged [][]byte
+
+		if err := bucket.ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if isRetracted(v) {
+				return nil
+			}
+
+			var u Update
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("%q: unable to unmarshal update: %w", k[8:], err)
+			}
+
+			if sel.Match(t.topicMatcherStore, &u) {
+				// Keys are only valid during the transaction, and must not be
+				// modified while iterating.
+				purged = append(purged, bytes.Clone(k))
+			}
+
+			return nil
+		}); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		n = len(purged)
+		if dryRun {
+			return nil
+		}
+
+		for _, k := range purged {
+			if err := bucket.Put(k, []byte{}); err != nil {
+				return fmt.Errorf("%w: unable to put value in Bolt DB: %w", ErrHistoryPurge, err)
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return 0, fmt.Errorf("bolt error: %w", err)
+	}
+
+	if !dryRun && n > 0 {
+		t.modified.Store(time.Now().UnixNano())
+	}
+
+	return n, nil
+}
+
+// ReadHistory calls fn for every update of the history not expired, oldest
+// first.
+func (t *BoltTransport) ReadHistory(ctx context.Context, fn func(u *Update) error) error {
+	now := time.Now()
+
+	return t.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.bucketName))
+		if b == nil {
+			return nil // No data
+		}
+
+		return b.ForEach(func(k, v []byte) error {
+			if err := ctx.Err(); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if isRetracted(v) || t.expired(k, v, now) {
+				return nil
+			}
+
+			var update *Update
+			if err := json.Unmarshal(v, &update); err != nil {
+				return fmt.Errorf("%q: unable to unmarshal update: %w", k[8:], err)
+			}
+
+			return fn(update)
+		})
+	})
+}
+
+// FetchSince returns up to limit updates of the history not expired published
+// after the one with the ID lastEventID. Unlike history replay, the search for
+// lastEventID is not capped by maxHistoryScan, for all the pages of a long
+// history to be fetched: only the keys are compared, most recent first.
+func (t *BoltTransport) FetchSince(ctx context.Context, lastEventID string, topics []string, limit int) ([]*Update, error) {
+	var updates []*Update
+
+	now := time.Now()
+
+	err := t.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(t.bucketName))
+		if b == nil {
+			if lastEventID == EarliestLastEventID {
+				return nil // No data
+			}
+
+			return ErrUpdateNotFound
+		}
+
+		c := b.Cursor()
+
+		k, v := c.First()
+		if lastEventID != EarliestLastEventID {
+			k, _ = c.Last()
+			for k != nil && string(k[8:]) != lastEventID {
+				k, _ = c.Prev()
+			}
+
+			if k == nil {
+				return ErrUpdateNotFound
+			}
+
+			k, v = c.Next()
+		}
+
+		for ; k != nil && len(updates) < limit; k, v = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			if isRetracted(v) || t.expired(k, v, now) {
+				continue
+			}
+
+			var update *Update
+			if err := json.Unmarshal(v, &update); err != nil {
+				return fmt.Errorf("%q: unable to unmarshal update: %w", k[8:], err)
+			}
+
+			if len(topics) == 0 || slices.ContainsFunc(update.topics(), func(topic string) bool { return slices.Contains(topics, topic) }) {
+				updates = append(updates, update)
+			}
+		}
+
+		return nil
+	})
+
+	return updates, err
+}
+
+// HistoryVersion implements TransportHistoryVersion. The version is the ID of
+// the last write transaction of the database, which also changes when the
+// other buckets are written to. With an event TTL, the history changes with
+// time: the version can't be told.
+func (t *BoltTransport) HistoryVersion(_ context.Context) (string, time.Time, error) {
+	if t.eventTTL > 0 {
+		return "", time.Time{}, nil
+	}
+
+	var txID int
+
+	if err := t.view(func(tx *bolt.Tx) error {
+		txID = tx.ID()
+
+		return nil
+	}); err != nil {
+		return "", time.Time{}, err
+	}
+
+	// The time the transport has been opened tells apart the databases
+	// restored from a backup, reusing the transaction IDs.
+	return strconv.FormatInt(t.openedAt, 36) + "." + strconv.Itoa(txID), time.Unix(0, t.modified.Load()), nil
+}
+
+// isRetracted reports whether a history value is the tombstone of a retracted
+// update.
+func isRetracted(v []byte) bool {
+	return len(v) == 0
+}
+
+// cleanup removes entries in the history above the size limit, exceeding
+// the retention policies or expired, and compacts the history when enabled,
+// triggered probabilistically.
 func (t *BoltTransport) cleanup(bucket *bolt.Bucket, lastID uint64) error {
-	if t.size == 0 ||
+	trim := t.size != 0 && t.size < lastID
+	expiring := bucket.Tx().Bucket([]byte(t.bucketName + boltExpiresBucketSuffix))
+
+	if (!trim && !t.compaction && t.retention == nil && t.eventTTL == 0 && expiring == nil) ||
 		t.cleanupFrequency == 0 ||
-		t.size >= lastID ||
 		(t.cleanupFrequency != 1 && rand.Float64() < t.cleanupFrequency) { //nolint:gosec
 		return nil
 	}
 
+	if t.compaction {
+		if err := t.compact(bucket); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case t.retention != nil:
+		if err := t.applyRetention(bucket); err != nil {
+			return err
+		}
+	case trim:
+		if err := t.trim(bucket, lastID); err != nil {
+			return err
+		}
+	}
+
+	if expiring != nil {
+		if err := t.removeExpiredUpdates(bucket, expiring, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	if t.eventTTL > 0 {
+		return t.expireHistory(bucket)
+	}
+
+	return nil
+}
+
+// trim removes the entries in the history above the size limit.
+func (t *BoltTransport) trim(bucket *bolt.Bucket, lastID uint64) error {
 	removeUntil := lastID - t.size
 
 	c := bucket.Cursor()
-	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+	for k, v := c.First(); k != nil; k, v = c.Next() {
 		if binary.BigEndian.Uint64(k[:8]) > removeUntil {
 			break
 		}
 
+		if t.exemptEntry(v) {
+			continue
+		}
+
 		if err := bucket.Delete(k); err != nil {
-			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+			return fmt.Errorf("%w: unable to delete value in Bolt DB: %w", ErrHistoryPurge, err)
 		}
 	}
 
 	return nil
 }
 
+// DispatchesSynchronously returns true: the updates are handed to the
+// subscribers once stored.
+func (*BoltTransport) DispatchesSynchronously() bool {
+	return true
+}
+
 // Interface guards.
 var (
-	_ Transport            = (*BoltTransport)(nil)
-	_ TransportSubscribers = (*BoltTransport)(nil)
+	_ Transport                      = (*BoltTransport)(nil)
+	_ TransportSynchronousDispatcher = (*BoltTransport)(nil)
+	_ TransportSubscribers           = (*BoltTransport)(nil)
+	_ TransportGroupDispatcher       = (*BoltTransport)(nil)
+	_ TransportRetracter             = (*BoltTransport)(nil)
+	_ TransportDisconnecter          = (*BoltTransport)(nil)
+	_ TransportRedeliverer           = (*BoltTransport)(nil)
+	_ TransportSubscriberSharder     = (*BoltTransport)(nil)
+	_ TransportHistoryReader         = (*BoltTransport)(nil)
+	_ TransportHistory               = (*BoltTransport)(nil)
+	_ TransportTopicMatcherStore     = (*BoltTransport)(nil)
+	_ TransportIdempotencyIndex      = (*BoltTransport)(nil)
+	_ TransportHistoryChainVerifier  = (*BoltTransport)(nil)
+	_ TransportRetentionExemptions   = (*BoltTransport)(nil)
+	_ TransportHistoryVersion        = (*BoltTransport)(nil)
+	_ TransportTopicSequencer        = (*BoltTransport)(nil)
+	_ TransportHistoryPurger         = (*BoltTransport)(nil)
 )
@@ -3,6 +3,7 @@
 package mercure
 
 import (
+	"log/slog"
 	"net/url"
 	"os"
 	"testing"
@@ -39,3 +40,27 @@ func TestNewBoltTransport(t *testing.T) {
 	_, err = DeprecatedNewBoltTransport(u, nil)
 	require.EqualError(t, err, `"bolt://test.db?size=invalid": invalid "size" parameter "invalid": invalid transport: strconv.ParseUint: parsing "invalid": invalid syntax`)
 }
+
+//nolint:paralleltest // Overrides the factory of the bolt scheme.
+func TestNewTransportRegisteredFactory(t *testing.T) {
+	u, _ := url.Parse("bolt://test-" + t.Name() + ".db?write_timeout=5s")
+	transport, err := NewTransport(u, nil)
+	require.NoError(t, err)
+	require.IsType(t, &BoltTransport{}, transport)
+	require.NoError(t, transport.Close(t.Context()))
+	require.NoError(t, os.Remove("test-"+t.Name()+".db"))
+
+	RegisterTransportFactory("bolt", func(_ *url.URL, _ *slog.Logger) (Transport, error) {
+		return NewLocalTransport(NewSubscriberList(0)), nil
+	})
+	t.Cleanup(func() {
+		transportFactoriesMu.Lock()
+		delete(transportFactories, "bolt")
+		transportFactoriesMu.Unlock()
+	})
+
+	transport, err = NewTransport(u, nil)
+	require.NoError(t, err)
+	require.IsType(t, &LocalTransport{}, transport)
+	require.NoError(t, transport.Close(t.Context()))
+}
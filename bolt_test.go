@@ -6,10 +6,14 @@ import (
 	"encoding/binary"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"slices"
 	"strconv"
 	"testing"
 	"testing/synctest"
+	"time"
 
+	"github.com/gofrs/uuid/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	bolt "go.etcd.io/bbolt"
@@ -203,6 +207,84 @@ func TestBoltTransportPurgeHistory(t *testing.T) {
 	}))
 }
 
+func TestBoltTransportCompaction(t *testing.T) {
+	t.Parallel()
+
+	for tail, expected := range map[uint64][]string{
+		2: {"3", "4", "6", "7"},
+		// 5, superseded by 7, is part of the tail.
+		3: {"3", "4", "5", "6", "7"},
+	} {
+		t.Run(strconv.FormatUint(tail, 10), func(t *testing.T) {
+			t.Parallel()
+
+			transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), defaultBoltBucketName, 0, 1)
+			require.NoError(t, err)
+			t.Cleanup(func() { require.NoError(t, transport.Close(t.Context())) })
+
+			transport.EnableCompaction(tail)
+
+			for i, u := range []*Update{
+				{Topic: "https://example.com/foo", CompactionKey: "a"},
+				{Topic: "https://example.com/foo", CompactionKey: "b"},
+				{Topic: "https://example.com/foo"},
+				{Topic: "https://example.com/bar", CompactionKey: "a"},
+				{Topic: "https://example.com/foo", CompactionKey: "a"},
+				{Topic: "https://example.com/foo", CompactionKey: "b"},
+				{Topic: "https://example.com/foo", CompactionKey: "a"},
+			} {
+				u.ID = strconv.Itoa(i + 1)
+				require.NoError(t, transport.Dispatch(t.Context(), u))
+			}
+
+			var ids []string
+			require.NoError(t, transport.ReadHistory(t.Context(), func(u *Update) error {
+				ids = append(ids, u.ID)
+
+				return nil
+			}))
+
+			assert.Equal(t, expected, ids)
+		})
+	}
+}
+
+func TestBoltTransportReplaySince(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	topics := []string{"https://example.com/foo"}
+
+	var ids []string
+
+	for _, age := range []time.Duration{3 * time.Hour, 2 * time.Hour, 0, time.Minute} {
+		id := "custom"
+		if age != 0 {
+			u, err := uuid.NewV7AtTime(time.Now().Add(-age))
+			require.NoError(t, err)
+
+			id = "urn:uuid:" + u.String()
+		}
+
+		ids = append(ids, id)
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: id}, Topic: topics[0]}))
+	}
+
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.ReplaySince = time.Now().Add(-time.Hour)
+	s.setMatchers(stringsToExactMatchers(topics), nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	// The truncation event has the ID of the last skipped update.
+	truncation := <-s.Receive()
+	assert.Equal(t, ids[1], truncation.ID)
+	assert.Equal(t, reservedEventType, truncation.Type)
+	assert.Contains(t, truncation.Data, `"type":"ReplayTruncated"`)
+
+	assert.Equal(t, ids[2], (<-s.Receive()).ID)
+	assert.Equal(t, ids[3], (<-s.Receive()).ID)
+}
+
 func TestBoltTransportDoNotDispatchUntilListen(t *testing.T) {
 	t.Parallel()
 
@@ -276,6 +358,33 @@ func TestBoltTransportClosed(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestBoltTransportConcurrentClose(t *testing.T) {
+	t.Parallel()
+
+	testTransportConcurrentClose(t, createBoltTransport(t, 0, 0))
+}
+
+func TestBoltTransportCloseDuringHistory(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	ctx := t.Context()
+
+	for range 100 {
+		require.NoError(t, transport.Dispatch(ctx, &Update{Topic: "https://example.com/foo"}))
+	}
+
+	require.NoError(t, transport.Close(ctx))
+
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/foo"}), nil)
+	require.ErrorIs(t, transport.AddSubscriber(ctx, s), ErrClosedTransport)
+
+	_, err := transport.RetractableUpdate(ctx, "foo")
+	require.ErrorIs(t, err, ErrClosedTransport)
+	require.ErrorIs(t, transport.ReadHistory(ctx, func(*Update) error { return nil }), ErrClosedTransport)
+}
+
 func TestBoltCleanDisconnectedSubscribers(t *testing.T) {
 	t.Parallel()
 
@@ -358,3 +467,160 @@ func TestBoltLastEventID(t *testing.T) {
 	lastEventID, _, _ := transport.GetSubscribers(t.Context())
 	assert.Equal(t, "foo", lastEventID)
 }
+
+func TestBoltTransportDispatchGroup(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "before"}, Topic: "https://example.com/foo"}))
+	require.NoError(t, transport.DispatchGroup(t.Context(), []*Update{
+		{Event: Event{ID: "1"}, Topic: "https://example.com/foo"},
+		{Event: Event{ID: "2"}, Topic: "https://example.com/bar"},
+		{Topic: "https://example.com/baz"},
+	}))
+
+	assert.Equal(t, uint64(4), transport.lastSeq)
+
+	var ids []string
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(defaultBoltBucketName)).ForEach(func(k, _ []byte) error {
+			ids = append(ids, string(k[8:]))
+
+			return nil
+		})
+	}))
+
+	require.Len(t, ids, 4)
+	assert.Equal(t, []string{"before", "1", "2"}, ids[:3])
+	assert.Equal(t, ids[3], transport.lastEventID)
+}
+
+func TestBoltTransportRetract(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+
+	topics := []string{"https://example.com/foo"}
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Event: Event{ID: strconv.Itoa(i)},
+			Topic: topics[0],
+		}))
+	}
+
+	u, err := transport.RetractableUpdate(t.Context(), "2")
+	require.NoError(t, err)
+	assert.Equal(t, topics[0], u.Topic)
+
+	require.NoError(t, transport.Retract(t.Context(), "2", &Update{Event: Event{ID: "r"}, Topic: topics[0]}))
+	assert.Equal(t, "r", transport.lastEventID)
+
+	_, err = transport.RetractableUpdate(t.Context(), "2")
+	require.ErrorIs(t, err, ErrUpdateNotFound)
+	require.ErrorIs(t, transport.Retract(t.Context(), "2", &Update{Topic: topics[0]}), ErrUpdateNotFound)
+
+	_, err = transport.RetractableUpdate(t.Context(), "unknown")
+	require.ErrorIs(t, err, ErrUpdateNotFound)
+
+	// A subscriber resuming from the retracted update still gets the
+	// following ones.
+	for lastEventID, expected := range map[string][]string{
+		EarliestLastEventID: {"1", "3", "r"},
+		"2":                 {"3", "r"},
+	} {
+		s := NewLocalSubscriber(lastEventID, transport.logger, &TopicMatcherStore{})
+		s.setMatchers(stringsToExactMatchers(topics), nil)
+		require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+		for _, id := range expected {
+			assert.Equal(t, id, (<-s.Receive()).ID)
+		}
+
+		assert.Equal(t, lastEventID, <-s.responseLastEventID)
+	}
+}
+
+func FuzzBoltLastEventID(f *testing.F) {
+	for _, id := range []string{"", EarliestLastEventID, "1", "2", "3", "unknown", "\x00"} {
+		f.Add(id)
+	}
+
+	topics := []string{"https://example.com/foo"}
+
+	f.Fuzz(func(t *testing.T, lastEventID string) {
+		transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), defaultBoltBucketName, 0, BoltDefaultCleanupFrequency)
+		require.NoError(t, err)
+
+		t.Cleanup(func() { assert.NoError(t, transport.Close(t.Context())) })
+
+		history := []string{"1", "2", "3"}
+		for _, id := range history {
+			require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: id}, Topic: topics[0]}))
+		}
+
+		s := NewLocalSubscriber(lastEventID, transport.logger, &TopicMatcherStore{})
+		s.setMatchers(stringsToExactMatchers(topics), nil)
+
+		require.NoError(t, transport.AddSubscriber(t.Context(), s))
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "live"}, Topic: topics[0]}))
+
+		// Only the updates following the requested one are replayed.
+		var want []string
+
+		switch i := slices.Index(history, lastEventID); {
+		case lastEventID == EarliestLastEventID:
+			want = history
+		case i != -1 && i < len(history)-1:
+			want = history[i+1:]
+		}
+
+		var received []string
+
+		for u := range s.Receive() {
+			if u.ID == "live" {
+				break
+			}
+
+			received = append(received, u.ID)
+		}
+
+		assert.Equal(t, want, received)
+	})
+}
+
+func TestBoltTransportFetchSince(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+
+	for i, topic := range []string{"https://example.com/1", "https://example.com/2", "https://example.com/1", "https://example.com/1"} {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: topic, Event: Event{ID: strconv.Itoa(i + 1)}}))
+	}
+
+	require.NoError(t, transport.Retract(t.Context(), "3", &Update{Topic: "https://example.com/1", Event: Event{ID: "r3"}}))
+
+	ids := func(updates []*Update) (ids []string) {
+		for _, u := range updates {
+			ids = append(ids, u.ID)
+		}
+
+		return ids
+	}
+
+	updates, err := transport.FetchSince(t.Context(), EarliestLastEventID, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2", "4", "r3"}, ids(updates))
+
+	updates, err = transport.FetchSince(t.Context(), "1", []string{"https://example.com/1"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4"}, ids(updates))
+
+	updates, err = transport.FetchSince(t.Context(), "r3", nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, updates)
+
+	_, err = transport.FetchSince(t.Context(), "unknown", nil, 10)
+	require.ErrorIs(t, err, ErrUpdateNotFound)
+}
@@ -0,0 +1,256 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltHashChainBucketSuffix is appended to the name of the bucket of the
+// history to name the bucket of its hash chain. The entries have the key of
+// the update they cover, and hold the SHA-256 hash of its stored value,
+// followed by the hash chaining it: the hash of the one of the previous
+// update, the key and the hash of the value.
+const boltHashChainBucketSuffix = "_hash_chain"
+
+// boltHashChainAnchorKey is the key of the hash chain holding the hash of the
+// last update removed from it, sorted before the keys of the updates.
+var boltHashChainAnchorKey = make([]byte, 8) //nolint:gochecknoglobals
+
+// EnableHashChain hash-chains the updates stored from now on: the hash of
+// every update covers the one of the previous update, so modifying, removing
+// or inserting an update breaks the chain, see VerifyHistoryChain. The
+// updates removed by the cleanup of the history, and the tombstones of the
+// retracted updates, are reported by the verification, but don't break the
+// chain.
+//
+// Once enabled, the chain must stay enabled: the updates stored without it
+// after the first chained one are reported as tampered with.
+//
+// EnableHashChain must be called before dispatching updates.
+func (t *BoltTransport) EnableHashChain() {
+	t.hashChain = true
+}
+
+// store appends updates to the history, chains them, and cleans the history
+// up.
+func (t *BoltTransport) store(tx *bolt.Tx, bucket *bolt.Bucket, updates []*Update, updateJSONs [][]byte) (uint64, error) {
+	lastSeq, err := appendUpdates(bucket, updates, updateJSONs)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := t.indexExpiringUpdates(tx, updates, lastSeq); err != nil {
+		return 0, err
+	}
+
+	if !t.hashChain {
+		return lastSeq, t.cleanup(bucket, lastSeq)
+	}
+
+	chain, err := tx.CreateBucketIfNotExists([]byte(t.bucketName + boltHashChainBucketSuffix))
+	if err != nil {
+		return 0, fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+	}
+
+	if err := appendHashChain(chain, updates, updateJSONs, lastSeq); err != nil {
+		return 0, err
+	}
+
+	if err := t.cleanup(bucket, lastSeq); err != nil {
+		return 0, err
+	}
+
+	return lastSeq, pruneHashChain(chain, bucket)
+}
+
+// appendHashChain chains the updates just appended to the history, ending
+// with the sequence lastSeq.
+func appendHashChain(chain *bolt.Bucket, updates []*Update, updateJSONs [][]byte, lastSeq uint64) error {
+	// The DB is append-only
+	chain.FillPercent = 1
+
+	prev := make([]byte, sha256.Size)
+	if k, v := chain.Cursor().Last(); k != nil {
+		copy(prev, v[len(v)-sha256.Size:])
+	}
+
+	for i, update := range updates {
+		key := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(update.ID)), lastSeq-uint64(len(updates)-1-i)) //nolint:gosec
+		key = append(key, update.ID...)
+
+		digest := sha256.Sum256(updateJSONs[i])
+		link := chainLink(prev, key, digest[:])
+
+		if err := chain.Put(key, append(digest[:], link...)); err != nil {
+			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+		}
+
+		prev = link
+	}
+
+	return nil
+}
+
+// chainLink returns the hash chaining an entry to the previous one.
+func chainLink(prev, key, digest []byte) []byte {
+	h := sha256.New()
+	h.Write(prev)
+	h.Write(key)
+	h.Write(digest)
+
+	return h.Sum(nil)
+}
+
+// pruneHashChain removes the entries of the chain older than the oldest
+// update of the history, the hash of the last one being kept as anchor.
+func pruneHashChain(chain, history *bolt.Bucket) error {
+	first, _ := history.Cursor().First()
+
+	var anchor []byte
+
+	c := chain.Cursor()
+	for k, v := c.Seek(boltHashChainFirstKey()); k != nil && (first == nil || bytes.Compare(k, first) < 0); k, v = c.Seek(boltHashChainFirstKey()) {
+		anchor = bytes.Clone(v[sha256.Size:])
+
+		if err := chain.Delete(k); err != nil {
+			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+		}
+	}
+
+	if anchor == nil {
+		return nil
+	}
+
+	if err := chain.Put(boltHashChainAnchorKey, anchor); err != nil {
+		return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+	}
+
+	return nil
+}
+
+// boltHashChainFirstKey returns the smallest key of an update, sequences
+// starting at 1.
+func boltHashChainFirstKey() []byte {
+	return binary.BigEndian.AppendUint64(nil, 1)
+}
+
+// VerifyHistoryChain checks the history against its hash chain.
+func (t *BoltTransport) VerifyHistoryChain(ctx context.Context) (*HistoryChainReport, error) {
+	var r *HistoryChainReport
+
+	err := t.view(func(tx *bolt.Tx) error {
+		var err error
+		r, err = verifyHashChain(ctx, tx, t.bucketName)
+
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// VerifyHistoryChain checks the history against its hash chain.
+func (b *BoltHistory) VerifyHistoryChain(ctx context.Context) (*HistoryChainReport, error) {
+	var r *HistoryChainReport
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		var err error
+		r, err = verifyHashChain(ctx, tx, b.bucketName)
+
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt error: %w", err)
+	}
+
+	return r, nil
+}
+
+// verifyHashChain walks the chain, checking every link and the content of the
+// updates still in the history, then looks for the updates missing from the
+// chain.
+func verifyHashChain(ctx context.Context, tx *bolt.Tx, bucketName string) (*HistoryChainReport, error) {
+	r := &HistoryChainReport{}
+
+	history := tx.Bucket([]byte(bucketName))
+	chain := tx.Bucket([]byte(bucketName + boltHashChainBucketSuffix))
+
+	// The updates stored after the start of the chain must be chained.
+	var start []byte
+
+	if chain != nil {
+		prev := make([]byte, sha256.Size)
+
+		c := chain.Cursor()
+
+		k, v := c.First()
+		if bytes.Equal(k, boltHashChainAnchorKey) {
+			copy(prev, v)
+
+			start = boltHashChainAnchorKey
+			k, v = c.Next()
+		}
+
+		for ; k != nil; k, v = c.Next() {
+			if err := ctx.Err(); err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+
+			if start == nil {
+				start = k
+			}
+
+			if len(k) < 8 || len(v) != 2*sha256.Size || !bytes.Equal(v[sha256.Size:], chainLink(prev, k, v[:sha256.Size])) {
+				return nil, fmt.Errorf("%w: %q: broken chain", ErrHistoryTampered, k[min(len(k), 8):])
+			}
+
+			prev = v[sha256.Size:]
+			r.Head, r.HeadEventID = hex.EncodeToString(prev), string(k[8:])
+
+			var value []byte
+			if history != nil {
+				value = history.Get(k)
+			}
+
+			switch {
+			case value == nil:
+				r.Removed++
+			case isRetracted(value):
+				r.Retracted++
+			default:
+				if digest := sha256.Sum256(value); !bytes.Equal(digest[:], v[:sha256.Size]) {
+					return nil, fmt.Errorf("%w: %q: content modified", ErrHistoryTampered, k[8:])
+				}
+
+				r.Verified++
+			}
+		}
+	}
+
+	if history == nil {
+		return r, nil
+	}
+
+	c := history.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		if start != nil && bytes.Compare(k, start) >= 0 {
+			if chain.Get(k) == nil {
+				return nil, fmt.Errorf("%w: %q: not chained", ErrHistoryTampered, k[min(len(k), 8):])
+			}
+
+			continue
+		}
+
+		r.Unchained++
+	}
+
+	return r, nil
+}
@@ -0,0 +1,138 @@
+package mercure
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newHashChainedBoltTransport(t *testing.T, path string, size uint64) *BoltTransport {
+	t.Helper()
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", size, 1)
+	require.NoError(t, err)
+
+	transport.EnableHashChain()
+
+	return transport
+}
+
+func TestBoltHashChain(t *testing.T) {
+	t.Parallel()
+
+	transport := newHashChainedBoltTransport(t, filepath.Join(t.TempDir(), "bolt.db"), 0)
+	defer transport.Close(t.Context())
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/foo", Event: Event{ID: id}}))
+	}
+
+	r, err := transport.VerifyHistoryChain(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 3, r.Verified)
+	assert.Equal(t, "3", r.HeadEventID)
+	assert.Len(t, r.Head, 64)
+
+	require.NoError(t, transport.Retract(t.Context(), "2", &Update{Topic: "https://example.com/foo", Event: Event{ID: "4"}}))
+
+	r, err = transport.VerifyHistoryChain(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, HistoryChainReport{Verified: 3, Retracted: 1, Head: r.Head, HeadEventID: "4"}, *r)
+
+	hub := createDummy(t, WithTransport(transport))
+	r, err = hub.VerifyHistoryChain(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 3, r.Verified)
+
+	_, err = createDummy(t).VerifyHistoryChain(t.Context())
+	require.ErrorIs(t, err, ErrHistoryChainNotSupported)
+}
+
+func TestBoltHashChainTampered(t *testing.T) {
+	t.Parallel()
+
+	for name, tamper := range map[string]func(history, chain *bolt.Bucket) error{
+		"modified": func(history, _ *bolt.Bucket) error {
+			k, _ := history.Cursor().First()
+
+			return history.Put(k, []byte(`{"ID":"1","Data":"tampered"}`))
+		},
+		"inserted": func(history, _ *bolt.Bucket) error {
+			k, _ := history.Cursor().First()
+
+			return history.Put(append(k[:8:8], "1bis"...), []byte(`{"ID":"1bis"}`))
+		},
+		"removed from the chain": func(_, chain *bolt.Bucket) error {
+			k, _ := chain.Cursor().First()
+
+			return chain.Delete(k)
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			transport := newHashChainedBoltTransport(t, filepath.Join(t.TempDir(), "bolt.db"), 0)
+			defer transport.Close(t.Context())
+
+			for _, id := range []string{"1", "2"} {
+				require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/foo", Event: Event{ID: id}}))
+			}
+
+			require.NoError(t, transport.db.Update(func(tx *bolt.Tx) error {
+				return tamper(tx.Bucket([]byte(defaultBoltBucketName)), tx.Bucket([]byte(defaultBoltBucketName+boltHashChainBucketSuffix)))
+			}))
+
+			_, err := transport.VerifyHistoryChain(t.Context())
+			require.ErrorIs(t, err, ErrHistoryTampered)
+		})
+	}
+}
+
+func TestBoltHashChainCleanup(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "bolt.db")
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 1)
+	require.NoError(t, err)
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/foo", Event: Event{ID: "unchained"}}))
+	require.NoError(t, transport.Close(t.Context()))
+
+	transport = newHashChainedBoltTransport(t, path, 3)
+
+	for _, id := range []string{"1", "2"} {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/foo", Event: Event{ID: id}}))
+	}
+
+	r, err := transport.VerifyHistoryChain(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, 2, r.Verified)
+	assert.Equal(t, 1, r.Unchained)
+
+	head := r.Head
+
+	// The size limit removes the oldest updates, and their hashes.
+	for _, id := range []string{"3", "4"} {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/foo", Event: Event{ID: id}}))
+	}
+
+	r, err = transport.VerifyHistoryChain(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, HistoryChainReport{Verified: 3, Head: r.Head, HeadEventID: "4"}, *r)
+	assert.NotEqual(t, head, r.Head)
+
+	require.NoError(t, transport.Close(t.Context()))
+
+	h, err := OpenBoltHistory(path, "", true)
+	require.NoError(t, err)
+
+	defer h.Close()
+
+	offline, err := h.VerifyHistoryChain(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, r, offline)
+}
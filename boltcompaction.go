@@ -0,0 +1,76 @@
+package mercure
+
+import (
+	"encoding/json"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// compactionEntry holds the fields of a stored update identifying the entity
+// it describes.
+type compactionEntry struct {
+	Topics        []string
+	CompactionKey string
+}
+
+// EnableCompaction compacts the history when it is cleaned up, like a Kafka
+// compacted topic: only the most recent update having a given topic and
+// compaction key (see Update.CompactionKey) is kept, so replaying the history
+// still yields the latest state of every entity. The tail most recent updates
+// are never compacted, for the subscribers reconnecting with a recent
+// Last-Event-ID. The updates without compaction key are not compacted.
+//
+// EnableCompaction must be called before dispatching updates.
+func (t *BoltTransport) EnableCompaction(tail uint64) {
+	t.compaction = true
+	t.compactionTail = tail
+}
+
+// compact removes the updates superseded by a more recent update having the
+// same topic and compaction key, except for the most recent ones.
+func (t *BoltTransport) compact(bucket *bolt.Bucket) error {
+	var (
+		seen       = make(map[[2]string]struct{})
+		superseded [][]byte
+		n          uint64
+	)
+
+	c := bucket.Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		if isRetracted(v) {
+			continue
+		}
+
+		n++
+
+		var e compactionEntry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return fmt.Errorf("%w: %q: unable to unmarshal update: %w", ErrHistoryPurge, k[8:], err)
+		}
+
+		if e.CompactionKey == "" || len(e.Topics) == 0 {
+			continue
+		}
+
+		key := [2]string{e.Topics[0], e.CompactionKey}
+		if _, ok := seen[key]; ok && n > t.compactionTail {
+			if !t.exempted(e.Topics) {
+				superseded = append(superseded, k)
+			}
+
+			continue
+		}
+
+		seen[key] = struct{}{}
+	}
+
+	// Deleting while iterating would move the cursor.
+	for _, k := range superseded {
+		if err := bucket.Delete(k); err != nil {
+			return fmt.Errorf("%w: unable to delete value in Bolt DB: %w", ErrHistoryPurge, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+package mercure
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltDeadLettersBucketSuffix is appended to the name of the bucket of the
+// history to name the bucket of the dead letters.
+const boltDeadLettersBucketSuffix = "_dead_letters"
+
+// BoltDeadLetterStore is a DeadLetterStore keeping the dead letters in a
+// bucket of the database of a BoltTransport, so they survive restarts.
+type BoltDeadLetterStore struct {
+	transport  *BoltTransport
+	bucketName string
+	size       uint64
+}
+
+// NewBoltDeadLetterStore creates a BoltDeadLetterStore keeping the size most
+// recently recorded dead letters in the database of the transport, 1000 when
+// 0.
+func NewBoltDeadLetterStore(transport *BoltTransport, size uint64) *BoltDeadLetterStore {
+	if size == 0 {
+		size = defaultDeadLetterStoreSize
+	}
+
+	return &BoltDeadLetterStore{transport: transport, bucketName: transport.bucketName + boltDeadLettersBucketSuffix, size: size}
+}
+
+// AddDeadLetter stores the dead letter, removing the ones recorded before the
+// size most recent ones.
+func (s *BoltDeadLetterStore) AddDeadLetter(_ context.Context, dl *DeadLetter) error {
+	v, err := json.Marshal(dl)
+	if err != nil {
+		return fmt.Errorf("error when marshaling dead letter: %w", err)
+	}
+
+	err = s.transport.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(s.bucketName))
+		if err != nil {
+			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+		}
+
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return fmt.Errorf("error when generating Bolt DB sequence: %w", err)
+		}
+
+		// Like the history, the keys are prefixed with the sequence, to be
+		// ordered.
+		k := binary.BigEndian.AppendUint64(make([]byte, 0, 8+len(dl.ID)), seq)
+		if err := bucket.Put(append(k, dl.ID...), v); err != nil {
+			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+		}
+
+		if seq <= s.size {
+			return nil
+		}
+
+		c := bucket.Cursor()
+		for k, _ := c.First(); k != nil && binary.BigEndian.Uint64(k[:8]) <= seq-s.size; k, _ = c.First() {
+			if err := bucket.Delete(k); err != nil {
+				return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return ErrClosedTransport
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// DeadLetters returns up to limit dead letters, oldest first.
+func (s *BoltDeadLetterStore) DeadLetters(_ context.Context, limit int) ([]*DeadLetter, error) {
+	var letters []*DeadLetter
+
+	err := s.transport.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(s.bucketName))
+		if bucket == nil {
+			return nil // No data
+		}
+
+		c := bucket.Cursor()
+		for k, v := c.First(); k != nil && (limit <= 0 || len(letters) < limit); k, v = c.Next() {
+			var dl *DeadLetter
+			if err := json.Unmarshal(v, &dl); err != nil {
+				return fmt.Errorf("%q: unable to unmarshal dead letter: %w", k[8:], err)
+			}
+
+			letters = append(letters, dl)
+		}
+
+		return nil
+	})
+
+	return letters, err
+}
+
+// DeadLetter returns the dead letter with the ID.
+func (s *BoltDeadLetterStore) DeadLetter(_ context.Context, id string) (*DeadLetter, error) {
+	var dl *DeadLetter
+
+	err := s.transport.view(func(tx *bolt.Tx) error {
+		_, v := s.find(tx, id)
+		if v == nil {
+			return ErrDeadLetterNotFound
+		}
+
+		if err := json.Unmarshal(v, &dl); err != nil {
+			return fmt.Errorf("%q: unable to unmarshal dead letter: %w", id, err)
+		}
+
+		return nil
+	})
+
+	return dl, err
+}
+
+// RemoveDeadLetter removes the dead letter with the ID.
+func (s *BoltDeadLetterStore) RemoveDeadLetter(_ context.Context, id string) error {
+	err := s.transport.db.Update(func(tx *bolt.Tx) error {
+		k, _ := s.find(tx, id)
+		if k == nil {
+			return ErrDeadLetterNotFound
+		}
+
+		if err := tx.Bucket([]byte(s.bucketName)).Delete(k); err != nil {
+			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+		}
+
+		return nil
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return ErrClosedTransport
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// find returns the entry of the dead letter with the ID. The store is
+// bounded by its size: it is walked entirely.
+func (s *BoltDeadLetterStore) find(tx *bolt.Tx, id string) (k, v []byte) {
+	bucket := tx.Bucket([]byte(s.bucketName))
+	if bucket == nil {
+		return nil, nil
+	}
+
+	c := bucket.Cursor()
+	for k, v = c.First(); k != nil; k, v = c.Next() {
+		if string(k[8:]) == id {
+			return k, v
+		}
+	}
+
+	return nil, nil
+}
+
+// Interface guards.
+var _ DeadLetterStore = (*BoltDeadLetterStore)(nil)
@@ -0,0 +1,35 @@
+package mercure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltDeadLetterStore(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	testDeadLetterStore(t, NewBoltDeadLetterStore(transport, 3))
+
+	// The history is left untouched.
+	var n int
+
+	require.NoError(t, transport.ReadHistory(t.Context(), func(*Update) error {
+		n++
+
+		return nil
+	}))
+	assert.Zero(t, n)
+}
+
+func TestBoltDeadLetterStoreClosed(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	store := NewBoltDeadLetterStore(transport, 0)
+	require.NoError(t, transport.Close(t.Context()))
+
+	require.ErrorIs(t, store.AddDeadLetter(t.Context(), &DeadLetter{ID: "1", Update: &Update{}}), ErrClosedTransport)
+}
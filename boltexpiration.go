@@ -0,0 +1,188 @@
+package mercure
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// storedAtPrefix starts the stored updates dated with SetEventTTL, holding
+	// the Unix time in nanoseconds they have been stored at.
+	storedAtPrefix = `{"StoredAt":`
+	// boltExpiresBucketSuffix is appended to the name of the bucket of the
+	// history to name the bucket indexing the updates having an expiration
+	// date (see Update.Expires) by the time they expire at, in Unix
+	// nanoseconds, followed by their key in the history.
+	boltExpiresBucketSuffix = "_expires"
+)
+
+// SetEventTTL expires the updates of the history stored more than ttl ago,
+// disabled when 0. The updates are dated when they are stored, the ones
+// stored before the TTL is set are dated by their hub-generated ID, and the
+// others never expire.
+//
+// The expired updates are removed from the head of the history when it is
+// cleaned up, with the cleanup frequency, and they are never replayed, even
+// before being removed. The most recent update is kept, for the last event ID
+// to survive restarts.
+//
+// SetEventTTL must be called before dispatching updates.
+func (t *BoltTransport) SetEventTTL(ttl time.Duration) {
+	t.eventTTL = max(ttl, 0)
+}
+
+// withStoredAt prepends the time the update is stored at to its JSON
+// representation, read by storedAt. The other fields are left untouched, so
+// the value is still a regular update for the readers ignoring the date.
+func withStoredAt(updateJSON []byte, now time.Time) []byte {
+	if len(updateJSON) < 2 || updateJSON[0] != '{' {
+		return updateJSON
+	}
+
+	b := make([]byte, 0, len(storedAtPrefix)+20+len(updateJSON))
+	b = append(b, storedAtPrefix...)
+	b = strconv.AppendInt(b, now.UnixNano(), 10)
+
+	if updateJSON[1] != '}' {
+		b = append(b, ',')
+	}
+
+	return append(b, updateJSON[1:]...)
+}
+
+// storedAt returns the time a stored update has been dated with by
+// withStoredAt.
+func storedAt(v []byte) (time.Time, bool) {
+	rest, ok := bytes.CutPrefix(v, []byte(storedAtPrefix))
+	if !ok {
+		return time.Time{}, false
+	}
+
+	end := bytes.IndexAny(rest, ",}")
+	if end < 0 {
+		return time.Time{}, false
+	}
+
+	ns, err := strconv.ParseInt(string(rest[:end]), 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(0, ns), true
+}
+
+// entryTime returns the time the update of the history entry has been
+// stored at, or published at according to its ID.
+func entryTime(k, v []byte) (time.Time, bool) {
+	if t, ok := storedAt(v); ok {
+		return t, true
+	}
+
+	return updateTime(string(k[8:]))
+}
+
+// expired reports whether the update of the history entry is older than the
+// event TTL.
+func (t *BoltTransport) expired(k, v []byte, now time.Time) bool {
+	if t.eventTTL == 0 {
+		return false
+	}
+
+	at, ok := entryTime(k, v)
+
+	return ok && now.Sub(at) > t.eventTTL
+}
+
+// expireHistory removes the expired updates, and the tombstones, from the
+// head of the history, up to the first update not expired.
+func (t *BoltTransport) expireHistory(bucket *bolt.Bucket) error {
+	var (
+		c       = bucket.Cursor()
+		last, _ = c.Last()
+		now     = time.Now()
+		deleted [][]byte
+	)
+
+	for k, v := c.First(); k != nil && !bytes.Equal(k, last); k, v = c.Next() {
+		if !isRetracted(v) && !t.expired(k, v, now) {
+			break
+		}
+
+		if t.exemptEntry(v) {
+			continue
+		}
+
+		deleted = append(deleted, bytes.Clone(k))
+	}
+
+	// Deleting while iterating would move the cursor.
+	for _, k := range deleted {
+		if err := bucket.Delete(k); err != nil {
+			return fmt.Errorf("%w: unable to delete value in Bolt DB: %w", ErrHistoryPurge, err)
+		}
+	}
+
+	return nil
+}
+
+// indexExpiringUpdates indexes the updates just appended to the history,
+// ending with the sequence lastSeq, that have an expiration date.
+func (t *BoltTransport) indexExpiringUpdates(tx *bolt.Tx, updates []*Update, lastSeq uint64) error {
+	var expiring *bolt.Bucket
+
+	for i, update := range updates {
+		if update.Expires.IsZero() {
+			continue
+		}
+
+		if expiring == nil {
+			var err error
+			if expiring, err = tx.CreateBucketIfNotExists([]byte(t.bucketName + boltExpiresBucketSuffix)); err != nil {
+				return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+			}
+		}
+
+		key := binary.BigEndian.AppendUint64(make([]byte, 0, 16+len(update.ID)), uint64(max(update.Expires.UnixNano(), 0))) //nolint:gosec
+		key = binary.BigEndian.AppendUint64(key, lastSeq-uint64(len(updates)-1-i))                                          //nolint:gosec
+		key = append(key, update.ID...)
+
+		if err := expiring.Put(key, []byte{}); err != nil {
+			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// removeExpiredUpdates removes the updates of the history expired at now, in
+// the order of the expiry index, wherever they are in the history. The most
+// recent update is kept, for the last event ID to survive restarts: it is
+// removed once another update has been stored.
+func (t *BoltTransport) removeExpiredUpdates(bucket, expiring *bolt.Bucket, now time.Time) error {
+	last, _ := bucket.Cursor().Last()
+
+	c := expiring.Cursor()
+	for k, _ := c.First(); k != nil && int64(binary.BigEndian.Uint64(k[:8])) <= now.UnixNano(); k, _ = c.First() { //nolint:gosec
+		if bytes.Equal(k[8:], last) {
+			break
+		}
+
+		// The update may have been removed by the other cleanups already.
+		if !t.exemptEntry(bucket.Get(k[8:])) {
+			if err := bucket.Delete(k[8:]); err != nil {
+				return fmt.Errorf("%w: unable to delete value in Bolt DB: %w", ErrHistoryPurge, err)
+			}
+		}
+
+		if err := expiring.Delete(k); err != nil {
+			return fmt.Errorf("%w: unable to delete value in Bolt DB: %w", ErrHistoryPurge, err)
+		}
+	}
+
+	return nil
+}
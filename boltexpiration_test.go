@@ -0,0 +1,188 @@
+package mercure
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestWithStoredAt(t *testing.T) {
+	t.Parallel()
+
+	now := time.Unix(0, 1_700_000_000_123_456_789)
+
+	b, err := json.Marshal(&Update{Topic: "https://example.com/1", Event: Event{ID: "1", Data: "foo"}})
+	require.NoError(t, err)
+
+	_, ok := storedAt(b)
+	assert.False(t, ok)
+
+	b = withStoredAt(b, now)
+
+	at, ok := storedAt(b)
+	require.True(t, ok)
+	assert.True(t, now.Equal(at))
+
+	// Still a regular update.
+	var u *Update
+	require.NoError(t, json.Unmarshal(b, &u))
+	assert.Equal(t, "https://example.com/1", u.Topic)
+	assert.Equal(t, "foo", u.Data)
+
+	at, ok = storedAt(withStoredAt([]byte("{}"), now))
+	require.True(t, ok)
+	assert.True(t, now.Equal(at))
+}
+
+func TestBoltTransportEventTTL(t *testing.T) {
+	t.Parallel()
+
+	transport := createRetentionBoltTransport(t, 0)
+
+	u, err := uuid.NewV7AtTime(time.Now().Add(-2 * time.Hour))
+	require.NoError(t, err)
+
+	old := "urn:uuid:" + u.String()
+
+	// Stored before the TTL is set, dated by their ID.
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: old}}))
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: "not-dated"}}))
+
+	transport.SetEventTTL(time.Hour)
+
+	// Expired, but not removed yet.
+	ids, _ := historyIDs(t, transport)
+	assert.Equal(t, []string{old, "not-dated"}, ids)
+
+	var read []string
+	require.NoError(t, transport.ReadHistory(t.Context(), func(u *Update) error {
+		read = append(read, u.ID)
+
+		return nil
+	}))
+	assert.Equal(t, []string{"not-dated"}, read)
+
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "*"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, "not-dated", (<-s.Receive()).ID)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: "dated"}}))
+
+	ids, _ = historyIDs(t, transport)
+	assert.Equal(t, []string{"not-dated", "dated"}, ids)
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		k, v := tx.Bucket([]byte(defaultBoltBucketName)).Cursor().Last()
+
+		at, ok := entryTime(k, v)
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now(), at, time.Minute)
+
+		return nil
+	}))
+}
+
+func TestBoltTransportEventTTLKeepsNewest(t *testing.T) {
+	t.Parallel()
+
+	transport := createRetentionBoltTransport(t, 0)
+	transport.SetEventTTL(time.Minute)
+
+	b, err := json.Marshal(&Update{Topic: "https://example.com/1", Event: Event{ID: "expired"}})
+	require.NoError(t, err)
+
+	expire := func() {
+		require.NoError(t, transport.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists([]byte(defaultBoltBucketName))
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			return transport.expireHistory(bucket)
+		}))
+	}
+
+	// Stored with a date in the past.
+	require.NoError(t, transport.db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(defaultBoltBucketName))
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		_, err = appendUpdates(bucket, []*Update{{Event: Event{ID: "expired"}}}, [][]byte{withStoredAt(b, time.Now().Add(-time.Hour))})
+
+		return err
+	}))
+
+	expire()
+
+	ids, _ := historyIDs(t, transport)
+	assert.Equal(t, []string{"expired"}, ids)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: "1"}}))
+
+	ids, _ = historyIDs(t, transport)
+	assert.Equal(t, []string{"1"}, ids)
+}
+
+func TestBoltTransportExpires(t *testing.T) {
+	t.Parallel()
+
+	transport := createRetentionBoltTransport(t, 0)
+
+	now := time.Now()
+	updates := []*Update{
+		{Topic: "https://example.com/typing", Expires: now.Add(-time.Second), Event: Event{ID: "expired"}},
+		{Topic: "https://example.com/1", Event: Event{ID: "permanent"}},
+		{Topic: "https://example.com/typing", Expires: now.Add(time.Hour), Event: Event{ID: "expiring"}},
+		{Topic: "https://example.com/typing", Expires: now.Add(-time.Second), Event: Event{ID: "last"}},
+	}
+
+	for _, u := range updates {
+		require.NoError(t, transport.Dispatch(t.Context(), u))
+	}
+
+	// The most recent update is kept, even if expired.
+	ids, _ := historyIDs(t, transport)
+	assert.Equal(t, []string{"permanent", "expiring", "last"}, ids)
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		var indexed []string
+		require.NoError(t, tx.Bucket([]byte(defaultBoltBucketName+boltExpiresBucketSuffix)).ForEach(func(k, _ []byte) error {
+			indexed = append(indexed, string(k[16:]))
+
+			return nil
+		}))
+		assert.Equal(t, []string{"last", "expiring"}, indexed)
+
+		return nil
+	}))
+
+	// The expired updates are never replayed.
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "*"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	assert.Equal(t, "permanent", (<-s.Receive()).ID)
+
+	u := <-s.Receive()
+	assert.Equal(t, "expiring", u.ID)
+	assert.True(t, updates[2].Expires.Equal(u.Expires))
+
+	select {
+	case u := <-s.Receive():
+		assert.Fail(t, "unexpected update", u.ID)
+	default:
+	}
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: "next"}}))
+
+	ids, _ = historyIDs(t, transport)
+	assert.Equal(t, []string{"permanent", "expiring", "next"}, ids)
+}
@@ -0,0 +1,117 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// boltIdempotencyKeysBucketSuffix is appended to the name of the bucket
+	// of the history to name the bucket of the idempotency keys, holding the
+	// time they expire at, in Unix nanoseconds, followed by the ID of their
+	// update.
+	boltIdempotencyKeysBucketSuffix = "_idempotency_keys"
+	// boltIdempotencyExpiryBucketSuffix is appended to the name of the bucket
+	// of the history to name the bucket indexing the idempotency keys by the
+	// time they expire at, to remove the expired ones.
+	boltIdempotencyExpiryBucketSuffix = "_idempotency_expiry"
+)
+
+// RememberIdempotencyKey records the idempotency key in the database, so the
+// publications are deduplicated across restarts. The expired keys are removed
+// meanwhile.
+func (t *BoltTransport) RememberIdempotencyKey(_ context.Context, key, id string, ttl time.Duration) (string, bool, error) {
+	found := false
+
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		keys, err := tx.CreateBucketIfNotExists([]byte(t.bucketName + boltIdempotencyKeysBucketSuffix))
+		if err != nil {
+			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+		}
+
+		expiry, err := tx.CreateBucketIfNotExists([]byte(t.bucketName + boltIdempotencyExpiryBucketSuffix))
+		if err != nil {
+			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+		}
+
+		now := time.Now()
+		if err := removeExpiredIdempotencyKeys(keys, expiry, now); err != nil {
+			return err
+		}
+
+		if v := keys.Get([]byte(key)); len(v) >= 8 {
+			found, id = true, string(v[8:])
+
+			return nil
+		}
+
+		expiresAt := binary.BigEndian.AppendUint64(make([]byte, 0, 8+max(len(id), len(key))), uint64(now.Add(ttl).UnixNano())) //nolint:gosec
+
+		if err := keys.Put([]byte(key), append(expiresAt, id...)); err != nil {
+			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+		}
+
+		if err := expiry.Put(append(expiresAt[:8:8], key...), []byte{}); err != nil {
+			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+		}
+
+		return nil
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return "", false, ErrClosedTransport
+	}
+
+	if err != nil {
+		return "", false, err //nolint:wrapcheck
+	}
+
+	return id, found, nil
+}
+
+// ForgetIdempotencyKey removes the idempotency key from the database.
+func (t *BoltTransport) ForgetIdempotencyKey(_ context.Context, key string) error {
+	err := t.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket([]byte(t.bucketName + boltIdempotencyKeysBucketSuffix))
+		if keys == nil {
+			return nil
+		}
+
+		// The entry of the expiry index is removed with the expired keys.
+		if err := keys.Delete([]byte(key)); err != nil {
+			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+		}
+
+		return nil
+	})
+	if errors.Is(err, bolt.ErrDatabaseNotOpen) {
+		return ErrClosedTransport
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// removeExpiredIdempotencyKeys removes the keys expired at now, in the order
+// of the expiry index.
+func removeExpiredIdempotencyKeys(keys, expiry *bolt.Bucket, now time.Time) error {
+	c := expiry.Cursor()
+	for k, _ := c.First(); k != nil && int64(binary.BigEndian.Uint64(k[:8])) <= now.UnixNano(); k, _ = c.First() { //nolint:gosec
+		// The key may have been forgotten, and recorded again since.
+		if v := keys.Get(k[8:]); len(v) >= 8 && bytes.Equal(v[:8], k[:8]) {
+			if err := keys.Delete(k[8:]); err != nil {
+				return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+			}
+		}
+
+		if err := expiry.Delete(k); err != nil {
+			return fmt.Errorf("unable to delete value in Bolt DB: %w", err)
+		}
+	}
+
+	return nil
+}
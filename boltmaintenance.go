@@ -0,0 +1,377 @@
+package mercure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrBoltDatabaseInUse is returned by OpenBoltHistory and CompactBoltDatabase
+// when another process, such as a running hub, holds the database.
+var ErrBoltDatabaseInUse = errors.New("the Bolt database is in use, stop the hub first")
+
+// boltCompactTxMaxSize is the size of the transactions copying the database
+// when compacting it.
+const boltCompactTxMaxSize = 64 << 20
+
+// BoltHistory gives offline access to the history stored by a BoltTransport,
+// for maintenance. The database must not be in use by a hub.
+type BoltHistory struct {
+	db         *bolt.DB
+	bucketName string
+}
+
+// BoltHistoryReport describes the content of a Bolt database.
+type BoltHistoryReport struct {
+	// Size is the size of the database file, in bytes.
+	Size int64 `json:"size"`
+	// Buckets holds the number of keys of every bucket of the database.
+	Buckets map[string]int `json:"buckets"`
+	// Updates is the number of updates in the history, retracted ones
+	// excluded.
+	Updates int `json:"updates"`
+	// Retracted is the number of tombstones of retracted or purged updates.
+	Retracted int `json:"retracted"`
+	// FirstEventID and LastEventID are the IDs of the oldest and the most
+	// recent entries of the history.
+	FirstEventID string `json:"first_event_id,omitempty"`
+	LastEventID  string `json:"last_event_id,omitempty"`
+	// Topics holds the number of updates per topic.
+	Topics map[string]int `json:"topics"`
+}
+
+// BoltPurgeFilter selects the updates to purge. An update is selected when it
+// matches all the non-zero criteria.
+type BoltPurgeFilter struct {
+	// Topic selects the updates having this topic.
+	Topic string
+	// Before selects the updates published before this date. Only the
+	// updates with a hub-generated ID can be dated: the others never match.
+	Before time.Time
+}
+
+// OpenBoltHistory opens the Bolt database at path, holding the history in
+// bucketName (the default bucket when empty).
+func OpenBoltHistory(path, bucketName string, readOnly bool) (*BoltHistory, error) {
+	if bucketName == "" {
+		bucketName = defaultBoltBucketName
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("unable to open Bolt database: %w", err)
+	}
+
+	db, err := openBoltDatabase(path, readOnly)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BoltHistory{db: db, bucketName: bucketName}, nil
+}
+
+func openBoltDatabase(path string, readOnly bool) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: 1 * time.Second, ReadOnly: readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%q: %w", path, ErrBoltDatabaseInUse)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open Bolt database: %w", err)
+	}
+
+	return db, nil
+}
+
+// Close closes the database.
+func (b *BoltHistory) Close() error {
+	if err := b.db.Close(); err != nil {
+		return fmt.Errorf("unable to close Bolt database: %w", err)
+	}
+
+	return nil
+}
+
+// Inspect reports the content of the database.
+func (b *BoltHistory) Inspect() (*BoltHistoryReport, error) {
+	r := &BoltHistoryReport{Buckets: make(map[string]int), Topics: make(map[string]int)}
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		r.Size = tx.Size()
+
+		if err := tx.ForEach(func(name []byte, bucket *bolt.Bucket) error {
+			r.Buckets[string(name)] = bucket.Stats().KeyN
+
+			return nil
+		}); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		return b.forEach(tx, func(k, v []byte) error {
+			if r.FirstEventID == "" {
+				r.FirstEventID = string(k[8:])
+			}
+
+			r.LastEventID = string(k[8:])
+
+			if isRetracted(v) {
+				r.Retracted++
+
+				return nil
+			}
+
+			var u Update
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("%q: unable to unmarshal update: %w", k[8:], err)
+			}
+
+			r.Updates++
+
+			for _, t := range u.topics() {
+				r.Topics[t]++
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("bolt error: %w", err)
+	}
+
+	return r, nil
+}
+
+// Purge removes the updates selected by the filter from the history and
+// returns their count. Like retracted updates, purged ones are replaced with
+// tombstones, so subscribers reconnecting with their ID resume from the right
+// position; those older than any kept update are deleted.
+func (b *BoltHistory) Purge(f BoltPurgeFilter) (int, error) {
+	if f.Topic == "" && f.Before.IsZero() {
+		return 0, fmt.Errorf("%w: no purge criterion", ErrHistoryPurge)
+	}
+
+	var n int
+
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		var deleted, tombstoned [][]byte
+
+		head := true
+
+		if err := b.forEach(tx, func(k, v []byte) error {
+			if isRetracted(v) {
+				return nil
+			}
+
+			var u Update
+			if err := json.Unmarshal(v, &u); err != nil {
+				return fmt.Errorf("%q: unable to unmarshal update: %w", k[8:], err)
+			}
+
+			if !f.match(&u) {
+				head = false
+
+				return nil
+			}
+
+			// Keys are only valid during the transaction, and must not be
+			// modified while iterating.
+			if head {
+				deleted = append(deleted, bytes.Clone(k))
+			} else {
+				tombstoned = append(tombstoned, bytes.Clone(k))
+			}
+
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		bucket := tx.Bucket([]byte(b.bucketName))
+
+		for _, k := range deleted {
+			if err := bucket.Delete(k); err != nil {
+				return fmt.Errorf("%w: unable to delete value in Bolt DB: %w", ErrHistoryPurge, err)
+			}
+		}
+
+		for _, k := range tombstoned {
+			if err := bucket.Put(k, []byte{}); err != nil {
+				return fmt.Errorf("%w: unable to put value in Bolt DB: %w", ErrHistoryPurge, err)
+			}
+		}
+
+		n = len(deleted) + len(tombstoned)
+
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("bolt error: %w", err)
+	}
+
+	return n, nil
+}
+
+func (f *BoltPurgeFilter) match(u *Update) bool {
+	if f.Topic != "" && !slices.Contains(u.topics(), f.Topic) {
+		return false
+	}
+
+	if f.Before.IsZero() {
+		return true
+	}
+
+	published, ok := updateTime(u.ID)
+
+	return ok && published.Before(f.Before)
+}
+
+// updateTime returns the publication date of an update with a hub-generated
+// ID (see Update.AssignUUID).
+func updateTime(id string) (time.Time, bool) {
+	s, ok := strings.CutPrefix(id, "urn:uuid:")
+	if !ok {
+		return time.Time{}, false
+	}
+
+	u, err := uuid.FromString(s)
+	if err != nil || u.Version() != uuid.V7 {
+		return time.Time{}, false
+	}
+
+	ts, err := uuid.TimestampFromV7(u)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	t, err := ts.Time()
+
+	return t, err == nil
+}
+
+// Export writes the updates of the history, in order, to w as newline
+// delimited JSON documents, and returns their count. When topic isn't empty,
+// only the updates having this topic are exported. Retracted updates are
+// omitted.
+func (b *BoltHistory) Export(w io.Writer, topic string) (int, error) {
+	var n int
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		return b.forEach(tx, func(k, v []byte) error {
+			if isRetracted(v) {
+				return nil
+			}
+
+			if topic != "" {
+				var u Update
+				if err := json.Unmarshal(v, &u); err != nil {
+					return fmt.Errorf("%q: unable to unmarshal update: %w", k[8:], err)
+				}
+
+				if !slices.Contains(u.topics(), topic) {
+					return nil
+				}
+			}
+
+			if _, err := w.Write(append(bytes.Clone(v), '\n')); err != nil {
+				return fmt.Errorf("unable to write update: %w", err)
+			}
+
+			n++
+
+			return nil
+		})
+	})
+	if err != nil {
+		return n, fmt.Errorf("bolt error: %w", err)
+	}
+
+	return n, nil
+}
+
+// forEach calls fn for every entry of the history, in order.
+func (b *BoltHistory) forEach(tx *bolt.Tx, fn func(k, v []byte) error) error {
+	bucket := tx.Bucket([]byte(b.bucketName))
+	if bucket == nil {
+		return nil // No data
+	}
+
+	return bucket.ForEach(func(k, v []byte) error { //nolint:wrapcheck
+		if len(k) < 8 {
+			return fmt.Errorf("%q: invalid history key", k)
+		}
+
+		return fn(k, v)
+	})
+}
+
+// CompactBoltDatabase rewrites the Bolt database at path to reclaim the space
+// freed by purged and cleaned up updates, and returns its size before and
+// after compaction. The database must not be in use by a hub.
+func CompactBoltDatabase(path string) (before, after int64, err error) {
+	src, err := openBoltDatabase(path, true)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	defer func() {
+		if src != nil {
+			_ = src.Close()
+		}
+	}()
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".compact-*")
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to create the compacted database: %w", err)
+	}
+
+	tmpPath := tmp.Name()
+	_ = tmp.Close()
+
+	defer os.Remove(tmpPath) //nolint:errcheck
+
+	dst, err := bolt.Open(tmpPath, 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to open the compacted database: %w", err)
+	}
+
+	if err := bolt.Compact(dst, src, boltCompactTxMaxSize); err != nil {
+		_ = dst.Close()
+
+		return 0, 0, fmt.Errorf("unable to compact Bolt database: %w", err)
+	}
+
+	if err := dst.Close(); err != nil {
+		return 0, 0, fmt.Errorf("unable to close the compacted database: %w", err)
+	}
+
+	if err := src.Close(); err != nil {
+		return 0, 0, fmt.Errorf("unable to close Bolt database: %w", err)
+	}
+
+	src = nil
+
+	srcInfo, err := os.Stat(path)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to stat Bolt database: %w", err)
+	}
+
+	dstInfo, err := os.Stat(tmpPath)
+	if err != nil {
+		return 0, 0, fmt.Errorf("unable to stat the compacted database: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return 0, 0, fmt.Errorf("unable to replace Bolt database: %w", err)
+	}
+
+	return srcInfo.Size(), dstInfo.Size(), nil
+}
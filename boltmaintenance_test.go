@@ -0,0 +1,134 @@
+package mercure
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createBoltHistoryFixture(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "mercure.db")
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.NoError(t, err)
+
+	for _, u := range []*Update{
+		{Topic: "https://example.com/books/1", Event: Event{ID: "old"}},
+		{Topic: "https://example.com/books/1"},
+		{Topic: "https://example.com/books/2"},
+		{Topic: "https://example.com/books/2"},
+	} {
+		require.NoError(t, transport.Dispatch(t.Context(), u))
+	}
+
+	r, err := transport.RetractableUpdate(t.Context(), "old")
+	require.NoError(t, err)
+	require.NoError(t, transport.Retract(t.Context(), r.ID, &Update{Topic: r.Topic, Event: Event{Type: reservedEventType}}))
+
+	_, err = OpenBoltHistory(path, "", true)
+	require.ErrorIs(t, err, ErrBoltDatabaseInUse)
+
+	require.NoError(t, transport.Close(t.Context()))
+
+	return path
+}
+
+func TestBoltHistoryInspect(t *testing.T) {
+	t.Parallel()
+
+	h, err := OpenBoltHistory(createBoltHistoryFixture(t), "", true)
+	require.NoError(t, err)
+
+	defer h.Close()
+
+	r, err := h.Inspect()
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int{defaultBoltBucketName: 5, boltSchemaBucketName: 1}, r.Buckets)
+	assert.Equal(t, 4, r.Updates)
+	assert.Equal(t, 1, r.Retracted)
+	assert.Equal(t, "old", r.FirstEventID)
+	assert.Equal(t, map[string]int{"https://example.com/books/1": 2, "https://example.com/books/2": 2}, r.Topics)
+	assert.Positive(t, r.Size)
+}
+
+func TestBoltHistoryExport(t *testing.T) {
+	t.Parallel()
+
+	h, err := OpenBoltHistory(createBoltHistoryFixture(t), "", true)
+	require.NoError(t, err)
+
+	defer h.Close()
+
+	var buf bytes.Buffer
+
+	n, err := h.Export(&buf, "https://example.com/books/2")
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		var u Update
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &u))
+		assert.Equal(t, "https://example.com/books/2", u.Topic)
+	}
+
+	n, err = h.Export(&bytes.Buffer{}, "")
+	require.NoError(t, err)
+	assert.Equal(t, 4, n)
+}
+
+func TestBoltHistoryPurge(t *testing.T) {
+	t.Parallel()
+
+	path := createBoltHistoryFixture(t)
+
+	h, err := OpenBoltHistory(path, "", false)
+	require.NoError(t, err)
+
+	_, err = h.Purge(BoltPurgeFilter{})
+	require.ErrorIs(t, err, ErrHistoryPurge)
+
+	n, err := h.Purge(BoltPurgeFilter{Topic: "https://example.com/books/1"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	r, err := h.Inspect()
+	require.NoError(t, err)
+
+	// The oldest update is older than any kept one, so it is deleted; the
+	// retraction update is replaced with a tombstone.
+	assert.Equal(t, map[string]int{defaultBoltBucketName: 4, boltSchemaBucketName: 1}, r.Buckets)
+	assert.Equal(t, 2, r.Updates)
+	assert.Equal(t, 2, r.Retracted)
+	assert.Equal(t, map[string]int{"https://example.com/books/2": 2}, r.Topics)
+
+	n, err = h.Purge(BoltPurgeFilter{Before: time.Now().Add(time.Minute)})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	require.NoError(t, h.Close())
+
+	before, after, err := CompactBoltDatabase(path)
+	require.NoError(t, err)
+	assert.Positive(t, before)
+	assert.Positive(t, after)
+
+	h, err = OpenBoltHistory(path, "", true)
+	require.NoError(t, err)
+
+	defer h.Close()
+
+	r, err = h.Inspect()
+	require.NoError(t, err)
+	assert.Zero(t, r.Updates)
+}
@@ -0,0 +1,281 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrBoltDatabaseCorrupted is returned by CheckBoltDatabase when the database
+// is damaged.
+var ErrBoltDatabaseCorrupted = errors.New("the Bolt database is corrupted")
+
+// boltCheckMaxErrors caps the number of integrity errors reported.
+const boltCheckMaxErrors = 10
+
+// boltSalvageBatchSize is the number of entries copied per transaction when
+// salvaging a database.
+const boltSalvageBatchSize = 1000
+
+// BoltRecoveryReport describes the recovery of a corrupted Bolt database.
+type BoltRecoveryReport struct {
+	// Salvaged is the number of entries copied to the new database.
+	Salvaged int
+	// Backup is the path the corrupted database has been moved to.
+	Backup string
+}
+
+// CheckBoltDatabase verifies the integrity of the Bolt database at path, and
+// returns ErrBoltDatabaseCorrupted, joined with the problems found, if it is
+// damaged. A missing database is valid: it will be created. The database must
+// not be in use.
+func CheckBoltDatabase(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	var db *bolt.DB
+
+	// Opening the database for writing loads the freelist here, instead of
+	// in the goroutine of Tx.Check, where reading a damaged page would crash
+	// the process.
+	if err := readDamaged(func() (err error) {
+		db, err = openBoltDatabase(path, false)
+
+		return err
+	}); err != nil {
+		if errors.Is(err, ErrBoltDatabaseInUse) || errors.Is(err, ErrBoltDatabaseCorrupted) {
+			return err
+		}
+
+		return fmt.Errorf("%w: %w", ErrBoltDatabaseCorrupted, err)
+	}
+
+	defer db.Close()
+
+	// Read every entry first, for the same reason.
+	if err := readDamaged(func() error {
+		return db.View(func(tx *bolt.Tx) error {
+			return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+				return b.ForEach(func(_, _ []byte) error { return nil })
+			})
+		})
+	}); err != nil {
+		return err
+	}
+
+	errs := []error{ErrBoltDatabaseCorrupted}
+
+	_ = db.View(func(tx *bolt.Tx) error {
+		for err := range tx.Check() {
+			if len(errs) <= boltCheckMaxErrors {
+				errs = append(errs, err)
+			}
+		}
+
+		return nil
+	})
+
+	if len(errs) > 1 {
+		return errors.Join(errs...)
+	}
+
+	return nil
+}
+
+// VerifyBoltDatabase checks the integrity of the Bolt database at path, and
+// recovers it with RecoverBoltDatabase if it is corrupted and recoverCorrupted
+// is true. The database must not be in use.
+func VerifyBoltDatabase(path string, recoverCorrupted bool, logger *slog.Logger) error {
+	err := CheckBoltDatabase(path)
+	if err == nil || !recoverCorrupted || !errors.Is(err, ErrBoltDatabaseCorrupted) {
+		return err
+	}
+
+	ctx := context.Background()
+	if logger.Enabled(ctx, slog.LevelError) {
+		logger.LogAttrs(ctx, slog.LevelError, "Bolt database corrupted, recovering it", slog.String("path", path), slog.Any("error", err))
+	}
+
+	r, err := RecoverBoltDatabase(path)
+	if err != nil {
+		return err
+	}
+
+	if logger.Enabled(ctx, slog.LevelWarn) {
+		logger.LogAttrs(ctx, slog.LevelWarn, "Bolt database recovered", slog.String("path", path), slog.Int("salvaged", r.Salvaged), slog.String("backup", r.Backup))
+	}
+
+	return nil
+}
+
+// RecoverBoltDatabase copies the readable entries of the corrupted Bolt
+// database at path to a new database, which replaces it. The corrupted
+// database is kept next to it, with a ".corrupted-<date>" suffix. The
+// database must not be in use.
+//
+// The entries of every bucket are read forward, then backward, until an
+// unreadable page is reached, so the entries stored in and between damaged
+// pages are lost. Subscribers reconnecting with the ID of a lost update
+// receive the whole history.
+func RecoverBoltDatabase(path string) (*BoltRecoveryReport, error) {
+	tmpPath := path + ".recover"
+	_ = os.Remove(tmpPath)
+
+	dst, err := bolt.Open(tmpPath, 0o600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the recovered database: %w", err)
+	}
+
+	defer os.Remove(tmpPath) //nolint:errcheck
+
+	r := &BoltRecoveryReport{}
+
+	// A database whose meta pages are unreadable can't be opened at all:
+	// nothing is salvaged, a fresh database replaces it.
+	if src, err := openBoltDatabase(path, true); err == nil {
+		r.Salvaged, err = salvageBoltDatabase(src, dst)
+
+		_ = src.Close()
+
+		if err != nil {
+			_ = dst.Close()
+
+			return nil, err
+		}
+	} else if errors.Is(err, ErrBoltDatabaseInUse) {
+		_ = dst.Close()
+
+		return nil, err
+	}
+
+	if err := dst.Close(); err != nil {
+		return nil, fmt.Errorf("unable to close the recovered database: %w", err)
+	}
+
+	r.Backup = path + ".corrupted-" + time.Now().UTC().Format("20060102T150405Z")
+	if err := os.Rename(path, r.Backup); err != nil {
+		return nil, fmt.Errorf("unable to back up the corrupted database: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return nil, fmt.Errorf("unable to replace the corrupted database: %w", err)
+	}
+
+	return r, nil
+}
+
+// salvageBoltDatabase copies the readable entries of the top-level buckets of
+// src to dst.
+func salvageBoltDatabase(src, dst *bolt.DB) (int, error) {
+	var buckets [][]byte
+
+	_ = readDamaged(func() error {
+		return src.View(func(tx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+				buckets = append(buckets, append([]byte(nil), name...))
+
+				return nil
+			})
+		})
+	})
+
+	var salvaged int
+
+	for _, name := range buckets {
+		var entries [][2][]byte
+
+		collect := func(k, v []byte) {
+			// Nested buckets are not used by the transport, and damaged
+			// pages may hold keys Bolt refuses.
+			if v != nil && len(k) > 0 && len(k) <= bolt.MaxKeySize && len(v) <= bolt.MaxValueSize {
+				entries = append(entries, [2][]byte{append([]byte(nil), k...), append([]byte(nil), v...)})
+			}
+		}
+
+		// Forward until the first unreadable page, then backward until the
+		// last one.
+		_ = readDamaged(func() error {
+			return src.View(func(tx *bolt.Tx) error {
+				c := tx.Bucket(name).Cursor()
+				for k, v := c.First(); k != nil; k, v = c.Next() {
+					collect(k, v)
+				}
+
+				return nil
+			})
+		})
+		_ = readDamaged(func() error {
+			return src.View(func(tx *bolt.Tx) error {
+				c := tx.Bucket(name).Cursor()
+				for k, v := c.Last(); k != nil; k, v = c.Prev() {
+					collect(k, v)
+				}
+
+				return nil
+			})
+		})
+
+		n, err := writeSalvaged(dst, name, entries)
+		if err != nil {
+			return salvaged, err
+		}
+
+		salvaged += n
+	}
+
+	return salvaged, nil
+}
+
+// writeSalvaged writes the entries to the bucket of dst, and returns the
+// number of distinct keys written.
+func writeSalvaged(dst *bolt.DB, name []byte, entries [][2][]byte) (int, error) {
+	seen := make(map[string]struct{}, len(entries))
+
+	// Loop at least once, to create the bucket even if nothing is salvaged.
+	for start := 0; ; start += boltSalvageBatchSize {
+		end := min(start+boltSalvageBatchSize, len(entries))
+
+		if err := dst.Update(func(tx *bolt.Tx) error {
+			b, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			for _, e := range entries[start:end] {
+				seen[string(e[0])] = struct{}{}
+
+				if err := b.Put(e[0], e[1]); err != nil {
+					return err //nolint:wrapcheck
+				}
+			}
+
+			return nil
+		}); err != nil {
+			return 0, fmt.Errorf("unable to write the recovered database: %w", err)
+		}
+
+		if end == len(entries) {
+			break
+		}
+	}
+
+	return len(seen), nil
+}
+
+// readDamaged runs fn, turning the panics caused by damaged pages into
+// errors.
+func readDamaged(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%w: %v", ErrBoltDatabaseCorrupted, r)
+		}
+	}()
+
+	return fn()
+}
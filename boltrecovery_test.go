@@ -0,0 +1,90 @@
+package mercure
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// createDamagedBoltDatabase creates a database holding n updates, then
+// overwrites the given pages with garbage.
+func createDamagedBoltDatabase(t *testing.T, n int, pages ...int64) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "mercure.db")
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.NoError(t, err)
+
+	for range n {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{Data: strings.Repeat("x", 200)}}))
+	}
+
+	require.NoError(t, transport.Close(t.Context()))
+	require.NoError(t, CheckBoltDatabase(path))
+
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	require.NoError(t, err)
+
+	pageSize := int64(os.Getpagesize())
+	for _, p := range pages {
+		_, err = f.WriteAt([]byte(strings.Repeat("\xff", 64)), p*pageSize)
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, f.Close())
+
+	return path
+}
+
+func TestCheckBoltDatabaseMissing(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, CheckBoltDatabase(filepath.Join(t.TempDir(), "missing.db")))
+}
+
+func TestRecoverBoltDatabase(t *testing.T) {
+	t.Parallel()
+
+	path := createDamagedBoltDatabase(t, 2000, 40)
+	require.ErrorIs(t, CheckBoltDatabase(path), ErrBoltDatabaseCorrupted)
+
+	r, err := RecoverBoltDatabase(path)
+	require.NoError(t, err)
+	assert.Less(t, r.Salvaged, 2000)
+	assert.Greater(t, r.Salvaged, 1900)
+	assert.FileExists(t, r.Backup)
+	require.NoError(t, CheckBoltDatabase(path))
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.NoError(t, err)
+
+	defer transport.Close(t.Context())
+
+	var n int
+
+	require.NoError(t, transport.ReadHistory(t.Context(), func(*Update) error {
+		n++
+
+		return nil
+	}))
+	assert.Equal(t, r.Salvaged-1, n) // the schema version is salvaged too
+}
+
+func TestRecoverBoltDatabaseUnreadable(t *testing.T) {
+	t.Parallel()
+
+	// Both meta pages are damaged, the database can't be opened.
+	path := createDamagedBoltDatabase(t, 10, 0, 1)
+	require.ErrorIs(t, CheckBoltDatabase(path), ErrBoltDatabaseCorrupted)
+
+	r, err := RecoverBoltDatabase(path)
+	require.NoError(t, err)
+	assert.Zero(t, r.Salvaged)
+	require.NoError(t, CheckBoltDatabase(path))
+}
@@ -0,0 +1,287 @@
+package mercure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrInvalidBoltRetentionPolicy is returned by SetRetentionPolicies for a
+// policy without matchers, with an invalid matcher or without limits.
+var ErrInvalidBoltRetentionPolicy = errors.New("invalid Bolt retention policy")
+
+// BoltRetentionPolicy limits the history kept for the updates having topics
+// selected by its matchers.
+type BoltRetentionPolicy struct {
+	// Matchers select the topics the policy applies to.
+	Matchers []TopicMatcher
+	// Size is the number of most recent updates governed by the policy kept
+	// in the history, unlimited when 0.
+	Size uint64
+	// TTL is how long the updates governed by the policy are kept in the
+	// history, unlimited when 0. Only the updates stored with an event TTL
+	// (see SetEventTTL) or having a hub-generated ID can be dated: the others
+	// never expire.
+	TTL time.Duration
+}
+
+// SetRetentionPolicies configures the retention of the history per topic,
+// instead of the single size of the transport: for instance 10000 updates for
+// the metrics, and only 100 for the chat messages.
+//
+// An update is governed by the most specific policy having a matcher
+// selecting one of its topics: exact matchers are more specific than URL
+// patterns, and URL patterns having a longer literal prefix more specific
+// than the others. Policies of the same specificity apply in order. The size
+// of the transport applies to the updates not governed by any policy.
+//
+// Like the size, the policies are applied when the history is cleaned up,
+// with the cleanup frequency. The updates removed from the middle of the
+// history are replaced with tombstones, so subscribers reconnecting with
+// their ID resume from the right position.
+//
+// SetRetentionPolicies must be called before dispatching updates.
+func (t *BoltTransport) SetRetentionPolicies(policies []BoltRetentionPolicy) error {
+	t.Lock()
+	defer t.Unlock()
+
+	for i, p := range policies {
+		if len(p.Matchers) == 0 {
+			return fmt.Errorf("%w: policy %d has no matchers", ErrInvalidBoltRetentionPolicy, i)
+		}
+
+		if p.Size == 0 && p.TTL <= 0 {
+			return fmt.Errorf("%w: policy %d has neither size nor TTL", ErrInvalidBoltRetentionPolicy, i)
+		}
+
+		for _, m := range p.Matchers {
+			if err := t.topicMatcherStore.validatePattern(m); err != nil {
+				return fmt.Errorf("%w: policy %d: %q: %w", ErrInvalidBoltRetentionPolicy, i, m.Pattern, err)
+			}
+		}
+	}
+
+	t.retention = policies
+
+	return nil
+}
+
+// SetTopicMatcherStore sets the store matching the topics of the updates
+// against the retention policies, resolving the relative patterns against the
+// URL of the hub.
+func (t *BoltTransport) SetTopicMatcherStore(store *TopicMatcherStore) {
+	if store == nil {
+		return
+	}
+
+	t.Lock()
+	t.topicMatcherStore = store
+	t.Unlock()
+}
+
+// retentionPolicy returns the index of the most specific policy governing
+// the update having the given topics, or -1 when none does.
+func (t *BoltTransport) retentionPolicy(topics []string) int {
+	policy, best := -1, -1
+
+	for i, p := range t.retention {
+		for _, m := range p.Matchers {
+			if s := matcherSpecificity(m); s > best && t.topicMatcherStore.matches(topics, m) {
+				policy, best = i, s
+			}
+		}
+	}
+
+	return policy
+}
+
+// matcherSpecificity ranks the matchers, the exact ones first, then the URL
+// patterns and the regular expressions by the length of their literal prefix.
+func matcherSpecificity(m TopicMatcher) int {
+	if m.Pattern == "*" {
+		return 0
+	}
+
+	if m.Type == MatcherTypeRegexp {
+		return len(regexpLiteralPrefix(m.Pattern)) + 1
+	}
+
+	if m.Type != MatcherTypeURLPattern {
+		return math.MaxInt
+	}
+
+	// The colon of the scheme is not a named group.
+	p, start := m.Pattern, 0
+	if i := strings.Index(p, "://"); i >= 0 && !strings.ContainsAny(p[:i], `*({\`) {
+		start = i + 3
+	}
+
+	if i := strings.IndexAny(p[start:], `:*({\`); i >= 0 {
+		return start + i + 1
+	}
+
+	return len(p) + 1
+}
+
+// applyRetention removes the updates exceeding the size or the TTL of the
+// policy governing them, the size of the transport applying to the others.
+func (t *BoltTransport) applyRetention(bucket *bolt.Bucket) error {
+	var (
+		kept     = make([]uint64, len(t.retention)+1)
+		policies = make(map[string]int)
+		expired  = make(map[string]struct{})
+		now      = time.Now()
+		newest   = true
+	)
+
+	c := bucket.Cursor()
+	for k, v := c.Last(); k != nil; k, v = c.Prev() {
+		if isRetracted(v) {
+			continue
+		}
+
+		var e compactionEntry
+		if err := json.Unmarshal(v, &e); err != nil {
+			return fmt.Errorf("%w: %q: unable to unmarshal update: %w", ErrHistoryPurge, k[8:], err)
+		}
+
+		if t.exempted(e.Topics) {
+			newest = false
+
+			continue
+		}
+
+		topicsKey := strings.Join(e.Topics, topicsKeySeparator)
+
+		i, ok := policies[topicsKey]
+		if !ok {
+			i = t.retentionPolicy(e.Topics)
+			policies[topicsKey] = i
+		}
+
+		size, ttl := t.size, time.Duration(0)
+		if i >= 0 {
+			size, ttl = t.retention[i].Size, t.retention[i].TTL
+		}
+
+		kept[i+1]++
+
+		// The most recent update is kept, for the last event ID to survive
+		// restarts.
+		if newest {
+			newest = false
+
+			continue
+		}
+
+		if size != 0 && kept[i+1] > size {
+			expired[string(k)] = struct{}{}
+
+			continue
+		}
+
+		if ttl > 0 {
+			if published, ok := entryTime(k, v); ok && now.Sub(published) > ttl {
+				expired[string(k)] = struct{}{}
+			}
+		}
+	}
+
+	if len(expired) == 0 {
+		return nil
+	}
+
+	// The head of the history, expired updates and tombstones, is deleted;
+	// the expired updates following a kept one are tombstoned.
+	var deleted, tombstoned [][]byte
+
+	head := true
+
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		_, ok := expired[string(k)]
+
+		switch {
+		case head && (ok || isRetracted(v)):
+			deleted = append(deleted, bytes.Clone(k))
+		case ok:
+			tombstoned = append(tombstoned, bytes.Clone(k))
+		default:
+			head = false
+		}
+	}
+
+	// Deleting while iterating would move the cursor.
+	for _, k := range deleted {
+		if err := bucket.Delete(k); err != nil {
+			return fmt.Errorf("%w: unable to delete value in Bolt DB: %w", ErrHistoryPurge, err)
+		}
+	}
+
+	for _, k := range tombstoned {
+		if err := bucket.Put(k, []byte{}); err != nil {
+			return fmt.Errorf("%w: unable to put value in Bolt DB: %w", ErrHistoryPurge, err)
+		}
+	}
+
+	return nil
+}
+
+// SetRetentionExemptions configures the topics whose updates are never
+// removed from the history by the cleanups, and the ones whose updates are
+// never stored.
+//
+// SetRetentionExemptions must be called before dispatching updates.
+func (t *BoltTransport) SetRetentionExemptions(e RetentionExemptions) error {
+	t.Lock()
+	t.exemptions = e
+	t.Unlock()
+
+	return nil
+}
+
+// persisted returns the updates, and their JSON representations, the
+// retention exemptions allow storing.
+func (t *BoltTransport) persisted(updates []*Update, updateJSONs [][]byte) ([]*Update, [][]byte) {
+	if len(t.exemptions.Forbidden) == 0 {
+		return updates, updateJSONs
+	}
+
+	var (
+		stored      = make([]*Update, 0, len(updates))
+		storedJSONs = make([][]byte, 0, len(updates))
+	)
+
+	for i, u := range updates {
+		if !t.topicMatcherStore.matchesAny(u.topics(), t.exemptions.Forbidden) {
+			stored = append(stored, u)
+			storedJSONs = append(storedJSONs, updateJSONs[i])
+		}
+	}
+
+	return stored, storedJSONs
+}
+
+// exempted reports whether the updates having the given topics are exempt
+// from the cleanups.
+func (t *BoltTransport) exempted(topics []string) bool {
+	return len(t.exemptions.Exempt) != 0 && t.topicMatcherStore.matchesAny(topics, t.exemptions.Exempt)
+}
+
+// exemptEntry reports whether the update of the history entry is exempt from
+// the cleanups. The tombstones never are.
+func (t *BoltTransport) exemptEntry(v []byte) bool {
+	if len(t.exemptions.Exempt) == 0 || isRetracted(v) {
+		return false
+	}
+
+	var e compactionEntry
+
+	// An entry that can't be read is exempt, not to lose it.
+	return json.Unmarshal(v, &e) != nil || t.exempted(e.Topics)
+}
@@ -0,0 +1,204 @@
+package mercure
+
+import (
+	"log/slog"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func createRetentionBoltTransport(t *testing.T, size uint64, policies ...BoltRetentionPolicy) *BoltTransport {
+	t.Helper()
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), defaultBoltBucketName, size, 1)
+	require.NoError(t, err)
+	t.Cleanup(func() { require.NoError(t, transport.Close(t.Context())) })
+
+	require.NoError(t, transport.SetRetentionPolicies(policies))
+
+	return transport
+}
+
+// historyIDs returns the IDs of the updates of the history, and the number of
+// tombstones.
+func historyIDs(t *testing.T, transport *BoltTransport) (ids []string, tombstones int) {
+	t.Helper()
+
+	require.NoError(t, transport.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(defaultBoltBucketName)).ForEach(func(k, v []byte) error {
+			if isRetracted(v) {
+				tombstones++
+			} else {
+				ids = append(ids, string(k[8:]))
+			}
+
+			return nil
+		})
+	}))
+
+	return ids, tombstones
+}
+
+func TestBoltTransportRetentionSize(t *testing.T) {
+	t.Parallel()
+
+	transport := createRetentionBoltTransport(t, 2,
+		BoltRetentionPolicy{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/*"}}, Size: 3},
+		BoltRetentionPolicy{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/chat/*"}}, Size: 1},
+	)
+
+	for i, topic := range []string{
+		"https://example.com/chat/1",    // c1
+		"https://example.com/metrics/1", // m2
+		"https://other.example.com/1",   // o3
+		"https://example.com/chat/1",    // c4
+		"https://example.com/metrics/1", // m5
+		"https://other.example.com/1",   // o6
+		"https://example.com/metrics/1", // m7
+		"https://other.example.com/1",   // o8
+		"https://example.com/metrics/1", // m9
+	} {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: topic, Event: Event{ID: strconv.Itoa(i + 1)}}))
+	}
+
+	ids, tombstones := historyIDs(t, transport)
+
+	// The most specific policy applies to the chat, the transport size to
+	// the other host.
+	assert.Equal(t, []string{"4", "5", "6", "7", "8", "9"}, ids)
+	assert.Equal(t, 0, tombstones)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/chat/1", Event: Event{ID: "10"}}))
+
+	ids, tombstones = historyIDs(t, transport)
+	assert.Equal(t, []string{"5", "6", "7", "8", "9", "10"}, ids)
+	assert.Equal(t, 0, tombstones)
+
+	for _, id := range []string{"11", "12"} {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/metrics/1", Event: Event{ID: id}}))
+	}
+
+	// 7 follows a kept update.
+	ids, tombstones = historyIDs(t, transport)
+	assert.Equal(t, []string{"6", "8", "9", "10", "11", "12"}, ids)
+	assert.Equal(t, 1, tombstones)
+
+	s := NewLocalSubscriber("7", transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "*"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	for _, expected := range []string{"8", "9", "10", "11", "12"} {
+		assert.Equal(t, expected, (<-s.Receive()).ID)
+	}
+}
+
+func TestBoltTransportRetentionTTL(t *testing.T) {
+	t.Parallel()
+
+	transport := createRetentionBoltTransport(t, 0,
+		BoltRetentionPolicy{Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/chat/1"}}, TTL: time.Hour},
+	)
+
+	id := func(age time.Duration) string {
+		u, err := uuid.NewV7AtTime(time.Now().Add(-age))
+		require.NoError(t, err)
+
+		return "urn:uuid:" + u.String()
+	}
+
+	old, recent := id(2*time.Hour), id(time.Minute)
+
+	for _, u := range []*Update{
+		{Topic: "https://example.com/chat/1", Event: Event{ID: old}},
+		{Topic: "https://example.com/metrics/1", Event: Event{ID: id(3 * time.Hour)}},
+		{Topic: "https://example.com/chat/1", Event: Event{ID: "not-dated"}},
+		{Topic: "https://example.com/chat/1", Event: Event{ID: recent}},
+	} {
+		require.NoError(t, transport.Dispatch(t.Context(), u))
+	}
+
+	ids, _ := historyIDs(t, transport)
+	assert.NotContains(t, ids, old)
+	assert.Contains(t, ids, "not-dated")
+	assert.Contains(t, ids, recent)
+	assert.Len(t, ids, 3)
+}
+
+func TestBoltTransportRetentionKeepsNewest(t *testing.T) {
+	t.Parallel()
+
+	transport := createRetentionBoltTransport(t, 0,
+		BoltRetentionPolicy{Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "*"}}, TTL: time.Minute},
+	)
+
+	u, err := uuid.NewV7AtTime(time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: "urn:uuid:" + u.String()}}))
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: "urn:uuid:" + u.String() + "-2"}}))
+
+	ids, tombstones := historyIDs(t, transport)
+	assert.Equal(t, []string{"urn:uuid:" + u.String() + "-2"}, ids)
+	assert.Equal(t, 0, tombstones)
+}
+
+func TestBoltTransportRetentionInvalid(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+
+	for _, p := range []BoltRetentionPolicy{
+		{Size: 10},
+		{Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/1"}}},
+		{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/{"}}, Size: 10},
+	} {
+		require.ErrorIs(t, transport.SetRetentionPolicies([]BoltRetentionPolicy{p}), ErrInvalidBoltRetentionPolicy, "%+v", p)
+	}
+}
+
+func TestMatcherSpecificity(t *testing.T) {
+	t.Parallel()
+
+	assert.Greater(t, matcherSpecificity(TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/1"}), matcherSpecificity(TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/metrics/cpu"}))
+	assert.Greater(t, matcherSpecificity(TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/metrics/*"}), matcherSpecificity(TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/*"}))
+	assert.Greater(t, matcherSpecificity(TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/*"}), matcherSpecificity(TopicMatcher{Type: MatcherTypeExact, Pattern: "*"}))
+}
+
+func TestBoltTransportRetentionExemptions(t *testing.T) {
+	t.Parallel()
+
+	transport := createRetentionBoltTransport(t, 2)
+	createDummy(t, WithTransport(transport), WithRetentionExemptions(RetentionExemptions{
+		Exempt:    []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/audit/*"}},
+		Forbidden: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/presence"}},
+	}))
+
+	s := NewLocalSubscriber("", transport.logger, &TopicMatcherStore{})
+	s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/presence"}}, nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	updates := []*Update{
+		{Topic: "https://example.com/audit/1", Expires: time.Now().Add(-time.Second), Event: Event{ID: "audit"}},
+		{Topic: "https://example.com/presence", Event: Event{ID: "presence"}},
+		{Topic: "https://example.com/1", Event: Event{ID: "a"}},
+		{Topic: "https://example.com/1", Event: Event{ID: "b"}},
+		{Topic: "https://example.com/1", Event: Event{ID: "c"}},
+		{Topic: "https://example.com/1", Event: Event{ID: "d"}},
+	}
+
+	for _, u := range updates {
+		require.NoError(t, transport.Dispatch(t.Context(), u))
+	}
+
+	// Dispatched, but not stored.
+	assert.Equal(t, "presence", (<-s.Receive()).ID)
+
+	ids, _ := historyIDs(t, transport)
+	assert.Equal(t, []string{"audit", "c", "d"}, ids)
+}
@@ -0,0 +1,188 @@
+package mercure
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltSchemaBucketName is the bucket holding the schema version of every
+// history bucket of a Bolt database.
+const boltSchemaBucketName = "mercure_schema"
+
+// ErrSchemaTooRecent is returned when the storage of a transport has been
+// migrated by a more recent version of the hub.
+var ErrSchemaTooRecent = errors.New("the storage schema is more recent than the one supported by this version of the hub")
+
+// SchemaMigration describes a change of the storage schema of a transport.
+type SchemaMigration struct {
+	// Version is the schema version after the migration.
+	Version int
+	// Description explains what the migration changes.
+	Description string
+}
+
+type boltMigration struct {
+	SchemaMigration
+
+	// up migrates the history stored in the bucket. It runs in the same
+	// transaction as the other pending migrations, so a failure leaves the
+	// database unchanged.
+	up func(tx *bolt.Tx, bucketName string) error
+}
+
+// boltMigrations are the migrations of the Bolt storage schema, in order. A
+// change to the storage format (the key encoding, the value encoding...) must
+// come with a new migration converting the existing histories.
+var boltMigrations = []boltMigration{ //nolint:gochecknoglobals
+	{
+		SchemaMigration: SchemaMigration{Version: 1, Description: "Version the schema of the history"},
+		// Keys are already made of the 8-byte sequence and the ID.
+		up: func(*bolt.Tx, string) error { return nil },
+	},
+}
+
+// boltSchemaVersion returns the schema version of the history stored in the
+// bucket, 0 if it has never been versioned.
+func boltSchemaVersion(tx *bolt.Tx, bucketName string) int {
+	b := tx.Bucket([]byte(boltSchemaBucketName))
+	if b == nil {
+		return 0
+	}
+
+	v := b.Get([]byte(bucketName))
+	if len(v) != 8 {
+		return 0
+	}
+
+	return int(binary.BigEndian.Uint64(v)) //nolint:gosec
+}
+
+func latestBoltSchema(migrations []boltMigration) int {
+	if len(migrations) == 0 {
+		return 0
+	}
+
+	return migrations[len(migrations)-1].Version
+}
+
+// pendingBoltMigrations returns the migrations to apply to the history stored
+// in the bucket. A new history is created with the latest schema, and has no
+// pending migration.
+func pendingBoltMigrations(tx *bolt.Tx, bucketName string, migrations []boltMigration) ([]boltMigration, error) {
+	version := boltSchemaVersion(tx, bucketName)
+	if version == 0 && tx.Bucket([]byte(bucketName)) == nil {
+		return nil, nil
+	}
+
+	if latest := latestBoltSchema(migrations); version > latest {
+		return nil, fmt.Errorf("%w: version %d, supported %d", ErrSchemaTooRecent, version, latest)
+	}
+
+	for i, m := range migrations {
+		if m.Version > version {
+			return migrations[i:], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// migrateBoltSchema applies the pending migrations to the history stored in
+// the bucket, atomically, and returns them.
+func migrateBoltSchema(db *bolt.DB, bucketName string, migrations []boltMigration) (applied []SchemaMigration, err error) {
+	if err := db.Update(func(tx *bolt.Tx) error {
+		pending, err := pendingBoltMigrations(tx, bucketName, migrations)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range pending {
+			if err := m.up(tx, bucketName); err != nil {
+				return fmt.Errorf("schema migration %d (%s): %w", m.Version, m.Description, err)
+			}
+
+			applied = append(applied, m.SchemaMigration)
+		}
+
+		latest := latestBoltSchema(migrations)
+		if boltSchemaVersion(tx, bucketName) == latest {
+			return nil
+		}
+
+		b, err := tx.CreateBucketIfNotExists([]byte(boltSchemaBucketName))
+		if err != nil {
+			return fmt.Errorf("unable to create the schema bucket: %w", err)
+		}
+
+		v := make([]byte, 8)
+		binary.BigEndian.PutUint64(v, uint64(latest)) //nolint:gosec
+
+		return b.Put([]byte(bucketName), v) //nolint:wrapcheck
+	}); err != nil {
+		return nil, fmt.Errorf("unable to migrate the Bolt database: %w", err)
+	}
+
+	return applied, nil
+}
+
+// PendingBoltMigrations returns the schema migrations the history stored in
+// bucketName (the default bucket when empty) of the Bolt database at path
+// needs, without applying them. The database must not be in use.
+func PendingBoltMigrations(path, bucketName string) ([]SchemaMigration, error) {
+	if bucketName == "" {
+		bucketName = defaultBoltBucketName
+	}
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	db, err := openBoltDatabase(path, true)
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+
+	var pending []SchemaMigration
+
+	if err := db.View(func(tx *bolt.Tx) error {
+		migrations, err := pendingBoltMigrations(tx, bucketName, boltMigrations)
+		for _, m := range migrations {
+			pending = append(pending, m.SchemaMigration)
+		}
+
+		return err
+	}); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return pending, nil
+}
+
+// MigrateBoltDatabase applies the pending schema migrations to the history
+// stored in bucketName (the default bucket when empty) of the Bolt database at
+// path, and returns them. BoltTransport applies them when it starts: this
+// allows migrating a database offline. The database must not be in use.
+func MigrateBoltDatabase(path, bucketName string) ([]SchemaMigration, error) {
+	if bucketName == "" {
+		bucketName = defaultBoltBucketName
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return nil, fmt.Errorf("unable to open Bolt database: %w", err)
+	}
+
+	db, err := openBoltDatabase(path, false)
+	if err != nil {
+		return nil, err
+	}
+
+	defer db.Close()
+
+	return migrateBoltSchema(db, bucketName, boltMigrations)
+}
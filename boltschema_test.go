@@ -0,0 +1,123 @@
+package mercure
+
+import (
+	"encoding/binary"
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltSchemaMigrations(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "mercure.db")
+
+	// A new database is created with the latest schema.
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}))
+	require.NoError(t, transport.Close(t.Context()))
+
+	pending, err := PendingBoltMigrations(path, "")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// An unversioned history, written before the schema was versioned.
+	db, err := openBoltDatabase(path, false)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(boltSchemaBucketName))
+	}))
+
+	var migrated []string
+
+	migrations := append(slices.Clone(boltMigrations), boltMigration{
+		SchemaMigration: SchemaMigration{Version: 2, Description: "Test"},
+		up: func(tx *bolt.Tx, bucketName string) error {
+			return tx.Bucket([]byte(bucketName)).ForEach(func(k, _ []byte) error {
+				migrated = append(migrated, string(k[8:]))
+
+				return nil
+			})
+		},
+	})
+
+	applied, err := migrateBoltSchema(db, defaultBoltBucketName, migrations)
+	require.NoError(t, err)
+	assert.Equal(t, []SchemaMigration{migrations[0].SchemaMigration, migrations[1].SchemaMigration}, applied)
+	assert.Len(t, migrated, 1)
+
+	applied, err = migrateBoltSchema(db, defaultBoltBucketName, migrations)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+
+	// A failing migration leaves the database unchanged.
+	errMigration := errors.New("failed")
+	_, err = migrateBoltSchema(db, defaultBoltBucketName, append(migrations, boltMigration{
+		SchemaMigration: SchemaMigration{Version: 3, Description: "Failing"},
+		up: func(tx *bolt.Tx, _ string) error {
+			if _, err := tx.CreateBucket([]byte("foo")); err != nil {
+				return err
+			}
+
+			return errMigration
+		},
+	}))
+	require.ErrorIs(t, err, errMigration)
+	require.NoError(t, db.View(func(tx *bolt.Tx) error {
+		assert.Nil(t, tx.Bucket([]byte("foo")))
+		assert.Equal(t, 2, boltSchemaVersion(tx, defaultBoltBucketName))
+
+		return nil
+	}))
+	require.NoError(t, db.Close())
+
+	// This version of the hub only knows the first schema.
+	_, err = PendingBoltMigrations(path, "")
+	require.ErrorIs(t, err, ErrSchemaTooRecent)
+
+	_, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), path, "", 0, 0)
+	require.ErrorIs(t, err, ErrSchemaTooRecent)
+}
+
+func TestMigrateBoltDatabase(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "mercure.db")
+
+	db, err := openBoltDatabase(path, false)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucket([]byte(defaultBoltBucketName))
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, 1)
+
+		return b.Put(append(key, "foo"...), []byte(`{"topic":"https://example.com/books/1"}`))
+	}))
+	require.NoError(t, db.Close())
+
+	pending, err := PendingBoltMigrations(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, []SchemaMigration{boltMigrations[0].SchemaMigration}, pending)
+
+	applied, err := MigrateBoltDatabase(path, "")
+	require.NoError(t, err)
+	assert.Equal(t, pending, applied)
+
+	pending, err = PendingBoltMigrations(path, "")
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	_, err = NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "reserved.db"), boltSchemaBucketName, 0, 0)
+	require.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package mercure
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltSequencesBucketSuffix is appended to the name of the bucket of the
+// history to name the bucket holding the last number assigned on each topic
+// (see WithTopicSequences).
+const boltSequencesBucketSuffix = "_sequences"
+
+// EnableTopicSequences numbers the updates in the database, in the
+// transaction storing them: the numbers survive restarts, and are shared by
+// the hubs using the same database file.
+func (t *BoltTransport) EnableTopicSequences() error {
+	t.topicSequences = true
+
+	return nil
+}
+
+// persistNumbered numbers the updates, then stores the ones not forbidden by
+// the retention exemptions, in a single transaction. The updates are left
+// unnumbered if it fails.
+func (t *BoltTransport) persistNumbered(updates []*Update, now time.Time) error {
+	var (
+		stored  []*Update
+		lastSeq uint64
+	)
+
+	if err := t.db.Update(func(tx *bolt.Tx) error {
+		if err := t.numberUpdates(tx, updates); err != nil {
+			return err
+		}
+
+		updateJSONs, err := t.marshalUpdates(updates, now)
+		if err != nil {
+			return err
+		}
+
+		var storedJSONs [][]byte
+		if stored, storedJSONs = t.persisted(updates, updateJSONs); len(stored) == 0 {
+			return nil
+		}
+
+		bucket, err := tx.CreateBucketIfNotExists([]byte(t.bucketName))
+		if err != nil {
+			return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+		}
+
+		lastSeq, err = t.store(tx, bucket, stored, storedJSONs)
+
+		return err
+	}); err != nil {
+		for _, u := range updates {
+			u.Sequence = 0
+		}
+
+		return fmt.Errorf("bolt error: %w", err)
+	}
+
+	if len(stored) > 0 {
+		t.advance(stored, lastSeq)
+	}
+
+	return nil
+}
+
+// numberUpdates sets the Sequence field of the updates, and records the last
+// number of their topics.
+func (t *BoltTransport) numberUpdates(tx *bolt.Tx, updates []*Update) error {
+	sequences, err := tx.CreateBucketIfNotExists([]byte(t.bucketName + boltSequencesBucketSuffix))
+	if err != nil {
+		return fmt.Errorf("error when creating Bolt DB bucket: %w", err)
+	}
+
+	for _, u := range updates {
+		topic := []byte(sequenceTopic(u))
+
+		var seq uint64
+		if v := sequences.Get(topic); len(v) == 8 {
+			seq = binary.BigEndian.Uint64(v)
+		}
+
+		seq++
+		if err := sequences.Put(topic, binary.BigEndian.AppendUint64(nil, seq)); err != nil {
+			return fmt.Errorf("unable to put value in Bolt DB: %w", err)
+		}
+
+		u.Sequence = seq
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltTransportTopicSequences(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "sequences.db")
+
+	open := func() *BoltTransport {
+		transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), path, defaultBoltBucketName, 0, BoltDefaultCleanupFrequency)
+		require.NoError(t, err)
+		require.NoError(t, transport.EnableTopicSequences())
+		require.NoError(t, transport.SetRetentionExemptions(RetentionExemptions{
+			Forbidden: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/presence"}},
+		}))
+
+		return transport
+	}
+
+	transport := open()
+
+	s := NewLocalSubscriber("", transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/1", "https://example.com/presence"}), nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: "a"}}))
+	require.NoError(t, transport.DispatchGroup(t.Context(), []*Update{
+		{Topic: "https://example.com/presence", Event: Event{ID: "p"}},
+		{Topic: "https://example.com/1", Event: Event{ID: "b"}},
+	}))
+
+	// The updates that are not stored are numbered too.
+	for _, want := range []uint64{1, 1, 2} {
+		assert.Equal(t, want, (<-s.Receive()).Sequence)
+	}
+
+	require.NoError(t, transport.Close(t.Context()))
+
+	// The numbers are stored with the updates, and survive restarts.
+	transport = open()
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(context.Background()))
+	})
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: "c"}}))
+
+	var sequences []uint64
+	require.NoError(t, transport.ReadHistory(t.Context(), func(u *Update) error {
+		sequences = append(sequences, u.Sequence)
+
+		return nil
+	}))
+	assert.Equal(t, []uint64{1, 2, 3}, sequences)
+}
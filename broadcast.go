@@ -0,0 +1,176 @@
+package mercure
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// broadcastScriptURL is the endpoint serving the broadcast client script.
+	broadcastScriptURL = defaultHubURL + "/broadcast.js"
+
+	// paramShared is the subscribe query parameter marking the connections
+	// shared by several clients.
+	paramShared = "shared"
+
+	// defaultBroadcastChannel is the name of the BroadcastChannel when
+	// BroadcastScript.Channel is not set.
+	defaultBroadcastChannel = "mercure"
+
+	broadcastConfigPlaceholder = "/* config */ {}"
+)
+
+var (
+	// ErrInvalidBroadcastScript is returned by WithBroadcastScript when the
+	// configuration of the script is not valid.
+	ErrInvalidBroadcastScript = errors.New("invalid broadcast script configuration")
+
+	// errInvalidShared is returned when the shared subscribe parameter is not
+	// a boolean.
+	errInvalidShared = errors.New(`invalid "shared" parameter`)
+)
+
+//go:embed broadcast.js
+var broadcastScriptSource string
+
+// BroadcastScript configures the client script served by WithBroadcastScript.
+type BroadcastScript struct {
+	// HubURL is the URL the script connects to, relative to the URL of the
+	// script. It defaults to the URL of the hub link (see WithHubLink).
+	HubURL string
+	// Topics are the topics the pages subscribe to by default, as templates
+	// whose {name} expressions are replaced with the variables given by the
+	// page, like https://example.com/users/{user}/notifications.
+	Topics []string
+	// TokenURL, when set, is the endpoint of the application the script
+	// POSTs to, with the cookies of the page, to get the access token of
+	// every connection, as a JSON object with a "token" member. Relative URLs
+	// are resolved against the page. The authorization cookie of the hub is
+	// used otherwise.
+	TokenURL string
+	// Channel is the name of the BroadcastChannel shared by the pages,
+	// "mercure" by default. Deployments serving several applications on the
+	// same origin must use distinct names.
+	Channel string
+}
+
+// broadcastScriptConfig is the configuration injected in the script.
+type broadcastScriptConfig struct {
+	Hub      string   `json:"hub"`
+	Topics   []string `json:"topics"`
+	TokenURL string   `json:"token_url,omitempty"`
+	Channel  string   `json:"channel"`
+}
+
+// WithBroadcastScript serves, at /.well-known/mercure/broadcast.js, a client
+// script letting all the tabs of an origin share a single connection to the
+// hub: one of them subscribes to the topics of all the tabs, and forwards the
+// events to the others through a BroadcastChannel. The pages load it with a
+// script element, and call MercureBroadcast.subscribe().
+//
+// The shared connection subscribes with the shared query parameter: the hub
+// then sends, in every event, a match field per subscribed matcher matching
+// the topics of the update, for the script to route the events to the tabs
+// requesting them. As the events reach every tab of the origin subscribed to
+// their topics, the access token of the connection must only grant the
+// private topics all of them may receive, typically the ones of the user.
+func WithBroadcastScript(s BroadcastScript) Option {
+	return func(o *opt) error {
+		for _, u := range []string{s.HubURL, s.TokenURL} {
+			if _, err := url.Parse(u); err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidBroadcastScript, err)
+			}
+		}
+
+		for _, t := range s.Topics {
+			if t == "" || strings.Count(t, "{") != strings.Count(t, "}") {
+				return fmt.Errorf("%w: invalid topic template %q", ErrInvalidBroadcastScript, t)
+			}
+		}
+
+		o.broadcastScript = &s
+
+		return nil
+	}
+}
+
+// script returns the script configured for the hub.
+func (s *BroadcastScript) script(hubURL string) ([]byte, error) {
+	c := broadcastScriptConfig{Hub: s.HubURL, Topics: s.Topics, TokenURL: s.TokenURL, Channel: s.Channel}
+	if c.Hub == "" {
+		c.Hub = hubURL
+	}
+
+	if c.Topics == nil {
+		c.Topics = []string{}
+	}
+
+	if c.Channel == "" {
+		c.Channel = defaultBroadcastChannel
+	}
+
+	j, err := json.Marshal(c)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return []byte(strings.Replace(broadcastScriptSource, broadcastConfigPlaceholder, string(j), 1)), nil
+}
+
+// BroadcastScriptHandler serves the broadcast client script.
+func (h *Hub) BroadcastScriptHandler(w http.ResponseWriter, r *http.Request) {
+	script, err := h.broadcastScript.script(h.hubURL)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	sum := sha256.Sum256(script)
+
+	w.Header().Set("Content-Type", "text/javascript; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("ETag", `"`+base64.RawURLEncoding.EncodeToString(sum[:16])+`"`)
+
+	http.ServeContent(w, r, "broadcast.js", time.Time{}, bytes.NewReader(script))
+}
+
+// parseShared reads the shared subscribe query parameter.
+func parseShared(values url.Values) (bool, error) {
+	v := values.Get(paramShared)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errInvalidShared
+	}
+
+	return b, nil
+}
+
+// matchFields returns the match fields of the event of the update sent to a
+// shared connection: one per subscribed matcher matching its topics.
+func matchFields(s *LocalSubscriber, u *Update) string {
+	var b strings.Builder
+
+	topics := u.topics()
+	for _, m := range s.SubscribedMatchers {
+		if s.topicMatcherStore.matches(topics, m) {
+			b.WriteString("match: " + string(m.Type) + " " + m.Pattern + "\n")
+		}
+	}
+
+	return b.String()
+}
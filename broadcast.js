@@ -0,0 +1,334 @@
+// Mercure broadcast client, generated by the hub.
+//
+// The tabs of the origin share a single connection to the hub: the tab
+// holding the Web Lock named after the channel connects, and forwards the
+// events to the other tabs through a BroadcastChannel. When it closes,
+// another tab takes the lock over, and resumes from the last event received.
+(function () {
+  "use strict";
+
+  const config = /* config */ {};
+
+  const base = document.currentScript ? document.currentScript.src : location.href;
+  const hubURL = new URL(config.hub, base);
+  const tokenURL = config.token_url ? new URL(config.token_url, location.href) : null;
+
+  const tab = crypto.randomUUID();
+  const channel = new BroadcastChannel(config.channel);
+
+  // The subscriptions of this tab, by ID.
+  const subscriptions = new Map();
+  let nextID = 0;
+
+  // The matchers wanted by every tab, by tab, only used by the leader.
+  const wanted = new Map();
+  let leader = false;
+  let connection = null;
+  let connectedKeys = null;
+  let connectTimer = null;
+
+  // The ID of the last event received, by any tab.
+  let lastEventID = null;
+
+  function matcherKey(type, pattern) {
+    return type + " " + pattern;
+  }
+
+  // expand expands the {name} expressions of a topic template.
+  function expand(template, variables) {
+    return template.replace(/\{([^}]+)\}/g, function (_, name) {
+      if (!(name in variables)) {
+        throw new Error('Missing variable "' + name + '" for the topic template ' + template);
+      }
+
+      return encodeURIComponent(String(variables[name]));
+    });
+  }
+
+  function ownKeys() {
+    const keys = new Set();
+    for (const s of subscriptions.values()) {
+      for (const k of s.keys) {
+        keys.add(k);
+      }
+    }
+
+    return Array.from(keys);
+  }
+
+  function announce() {
+    if (leader) {
+      wanted.set(tab, ownKeys());
+      scheduleConnect();
+
+      return;
+    }
+
+    channel.postMessage({ type: "matchers", tab: tab, keys: ownKeys() });
+  }
+
+  function dispatch(event) {
+    if (event.id !== null) {
+      lastEventID = event.id;
+    }
+
+    for (const s of subscriptions.values()) {
+      if (event.matches.some(function (k) { return s.keys.has(k); })) {
+        try {
+          s.callback(event);
+        } catch (e) {
+          console.error(e);
+        }
+      }
+    }
+  }
+
+  channel.onmessage = function (e) {
+    const m = e.data;
+
+    switch (m.type) {
+      case "event":
+        dispatch(m.event);
+        break;
+
+      case "hello":
+        announce();
+        break;
+
+      case "matchers":
+        if (leader) {
+          wanted.set(m.tab, m.keys);
+          scheduleConnect();
+        }
+        break;
+
+      case "leave":
+        if (leader) {
+          wanted.delete(m.tab);
+          scheduleConnect();
+        }
+        break;
+    }
+  };
+
+  addEventListener("pagehide", function () {
+    if (!leader) {
+      channel.postMessage({ type: "leave", tab: tab });
+    }
+  });
+
+  // scheduleConnect reconnects with the matchers of all the tabs when they
+  // change, waiting for the other changes made at the same time.
+  function scheduleConnect() {
+    clearTimeout(connectTimer);
+    connectTimer = setTimeout(function () {
+      const keys = new Set();
+      for (const ks of wanted.values()) {
+        for (const k of ks) {
+          keys.add(k);
+        }
+      }
+
+      const sorted = Array.from(keys).sort();
+      if (sorted.join("\n") !== connectedKeys) {
+        connect(sorted);
+      }
+    }, 50);
+  }
+
+  function sleep(ms) {
+    return new Promise(function (resolve) { setTimeout(resolve, ms); });
+  }
+
+  async function fetchToken(signal) {
+    const response = await fetch(tokenURL, { method: "POST", credentials: "include", signal: signal });
+    if (!response.ok) {
+      throw new Error("Unable to get an access token: " + response.status);
+    }
+
+    return (await response.json()).token;
+  }
+
+  function subscribeURL(keys) {
+    const url = new URL(hubURL);
+    for (const k of keys) {
+      const i = k.indexOf(" ");
+      const type = k.slice(0, i);
+      url.searchParams.append(type === "exact" ? "match" : "match_" + type, k.slice(i + 1));
+    }
+
+    url.searchParams.set("shared", "true");
+    if (lastEventID !== null) {
+      url.searchParams.set("last_event_id", lastEventID);
+    }
+
+    return url;
+  }
+
+  async function connect(keys) {
+    if (connection) {
+      connection.abort();
+    }
+
+    connectedKeys = keys.join("\n");
+    connection = null;
+    if (keys.length === 0) {
+      return;
+    }
+
+    const controller = new AbortController();
+    connection = controller;
+
+    let retry = 3000;
+    while (!controller.signal.aborted) {
+      const start = Date.now();
+
+      try {
+        // The hub closes the connection when the token expires: a new one is
+        // fetched for every connection.
+        const headers = { Accept: "text/event-stream" };
+        if (tokenURL) {
+          headers.Authorization = "Bearer " + (await fetchToken(controller.signal));
+        }
+
+        const response = await fetch(subscribeURL(keys), {
+          headers: headers,
+          credentials: "include",
+          cache: "no-store",
+          signal: controller.signal,
+        });
+        if (!response.ok) {
+          throw new Error("Unexpected status code " + response.status);
+        }
+
+        retry = await read(response.body, retry);
+      } catch (e) {
+        if (controller.signal.aborted) {
+          return;
+        }
+
+        console.warn("Mercure connection lost", e);
+      }
+
+      // Closed by the hub after a while, most likely because the token
+      // expired: reconnect at once.
+      if (Date.now() - start < retry) {
+        await sleep(retry);
+      }
+    }
+  }
+
+  // read parses the text/event-stream response, and returns the reconnection
+  // time set by the hub when it ends.
+  async function read(body, retry) {
+    const reader = body.pipeThrough(new TextDecoderStream()).getReader();
+
+    let buffer = "";
+    let event = { id: null, type: "", data: null, matches: [] };
+
+    for (;;) {
+      const chunk = await reader.read();
+      if (chunk.done) {
+        return retry;
+      }
+
+      buffer += chunk.value;
+
+      let i;
+      while ((i = buffer.search(/[\r\n]/)) >= 0) {
+        if (buffer[i] === "\r" && i === buffer.length - 1) {
+          // Maybe the first half of a CRLF.
+          break;
+        }
+
+        const line = buffer.slice(0, i);
+        buffer = buffer.slice(buffer[i] === "\r" && buffer[i + 1] === "\n" ? i + 2 : i + 1);
+
+        if (line === "") {
+          if (event.data !== null) {
+            const e = { id: event.id, type: event.type || "message", data: event.data, matches: event.matches };
+            channel.postMessage({ type: "event", event: e });
+            dispatch(e);
+          }
+
+          event = { id: null, type: "", data: null, matches: [] };
+          continue;
+        }
+
+        if (line[0] === ":") {
+          continue;
+        }
+
+        const c = line.indexOf(":");
+        const field = c < 0 ? line : line.slice(0, c);
+        let value = c < 0 ? "" : line.slice(c + 1);
+        if (value[0] === " ") {
+          value = value.slice(1);
+        }
+
+        switch (field) {
+          case "data":
+            event.data = event.data === null ? value : event.data + "\n" + value;
+            break;
+
+          case "id":
+            event.id = value;
+            break;
+
+          case "event":
+            event.type = value;
+            break;
+
+          case "match":
+            event.matches.push(value);
+            break;
+
+          case "retry":
+            if (/^\d+$/.test(value)) {
+              retry = Number(value);
+            }
+            break;
+        }
+      }
+    }
+  }
+
+  navigator.locks.request("mercure:" + config.channel, function () {
+    leader = true;
+    wanted.set(tab, ownKeys());
+    channel.postMessage({ type: "hello" });
+    scheduleConnect();
+
+    // Held until the tab is closed.
+    return new Promise(function () {});
+  });
+
+  window.MercureBroadcast = {
+    // subscribe calls callback with the events ({id, type, data, matches})
+    // of the topics, the topic templates of the configuration expanded with
+    // options.variables by default, and of the URL patterns. It returns a
+    // function canceling the subscription.
+    subscribe: function (options, callback) {
+      const variables = options.variables || {};
+      const topics = options.topics || config.topics.map(function (t) { return expand(t, variables); });
+
+      const keys = new Set();
+      for (const t of topics) {
+        keys.add(matcherKey("exact", t));
+      }
+
+      for (const p of options.urlpatterns || []) {
+        keys.add(matcherKey("urlpattern", p));
+      }
+
+      const id = nextID++;
+      subscriptions.set(id, { keys: keys, callback: callback });
+      announce();
+
+      return function () {
+        subscriptions.delete(id);
+        announce();
+      };
+    },
+  };
+})();
@@ -0,0 +1,115 @@
+package mercure
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithBroadcastScriptInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, s := range []BroadcastScript{
+		{HubURL: "http://[::1"},
+		{TokenURL: "%zz"},
+		{Topics: []string{""}},
+		{Topics: []string{"https://example.com/users/{user"}},
+	} {
+		_, err := NewHub(t.Context(), WithBroadcastScript(s))
+		require.ErrorIs(t, err, ErrInvalidBroadcastScript)
+	}
+}
+
+func TestBroadcastScriptHandler(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithBroadcastScript(BroadcastScript{
+		Topics:   []string{"https://example.com/users/{user}/notifications"},
+		TokenURL: "/mercure-token",
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, broadcastScriptURL, nil)
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/javascript; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "no-cache", resp.Header.Get("Cache-Control"))
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `const config = {"hub":"/.well-known/mercure","topics":["https://example.com/users/{user}/notifications"],"token_url":"/mercure-token","channel":"mercure"};`)
+	assert.NotContains(t, string(body), broadcastConfigPlaceholder)
+
+	req = httptest.NewRequest(http.MethodGet, broadcastScriptURL, nil)
+	req.Header.Set("If-None-Match", resp.Header.Get("ETag"))
+	w = httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotModified, w.Code)
+}
+
+func TestBroadcastScriptDisabled(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	req := httptest.NewRequest(http.MethodGet, broadcastScriptURL, nil)
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSubscribeShared(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1&match_urlpattern=https://example.com/books/:id&match=https://example.com/authors/1&shared=true", nil).WithContext(ctx)
+	w := newSubscribeRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "a", Data: "book"}}))
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/authors/1", Event: Event{ID: "b", Data: "author"}}))
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	body := w.Body.String()
+	assert.Contains(t, body, "match: exact https://example.com/books/1\nmatch: urlpattern https://example.com/books/:id\nid: a\ndata: book\n\n")
+	assert.Contains(t, body, "match: exact https://example.com/authors/1\nid: b\ndata: author\n\n")
+}
+
+func TestSubscribeSharedInvalid(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1&shared=maybe", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), `Invalid "shared" parameter`))
+}
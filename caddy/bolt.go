@@ -5,6 +5,7 @@ import (
 	"encoding/gob"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
@@ -15,12 +16,51 @@ func init() { //nolint:gochecknoinits
 	caddy.RegisterModule(&Bolt{})
 }
 
+// BoltRetentionConfig limits the history kept for the updates of some topics.
+type BoltRetentionConfig struct {
+	// Exact topic matchers selecting the topics the policy applies to.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers selecting the topics the policy applies to.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+
+	// Number of most recent updates kept.
+	Size uint64 `json:"size,omitempty"`
+
+	// How long the updates are kept.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+}
+
 type Bolt struct {
 	Path             string  `json:"path,omitempty"`
 	BucketName       string  `json:"bucket_name,omitempty"`
 	Size             uint64  `json:"size,omitempty"`
 	CleanupFrequency float64 `json:"cleanup_frequency,omitempty"`
 
+	// Verify the integrity of the database on startup, and refuse to start if
+	// it is corrupted.
+	IntegrityCheck bool `json:"integrity_check,omitempty"`
+
+	// Verify the integrity of the database on startup, and replace it with
+	// its readable entries if it is corrupted. The corrupted database is
+	// kept next to it.
+	Recover bool `json:"recover,omitempty"`
+
+	// Keep only the most recent update per topic and compaction key, except
+	// for the CompactionTail most recent updates.
+	Compaction     bool   `json:"compaction,omitempty"`
+	CompactionTail uint64 `json:"compaction_tail,omitempty"`
+
+	// Expire the updates stored for longer than this duration.
+	EventTTL caddy.Duration `json:"event_ttl,omitempty"`
+
+	// Hash-chain the stored updates, for the history to be verifiable.
+	HashChain bool `json:"hash_chain,omitempty"`
+
+	// Retention policies of the history per topic, the size applying to
+	// the updates not governed by any policy.
+	Retention []BoltRetentionConfig `json:"retention,omitempty"`
+
 	transport    *mercure.BoltTransport
 	transportKey string
 }
@@ -53,8 +93,12 @@ func (b *Bolt) Provision(ctx caddy.Context) error {
 	b.transportKey = key.String()
 
 	destructor, _, err := TransportUsagePool.LoadOrNew(b.transportKey, func() (caddy.Destructor, error) {
+		if err := b.checkIntegrity(ctx); err != nil {
+			return nil, err
+		}
+
 		t, err := mercure.NewBoltTransport(
-			mercure.NewSubscriberList(ctx.Value(SubscriberListCacheSizeContextKey).(int)),
+			mercure.NewSubscriberList(0),
 			ctx.Slogger(),
 			b.Path,
 			b.BucketName,
@@ -65,6 +109,22 @@ func (b *Bolt) Provision(ctx caddy.Context) error {
 			return nil, err
 		}
 
+		if b.Compaction {
+			t.EnableCompaction(b.CompactionTail)
+		}
+
+		t.SetEventTTL(time.Duration(b.EventTTL))
+
+		if b.HashChain {
+			t.EnableHashChain()
+		}
+
+		if err := t.SetRetentionPolicies(b.retentionPolicies()); err != nil {
+			_ = t.Close(ctx)
+
+			return nil, err
+		}
+
 		return TransportDestructor[*mercure.BoltTransport]{Transport: t}, nil
 	})
 	if err != nil {
@@ -76,6 +136,36 @@ func (b *Bolt) Provision(ctx caddy.Context) error {
 	return nil
 }
 
+// retentionPolicies returns the configured retention policies.
+func (b *Bolt) retentionPolicies() []mercure.BoltRetentionPolicy {
+	if len(b.Retention) == 0 {
+		return nil
+	}
+
+	policies := make([]mercure.BoltRetentionPolicy, 0, len(b.Retention))
+	for _, r := range b.Retention {
+		policies = append(policies, mercure.BoltRetentionPolicy{
+			Matchers: topicMatchers(r.Match, r.MatchURLPattern),
+			Size:     r.Size,
+			TTL:      time.Duration(r.TTL),
+		})
+	}
+
+	return policies
+}
+
+// checkIntegrity verifies the integrity of the database, and recovers it if
+// configured to.
+//
+//nolint:wrapcheck
+func (b *Bolt) checkIntegrity(ctx caddy.Context) error {
+	if !b.IntegrityCheck && !b.Recover {
+		return nil
+	}
+
+	return mercure.VerifyBoltDatabase(b.Path, b.Recover, ctx.Slogger())
+}
+
 //nolint:wrapcheck
 func (b *Bolt) Cleanup() error {
 	_, err := TransportUsagePool.Delete(b.transportKey)
@@ -127,6 +217,47 @@ func (b *Bolt) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 				}
 
 				b.Size = s
+
+			case "integrity_check":
+				b.IntegrityCheck = true
+
+			case "recover":
+				b.Recover = true
+
+			case "compaction":
+				b.Compaction = true
+
+				if d.NextArg() {
+					tail, e := strconv.ParseUint(d.Val(), 10, 64)
+					if e != nil {
+						return d.WrapErr(e)
+					}
+
+					b.CompactionTail = tail
+				}
+
+			case "event_ttl":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				ttl, e := caddy.ParseDuration(d.Val())
+				if e != nil {
+					return d.WrapErr(e)
+				}
+
+				b.EventTTL = caddy.Duration(ttl)
+
+			case "hash_chain":
+				b.HashChain = true
+
+			case "retention":
+				r, err := parseBoltRetentionBlock(d)
+				if err != nil {
+					return err
+				}
+
+				b.Retention = append(b.Retention, r)
 			}
 		}
 	}
@@ -134,6 +265,56 @@ func (b *Bolt) UnmarshalCaddyfile(d *caddyfile.Dispenser) error {
 	return nil
 }
 
+// parseBoltRetentionBlock parses a "retention { ... }" Caddyfile block.
+//
+//nolint:wrapcheck
+func parseBoltRetentionBlock(d *caddyfile.Dispenser) (BoltRetentionConfig, error) {
+	var r BoltRetentionConfig
+
+	if d.NextArg() {
+		return r, d.ArgErr()
+	}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "match":
+			r.Match = append(r.Match, d.RemainingArgs()...)
+
+		case "match_urlpattern":
+			r.MatchURLPattern = append(r.MatchURLPattern, d.RemainingArgs()...)
+
+		case "size":
+			if !d.NextArg() {
+				return r, d.ArgErr()
+			}
+
+			s, err := strconv.ParseUint(d.Val(), 10, 64)
+			if err != nil {
+				return r, d.WrapErr(err)
+			}
+
+			r.Size = s
+
+		case "ttl":
+			if !d.NextArg() {
+				return r, d.ArgErr()
+			}
+
+			ttl, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return r, d.WrapErr(err)
+			}
+
+			r.TTL = caddy.Duration(ttl)
+
+		default:
+			return r, d.Errf("unknown retention directive %q", d.Val())
+		}
+	}
+
+	return r, nil
+}
+
 var (
 	_ caddy.Provisioner     = (*Bolt)(nil)
 	_ caddy.CleanerUpper    = (*Bolt)(nil)
@@ -0,0 +1,335 @@
+package caddy
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/dunglas/mercure"
+	"github.com/spf13/cobra"
+)
+
+var (
+	errMissingPurgeCriterion = errors.New("--topic or --before is required")
+	errPendingMigrations     = errors.New("the database has pending schema migrations")
+)
+
+func init() { //nolint:gochecknoinits
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "bolt",
+		Usage: "inspect|check|verify|recover|migrate|compact|purge|export [<path>]",
+		Short: "Maintains the database of the Bolt transport",
+		Long: `
+Operates on the database of the Bolt transport while the hub is stopped.
+The path defaults to the one used by the bolt transport when none is
+configured.
+
+	- inspect: lists the buckets, and counts the updates per topic
+	- check: verifies the integrity of the database
+	- verify: verifies the hash chain of the history
+	- recover: replaces a corrupted database with its readable entries
+	- migrate: applies the pending schema migrations
+	- compact: reclaims the space freed by purged updates
+	- purge: removes updates from the history, by topic or age
+	- export: writes the history to stdout as newline delimited JSON`,
+		CobraFunc: func(cmd *cobra.Command) {
+			cmd.PersistentFlags().String("bucket", "", "Name of the bucket holding the history")
+
+			inspect := &cobra.Command{
+				Use:   "inspect [<path>]",
+				Short: "Reports the content of the database",
+				Args:  cobra.MaximumNArgs(1),
+				RunE:  boltInspect,
+			}
+			inspect.Flags().Bool("json", false, "Output JSON")
+
+			check := &cobra.Command{
+				Use:   "check [<path>]",
+				Short: "Verifies the integrity of the database",
+				Args:  cobra.MaximumNArgs(1),
+				RunE:  boltCheck,
+			}
+
+			verify := &cobra.Command{
+				Use:   "verify [<path>]",
+				Short: "Verifies that the history hasn't been tampered with",
+				Args:  cobra.MaximumNArgs(1),
+				RunE:  boltVerify,
+			}
+			verify.Flags().Bool("json", false, "Output JSON")
+
+			recoverCmd := &cobra.Command{
+				Use:   "recover [<path>]",
+				Short: "Replaces a corrupted database with its readable entries",
+				Args:  cobra.MaximumNArgs(1),
+				RunE:  boltRecover,
+			}
+
+			migrateCmd := &cobra.Command{
+				Use:   "migrate [<path>]",
+				Short: "Applies the pending schema migrations",
+				Args:  cobra.MaximumNArgs(1),
+				RunE:  boltMigrate,
+			}
+			migrateCmd.Flags().Bool("check-migrations", false, "List the pending migrations without applying them, and fail if there are any")
+
+			compact := &cobra.Command{
+				Use:   "compact [<path>]",
+				Short: "Rewrites the database to reclaim free space",
+				Args:  cobra.MaximumNArgs(1),
+				RunE:  boltCompact,
+			}
+
+			purge := &cobra.Command{
+				Use:   "purge [<path>]",
+				Short: "Removes updates from the history",
+				Args:  cobra.MaximumNArgs(1),
+				RunE:  boltPurge,
+			}
+			purge.Flags().String("topic", "", "Purge the updates having this topic")
+			purge.Flags().String("before", "", "Purge the updates older than this duration (e.g. 720h) or date (RFC 3339)")
+
+			export := &cobra.Command{
+				Use:   "export [<path>]",
+				Short: "Writes the history to stdout as newline delimited JSON",
+				Args:  cobra.MaximumNArgs(1),
+				RunE:  boltExport,
+			}
+			export.Flags().String("topic", "", "Export only the updates having this topic")
+
+			cmd.AddCommand(inspect, check, verify, recoverCmd, migrateCmd, compact, purge, export)
+		},
+	})
+}
+
+// boltPath returns the database path from the arguments, or the default path
+// of the bolt transport.
+func boltPath(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+
+	return filepath.Join(caddy.AppDataDir(), "mercure.db")
+}
+
+func openBoltHistory(cmd *cobra.Command, args []string, readOnly bool) (*mercure.BoltHistory, error) {
+	bucket, _ := cmd.Flags().GetString("bucket")
+
+	return mercure.OpenBoltHistory(boltPath(args), bucket, readOnly) //nolint:wrapcheck
+}
+
+func boltInspect(cmd *cobra.Command, args []string) error {
+	h, err := openBoltHistory(cmd, args, true)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	r, err := h.Inspect()
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	out := cmd.OutOrStdout()
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+
+		return e.Encode(r) //nolint:wrapcheck
+	}
+
+	fmt.Fprintf(out, "Size: %d bytes\n", r.Size)
+	fmt.Fprintf(out, "Updates: %d (%d retracted)\n", r.Updates, r.Retracted)
+	fmt.Fprintf(out, "First event ID: %s\nLast event ID: %s\n", r.FirstEventID, r.LastEventID)
+
+	fmt.Fprintln(out, "\nBuckets:")
+
+	for _, name := range slices.Sorted(maps.Keys(r.Buckets)) {
+		fmt.Fprintf(out, "  %s\t%d\n", name, r.Buckets[name])
+	}
+
+	fmt.Fprintln(out, "\nTopics:")
+
+	for _, topic := range slices.Sorted(maps.Keys(r.Topics)) {
+		fmt.Fprintf(out, "  %s\t%d\n", topic, r.Topics[topic])
+	}
+
+	return nil
+}
+
+func boltCheck(cmd *cobra.Command, args []string) error {
+	if err := mercure.CheckBoltDatabase(boltPath(args)); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	fmt.Fprintln(cmd.OutOrStdout(), "The database is valid")
+
+	return nil
+}
+
+func boltVerify(cmd *cobra.Command, args []string) error {
+	h, err := openBoltHistory(cmd, args, true)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	r, err := h.VerifyHistoryChain(cmd.Context())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	out := cmd.OutOrStdout()
+
+	if asJSON, _ := cmd.Flags().GetBool("json"); asJSON {
+		e := json.NewEncoder(out)
+		e.SetIndent("", "  ")
+
+		return e.Encode(r) //nolint:wrapcheck
+	}
+
+	fmt.Fprintf(out, "Verified: %d\nRetracted: %d\nRemoved: %d\nUnchained: %d\n", r.Verified, r.Retracted, r.Removed, r.Unchained)
+	fmt.Fprintf(out, "Head: %s (%s)\n", r.Head, r.HeadEventID)
+
+	return nil
+}
+
+func boltRecover(cmd *cobra.Command, args []string) error {
+	path := boltPath(args)
+
+	err := mercure.CheckBoltDatabase(path)
+	if err == nil {
+		fmt.Fprintln(cmd.OutOrStdout(), "The database is valid, nothing to recover")
+
+		return nil
+	}
+
+	if !errors.Is(err, mercure.ErrBoltDatabaseCorrupted) {
+		return err //nolint:wrapcheck
+	}
+
+	r, err := mercure.RecoverBoltDatabase(path)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Salvaged %d entries, the corrupted database has been moved to %s\n", r.Salvaged, r.Backup)
+
+	return nil
+}
+
+func boltMigrate(cmd *cobra.Command, args []string) error {
+	bucket, _ := cmd.Flags().GetString("bucket")
+	out := cmd.OutOrStdout()
+
+	if check, _ := cmd.Flags().GetBool("check-migrations"); check {
+		pending, err := mercure.PendingBoltMigrations(boltPath(args), bucket)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		if len(pending) == 0 {
+			fmt.Fprintln(out, "The schema is up to date")
+
+			return nil
+		}
+
+		for _, m := range pending {
+			fmt.Fprintf(out, "Pending: %d\t%s\n", m.Version, m.Description)
+		}
+
+		return errPendingMigrations
+	}
+
+	applied, err := mercure.MigrateBoltDatabase(boltPath(args), bucket)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	for _, m := range applied {
+		fmt.Fprintf(out, "Applied: %d\t%s\n", m.Version, m.Description)
+	}
+
+	if len(applied) == 0 {
+		fmt.Fprintln(out, "The schema is up to date")
+	}
+
+	return nil
+}
+
+func boltCompact(cmd *cobra.Command, args []string) error {
+	before, after, err := mercure.CompactBoltDatabase(boltPath(args))
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Compacted from %d to %d bytes\n", before, after)
+
+	return nil
+}
+
+func boltPurge(cmd *cobra.Command, args []string) error {
+	var f mercure.BoltPurgeFilter
+
+	f.Topic, _ = cmd.Flags().GetString("topic")
+
+	if before, _ := cmd.Flags().GetString("before"); before != "" {
+		if d, err := caddy.ParseDuration(before); err == nil {
+			f.Before = time.Now().Add(-d)
+		} else if f.Before, err = time.Parse(time.RFC3339, before); err != nil {
+			return fmt.Errorf("invalid --before value %q: %w", before, err)
+		}
+	}
+
+	if f.Topic == "" && f.Before.IsZero() {
+		return errMissingPurgeCriterion
+	}
+
+	h, err := openBoltHistory(cmd, args, false)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	n, err := h.Purge(f)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Purged %d updates, run compact to reclaim the space\n", n)
+
+	return nil
+}
+
+func boltExport(cmd *cobra.Command, args []string) error {
+	topic, _ := cmd.Flags().GetString("topic")
+
+	h, err := openBoltHistory(cmd, args, true)
+	if err != nil {
+		return err
+	}
+	defer h.Close()
+
+	w := bufio.NewWriter(cmd.OutOrStdout())
+
+	n, err := h.Export(w, topic)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("unable to write export: %w", err)
+	}
+
+	fmt.Fprintf(cmd.ErrOrStderr(), "Exported %d updates\n", n)
+
+	return nil
+}
@@ -1,10 +1,23 @@
 package caddy
 
 import (
+	"bufio"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
 	"fmt"
 	"io"
+	"log/slog"
+	"math/big"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
@@ -13,10 +26,17 @@ import (
 	"testing"
 	"time"
 
+	"github.com/MicahParks/keyfunc/v3"
+	"github.com/caddyserver/caddy/v2"
 	"github.com/caddyserver/caddy/v2/caddytest"
+	"github.com/dunglas/mercure"
+	"github.com/dunglas/mercure/mercurepb"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 const (
@@ -105,11 +125,19 @@ func TestMercure(t *testing.T) {
 			path ` + boltPath + `
 		}`},
 		{"local", "transport local\n"},
+		{"dual", `transport dual {
+			old bolt {
+				path ` + boltPath + `
+			}
+			new local
+			cutover
+		}`},
+		{"url", "transport_url bolt://" + boltPath + "?subscriber_shards=2\n"},
 	}
 
 	for _, d := range data {
 		t.Run(d.name, func(t *testing.T) {
-			if d.name == "bolt" {
+			if d.name != "local" {
 				t.Cleanup(func() {
 					require.NoError(t, os.Remove(boltPath))
 				})
@@ -200,13 +228,190 @@ example.com:9080 {
 
 			received.Wait()
 
-			if d.name != "bolt" {
+			if d.name == "local" {
 				assert.NoFileExists(t, boltPath)
 			}
 		})
 	}
 }
 
+// TestMultipleListeners checks that hubs declared on several listeners share
+// their transport: an update published on the internal H2C listener reaches a
+// subscriber of the public one.
+func TestMultipleListeners(t *testing.T) {
+	tester := caddytest.NewTester(t)
+	tester.InitServer(`{
+	skip_install_trust
+	admin localhost:2999
+	http_port     9080
+	https_port    9443
+
+	servers :9081 {
+		protocols h1 h2c
+	}
+}
+
+localhost:9080 {
+	route {
+		@publish method POST
+		respond @publish 403
+
+		mercure {
+			anonymous
+			issuer https://example.com {
+				publisher {
+					jwt !ChangeMe!
+				}
+			}
+			resource_identifier https://example.com/.well-known/mercure
+			transport local
+		}
+
+		respond 404
+	}
+}
+
+http://localhost:9081 {
+	route {
+		mercure {
+			anonymous
+			issuer https://example.com {
+				publisher {
+					jwt !ChangeMe!
+				}
+			}
+			resource_identifier https://example.com/.well-known/mercure
+			transport local
+		}
+
+		respond 404
+	}
+}`, "caddyfile")
+
+	var connected, received sync.WaitGroup
+
+	connected.Add(1)
+	received.Go(func() {
+		cx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(cx, http.MethodGet, "http://localhost:9080/.well-known/mercure?match=https%3A%2F%2Fexample.com%2Ffoo%2F1", nil)
+		resp := tester.AssertResponseCode(req, http.StatusOK)
+
+		connected.Done()
+
+		var receivedBody strings.Builder
+
+		buf := make([]byte, 1024)
+		for !strings.Contains(receivedBody.String(), "data: bar\n") {
+			n, err := resp.Body.Read(buf)
+			require.NoError(t, err)
+
+			receivedBody.Write(buf[:n])
+		}
+
+		assert.NoError(t, resp.Body.Close())
+	})
+
+	connected.Wait()
+
+	body := url.Values{"topic": {"https://example.com/foo/1"}, "data": {"bar"}}
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:9081/.well-known/mercure", strings.NewReader(body.Encode()))
+	require.NoError(t, err)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", bearerPrefix+publisherJWT)
+
+	resp := tester.AssertResponseCode(req, http.StatusOK)
+	require.NoError(t, resp.Body.Close())
+
+	// Publishing is refused on the public listener.
+	req, err = http.NewRequest(http.MethodPost, "http://localhost:9080/.well-known/mercure", strings.NewReader(body.Encode()))
+	require.NoError(t, err)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", bearerPrefix+publisherJWT)
+
+	resp = tester.AssertResponseCode(req, http.StatusForbidden)
+	require.NoError(t, resp.Body.Close())
+
+	received.Wait()
+}
+
+// TestSidecar checks that an update published through the sidecar API reaches
+// an HTTP subscriber.
+func TestSidecar(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "mercure.sock")
+
+	tester := caddytest.NewTester(t)
+	tester.InitServer(`{
+	skip_install_trust
+	admin localhost:2999
+	http_port     9080
+	https_port    9443
+}
+
+localhost:9080 {
+	route {
+		mercure {
+			anonymous
+			issuer https://example.com {
+				publisher {
+					jwt !ChangeMe!
+				}
+			}
+			resource_identifier https://example.com/.well-known/mercure
+			transport local
+			sidecar `+socket+` secret
+		}
+
+		respond 404
+	}
+}`, "caddyfile")
+
+	var connected, received sync.WaitGroup
+
+	connected.Add(1)
+	received.Go(func() {
+		cx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		req, _ := http.NewRequestWithContext(cx, http.MethodGet, "http://localhost:9080/.well-known/mercure?match=https%3A%2F%2Fexample.com%2Ffoo%2F1", nil)
+		resp := tester.AssertResponseCode(req, http.StatusOK)
+
+		connected.Done()
+
+		var receivedBody strings.Builder
+
+		buf := make([]byte, 1024)
+		for !strings.Contains(receivedBody.String(), "data: bar\n") {
+			n, err := resp.Body.Read(buf)
+			require.NoError(t, err)
+
+			receivedBody.Write(buf[:n])
+		}
+
+		assert.NoError(t, resp.Body.Close())
+	})
+
+	connected.Wait()
+
+	conn, err := net.Dial("unix", socket)
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(`{"jsonrpc": "2.0", "id": 1, "method": "authenticate", "params": {"token": "secret"}}` + "\n" +
+		`{"jsonrpc": "2.0", "id": 2, "method": "publish", "params": {"id": "a", "topic": "https://example.com/foo/1", "data": "bar"}}` + "\n"))
+	require.NoError(t, err)
+
+	r := bufio.NewScanner(conn)
+	for _, want := range []string{`{"jsonrpc":"2.0","id":1,"result":true}`, `{"jsonrpc":"2.0","id":2,"result":{"id":"a"}}`} {
+		require.True(t, r.Scan())
+		assert.Equal(t, want, r.Text())
+	}
+
+	received.Wait()
+}
+
 // TestJWTPlaceholders exercises env-var placeholder support with an object-form
 // RS256 JWT. The deprecated URI-template subscribe claim lives in
 // TestJWTPlaceholdersDeprecated — here the publisher uses the modern
@@ -567,6 +772,18 @@ mercure {
 		bucket_name foo
 		size 20
 		cleanup_frequency 0.2
+		recover
+		compaction 1000
+		event_ttl 24h
+		hash_chain
+		retention {
+			match_urlpattern /metrics/*
+			size 10000
+		}
+		retention {
+			match https://example.com/chat
+			ttl 1h
+		}
 	}
 }
 `, "caddyfile", `{
@@ -588,8 +805,27 @@ mercure {
 									"transport": {
 										"bucket_name": "foo",
 										"cleanup_frequency": 0.2,
+										"compaction": true,
+										"compaction_tail": 1000,
+										"event_ttl": 86400000000000,
+										"hash_chain": true,
 										"name": "bolt",
 										"path": "test.db",
+										"recover": true,
+										"retention": [
+											{
+												"match_urlpattern": [
+													"/metrics/*"
+												],
+												"size": 10000
+											},
+											{
+												"match": [
+													"https://example.com/chat"
+												],
+												"ttl": 3600000000000
+											}
+										],
 										"size": 20
 									}
 								}
@@ -640,42 +876,2114 @@ mercure {
 }`)
 }
 
-func TestNewJWKSetKeyfunc(t *testing.T) {
-	jwksPath, err := filepath.Abs("testdata/RS256.jwks.json")
-	require.NoError(t, err)
-
-	t.Run("file URL with empty host", func(t *testing.T) {
-		k, err := newJWKSetKeyfunc(t.Context(), "file://"+jwksPath)
-		require.NoError(t, err)
-		assert.NotNil(t, k)
-	})
+func TestAdaptDualConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
 
-	t.Run("file URL with localhost host", func(t *testing.T) {
-		k, err := newJWKSetKeyfunc(t.Context(), "file://localhost"+jwksPath)
-		require.NoError(t, err)
-		assert.NotNil(t, k)
-	})
+mercure {
+	publisher_jwt !ChangeMe!
+	transport dual {
+		old bolt {
+			path test.db
+		}
+		new local
+		cutover
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"transport": {
+										"cutover": true,
+										"name": "dual",
+										"new": {
+											"name": "local"
+										},
+										"old": {
+											"name": "bolt",
+											"path": "test.db"
+										}
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
 
-	t.Run("file URL with rejected host", func(t *testing.T) {
-		_, err := newJWKSetKeyfunc(t.Context(), "file://example.com"+jwksPath)
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), `"example.com"`)
-	})
+func TestAdaptDualPartialDispatchConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
 
-	t.Run("missing file", func(t *testing.T) {
-		_, err := newJWKSetKeyfunc(t.Context(), "file://"+filepath.Join(t.TempDir(), "absent.json"))
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "failed to read JWK Set file")
-	})
+mercure {
+	publisher_jwt !ChangeMe!
+	transport dual {
+		old local
+		new local
+		retries 3 200ms
+		on_partial_failure dead_letter http https://example.com/dead-letter {
+			header Authorization "Bearer foo"
+		}
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"transport": {
+										"dead_letter": {
+											"header": {
+												"Authorization": [
+													"Bearer foo"
+												]
+											},
+											"type": "http",
+											"url": "https://example.com/dead-letter"
+										},
+										"name": "dual",
+										"new": {
+											"name": "local"
+										},
+										"old": {
+											"name": "local"
+										},
+										"on_partial_failure": "dead_letter",
+										"retries": 3,
+										"retry_delay": 200000000
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
 
-	t.Run("invalid JWK Set JSON", func(t *testing.T) {
-		bad := filepath.Join(t.TempDir(), "bad.json")
-		require.NoError(t, os.WriteFile(bad, []byte("not json"), 0o600))
+func TestAdaptPublishHookConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
 
-		_, err := newJWKSetKeyfunc(t.Context(), "file://"+bad)
-		require.Error(t, err)
-		assert.Contains(t, err.Error(), "failed to parse JWK Set file")
-	})
+mercure {
+	publisher_jwt !ChangeMe!
+	publish_hook http https://example.com/hook {
+		match_urlpattern https://example.com/books/*
+		header Authorization "Bearer foo"
+	}
+	publish_hook nats nats://localhost:4222 mercure.updates {
+		private
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publish_hooks": [
+										{
+											"header": {
+												"Authorization": [
+													"Bearer foo"
+												]
+											},
+											"match_urlpattern": [
+												"https://example.com/books/*"
+											],
+											"type": "http",
+											"url": "https://example.com/hook"
+										},
+										{
+											"private": true,
+											"target": "mercure.updates",
+											"type": "nats",
+											"url": "nats://localhost:4222"
+										}
+									],
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptPollConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	poll https://example.com/books.json https://example.com/books/{id} {
+		interval 30s
+		format json
+		id_field isbn
+		header Authorization "Bearer foo"
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"polling_connectors": [
+										{
+											"format": "json",
+											"header": {
+												"Authorization": [
+													"Bearer foo"
+												]
+											},
+											"id_field": "isbn",
+											"interval": 30000000000,
+											"topic": "https://example.com/books/{id}",
+											"url": "https://example.com/books.json"
+										}
+									],
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptFileChangeConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	watch /data/assets https://example.com/assets/{key} {
+		interval 5s
+		poll
+	}
+	s3_notifications {env.S3_TOKEN} https://example.com/{bucket}/{key} {
+		private
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"file_watchers": [
+										{
+											"dir": "/data/assets",
+											"interval": 5000000000,
+											"poll": true,
+											"topic": "https://example.com/assets/{key}"
+										}
+									],
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"s3_notifications": {
+										"private": true,
+										"token": "{env.S3_TOKEN}",
+										"topic": "https://example.com/{bucket}/{key}"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestReplaceHeaderPlaceholders(t *testing.T) {
+	t.Setenv("MERCURE_TEST_TOKEN", "foo")
+
+	assert.Nil(t, replaceHeaderPlaceholders(caddy.NewReplacer(), nil))
+	assert.Equal(t,
+		http.Header{"Authorization": {"Bearer foo"}, "X-Static": {"bar"}},
+		replaceHeaderPlaceholders(caddy.NewReplacer(), http.Header{"Authorization": {"Bearer {env.MERCURE_TEST_TOKEN}"}, "X-Static": {"bar"}}),
+	)
+}
+
+func TestAdaptRoutingRuleConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	routing_rule big-orders {
+		match_urlpattern https://example.com/orders/:id
+		when $.total > 1000
+		add_topic https://example.com/big-orders
+	}
+	routing_rule {
+		when `+"`"+`$.env == "test"`+"`"+`
+		drop
+	}
+	routing_rule {
+		transform `+"`"+`{"total":{{.total}}}`+"`"+`
+	}
+	routing_rule {
+		match https://example.com/alerts
+		escalate http https://example.com/on-call
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"routing_rules": [
+										{
+											"action": "add_topic",
+											"match_urlpattern": [
+												"https://example.com/orders/:id"
+											],
+											"name": "big-orders",
+											"topic": "https://example.com/big-orders",
+											"when": "$.total \u003e 1000"
+										},
+										{
+											"action": "drop",
+											"when": "$.env == \"test\""
+										},
+										{
+											"action": "transform",
+											"template": "{\"total\":{{.total}}}"
+										},
+										{
+											"action": "escalate",
+											"escalate": {
+												"type": "http",
+												"url": "https://example.com/on-call"
+											},
+											"match": [
+												"https://example.com/alerts"
+											]
+										}
+									]
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestRoutingRules(t *testing.T) {
+	m := &Mercure{RoutingRules: []RoutingRuleConfig{
+		{Name: "big-orders", MatchURLPattern: []string{"https://example.com/orders/:id"}, When: "$.total > 1000", Action: "add_topic", Topic: "https://example.com/big-orders"},
+		{Action: "escalate", Escalate: &PublishHookConfig{Type: "http", URL: "https://example.com/on-call"}},
+	}}
+
+	rules, err := m.routingRules()
+	require.NoError(t, err)
+	require.Len(t, rules, 2)
+	assert.Equal(t, []mercure.TopicMatcher{{Type: mercure.MatcherTypeURLPattern, Pattern: "https://example.com/orders/:id"}}, rules[0].Matchers)
+	assert.Equal(t, mercure.RoutingAddTopic, rules[0].Action)
+	assert.IsType(t, &mercure.HTTPPublishHookTarget{}, rules[1].Target)
+
+	_, err = (&Mercure{RoutingRules: []RoutingRuleConfig{{Action: "escalate", Escalate: &PublishHookConfig{Type: "foo"}}}}).routingRules()
+	require.ErrorIs(t, err, errUnknownPublishHookType)
+}
+
+func TestAdaptEnricherConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	enricher author https://users.example.com/lookup {
+		key $.author_id
+		match_urlpattern https://example.com/comments/:id
+		timeout 50ms
+		cache_ttl 5m
+		header Authorization "Bearer secret"
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"enrichers": [
+										{
+											"cache_ttl": 300000000000,
+											"header": {
+												"Authorization": [
+													"Bearer secret"
+												]
+											},
+											"key": "$.author_id",
+											"match_urlpattern": [
+												"https://example.com/comments/:id"
+											],
+											"name": "author",
+											"timeout": 50000000,
+											"url": "https://users.example.com/lookup"
+										}
+									],
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestEnrichers(t *testing.T) {
+	m := &Mercure{Enrichers: []EnricherConfig{
+		{Name: "author", URL: "https://users.example.com/lookup", Key: "$.author_id", Match: []string{"https://example.com/comments/1"}, Timeout: caddy.Duration(50 * time.Millisecond)},
+	}}
+
+	enrichers, err := m.enrichers()
+	require.NoError(t, err)
+	require.Len(t, enrichers, 1)
+	assert.Equal(t, []mercure.TopicMatcher{{Type: mercure.MatcherTypeExact, Pattern: "https://example.com/comments/1"}}, enrichers[0].Matchers)
+	assert.Equal(t, 50*time.Millisecond, enrichers[0].Timeout)
+	assert.IsType(t, &mercure.HTTPEnricherLookup{}, enrichers[0].Lookup)
+
+	_, err = (&Mercure{Enrichers: []EnricherConfig{{URL: "/relative"}}}).enrichers()
+	require.ErrorIs(t, err, mercure.ErrInvalidEnricher)
+}
+
+func TestAdaptSubscriptionApprovalConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	subscription_approval {
+		match_urlpattern https://example.com/rooms/:id
+		topic https://example.com/approvals
+		approver http https://example.com/moderation
+		timeout 10m
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"subscription_approval": {
+										"approver": {
+											"type": "http",
+											"url": "https://example.com/moderation"
+										},
+										"match_urlpattern": [
+											"https://example.com/rooms/:id"
+										],
+										"timeout": 600000000000,
+										"topic": "https://example.com/approvals"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptJSONPatchDeltasConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	json_patch_deltas {
+		match_urlpattern https://example.com/books/*
+		max_documents 1000
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"json_patch_deltas": {
+										"match_urlpattern": [
+											"https://example.com/books/*"
+										],
+										"max_documents": 1000
+									},
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptRetainedValuesConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	retained_values {
+		match https://example.com/status
+		match_urlpattern https://example.com/books/:id
+		max_topics 1000
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"retained_values": {
+										"match": [
+											"https://example.com/status"
+										],
+										"match_urlpattern": [
+											"https://example.com/books/:id"
+										],
+										"max_topics": 1000
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptSubscriberBufferConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	subscriber_buffer 200 drop-oldest
+	dispatch_watermark 50000
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"dispatch_watermark": 50000,
+									"handler": "mercure",
+									"overflow_policy": "drop-oldest",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"subscriber_buffer_size": 200
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptSubscriberBandwidthConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	subscriber_bandwidth 1MB 10MB
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"subscriber_bandwidth": {
+										"per_connection": 1000000,
+										"per_subject": 10000000
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptAuthorizationURLConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	anonymous
+	authorization_url https://auth.example.com/mercure {
+		cache_ttl 5s
+		cache_size 500
+		failure_threshold 3
+		open_duration 1m
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"anonymous": true,
+									"authorization_webhook": {
+										"cache_size": 500,
+										"cache_ttl": 5000000000,
+										"failure_threshold": 3,
+										"open_duration": 60000000000,
+										"url": "https://auth.example.com/mercure"
+									},
+									"handler": "mercure"
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptTokenIntrospectionConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	resource_identifier https://example.com/
+	token_introspection https://auth.example.com/introspect {
+		client_id mercure
+		client_secret s3cr3t
+		cache_ttl 30s
+		cache_size 1000
+		subscribe_field mercure_subscribe
+		publish_field mercure_publish
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"resource_identifier": "https://example.com/",
+									"token_introspection": {
+										"cache_size": 1000,
+										"cache_ttl": 30000000000,
+										"client_id": "mercure",
+										"client_secret": "s3cr3t",
+										"endpoint": "https://auth.example.com/introspect",
+										"publish_field": "mercure_publish",
+										"subscribe_field": "mercure_subscribe"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptResumeGracePeriodConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	anonymous
+	resume_grace_period 30s
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"anonymous": true,
+									"handler": "mercure",
+									"resume_grace_period": 30000000000
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptBroadcastScriptConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	anonymous
+	broadcast_script {
+		topic https://example.com/users/{user}/notifications https://example.com/announcements
+		token_url /mercure-token
+		channel app
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"anonymous": true,
+									"broadcast_script": {
+										"channel": "app",
+										"token_url": "/mercure-token",
+										"topics": [
+											"https://example.com/users/{user}/notifications",
+											"https://example.com/announcements"
+										]
+									},
+									"handler": "mercure"
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptProfileConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	profile embedded
+	subscriber_shards 2
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"profile": "embedded",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"subscriber_shards": 2
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptRetentionExemptionsConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	retention_exemptions {
+		exempt https://example.com/audit
+		exempt_urlpattern https://example.com/invoices/:id
+		forbidden https://example.com/presence
+		forbidden_urlpattern https://example.com/users/:id/location
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"retention_exemptions": {
+										"exempt": [
+											"https://example.com/audit"
+										],
+										"exempt_urlpattern": [
+											"https://example.com/invoices/:id"
+										],
+										"forbidden": [
+											"https://example.com/presence"
+										],
+										"forbidden_urlpattern": [
+											"https://example.com/users/:id/location"
+										]
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptIdleTopicsConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	idle_topics 1h {
+		collect
+		max_topics 1000
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"idle_topics": {
+										"collect": true,
+										"max_topics": 1000,
+										"ttl": 3600000000000
+									},
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptTopicMatcherPersistenceConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	topic_matcher_persistence /var/lib/mercure/matchers.json {
+		max_matchers 500
+		interval 5m
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"topic_matcher_persistence": {
+										"interval": 300000000000,
+										"max_matchers": 500,
+										"path": "/var/lib/mercure/matchers.json"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptHealthTopicConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	health_topic 30s {
+		node node-1
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"health_topic": {
+										"interval": 30000000000,
+										"node": "node-1"
+									},
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptSelfCheckConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	self_check {
+		topic https://example.com/self-check
+		publisher_token {env.PUBLISHER_TOKEN}
+		subscriber_token {env.SUBSCRIBER_TOKEN}
+		timeout 10s
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"self_check": {
+										"publisher_token": "{env.PUBLISHER_TOKEN}",
+										"subscriber_token": "{env.SUBSCRIBER_TOKEN}",
+										"timeout": 10000000000,
+										"topic": "https://example.com/self-check"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptTopicCardinalityConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	topic_cardinality {
+		max_topics 100000
+		max_topics_per_publisher 1000
+		window 10m
+		log_only
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"topic_cardinality": {
+										"log_only": true,
+										"max_topics": 100000,
+										"max_topics_per_publisher": 1000,
+										"window": 600000000000
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptTenancyConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	tenancy {
+		window 10m
+		tenant acme {
+			issuer https://acme.example.com https://auth.acme.example.com
+			max_connections 1000
+			max_topics 10000
+			max_history_bytes 10MB
+			publish_rate 2.5
+			publish_burst 10
+		}
+		tenant globex {
+			issuer https://globex.example.com
+			max_connections 10
+		}
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"tenancy": {
+										"tenants": [
+											{
+												"issuers": [
+													"https://acme.example.com",
+													"https://auth.acme.example.com"
+												],
+												"max_connections": 1000,
+												"max_history_bytes": 10000000,
+												"max_topics": 10000,
+												"name": "acme",
+												"publish_burst": 10,
+												"publish_rate": 2.5
+											},
+											{
+												"issuers": [
+													"https://globex.example.com"
+												],
+												"max_connections": 10,
+												"name": "globex"
+											}
+										],
+										"window": 600000000000
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptDeadLettersConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	dead_letters {
+		size 500
+		store bolt
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"dead_letters": {
+										"size": 500,
+										"store": "bolt"
+									},
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptConditionalPublishingConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	conditional_publishing 1000
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"conditional_publishing": true,
+									"conditional_publishing_max_topics": 1000,
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptDeliveryReceiptsConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	delivery_receipts
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"delivery_receipts": true,
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptRegexpTopicMatchersConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	regexp_topic_matchers
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"regexp_topic_matchers": true
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptTopicSequencesConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	topic_sequences
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"topic_sequences": true
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptQueryTokensConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	subscriber_jwt !ChangeMe!
+	query_tokens 1m
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"query_token_max_lifetime": 60000000000,
+									"query_tokens": true,
+									"subscriber_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptIdempotentPublishingConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	idempotent_publishing 1h
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"idempotency_window": 3600000000000,
+									"idempotent_publishing": true,
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptLameDuckConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	lame_duck https://hub-2.example.com {
+		retry_after 10s
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"lame_duck": {
+										"peer_url": "https://hub-2.example.com",
+										"retry_after": 10000000000
+									},
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptDiscoveryConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	hub_link https://hub.example.com/.well-known/mercure hub
+	discovery
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"discovery": true,
+									"handler": "mercure",
+									"hub_link": {
+										"rels": [
+											"hub"
+										],
+										"url": "https://hub.example.com/.well-known/mercure"
+									},
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptLongPollingConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	anonymous
+	long_polling 20s
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"anonymous": true,
+									"handler": "mercure",
+									"long_polling": true,
+									"long_polling_timeout": 20000000000
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptWebSocketPublishingConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	subscriber_jwt !ChangeMe!
+	websocket publish
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"subscriber_jwt": {
+										"key": "!ChangeMe!"
+									},
+									"websocket": true,
+									"websocket_publishing": true
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptGRPCConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	grpc localhost:9090
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"grpc": "localhost:9090",
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+// TestGRPC checks that an update can be published through the gRPC API.
+func TestGRPC(t *testing.T) {
+	tester := caddytest.NewTester(t)
+	tester.InitServer(`{
+	skip_install_trust
+	admin localhost:2999
+	http_port     9080
+	https_port    9443
+}
+
+localhost:9080 {
+	route {
+		mercure {
+			anonymous
+			issuer https://example.com {
+				publisher {
+					jwt !ChangeMe!
+				}
+			}
+			resource_identifier https://example.com/.well-known/mercure
+			transport local
+			grpc localhost:9091
+		}
+
+		respond 404
+	}
+}`, "caddyfile")
+
+	conn, err := grpc.NewClient("localhost:9091", grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+
+	defer conn.Close()
+
+	ctx := metadata.AppendToOutgoingContext(t.Context(), "authorization", bearerPrefix+publisherJWT)
+
+	resp, err := mercurepb.NewHubClient(conn).Publish(ctx, &mercurepb.PublishRequest{Id: "a", Topic: "https://example.com/foo/1", Data: "bar"})
+	require.NoError(t, err)
+	assert.Equal(t, "a", resp.GetId())
+}
+
+func TestSubscriptionApproval(t *testing.T) {
+	m := &Mercure{SubscriptionApproval: &SubscriptionApprovalConfig{
+		Match:    []string{"https://example.com/rooms/1"},
+		Approver: &PublishHookConfig{Type: "http", URL: "https://example.com/moderation"},
+		Timeout:  caddy.Duration(time.Minute),
+	}}
+
+	a, err := m.subscriptionApproval()
+	require.NoError(t, err)
+	assert.Equal(t, []mercure.TopicMatcher{{Type: mercure.MatcherTypeExact, Pattern: "https://example.com/rooms/1"}}, a.Matchers)
+	assert.IsType(t, &mercure.HTTPPublishHookTarget{}, a.Target)
+	assert.Equal(t, time.Minute, a.Timeout)
+
+	m.SubscriptionApproval.Approver.Type = "foo"
+	_, err = m.subscriptionApproval()
+	require.ErrorIs(t, err, errUnknownPublishHookType)
+}
+
+func TestAdaptFederationConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	publisher_jwt !ChangeMe!
+	federation {
+		client_ca /etc/mercure/peers-ca.pem
+		peer eu.example.com {
+			match_urlpattern https://eu.example.com/*
+		}
+	}
+	federate https://eu.example.com/.well-known/mercure {
+		name us.example.com
+		audience https://eu.example.com
+		certificate /etc/mercure/us.pem /etc/mercure/us-key.pem
+		match_urlpattern https://us.example.com/*
+		private
+		manifest_ttl 30m
+		region_affinity_urlpattern https://us.example.com/stores/*
+		interest_filtering
+		interest_interval 5s
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"federate": [
+										{
+											"audience": "https://eu.example.com",
+											"certificate": "/etc/mercure/us.pem",
+											"interest_filtering": true,
+											"interest_interval": 5000000000,
+											"key": "/etc/mercure/us-key.pem",
+											"manifest_ttl": 1800000000000,
+											"match_urlpattern": [
+												"https://us.example.com/*"
+											],
+											"name": "us.example.com",
+											"private": true,
+											"region_affinity_urlpattern": [
+												"https://us.example.com/stores/*"
+											],
+											"url": "https://eu.example.com/.well-known/mercure"
+										}
+									],
+									"federation": {
+										"client_ca": [
+											"/etc/mercure/peers-ca.pem"
+										],
+										"peers": [
+											{
+												"match_urlpattern": [
+													"https://eu.example.com/*"
+												],
+												"name": "eu.example.com"
+											}
+										]
+									},
+									"handler": "mercure",
+									"publisher_jwt": {
+										"key": "!ChangeMe!"
+									}
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+// writeTestCertificate writes a self-signed client certificate and its key
+// as PEM files.
+func writeTestCertificate(t *testing.T, name string) (certFile, keyFile string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		DNSNames:              []string{name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile = filepath.Join(dir, "cert.pem")
+	keyFile = filepath.Join(dir, "key.pem")
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certFile, keyFile
+}
+
+func TestFederation(t *testing.T) {
+	certFile, keyFile := writeTestCertificate(t, "us.example.com")
+
+	m := &Mercure{
+		Federation: &FederationConfig{
+			ClientCA: []string{certFile},
+			Peers:    []FederationPeerConfig{{Name: "eu.example.com", MatchURLPattern: []string{"https://eu.example.com/*"}}},
+		},
+		Federate: []FederateConfig{{
+			URL:                      "https://eu.example.com/.well-known/mercure",
+			Name:                     "us.example.com",
+			Certificate:              certFile,
+			Key:                      keyFile,
+			CA:                       certFile,
+			MatchURLPattern:          []string{"https://us.example.com/*"},
+			RegionAffinityURLPattern: []string{"https://us.example.com/stores/{id}"},
+		}},
+	}
+
+	f, err := m.federation()
+	require.NoError(t, err)
+	assert.NotNil(t, f.ClientCAs)
+	assert.Equal(t, []mercure.FederationPeer{{Name: "eu.example.com", Matchers: []mercure.TopicMatcher{{Type: mercure.MatcherTypeURLPattern, Pattern: "https://eu.example.com/*"}}}}, f.Peers)
+
+	hooks, err := m.federationHooks()
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	assert.IsType(t, &mercure.FederationPublishHookTarget{}, hooks[0].Target)
+	assert.Equal(t, []mercure.TopicMatcher{{Type: mercure.MatcherTypeURLPattern, Pattern: "https://us.example.com/*"}}, hooks[0].Matchers)
+
+	m.Federate[0].RegionAffinityURLPattern = []string{"https://us.example.com/{"}
+	_, err = m.federationHooks()
+	require.ErrorIs(t, err, mercure.ErrInvalidPublishHook)
+
+	m.Federation.ClientCA = []string{keyFile}
+	_, err = m.federation()
+	require.ErrorIs(t, err, errInvalidCA)
+}
+
+func TestServerlessPublishHooks(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("PUBSUB_EMULATOR_HOST", "localhost:8085")
+
+	m := &Mercure{PublishHooks: []PublishHookConfig{
+		{Type: "lambda", URL: "arn:aws:lambda:eu-west-3:123456789012:function:foo"},
+		{Type: "sns", URL: "arn:aws:sns:eu-west-3:123456789012:updates"},
+		{Type: "pubsub", URL: "projects/my-project/topics/updates"},
+	}}
+
+	hooks, err := m.publishHooks()
+	require.NoError(t, err)
+	require.Len(t, hooks, 3)
+	assert.IsType(t, &mercure.LambdaPublishHookTarget{}, hooks[0].Target)
+	assert.IsType(t, &mercure.SNSPublishHookTarget{}, hooks[1].Target)
+	assert.IsType(t, &mercure.PubSubPublishHookTarget{}, hooks[2].Target)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+
+	_, err = (&Mercure{PublishHooks: []PublishHookConfig{{Type: "lambda", URL: "foo"}}}).publishHooks()
+	require.ErrorIs(t, err, mercure.ErrInvalidPublishHook)
+}
+
+func TestNewJWKSetKeyfunc(t *testing.T) {
+	jwksPath, err := filepath.Abs("testdata/RS256.jwks.json")
+	require.NoError(t, err)
+
+	t.Run("file URL with empty host", func(t *testing.T) {
+		k, err := newJWKSetKeyfunc(t.Context(), "file://"+jwksPath, keyfunc.Override{})
+		require.NoError(t, err)
+		assert.NotNil(t, k)
+	})
+
+	t.Run("file URL with localhost host", func(t *testing.T) {
+		k, err := newJWKSetKeyfunc(t.Context(), "file://localhost"+jwksPath, keyfunc.Override{})
+		require.NoError(t, err)
+		assert.NotNil(t, k)
+	})
+
+	t.Run("file URL with rejected host", func(t *testing.T) {
+		_, err := newJWKSetKeyfunc(t.Context(), "file://example.com"+jwksPath, keyfunc.Override{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `"example.com"`)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := newJWKSetKeyfunc(t.Context(), "file://"+filepath.Join(t.TempDir(), "absent.json"), keyfunc.Override{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to read JWK Set file")
+	})
+
+	t.Run("invalid JWK Set JSON", func(t *testing.T) {
+		bad := filepath.Join(t.TempDir(), "bad.json")
+		require.NoError(t, os.WriteFile(bad, []byte("not json"), 0o600))
+
+		_, err := newJWKSetKeyfunc(t.Context(), "file://"+bad, keyfunc.Override{})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse JWK Set file")
+	})
+}
+
+// rsaJWKSet returns the JWK Set of the public keys, by key ID.
+func rsaJWKSet(keys map[string]*rsa.PrivateKey) string {
+	jwks := make([]string, 0, len(keys))
+	for kid, k := range keys {
+		jwks = append(jwks, fmt.Sprintf(`{"kty":"RSA","kid":%q,"alg":"RS256","use":"sig","n":%q,"e":%q}`,
+			kid,
+			base64.RawURLEncoding.EncodeToString(k.N.Bytes()),
+			base64.RawURLEncoding.EncodeToString(big.NewInt(int64(k.E)).Bytes()),
+		))
+	}
+
+	return `{"keys":[` + strings.Join(jwks, ",") + `]}`
+}
+
+func TestJWKSetKeyRotation(t *testing.T) {
+	key1, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var (
+		mu   sync.Mutex
+		jwks = rsaJWKSet(map[string]*rsa.PrivateKey{"1": key1})
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, jwks)
+	}))
+	t.Cleanup(srv.Close)
+
+	m := &Mercure{logger: slog.New(slog.DiscardHandler)}
+	k, err := newJWKSetKeyfunc(t.Context(), srv.URL, m.jwksOverride(VerifierConfig{
+		JWKSURL:                       srv.URL,
+		JWKSUnknownKIDRefreshInterval: caddy.Duration(time.Millisecond),
+	}, "publisher"))
+	require.NoError(t, err)
+
+	sign := func(kid string, key *rsa.PrivateKey) string {
+		token := jwt.New(jwt.SigningMethodRS256)
+		token.Header["kid"] = kid
+
+		s, err := token.SignedString(key)
+		require.NoError(t, err)
+
+		return s
+	}
+
+	_, err = jwt.Parse(sign("1", key1), k.Keyfunc)
+	require.NoError(t, err)
+
+	// The issuer rotates its keys: the unknown key IDs trigger refreshes,
+	// which the default interval would limit to one every five minutes.
+	for _, kid := range []string{"2", "3"} {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		require.NoError(t, err)
+
+		mu.Lock()
+		jwks = rsaJWKSet(map[string]*rsa.PrivateKey{kid: key})
+		mu.Unlock()
+
+		time.Sleep(2 * time.Millisecond)
+
+		_, err = jwt.Parse(sign(kid, key), k.Keyfunc)
+		require.NoError(t, err)
+	}
+}
+
+func TestAdaptJWKSRefreshIntervalsConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	issuer https://example.com {
+		publisher {
+			jwks_uri https://example.com/jwks RS256
+			jwks_refresh_interval 10m
+			jwks_unknown_kid_refresh_interval 30s
+		}
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"issuers": [
+										{
+											"identifier": "https://example.com",
+											"publisher": {
+												"jwks_algorithms": [
+													"RS256"
+												],
+												"jwks_refresh_interval": 600000000000,
+												"jwks_unknown_kid_refresh_interval": 30000000000,
+												"jwks_uri": "https://example.com/jwks"
+											}
+										}
+									]
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
+}
+
+func TestAdaptIssuerAudiencesConfig(t *testing.T) {
+	caddytest.AssertAdapt(t, `http://
+
+mercure {
+	issuer https://idp.example.com {
+		audience mercure-app mercure-admin
+		claim_namespace https://mercure.example.com/
+		subscriber {
+			jwks_uri https://idp.example.com/jwks RS256
+		}
+	}
+}
+`, "caddyfile", `{
+	"apps": {
+		"http": {
+			"servers": {
+				"srv0": {
+					"listen": [
+						":80"
+					],
+					"routes": [
+						{
+							"handle": [
+								{
+									"handler": "mercure",
+									"issuers": [
+										{
+											"audiences": [
+												"mercure-app",
+												"mercure-admin"
+											],
+											"claim_namespace": "https://mercure.example.com/",
+											"identifier": "https://idp.example.com",
+											"subscriber": {
+												"jwks_algorithms": [
+													"RS256"
+												],
+												"jwks_uri": "https://idp.example.com/jwks"
+											}
+										}
+									]
+								}
+							]
+						}
+					]
+				}
+			}
+		}
+	}
+}`)
 }
 
 // TestMultiIssuerPublish exercises per-issuer key binding through the Caddy
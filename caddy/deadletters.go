@@ -0,0 +1,196 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/dunglas/mercure"
+)
+
+var errNoDeadLetterIDs = errors.New("no dead letter IDs")
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&DeadLetters{})
+}
+
+// DeadLetters is a Caddy admin API module inspecting, re-delivering and
+// discarding the updates dropped for slow subscribers.
+type DeadLetters struct{}
+
+// CaddyModule returns the Caddy module information.
+func (*DeadLetters) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.mercure_dead_letters",
+		New: func() caddy.Module { return new(DeadLetters) },
+	}
+}
+
+// Routes returns the admin routes for the dead letters module.
+func (d *DeadLetters) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/mercure/dead-letters",
+			Handler: caddy.AdminHandlerFunc(d.handleDeadLetters),
+		},
+		{
+			Pattern: "/mercure/dead-letters/",
+			Handler: caddy.AdminHandlerFunc(d.handleDeadLetters),
+		},
+	}
+}
+
+type deadLettersRequest struct {
+	IDs []string `json:"ids"`
+}
+
+type namedDeadLetter struct {
+	*mercure.DeadLetter
+
+	Hub string `json:"hub"`
+}
+
+type redeliverResponse struct {
+	Redelivered map[string]int `json:"redelivered"`
+}
+
+// handleDeadLetters lists (GET), re-delivers (POST) or discards (DELETE) the
+// dead letters of all the hubs, or of the hub named in the path.
+func (d *DeadLetters) handleDeadLetters(w http.ResponseWriter, r *http.Request) error {
+	var (
+		req   deadLettersRequest
+		limit int
+	)
+
+	switch r.Method {
+	case http.MethodGet:
+		if l := r.URL.Query().Get("limit"); l != "" {
+			var err error
+			if limit, err = strconv.Atoi(l); err != nil || limit < 0 {
+				return caddy.APIError{
+					HTTPStatus: http.StatusBadRequest,
+					Err:        fmt.Errorf("invalid limit %q", l), //nolint:err113
+				}
+			}
+		}
+
+	case http.MethodPost, http.MethodDelete:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        fmt.Errorf("invalid dead letter IDs: %w", err),
+			}
+		}
+
+		if len(req.IDs) == 0 {
+			return caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        errNoDeadLetterIDs,
+			}
+		}
+
+	default:
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        errMethodNotAllowed,
+		}
+	}
+
+	hubName := strings.Trim(strings.TrimPrefix(r.URL.Path, "/mercure/dead-letters"), "/")
+
+	var (
+		letters     = []namedDeadLetter{}
+		redelivered = make(map[string]int, len(req.IDs))
+		matched     bool
+	)
+
+	for _, info := range snapshotHubs() {
+		if hubName != "" && info.name != hubName {
+			continue
+		}
+
+		matched = true
+
+		err := d.handleHub(r, info, &req, limit, &letters, redelivered)
+		switch {
+		case errors.Is(err, mercure.ErrDeadLettersNotEnabled):
+			continue
+		case errors.Is(err, mercure.ErrDeadLetterNotRedeliverable), errors.Is(err, mercure.ErrRedeliveryNotSupported):
+			return caddy.APIError{
+				HTTPStatus: http.StatusUnprocessableEntity,
+				Err:        fmt.Errorf("hub %q: %w", info.name, err),
+			}
+		case err != nil:
+			return caddy.APIError{
+				HTTPStatus: http.StatusInternalServerError,
+				Err:        fmt.Errorf("hub %q: %w", info.name, err),
+			}
+		}
+	}
+
+	if hubName != "" && !matched {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("%w: %q", errHubNotFound, hubName),
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+
+		return json.NewEncoder(w).Encode(letters) //nolint:wrapcheck
+	case http.MethodPost:
+		w.Header().Set("Content-Type", "application/json")
+
+		return json.NewEncoder(w).Encode(redeliverResponse{Redelivered: redelivered}) //nolint:wrapcheck
+	default:
+		w.WriteHeader(http.StatusNoContent)
+
+		return nil
+	}
+}
+
+// handleHub applies the request to a hub. As the IDs are unique, the dead
+// letters not found in a hub are looked for in the others.
+func (*DeadLetters) handleHub(r *http.Request, info *hubInfo, req *deadLettersRequest, limit int, letters *[]namedDeadLetter, redelivered map[string]int) error {
+	ctx := r.Context()
+
+	if r.Method == http.MethodGet {
+		dls, err := info.hub.DeadLetters(ctx, limit)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		for _, dl := range dls {
+			*letters = append(*letters, namedDeadLetter{DeadLetter: dl, Hub: info.name})
+		}
+
+		return nil
+	}
+
+	for _, id := range req.IDs {
+		var err error
+		if r.Method == http.MethodPost {
+			var n int
+			if n, err = info.hub.RedeliverDeadLetter(ctx, id); err == nil {
+				redelivered[id] += n
+			}
+		} else {
+			err = info.hub.DiscardDeadLetter(ctx, id)
+		}
+
+		if err != nil && !errors.Is(err, mercure.ErrDeadLetterNotFound) {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return nil
+}
+
+// Interface guards.
+var _ caddy.AdminRouter = (*DeadLetters)(nil)
@@ -0,0 +1,118 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/dunglas/mercure"
+)
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&Disconnect{})
+}
+
+// Disconnect is a Caddy admin API module disconnecting subscribers in bulk.
+type Disconnect struct{}
+
+// CaddyModule returns the Caddy module information.
+func (*Disconnect) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.mercure_disconnect",
+		New: func() caddy.Module { return new(Disconnect) },
+	}
+}
+
+// Routes returns the admin routes for the disconnect module.
+func (d *Disconnect) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/mercure/disconnect",
+			Handler: caddy.AdminHandlerFunc(d.handleDisconnect),
+		},
+		{
+			Pattern: "/mercure/disconnect/",
+			Handler: caddy.AdminHandlerFunc(d.handleDisconnect),
+		},
+	}
+}
+
+type disconnectRequest struct {
+	mercure.SubscriberSelector
+
+	DryRun bool `json:"dry_run,omitempty"`
+}
+
+type disconnectResponse struct {
+	Disconnected int  `json:"disconnected"`
+	DryRun       bool `json:"dry_run"`
+}
+
+// handleDisconnect disconnects the subscribers matching the selector in the
+// JSON body, from all the hubs, or from the hub named in the path.
+func (d *Disconnect) handleDisconnect(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        errMethodNotAllowed,
+		}
+	}
+
+	hubName := strings.Trim(strings.TrimPrefix(r.URL.Path, "/mercure/disconnect"), "/")
+
+	var req disconnectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("invalid selector: %w", err),
+		}
+	}
+
+	var (
+		total   int
+		matched bool
+	)
+
+	for _, info := range snapshotHubs() {
+		if hubName != "" && info.name != hubName {
+			continue
+		}
+
+		matched = true
+
+		n, err := info.hub.DisconnectSubscribers(r.Context(), &req.SubscriberSelector, req.DryRun)
+		switch {
+		case errors.Is(err, mercure.ErrEmptySubscriberSelector):
+			return caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        err,
+			}
+		case errors.Is(err, mercure.ErrDisconnectNotSupported):
+			continue
+		case err != nil:
+			return caddy.APIError{
+				HTTPStatus: http.StatusInternalServerError,
+				Err:        fmt.Errorf("hub %q: %w", info.name, err),
+			}
+		}
+
+		total += n
+	}
+
+	if hubName != "" && !matched {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("%w: %q", errHubNotFound, hubName),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	return json.NewEncoder(w).Encode(disconnectResponse{Disconnected: total, DryRun: req.DryRun}) //nolint:wrapcheck
+}
+
+// Interface guards.
+var _ caddy.AdminRouter = (*Disconnect)(nil)
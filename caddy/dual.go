@@ -0,0 +1,200 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/dunglas/mercure"
+)
+
+var errMissingDualTransport = errors.New("the old and new transports of the dual transport are required")
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&Dual{})
+}
+
+// Dual writes the updates to an old and a new transport during a migration,
+// and serves reads from the old one until Cutover is set.
+type Dual struct {
+	// The transport migrated from.
+	OldRaw json.RawMessage `json:"old,omitempty" caddy:"namespace=http.handlers.mercure inline_key=name"` //nolint:tagalign
+
+	// The transport migrated to.
+	NewRaw json.RawMessage `json:"new,omitempty" caddy:"namespace=http.handlers.mercure inline_key=name"` //nolint:tagalign
+
+	// Serve subscribers and history from the new transport.
+	Cutover bool `json:"cutover,omitempty"`
+
+	// Number of retries when the transport not serving reads fails to store
+	// updates.
+	Retries int `json:"retries,omitempty"`
+
+	// Delay before the first retry, doubled after each attempt. Defaults to
+	// 100ms.
+	RetryDelay caddy.Duration `json:"retry_delay,omitempty"`
+
+	// What to do when the retries failed: ignore (the default), rollback or
+	// dead_letter.
+	OnPartialFailure string `json:"on_partial_failure,omitempty"`
+
+	// The target receiving the updates when OnPartialFailure is dead_letter.
+	DeadLetter *PublishHookConfig `json:"dead_letter,omitempty"`
+
+	transport  *mercure.DualTransport
+	deadLetter mercure.PublishHookTarget
+}
+
+// CaddyModule returns the Caddy module information.
+func (*Dual) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "http.handlers.mercure.dual",
+		New: func() caddy.Module { return new(Dual) },
+	}
+}
+
+func (d *Dual) GetTransport() mercure.Transport { //nolint:ireturn
+	return d.transport
+}
+
+// Provision provisions d's configuration. The old and new transports are
+// modules of their own, closed on cleanup by their usage pool.
+//
+//nolint:wrapcheck
+func (d *Dual) Provision(ctx caddy.Context) error {
+	if d.OldRaw == nil || d.NewRaw == nil {
+		return errMissingDualTransport
+	}
+
+	old, err := ctx.LoadModule(d, "OldRaw")
+	if err != nil {
+		return err
+	}
+
+	n, err := ctx.LoadModule(d, "NewRaw")
+	if err != nil {
+		return err
+	}
+
+	d.transport = mercure.NewDualTransport(old.(Transport).GetTransport(), n.(Transport).GetTransport(), ctx.Slogger(), d.Cutover)
+
+	if d.DeadLetter != nil {
+		repl := caddy.NewReplacer()
+		c := *d.DeadLetter
+		c.URL = repl.ReplaceKnown(c.URL, "")
+		c.Header = replaceHeaderPlaceholders(repl, c.Header)
+
+		if d.deadLetter, err = newPublishHookTarget(c); err != nil {
+			return err
+		}
+	}
+
+	return d.transport.SetPartialDispatchPolicy(mercure.PartialDispatchPolicy{
+		Retries:    d.Retries,
+		RetryDelay: time.Duration(d.RetryDelay),
+		Action:     mercure.PartialDispatchAction(d.OnPartialFailure),
+		DeadLetter: d.deadLetter,
+	})
+}
+
+// Cleanup closes the dead-letter target, if any.
+//
+//nolint:wrapcheck
+func (d *Dual) Cleanup() error {
+	if c, ok := d.deadLetter.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// UnmarshalCaddyfile sets up the handler from Caddyfile tokens.
+//
+//nolint:wrapcheck
+func (d *Dual) UnmarshalCaddyfile(disp *caddyfile.Dispenser) error {
+	for disp.Next() {
+		for disp.NextBlock(0) {
+			switch v := disp.Val(); v {
+			case "old", "new":
+				if !disp.NextArg() {
+					return disp.ArgErr()
+				}
+
+				name := disp.Val()
+				modID := "http.handlers.mercure." + name
+
+				unm, err := caddyfile.UnmarshalModule(disp, modID)
+				if err != nil {
+					return err
+				}
+
+				t, ok := unm.(Transport)
+				if !ok {
+					return disp.Errf(`module %s (%T) is not a supported transport implementation (requires "github.com/dunglas/mercure/caddy".Transport)`, modID, unm)
+				}
+
+				raw := caddyconfig.JSONModuleObject(t, "name", name, nil)
+				if v == "old" {
+					d.OldRaw = raw
+				} else {
+					d.NewRaw = raw
+				}
+
+			case "cutover":
+				d.Cutover = true
+
+			case "retries":
+				args := disp.RemainingArgs()
+				if len(args) < 1 || len(args) > 2 {
+					return disp.ArgErr()
+				}
+
+				retries, err := strconv.Atoi(args[0])
+				if err != nil {
+					return disp.Errf("invalid retries %q: %v", args[0], err)
+				}
+
+				d.Retries = retries
+
+				if len(args) == 2 {
+					delay, err := caddy.ParseDuration(args[1])
+					if err != nil {
+						return disp.Errf("invalid retry delay %q: %v", args[1], err)
+					}
+
+					d.RetryDelay = caddy.Duration(delay)
+				}
+
+			case "on_partial_failure":
+				if !disp.NextArg() {
+					return disp.ArgErr()
+				}
+
+				d.OnPartialFailure = disp.Val()
+				if d.OnPartialFailure == string(mercure.PartialDispatchDeadLetter) {
+					c, err := parsePublishHookBlock(disp)
+					if err != nil {
+						return err
+					}
+
+					d.DeadLetter = &c
+				} else if disp.NextArg() {
+					return disp.ArgErr()
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+var (
+	_ caddy.Provisioner     = (*Dual)(nil)
+	_ caddy.CleanerUpper    = (*Dual)(nil)
+	_ caddyfile.Unmarshaler = (*Dual)(nil)
+)
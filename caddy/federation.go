@@ -0,0 +1,300 @@
+package caddy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/caddyserver/caddy/v2/caddyconfig/caddyfile"
+	"github.com/dunglas/mercure"
+)
+
+var errInvalidCA = errors.New("no certificate found in CA file")
+
+// FederationConfig lets other hubs publish into some topic spaces of the hub.
+type FederationConfig struct {
+	// PEM files of the CAs verifying the client certificates of the peers.
+	ClientCA []string `json:"client_ca,omitempty"`
+
+	// Hubs allowed to publish.
+	Peers []FederationPeerConfig `json:"peers,omitempty"`
+}
+
+// FederationPeerConfig is a hub allowed to publish into some topic spaces of
+// the hub.
+type FederationPeerConfig struct {
+	// DNS name the client certificate of the peer must be valid for.
+	Name string `json:"name,omitempty"`
+
+	// Exact topic matchers of the topic spaces the peer may publish into.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers of the topic spaces the peer may publish
+	// into.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+}
+
+// FederateConfig publishes the updates of some topics to a peer hub.
+type FederateConfig struct {
+	// URL of the peer hub.
+	URL string `json:"url,omitempty"`
+
+	// Name of the hub in the federation, its client certificate must be
+	// valid for.
+	Name string `json:"name,omitempty"`
+
+	// Resource identifier of the peer hub, if it has one.
+	Audience string `json:"audience,omitempty"`
+
+	// PEM files of the client certificate and of its private key.
+	Certificate string `json:"certificate,omitempty"`
+	Key         string `json:"key,omitempty"`
+
+	// PEM file of the CAs verifying the certificate of the peer hub,
+	// defaults to the system roots.
+	CA string `json:"ca,omitempty"`
+
+	// Exact topic matchers of the updates to publish, claimed by the
+	// manifests.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers of the updates to publish, claimed by the
+	// manifests.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+
+	// Also publish the private updates.
+	Private bool `json:"private,omitempty"`
+
+	// Lifetime of the manifests.
+	ManifestTTL caddy.Duration `json:"manifest_ttl,omitempty"`
+
+	// Exact topic matchers of the topics with region affinity, only
+	// published while the peer hub has subscribers for them.
+	RegionAffinity []string `json:"region_affinity,omitempty"`
+
+	// URL Pattern topic matchers of the topics with region affinity.
+	RegionAffinityURLPattern []string `json:"region_affinity_urlpattern,omitempty"`
+
+	// Only publish the updates of all the topics while the peer hub has
+	// subscribers for them.
+	InterestFiltering bool `json:"interest_filtering,omitempty"`
+
+	// How often the digest of the topic selectors of the subscribers of the
+	// peer hub is fetched.
+	InterestInterval caddy.Duration `json:"interest_interval,omitempty"`
+}
+
+func loadCertPool(files ...string) (*x509.CertPool, error) {
+	pool := x509.NewCertPool()
+
+	for _, f := range files {
+		pem, err := os.ReadFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA file: %w", err)
+		}
+
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: %q", errInvalidCA, f)
+		}
+	}
+
+	return pool, nil
+}
+
+func topicMatchers(match, matchURLPattern []string) []mercure.TopicMatcher {
+	matchers := make([]mercure.TopicMatcher, 0, len(match)+len(matchURLPattern))
+	for _, p := range match {
+		matchers = append(matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+	}
+
+	for _, p := range matchURLPattern {
+		matchers = append(matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+	}
+
+	return matchers
+}
+
+// federation creates the configured federation.
+func (m *Mercure) federation() (mercure.Federation, error) {
+	var (
+		f   mercure.Federation
+		err error
+	)
+
+	if f.ClientCAs, err = loadCertPool(m.Federation.ClientCA...); err != nil {
+		return f, err
+	}
+
+	for _, p := range m.Federation.Peers {
+		f.Peers = append(f.Peers, mercure.FederationPeer{Name: p.Name, Matchers: topicMatchers(p.Match, p.MatchURLPattern)})
+	}
+
+	return f, nil
+}
+
+// federationHooks creates the publish hooks publishing to the peer hubs.
+func (m *Mercure) federationHooks() ([]mercure.PublishHook, error) {
+	repl := caddy.NewReplacer()
+	hooks := make([]mercure.PublishHook, 0, len(m.Federate))
+
+	for _, c := range m.Federate {
+		cert, err := tls.LoadX509KeyPair(repl.ReplaceKnown(c.Certificate, ""), repl.ReplaceKnown(c.Key, ""))
+		if err != nil {
+			return nil, fmt.Errorf("unable to load the federation certificate: %w", err)
+		}
+
+		fc := mercure.FederationPublishHookConfig{
+			Name:              c.Name,
+			Audience:          c.Audience,
+			Certificate:       cert,
+			Matchers:          topicMatchers(c.Match, c.MatchURLPattern),
+			ManifestTTL:       time.Duration(c.ManifestTTL),
+			RegionAffinity:    topicMatchers(c.RegionAffinity, c.RegionAffinityURLPattern),
+			InterestFiltering: c.InterestFiltering,
+			InterestInterval:  time.Duration(c.InterestInterval),
+		}
+
+		if c.CA != "" {
+			if fc.RootCAs, err = loadCertPool(repl.ReplaceKnown(c.CA, "")); err != nil {
+				return nil, err
+			}
+		}
+
+		target, err := mercure.NewFederationPublishHookTarget(repl.ReplaceKnown(c.URL, ""), fc)
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		hooks = append(hooks, mercure.PublishHook{Matchers: fc.Matchers, Private: c.Private, Target: target})
+	}
+
+	return hooks, nil
+}
+
+// parseFederationBlock parses a "federation { ... }" Caddyfile block.
+func parseFederationBlock(d *caddyfile.Dispenser) (*FederationConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	f := &FederationConfig{}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "client_ca":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			f.ClientCA = append(f.ClientCA, args...)
+
+		case "peer":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			p := FederationPeerConfig{Name: d.Val()}
+
+			for d.NextBlock(2) {
+				switch d.Val() {
+				case "match":
+					p.Match = append(p.Match, d.RemainingArgs()...)
+
+				case "match_urlpattern":
+					p.MatchURLPattern = append(p.MatchURLPattern, d.RemainingArgs()...)
+
+				default:
+					return nil, d.Errf("unknown federation peer directive %q", d.Val()) //nolint:wrapcheck
+				}
+			}
+
+			f.Peers = append(f.Peers, p)
+
+		default:
+			return nil, d.Errf("unknown federation directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return f, nil
+}
+
+// parseFederateBlock parses a "federate <url> { ... }" Caddyfile block.
+func parseFederateBlock(d *caddyfile.Dispenser) (FederateConfig, error) {
+	var fc FederateConfig
+
+	if !d.NextArg() {
+		return fc, d.ArgErr() //nolint:wrapcheck
+	}
+
+	fc.URL = d.Val()
+
+	if d.NextArg() {
+		return fc, d.ArgErr() //nolint:wrapcheck
+	}
+
+	for d.NextBlock(1) {
+		switch v := d.Val(); v {
+		case "name", "audience", "ca":
+			if !d.NextArg() {
+				return fc, d.ArgErr() //nolint:wrapcheck
+			}
+
+			switch v {
+			case "name":
+				fc.Name = d.Val()
+			case "audience":
+				fc.Audience = d.Val()
+			default:
+				fc.CA = d.Val()
+			}
+
+		case "certificate":
+			args := d.RemainingArgs()
+			if len(args) != 2 {
+				return fc, d.ArgErr() //nolint:wrapcheck
+			}
+
+			fc.Certificate, fc.Key = args[0], args[1]
+
+		case "match":
+			fc.Match = append(fc.Match, d.RemainingArgs()...)
+
+		case "match_urlpattern":
+			fc.MatchURLPattern = append(fc.MatchURLPattern, d.RemainingArgs()...)
+
+		case "private":
+			fc.Private = true
+
+		case "interest_filtering":
+			fc.InterestFiltering = true
+
+		case "region_affinity":
+			fc.RegionAffinity = append(fc.RegionAffinity, d.RemainingArgs()...)
+
+		case "region_affinity_urlpattern":
+			fc.RegionAffinityURLPattern = append(fc.RegionAffinityURLPattern, d.RemainingArgs()...)
+
+		case "manifest_ttl", "interest_interval":
+			du, err := parseDurationParameter(d)
+			if err != nil {
+				return fc, err
+			}
+
+			if v == "manifest_ttl" {
+				fc.ManifestTTL = *du
+			} else {
+				fc.InterestInterval = *du
+			}
+
+		default:
+			return fc, d.Errf("unknown federate directive %q", v) //nolint:wrapcheck
+		}
+	}
+
+	return fc, nil
+}
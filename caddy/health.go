@@ -116,7 +116,7 @@ func parseHealthPath(urlPath string) (checkType, hubName string, err error) {
 }
 
 func (h *Health) checkTransports(r *http.Request, checkType, hubName string) error {
-	infos := h.snapshotHubs()
+	infos := snapshotHubs()
 
 	var matched bool
 
@@ -127,6 +127,12 @@ func (h *Health) checkTransports(r *http.Request, checkType, hubName string) err
 
 		matched = true
 
+		if checkType == checkReady {
+			if err := info.hub.SelfCheckResult(); err != nil {
+				return fmt.Errorf("hub %q: %w", info.name, err)
+			}
+		}
+
 		checker, ok := info.transport.(mercure.TransportHealthChecker)
 		if !ok {
 			continue
@@ -151,7 +157,7 @@ func (h *Health) checkTransports(r *http.Request, checkType, hubName string) err
 	return nil
 }
 
-func (h *Health) snapshotHubs() []*hubInfo {
+func snapshotHubs() []*hubInfo {
 	hubsMu.Lock()
 	defer hubsMu.Unlock()
 
@@ -265,3 +265,47 @@ localhost:9080 {
 	resp := tester.AssertResponseCode(req, http.StatusNotFound)
 	require.NoError(t, resp.Body.Close())
 }
+
+func TestHealthEndpointSelfCheck(t *testing.T) {
+	tester := caddytest.NewTester(t)
+	tester.InitServer(`{
+	skip_install_trust
+	admin localhost:2999
+	http_port     9080
+	https_port    9443
+}
+
+localhost:9080 {
+	route {
+		mercure {
+			anonymous
+			issuer https://example.com {
+				publisher {
+					jwt !ChangeMe!
+				}
+			}
+			resource_identifier https://example.com/.well-known/mercure
+			transport local
+			self_check {
+				publisher_token invalid
+				timeout 10ms
+			}
+		}
+
+		respond 404
+	}
+}`, "caddyfile")
+
+	// The hub isn't ready while the self-check fails, but it is alive.
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:2999/mercure/health/ready", nil)
+	require.NoError(t, err)
+
+	resp := tester.AssertResponseCode(req, http.StatusServiceUnavailable)
+	require.NoError(t, resp.Body.Close())
+
+	req, err = http.NewRequest(http.MethodGet, "http://localhost:2999/mercure/health/live", nil)
+	require.NoError(t, err)
+
+	resp = tester.AssertResponseCode(req, http.StatusOK)
+	require.NoError(t, resp.Body.Close())
+}
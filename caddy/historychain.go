@@ -0,0 +1,101 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/dunglas/mercure"
+)
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&HistoryChain{})
+}
+
+// HistoryChain is a Caddy admin API module verifying the hash chain of the
+// history of the hubs.
+type HistoryChain struct{}
+
+// CaddyModule returns the Caddy module information.
+func (*HistoryChain) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.mercure_history_chain",
+		New: func() caddy.Module { return new(HistoryChain) },
+	}
+}
+
+// Routes returns the admin routes for the history chain module.
+func (h *HistoryChain) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/mercure/history-chain",
+			Handler: caddy.AdminHandlerFunc(h.handleHistoryChain),
+		},
+		{
+			Pattern: "/mercure/history-chain/",
+			Handler: caddy.AdminHandlerFunc(h.handleHistoryChain),
+		},
+	}
+}
+
+// handleHistoryChain verifies the history of all the hubs whose transport
+// supports it, or of the hub named in the path, and returns the reports by
+// hub name.
+func (*HistoryChain) handleHistoryChain(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodGet {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        errMethodNotAllowed,
+		}
+	}
+
+	hubName := strings.Trim(strings.TrimPrefix(r.URL.Path, "/mercure/history-chain"), "/")
+
+	var (
+		reports = make(map[string]*mercure.HistoryChainReport)
+		matched bool
+	)
+
+	for _, info := range snapshotHubs() {
+		if hubName != "" && info.name != hubName {
+			continue
+		}
+
+		matched = true
+
+		report, err := info.hub.VerifyHistoryChain(r.Context())
+		switch {
+		case errors.Is(err, mercure.ErrHistoryChainNotSupported):
+			continue
+		case errors.Is(err, mercure.ErrHistoryTampered):
+			return caddy.APIError{
+				HTTPStatus: http.StatusConflict,
+				Err:        fmt.Errorf("hub %q: %w", info.name, err),
+			}
+		case err != nil:
+			return caddy.APIError{
+				HTTPStatus: http.StatusInternalServerError,
+				Err:        fmt.Errorf("hub %q: %w", info.name, err),
+			}
+		}
+
+		reports[info.name] = report
+	}
+
+	if hubName != "" && !matched {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("%w: %q", errHubNotFound, hubName),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	return json.NewEncoder(w).Encode(reports) //nolint:wrapcheck
+}
+
+// Interface guards.
+var _ caddy.AdminRouter = (*HistoryChain)(nil)
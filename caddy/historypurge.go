@@ -0,0 +1,294 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/caddyserver/caddy/v2"
+	"github.com/dunglas/mercure"
+	"github.com/gofrs/uuid/v5"
+)
+
+var errNoHistoryPurger = errors.New("no hub supports purging the history")
+
+func init() { //nolint:gochecknoinits
+	caddy.RegisterModule(&HistoryPurge{})
+}
+
+// HistoryPurge is a Caddy admin API module purging the history of all the
+// hubs in two phases: the purge is prepared on every hub, then confirmed.
+type HistoryPurge struct{}
+
+// clusterHistoryPurge is a purge prepared on several hubs.
+type clusterHistoryPurge struct {
+	// purges holds the ID of the purge prepared on every hub, by hub name.
+	purges  map[string]string
+	expires time.Time
+}
+
+var (
+	clusterHistoryPurgesMu sync.Mutex
+	clusterHistoryPurges   = make(map[string]*clusterHistoryPurge) //nolint:gochecknoglobals
+)
+
+// CaddyModule returns the Caddy module information.
+func (*HistoryPurge) CaddyModule() caddy.ModuleInfo {
+	return caddy.ModuleInfo{
+		ID:  "admin.api.mercure_history_purge",
+		New: func() caddy.Module { return new(HistoryPurge) },
+	}
+}
+
+// Routes returns the admin routes for the history purge module.
+func (p *HistoryPurge) Routes() []caddy.AdminRoute {
+	return []caddy.AdminRoute{
+		{
+			Pattern: "/mercure/history-purge",
+			Handler: caddy.AdminHandlerFunc(p.handlePrepare),
+		},
+		{
+			Pattern: "/mercure/history-purge/",
+			Handler: caddy.AdminHandlerFunc(p.handlePrepare),
+		},
+		{
+			Pattern: "/mercure/history-purge-confirmation",
+			Handler: caddy.AdminHandlerFunc(p.handleConfirmation),
+		},
+	}
+}
+
+type historyPurgeRequest struct {
+	Match           []string  `json:"match,omitempty"`
+	MatchURLPattern []string  `json:"match_urlpattern,omitempty"`
+	Before          time.Time `json:"before,omitzero"`
+}
+
+func (req *historyPurgeRequest) selector() mercure.HistoryPurgeSelector {
+	sel := mercure.HistoryPurgeSelector{Before: req.Before}
+
+	for _, p := range req.Match {
+		sel.Matchers = append(sel.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+	}
+
+	for _, p := range req.MatchURLPattern {
+		sel.Matchers = append(sel.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+	}
+
+	return sel
+}
+
+type historyPurgeResponse struct {
+	ID      string         `json:"id"`
+	Updates int            `json:"updates"`
+	Hubs    map[string]int `json:"hubs"`
+	Expires time.Time      `json:"expires"`
+}
+
+type historyPurgeConfirmation struct {
+	ID string `json:"id"`
+}
+
+type historyPurgeConfirmationResponse struct {
+	Purged int            `json:"purged"`
+	Hubs   map[string]int `json:"hubs"`
+}
+
+// handlePrepare prepares the purge of the history of all the hubs supporting
+// it, or of the hub named in the path, with the selector in the JSON body. If
+// it can't be prepared on one of them, it is canceled on the others.
+func (*HistoryPurge) handlePrepare(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        errMethodNotAllowed,
+		}
+	}
+
+	hubName := strings.Trim(strings.TrimPrefix(r.URL.Path, "/mercure/history-purge"), "/")
+
+	var req historyPurgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("invalid selector: %w", err),
+		}
+	}
+
+	var (
+		resp = historyPurgeResponse{ID: "urn:uuid:" + uuid.Must(uuid.NewV4()).String(), Hubs: make(map[string]int)}
+		c    = &clusterHistoryPurge{purges: make(map[string]string)}
+
+		hubsByName = make(map[string]*mercure.Hub)
+		matched    bool
+	)
+
+	cancel := func() {
+		for name, id := range c.purges {
+			hubsByName[name].CancelHistoryPurge(id)
+		}
+	}
+
+	for _, info := range snapshotHubs() {
+		if hubName != "" && info.name != hubName {
+			continue
+		}
+
+		matched = true
+
+		p, err := info.hub.PrepareHistoryPurge(r.Context(), req.selector())
+		switch {
+		case errors.Is(err, mercure.ErrHistoryPurgeNotSupported):
+			continue
+		case errors.Is(err, mercure.ErrInvalidHistoryPurgeSelector):
+			cancel()
+
+			return caddy.APIError{
+				HTTPStatus: http.StatusBadRequest,
+				Err:        err,
+			}
+		case err != nil:
+			cancel()
+
+			return caddy.APIError{
+				HTTPStatus: http.StatusInternalServerError,
+				Err:        fmt.Errorf("hub %q: %w", info.name, err),
+			}
+		}
+
+		hubsByName[info.name] = info.hub
+		c.purges[info.name] = p.ID
+		resp.Hubs[info.name] = p.Updates
+		resp.Updates += p.Updates
+
+		if c.expires.IsZero() || p.Expires.Before(c.expires) {
+			c.expires = p.Expires
+		}
+	}
+
+	if hubName != "" && !matched {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        fmt.Errorf("%w: %q", errHubNotFound, hubName),
+		}
+	}
+
+	if len(c.purges) == 0 {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotImplemented,
+			Err:        errNoHistoryPurger,
+		}
+	}
+
+	resp.Expires = c.expires
+
+	clusterHistoryPurgesMu.Lock()
+	for id, pending := range clusterHistoryPurges {
+		if time.Now().After(pending.expires) {
+			delete(clusterHistoryPurges, id)
+		}
+	}
+
+	clusterHistoryPurges[resp.ID] = c
+	clusterHistoryPurgesMu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+
+	return json.NewEncoder(w).Encode(resp) //nolint:wrapcheck
+}
+
+// handleConfirmation confirms (POST) or cancels (DELETE) the prepared purge
+// whose ID is in the JSON body, on all the hubs it has been prepared on.
+func (*HistoryPurge) handleConfirmation(w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		return caddy.APIError{
+			HTTPStatus: http.StatusMethodNotAllowed,
+			Err:        errMethodNotAllowed,
+		}
+	}
+
+	var req historyPurgeConfirmation
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return caddy.APIError{
+			HTTPStatus: http.StatusBadRequest,
+			Err:        fmt.Errorf("invalid confirmation: %w", err),
+		}
+	}
+
+	clusterHistoryPurgesMu.Lock()
+	c, ok := clusterHistoryPurges[req.ID]
+	delete(clusterHistoryPurges, req.ID)
+	clusterHistoryPurgesMu.Unlock()
+
+	if !ok || time.Now().After(c.expires) {
+		return caddy.APIError{
+			HTTPStatus: http.StatusNotFound,
+			Err:        mercure.ErrHistoryPurgeNotFound,
+		}
+	}
+
+	hubsByName := make(map[string]*mercure.Hub)
+	for _, info := range snapshotHubs() {
+		hubsByName[info.name] = info.hub
+	}
+
+	// Every hub must still be there before purging any of them.
+	for name := range c.purges {
+		if _, ok := hubsByName[name]; !ok {
+			for n, id := range c.purges {
+				if h, ok := hubsByName[n]; ok {
+					h.CancelHistoryPurge(id)
+				}
+			}
+
+			return caddy.APIError{
+				HTTPStatus: http.StatusConflict,
+				Err:        fmt.Errorf("%w: %q", errHubNotFound, name),
+			}
+		}
+	}
+
+	if r.Method == http.MethodDelete {
+		for name, id := range c.purges {
+			hubsByName[name].CancelHistoryPurge(id)
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return nil
+	}
+
+	resp := historyPurgeConfirmationResponse{Hubs: make(map[string]int)}
+
+	var errs []error
+
+	for name, id := range c.purges {
+		n, err := hubsByName[name].ConfirmHistoryPurge(r.Context(), id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("hub %q: %w", name, err))
+
+			continue
+		}
+
+		resp.Hubs[name] = n
+		resp.Purged += n
+	}
+
+	if len(errs) != 0 {
+		return caddy.APIError{
+			HTTPStatus: http.StatusInternalServerError,
+			Err:        fmt.Errorf("%w (purged: %v)", errors.Join(errs...), resp.Hubs),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	return json.NewEncoder(w).Encode(resp) //nolint:wrapcheck
+}
+
+// Interface guards.
+var _ caddy.AdminRouter = (*HistoryPurge)(nil)
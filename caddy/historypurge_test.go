@@ -0,0 +1,81 @@
+package caddy
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/caddyserver/caddy/v2/caddytest"
+	"github.com/dunglas/mercure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistoryPurgeEndpoints(t *testing.T) {
+	tester := caddytest.NewTester(t)
+	tester.InitServer(`{
+	skip_install_trust
+	admin localhost:2999
+	http_port     9080
+	https_port    9443
+}
+
+localhost:9080 {
+	route {
+		mercure {
+			anonymous
+			issuer https://example.com {
+				publisher {
+					jwt !ChangeMe!
+				}
+			}
+			resource_identifier https://example.com/.well-known/mercure
+			transport bolt {
+				path `+filepath.Join(t.TempDir(), "purge.db")+`
+			}
+		}
+
+		respond 404
+	}
+}`, "caddyfile")
+
+	hubs := snapshotHubs()
+	require.Len(t, hubs, 1)
+
+	for _, topic := range []string{"https://example.com/users/1", "https://example.com/books/1"} {
+		require.NoError(t, hubs[0].hub.Publish(t.Context(), &mercure.Update{Topic: topic}))
+	}
+
+	post := func(path, body string, status int) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, "http://localhost:2999"+path, strings.NewReader(body))
+		require.NoError(t, err)
+
+		return tester.AssertResponseCode(req, status)
+	}
+
+	resp := post("/mercure/history-purge", `{}`, http.StatusBadRequest)
+	require.NoError(t, resp.Body.Close())
+
+	resp = post("/mercure/history-purge/unknown", `{"match": ["https://example.com/users/1"]}`, http.StatusNotFound)
+	require.NoError(t, resp.Body.Close())
+
+	resp = post("/mercure/history-purge", `{"match": ["https://example.com/users/1"]}`, http.StatusOK)
+
+	var prepared historyPurgeResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&prepared))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, 1, prepared.Updates)
+	assert.Equal(t, map[string]int{hubs[0].name: 1}, prepared.Hubs)
+
+	resp = post("/mercure/history-purge-confirmation", `{"id": "`+prepared.ID+`"}`, http.StatusOK)
+
+	var confirmed historyPurgeConfirmationResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&confirmed))
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, 1, confirmed.Purged)
+
+	resp = post("/mercure/history-purge-confirmation", `{"id": "`+prepared.ID+`"}`, http.StatusNotFound)
+	require.NoError(t, resp.Body.Close())
+}
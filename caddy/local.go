@@ -31,11 +31,11 @@ func (l *Local) GetTransport() mercure.Transport { //nolint:ireturn
 }
 
 // Provision provisions l's configuration.
-func (l *Local) Provision(ctx caddy.Context) error {
+func (l *Local) Provision(_ caddy.Context) error {
 	destructor, _, _ := TransportUsagePool.LoadOrNew(localTransportKey, func() (caddy.Destructor, error) {
 		return TransportDestructor[*mercure.LocalTransport]{
 			Transport: mercure.NewLocalTransport(
-				mercure.NewSubscriberList(ctx.Value(SubscriberListCacheSizeContextKey).(int)),
+				mercure.NewSubscriberList(0),
 			),
 		}, nil
 	})
@@ -4,11 +4,13 @@ package caddy
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"math"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -26,6 +28,7 @@ import (
 	"github.com/caddyserver/caddy/v2/modules/caddyhttp"
 	"github.com/dunglas/mercure"
 	"github.com/dustin/go-humanize"
+	"golang.org/x/time/rate"
 )
 
 const defaultHubURL = "/.well-known/mercure"
@@ -41,6 +44,10 @@ var (
 
 	ErrCompatibility = errors.New("compatibility mode only supports protocol versions 7 and 8")
 
+	errUnknownPublishHookType = errors.New("unknown publish hook type")
+	errStreamNetwork          = errors.New("the API requires a stream network")
+	errDeadLettersStore       = errors.New(`the "bolt" dead letters store requires the Bolt transport`)
+
 	// hubs is a list of registered Mercure hubs, the key is the top-most subroute.
 	hubs   = make(map[caddy.Module]*hubInfo) //nolint:gochecknoglobals
 	hubsMu sync.Mutex                        //nolint:gochecknoglobals
@@ -83,6 +90,54 @@ type JWTConfig struct {
 	Alg string `json:"alg,omitempty"`
 }
 
+// TokenIntrospectionConfig validates the opaque access tokens with an OAuth
+// 2.0 token introspection endpoint (RFC 7662).
+type TokenIntrospectionConfig struct {
+	// URL of the introspection endpoint.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// Credentials of the hub, sent with HTTP Basic authentication.
+	ClientID     string `json:"client_id,omitempty"`
+	ClientSecret string `json:"client_secret,omitempty"`
+
+	// How long the introspection responses are cached, 1 minute by default,
+	// a negative value disabling the cache.
+	CacheTTL caddy.Duration `json:"cache_ttl,omitempty"`
+
+	// Maximum number of responses cached, 10000 by default.
+	CacheSize int `json:"cache_size,omitempty"`
+
+	// Member of the responses holding the authorization details,
+	// "authorization_details" by default.
+	AuthorizationDetailsField string `json:"authorization_details_field,omitempty"`
+
+	// Members of the responses holding the topic selectors the token may
+	// subscribe and publish to.
+	SubscribeField string `json:"subscribe_field,omitempty"`
+	PublishField   string `json:"publish_field,omitempty"`
+}
+
+// AuthorizationWebhookConfig delegates the authorization of the
+// subscriptions and the publications to an external service.
+type AuthorizationWebhookConfig struct {
+	// URL of the service.
+	URL string `json:"url,omitempty"`
+
+	// How long the decisions are cached, 10 seconds by default, a negative
+	// value disabling the cache.
+	CacheTTL caddy.Duration `json:"cache_ttl,omitempty"`
+
+	// Maximum number of decisions cached, 10000 by default.
+	CacheSize int `json:"cache_size,omitempty"`
+
+	// Consecutive failures of the service opening the circuit breaker, 5 by
+	// default.
+	FailureThreshold int `json:"failure_threshold,omitempty"`
+
+	// How long the circuit breaker stays open, 30 seconds by default.
+	OpenDuration caddy.Duration `json:"open_duration,omitempty"`
+}
+
 // IssuerConfig binds a trusted issuer to its per-role verification material.
 type IssuerConfig struct {
 	// Identifier is the exact token iss claim value (RFC 9068 §4).
@@ -92,6 +147,14 @@ type IssuerConfig struct {
 	// protected resource metadata. Leave false for self-issued tokens.
 	AuthorizationServer bool `json:"authorization_server,omitempty"`
 
+	// Audiences accepted for the tokens of this issuer instead of the
+	// resource identifier of the hub.
+	Audiences []string `json:"audiences,omitempty"`
+
+	// Prefix of the names of the hub-specific claims in the tokens of this
+	// issuer, like "https://mercure.example.com/".
+	ClaimNamespace string `json:"claim_namespace,omitempty"`
+
 	// Publisher verifies publisher tokens from this issuer.
 	Publisher VerifierConfig `json:"publisher,omitzero"`
 
@@ -99,6 +162,430 @@ type IssuerConfig struct {
 	Subscriber VerifierConfig `json:"subscriber,omitzero"`
 }
 
+// AlertConfig configures an alert rule evaluated by the hub.
+type AlertConfig struct {
+	// Event is the counted event: connection_drop, dispatch_error or
+	// history_purge_failure.
+	Event string `json:"event,omitempty"`
+
+	// Threshold is the number of events within the window firing the alert.
+	Threshold int `json:"threshold,omitempty"`
+
+	// Window is the duration the events are counted over.
+	Window caddy.Duration `json:"window,omitempty"`
+}
+
+// ResponseHeadersConfig adds headers to the successful responses of some hub
+// endpoints.
+type ResponseHeadersConfig struct {
+	// Endpoints the headers are added to: subscribe, publish, subscriptions or
+	// resource_metadata. All endpoints when empty.
+	Endpoints []string `json:"endpoints,omitempty"`
+
+	// Exact topic matchers restricting subscribe headers to the subscriptions
+	// requesting them.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers restricting subscribe headers to the
+	// subscriptions requesting them, or a topic they match.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+
+	// The headers to set.
+	Header http.Header `json:"header,omitempty"`
+}
+
+// PublishHookConfig sends copies of the published updates to an external
+// system.
+type PublishHookConfig struct {
+	// Type is the external system: http, nats, kafka, lambda, sns or pubsub.
+	Type string `json:"type,omitempty"`
+
+	// URL is the URL the updates are POSTed to (http), of the NATS server
+	// (nats), or of the Kafka REST Proxy (kafka). It is the name or ARN of the
+	// function (lambda), the ARN of the topic (sns), or the
+	// projects/<project>/topics/<topic> name of the topic (pubsub).
+	URL string `json:"url,omitempty"`
+
+	// Target is the NATS subject (nats) or the Kafka topic (kafka).
+	Target string `json:"target,omitempty"`
+
+	// Exact topic matchers restricting the hook to the updates having one of
+	// these topics.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers restricting the hook to the updates having
+	// a topic they match.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+
+	// Also send the private updates.
+	Private bool `json:"private,omitempty"`
+
+	// Headers added to the requests (http and kafka).
+	Header http.Header `json:"header,omitempty"`
+}
+
+// EnricherConfig adds server-computed fields, looked up with an HTTP endpoint,
+// to the published updates.
+type EnricherConfig struct {
+	// Name identifies the enricher in the logs.
+	Name string `json:"name,omitempty"`
+
+	// URL of the lookup endpoint.
+	URL string `json:"url,omitempty"`
+
+	// JSONPath selecting the lookup key in the data of the updates, such as
+	// $.author_id. The updates are POSTed to the URL when empty.
+	Key string `json:"key,omitempty"`
+
+	// Exact topic matchers restricting the enricher to the updates having one
+	// of these topics.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers restricting the enricher to the updates
+	// having a topic they match.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+
+	// How long the publication waits for the lookup.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+
+	// How long the lookups by key are cached.
+	CacheTTL caddy.Duration `json:"cache_ttl,omitempty"`
+
+	// Headers added to the requests.
+	Header http.Header `json:"header,omitempty"`
+}
+
+// RoutingRuleConfig adapts the routing of the published updates to their
+// topic and content.
+type RoutingRuleConfig struct {
+	// Name identifies the rule in the logs.
+	Name string `json:"name,omitempty"`
+
+	// Exact topic matchers restricting the rule to the updates having one of
+	// these topics.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers restricting the rule to the updates having
+	// a topic they match.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+
+	// JSONPath predicate on the data of the updates, such as
+	// $.total > 1000.
+	When string `json:"when,omitempty"`
+
+	// Action is add_topic, drop, transform or escalate.
+	Action string `json:"action,omitempty"`
+
+	// Topic receiving a copy of the updates (add_topic).
+	Topic string `json:"topic,omitempty"`
+
+	// Go template producing the new data of the updates (transform).
+	Template string `json:"template,omitempty"`
+
+	// System the updates are sent to (escalate).
+	Escalate *PublishHookConfig `json:"escalate,omitempty"`
+}
+
+// SubscriptionApprovalConfig requires approval for the subscriptions to some
+// topic selectors.
+type SubscriptionApprovalConfig struct {
+	// Exact topic matchers selecting the topic selectors requiring approval.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers selecting the topic selectors requiring
+	// approval.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+
+	// Topic the approval requests are published on, privately.
+	Topic string `json:"topic,omitempty"`
+
+	// System the approval requests are sent to.
+	Approver *PublishHookConfig `json:"approver,omitempty"`
+
+	// How long a subscription awaits approval before being rejected.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+}
+
+// JSONPatchDeltasConfig computes JSON Patch deltas for the subscribers
+// requesting them.
+type JSONPatchDeltasConfig struct {
+	// Exact topic matchers selecting the topics whose updates are diffed.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers selecting the topics whose updates are
+	// diffed.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+
+	// Number of documents the hub retains.
+	MaxDocuments int `json:"max_documents,omitempty"`
+}
+
+// RetainedValuesConfig retains the last update of some topics, sent to the
+// subscribers requesting a snapshot.
+type RetainedValuesConfig struct {
+	// Exact topic matchers selecting the topics whose last update is
+	// retained.
+	Match []string `json:"match,omitempty"`
+
+	// URL Pattern topic matchers selecting the topics whose last update is
+	// retained.
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+
+	// Number of topics whose value the hub retains.
+	MaxTopics int `json:"max_topics,omitempty"`
+}
+
+// RetentionExemptionsConfig overrides the retention of the history for
+// compliance topics.
+type RetentionExemptionsConfig struct {
+	// Exact topic matchers selecting the topics whose updates are never
+	// removed from the history automatically.
+	Exempt []string `json:"exempt,omitempty"`
+
+	// URL Pattern topic matchers selecting the topics whose updates are
+	// never removed from the history automatically.
+	ExemptURLPattern []string `json:"exempt_urlpattern,omitempty"`
+
+	// Exact topic matchers selecting the topics whose updates are never
+	// persisted.
+	Forbidden []string `json:"forbidden,omitempty"`
+
+	// URL Pattern topic matchers selecting the topics whose updates are
+	// never persisted.
+	ForbiddenURLPattern []string `json:"forbidden_urlpattern,omitempty"`
+}
+
+// IdleTopicsConfig tracks the topics without subscribers not published on for
+// a while, and optionally forgets their state.
+type IdleTopicsConfig struct {
+	// How long a topic without subscribers must not be published on to be
+	// idle.
+	TTL caddy.Duration `json:"ttl,omitempty"`
+
+	// Forget the retained values, JSON Patch states, last event IDs and
+	// cached selector matches of the idle topics.
+	Collect bool `json:"collect,omitempty"`
+
+	// Number of topics tracked.
+	MaxTopics int `json:"max_topics,omitempty"`
+}
+
+// SubscriberBandwidthConfig caps the number of bytes per second written to the
+// subscribers.
+type SubscriberBandwidthConfig struct {
+	// Bytes per second written to each subscriber.
+	PerConnection int64 `json:"per_connection,omitempty"`
+
+	// Bytes per second written to all the subscribers whose tokens have the
+	// same subject.
+	PerSubject int64 `json:"per_subject,omitempty"`
+}
+
+// BroadcastScriptConfig serves the client script sharing a connection to the
+// hub between the tabs of an origin.
+type BroadcastScriptConfig struct {
+	// URL the script connects to, the hub link URL by default.
+	HubURL string `json:"hub_url,omitempty"`
+
+	// Templates of the topics the pages subscribe to by default.
+	Topics []string `json:"topics,omitempty"`
+
+	// Endpoint of the application providing the access tokens.
+	TokenURL string `json:"token_url,omitempty"`
+
+	// Name of the BroadcastChannel, "mercure" by default.
+	Channel string `json:"channel,omitempty"`
+}
+
+// HealthTopicConfig publishes health samples on the topic of the node.
+type HealthTopicConfig struct {
+	// Time between two samples.
+	Interval caddy.Duration `json:"interval,omitempty"`
+
+	// Name of the node, the host name by default.
+	Node string `json:"node,omitempty"`
+}
+
+// TopicMatcherPersistenceConfig saves the hottest compiled topic matchers
+// across restarts.
+type TopicMatcherPersistenceConfig struct {
+	// File storing the matchers.
+	Path string `json:"path,omitempty"`
+
+	// Number of matchers saved.
+	MaxMatchers int `json:"max_matchers,omitempty"`
+
+	// Time between two saves.
+	Interval caddy.Duration `json:"interval,omitempty"`
+}
+
+// SelfCheckConfig checks at startup that the hub works end to end.
+type SelfCheckConfig struct {
+	// Loopback topic.
+	Topic string `json:"topic,omitempty"`
+
+	// Tokens that must be authorized to publish and subscribe to the
+	// loopback topic.
+	PublisherToken  string `json:"publisher_token,omitempty"`
+	SubscriberToken string `json:"subscriber_token,omitempty"`
+
+	// Timeout of an attempt, and time between two attempts.
+	Timeout caddy.Duration `json:"timeout,omitempty"`
+}
+
+// TopicCardinalityConfig limits the number of distinct topics published on.
+type TopicCardinalityConfig struct {
+	// Number of distinct topics that can be published on by all the
+	// publishers.
+	MaxTopics int `json:"max_topics,omitempty"`
+
+	// Number of distinct topics that can be published on by a single
+	// publisher.
+	MaxTopicsPerPublisher int `json:"max_topics_per_publisher,omitempty"`
+
+	// Period over which the distinct topics are counted.
+	Window caddy.Duration `json:"window,omitempty"`
+
+	// Log the updates exceeding the limits instead of rejecting them.
+	LogOnly bool `json:"log_only,omitempty"`
+}
+
+// TenantConfig is a tenant of a shared hub and its quotas. A zero quota means
+// no limit.
+type TenantConfig struct {
+	// Name of the tenant, in the metrics.
+	Name string `json:"name,omitempty"`
+
+	// Identifiers of the issuers whose tokens belong to the tenant.
+	Issuers []string `json:"issuers,omitempty"`
+
+	// Number of subscribers connected at the same time.
+	MaxConnections int `json:"max_connections,omitempty"`
+
+	// Number of distinct topics published on during a window.
+	MaxTopics int `json:"max_topics,omitempty"`
+
+	// Number of bytes published during a window.
+	MaxHistoryBytes int64 `json:"max_history_bytes,omitempty"`
+
+	// Number of updates published per second.
+	PublishRate float64 `json:"publish_rate,omitempty"`
+
+	// Number of updates that can be published at once.
+	PublishBurst int `json:"publish_burst,omitempty"`
+}
+
+// TenancyConfig enables the multi-tenant mode, enforcing quotas per tenant.
+type TenancyConfig struct {
+	Tenants []TenantConfig `json:"tenants,omitempty"`
+
+	// Period over which the topics and the history bytes are counted.
+	Window caddy.Duration `json:"window,omitempty"`
+}
+
+// DeadLettersConfig records the updates dropped because a subscriber didn't
+// receive them fast enough.
+type DeadLettersConfig struct {
+	// Number of dead letters kept, 1000 by default.
+	Size int `json:"size,omitempty"`
+
+	// Where the dead letters are kept: "memory" (the default), or "bolt" to
+	// keep them in the database of the Bolt transport.
+	Store string `json:"store,omitempty"`
+}
+
+// LameDuckConfig redirects or queues the publications received while the hub
+// shuts down.
+type LameDuckConfig struct {
+	// Base URL of the peer hub the publishers are redirected to. The updates
+	// are queued to the transport when empty.
+	PeerURL string `json:"peer_url,omitempty"`
+
+	// Delay advertised to the publishers once the transport is closed.
+	RetryAfter caddy.Duration `json:"retry_after,omitempty"`
+}
+
+// PollingConnectorConfig periodically fetches a JSON document, an Atom or an
+// RSS feed, and publishes its changes.
+type PollingConnectorConfig struct {
+	// URL of the polled document.
+	URL string `json:"url,omitempty"`
+
+	// Topic of the published updates. {id} is replaced with the ID of the
+	// item.
+	Topic string `json:"topic,omitempty"`
+
+	// Interval between two fetches.
+	Interval caddy.Duration `json:"interval,omitempty"`
+
+	// Format of the document: json, atom or rss. Detected when empty.
+	Format string `json:"format,omitempty"`
+
+	// Field identifying the items of a JSON array.
+	IDField string `json:"id_field,omitempty"`
+
+	// Publish private updates.
+	Private bool `json:"private,omitempty"`
+
+	// Headers added to the requests.
+	Header http.Header `json:"header,omitempty"`
+}
+
+// FileWatcherConfig publishes the changes of the files of a directory.
+type FileWatcherConfig struct {
+	// The watched directory.
+	Dir string `json:"dir,omitempty"`
+
+	// Topic of the published updates. {key} is replaced with the path of
+	// the file.
+	Topic string `json:"topic,omitempty"`
+
+	// Minimum interval between two scans of the directory, and interval
+	// between two periodic scans.
+	Interval caddy.Duration `json:"interval,omitempty"`
+
+	// Scan the directory periodically instead of waiting for the changes
+	// reported by inotify, for network filesystems.
+	Poll bool `json:"poll,omitempty"`
+
+	// Publish private updates.
+	Private bool `json:"private,omitempty"`
+}
+
+// S3NotificationsConfig publishes the changes of the objects of S3 buckets
+// notified to the hub.
+type S3NotificationsConfig struct {
+	// Token authenticating the notifications. Supports placeholders.
+	Token string `json:"token,omitempty"`
+
+	// Topic of the published updates. {bucket} is replaced with the bucket,
+	// {key} with the key of the object.
+	Topic string `json:"topic,omitempty"`
+
+	// Publish private updates.
+	Private bool `json:"private,omitempty"`
+}
+
+// HubLinkConfig customizes the rel="mercure" Link header advertising the hub.
+type HubLinkConfig struct {
+	// URL of the hub, like https://hub.example.com/.well-known/mercure.
+	URL string `json:"url,omitempty"`
+
+	// Additional relation types of the link.
+	Rels []string `json:"rels,omitempty"`
+}
+
+// SidecarConfig serves the sidecar API, letting colocated services publish
+// and subscribe through a Unix domain socket.
+type SidecarConfig struct {
+	// Network address of the socket, like unix//run/mercure/sidecar.sock|0660.
+	// A path is a Unix domain socket.
+	Address string `json:"address,omitempty"`
+
+	// Token the connections must authenticate with. Supports placeholders.
+	Token string `json:"token,omitempty"`
+}
+
 // VerifierConfig configures how one role's tokens are verified: either a static
 // key (JWT) or a JWK Set (JWKSURL). The two are mutually exclusive.
 type VerifierConfig struct {
@@ -111,6 +598,17 @@ type VerifierConfig struct {
 	// JWKSAlgorithms pins the allowed JWS algorithms for the JWK Set path
 	// (RFC 8725). Defaults to the hub's asymmetric allowlist when empty.
 	JWKSAlgorithms []string `json:"jwks_algorithms,omitempty"`
+
+	// JWKSRefreshInterval is how often the JWK Set is fetched again, one
+	// hour by default.
+	JWKSRefreshInterval caddy.Duration `json:"jwks_refresh_interval,omitempty"`
+
+	// JWKSUnknownKIDRefreshInterval is the minimum time between two fetches
+	// of the JWK Set triggered by tokens signed with an unknown key ID, five
+	// minutes by default. Keys rotated by the issuer are so picked up
+	// without waiting for the next refresh, while tokens with forged key IDs
+	// can't make the hub flood the issuer.
+	JWKSUnknownKIDRefreshInterval caddy.Duration `json:"jwks_unknown_kid_refresh_interval,omitempty"`
 }
 
 // isSet reports whether the verifier declares any material.
@@ -120,7 +618,7 @@ func (v VerifierConfig) isSet() bool {
 
 // Mercure implements a Mercure hub as a Caddy module. Mercure is a protocol allowing to push data updates to web browsers and other HTTP clients in a convenient, fast, reliable and battery-efficient way.
 type Mercure struct {
-	deprecatedTransport
+	transportURL
 
 	// Human-readable name for this hub, used in health check endpoints and metrics.
 	Name string `json:"name,omitempty"`
@@ -146,6 +644,63 @@ type Mercure struct {
 	// Frequency of the heartbeat, defaults to 40s.
 	Heartbeat *caddy.Duration `json:"heartbeat,omitempty"`
 
+	// Send a last event telling the subscribers why the hub closes their
+	// connection.
+	DisconnectEvents bool `json:"disconnect_events,omitempty"`
+
+	// Reconnection delay advised in the disconnect events when the hub stops
+	// or the subscriber is too slow, randomized between the half and the
+	// whole of it.
+	DisconnectRetry caddy.Duration `json:"disconnect_retry,omitempty"`
+
+	// Send their own delivery statistics to the subscribers, with the
+	// heartbeats.
+	SubscriberStats bool `json:"subscriber_stats,omitempty"`
+
+	// Number of updates waiting to be sent to a subscriber, 1000 by default.
+	SubscriberBufferSize int `json:"subscriber_buffer_size,omitempty"`
+
+	// What happens when the buffer of a subscriber is full: "disconnect"
+	// (default), "drop-oldest" or "drop-newest".
+	OverflowPolicy string `json:"overflow_policy,omitempty"`
+
+	// Number of updates waiting to be sent, all subscribers included, above
+	// which the live updates of the most lagging subscribers are shed.
+	DispatchWatermark int `json:"dispatch_watermark,omitempty"`
+
+	// Cap the bandwidth of the subscribers.
+	SubscriberBandwidth *SubscriberBandwidthConfig `json:"subscriber_bandwidth,omitempty"`
+
+	// Enable the WebSocket subscribe endpoint, /.well-known/mercure/ws.
+	WebSocket bool `json:"websocket,omitempty"`
+
+	// Let the WebSocket clients publish on their connection, with the
+	// publish claims of their JWT.
+	WebSocketPublishing bool `json:"websocket_publishing,omitempty"`
+
+	// Customize the rel="mercure" Link header advertising the hub.
+	HubLink *HubLinkConfig `json:"hub_link,omitempty"`
+
+	// Serve the discovery document, /.well-known/mercure/discovery.
+	Discovery bool `json:"discovery,omitempty"`
+
+	// Serve the broadcast client script, /.well-known/mercure/broadcast.js.
+	BroadcastScript *BroadcastScriptConfig `json:"broadcast_script,omitempty"`
+
+	// Enable the long-polling endpoint, /.well-known/mercure/poll.
+	LongPolling bool `json:"long_polling,omitempty"`
+
+	// Maximum duration of a poll.
+	LongPollingTimeout caddy.Duration `json:"long_polling_timeout,omitempty"`
+
+	// Keep the subscriptions of the lost SSE connections during this grace
+	// period, for the clients to resume them with their resume token.
+	ResumeGracePeriod *caddy.Duration `json:"resume_grace_period,omitempty"`
+
+	// Don't replay the updates of the history older than this, even when
+	// the Last-Event-ID of the subscriber points further back.
+	MaxReplayAge *caddy.Duration `json:"max_replay_age,omitempty"`
+
 	// Maximum size in bytes of publish and QUERY subscribe request bodies;
 	// larger requests are rejected with a 413 status code. Defaults to 1MiB,
 	// set to 0 to disable the in-hub limit.
@@ -155,6 +710,13 @@ type Mercure struct {
 	// material, so key material is never pooled across issuers.
 	Issuers []IssuerConfig `json:"issuers,omitempty"`
 
+	// Validate the opaque access tokens with a token introspection endpoint.
+	TokenIntrospection *TokenIntrospectionConfig `json:"token_introspection,omitempty"`
+
+	// Authorize the subscriptions and the publications with an external
+	// service.
+	AuthorizationWebhook *AuthorizationWebhookConfig `json:"authorization_webhook,omitempty"`
+
 	// Deprecated: use Issuers. Static publisher key and signing algorithm,
 	// mapped to a single implicit issuer (usable only in compatibility mode).
 	PublisherJWT JWTConfig `json:"publisher_jwt,omitzero"`
@@ -177,12 +739,37 @@ type Mercure struct {
 	// Allowed CORS origins.
 	CORSOrigins []string `json:"cors_origins,omitempty"`
 
+	// How long browsers may cache the responses to CORS preflight requests.
+	// Negative to disable the caching.
+	CORSMaxAge *caddy.Duration `json:"cors_max_age,omitempty"`
+
+	// Tuning preset: "embedded" or "broadcast". The settings configured
+	// explicitly take precedence.
+	Profile string `json:"profile,omitempty"`
+
 	// Maximum number of entries in the topic matcher cache. 0 or negative
 	// disables the cache. Defaults to DefaultTopicMatcherStoreCacheSize.
 	TopicMatcherCacheSize *int `json:"topic_matcher_cache_size,omitempty"`
 
+	// Save the hottest compiled topic matchers across restarts.
+	TopicMatcherPersistence *TopicMatcherPersistenceConfig `json:"topic_matcher_persistence,omitempty"`
+
+	// Allow the regexp topic matcher type.
+	RegexpTopicMatchers bool `json:"regexp_topic_matchers,omitempty"`
+
+	// Accept the access token of the subscribers in the "authorization" query parameter.
+	QueryTokens bool `json:"query_tokens,omitempty"`
+
+	// Maximum lifetime of the access tokens passed in the query (5m by default).
+	QueryTokenMaxLifetime caddy.Duration `json:"query_token_max_lifetime,omitempty"`
+
+	// Deprecated: ignored, the subscribers are found with the topic index.
 	SubscriberListCacheSize *int `json:"subscriber_list_cache_size,omitempty"`
 
+	// Number of shards the subscribers of the transport are split in, each
+	// with its own lock, cache and matching worker. Defaults to 1.
+	SubscriberShards int `json:"subscriber_shards,omitempty"`
+
 	// The name of the authorization cookie. Defaults to
 	// "__Secure-mercure_access_token"; plain-HTTP deployments must configure a
 	// prefix-less name.
@@ -207,6 +794,130 @@ type Mercure struct {
 	// The version of the Mercure protocol to be backward compatible with (versions 7 and 8 are supported)
 	ProtocolVersionCompatibility int `json:"protocol_version_compatibility,omitempty"`
 
+	// Alert rules evaluated by the hub. Fired alerts are logged and POSTed to the alert webhooks.
+	Alerts []AlertConfig `json:"alerts,omitempty"`
+
+	// URLs fired alerts are POSTed to, as JSON documents.
+	AlertWebhooks []string `json:"alert_webhooks,omitempty"`
+
+	// Headers added to the responses of the hub, per endpoint and subscribed topic matchers.
+	ResponseHeaders []ResponseHeadersConfig `json:"response_headers,omitempty"`
+
+	// Hooks sending copies of the published updates to external systems.
+	PublishHooks []PublishHookConfig `json:"publish_hooks,omitempty"`
+
+	// Enrichers adding server-computed fields to the published updates.
+	Enrichers []EnricherConfig `json:"enrichers,omitempty"`
+
+	// Rules adapting the routing of the published updates to their topic and
+	// content, applied in order.
+	RoutingRules []RoutingRuleConfig `json:"routing_rules,omitempty"`
+
+	// Hubs allowed to publish into some topic spaces of the hub.
+	Federation *FederationConfig `json:"federation,omitempty"`
+
+	// Peer hubs the updates of some topics are published to.
+	Federate []FederateConfig `json:"federate,omitempty"`
+
+	// Approval required for the subscriptions to some topic selectors.
+	SubscriptionApproval *SubscriptionApprovalConfig `json:"subscription_approval,omitempty"`
+
+	// JSON Patch deltas computed from the retained state of some topics.
+	JSONPatchDeltas *JSONPatchDeltasConfig `json:"json_patch_deltas,omitempty"`
+
+	// Last update of some topics, sent to the subscribers requesting a
+	// snapshot.
+	RetainedValues *RetainedValuesConfig `json:"retained_values,omitempty"`
+
+	// Topics never purged from the history, or never persisted.
+	RetentionExemptions *RetentionExemptionsConfig `json:"retention_exemptions,omitempty"`
+
+	// Number the updates of each topic.
+	TopicSequences bool `json:"topic_sequences,omitempty"`
+
+	// Track, and optionally collect, the idle topics.
+	IdleTopics *IdleTopicsConfig `json:"idle_topics,omitempty"`
+
+	// Publish health samples on /.well-known/mercure/health/{node}.
+	HealthTopic *HealthTopicConfig `json:"health_topic,omitempty"`
+
+	// Check at startup that the hub works end to end, and don't report
+	// ready until then.
+	SelfCheck *SelfCheckConfig `json:"self_check,omitempty"`
+
+	// Limit the number of distinct topics published on.
+	TopicCardinality *TopicCardinalityConfig `json:"topic_cardinality,omitempty"`
+
+	// Quotas of the tenants of a shared hub.
+	Tenancy *TenancyConfig `json:"tenancy,omitempty"`
+
+	// Record the updates dropped for slow subscribers, to re-deliver them.
+	DeadLetters *DeadLettersConfig `json:"dead_letters,omitempty"`
+
+	// Redirect or queue the publications received during the shutdown.
+	LameDuck *LameDuckConfig `json:"lame_duck,omitempty"`
+
+	// Connectors publishing the changes of polled documents.
+	PollingConnectors []PollingConnectorConfig `json:"polling_connectors,omitempty"`
+
+	// Watchers publishing the changes of the files of directories.
+	FileWatchers []FileWatcherConfig `json:"file_watchers,omitempty"`
+
+	// Publish the changes of the objects of S3 buckets, notified to the
+	// /.well-known/mercure/s3-notifications endpoint.
+	S3Notifications *S3NotificationsConfig `json:"s3_notifications,omitempty"`
+
+	// Serve the JSON-RPC sidecar API on a Unix domain socket.
+	Sidecar *SidecarConfig `json:"sidecar,omitempty"`
+
+	// Network address of the gRPC API, like localhost:9090. The API is served in clear text.
+	GRPC string `json:"grpc,omitempty"`
+
+	// Make anonymous subscriptions shareable by SSE-aware CDNs: stable URLs and publicly cacheable streams.
+	CDNFanOut bool `json:"cdn_fan_out,omitempty"`
+
+	// How long a CDN may attach new viewers to an origin stream in CDN fan-out mode.
+	CDNEdgeTTL caddy.Duration `json:"cdn_edge_ttl,omitempty"`
+
+	// Publish the updates having an If-Match header only if it is the ID of the last update of the topic.
+	ConditionalPublishing bool `json:"conditional_publishing,omitempty"`
+
+	// Number of topics whose last event ID the hub remembers for conditional publishing.
+	ConditionalPublishingMaxTopics int `json:"conditional_publishing_max_topics,omitempty"`
+
+	// Answer the publications having a "Prefer: receipt" header with the number of local subscribers the update has been handed to.
+	DeliveryReceipts bool `json:"delivery_receipts,omitempty"`
+
+	// Deduplicate the publications having the Idempotency-Key header (or id field) of a recent publication.
+	IdempotentPublishing bool `json:"idempotent_publishing,omitempty"`
+
+	// Time during which the idempotency keys are remembered (24h by default).
+	IdempotencyWindow caddy.Duration `json:"idempotency_window,omitempty"`
+
+	// Directory storing the attachments of multipart publications. Attachments are disabled when empty.
+	AttachmentsDir string `json:"attachments_dir,omitempty"`
+
+	// Key signing the attachment URLs. Defaults to a random key, invalidating the URLs on restart.
+	AttachmentSigningKey string `json:"attachment_signing_key,omitempty"`
+
+	// Validity of the attachment URLs.
+	AttachmentURLTTL caddy.Duration `json:"attachment_url_ttl,omitempty"`
+
+	// Secret encrypting the grants of capability URLs. Capability URLs are disabled when empty.
+	CapabilityKey string `json:"capability_key,omitempty"`
+
+	// Maximum validity of capability URLs.
+	CapabilityMaxTTL caddy.Duration `json:"capability_max_ttl,omitempty"`
+
+	// Assign guest session IDs and inbox topics to anonymous subscribers.
+	GuestSessions bool `json:"guest_sessions,omitempty"`
+
+	// The name of the guest session cookie. Defaults to "__Secure-mercure_guest".
+	GuestCookieName string `json:"guest_cookie_name,omitempty"`
+
+	// Subscribe every token subject to its inbox topic.
+	UserInboxes bool `json:"user_inboxes,omitempty"`
+
 	// The transport configuration.
 	TransportRaw json.RawMessage `json:"transport,omitempty" caddy:"namespace=http.handlers.mercure inline_key=name"` //nolint:tagalign
 
@@ -239,7 +950,17 @@ func (m *Mercure) Provision(ctx caddy.Context) (err error) { //nolint:funlen,goc
 		return err
 	}
 
-	cacheSize := mercure.DefaultTopicMatcherStoreCacheSize
+	profile := mercure.ProfileSettings{
+		TopicMatcherCacheSize: mercure.DefaultTopicMatcherStoreCacheSize,
+		SubscriberShards:      1,
+	}
+	if m.Profile != "" {
+		if profile, err = mercure.Profile(m.Profile).Settings(); err != nil {
+			return err
+		}
+	}
+
+	cacheSize := profile.TopicMatcherCacheSize
 	if m.TopicMatcherCacheSize != nil {
 		cacheSize = *m.TopicMatcherCacheSize
 	}
@@ -252,16 +973,14 @@ func (m *Mercure) Provision(ctx caddy.Context) (err error) { //nolint:funlen,goc
 	ctx = ctx.WithValue(SubscriptionsContextKey, m.Subscriptions)
 	ctx = ctx.WithValue(WriteTimeoutContextKey, m.WriteTimeout)
 
-	if m.SubscriberListCacheSize == nil {
-		ctx = ctx.WithValue(SubscriberListCacheSizeContextKey, mercure.DefaultSubscriberListCacheSize)
-	} else {
-		ctx = ctx.WithValue(SubscriberListCacheSizeContextKey, *m.SubscriberListCacheSize)
-	}
-
 	m.logger = slog.New(mercure.NewSlogHandler(ctx.Slogger().Handler()))
 
+	if m.SubscriberListCacheSize != nil {
+		m.logger.Warn(`The subscriber_list_cache_size directive is deprecated and ignored: the subscribers are found with the topic index, remove it`)
+	}
+
 	var transport mercure.Transport
-	if transport, err = m.createTransportDeprecated(); err != nil {
+	if transport, err = m.createTransportFromURL(ctx); err != nil {
 		return err
 	}
 
@@ -293,6 +1012,19 @@ func (m *Mercure) Provision(ctx caddy.Context) (err error) { //nolint:funlen,goc
 		opts = append(opts, mercure.WithResourceIdentifier(m.ResourceIdentifier))
 	}
 
+	// Always set, so that removing the directive rebalances a transport
+	// reused across configuration reloads.
+	shards := profile.SubscriberShards
+	if m.SubscriberShards != 0 {
+		shards = m.SubscriberShards
+	}
+
+	opts = append(opts, mercure.WithSubscriberShards(max(shards, 1)))
+
+	if m.Profile != "" {
+		opts = append(opts, mercure.WithProfile(mercure.Profile(m.Profile)))
+	}
+
 	if m.logger.Enabled(ctx, slog.LevelDebug) {
 		opts = append(opts, mercure.WithDebug())
 	}
@@ -306,6 +1038,29 @@ func (m *Mercure) Provision(ctx caddy.Context) (err error) { //nolint:funlen,goc
 		opts = append(opts, mercure.WithIssuers(issuers))
 	}
 
+	if c := m.TokenIntrospection; c != nil {
+		opts = append(opts, mercure.WithTokenIntrospection(mercure.TokenIntrospection{
+			Endpoint:                  c.Endpoint,
+			ClientID:                  c.ClientID,
+			ClientSecret:              c.ClientSecret,
+			CacheTTL:                  time.Duration(c.CacheTTL),
+			CacheSize:                 c.CacheSize,
+			AuthorizationDetailsField: c.AuthorizationDetailsField,
+			SubscribeField:            c.SubscribeField,
+			PublishField:              c.PublishField,
+		}))
+	}
+
+	if c := m.AuthorizationWebhook; c != nil {
+		opts = append(opts, mercure.WithAuthorizationWebhook(mercure.AuthorizationWebhook{
+			URL:              c.URL,
+			CacheTTL:         time.Duration(c.CacheTTL),
+			CacheSize:        c.CacheSize,
+			FailureThreshold: c.FailureThreshold,
+			OpenDuration:     time.Duration(c.OpenDuration),
+		}))
+	}
+
 	if m.Anonymous {
 		opts = append(opts, mercure.WithAnonymous())
 	}
@@ -334,50 +1089,463 @@ func (m *Mercure) Provision(ctx caddy.Context) (err error) { //nolint:funlen,goc
 		opts = append(opts, mercure.WithHeartbeat(time.Duration(*d)))
 	}
 
-	if s := m.MaxRequestBodySize; s != nil {
-		opts = append(opts, mercure.WithMaxRequestBodySize(*s))
+	if m.DisconnectEvents {
+		opts = append(opts, mercure.WithDisconnectEvents(time.Duration(m.DisconnectRetry)))
 	}
 
-	if len(m.PublishOrigins) > 0 {
-		opts = append(opts, mercure.WithPublishOrigins(m.PublishOrigins))
+	if m.SubscriberStats {
+		opts = append(opts, mercure.WithSubscriberStats())
 	}
 
-	if len(m.CORSOrigins) > 0 {
-		opts = append(opts, mercure.WithCORSOrigins(m.CORSOrigins))
+	if m.SubscriberBufferSize != 0 || m.OverflowPolicy != "" {
+		opts = append(opts, mercure.WithSubscriberBuffer(m.SubscriberBufferSize, mercure.OverflowPolicy(m.OverflowPolicy)))
 	}
 
-	if m.ProtocolVersionCompatibility != 0 {
-		opts = append(opts, mercure.WithProtocolVersionCompatibility(m.ProtocolVersionCompatibility))
+	if m.DispatchWatermark != 0 {
+		opts = append(opts, mercure.WithDispatchWatermark(m.DispatchWatermark))
 	}
 
-	eventApp, err := ctx.App("events")
-	if err != nil {
-		return err
+	if c := m.SubscriberBandwidth; c != nil {
+		opts = append(opts, mercure.WithSubscriberBandwidth(mercure.BandwidthLimits{PerConnection: c.PerConnection, PerSubject: c.PerSubject}))
 	}
 
-	var c context.Context
+	switch {
+	case m.WebSocketPublishing:
+		opts = append(opts, mercure.WithWebSocketPublishing())
+	case m.WebSocket:
+		opts = append(opts, mercure.WithWebSocket())
+	}
 
-	c, m.cancel = context.WithCancel(ctx)
-	if err := eventApp.(*caddyevents.App).On("stopping", stoppingHandlerFunc(m.cancel)); err != nil {
-		return err
+	if l := m.HubLink; l != nil {
+		opts = append(opts, mercure.WithHubLink(l.URL, l.Rels...))
 	}
 
-	h, err := mercure.NewHub(c, opts...)
-	if err != nil {
-		return err
+	if m.Discovery {
+		opts = append(opts, mercure.WithDiscovery())
 	}
 
-	m.hub = h
+	if c := m.BroadcastScript; c != nil {
+		opts = append(opts, mercure.WithBroadcastScript(mercure.BroadcastScript{
+			HubURL:   c.HubURL,
+			Topics:   c.Topics,
+			TokenURL: c.TokenURL,
+			Channel:  c.Channel,
+		}))
+	}
 
-	name := m.Name
-	if name == "" {
-		name = "default"
+	if m.LongPolling {
+		opts = append(opts, mercure.WithLongPolling(time.Duration(m.LongPollingTimeout)))
 	}
 
-	info := &hubInfo{
-		hub:       h,
-		transport: transport,
-		name:      name,
+	if d := m.ResumeGracePeriod; d != nil {
+		opts = append(opts, mercure.WithResumeGracePeriod(time.Duration(*d)))
+	}
+
+	if d := m.MaxReplayAge; d != nil {
+		opts = append(opts, mercure.WithMaxReplayAge(time.Duration(*d)))
+	}
+
+	if s := m.MaxRequestBodySize; s != nil {
+		opts = append(opts, mercure.WithMaxRequestBodySize(*s))
+	}
+
+	if len(m.PublishOrigins) > 0 {
+		opts = append(opts, mercure.WithPublishOrigins(m.PublishOrigins))
+	}
+
+	if len(m.CORSOrigins) > 0 {
+		opts = append(opts, mercure.WithCORSOrigins(m.CORSOrigins))
+	}
+
+	if d := m.CORSMaxAge; d != nil {
+		opts = append(opts, mercure.WithCORSMaxAge(time.Duration(*d)))
+	}
+
+	if m.ProtocolVersionCompatibility != 0 {
+		opts = append(opts, mercure.WithProtocolVersionCompatibility(m.ProtocolVersionCompatibility))
+	}
+
+	if len(m.Alerts) > 0 {
+		rules := make([]mercure.AlertRule, 0, len(m.Alerts))
+		for _, a := range m.Alerts {
+			rules = append(rules, mercure.AlertRule{Event: mercure.AlertEvent(a.Event), Threshold: a.Threshold, Window: time.Duration(a.Window)})
+		}
+
+		notifiers := make([]mercure.AlertNotifier, 0, len(m.AlertWebhooks))
+		for _, u := range m.AlertWebhooks {
+			notifiers = append(notifiers, mercure.NewWebhookAlertNotifier(u, nil))
+		}
+
+		opts = append(opts, mercure.WithAlerts(rules, notifiers...))
+	}
+
+	if m.CDNFanOut {
+		opts = append(opts, mercure.WithCDNFanOut(time.Duration(m.CDNEdgeTTL)))
+	}
+
+	if m.ConditionalPublishing {
+		opts = append(opts, mercure.WithConditionalPublishing(m.ConditionalPublishingMaxTopics))
+	}
+
+	if m.DeliveryReceipts {
+		opts = append(opts, mercure.WithDeliveryReceipts())
+	}
+
+	if m.RegexpTopicMatchers {
+		opts = append(opts, mercure.WithRegexpTopicMatchers())
+	}
+
+	if m.QueryTokens {
+		maxLifetime := time.Duration(m.QueryTokenMaxLifetime)
+		if maxLifetime == 0 {
+			maxLifetime = mercure.DefaultQueryTokenMaxLifetime
+		}
+
+		opts = append(opts, mercure.WithQueryTokens(maxLifetime))
+	}
+
+	if m.IdempotentPublishing {
+		opts = append(opts, mercure.WithIdempotentPublishing(time.Duration(m.IdempotencyWindow)))
+	}
+
+	if m.AttachmentsDir != "" {
+		store, err := mercure.NewFileBlobStore(m.AttachmentsDir)
+		if err != nil {
+			return err
+		}
+
+		var key []byte
+		if m.AttachmentSigningKey != "" {
+			key = []byte(m.AttachmentSigningKey)
+		}
+
+		opts = append(opts, mercure.WithAttachments(store, key, time.Duration(m.AttachmentURLTTL)))
+	}
+
+	if m.GuestSessions {
+		opts = append(opts, mercure.WithGuestSessions(m.GuestCookieName))
+	}
+
+	if m.UserInboxes {
+		opts = append(opts, mercure.WithUserInboxes())
+	}
+
+	if m.CapabilityKey != "" {
+		// Any secret is turned into an AES-256 key.
+		key := sha256.Sum256([]byte(m.CapabilityKey))
+
+		opts = append(opts, mercure.WithCapabilityURLs(key[:], time.Duration(m.CapabilityMaxTTL)))
+	}
+
+	if len(m.ResponseHeaders) > 0 {
+		rules := make([]mercure.ResponseHeaderRule, 0, len(m.ResponseHeaders))
+		for _, rh := range m.ResponseHeaders {
+			r := mercure.ResponseHeaderRule{Header: rh.Header}
+			for _, e := range rh.Endpoints {
+				r.Endpoints = append(r.Endpoints, mercure.Endpoint(e))
+			}
+
+			for _, p := range rh.Match {
+				r.Matchers = append(r.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+			}
+
+			for _, p := range rh.MatchURLPattern {
+				r.Matchers = append(r.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+			}
+
+			rules = append(rules, r)
+		}
+
+		opts = append(opts, mercure.WithResponseHeaders(rules...))
+	}
+
+	if len(m.PublishHooks) > 0 || len(m.Federate) > 0 {
+		hooks, err := m.publishHooks()
+		if err != nil {
+			return err
+		}
+
+		federationHooks, err := m.federationHooks()
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, mercure.WithPublishHooks(append(hooks, federationHooks...)...))
+	}
+
+	if m.Federation != nil {
+		f, err := m.federation()
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, mercure.WithFederation(f))
+	}
+
+	if len(m.Enrichers) > 0 {
+		enrichers, err := m.enrichers()
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, mercure.WithEnrichers(enrichers...))
+	}
+
+	if len(m.RoutingRules) > 0 {
+		rules, err := m.routingRules()
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, mercure.WithRoutingRules(rules...))
+	}
+
+	if m.SubscriptionApproval != nil {
+		a, err := m.subscriptionApproval()
+		if err != nil {
+			return err
+		}
+
+		opts = append(opts, mercure.WithSubscriptionApproval(a))
+	}
+
+	if c := m.JSONPatchDeltas; c != nil {
+		d := mercure.JSONPatchDeltas{MaxDocuments: c.MaxDocuments}
+
+		for _, p := range c.Match {
+			d.Matchers = append(d.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+		}
+
+		for _, p := range c.MatchURLPattern {
+			d.Matchers = append(d.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+		}
+
+		opts = append(opts, mercure.WithJSONPatchDeltas(d))
+	}
+
+	if c := m.RetainedValues; c != nil {
+		r := mercure.RetainedValues{MaxTopics: c.MaxTopics}
+
+		for _, p := range c.Match {
+			r.Matchers = append(r.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+		}
+
+		for _, p := range c.MatchURLPattern {
+			r.Matchers = append(r.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+		}
+
+		opts = append(opts, mercure.WithRetainedValues(r))
+	}
+
+	if c := m.RetentionExemptions; c != nil {
+		var e mercure.RetentionExemptions
+
+		for _, p := range c.Exempt {
+			e.Exempt = append(e.Exempt, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+		}
+
+		for _, p := range c.ExemptURLPattern {
+			e.Exempt = append(e.Exempt, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+		}
+
+		for _, p := range c.Forbidden {
+			e.Forbidden = append(e.Forbidden, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+		}
+
+		for _, p := range c.ForbiddenURLPattern {
+			e.Forbidden = append(e.Forbidden, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+		}
+
+		opts = append(opts, mercure.WithRetentionExemptions(e))
+	}
+
+	if m.TopicSequences {
+		opts = append(opts, mercure.WithTopicSequences())
+	}
+
+	if c := m.IdleTopics; c != nil {
+		opts = append(opts, mercure.WithIdleTopics(mercure.IdleTopics{
+			TTL:       time.Duration(c.TTL),
+			Collect:   c.Collect,
+			MaxTopics: c.MaxTopics,
+		}))
+	}
+
+	if c := m.TopicMatcherPersistence; c != nil {
+		opts = append(opts, mercure.WithTopicMatcherPersistence(mercure.TopicMatcherPersistence{
+			Persister:   mercure.NewFileTopicMatcherPersister(c.Path),
+			MaxMatchers: c.MaxMatchers,
+			Interval:    time.Duration(c.Interval),
+		}))
+	}
+
+	if c := m.HealthTopic; c != nil {
+		opts = append(opts, mercure.WithHealthTopic(mercure.HealthTopic{
+			Interval: time.Duration(c.Interval),
+			Node:     c.Node,
+		}))
+	}
+
+	if c := m.SelfCheck; c != nil {
+		repl := caddy.NewReplacer()
+
+		opts = append(opts, mercure.WithSelfCheck(mercure.SelfCheck{
+			Topic:           c.Topic,
+			PublisherToken:  repl.ReplaceKnown(c.PublisherToken, ""),
+			SubscriberToken: repl.ReplaceKnown(c.SubscriberToken, ""),
+			Timeout:         time.Duration(c.Timeout),
+		}))
+	}
+
+	if c := m.TopicCardinality; c != nil {
+		opts = append(opts, mercure.WithTopicCardinalityLimits(mercure.TopicCardinalityLimits{
+			MaxTopics:             c.MaxTopics,
+			MaxTopicsPerPublisher: c.MaxTopicsPerPublisher,
+			Window:                time.Duration(c.Window),
+			LogOnly:               c.LogOnly,
+		}))
+	}
+
+	if c := m.Tenancy; c != nil {
+		p := mercure.TenancyPolicy{Window: time.Duration(c.Window), Tenants: make([]mercure.Tenant, 0, len(c.Tenants))}
+		for _, tc := range c.Tenants {
+			p.Tenants = append(p.Tenants, mercure.Tenant{
+				Name:    tc.Name,
+				Issuers: tc.Issuers,
+				Quotas: mercure.TenantQuotas{
+					MaxConnections:  tc.MaxConnections,
+					MaxTopics:       tc.MaxTopics,
+					MaxHistoryBytes: tc.MaxHistoryBytes,
+					PublishRate:     tc.PublishRate,
+					PublishBurst:    tc.PublishBurst,
+				},
+			})
+		}
+
+		opts = append(opts, mercure.WithTenancy(p))
+	}
+
+	if c := m.DeadLetters; c != nil {
+		var store mercure.DeadLetterStore
+
+		switch c.Store {
+		case "", "memory":
+			store = mercure.NewMemoryDeadLetterStore(c.Size)
+		case "bolt":
+			bt, ok := transport.(*mercure.BoltTransport)
+			if !ok {
+				return errDeadLettersStore
+			}
+
+			store = mercure.NewBoltDeadLetterStore(bt, uint64(max(c.Size, 0)))
+		default:
+			return fmt.Errorf("unknown dead letters store %q", c.Store) //nolint:err113
+		}
+
+		opts = append(opts, mercure.WithDeadLetters(store))
+	}
+
+	if c := m.LameDuck; c != nil {
+		opts = append(opts, mercure.WithLameDuck(mercure.LameDuck{
+			PeerURL:    caddy.NewReplacer().ReplaceKnown(c.PeerURL, ""),
+			RetryAfter: time.Duration(c.RetryAfter),
+		}))
+	}
+
+	if len(m.PollingConnectors) > 0 {
+		repl := caddy.NewReplacer()
+
+		connectors := make([]mercure.PollingConnector, 0, len(m.PollingConnectors))
+		for _, c := range m.PollingConnectors {
+			connectors = append(connectors, mercure.PollingConnector{
+				URL:      c.URL,
+				Interval: time.Duration(c.Interval),
+				Format:   mercure.PollingFormat(c.Format),
+				IDField:  c.IDField,
+				Topic:    c.Topic,
+				Private:  c.Private,
+				Header:   replaceHeaderPlaceholders(repl, c.Header),
+			})
+		}
+
+		opts = append(opts, mercure.WithPollingConnectors(connectors...))
+	}
+
+	if len(m.FileWatchers) > 0 {
+		watchers := make([]mercure.FileWatcher, 0, len(m.FileWatchers))
+		for _, w := range m.FileWatchers {
+			watchers = append(watchers, mercure.FileWatcher{Dir: w.Dir, Interval: time.Duration(w.Interval), Poll: w.Poll, Topic: w.Topic, Private: w.Private})
+		}
+
+		opts = append(opts, mercure.WithFileWatchers(watchers...))
+	}
+
+	if c := m.S3Notifications; c != nil {
+		opts = append(opts, mercure.WithS3Notifications(mercure.S3Notifications{
+			Token:   caddy.NewReplacer().ReplaceKnown(c.Token, ""),
+			Topic:   c.Topic,
+			Private: c.Private,
+		}))
+	}
+
+	var sidecarListener net.Listener
+
+	if c := m.Sidecar; c != nil {
+		if sidecarListener, err = listenAPI(ctx, "sidecar", c.Address, "unix"); err != nil {
+			return err
+		}
+
+		opts = append(opts, mercure.WithSidecar(sidecarListener, caddy.NewReplacer().ReplaceKnown(c.Token, "")))
+	}
+
+	var grpcListener net.Listener
+
+	if m.GRPC != "" {
+		if grpcListener, err = listenAPI(ctx, "gRPC", m.GRPC, "tcp"); err != nil {
+			if sidecarListener != nil {
+				_ = sidecarListener.Close()
+			}
+
+			return err
+		}
+
+		opts = append(opts, mercure.WithGRPC(grpcListener))
+	}
+
+	eventApp, err := ctx.App("events")
+	if err != nil {
+		return err
+	}
+
+	var c context.Context
+
+	c, m.cancel = context.WithCancel(ctx)
+	if err := eventApp.(*caddyevents.App).On("stopping", stoppingHandlerFunc(m.cancel)); err != nil {
+		return err
+	}
+
+	h, err := mercure.NewHub(c, opts...)
+	if err != nil {
+		for _, l := range []net.Listener{sidecarListener, grpcListener} {
+			if l != nil {
+				_ = l.Close()
+			}
+		}
+
+		return err
+	}
+
+	m.hub = h
+
+	name := m.Name
+	if name == "" {
+		name = "default"
+	}
+
+	info := &hubInfo{
+		hub:       h,
+		transport: transport,
+		name:      name,
 	}
 
 	var found bool
@@ -415,7 +1583,7 @@ func (m *Mercure) Cleanup() error {
 		}
 	}
 
-	return m.cleanupTransportDeprecated()
+	return m.cleanupTransportFromURL()
 }
 
 func (m *Mercure) ServeHTTP(w http.ResponseWriter, r *http.Request, next caddyhttp.Handler) error {
@@ -459,219 +1627,1925 @@ func (m *Mercure) UnmarshalCaddyfile(d *caddyfile.Dispenser) (err error) { //nol
 					return err
 				}
 
-			case "dispatch_timeout":
-				if m.DispatchTimeout, err = parseDurationParameter(d); err != nil {
-					return err
-				}
+			case "dispatch_timeout":
+				if m.DispatchTimeout, err = parseDurationParameter(d); err != nil {
+					return err
+				}
+
+			case "heartbeat":
+				if m.Heartbeat, err = parseDurationParameter(d); err != nil {
+					return err
+				}
+
+			case "disconnect_events":
+				m.DisconnectEvents = true
+
+				if d.NextArg() {
+					du, err := caddy.ParseDuration(d.Val())
+					if err != nil {
+						return d.WrapErr(err)
+					}
+
+					m.DisconnectRetry = caddy.Duration(du)
+				}
+
+			case "subscriber_stats":
+				m.SubscriberStats = true
+
+			case "subscriber_buffer":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				size, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.WrapErr(err)
+				}
+
+				if size < 0 {
+					return d.Errf("subscriber_buffer must be >= 0, got %d", size)
+				}
+
+				m.SubscriberBufferSize = size
+
+				if d.NextArg() {
+					switch p := mercure.OverflowPolicy(d.Val()); p {
+					case mercure.OverflowDisconnect, mercure.OverflowDropOldest, mercure.OverflowDropNewest:
+						m.OverflowPolicy = string(p)
+					default:
+						return d.Errf("unknown overflow policy %q", d.Val())
+					}
+				}
+
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "subscriber_bandwidth":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				args := append([]string{d.Val()}, d.RemainingArgs()...)
+				if len(args) > 2 {
+					return d.ArgErr()
+				}
+
+				limits := make([]int64, 2)
+				for i, arg := range args {
+					size, err := humanize.ParseBytes(arg)
+					if err != nil || size > math.MaxInt64 {
+						return d.Errf("invalid subscriber_bandwidth %q", arg)
+					}
+
+					limits[i] = int64(size)
+				}
+
+				m.SubscriberBandwidth = &SubscriberBandwidthConfig{PerConnection: limits[0], PerSubject: limits[1]}
+
+			case "profile":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				if _, err := mercure.Profile(d.Val()).Settings(); err != nil {
+					return d.WrapErr(err)
+				}
+
+				m.Profile = d.Val()
+
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "dispatch_watermark":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				watermark, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.WrapErr(err)
+				}
+
+				if watermark < 0 {
+					return d.Errf("dispatch_watermark must be >= 0, got %d", watermark)
+				}
+
+				m.DispatchWatermark = watermark
+
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "websocket":
+				m.WebSocket = true
+
+				if d.NextArg() {
+					if d.Val() != "publish" {
+						return d.Errf("unknown websocket argument %q", d.Val())
+					}
+
+					m.WebSocketPublishing = true
+				}
+
+			case "hub_link":
+				l := &HubLinkConfig{}
+				if !d.Args(&l.URL) {
+					return d.ArgErr()
+				}
+
+				l.Rels = d.RemainingArgs()
+				m.HubLink = l
+
+			case "discovery":
+				m.Discovery = true
+
+			case "long_polling":
+				m.LongPolling = true
+
+				if d.NextArg() {
+					du, err := caddy.ParseDuration(d.Val())
+					if err != nil {
+						return d.WrapErr(err)
+					}
+
+					m.LongPollingTimeout = caddy.Duration(du)
+				}
+
+			case "max_replay_age":
+				if m.MaxReplayAge, err = parseDurationParameter(d); err != nil {
+					return err
+				}
+
+			case "resume_grace_period":
+				if m.ResumeGracePeriod, err = parseDurationParameter(d); err != nil {
+					return err
+				}
+
+			case "max_request_body_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				size, err := humanize.ParseBytes(d.Val())
+				if err != nil || size > math.MaxInt64 {
+					return d.Errf("invalid max_request_body_size %q", d.Val())
+				}
+
+				s := int64(size)
+				m.MaxRequestBodySize = &s
+
+			case "publisher_jwks_url":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.PublisherJWKSURL = d.Val()
+
+			case "publisher_jwt":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.PublisherJWT.Key = d.Val()
+				if d.NextArg() {
+					m.PublisherJWT.Alg = d.Val()
+				}
+
+			case "subscriber_jwks_url":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.SubscriberJWKSURL = d.Val()
+
+			case "subscriber_jwt":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.SubscriberJWT.Key = d.Val()
+				if d.NextArg() {
+					m.SubscriberJWT.Alg = d.Val()
+				}
+
+			case "publish_origins":
+				m.PublishOrigins = d.RemainingArgs()
+				if len(m.PublishOrigins) == 0 {
+					return d.ArgErr()
+				}
+
+			case "cors_origins":
+				m.CORSOrigins = d.RemainingArgs()
+				if len(m.CORSOrigins) == 0 {
+					return d.ArgErr()
+				}
+
+			case "cors_max_age":
+				if m.CORSMaxAge, err = parseDurationParameter(d); err != nil {
+					return err
+				}
+
+			case "transport":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				name := d.Val()
+				modID := "http.handlers.mercure." + name
+
+				unm, err := caddyfile.UnmarshalModule(d, modID)
+				if err != nil {
+					return err
+				}
+
+				t, ok := unm.(Transport)
+				if !ok {
+					return d.Errf(`module %s (%T) is not a supported transport implementation (requires "github.com/dunglas/mercure/caddy".Transport)`, modID, unm)
+				}
+
+				m.TransportRaw = caddyconfig.JSONModuleObject(t, "name", name, nil)
+
+			case "transport_url":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.assignTransportURL(d.Val())
+
+			case "topic_matcher_cache":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				size, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.WrapErr(err)
+				}
+
+				m.TopicMatcherCacheSize = &size
+
+			case "topic_matcher_persistence":
+				if m.TopicMatcherPersistence, err = parseTopicMatcherPersistenceBlock(d); err != nil {
+					return err
+				}
+
+			case "regexp_topic_matchers":
+				m.RegexpTopicMatchers = true
+
+			case "query_tokens":
+				m.QueryTokens = true
+
+				if d.NextArg() {
+					du, err := caddy.ParseDuration(d.Val())
+					if err != nil {
+						return d.WrapErr(err)
+					}
+
+					m.QueryTokenMaxLifetime = caddy.Duration(du)
+				}
+
+			case "subscriber_list_cache_size":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				size, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.WrapErr(err)
+				}
+
+				if size < 0 {
+					return d.Errf("subscriber_list_cache_size must be >= 0, got %d", size)
+				}
+
+				m.SubscriberListCacheSize = &size
+
+			case "subscriber_shards":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				n, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.WrapErr(err)
+				}
+
+				if n < 1 {
+					return d.Errf("subscriber_shards must be >= 1, got %d", n)
+				}
+
+				m.SubscriberShards = n
+
+			case "cookie_name":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.CookieName = d.Val()
+
+			case "public_url":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.PublicURL = d.Val()
+
+			case "resource_identifier":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.ResourceIdentifier = d.Val()
+
+			case "issuer":
+				ic, err := parseIssuerBlock(d)
+				if err != nil {
+					return err
+				}
+
+				m.Issuers = append(m.Issuers, ic)
+
+			case "token_introspection":
+				if m.TokenIntrospection, err = parseTokenIntrospectionBlock(d); err != nil {
+					return err
+				}
+
+			case "authorization_url":
+				if m.AuthorizationWebhook, err = parseAuthorizationURLBlock(d); err != nil {
+					return err
+				}
+
+			case "alert":
+				ac, err := parseAlertDirective(d)
+				if err != nil {
+					return err
+				}
+
+				m.Alerts = append(m.Alerts, ac)
+
+			case "alert_webhook":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.AlertWebhooks = append(m.AlertWebhooks, d.Val())
+
+			case "cdn_fan_out":
+				m.CDNFanOut = true
+
+				if d.NextArg() {
+					du, err := caddy.ParseDuration(d.Val())
+					if err != nil {
+						return d.WrapErr(err)
+					}
+
+					m.CDNEdgeTTL = caddy.Duration(du)
+				}
+
+			case "conditional_publishing":
+				m.ConditionalPublishing = true
+
+				if d.NextArg() {
+					n, err := strconv.Atoi(d.Val())
+					if err != nil {
+						return d.WrapErr(err)
+					}
+
+					m.ConditionalPublishingMaxTopics = n
+				}
+
+			case "delivery_receipts":
+				m.DeliveryReceipts = true
+
+			case "idempotent_publishing":
+				m.IdempotentPublishing = true
+
+				if d.NextArg() {
+					du, err := caddy.ParseDuration(d.Val())
+					if err != nil {
+						return d.WrapErr(err)
+					}
+
+					m.IdempotencyWindow = caddy.Duration(du)
+				}
+
+			case "attachments":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.AttachmentsDir = d.Val()
+
+				if d.NextArg() {
+					du, err := caddy.ParseDuration(d.Val())
+					if err != nil {
+						return d.WrapErr(err)
+					}
+
+					m.AttachmentURLTTL = caddy.Duration(du)
+				}
+
+			case "guest_sessions":
+				m.GuestSessions = true
+
+				if d.NextArg() {
+					m.GuestCookieName = d.Val()
+				}
+
+			case "user_inboxes":
+				m.UserInboxes = true
+
+			case "capability_key":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.CapabilityKey = d.Val()
+
+				if d.NextArg() {
+					du, err := caddy.ParseDuration(d.Val())
+					if err != nil {
+						return d.WrapErr(err)
+					}
+
+					m.CapabilityMaxTTL = caddy.Duration(du)
+				}
+
+			case "attachment_signing_key":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.AttachmentSigningKey = d.Val()
+
+			case "watch":
+				var w FileWatcherConfig
+				if !d.Args(&w.Dir, &w.Topic) || d.NextArg() {
+					return d.ArgErr()
+				}
+
+				for d.NextBlock(1) {
+					switch d.Val() {
+					case "interval":
+						interval, err := parseDurationParameter(d)
+						if err != nil {
+							return err
+						}
+
+						w.Interval = *interval
+
+					case "poll":
+						w.Poll = true
+
+					case "private":
+						w.Private = true
+
+					default:
+						return d.Errf("unknown watch directive %q", d.Val())
+					}
+				}
+
+				m.FileWatchers = append(m.FileWatchers, w)
+
+			case "s3_notifications":
+				c := &S3NotificationsConfig{}
+				if !d.Args(&c.Token, &c.Topic) || d.NextArg() {
+					return d.ArgErr()
+				}
+
+				for d.NextBlock(1) {
+					if d.Val() != "private" {
+						return d.Errf("unknown s3_notifications directive %q", d.Val())
+					}
+
+					c.Private = true
+				}
+
+				m.S3Notifications = c
+
+			case "sidecar":
+				c := &SidecarConfig{}
+				if !d.Args(&c.Address) {
+					return d.ArgErr()
+				}
+
+				d.Args(&c.Token)
+
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+				m.Sidecar = c
+
+			case "grpc":
+				if !d.Args(&m.GRPC) {
+					return d.ArgErr()
+				}
+
+				if d.NextArg() {
+					return d.ArgErr()
+				}
+
+			case "poll":
+				pc, err := parsePollBlock(d)
+				if err != nil {
+					return err
+				}
+
+				m.PollingConnectors = append(m.PollingConnectors, pc)
+
+			case "publish_hook":
+				ph, err := parsePublishHookBlock(d)
+				if err != nil {
+					return err
+				}
+
+				m.PublishHooks = append(m.PublishHooks, ph)
+
+			case "enricher":
+				e, err := parseEnricherBlock(d)
+				if err != nil {
+					return err
+				}
+
+				m.Enrichers = append(m.Enrichers, e)
+
+			case "routing_rule":
+				rr, err := parseRoutingRuleBlock(d)
+				if err != nil {
+					return err
+				}
+
+				m.RoutingRules = append(m.RoutingRules, rr)
+
+			case "federation":
+				if m.Federation, err = parseFederationBlock(d); err != nil {
+					return err
+				}
+
+			case "federate":
+				fc, err := parseFederateBlock(d)
+				if err != nil {
+					return err
+				}
+
+				m.Federate = append(m.Federate, fc)
+
+			case "subscription_approval":
+				if m.SubscriptionApproval, err = parseSubscriptionApprovalBlock(d); err != nil {
+					return err
+				}
+
+			case "json_patch_deltas":
+				if m.JSONPatchDeltas, err = parseJSONPatchDeltasBlock(d); err != nil {
+					return err
+				}
+
+			case "retained_values":
+				if m.RetainedValues, err = parseRetainedValuesBlock(d); err != nil {
+					return err
+				}
+
+			case "retention_exemptions":
+				if m.RetentionExemptions, err = parseRetentionExemptionsBlock(d); err != nil {
+					return err
+				}
+
+			case "topic_sequences":
+				m.TopicSequences = true
+
+			case "idle_topics":
+				if m.IdleTopics, err = parseIdleTopicsBlock(d); err != nil {
+					return err
+				}
+
+			case "broadcast_script":
+				if m.BroadcastScript, err = parseBroadcastScriptBlock(d); err != nil {
+					return err
+				}
+
+			case "health_topic":
+				if m.HealthTopic, err = parseHealthTopicBlock(d); err != nil {
+					return err
+				}
+
+			case "self_check":
+				if m.SelfCheck, err = parseSelfCheckBlock(d); err != nil {
+					return err
+				}
+
+			case "topic_cardinality":
+				if m.TopicCardinality, err = parseTopicCardinalityBlock(d); err != nil {
+					return err
+				}
+
+			case "tenancy":
+				if m.Tenancy, err = parseTenancyBlock(d); err != nil {
+					return err
+				}
+
+			case "dead_letters":
+				if m.DeadLetters, err = parseDeadLettersBlock(d); err != nil {
+					return err
+				}
+
+			case "lame_duck":
+				if m.LameDuck, err = parseLameDuckBlock(d); err != nil {
+					return err
+				}
+
+			case "response_headers":
+				rh, err := parseResponseHeadersBlock(d)
+				if err != nil {
+					return err
+				}
+
+				m.ResponseHeaders = append(m.ResponseHeaders, rh)
+
+			case "protocol_version_compatibility":
+				if !d.NextArg() {
+					return d.ArgErr()
+				}
+
+				v, err := strconv.Atoi(d.Val())
+				if err != nil {
+					return d.WrapErr(err)
+				}
+
+				if v != 7 && v != 8 {
+					return d.WrapErr(ErrCompatibility)
+				}
+
+				m.ProtocolVersionCompatibility = v
+			}
+		}
+	}
+
+	m.assignTransportURLFromEnv()
+
+	return nil
+}
+
+// parseIssuerBlock parses an "issuer <identifier> { ... }" Caddyfile block.
+func parseIssuerBlock(d *caddyfile.Dispenser) (IssuerConfig, error) {
+	var ic IssuerConfig
+
+	if !d.NextArg() {
+		return ic, d.ArgErr() //nolint:wrapcheck
+	}
+
+	ic.Identifier = d.Val()
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "authorization_server":
+			ic.AuthorizationServer = true
+
+		case "audience":
+			ic.Audiences = append(ic.Audiences, d.RemainingArgs()...)
+			if len(ic.Audiences) == 0 {
+				return ic, d.ArgErr() //nolint:wrapcheck
+			}
+
+		case "claim_namespace":
+			if !d.NextArg() {
+				return ic, d.ArgErr() //nolint:wrapcheck
+			}
+
+			ic.ClaimNamespace = d.Val()
+
+		case "publisher":
+			v, err := parseVerifierBlock(d)
+			if err != nil {
+				return ic, err
+			}
+
+			ic.Publisher = v
+
+		case "subscriber":
+			v, err := parseVerifierBlock(d)
+			if err != nil {
+				return ic, err
+			}
+
+			ic.Subscriber = v
+
+		default:
+			return ic, d.Errf("unknown issuer directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return ic, nil
+}
+
+// parseResponseHeadersBlock parses a "response_headers [<endpoint...>] { ... }"
+// Caddyfile block.
+func parseResponseHeadersBlock(d *caddyfile.Dispenser) (ResponseHeadersConfig, error) {
+	rh := ResponseHeadersConfig{Endpoints: d.RemainingArgs(), Header: http.Header{}}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "match":
+			rh.Match = append(rh.Match, d.RemainingArgs()...)
+
+		case "match_urlpattern":
+			rh.MatchURLPattern = append(rh.MatchURLPattern, d.RemainingArgs()...)
+
+		case "header":
+			args := d.RemainingArgs()
+			if len(args) != 2 {
+				return rh, d.ArgErr() //nolint:wrapcheck
+			}
+
+			rh.Header.Add(args[0], args[1])
+
+		default:
+			return rh, d.Errf("unknown response_headers directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return rh, nil
+}
+
+// publishHooks creates the configured publish hooks.
+func (m *Mercure) publishHooks() ([]mercure.PublishHook, error) {
+	repl := caddy.NewReplacer()
+	hooks := make([]mercure.PublishHook, 0, len(m.PublishHooks))
+
+	for _, c := range m.PublishHooks {
+		c.URL = repl.ReplaceKnown(c.URL, "")
+		c.Header = replaceHeaderPlaceholders(repl, c.Header)
+
+		ph := mercure.PublishHook{Private: c.Private}
+
+		for _, p := range c.Match {
+			ph.Matchers = append(ph.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+		}
+
+		for _, p := range c.MatchURLPattern {
+			ph.Matchers = append(ph.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+		}
+
+		var err error
+		if ph.Target, err = newPublishHookTarget(c); err != nil {
+			return nil, err
+		}
+
+		hooks = append(hooks, ph)
+	}
+
+	return hooks, nil
+}
+
+// enrichers creates the configured enrichers.
+func (m *Mercure) enrichers() ([]mercure.Enricher, error) {
+	repl := caddy.NewReplacer()
+	enrichers := make([]mercure.Enricher, 0, len(m.Enrichers))
+
+	for _, c := range m.Enrichers {
+		e := mercure.Enricher{Name: c.Name, Timeout: time.Duration(c.Timeout)}
+
+		for _, p := range c.Match {
+			e.Matchers = append(e.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+		}
+
+		for _, p := range c.MatchURLPattern {
+			e.Matchers = append(e.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+		}
+
+		var err error
+		if e.Lookup, err = mercure.NewHTTPEnricherLookup(repl.ReplaceKnown(c.URL, ""), c.Key, replaceHeaderPlaceholders(repl, c.Header), nil, time.Duration(c.CacheTTL)); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		enrichers = append(enrichers, e)
+	}
+
+	return enrichers, nil
+}
+
+// routingRules creates the configured routing rules.
+func (m *Mercure) routingRules() ([]mercure.RoutingRule, error) {
+	repl := caddy.NewReplacer()
+	rules := make([]mercure.RoutingRule, 0, len(m.RoutingRules))
+
+	for _, c := range m.RoutingRules {
+		r := mercure.RoutingRule{
+			Name:      c.Name,
+			Predicate: c.When,
+			Action:    mercure.RoutingAction(c.Action),
+			Topic:     c.Topic,
+			Template:  c.Template,
+		}
+
+		for _, p := range c.Match {
+			r.Matchers = append(r.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+		}
+
+		for _, p := range c.MatchURLPattern {
+			r.Matchers = append(r.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+		}
+
+		if c.Escalate != nil {
+			e := *c.Escalate
+			e.URL = repl.ReplaceKnown(e.URL, "")
+			e.Header = replaceHeaderPlaceholders(repl, e.Header)
+
+			var err error
+			if r.Target, err = newPublishHookTarget(e); err != nil {
+				return nil, err
+			}
+		}
+
+		rules = append(rules, r)
+	}
+
+	return rules, nil
+}
+
+// subscriptionApproval creates the configured subscription approval.
+func (m *Mercure) subscriptionApproval() (mercure.SubscriptionApproval, error) {
+	c := m.SubscriptionApproval
+	a := mercure.SubscriptionApproval{Topic: c.Topic, Timeout: time.Duration(c.Timeout)}
+
+	for _, p := range c.Match {
+		a.Matchers = append(a.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: p})
+	}
+
+	for _, p := range c.MatchURLPattern {
+		a.Matchers = append(a.Matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeURLPattern, Pattern: p})
+	}
+
+	if c.Approver != nil {
+		repl := caddy.NewReplacer()
+		ac := *c.Approver
+		ac.URL = repl.ReplaceKnown(ac.URL, "")
+		ac.Header = replaceHeaderPlaceholders(repl, ac.Header)
+
+		var err error
+		if a.Target, err = newPublishHookTarget(ac); err != nil {
+			return a, err
+		}
+	}
+
+	return a, nil
+}
+
+// newPublishHookTarget creates the target of a publish hook, whose
+// placeholders have been replaced.
+//
+//nolint:ireturn
+func newPublishHookTarget(c PublishHookConfig) (mercure.PublishHookTarget, error) {
+	var (
+		target mercure.PublishHookTarget
+		err    error
+	)
+
+	switch c.Type {
+	case "http":
+		target = mercure.NewHTTPPublishHookTarget(c.URL, c.Header, nil)
+	case "nats":
+		target, err = mercure.NewNATSPublishHookTarget(c.URL, c.Target)
+	case "kafka":
+		target, err = mercure.NewKafkaPublishHookTarget(c.URL, c.Target, c.Header, nil)
+	case "lambda":
+		target, err = mercure.NewLambdaPublishHookTarget(c.URL, awsPublishHookConfigFromEnv())
+	case "sns":
+		target, err = mercure.NewSNSPublishHookTarget(c.URL, awsPublishHookConfigFromEnv())
+	case "pubsub":
+		var pc mercure.PubSubPublishHookConfig
+		if pc, err = pubSubPublishHookConfigFromEnv(); err == nil {
+			target, err = mercure.NewPubSubPublishHookTarget(c.URL, pc)
+		}
+	default:
+		err = fmt.Errorf("%w %q", errUnknownPublishHookType, c.Type)
+	}
+
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return target, nil
+}
+
+// listenAPI listens on the address of an API served by the hub, the network
+// defaulting to defaultNetwork. Caddy shares the listeners between the
+// configurations, so reloads don't interrupt the API.
+func listenAPI(ctx caddy.Context, api, address, defaultNetwork string) (net.Listener, error) {
+	if strings.HasPrefix(address, "/") {
+		address = "unix/" + address
+	}
+
+	na, err := caddy.ParseNetworkAddressWithDefaults(address, defaultNetwork, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s address %q: %w", api, address, err)
+	}
+
+	ln, err := na.Listen(ctx, 0, net.ListenConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen on the %s address %q: %w", api, address, err)
+	}
+
+	l, ok := ln.(net.Listener)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", errStreamNetwork, address)
+	}
+
+	return l, nil
+}
+
+// awsPublishHookConfigFromEnv reads the region, the credentials and the
+// endpoint from the standard environment variables of the AWS SDKs.
+func awsPublishHookConfigFromEnv() mercure.AWSPublishHookConfig {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+
+	return mercure.AWSPublishHookConfig{
+		Region:          region,
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+	}
+}
+
+// pubSubPublishHookConfigFromEnv uses the emulator when PUBSUB_EMULATOR_HOST
+// is set, the service account key GOOGLE_APPLICATION_CREDENTIALS points to
+// otherwise, and falls back to the metadata server.
+func pubSubPublishHookConfigFromEnv() (mercure.PubSubPublishHookConfig, error) {
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		return mercure.PubSubPublishHookConfig{Endpoint: "http://" + host, Unauthenticated: true}, nil
+	}
+
+	var c mercure.PubSubPublishHookConfig
+
+	if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+		key, err := os.ReadFile(path)
+		if err != nil {
+			return c, fmt.Errorf("unable to read the Google credentials: %w", err)
+		}
+
+		c.ServiceAccountKey = key
+	}
+
+	return c, nil
+}
+
+// replaceHeaderPlaceholders returns a copy of the headers with the global
+// placeholders, such as {env.*}, replaced, so secrets can be kept out of the
+// configuration.
+func replaceHeaderPlaceholders(repl *caddy.Replacer, header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	replaced := make(http.Header, len(header))
+	for k, values := range header {
+		for _, v := range values {
+			replaced.Add(k, repl.ReplaceKnown(v, ""))
+		}
+	}
+
+	return replaced
+}
+
+// parsePollBlock parses a "poll <url> <topic> { ... }" Caddyfile block.
+func parsePollBlock(d *caddyfile.Dispenser) (PollingConnectorConfig, error) {
+	var pc PollingConnectorConfig
+	if !d.Args(&pc.URL, &pc.Topic) || d.NextArg() {
+		return pc, d.ArgErr() //nolint:wrapcheck
+	}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "interval":
+			interval, err := parseDurationParameter(d)
+			if err != nil {
+				return pc, err
+			}
+
+			pc.Interval = *interval
+
+		case "format":
+			if !d.Args(&pc.Format) {
+				return pc, d.ArgErr() //nolint:wrapcheck
+			}
+
+		case "id_field":
+			if !d.Args(&pc.IDField) {
+				return pc, d.ArgErr() //nolint:wrapcheck
+			}
+
+		case "private":
+			pc.Private = true
+
+		case "header":
+			args := d.RemainingArgs()
+			if len(args) != 2 {
+				return pc, d.ArgErr() //nolint:wrapcheck
+			}
+
+			if pc.Header == nil {
+				pc.Header = http.Header{}
+			}
+
+			pc.Header.Add(args[0], args[1])
+
+		default:
+			return pc, d.Errf("unknown poll directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return pc, nil
+}
+
+// parsePublishHookBlock parses a "publish_hook <type> <url> [<target>] { ... }"
+// Caddyfile block.
+func parsePublishHookBlock(d *caddyfile.Dispenser) (PublishHookConfig, error) {
+	args := d.RemainingArgs()
+	if len(args) < 2 || len(args) > 3 {
+		return PublishHookConfig{}, d.ArgErr() //nolint:wrapcheck
+	}
+
+	ph := PublishHookConfig{Type: args[0], URL: args[1]}
+	if len(args) == 3 {
+		ph.Target = args[2]
+	}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "match":
+			ph.Match = append(ph.Match, d.RemainingArgs()...)
+
+		case "match_urlpattern":
+			ph.MatchURLPattern = append(ph.MatchURLPattern, d.RemainingArgs()...)
+
+		case "private":
+			ph.Private = true
+
+		case "header":
+			args := d.RemainingArgs()
+			if len(args) != 2 {
+				return ph, d.ArgErr() //nolint:wrapcheck
+			}
+
+			if ph.Header == nil {
+				ph.Header = http.Header{}
+			}
+
+			ph.Header.Add(args[0], args[1])
+
+		default:
+			return ph, d.Errf("unknown publish_hook directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return ph, nil
+}
+
+// parseEnricherBlock parses an "enricher <name> <url> { ... }" Caddyfile
+// block.
+func parseEnricherBlock(d *caddyfile.Dispenser) (EnricherConfig, error) {
+	args := d.RemainingArgs()
+	if len(args) != 2 {
+		return EnricherConfig{}, d.ArgErr() //nolint:wrapcheck
+	}
+
+	e := EnricherConfig{Name: args[0], URL: args[1]}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "key":
+			if !d.NextArg() {
+				return e, d.ArgErr() //nolint:wrapcheck
+			}
+
+			e.Key = d.Val()
+
+		case "match":
+			e.Match = append(e.Match, d.RemainingArgs()...)
+
+		case "match_urlpattern":
+			e.MatchURLPattern = append(e.MatchURLPattern, d.RemainingArgs()...)
+
+		case "timeout":
+			t, err := parseDurationParameter(d)
+			if err != nil {
+				return e, err
+			}
+
+			e.Timeout = *t
+
+		case "cache_ttl":
+			t, err := parseDurationParameter(d)
+			if err != nil {
+				return e, err
+			}
+
+			e.CacheTTL = *t
+
+		case "header":
+			args := d.RemainingArgs()
+			if len(args) != 2 {
+				return e, d.ArgErr() //nolint:wrapcheck
+			}
+
+			if e.Header == nil {
+				e.Header = http.Header{}
+			}
+
+			e.Header.Add(args[0], args[1])
+
+		default:
+			return e, d.Errf("unknown enricher directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return e, nil
+}
+
+// parseRoutingRuleBlock parses a "routing_rule [<name>] { ... }" Caddyfile
+// block.
+func parseRoutingRuleBlock(d *caddyfile.Dispenser) (RoutingRuleConfig, error) {
+	var rr RoutingRuleConfig
+
+	switch args := d.RemainingArgs(); len(args) {
+	case 0:
+	case 1:
+		rr.Name = args[0]
+	default:
+		return rr, d.ArgErr() //nolint:wrapcheck
+	}
+
+	setAction := func(action string) error {
+		if rr.Action != "" {
+			return d.Errf("routing_rule: %q conflicts with %q", action, rr.Action) //nolint:wrapcheck
+		}
+
+		rr.Action = action
+
+		return nil
+	}
+
+	for d.NextBlock(1) {
+		switch v := d.Val(); v {
+		case "match":
+			rr.Match = append(rr.Match, d.RemainingArgs()...)
+
+		case "match_urlpattern":
+			rr.MatchURLPattern = append(rr.MatchURLPattern, d.RemainingArgs()...)
+
+		case "when":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return rr, d.ArgErr() //nolint:wrapcheck
+			}
+
+			rr.When = strings.Join(args, " ")
+
+		case "drop":
+			if d.NextArg() {
+				return rr, d.ArgErr() //nolint:wrapcheck
+			}
+
+			if err := setAction(v); err != nil {
+				return rr, err
+			}
+
+		case "add_topic", "transform":
+			if !d.NextArg() {
+				return rr, d.ArgErr() //nolint:wrapcheck
+			}
+
+			if v == "add_topic" {
+				rr.Topic = d.Val()
+			} else {
+				rr.Template = d.Val()
+			}
+
+			if d.NextArg() {
+				return rr, d.ArgErr() //nolint:wrapcheck
+			}
+
+			if err := setAction(v); err != nil {
+				return rr, err
+			}
+
+		case "escalate":
+			args := d.RemainingArgs()
+			if len(args) < 2 || len(args) > 3 {
+				return rr, d.ArgErr() //nolint:wrapcheck
+			}
+
+			e := &PublishHookConfig{Type: args[0], URL: args[1]}
+			if len(args) == 3 {
+				e.Target = args[2]
+			}
+
+			rr.Escalate = e
+
+			if err := setAction(v); err != nil {
+				return rr, err
+			}
+
+		default:
+			return rr, d.Errf("unknown routing_rule directive %q", v) //nolint:wrapcheck
+		}
+	}
+
+	if rr.Action == "" {
+		return rr, d.Err("routing_rule: missing action") //nolint:wrapcheck
+	}
+
+	return rr, nil
+}
+
+// parseJSONPatchDeltasBlock parses a "json_patch_deltas { ... }" Caddyfile
+// block.
+func parseJSONPatchDeltasBlock(d *caddyfile.Dispenser) (*JSONPatchDeltasConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	c := &JSONPatchDeltasConfig{}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "match":
+			c.Match = append(c.Match, d.RemainingArgs()...)
+
+		case "match_urlpattern":
+			c.MatchURLPattern = append(c.MatchURLPattern, d.RemainingArgs()...)
+
+		case "max_documents":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			c.MaxDocuments = n
+
+		default:
+			return nil, d.Errf("unknown json_patch_deltas directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseRetainedValuesBlock parses a "retained_values { ... }" Caddyfile block.
+func parseRetainedValuesBlock(d *caddyfile.Dispenser) (*RetainedValuesConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	c := &RetainedValuesConfig{}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "match":
+			c.Match = append(c.Match, d.RemainingArgs()...)
+
+		case "match_urlpattern":
+			c.MatchURLPattern = append(c.MatchURLPattern, d.RemainingArgs()...)
+
+		case "max_topics":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			c.MaxTopics = n
+
+		default:
+			return nil, d.Errf("unknown retained_values directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseRetentionExemptionsBlock parses a "retention_exemptions { ... }"
+// Caddyfile block.
+func parseRetentionExemptionsBlock(d *caddyfile.Dispenser) (*RetentionExemptionsConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	c := &RetentionExemptionsConfig{}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "exempt":
+			c.Exempt = append(c.Exempt, d.RemainingArgs()...)
+
+		case "exempt_urlpattern":
+			c.ExemptURLPattern = append(c.ExemptURLPattern, d.RemainingArgs()...)
+
+		case "forbidden":
+			c.Forbidden = append(c.Forbidden, d.RemainingArgs()...)
+
+		case "forbidden_urlpattern":
+			c.ForbiddenURLPattern = append(c.ForbiddenURLPattern, d.RemainingArgs()...)
+
+		default:
+			return nil, d.Errf("unknown retention_exemptions directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseTokenIntrospectionBlock parses a "token_introspection <endpoint> {
+// ... }" Caddyfile block.
+func parseTokenIntrospectionBlock(d *caddyfile.Dispenser) (*TokenIntrospectionConfig, error) {
+	if !d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	c := &TokenIntrospectionConfig{Endpoint: d.Val()}
+
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	for d.NextBlock(1) {
+		directive := d.Val()
+		if !d.NextArg() {
+			return nil, d.ArgErr() //nolint:wrapcheck
+		}
+
+		switch directive {
+		case "client_id":
+			c.ClientID = d.Val()
+
+		case "client_secret":
+			c.ClientSecret = d.Val()
+
+		case "cache_ttl":
+			du, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			c.CacheTTL = caddy.Duration(du)
+
+		case "cache_size":
+			size, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			c.CacheSize = size
+
+		case "authorization_details_field":
+			c.AuthorizationDetailsField = d.Val()
+
+		case "subscribe_field":
+			c.SubscribeField = d.Val()
+
+		case "publish_field":
+			c.PublishField = d.Val()
+
+		default:
+			return nil, d.Errf("unknown token_introspection directive %q", directive) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseAuthorizationURLBlock parses an "authorization_url <url> { ... }"
+// Caddyfile block.
+func parseAuthorizationURLBlock(d *caddyfile.Dispenser) (*AuthorizationWebhookConfig, error) {
+	if !d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	c := &AuthorizationWebhookConfig{URL: d.Val()}
+
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	for d.NextBlock(1) {
+		directive := d.Val()
+		if !d.NextArg() {
+			return nil, d.ArgErr() //nolint:wrapcheck
+		}
+
+		switch directive {
+		case "cache_ttl", "open_duration":
+			du, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			if directive == "cache_ttl" {
+				c.CacheTTL = caddy.Duration(du)
+			} else {
+				c.OpenDuration = caddy.Duration(du)
+			}
+
+		case "cache_size", "failure_threshold":
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			if directive == "cache_size" {
+				c.CacheSize = n
+			} else {
+				c.FailureThreshold = n
+			}
+
+		default:
+			return nil, d.Errf("unknown authorization_url directive %q", directive) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseBroadcastScriptBlock parses a "broadcast_script { ... }" Caddyfile
+// block.
+func parseBroadcastScriptBlock(d *caddyfile.Dispenser) (*BroadcastScriptConfig, error) {
+	c := &BroadcastScriptConfig{}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "topic":
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			c.Topics = append(c.Topics, args...)
+
+		case "hub_url":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			c.HubURL = d.Val()
+
+		case "token_url":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			c.TokenURL = d.Val()
+
+		case "channel":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			c.Channel = d.Val()
+
+		default:
+			return nil, d.Errf("unknown broadcast_script directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseIdleTopicsBlock parses an "idle_topics <ttl> { ... }" Caddyfile block.
+func parseIdleTopicsBlock(d *caddyfile.Dispenser) (*IdleTopicsConfig, error) {
+	if !d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	ttl, err := caddy.ParseDuration(d.Val())
+	if err != nil {
+		return nil, d.WrapErr(err) //nolint:wrapcheck
+	}
+
+	c := &IdleTopicsConfig{TTL: caddy.Duration(ttl)}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "collect":
+			c.Collect = true
+
+		case "max_topics":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			c.MaxTopics = n
+
+		default:
+			return nil, d.Errf("unknown idle_topics directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseHealthTopicBlock parses a "health_topic [<interval>] { ... }"
+// Caddyfile block.
+func parseHealthTopicBlock(d *caddyfile.Dispenser) (*HealthTopicConfig, error) {
+	c := &HealthTopicConfig{}
+
+	if d.NextArg() {
+		interval, err := caddy.ParseDuration(d.Val())
+		if err != nil {
+			return nil, d.WrapErr(err) //nolint:wrapcheck
+		}
+
+		c.Interval = caddy.Duration(interval)
+	}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "node":
+			if !d.Args(&c.Node) {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+		default:
+			return nil, d.Errf("unknown health_topic directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseTopicMatcherPersistenceBlock parses a
+// "topic_matcher_persistence <path> { ... }" Caddyfile block.
+func parseTopicMatcherPersistenceBlock(d *caddyfile.Dispenser) (*TopicMatcherPersistenceConfig, error) {
+	c := &TopicMatcherPersistenceConfig{}
+
+	if !d.Args(&c.Path) {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "max_matchers":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			c.MaxMatchers = n
+
+		case "interval":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			interval, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			c.Interval = caddy.Duration(interval)
+
+		default:
+			return nil, d.Errf("unknown topic_matcher_persistence directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseSelfCheckBlock parses a "self_check { ... }" Caddyfile block.
+func parseSelfCheckBlock(d *caddyfile.Dispenser) (*SelfCheckConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	c := &SelfCheckConfig{}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "topic":
+			if !d.Args(&c.Topic) {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+		case "publisher_token":
+			if !d.Args(&c.PublisherToken) {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+		case "subscriber_token":
+			if !d.Args(&c.SubscriberToken) {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+		case "timeout":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			timeout, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
+
+			c.Timeout = caddy.Duration(timeout)
+
+		default:
+			return nil, d.Errf("unknown self_check directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return c, nil
+}
+
+// parseTopicCardinalityBlock parses a "topic_cardinality { ... }" Caddyfile
+// block.
+func parseTopicCardinalityBlock(d *caddyfile.Dispenser) (*TopicCardinalityConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
 
-			case "heartbeat":
-				if m.Heartbeat, err = parseDurationParameter(d); err != nil {
-					return err
-				}
+	c := &TopicCardinalityConfig{}
 
-			case "max_request_body_size":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "max_topics", "max_topics_per_publisher":
+			directive := d.Val()
 
-				size, err := humanize.ParseBytes(d.Val())
-				if err != nil || size > math.MaxInt64 {
-					return d.Errf("invalid max_request_body_size %q", d.Val())
-				}
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
 
-				s := int64(size)
-				m.MaxRequestBodySize = &s
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
 
-			case "publisher_jwks_url":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+			if directive == "max_topics" {
+				c.MaxTopics = n
+			} else {
+				c.MaxTopicsPerPublisher = n
+			}
 
-				m.PublisherJWKSURL = d.Val()
+		case "window":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
 
-			case "publisher_jwt":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+			w, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
 
-				m.PublisherJWT.Key = d.Val()
-				if d.NextArg() {
-					m.PublisherJWT.Alg = d.Val()
-				}
+			c.Window = caddy.Duration(w)
 
-			case "subscriber_jwks_url":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+		case "log_only":
+			c.LogOnly = true
 
-				m.SubscriberJWKSURL = d.Val()
+		default:
+			return nil, d.Errf("unknown topic_cardinality directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
 
-			case "subscriber_jwt":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+	return c, nil
+}
 
-				m.SubscriberJWT.Key = d.Val()
-				if d.NextArg() {
-					m.SubscriberJWT.Alg = d.Val()
-				}
+// parseTenancyBlock parses a "tenancy { ... }" Caddyfile block.
+func parseTenancyBlock(d *caddyfile.Dispenser) (*TenancyConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
 
-			case "publish_origins":
-				m.PublishOrigins = d.RemainingArgs()
-				if len(m.PublishOrigins) == 0 {
-					return d.ArgErr()
-				}
+	c := &TenancyConfig{}
 
-			case "cors_origins":
-				m.CORSOrigins = d.RemainingArgs()
-				if len(m.CORSOrigins) == 0 {
-					return d.ArgErr()
-				}
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "window":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
 
-			case "transport":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+			w, err := caddy.ParseDuration(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
 
-				name := d.Val()
-				modID := "http.handlers.mercure." + name
+			c.Window = caddy.Duration(w)
 
-				unm, err := caddyfile.UnmarshalModule(d, modID)
-				if err != nil {
-					return err
-				}
+		case "tenant":
+			tc, err := parseTenantBlock(d)
+			if err != nil {
+				return nil, err
+			}
 
-				t, ok := unm.(Transport)
-				if !ok {
-					return d.Errf(`module %s (%T) is not a supported transport implementation (requires "github.com/dunglas/mercure/caddy".Transport)`, modID, unm)
-				}
+			c.Tenants = append(c.Tenants, tc)
 
-				m.TransportRaw = caddyconfig.JSONModuleObject(t, "name", name, nil)
+		default:
+			return nil, d.Errf("unknown tenancy directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
 
-			case "transport_url":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+	return c, nil
+}
 
-				m.assignDeprecatedTransportURL(d.Val())
+// parseTenantBlock parses a "tenant <name> { ... }" block of a tenancy
+// block.
+func parseTenantBlock(d *caddyfile.Dispenser) (TenantConfig, error) {
+	var tc TenantConfig
 
-			case "topic_matcher_cache":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+	if !d.NextArg() {
+		return tc, d.ArgErr() //nolint:wrapcheck
+	}
 
-				size, err := strconv.Atoi(d.Val())
-				if err != nil {
-					return d.WrapErr(err)
-				}
+	tc.Name = d.Val()
 
-				m.TopicMatcherCacheSize = &size
-			case "subscriber_list_cache_size":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+	if d.NextArg() {
+		return tc, d.ArgErr() //nolint:wrapcheck
+	}
 
-				size, err := strconv.Atoi(d.Val())
-				if err != nil {
-					return d.WrapErr(err)
-				}
+	for d.NextBlock(2) {
+		directive := d.Val()
 
-				if size < 0 {
-					return d.Errf("subscriber_list_cache_size must be >= 0, got %d", size)
-				}
+		if directive == "issuer" {
+			args := d.RemainingArgs()
+			if len(args) == 0 {
+				return tc, d.ArgErr() //nolint:wrapcheck
+			}
 
-				m.SubscriberListCacheSize = &size
+			tc.Issuers = append(tc.Issuers, args...)
 
-			case "cookie_name":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+			continue
+		}
 
-				m.CookieName = d.Val()
+		if !d.NextArg() {
+			return tc, d.ArgErr() //nolint:wrapcheck
+		}
 
-			case "public_url":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+		var err error
+
+		switch directive {
+		case "max_connections":
+			tc.MaxConnections, err = strconv.Atoi(d.Val())
+		case "max_topics":
+			tc.MaxTopics, err = strconv.Atoi(d.Val())
+		case "max_history_bytes":
+			var size uint64
+			if size, err = humanize.ParseBytes(d.Val()); err == nil && size > math.MaxInt64 {
+				return tc, d.Errf("invalid max_history_bytes %q", d.Val()) //nolint:wrapcheck
+			}
 
-				m.PublicURL = d.Val()
+			tc.MaxHistoryBytes = int64(size)
+		case "publish_rate":
+			tc.PublishRate, err = strconv.ParseFloat(d.Val(), 64)
+		case "publish_burst":
+			tc.PublishBurst, err = strconv.Atoi(d.Val())
+		default:
+			return tc, d.Errf("unknown tenant directive %q", directive) //nolint:wrapcheck
+		}
 
-			case "resource_identifier":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+		if err != nil {
+			return tc, d.WrapErr(err) //nolint:wrapcheck
+		}
+	}
 
-				m.ResourceIdentifier = d.Val()
+	return tc, nil
+}
 
-			case "issuer":
-				ic, err := parseIssuerBlock(d)
-				if err != nil {
-					return err
-				}
+// parseDeadLettersBlock parses a "dead_letters { ... }" Caddyfile block.
+func parseDeadLettersBlock(d *caddyfile.Dispenser) (*DeadLettersConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
 
-				m.Issuers = append(m.Issuers, ic)
+	c := &DeadLettersConfig{}
 
-			case "protocol_version_compatibility":
-				if !d.NextArg() {
-					return d.ArgErr()
-				}
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "size":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
 
-				v, err := strconv.Atoi(d.Val())
-				if err != nil {
-					return d.WrapErr(err)
-				}
+			n, err := strconv.Atoi(d.Val())
+			if err != nil {
+				return nil, d.WrapErr(err) //nolint:wrapcheck
+			}
 
-				if v != 7 && v != 8 {
-					return d.WrapErr(ErrCompatibility)
-				}
+			c.Size = n
 
-				m.ProtocolVersionCompatibility = v
+		case "store":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
 			}
+
+			c.Store = d.Val()
+
+		default:
+			return nil, d.Errf("unknown dead_letters directive %q", d.Val()) //nolint:wrapcheck
 		}
 	}
 
-	m.assignDeprecatedTransportURLForEnv()
-
-	return nil
+	return c, nil
 }
 
-// parseIssuerBlock parses an "issuer <identifier> { ... }" Caddyfile block.
-func parseIssuerBlock(d *caddyfile.Dispenser) (IssuerConfig, error) {
-	var ic IssuerConfig
-
-	if !d.NextArg() {
-		return ic, d.ArgErr() //nolint:wrapcheck
+// parseSubscriptionApprovalBlock parses a "subscription_approval { ... }"
+// Caddyfile block.
+func parseSubscriptionApprovalBlock(d *caddyfile.Dispenser) (*SubscriptionApprovalConfig, error) {
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
 	}
 
-	ic.Identifier = d.Val()
+	sa := &SubscriptionApprovalConfig{}
 
 	for d.NextBlock(1) {
 		switch d.Val() {
-		case "authorization_server":
-			ic.AuthorizationServer = true
+		case "match":
+			sa.Match = append(sa.Match, d.RemainingArgs()...)
 
-		case "publisher":
-			v, err := parseVerifierBlock(d)
+		case "match_urlpattern":
+			sa.MatchURLPattern = append(sa.MatchURLPattern, d.RemainingArgs()...)
+
+		case "topic":
+			if !d.NextArg() {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			sa.Topic = d.Val()
+
+		case "approver":
+			args := d.RemainingArgs()
+			if len(args) < 2 || len(args) > 3 {
+				return nil, d.ArgErr() //nolint:wrapcheck
+			}
+
+			sa.Approver = &PublishHookConfig{Type: args[0], URL: args[1]}
+			if len(args) == 3 {
+				sa.Approver.Target = args[2]
+			}
+
+		case "timeout":
+			t, err := parseDurationParameter(d)
 			if err != nil {
-				return ic, err
+				return nil, err
 			}
 
-			ic.Publisher = v
+			sa.Timeout = *t
 
-		case "subscriber":
-			v, err := parseVerifierBlock(d)
+		default:
+			return nil, d.Errf("unknown subscription_approval directive %q", d.Val()) //nolint:wrapcheck
+		}
+	}
+
+	return sa, nil
+}
+
+// parseLameDuckBlock parses a "lame_duck [<peer_url>] { ... }" Caddyfile
+// block.
+func parseLameDuckBlock(d *caddyfile.Dispenser) (*LameDuckConfig, error) {
+	ld := &LameDuckConfig{}
+
+	d.Args(&ld.PeerURL)
+
+	if d.NextArg() {
+		return nil, d.ArgErr() //nolint:wrapcheck
+	}
+
+	for d.NextBlock(1) {
+		switch d.Val() {
+		case "retry_after":
+			t, err := parseDurationParameter(d)
 			if err != nil {
-				return ic, err
+				return nil, err
 			}
 
-			ic.Subscriber = v
+			ld.RetryAfter = *t
 
 		default:
-			return ic, d.Errf("unknown issuer directive %q", d.Val()) //nolint:wrapcheck
+			return nil, d.Errf("unknown lame_duck directive %q", d.Val()) //nolint:wrapcheck
 		}
 	}
 
-	return ic, nil
+	return ld, nil
 }
 
 // parseVerifierBlock parses a "publisher"/"subscriber" verifier subblock. The
@@ -707,11 +3581,32 @@ func parseVerifierBlock(d *caddyfile.Dispenser) (VerifierConfig, error) {
 			v.JWKSURL = d.Val()
 			v.JWKSAlgorithms = d.RemainingArgs()
 
+		case "jwks_refresh_interval", "jwks_unknown_kid_refresh_interval":
+			directive := d.Val()
+			if !d.NextArg() {
+				return v, d.ArgErr() //nolint:wrapcheck
+			}
+
+			i, err := caddy.ParseDuration(d.Val())
+			if err != nil || i <= 0 {
+				return v, d.Errf("invalid %s %q", directive, d.Val()) //nolint:wrapcheck
+			}
+
+			if directive == "jwks_refresh_interval" {
+				v.JWKSRefreshInterval = caddy.Duration(i)
+			} else {
+				v.JWKSUnknownKIDRefreshInterval = caddy.Duration(i)
+			}
+
 		default:
 			return v, d.Errf("unknown verifier directive %q", d.Val()) //nolint:wrapcheck
 		}
 	}
 
+	if v.JWKSURL == "" && (v.JWKSRefreshInterval != 0 || v.JWKSUnknownKIDRefreshInterval != 0) {
+		return v, d.Err(`the refresh intervals of the JWK Set require "jwks_uri"`) //nolint:wrapcheck
+	}
+
 	return v, nil
 }
 
@@ -773,7 +3668,7 @@ func (m *Mercure) populateJWTConfig() error {
 // VerifierConfig that isSet reports as configured.
 func (m *Mercure) buildVerifier(ctx context.Context, c VerifierConfig, role string) (mercure.Verifier, error) { //nolint:ireturn
 	if c.JWKSURL != "" {
-		k, err := newJWKSetKeyfunc(ctx, c.JWKSURL)
+		k, err := newJWKSetKeyfunc(ctx, c.JWKSURL, m.jwksOverride(c, role))
 		if err != nil {
 			return nil, fmt.Errorf("failed to retrieve %s JWK Set: %w", role, err)
 		}
@@ -821,6 +3716,8 @@ func (m *Mercure) buildIssuers(ctx context.Context) ([]mercure.Issuer, error) {
 			return nil, err
 		}
 
+		issuer.Audiences = ic.Audiences
+		issuer.ClaimNamespace = ic.ClaimNamespace
 		issuers = append(issuers, issuer)
 	}
 
@@ -839,15 +3736,39 @@ func (m *Mercure) buildIssuers(ctx context.Context) ([]mercure.Issuer, error) {
 	return issuers, nil
 }
 
+// jwksOverride returns the options of the JWK Set of the verifier: its refresh
+// intervals, and the logging of the failed refreshes through the logger of the
+// hub.
+func (m *Mercure) jwksOverride(c VerifierConfig, role string) keyfunc.Override {
+	o := keyfunc.Override{
+		RefreshInterval: time.Duration(c.JWKSRefreshInterval),
+		RefreshErrorHandlerFunc: func(u string) func(ctx context.Context, err error) {
+			return func(ctx context.Context, err error) {
+				if m.logger.Enabled(ctx, slog.LevelError) {
+					m.logger.LogAttrs(ctx, slog.LevelError, "Failed to refresh JWK Set", slog.String("role", role), slog.String("url", u), slog.Any("error", err))
+				}
+			}
+		},
+	}
+
+	if c.JWKSUnknownKIDRefreshInterval != 0 {
+		o.RefreshUnknownKID = rate.NewLimiter(rate.Every(time.Duration(c.JWKSUnknownKIDRefreshInterval)), 1)
+	}
+
+	return o
+}
+
 // newJWKSetKeyfunc builds a Keyfunc from a JWK Set URL.
 //
 // file:// URLs point to a local JSON file containing a JWK Set; the file is
 // read once at provision time, so rotating the keys requires a Caddy config
-// reload. Other URLs are forwarded to keyfunc.NewDefaultCtx, which handles
-// HTTP(S) and rejects unsupported schemes.
+// reload, and the override is ignored. Other URLs are forwarded to
+// keyfunc.NewDefaultOverrideCtx, which handles HTTP(S), refreshes the keys
+// periodically and when a token has an unknown key ID, and rejects unsupported
+// schemes.
 //
 //nolint:ireturn
-func newJWKSetKeyfunc(ctx context.Context, rawURL string) (keyfunc.Keyfunc, error) {
+func newJWKSetKeyfunc(ctx context.Context, rawURL string, override keyfunc.Override) (keyfunc.Keyfunc, error) {
 	u, err := url.Parse(rawURL)
 	if err != nil {
 		return nil, fmt.Errorf("invalid JWK Set URL %q: %w", rawURL, err)
@@ -871,7 +3792,7 @@ func newJWKSetKeyfunc(ctx context.Context, rawURL string) (keyfunc.Keyfunc, erro
 		return k, nil
 	}
 
-	return keyfunc.NewDefaultCtx(ctx, []string{rawURL}) //nolint:wrapcheck
+	return keyfunc.NewDefaultOverrideCtx(ctx, []string{rawURL}, override) //nolint:wrapcheck
 }
 
 // parseCaddyfile unmarshals tokens from h into a new Middleware.
@@ -881,6 +3802,27 @@ func parseCaddyfile(h httpcaddyfile.Helper) (caddyhttp.MiddlewareHandler, error)
 	return m, m.UnmarshalCaddyfile(h.Dispenser)
 }
 
+// parseAlertDirective parses an "alert <event> <threshold> <window>" Caddyfile
+// directive.
+func parseAlertDirective(d *caddyfile.Dispenser) (AlertConfig, error) {
+	args := d.RemainingArgs()
+	if len(args) != 3 {
+		return AlertConfig{}, d.ArgErr() //nolint:wrapcheck
+	}
+
+	threshold, err := strconv.Atoi(args[1])
+	if err != nil {
+		return AlertConfig{}, d.WrapErr(err) //nolint:wrapcheck
+	}
+
+	window, err := caddy.ParseDuration(args[2])
+	if err != nil {
+		return AlertConfig{}, d.WrapErr(err) //nolint:wrapcheck
+	}
+
+	return AlertConfig{Event: args[0], Threshold: threshold, Window: caddy.Duration(window)}, nil
+}
+
 func parseDurationParameter(d *caddyfile.Dispenser) (*caddy.Duration, error) {
 	if !d.NextArg() {
 		return nil, d.ArgErr() //nolint:wrapcheck
@@ -17,12 +17,12 @@ var transports = caddy.NewUsagePool() //nolint:gochecknoglobals
 // Deprecated
 //
 //nolint:wrapcheck,ireturn,nilnil
-func (m *Mercure) createTransportDeprecated() (mercure.Transport, error) {
+func (m *Mercure) createTransportFromURL(_ caddy.Context) (mercure.Transport, error) {
 	if m.TransportURL == "" {
 		return nil, nil
 	}
 
-	m.logger.Warn(`Setting the transport_url or the MERCURE_TRANSPORT_URL environment variable is deprecated, use the "transport" directive instead`)
+	m.logger.Warn(`Transport factories are deprecated, build without the deprecated_transport tag to create the transport of transport_url and MERCURE_TRANSPORT_URL with mercure.NewTransportFromDSN`)
 
 	destructor, _, err := transports.LoadOrNew(m.TransportURL, func() (caddy.Destructor, error) {
 		u, err := url.Parse(m.TransportURL)
@@ -55,18 +55,16 @@ func (m *Mercure) createTransportDeprecated() (mercure.Transport, error) {
 	return destructor.(*TransportDestructor[mercure.Transport]).Transport, nil
 }
 
-type deprecatedTransport struct {
-	// Transport to use.
-	//
-	// Deprecated: use transports Caddy modules.
+type transportURL struct {
+	// Transport to use, created with the deprecated transport factories.
 	TransportURL string `json:"transport_url,omitempty"`
 }
 
-func (m *Mercure) assignDeprecatedTransportURL(u string) {
+func (m *Mercure) assignTransportURL(u string) {
 	m.TransportURL = u
 }
 
-func (m *Mercure) assignDeprecatedTransportURLForEnv() {
+func (m *Mercure) assignTransportURLFromEnv() {
 	// BC layer with old versions of the built-in Caddyfile
 	if m.TransportRaw != nil || m.TransportURL != "" {
 		return
@@ -76,7 +74,7 @@ func (m *Mercure) assignDeprecatedTransportURLForEnv() {
 }
 
 //nolint:wrapcheck
-func (m *Mercure) cleanupTransportDeprecated() error {
+func (m *Mercure) cleanupTransportFromURL() error {
 	if m.TransportURL == "" {
 		return nil
 	}
@@ -9,22 +9,62 @@ import (
 	"github.com/dunglas/mercure"
 )
 
-func (_ *Mercure) createTransportDeprecated() (mercure.Transport, error) {
-	return nil, nil
+// transportURLKey is the key of the transports created from a DSN in
+// TransportUsagePool.
+type transportURLKey struct {
+	dsn string
 }
 
-func (m *Mercure) assignDeprecatedTransportURL(_ string) {
-	caddy.Log().Error(`Setting the "transport_url" directive is not available anymore, use the "transport" directive instead`)
-}
+// createTransportFromURL creates the transport described by TransportURL with
+// mercure.NewTransportFromDSN.
+//
+//nolint:wrapcheck,ireturn,nilnil
+func (m *Mercure) createTransportFromURL(ctx caddy.Context) (mercure.Transport, error) {
+	if m.TransportURL == "" {
+		return nil, nil
+	}
 
-func (m *Mercure) assignDeprecatedTransportURLForEnv() {
-	if "" != os.Getenv("MERCURE_TRANSPORT_URL") {
-		caddy.Log().Error(`The "MERCURE_TRANSPORT_URL"" environment variable is not supported anymore, set the "transport" directive in the "MERCURE_EXTRA_DIRECTIVES" environment variable instead`)
+	destructor, _, err := TransportUsagePool.LoadOrNew(transportURLKey{m.TransportURL}, func() (caddy.Destructor, error) {
+		t, err := mercure.NewTransportFromDSN(m.TransportURL, ctx.Slogger())
+		if err != nil {
+			return nil, err
+		}
+
+		return TransportDestructor[mercure.Transport]{Transport: t}, nil
+	})
+	if err != nil {
+		return nil, err
 	}
+
+	return destructor.(TransportDestructor[mercure.Transport]).Transport, nil
+}
+
+type transportURL struct {
+	// Transport to use, as a DSN. Takes precedence over the transport
+	// directive.
+	TransportURL string `json:"transport_url,omitempty"`
+}
+
+func (m *Mercure) assignTransportURL(u string) {
+	m.TransportURL = u
 }
 
-func (m *Mercure) cleanupTransportDeprecated() error {
-	return nil
+func (m *Mercure) assignTransportURLFromEnv() {
+	// BC layer with old versions of the built-in Caddyfile
+	if m.TransportRaw != nil || m.TransportURL != "" {
+		return
+	}
+
+	m.TransportURL = os.Getenv("MERCURE_TRANSPORT_URL")
 }
 
-type deprecatedTransport struct{}
+//nolint:wrapcheck
+func (m *Mercure) cleanupTransportFromURL() error {
+	if m.TransportURL == "" {
+		return nil
+	}
+
+	_, err := TransportUsagePool.Delete(transportURLKey{m.TransportURL})
+
+	return err
+}
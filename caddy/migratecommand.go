@@ -0,0 +1,76 @@
+package caddy
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	caddycmd "github.com/caddyserver/caddy/v2/cmd"
+	"github.com/dunglas/mercure"
+	"github.com/spf13/cobra"
+)
+
+var (
+	errMissingMigrationDSN = errors.New("--from and --to are required")
+	errNoHistory           = errors.New("the source transport has no history")
+)
+
+func init() { //nolint:gochecknoinits
+	caddycmd.RegisterCommand(caddycmd.Command{
+		Name:  "migrate",
+		Usage: "--from <dsn> --to <dsn>",
+		Short: "Copies the history of a transport to another one",
+		Long: `
+Copies the history from a transport to another one, preserving the order
+and the IDs of the updates, then reads it back from the destination to
+verify it. The hub must be stopped, and the destination empty.
+
+Transports are given as DSNs, e.g. bolt:///var/lib/mercure/old.db,
+bolt://relative.db?bucket_name=updates or local://. The history is not
+truncated unless the DSN sets a size.`,
+		CobraFunc: func(cmd *cobra.Command) {
+			cmd.Flags().String("from", "", "DSN of the source transport")
+			cmd.Flags().String("to", "", "DSN of the destination transport")
+			cmd.RunE = migrate
+		},
+	})
+}
+
+func migrate(cmd *cobra.Command, _ []string) error {
+	fromDSN, _ := cmd.Flags().GetString("from")
+	toDSN, _ := cmd.Flags().GetString("to")
+
+	if fromDSN == "" || toDSN == "" {
+		return errMissingMigrationDSN
+	}
+
+	from, err := mercure.NewTransportFromDSN(fromDSN, slog.Default())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer from.Close(cmd.Context())
+
+	reader, ok := from.(mercure.TransportHistoryReader)
+	if !ok {
+		return errNoHistory
+	}
+
+	to, err := mercure.NewTransportFromDSN(toDSN, slog.Default())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer to.Close(cmd.Context())
+
+	r, err := mercure.MigrateHistory(cmd.Context(), reader, to, slog.Default())
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	fmt.Fprintf(cmd.OutOrStdout(), "Copied %d updates\n", r.Copied)
+
+	if !r.Verified {
+		fmt.Fprintln(cmd.ErrOrStderr(), "The destination transport can't be read back, the copy has not been verified")
+	}
+
+	return nil
+}
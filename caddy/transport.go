@@ -26,7 +26,10 @@ type (
 )
 
 var (
-	SubscriptionsContextKey           = subscriptionsKeyType{}        //nolint:gochecknoglobals
-	WriteTimeoutContextKey            = writeTimeoutKeyType{}         //nolint:gochecknoglobals
+	SubscriptionsContextKey = subscriptionsKeyType{} //nolint:gochecknoglobals
+	WriteTimeoutContextKey  = writeTimeoutKeyType{}  //nolint:gochecknoglobals
+
+	// Deprecated: the subscriber list has no cache anymore, the context has no
+	// value for this key.
 	SubscriberListCacheSizeContextKey = subscriberListCacheSizeType{} //nolint:gochecknoglobals
 )
@@ -0,0 +1,302 @@
+package mercure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// capabilitiesURL is the endpoint minting capability URLs.
+	capabilitiesURL = defaultHubURL + "/capabilities"
+	// paramCapability is the subscribe query parameter carrying a capability.
+	paramCapability = "capability"
+)
+
+// DefaultCapabilityMaxTTL is the default maximum validity of capability URLs.
+const DefaultCapabilityMaxTTL = 24 * time.Hour
+
+var (
+	// ErrInvalidCapabilityKey is returned by WithCapabilityURLs when the key
+	// is not a valid AES key.
+	ErrInvalidCapabilityKey = errors.New("the capability key must be 16, 24 or 32 bytes long")
+	// ErrCapabilityURLsNotEnabled is returned by CapabilityURL when the hub
+	// has no capability key.
+	ErrCapabilityURLsNotEnabled = errors.New("capability URLs are not enabled")
+	// ErrInvalidCapability is returned when a capability can't be decrypted,
+	// is malformed or has expired.
+	ErrInvalidCapability = errors.New("invalid capability")
+)
+
+// capability is the encrypted content of a capability URL: subscribe grants,
+// in the shape of the topics of an authorization detail, and an expiration
+// date.
+type capability struct {
+	Topics    []detailTopic `json:"topics"`
+	ExpiresAt int64         `json:"exp"`
+}
+
+// WithCapabilityURLs allows the hub to mint capability URLs: subscribe URLs
+// embedding encrypted subscribe grants, which can be shared with guests that
+// have no token. key is an AES key (16, 24 or 32 bytes) encrypting the grants,
+// that must be shared by all the hubs of a cluster. Capability URLs can't be
+// valid for longer than maxTTL; a zero maxTTL uses DefaultCapabilityMaxTTL.
+//
+// Anyone holding a capability URL can subscribe until it expires: keep their
+// validity short, they can end up in logs and browser histories.
+func WithCapabilityURLs(key []byte, maxTTL time.Duration) Option {
+	return func(o *opt) error {
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return ErrInvalidCapabilityKey
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return fmt.Errorf("unable to create the capability cipher: %w", err)
+		}
+
+		if maxTTL == 0 {
+			maxTTL = DefaultCapabilityMaxTTL
+		}
+
+		o.capabilityAEAD = aead
+		o.capabilityMaxTTL = maxTTL
+
+		return nil
+	}
+}
+
+// CapabilityURL mints a subscribe URL granting its holder the right to
+// subscribe to the given topic matchers, private updates included, until ttl
+// elapses. A ttl greater than the maximum configured with WithCapabilityURLs
+// is shortened. The URL is absolute when the public URL is set (see
+// WithPublicURL), and relative to the hub origin otherwise.
+//
+// Authorization is the caller's responsibility.
+func (h *Hub) CapabilityURL(matchers []TopicMatcher, ttl time.Duration) (string, error) {
+	if h.capabilityAEAD == nil {
+		return "", ErrCapabilityURLsNotEnabled
+	}
+
+	if len(matchers) == 0 {
+		return "", ErrMissingTopicMatchers
+	}
+
+	if len(matchers) > maxMatcherCount {
+		return "", errTooManyMatchers
+	}
+
+	if ttl == 0 || ttl > h.capabilityMaxTTL {
+		ttl = h.capabilityMaxTTL
+	}
+
+	c := capability{Topics: make([]detailTopic, len(matchers)), ExpiresAt: time.Now().Add(ttl).Unix()}
+
+	q := make(url.Values)
+
+	for i, m := range matchers {
+		if err := validateProtocolMatcher(h.topicMatcherStore, m); err != nil {
+			return "", fmt.Errorf("%q: %w", m.Pattern, err)
+		}
+
+		c.Topics[i] = detailTopic{m}
+
+		param := paramMatch
+		if m.Type != MatcherTypeExact {
+			param += "_" + string(m.Type)
+		}
+
+		q.Add(param, m.Pattern)
+	}
+
+	plaintext, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("unable to marshal capability: %w", err)
+	}
+
+	nonce := make([]byte, h.capabilityAEAD.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("unable to generate capability nonce: %w", err)
+	}
+
+	q.Set(paramCapability, base64.RawURLEncoding.EncodeToString(h.capabilityAEAD.Seal(nonce, nonce, plaintext, nil)))
+
+	return h.absoluteURL(defaultHubURL) + "?" + q.Encode(), nil
+}
+
+// capabilityClaims decrypts a capability and returns the claims it grants.
+func (h *Hub) capabilityClaims(encoded string) (*claims, error) {
+	ciphertext, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(ciphertext) < h.capabilityAEAD.NonceSize() {
+		return nil, ErrInvalidCapability
+	}
+
+	ns := h.capabilityAEAD.NonceSize()
+
+	plaintext, err := h.capabilityAEAD.Open(nil, ciphertext[:ns], ciphertext[ns:], nil)
+	if err != nil {
+		return nil, ErrInvalidCapability
+	}
+
+	var c capability
+	if err := json.Unmarshal(plaintext, &c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCapability, err)
+	}
+
+	if time.Now().Unix() > c.ExpiresAt {
+		return nil, fmt.Errorf("%w: expired", ErrInvalidCapability)
+	}
+
+	// Validated again: the topic matcher store may have changed since the
+	// capability was minted.
+	authz, err := validateAuthorizationDetails(h.topicMatcherStore, []authorizationDetail{{
+		Type:    authorizationDetailTypeMercure,
+		Actions: []mercureAction{actionSubscribe},
+		Topics:  c.Topics,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCapability, err)
+	}
+
+	// The connections are closed when the capability expires, as when a
+	// token does (see getWriteDeadline).
+	return &claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Unix(c.ExpiresAt, 0))}, authz: authz}, nil
+}
+
+// authorizeSubscriber authorizes a subscription request with its capability
+// if it has one, with its token otherwise. A capability takes precedence, so
+// opening a shared link in a browser holding a cookie grants what the link
+// grants.
+func (h *Hub) authorizeSubscriber(r *http.Request, values url.Values) (*claims, error) {
+	if h.capabilityAEAD != nil {
+		if c := values.Get(paramCapability); c != "" {
+			return h.capabilityClaims(c)
+		}
+	}
+
+	if !h.subscriberConfigured {
+		return nil, nil //nolint:nilnil
+	}
+
+	return h.authorize(r, false)
+}
+
+// delegates reports whether the subscribe grants cover the whole matcher m, so
+// a capability for m grants nothing more: they must hold m itself or the
+// wildcard, or, for an exact m, grant subscribing to its topic. Matching the
+// pattern of m as a topic is not enough: an exact grant for the topic
+// "https://example.com/books/*" doesn't cover the URL pattern of the same name.
+func (a *mercureAuthz) delegates(tms *TopicMatcherStore, m TopicMatcher) bool {
+	if m.Type == MatcherTypeExact && m.Pattern != "*" && a.grants(tms, actionSubscribe, m.Pattern) {
+		return true
+	}
+
+	for _, tm := range a.subscribeMatchers() {
+		if tm == m || tm.Pattern == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CapabilitiesHandler mints capability URLs. The topic matchers are read from
+// the "match" and "match_<matcher_type>" form fields, and the validity from
+// the optional "ttl" field, in seconds. The response body is the URL.
+//
+// A subscriber can only share what it can subscribe to: the token must grant
+// subscribing to every requested matcher, and the URL expires with it.
+func (h *Hub) CapabilitiesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	claims, err := h.authorize(r, false)
+	if err != nil || claims == nil {
+		h.writeAuthError(w, r, err)
+
+		return
+	}
+
+	h.limitRequestBody(w, r)
+
+	if err := r.ParseForm(); err != nil {
+		status := http.StatusBadRequest
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, http.StatusText(status), status)
+
+		return
+	}
+
+	matchers, err := h.parseMatchers(r.PostForm, false)
+	if err != nil {
+		h.writeMatcherParamError(ctx, w, err)
+
+		return
+	}
+
+	// A capability grants subscribing: the webhook must allow it.
+	if claims, err = h.authorizeSubscription(ctx, h.httpCaller(r), claims, matchers); err != nil {
+		h.writeAuthorizationError(w, r, err)
+
+		return
+	}
+
+	for _, m := range matchers {
+		if !claims.authz.delegates(h.topicMatcherStore, m) {
+			h.writeBearerError(w, bearerErrInsufficientScope, http.StatusForbidden)
+
+			return
+		}
+	}
+
+	ttl := h.capabilityMaxTTL
+
+	if s := r.PostForm.Get("ttl"); s != "" {
+		seconds, err := strconv.ParseUint(s, 10, 32)
+		if err != nil || seconds == 0 {
+			http.Error(w, `Invalid "ttl" parameter`, http.StatusBadRequest)
+
+			return
+		}
+
+		ttl = time.Duration(seconds) * time.Second
+	}
+
+	if claims.ExpiresAt != nil {
+		if ttl = min(ttl, time.Until(claims.ExpiresAt.Time)); ttl < time.Second {
+			h.writeAuthError(w, r, ErrInvalidJWT)
+
+			return
+		}
+	}
+
+	u, err := h.CapabilityURL(matchers, ttl)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if _, err := io.WriteString(w, u); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write capability response", slog.Any("error", err))
+	}
+}
@@ -0,0 +1,126 @@
+package mercure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testCapabilityKey = []byte("0123456789abcdef0123456789abcdef")
+
+func TestCapabilityURL(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithCapabilityURLs(testCapabilityKey, 0), WithPublicURL("https://hub.example.com"+defaultHubURL))
+
+	matchers := []TopicMatcher{
+		{Type: MatcherTypeExact, Pattern: "https://example.com/books/1"},
+		{Type: MatcherTypeURLPattern, Pattern: "https://example.com/authors/*"},
+	}
+
+	u, err := hub.CapabilityURL(matchers, time.Minute)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(u, "https://hub.example.com"+defaultHubURL+"?"), u)
+
+	parsed, err := url.Parse(u)
+	require.NoError(t, err)
+
+	c, err := hub.capabilityClaims(parsed.Query().Get(paramCapability))
+	require.NoError(t, err)
+	require.NotNil(t, c.ExpiresAt, "the connection must be closed when the capability expires")
+	assert.WithinDuration(t, time.Now().Add(time.Minute), c.ExpiresAt.Time, 2*time.Second)
+
+	ctx, cancel := context.WithCancel(t.Context())
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		req := httptest.NewRequest(http.MethodGet, strings.TrimPrefix(u, "https://hub.example.com"), nil).WithContext(ctx)
+		hub.SubscribeHandler(newSubscribeRecorder(), req)
+	})
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+	_, subscribers, err := hub.transport.(TransportSubscribers).GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, matchers, subscribers[0].SubscribedMatchers)
+	assert.Equal(t, matchers, subscribers[0].AllowedPrivateMatchers)
+
+	cancel()
+	wg.Wait()
+}
+
+func TestCapabilityURLInvalid(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithCapabilityURLs(testCapabilityKey, 0))
+	other := createDummy(t, WithCapabilityURLs([]byte("fedcba9876543210"), 0))
+
+	matchers := []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/books/1"}}
+
+	expired, err := hub.CapabilityURL(matchers, -time.Second)
+	require.NoError(t, err)
+
+	forged, err := other.CapabilityURL(matchers, time.Minute)
+	require.NoError(t, err)
+
+	for name, u := range map[string]string{
+		"expired":   expired,
+		"forged":    forged,
+		"malformed": defaultHubURL + "?match=https://example.com/books/1&capability=foo",
+	} {
+		w := httptest.NewRecorder()
+		hub.SubscribeHandler(w, httptest.NewRequest(http.MethodGet, u, nil))
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, name)
+	}
+
+	_, err = createDummy(t).CapabilityURL(matchers, time.Minute)
+	require.ErrorIs(t, err, ErrCapabilityURLsNotEnabled)
+
+	_, err = NewHub(t.Context(), WithCapabilityURLs([]byte("short"), 0))
+	require.ErrorIs(t, err, ErrInvalidCapabilityKey)
+}
+
+func TestCapabilitiesHandler(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithCapabilityURLs(testCapabilityKey, 0))
+	token := createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1", "https://example.com/authors/*"})
+
+	for name, tc := range map[string]struct {
+		form   url.Values
+		status int
+	}{
+		"granted topic":         {url.Values{"match": {"https://example.com/books/1"}, "ttl": {"60"}}, http.StatusOK},
+		"granted matcher":       {url.Values{"match": {"https://example.com/authors/*"}}, http.StatusOK},
+		"other topic":           {url.Values{"match": {"https://example.com/books/2"}}, http.StatusForbidden},
+		"matcher named a topic": {url.Values{"match_urlpattern": {"https://example.com/books/1"}}, http.StatusForbidden},
+		"invalid ttl":           {url.Values{"match": {"https://example.com/books/1"}, "ttl": {"0"}}, http.StatusBadRequest},
+		"missing matcher":       {url.Values{}, http.StatusBadRequest},
+	} {
+		req := httptest.NewRequest(http.MethodPost, capabilitiesURL, strings.NewReader(tc.form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", bearerPrefix+token)
+
+		w := httptest.NewRecorder()
+		hub.ServeHTTP(w, req)
+
+		require.Equal(t, tc.status, w.Code, name)
+
+		if tc.status == http.StatusOK {
+			assert.Contains(t, w.Body.String(), paramCapability+"=", name)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, httptest.NewRequest(http.MethodPost, capabilitiesURL, nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,85 @@
+package mercure
+
+import (
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// DefaultCDNEdgeTTL is the default duration a CDN may share an origin stream
+// between its viewers in CDN fan-out mode.
+const DefaultCDNEdgeTTL = 10 * time.Second
+
+// cdnVary lists the request headers the shareable streams depend on.
+var cdnVary = []string{"Accept-Language"}
+
+// WithCDNFanOut makes anonymous subscriptions CDN-friendly, so an SSE-aware CDN
+// can collapse the requests of its viewers and fan out a single origin stream
+// to all of them:
+//
+//   - every set of topic matchers has a single, stable subscribe URL: other
+//     spellings (parameter order, duplicated matchers, unrelated parameters)
+//     are permanently redirected to it;
+//   - the streams of these subscriptions are publicly cacheable for edgeTTL,
+//     the s-maxage directive telling the CDN how long it may keep attaching new
+//     viewers to an origin stream.
+//
+// Only requests without credentials, Last-Event-ID nor if-state-version-gt
+// qualify: they receive public updates only, so sharing their stream discloses
+// nothing. The other subscriptions keep their private, uncacheable responses,
+// as do all of them when WithResumeGracePeriod or WithSubscriberStats is set,
+// the streams carrying a resume token or the statistics of the connection. A
+// zero edgeTTL uses DefaultCDNEdgeTTL.
+func WithCDNFanOut(edgeTTL time.Duration) Option {
+	return func(o *opt) error {
+		if edgeTTL == 0 {
+			edgeTTL = DefaultCDNEdgeTTL
+		}
+
+		o.cdnFanOut = true
+		o.cdnEdgeTTL = edgeTTL
+
+		return nil
+	}
+}
+
+// shareableSubscription reports whether the stream of a subscription can be
+// shared by a CDN: it must not depend on the client state (credentials,
+// Last-Event-ID, if-state-version-gt, guest session, JSON Patch deltas, snapshot),
+// nor hold data of the connection (resume tokens, delivery statistics).
+func (h *Hub) shareableSubscription(r *http.Request, s *Subscriber) bool {
+	return h.cdnFanOut && r.Method == http.MethodGet && s.Claims == nil && !s.RequestLastEventIDSet && s.RequestStateVersion == 0 &&
+		s.GuestID == "" && !s.JSONPatchDelta && !s.WithSnapshot && h.resumes == nil && !h.subscriberStats
+}
+
+// canonicalSubscribeQuery builds the stable query string of a subscription:
+// only the topic matcher parameters, sorted by name then value, without
+// duplicates.
+func canonicalSubscribeQuery(tms *TopicMatcherStore, values url.Values, deprecated bool) string {
+	canonical := make(url.Values, len(values))
+
+	for k, vs := range values {
+		if _, ok := matcherTypeFromParam(tms, k); !ok && (!deprecated || k != paramTopic) {
+			continue
+		}
+
+		vs = slices.Clone(vs)
+		slices.Sort(vs)
+		canonical[k] = slices.Compact(vs)
+	}
+
+	return canonical.Encode()
+}
+
+// setCDNHeaders replaces the private cache headers of a shareable stream. The
+// stream depends on the Accept-Language header, selecting the localized
+// variants of the updates: CDNs must share it only between the viewers
+// sending the same languages.
+func (h *Hub) setCDNHeaders(header http.Header) {
+	header["Cache-Control"] = []string{"public, max-age=0, s-maxage=" + strconv.Itoa(int(h.cdnEdgeTTL.Seconds()))}
+	header["Vary"] = cdnVary
+	delete(header, "Pragma")
+	delete(header, "Expire")
+}
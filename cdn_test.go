@@ -0,0 +1,105 @@
+package mercure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanonicalSubscribeQuery(t *testing.T) {
+	t.Parallel()
+
+	q := url.Values{
+		"match":            {"https://example.com/b", "https://example.com/a", "https://example.com/b"},
+		"match_urlpattern": {"https://example.com/*"},
+		"foo":              {"bar"},
+	}
+
+	assert.Equal(t, "match=https%3A%2F%2Fexample.com%2Fa&match=https%3A%2F%2Fexample.com%2Fb&match_urlpattern=https%3A%2F%2Fexample.com%2F%2A", canonicalSubscribeQuery(&TopicMatcherStore{}, q, false))
+}
+
+func TestCDNFanOutRedirect(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithCDNFanOut(0))
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?foo=bar&match=https://example.com/b&match=https://example.com/a", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	assert.Equal(t, http.StatusPermanentRedirect, w.Code)
+	assert.Equal(t, defaultHubURL+"?match=https%3A%2F%2Fexample.com%2Fa&match=https%3A%2F%2Fexample.com%2Fb", w.Header().Get("Location"))
+}
+
+// cdnStreamHeaders returns the headers of the stream of an anonymous
+// subscription.
+func cdnStreamHeaders(t *testing.T, hub *Hub, header http.Header) http.Header {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	w := newSubscribeRecorder()
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https%3A%2F%2Fexample.com%2Fa", nil).WithContext(ctx)
+		req.Header = header.Clone()
+		if req.Header == nil {
+			req.Header = http.Header{}
+		}
+
+		hub.SubscribeHandler(w, req)
+	})
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+	cancel()
+	wg.Wait()
+
+	return w.Header()
+}
+
+func TestCDNFanOutHeaders(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithCDNFanOut(0))
+
+	for name, tc := range map[string]struct {
+		header       http.Header
+		cacheControl string
+	}{
+		"anonymous":     {nil, "public, max-age=0, s-maxage=10"},
+		"authenticated": {http.Header{"Authorization": {bearerPrefix + createDummyAuthorizedJWT(roleSubscriber, []string{"*"})}}, headerCacheControl[0]},
+		"last event id": {http.Header{"Last-Event-Id": {EarliestLastEventID}}, headerCacheControl[0]},
+	} {
+		assert.Equal(t, tc.cacheControl, cdnStreamHeaders(t, hub, tc.header).Get("Cache-Control"), name)
+	}
+}
+
+func TestCDNFanOutVaryAcceptLanguage(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithCDNFanOut(0))
+
+	// The localized variants are selected by Accept-Language.
+	header := cdnStreamHeaders(t, hub, http.Header{"Accept-Language": {"fr-FR"}})
+	assert.Equal(t, "public, max-age=0, s-maxage=10", header.Get("Cache-Control"))
+	assert.Equal(t, "Accept-Language", header.Get("Vary"))
+}
+
+func TestCDNFanOutNotShared(t *testing.T) {
+	t.Parallel()
+
+	for name, opt := range map[string]Option{
+		"resume": WithResumeGracePeriod(time.Minute),
+		"stats":  WithSubscriberStats(),
+	} {
+		hub := createAnonymousDummy(t, WithCDNFanOut(0), opt)
+
+		assert.Equal(t, headerCacheControl[0], cdnStreamHeaders(t, hub, nil).Get("Cache-Control"), name)
+	}
+}
@@ -0,0 +1,168 @@
+package mercure
+
+import (
+	"errors"
+	"fmt"
+	"hash/maphash"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/maypok86/otter/v2"
+)
+
+const (
+	// defaultConditionalPublishingMaxTopics is the number of topics whose last
+	// event ID the hub remembers when WithConditionalPublishing is passed 0.
+	defaultConditionalPublishingMaxTopics = 100_000
+	// conditionalPublishingStripes is the number of locks serializing the
+	// publications of the topics, so a conditional publication can't race
+	// with another one on the same topic.
+	conditionalPublishingStripes = 64
+)
+
+var (
+	// ErrPreconditionFailed is returned by Publish and PublishGroup when the
+	// IfMatch field of an update is not the ID of the last update published on
+	// its topic.
+	ErrPreconditionFailed = errors.New("the last update published on the topic doesn't have the ID given by If-Match")
+	// ErrConditionalPublishingNotEnabled is returned by Publish and
+	// PublishGroup for conditional updates when WithConditionalPublishing is
+	// not set.
+	ErrConditionalPublishingNotEnabled = errors.New("conditional publishing is not enabled")
+	// ErrInvalidConditionalPublishing is returned by WithConditionalPublishing
+	// for a negative number of topics.
+	ErrInvalidConditionalPublishing = errors.New("the number of topics of conditional publishing must not be negative")
+)
+
+// lastEventIDs remembers the ID of the last update published on the topics,
+// to check the conditional publications.
+type lastEventIDs struct {
+	ids     *otter.Cache[string, string]
+	seed    maphash.Seed
+	stripes [conditionalPublishingStripes]sync.Mutex
+}
+
+// WithConditionalPublishing enables the conditional publications: an update
+// having an IfMatch field (the If-Match header of the publish request) is
+// only published if IfMatch is the ID of the last update published on its
+// topic, otherwise Publish returns ErrPreconditionFailed and the publish
+// endpoint answers with a 412 status code. Publishers can so implement
+// optimistic concurrency control, not to overwrite changes published
+// concurrently.
+//
+// The hub remembers the last ID of up to maxTopics topics (100000 when 0),
+// the least recently used ones being forgotten. The updates on the topics it
+// doesn't remember, such as after a restart, and the updates published by
+// other hubs sharing the transport, make the conditional publications fail
+// until an unconditional update is published on the topic.
+func WithConditionalPublishing(maxTopics int) Option {
+	return func(o *opt) error {
+		if maxTopics < 0 {
+			return ErrInvalidConditionalPublishing
+		}
+
+		if maxTopics == 0 {
+			maxTopics = defaultConditionalPublishingMaxTopics
+		}
+
+		ids, err := otter.New(&otter.Options[string, string]{MaximumSize: maxTopics})
+		if err != nil {
+			return fmt.Errorf("unable to create the last event IDs cache: %w", err)
+		}
+
+		o.lastEventIDs = &lastEventIDs{ids: ids, seed: maphash.MakeSeed()}
+
+		return nil
+	}
+}
+
+// lockTopics serializes the publication of the updates with the other
+// publications on their topics, and returns the function releasing the
+// locks. The updates are checked and dispatched, and their IDs recorded,
+// holding the locks.
+func (h *Hub) lockTopics(updates ...*Update) func() {
+	l := h.lastEventIDs
+	if l == nil {
+		return func() {}
+	}
+
+	stripes := make([]uint64, 0, len(updates))
+	for _, u := range updates {
+		stripes = append(stripes, maphash.String(l.seed, u.Topic)%conditionalPublishingStripes)
+	}
+
+	// Always locked in the same order, not to deadlock with the groups.
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	for _, i := range stripes {
+		l.stripes[i].Lock()
+	}
+
+	return func() {
+		for _, i := range stripes {
+			l.stripes[i].Unlock()
+		}
+	}
+}
+
+// checkConditions returns ErrPreconditionFailed if the IfMatch field of one of
+// the updates is not the ID of the last update published on its topic, the
+// previous updates of the group included.
+func (h *Hub) checkConditions(updates ...*Update) error {
+	l := h.lastEventIDs
+
+	var pending map[string]string
+
+	for _, u := range updates {
+		if u.IfMatch != "" {
+			if l == nil {
+				return ErrConditionalPublishingNotEnabled
+			}
+
+			id, ok := pending[u.Topic]
+			if !ok {
+				id, ok = l.ids.GetIfPresent(u.Topic)
+			}
+
+			if !ok || id != u.IfMatch {
+				return fmt.Errorf("%q: %w", u.Topic, ErrPreconditionFailed)
+			}
+		}
+
+		if l != nil && len(updates) > 1 {
+			if pending == nil {
+				pending = make(map[string]string)
+			}
+
+			pending[u.Topic] = u.ID
+		}
+	}
+
+	return nil
+}
+
+// recordLastEventIDs remembers the IDs of the dispatched updates.
+func (h *Hub) recordLastEventIDs(updates ...*Update) {
+	l := h.lastEventIDs
+	if l == nil {
+		return
+	}
+
+	for _, u := range updates {
+		l.ids.Set(u.Topic, u.ID)
+	}
+}
+
+// parseIfMatch returns the event ID of the If-Match header, which may be
+// quoted like an entity tag.
+func parseIfMatch(r *http.Request) string {
+	v := strings.TrimSpace(r.Header.Get("If-Match"))
+	if len(v) >= 2 && v[0] == '"' && v[len(v)-1] == '"' {
+		return v[1 : len(v)-1]
+	}
+
+	return v
+}
@@ -0,0 +1,141 @@
+package mercure
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conditionalPublish publishes an update on the book with the If-Match
+// header, and returns the status code and the body of the response.
+func conditionalPublish(t *testing.T, hub *Hub, ifMatch string) (int, string) {
+	t.Helper()
+
+	form := url.Values{"topic": {"https://example.com/books/1"}, "data": {"Dune"}}
+
+	req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+	if ifMatch != "" {
+		req.Header.Add("If-Match", ifMatch)
+	}
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	resp := w.Result()
+
+	t.Cleanup(func() {
+		require.NoError(t, resp.Body.Close())
+	})
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, string(body)
+}
+
+func TestConditionalPublish(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithConditionalPublishing(0))
+
+	// The hub doesn't know the last update of the topic yet.
+	status, _ := conditionalPublish(t, hub, "urn:uuid:unknown")
+	assert.Equal(t, http.StatusPreconditionFailed, status)
+
+	status, id := conditionalPublish(t, hub, "")
+	require.Equal(t, http.StatusOK, status)
+
+	status, next := conditionalPublish(t, hub, id)
+	require.Equal(t, http.StatusOK, status)
+
+	// Not the last update anymore.
+	status, body := conditionalPublish(t, hub, id)
+	assert.Equal(t, http.StatusPreconditionFailed, status)
+	assert.Contains(t, body, ErrPreconditionFailed.Error())
+
+	// Quoted like an entity tag.
+	status, _ = conditionalPublish(t, hub, `"`+next+`"`)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestConditionalPublishNotEnabled(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	status, _ := conditionalPublish(t, hub, "urn:uuid:unknown")
+	assert.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestConditionalPublishConcurrent(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithConditionalPublishing(0))
+
+	base := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, hub.Publish(t.Context(), base))
+
+	var (
+		wg        sync.WaitGroup
+		published atomic.Int32
+	)
+
+	for range 20 {
+		wg.Go(func() {
+			err := hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", IfMatch: base.ID})
+			if err == nil {
+				published.Add(1)
+
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrPreconditionFailed)
+		})
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), published.Load())
+}
+
+func TestConditionalPublishGroup(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithConditionalPublishing(0))
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "b1"}}))
+
+	// The conditions see the previous updates of the group.
+	require.NoError(t, hub.PublishGroup(t.Context(), []*Update{
+		{Topic: "https://example.com/books/1", IfMatch: "b1", Event: Event{ID: "b2"}},
+		{Topic: "https://example.com/books/1", IfMatch: "b2", Event: Event{ID: "b3"}},
+	}))
+
+	// All or nothing.
+	err := hub.PublishGroup(t.Context(), []*Update{
+		{Topic: "https://example.com/authors/1", Event: Event{ID: "a1"}},
+		{Topic: "https://example.com/books/1", IfMatch: "b2", Event: Event{ID: "b4"}},
+	})
+	require.ErrorIs(t, err, ErrPreconditionFailed)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", IfMatch: "b3"}))
+	require.ErrorIs(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/authors/1", IfMatch: "a1"}), ErrPreconditionFailed)
+}
+
+func TestWithConditionalPublishingInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithConditionalPublishing(-1))
+	require.ErrorIs(t, err, ErrInvalidConditionalPublishing)
+}
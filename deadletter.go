@@ -0,0 +1,309 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// deadLetterQueueSize is the number of dropped updates waiting to be
+	// recorded in the store.
+	deadLetterQueueSize = 1000
+	// defaultDeadLetterStoreSize is the number of dead letters kept by the
+	// stores created with a size of 0.
+	defaultDeadLetterStoreSize = 1000
+)
+
+var (
+	// ErrDeadLetterNotFound is returned by the DeadLetterStore methods and by
+	// the Hub dead letter methods when there is no dead letter with the ID.
+	ErrDeadLetterNotFound = errors.New("dead letter not found")
+	// ErrDeadLettersNotEnabled is returned by the Hub dead letter methods when
+	// WithDeadLetters is not set.
+	ErrDeadLettersNotEnabled = errors.New("dead letters are not enabled")
+	// ErrRedeliveryNotSupported is returned by RedeliverDeadLetter when the
+	// transport does not implement TransportRedeliverer.
+	ErrRedeliveryNotSupported = errors.New("the transport does not support re-delivering updates")
+	// ErrDeadLetterNotRedeliverable is returned by RedeliverDeadLetter for the
+	// updates dropped for anonymous subscribers, which can't be recognized
+	// when they reconnect.
+	ErrDeadLetterNotRedeliverable = errors.New("the update has been dropped for an anonymous subscriber")
+)
+
+// DeadLetter is an update dropped because a subscriber didn't receive the
+// updates fast enough.
+type DeadLetter struct {
+	// ID identifies the dead letter.
+	ID string `json:"id"`
+	// SubscriberID is the ID of the subscriber the update was dropped for.
+	SubscriberID string `json:"subscriber"`
+	// Subject is the subject of the token of the subscriber, empty for
+	// anonymous subscribers.
+	Subject string `json:"sub,omitempty"`
+	// Update is the dropped update.
+	Update *Update `json:"update"`
+	// DroppedAt is when the update has been dropped.
+	DroppedAt time.Time `json:"dropped_at"`
+}
+
+// DeadLetterStore keeps the dead letters, for them to be inspected and
+// re-delivered.
+type DeadLetterStore interface {
+	// AddDeadLetter stores a dead letter.
+	AddDeadLetter(ctx context.Context, dl *DeadLetter) error
+	// DeadLetters returns up to limit dead letters, oldest first, all of
+	// them when limit is 0.
+	DeadLetters(ctx context.Context, limit int) ([]*DeadLetter, error)
+	// DeadLetter returns the dead letter with the ID, or
+	// ErrDeadLetterNotFound.
+	DeadLetter(ctx context.Context, id string) (*DeadLetter, error)
+	// RemoveDeadLetter removes the dead letter with the ID, or returns
+	// ErrDeadLetterNotFound.
+	RemoveDeadLetter(ctx context.Context, id string) error
+}
+
+// deadLetters records the dropped updates in the store, from a worker not to
+// block the dispatch.
+type deadLetters struct {
+	store DeadLetterStore
+	queue chan *DeadLetter
+}
+
+// WithDeadLetters records in the store the updates dropped because a
+// subscriber didn't receive them fast enough (see
+// DisconnectReasonSlowConsumer), with the ID of the subscriber and the subject
+// of its token. They can then be inspected, and re-delivered to the
+// subscribers having the same subject once they reconnected, using
+// Hub.DeadLetters and Hub.RedeliverDeadLetter.
+//
+// The dropped updates are recorded asynchronously: when the store can't keep
+// up, they are only logged.
+func WithDeadLetters(store DeadLetterStore) Option {
+	return func(o *opt) error {
+		o.deadLetters = &deadLetters{store: store, queue: make(chan *DeadLetter, deadLetterQueueSize)}
+
+		return nil
+	}
+}
+
+// startDeadLetters starts the worker recording the dead letters, stopped
+// when ctx is done, and registers the callback queuing them.
+func (o *opt) startDeadLetters(ctx context.Context) {
+	d := o.deadLetters
+	if d == nil {
+		return
+	}
+
+	onDrop := o.subscriberCallbacks.OnDrop
+	o.subscriberCallbacks.OnDrop = func(s *LocalSubscriber, u *Update) {
+		if onDrop != nil {
+			onDrop(s, u)
+		}
+
+		d.queueDeadLetter(ctx, o.logger, s, u)
+	}
+
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case dl := <-d.queue:
+				if err := d.store.AddDeadLetter(ctx, dl); err != nil && o.logger.Enabled(ctx, slog.LevelError) {
+					o.logger.LogAttrs(ctx, slog.LevelError, "Failed to record dead letter", slog.String("subscriber", dl.SubscriberID), slog.String("id", dl.Update.ID), slog.Any("error", err))
+				}
+			}
+		}
+	}()
+}
+
+// queueDeadLetter queues the update dropped for the subscriber.
+func (d *deadLetters) queueDeadLetter(ctx context.Context, logger *slog.Logger, s *LocalSubscriber, u *Update) {
+	dl := &DeadLetter{
+		ID:           "urn:uuid:" + uuid.Must(uuid.NewV7()).String(),
+		SubscriberID: s.ID,
+		Update:       u,
+		DroppedAt:    time.Now(),
+	}
+
+	if s.Claims != nil {
+		dl.Subject = s.Claims.Subject
+	}
+
+	select {
+	case d.queue <- dl:
+	default:
+		if logger.Enabled(ctx, slog.LevelWarn) {
+			logger.LogAttrs(ctx, slog.LevelWarn, "Dead letter queue full, dead letter not recorded", slog.String("subscriber", s.ID), slog.String("id", u.ID))
+		}
+	}
+}
+
+// DeadLetters returns up to limit dead letters, oldest first, all of them
+// when limit is 0. Authorization is the caller's responsibility.
+func (h *Hub) DeadLetters(ctx context.Context, limit int) ([]*DeadLetter, error) {
+	if h.deadLetters == nil {
+		return nil, ErrDeadLettersNotEnabled
+	}
+
+	return h.deadLetters.store.DeadLetters(ctx, limit) //nolint:wrapcheck
+}
+
+// RedeliverDeadLetter dispatches the update of the dead letter again to the
+// connected subscribers having the subject of the subscriber it has been
+// dropped for, and allowed to receive it, on all the nodes of the cluster. It
+// returns their count, and removes the dead letter when it has been
+// re-delivered to at least one subscriber.
+//
+// The transport must implement TransportRedeliverer, otherwise
+// ErrRedeliveryNotSupported is returned. Authorization is the caller's
+// responsibility.
+func (h *Hub) RedeliverDeadLetter(ctx context.Context, id string) (int, error) {
+	if h.deadLetters == nil {
+		return 0, ErrDeadLettersNotEnabled
+	}
+
+	tr, ok := h.transport.(TransportRedeliverer)
+	if !ok {
+		return 0, ErrRedeliveryNotSupported
+	}
+
+	dl, err := h.deadLetters.store.DeadLetter(ctx, id)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	if dl.Subject == "" {
+		return 0, ErrDeadLetterNotRedeliverable
+	}
+
+	n, err := tr.Redeliver(ctx, &SubscriberSelector{Subject: dl.Subject}, dl.Update)
+	if err != nil || n == 0 {
+		return 0, err //nolint:wrapcheck
+	}
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Dead letter re-delivered", slog.String("dead_letter", id), slog.String("id", dl.Update.ID), slog.Int("count", n))
+	}
+
+	return n, h.deadLetters.store.RemoveDeadLetter(ctx, id) //nolint:wrapcheck
+}
+
+// DiscardDeadLetter removes the dead letter without re-delivering its update.
+// Authorization is the caller's responsibility.
+func (h *Hub) DiscardDeadLetter(ctx context.Context, id string) error {
+	if h.deadLetters == nil {
+		return ErrDeadLettersNotEnabled
+	}
+
+	return h.deadLetters.store.RemoveDeadLetter(ctx, id) //nolint:wrapcheck
+}
+
+// redeliver dispatches the update to the connected subscribers of the list
+// matching the selector and allowed to receive it, and returns their count.
+func redeliver(ctx context.Context, sl *SubscriberList, sel *SubscriberSelector, u *Update) (n int) {
+	sl.Walk(0, func(s *LocalSubscriber) bool {
+		if s.disconnected.Load() > 0 || !sel.Match(&s.Subscriber) || !s.Match(u) {
+			return true
+		}
+
+		if s.Dispatch(ctx, u, false) {
+			n++
+		}
+
+		return true
+	})
+
+	return n
+}
+
+// MemoryDeadLetterStore is a DeadLetterStore keeping the most recent dead
+// letters in memory, in a ring.
+type MemoryDeadLetterStore struct {
+	sync.Mutex
+
+	size    int
+	letters []*DeadLetter
+	// start is the index of the oldest dead letter once the ring is full.
+	start int
+}
+
+// NewMemoryDeadLetterStore creates a MemoryDeadLetterStore keeping the size
+// most recent dead letters, 1000 when 0.
+func NewMemoryDeadLetterStore(size int) *MemoryDeadLetterStore {
+	if size <= 0 {
+		size = defaultDeadLetterStoreSize
+	}
+
+	return &MemoryDeadLetterStore{size: size}
+}
+
+// AddDeadLetter stores the dead letter, replacing the oldest one when the
+// store is full.
+func (s *MemoryDeadLetterStore) AddDeadLetter(_ context.Context, dl *DeadLetter) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.letters) < s.size {
+		s.letters = append(s.letters, dl)
+
+		return nil
+	}
+
+	s.letters[s.start] = dl
+	s.start = (s.start + 1) % s.size
+
+	return nil
+}
+
+// DeadLetters returns up to limit dead letters, oldest first.
+func (s *MemoryDeadLetterStore) DeadLetters(_ context.Context, limit int) ([]*DeadLetter, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	letters := slices.Concat(s.letters[s.start:], s.letters[:s.start])
+	if limit > 0 && len(letters) > limit {
+		letters = letters[:limit]
+	}
+
+	return letters, nil
+}
+
+// DeadLetter returns the dead letter with the ID.
+func (s *MemoryDeadLetterStore) DeadLetter(_ context.Context, id string) (*DeadLetter, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if i := slices.IndexFunc(s.letters, func(dl *DeadLetter) bool { return dl.ID == id }); i >= 0 {
+		return s.letters[i], nil
+	}
+
+	return nil, ErrDeadLetterNotFound
+}
+
+// RemoveDeadLetter removes the dead letter with the ID.
+func (s *MemoryDeadLetterStore) RemoveDeadLetter(_ context.Context, id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	i := slices.IndexFunc(s.letters, func(dl *DeadLetter) bool { return dl.ID == id })
+	if i < 0 {
+		return ErrDeadLetterNotFound
+	}
+
+	// The ring is put back in order, it isn't full anymore.
+	i = (i - s.start + len(s.letters)) % len(s.letters)
+	s.letters = slices.Delete(slices.Concat(s.letters[s.start:], s.letters[:s.start]), i, i+1)
+	s.start = 0
+
+	return nil
+}
+
+// Interface guards.
+var _ DeadLetterStore = (*MemoryDeadLetterStore)(nil)
@@ -0,0 +1,181 @@
+package mercure
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// deadLetterIDs returns the IDs of the dead letters of the store, oldest
+// first.
+func deadLetterIDs(t *testing.T, store DeadLetterStore) (ids []string) {
+	t.Helper()
+
+	letters, err := store.DeadLetters(t.Context(), 0)
+	require.NoError(t, err)
+
+	for _, dl := range letters {
+		ids = append(ids, dl.ID)
+	}
+
+	return ids
+}
+
+func testDeadLetterStore(t *testing.T, store DeadLetterStore) {
+	t.Helper()
+
+	for i := range 4 {
+		require.NoError(t, store.AddDeadLetter(t.Context(), &DeadLetter{ID: strconv.Itoa(i), Update: &Update{Event: Event{ID: "u" + strconv.Itoa(i)}}}))
+	}
+
+	// The oldest dead letter has been replaced.
+	assert.Equal(t, []string{"1", "2", "3"}, deadLetterIDs(t, store))
+
+	letters, err := store.DeadLetters(t.Context(), 2)
+	require.NoError(t, err)
+	require.Len(t, letters, 2)
+	assert.Equal(t, "1", letters[0].ID)
+
+	dl, err := store.DeadLetter(t.Context(), "2")
+	require.NoError(t, err)
+	assert.Equal(t, "u2", dl.Update.ID)
+
+	_, err = store.DeadLetter(t.Context(), "0")
+	require.ErrorIs(t, err, ErrDeadLetterNotFound)
+
+	require.NoError(t, store.RemoveDeadLetter(t.Context(), "2"))
+	require.ErrorIs(t, store.RemoveDeadLetter(t.Context(), "2"), ErrDeadLetterNotFound)
+	assert.Equal(t, []string{"1", "3"}, deadLetterIDs(t, store))
+
+	require.NoError(t, store.AddDeadLetter(t.Context(), &DeadLetter{ID: "4", Update: &Update{}}))
+	require.NoError(t, store.AddDeadLetter(t.Context(), &DeadLetter{ID: "5", Update: &Update{}}))
+	assert.Equal(t, []string{"3", "4", "5"}, deadLetterIDs(t, store))
+}
+
+func TestMemoryDeadLetterStore(t *testing.T) {
+	t.Parallel()
+
+	testDeadLetterStore(t, NewMemoryDeadLetterStore(3))
+}
+
+// newDeadLetterSubscriber adds to the transport of the hub a subscriber with
+// a token having the subject, or no token when it is empty.
+func newDeadLetterSubscriber(t *testing.T, hub *Hub, subject string) *LocalSubscriber {
+	t.Helper()
+
+	s := NewLocalSubscriber("", hub.logger, hub.topicMatcherStore)
+	s.SetCallbacks(hub.subscriberCallbacks)
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/books/1"}), nil)
+
+	if subject != "" {
+		s.Claims = &claims{RegisteredClaims: jwt.RegisteredClaims{Subject: subject}}
+	}
+
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+	s.Ready(t.Context())
+
+	return s
+}
+
+// fillSubscriber dispatches updates until the subscriber is disconnected for
+// being too slow, then n more, dropped too.
+func fillSubscriber(t *testing.T, hub *Hub, n int) {
+	t.Helper()
+
+	for i := range outBufferLength + n + 1 {
+		require.NoError(t, hub.transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: strconv.Itoa(i)}}))
+	}
+}
+
+func TestDeadLetters(t *testing.T) {
+	t.Parallel()
+
+	store := NewMemoryDeadLetterStore(0)
+	hub := createAnonymousDummy(t, WithDeadLetters(store))
+
+	s := newDeadLetterSubscriber(t, hub, "alice")
+	fillSubscriber(t, hub, 1)
+
+	var letters []*DeadLetter
+
+	require.Eventually(t, func() bool {
+		letters, _ = hub.DeadLetters(t.Context(), 0)
+
+		return len(letters) == 2
+	}, time.Second, time.Millisecond)
+
+	assert.Equal(t, s.ID, letters[0].SubscriberID)
+	assert.Equal(t, "alice", letters[0].Subject)
+	assert.Equal(t, strconv.Itoa(outBufferLength), letters[0].Update.ID)
+	assert.Equal(t, strconv.Itoa(outBufferLength+1), letters[1].Update.ID)
+
+	// Not connected anymore.
+	n, err := hub.RedeliverDeadLetter(t.Context(), letters[0].ID)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	require.NoError(t, hub.transport.RemoveSubscriber(t.Context(), s))
+
+	newDeadLetterSubscriber(t, hub, "bob")
+	reconnected := newDeadLetterSubscriber(t, hub, "alice")
+
+	n, err = hub.RedeliverDeadLetter(t.Context(), letters[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, strconv.Itoa(outBufferLength), (<-reconnected.Receive()).ID)
+
+	_, err = hub.RedeliverDeadLetter(t.Context(), letters[0].ID)
+	require.ErrorIs(t, err, ErrDeadLetterNotFound)
+
+	require.NoError(t, hub.DiscardDeadLetter(t.Context(), letters[1].ID))
+	assert.Empty(t, deadLetterIDs(t, store))
+}
+
+func TestDeadLettersAnonymous(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithDeadLetters(NewMemoryDeadLetterStore(0)))
+
+	newDeadLetterSubscriber(t, hub, "")
+	fillSubscriber(t, hub, 0)
+
+	var letters []*DeadLetter
+
+	require.Eventually(t, func() bool {
+		letters, _ = hub.DeadLetters(t.Context(), 0)
+
+		return len(letters) == 1
+	}, time.Second, time.Millisecond)
+
+	assert.Empty(t, letters[0].Subject)
+
+	_, err := hub.RedeliverDeadLetter(t.Context(), letters[0].ID)
+	require.ErrorIs(t, err, ErrDeadLetterNotRedeliverable)
+}
+
+func TestDeadLettersNotEnabled(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	_, err := hub.DeadLetters(t.Context(), 0)
+	require.ErrorIs(t, err, ErrDeadLettersNotEnabled)
+
+	_, err = hub.RedeliverDeadLetter(t.Context(), "foo")
+	require.ErrorIs(t, err, ErrDeadLettersNotEnabled)
+
+	require.ErrorIs(t, hub.DiscardDeadLetter(t.Context(), "foo"), ErrDeadLettersNotEnabled)
+}
+
+func TestDeadLettersRedeliveryNotSupported(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithTransport(&addSubscriberErrorTransport{}), WithDeadLetters(NewMemoryDeadLetterStore(0)))
+
+	_, err := hub.RedeliverDeadLetter(t.Context(), "foo")
+	require.ErrorIs(t, err, ErrRedeliveryNotSupported)
+}
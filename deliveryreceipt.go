@@ -0,0 +1,111 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+)
+
+// preferReceipt is the preference (RFC 7240) of the publishers requesting a
+// delivery receipt.
+const preferReceipt = "receipt"
+
+// ErrDeliveryReceiptsNotSupported is returned when the transport doesn't
+// implement TransportSynchronousDispatcher.
+var ErrDeliveryReceiptsNotSupported = errors.New("the transport doesn't support delivery receipts")
+
+// DeliveryReceipt counts the subscribers connected to the hub an update has
+// been handed to, see Hub.PublishWithReceipt.
+type DeliveryReceipt struct {
+	// ID is the ID of the update.
+	ID string `json:"id"`
+	// Delivered is the number of subscribers the update has been handed to,
+	// to be written to their connection.
+	Delivered int64 `json:"delivered"`
+	// Queued is the number of subscribers still receiving the updates of
+	// the history, the update will be sent to them after.
+	Queued int64 `json:"queued"`
+	// Dropped is the number of subscribers disconnected, or being
+	// disconnected, because they don't receive the updates fast enough.
+	Dropped int64 `json:"dropped"`
+}
+
+// deliveryReceipt collects the outcomes of the dispatch of an update to the
+// local subscribers.
+type deliveryReceipt struct {
+	delivered atomic.Int64
+	queued    atomic.Int64
+	dropped   atomic.Int64
+}
+
+// WithDeliveryReceipts allows the publishers to send the "Prefer: receipt"
+// header (RFC 7240): the response is then sent once the update has been
+// stored by the transport and handed to the subscribers connected to the
+// hub, and is a JSON DeliveryReceipt instead of the ID of the update.
+// Publishers implementing at-least-once delivery publish the update again
+// when the request fails or when no subscriber received it.
+//
+// The transport must implement TransportSynchronousDispatcher: transports
+// relying on a broker, such as Redis or Kafka, hand the updates to the
+// subscribers when they are received back, after the publication.
+func WithDeliveryReceipts() Option {
+	return func(o *opt) error {
+		o.deliveryReceipts = true
+
+		return nil
+	}
+}
+
+// validateDeliveryReceipts checks that the transport supports the delivery
+// receipts, when enabled.
+func (o *opt) validateDeliveryReceipts() error {
+	if o.deliveryReceipts && !dispatchesSynchronously(o.transport) {
+		return ErrDeliveryReceiptsNotSupported
+	}
+
+	return nil
+}
+
+// dispatchesSynchronously reports whether the transport hands the updates to
+// its local subscribers before Dispatch returns.
+func dispatchesSynchronously(t Transport) bool {
+	s, ok := t.(TransportSynchronousDispatcher)
+
+	return ok && s.DispatchesSynchronously()
+}
+
+// PublishWithReceipt publishes the update like Publish, and returns the
+// number of subscribers connected to the hub it has been handed to. The
+// subscribers of the other nodes of a cluster, the ones skipping the update
+// because they already have a newer state version, and the copies created by
+// routing rules are not counted. The receipt is returned with the errors
+// wrapping ErrPartialDispatch, the update having been published.
+//
+// ErrDeliveryReceiptsNotSupported is returned if the transport doesn't
+// implement TransportSynchronousDispatcher.
+func (h *Hub) PublishWithReceipt(ctx context.Context, u *Update) (DeliveryReceipt, error) {
+	if !dispatchesSynchronously(h.transport) {
+		return DeliveryReceipt{}, ErrDeliveryReceiptsNotSupported
+	}
+
+	r := &deliveryReceipt{}
+	u.receipt = r
+
+	err := h.Publish(ctx, u)
+	if err != nil && !errors.Is(err, ErrPartialDispatch) {
+		return DeliveryReceipt{}, err
+	}
+
+	return DeliveryReceipt{
+		ID:        u.ID,
+		Delivered: r.delivered.Load(),
+		Queued:    r.queued.Load(),
+		Dropped:   r.dropped.Load(),
+	}, err
+}
+
+// prefersReceipt reports whether the publisher requested a delivery receipt.
+func (h *Hub) prefersReceipt(r *http.Request) bool {
+	return h.deliveryReceipts && prefers(r, preferReceipt)
+}
@@ -0,0 +1,130 @@
+package mercure
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const receiptTopic = "https://example.com/books/1"
+
+// addReceiptSubscribers adds a subscriber receiving the updates, one
+// receiving the history, one too slow and one not subscribed to the topic.
+func addReceiptSubscribers(t *testing.T, hub *Hub) {
+	t.Helper()
+
+	transport := hub.transport.(*LocalTransport)
+
+	newSubscriber := func(topic string) *LocalSubscriber {
+		s := NewLocalSubscriber("", slog.Default(), hub.topicMatcherStore)
+		s.setMatchers(stringsToExactMatchers([]string{topic}), nil)
+
+		return s
+	}
+
+	require.NoError(t, transport.AddSubscriber(t.Context(), newSubscriber(receiptTopic)))
+	require.NoError(t, transport.AddSubscriber(t.Context(), newSubscriber("https://example.com/books/2")))
+
+	slow := newSubscriber(receiptTopic)
+	slow.out = make(chan *Update)
+	require.NoError(t, transport.AddSubscriber(t.Context(), slow))
+
+	// Not ready yet.
+	transport.subscribers.Add(newSubscriber(receiptTopic))
+}
+
+func TestPublishWithReceipt(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+	addReceiptSubscribers(t, hub)
+
+	receipt, err := hub.PublishWithReceipt(t.Context(), &Update{Topic: receiptTopic, Event: Event{ID: "id", Data: "Hello!"}})
+	require.NoError(t, err)
+	assert.Equal(t, DeliveryReceipt{ID: "id", Delivered: 1, Queued: 1, Dropped: 1}, receipt)
+
+	_, err = hub.PublishWithReceipt(t.Context(), &Update{Topic: "/.well-known/mercure/foo"})
+	require.ErrorIs(t, err, ErrReservedTopic)
+}
+
+func TestPublishHandlerReceipt(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithDeliveryReceipts())
+	addReceiptSubscribers(t, hub)
+
+	publish := func(prefer string) *http.Response {
+		form := url.Values{"id": {"id"}, "topic": {receiptTopic}, "data": {"Hello!"}}
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+		if prefer != "" {
+			req.Header.Add("Prefer", prefer)
+		}
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w.Result()
+	}
+
+	resp := publish("respond-async, Receipt; foo=bar")
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "receipt", resp.Header.Get("Preference-Applied"))
+
+	var receipt DeliveryReceipt
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&receipt))
+	assert.Equal(t, DeliveryReceipt{ID: "id", Delivered: 1, Queued: 1, Dropped: 1}, receipt)
+
+	resp = publish("")
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Preference-Applied"))
+}
+
+func TestPublishHandlerReceiptNotEnabled(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	form := url.Values{"topic": {receiptTopic}}
+
+	req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+	req.Header.Add("Prefer", "receipt")
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	resp := w.Result()
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Preference-Applied"))
+}
+
+func TestWithDeliveryReceiptsNotSupported(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithTransport(&addSubscriberErrorTransport{}), WithDeliveryReceipts())
+	require.ErrorIs(t, err, ErrDeliveryReceiptsNotSupported)
+
+	hub := createDummy(t, WithTransport(&addSubscriberErrorTransport{}))
+
+	_, err = hub.PublishWithReceipt(t.Context(), &Update{Topic: receiptTopic})
+	require.ErrorIs(t, err, ErrDeliveryReceiptsNotSupported)
+}
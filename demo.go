@@ -11,8 +11,6 @@ import (
 	"time"
 )
 
-const hubLink = "<" + defaultHubURL + `>; rel="mercure"`
-
 // uiContent is our static web server content.
 //
 //go:embed public
@@ -36,9 +34,9 @@ func (h *Hub) Demo(w http.ResponseWriter, r *http.Request) {
 	header := w.Header()
 
 	if h.cookieName == defaultCookieName {
-		header["Link"] = append(header["Link"], hubLink, "<"+url+`>; rel="self"`)
+		header["Link"] = append(header["Link"], h.hubLink, "<"+url+`>; rel="self"`)
 	} else {
-		header["Link"] = append(header["Link"], hubLink+`; cookie-name="`+h.cookieName+`"`, "<"+url+`>; rel="self"`)
+		header["Link"] = append(header["Link"], h.hubLink+`; cookie-name="`+h.cookieName+`"`, "<"+url+`>; rel="self"`)
 	}
 
 	if mimeType != "" {
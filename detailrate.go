@@ -0,0 +1,239 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxPublishRateBuckets is the number of publish rate buckets above which the
+// full ones, whose publishers have been idle long enough to be forgotten, are
+// removed.
+const maxPublishRateBuckets = 10_000
+
+var (
+	// ErrPublishRateExceeded is returned when publishing would exceed the
+	// max_rate of an authorization detail of the token. The publish endpoints
+	// answer with a 429 status code.
+	ErrPublishRateExceeded = errors.New("publish rate exceeded")
+
+	errInvalidMaxRate = errors.New(`"max_rate" must be a positive number`)
+)
+
+// validateMaxRate checks the max_rate member of a detail or a claim: absent
+// (nil) means unlimited.
+func validateMaxRate(rate *float64) (float64, error) {
+	if rate == nil {
+		return 0, nil
+	}
+
+	if *rate <= 0 || math.IsInf(*rate, 0) || math.IsNaN(*rate) {
+		return 0, errInvalidMaxRate
+	}
+
+	return *rate, nil
+}
+
+// rateBucket is a token bucket refilled with rate tokens per second, holding
+// at most one second of them, and at least one.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateBucket(rate float64, now time.Time) *rateBucket {
+	return &rateBucket{tokens: rateBurst(rate), last: now}
+}
+
+func rateBurst(rate float64) float64 {
+	return math.Max(1, rate)
+}
+
+// refill adds the tokens earned since the last refill, and reports whether the
+// bucket is full.
+func (b *rateBucket) refill(rate float64, now time.Time) bool {
+	burst := rateBurst(rate)
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	return b.tokens >= burst
+}
+
+// rateLimitedDetails returns the indexes of the details carrying the action
+// and a max_rate that grant the topics, the first detail granting a topic
+// being the one limiting it. When first is true, only the first granted topic
+// is considered.
+func (a *mercureAuthz) rateLimitedDetails(tms *TopicMatcherStore, action mercureAction, topics []string, first bool) []int {
+	if !a.hasMaxRate(action) {
+		return nil
+	}
+
+	var details []int
+
+	for _, t := range topics {
+		i := a.grantingDetail(tms, action, t)
+		if i < 0 {
+			continue
+		}
+
+		if a.details[i].maxRate > 0 && !slices.Contains(details, i) {
+			details = append(details, i)
+		}
+
+		if first {
+			break
+		}
+	}
+
+	return details
+}
+
+// hasMaxRate reports whether a detail carrying the action has a max_rate.
+func (a *mercureAuthz) hasMaxRate(action mercureAction) bool {
+	if a == nil {
+		return false
+	}
+
+	for i := range a.details {
+		if a.details[i].maxRate > 0 && a.details[i].hasAction(action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publishRates holds the publish rate buckets of a hub, by publisher and
+// authorization detail.
+type publishRates struct {
+	sync.Mutex
+
+	buckets map[string]*rateBucket
+}
+
+// checkPublishRate consumes one token per update from the buckets of the
+// details limiting the rate of their topics, and returns
+// ErrPublishRateExceeded without consuming anything if one of them is empty.
+//
+// The buckets are shared by the tokens of the same publisher (see
+// publisherID): a publisher can't reset its budget by getting a new token.
+// The tokens without sub nor jti claims share the same buckets.
+func (h *Hub) checkPublishRate(ctx context.Context, c *claims, topics ...[]string) error {
+	if c == nil || !c.authz.hasMaxRate(actionPublish) {
+		return nil
+	}
+
+	needed := make(map[int]float64)
+	for _, ts := range topics {
+		for _, i := range c.authz.rateLimitedDetails(h.topicMatcherStore, actionPublish, ts, false) {
+			needed[i]++
+		}
+	}
+
+	if len(needed) == 0 {
+		return nil
+	}
+
+	publisher := publisherID(c)
+	now := time.Now()
+
+	pr := &h.publishRates
+	pr.Lock()
+	defer pr.Unlock()
+
+	if pr.buckets == nil {
+		pr.buckets = make(map[string]*rateBucket)
+	}
+
+	if len(pr.buckets) > maxPublishRateBuckets {
+		pr.prune(now)
+	}
+
+	buckets := make(map[int]*rateBucket, len(needed))
+	for i, n := range needed {
+		rate := c.authz.details[i].maxRate
+		key := publisher + "\x00" + strconv.Itoa(i) + "\x00" + strconv.FormatFloat(rate, 'g', -1, 64)
+
+		b, ok := pr.buckets[key]
+		if !ok {
+			b = newRateBucket(rate, now)
+			pr.buckets[key] = b
+		}
+
+		b.refill(rate, now)
+		if b.tokens < n {
+			if h.logger.Enabled(ctx, slog.LevelInfo) {
+				h.logger.LogAttrs(ctx, slog.LevelInfo, "Publish rate exceeded", slog.String("publisher", publisher), slog.Float64("max_rate", rate))
+			}
+
+			return fmt.Errorf("%w: %g updates per second at most", ErrPublishRateExceeded, rate)
+		}
+
+		buckets[i] = b
+	}
+
+	for i, b := range buckets {
+		b.tokens -= needed[i]
+	}
+
+	return nil
+}
+
+// prune must be called with the lock held. It removes the full buckets, the
+// rate being parsed back from their key.
+func (pr *publishRates) prune(now time.Time) {
+	for key, b := range pr.buckets {
+		rate, err := strconv.ParseFloat(key[strings.LastIndexByte(key, 0)+1:], 64)
+		if err != nil || b.refill(rate, now) {
+			delete(pr.buckets, key)
+		}
+	}
+}
+
+// deliveryRates holds the delivery rate buckets of a subscriber, by
+// authorization detail.
+type deliveryRates map[int]*rateBucket
+
+// rateLimited must be called with mutex held. It reports whether delivering
+// the live update would exceed the max_rate of the subscribe detail granting
+// its first granted topic, and consumes a token otherwise.
+func (s *LocalSubscriber) rateLimited(u *Update) bool {
+	if s.Claims == nil {
+		return false
+	}
+
+	details := s.Claims.authz.rateLimitedDetails(s.topicMatcherStore, actionSubscribe, u.topics(), true)
+	if len(details) == 0 {
+		return false
+	}
+
+	i := details[0]
+	rate := s.Claims.authz.details[i].maxRate
+	now := time.Now()
+
+	if s.deliveryRates == nil {
+		s.deliveryRates = make(deliveryRates)
+	}
+
+	b, ok := s.deliveryRates[i]
+	if !ok {
+		b = newRateBucket(rate, now)
+		s.deliveryRates[i] = b
+	}
+
+	b.refill(rate, now)
+	if b.tokens < 1 {
+		return true
+	}
+
+	b.tokens--
+
+	return false
+}
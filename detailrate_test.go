@@ -0,0 +1,136 @@
+package mercure
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ratePtr(r float64) *float64 {
+	return &r
+}
+
+func TestAuthorizationDetailMaxRate(t *testing.T) {
+	t.Parallel()
+
+	tms := newTestTSS(t)
+
+	var d authorizationDetail
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"type": "https://mercure.rocks/authorization-detail",
+		"actions": ["publish"],
+		"topics": [{"match": "https://example.com/foo"}],
+		"max_rate": 2.5
+	}`), &d))
+
+	authz, err := validateAuthorizationDetails(tms, []authorizationDetail{d})
+	require.NoError(t, err)
+	assert.InDelta(t, 2.5, authz.details[0].maxRate, 0)
+
+	for _, rate := range []float64{0, -1} {
+		d.MaxRate = ratePtr(rate)
+
+		_, err := validateAuthorizationDetails(tms, []authorizationDetail{d})
+		require.ErrorIs(t, err, errInvalidAuthorizationDetail)
+		require.ErrorIs(t, err, errInvalidMaxRate)
+	}
+}
+
+func rateLimitedPublisherJWT(rate float64) string {
+	return mintAccessToken([]byte("publisher"), testResourceIdentifier, []authorizationDetail{
+		{
+			Type:    authorizationDetailTypeMercure,
+			Actions: []mercureAction{actionPublish},
+			Topics:  stringsToDetailTopics([]string{"https://example.com/limited"}),
+			MaxRate: ratePtr(rate),
+		},
+		{
+			Type:    authorizationDetailTypeMercure,
+			Actions: []mercureAction{actionPublish},
+			Topics:  stringsToDetailTopics([]string{"*"}),
+		},
+	})
+}
+
+func publishStatus(t *testing.T, hub *Hub, token, topic string) int {
+	t.Helper()
+
+	form := url.Values{"topic": {topic}, "data": {"foo"}}
+	req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", bearerPrefix+token)
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+
+	return w.Code
+}
+
+func TestPublishRate(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+	token := rateLimitedPublisherJWT(2)
+
+	assert.Equal(t, http.StatusOK, publishStatus(t, hub, token, "https://example.com/limited"))
+	assert.Equal(t, http.StatusOK, publishStatus(t, hub, token, "https://example.com/limited"))
+	assert.Equal(t, http.StatusTooManyRequests, publishStatus(t, hub, token, "https://example.com/limited"))
+
+	// The topics granted by the next detail aren't limited.
+	assert.Equal(t, http.StatusOK, publishStatus(t, hub, token, "https://example.com/other"))
+
+	// A new token of the same publisher shares the budget.
+	assert.Equal(t, http.StatusTooManyRequests, publishStatus(t, hub, rateLimitedPublisherJWT(2), "https://example.com/limited"))
+}
+
+func TestPublishGroupRate(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+	token := rateLimitedPublisherJWT(2)
+
+	resp := publishGroupRequest(t, hub, token, `[
+		{"topic": "https://example.com/limited", "data": "1"},
+		{"topic": "https://example.com/limited", "data": "2"},
+		{"topic": "https://example.com/limited", "data": "3"}
+	]`)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// Nothing has been consumed by the rejected group.
+	resp = publishGroupRequest(t, hub, token, `[
+		{"topic": "https://example.com/limited", "data": "1"},
+		{"topic": "https://example.com/limited", "data": "2"}
+	]`)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDeliveryRate(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	tms := newTestTSS(t)
+
+	s := NewLocalSubscriber("", slog.Default(), tms)
+	s.Claims = &claims{authz: &mercureAuthz{details: []validatedDetail{
+		{subscribe: true, topics: stringsToExactMatchers([]string{"https://example.com/limited"}), maxRate: 1},
+		{subscribe: true, topics: stringsToExactMatchers([]string{"*"})},
+	}}}
+	s.Ready(ctx)
+
+	for range 3 {
+		s.Dispatch(ctx, &Update{Topic: "https://example.com/limited"}, false)
+		s.Dispatch(ctx, &Update{Topic: "https://example.com/other"}, false)
+	}
+
+	// The history isn't limited.
+	s.Dispatch(ctx, &Update{Topic: "https://example.com/limited"}, true)
+
+	assert.Equal(t, SubscriberStats{Delivered: 5, Replayed: 1, Dropped: 2}, s.Stats())
+}
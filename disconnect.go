@@ -0,0 +1,133 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+)
+
+var (
+	// ErrDisconnectNotSupported is returned by DisconnectSubscribers when the
+	// transport does not implement TransportDisconnecter.
+	ErrDisconnectNotSupported = errors.New("the transport does not support disconnecting subscribers")
+	// ErrEmptySubscriberSelector is returned by DisconnectSubscribers when the
+	// selector has no criterion, to not disconnect everyone by mistake.
+	ErrEmptySubscriberSelector = errors.New("the subscriber selector has no criterion")
+)
+
+// SubscriberSelector selects subscribers to disconnect in bulk. A subscriber
+// is selected when it matches all the non-empty criteria.
+type SubscriberSelector struct {
+	// Topics selects the subscribers subscribed to at least one of these
+	// topics, that is to say those that would receive a public update
+	// published on them.
+	Topics []string `json:"topics,omitempty"`
+	// Issuer selects the subscribers whose token has this "iss" claim.
+	Issuer string `json:"iss,omitempty"`
+	// Subject selects the subscribers whose token has this "sub" claim.
+	Subject string `json:"sub,omitempty"`
+	// Audience selects the subscribers whose token has this value in its "aud"
+	// claim.
+	Audience string `json:"aud,omitempty"`
+	// TokenID selects the subscribers whose token has this "jti" claim.
+	TokenID string `json:"jti,omitempty"`
+}
+
+func (sel *SubscriberSelector) hasClaimCriteria() bool {
+	return sel.Issuer != "" || sel.Subject != "" || sel.Audience != "" || sel.TokenID != ""
+}
+
+// Match reports whether the subscriber is selected. Claim criteria never
+// select anonymous subscribers.
+func (sel *SubscriberSelector) Match(s *Subscriber) bool {
+	if len(sel.Topics) != 0 && !s.MatchTopics(sel.Topics, false) {
+		return false
+	}
+
+	if !sel.hasClaimCriteria() {
+		return true
+	}
+
+	if s.Claims == nil {
+		return false
+	}
+
+	c := s.Claims.RegisteredClaims
+
+	return (sel.Issuer == "" || c.Issuer == sel.Issuer) &&
+		(sel.Subject == "" || c.Subject == sel.Subject) &&
+		(sel.Audience == "" || slices.Contains(c.Audience, sel.Audience)) &&
+		(sel.TokenID == "" || c.ID == sel.TokenID)
+}
+
+func (sel *SubscriberSelector) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, 5)
+
+	if len(sel.Topics) != 0 {
+		attrs = append(attrs, slog.Any("topics", sel.Topics))
+	}
+
+	for _, a := range [...]struct{ k, v string }{{"iss", sel.Issuer}, {"sub", sel.Subject}, {"aud", sel.Audience}, {"jti", sel.TokenID}} {
+		if a.v != "" {
+			attrs = append(attrs, slog.String(a.k, a.v))
+		}
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// DisconnectSubscribers disconnects all the subscribers matching the
+// selector, on all the nodes of the cluster, and returns how many were
+// disconnected. With dryRun, nobody is disconnected and the returned count is
+// how many subscribers would have been. Disconnected subscribers can
+// reconnect: revoke their tokens first when they must not.
+//
+// The transport must implement TransportDisconnecter, otherwise
+// ErrDisconnectNotSupported is returned. Authorization is the caller's
+// responsibility.
+func (h *Hub) DisconnectSubscribers(ctx context.Context, sel *SubscriberSelector, dryRun bool) (int, error) {
+	if len(sel.Topics) == 0 && !sel.hasClaimCriteria() {
+		return 0, ErrEmptySubscriberSelector
+	}
+
+	tr, ok := h.transport.(TransportDisconnecter)
+	if !ok {
+		return 0, ErrDisconnectNotSupported
+	}
+
+	n, err := tr.DisconnectSubscribers(ctx, sel, dryRun)
+	if err != nil {
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to disconnect subscribers", slog.Any("selector", sel), slog.Any("error", err))
+		}
+
+		return 0, err //nolint:wrapcheck
+	}
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Subscribers disconnected", slog.Any("selector", sel), slog.Int("count", n), slog.Bool("dry_run", dryRun))
+	}
+
+	return n, nil
+}
+
+// disconnectSubscribers disconnects the connected subscribers of the list
+// matching the selector and returns their count.
+func disconnectSubscribers(sl *SubscriberList, sel *SubscriberSelector, dryRun bool) (n int) {
+	sl.Walk(0, func(s *LocalSubscriber) bool {
+		if s.disconnected.Load() > 0 || !sel.Match(&s.Subscriber) {
+			return true
+		}
+
+		n++
+
+		if !dryRun {
+			s.DisconnectWithReason(DisconnectReasonKicked)
+		}
+
+		return true
+	})
+
+	return n
+}
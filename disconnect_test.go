@@ -0,0 +1,64 @@
+package mercure
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDisconnectSubscribers(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	subscribers := make(map[string]*LocalSubscriber)
+
+	for name, tc := range map[string]struct {
+		topic  string
+		claims *claims
+	}{
+		"acme alice": {"https://example.com/books/1", &claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "https://acme.example.com", Subject: "alice"}}},
+		"acme bob":   {"https://example.com/books/2", &claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: "https://acme.example.com", Subject: "bob"}}},
+		"anonymous":  {"https://example.com/books/1", nil},
+	} {
+		s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+		s.Claims = tc.claims
+		s.setMatchers(stringsToExactMatchers([]string{tc.topic}), nil)
+		require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+
+		subscribers[name] = s
+	}
+
+	for name, tc := range map[string]struct {
+		selector SubscriberSelector
+		count    int
+	}{
+		"issuer":          {SubscriberSelector{Issuer: "https://acme.example.com"}, 2},
+		"topic":           {SubscriberSelector{Topics: []string{"https://example.com/books/1"}}, 2},
+		"topic and claim": {SubscriberSelector{Topics: []string{"https://example.com/books/1"}, Subject: "alice"}, 1},
+		"no match":        {SubscriberSelector{Subject: "carol"}, 0},
+	} {
+		n, err := hub.DisconnectSubscribers(t.Context(), &tc.selector, true)
+		require.NoError(t, err, name)
+		assert.Equal(t, tc.count, n, name)
+	}
+
+	n, err := hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Issuer: "https://acme.example.com"}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	for name, s := range subscribers {
+		assert.Equal(t, name != "anonymous", s.disconnected.Load() > 0, name)
+	}
+
+	// Already disconnected subscribers are not counted again.
+	n, err = hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Issuer: "https://acme.example.com"}, false)
+	require.NoError(t, err)
+	assert.Zero(t, n)
+
+	_, err = hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{}, true)
+	require.ErrorIs(t, err, ErrEmptySubscriberSelector)
+}
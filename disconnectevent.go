@@ -0,0 +1,101 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"math/rand/v2"
+	"strconv"
+	"time"
+)
+
+// WithDisconnectEvents sends a last event to the subscribers when the hub
+// closes their connection, telling them why, so they can react instead of
+// blindly reconnecting.
+//
+// The event has the reserved "mercure" type, and no ID not to reset the
+// Last-Event-ID of the client. When retry is not zero, the subscribers
+// disconnected because the hub or the transport stopped, or because they
+// were too slow, are advised to reconnect after a delay randomized between
+// retry/2 and retry, to spread the reconnections.
+func WithDisconnectEvents(retry time.Duration) Option {
+	return func(o *opt) error {
+		o.disconnectEvents = true
+		o.disconnectRetry = retry
+
+		return nil
+	}
+}
+
+// disconnection is the data of the disconnect events.
+type disconnection struct {
+	Type   string           `json:"type"`
+	Reason DisconnectReason `json:"reason"`
+	// Retry is the advised reconnection delay, in milliseconds.
+	Retry int64 `json:"retry,omitempty"`
+}
+
+// disconnectEvent returns the event telling why the hub closes the connection
+// of the subscriber, if the hub initiated it.
+func (h *Hub) disconnectEvent(reason DisconnectReason) (string, bool) {
+	d, ok := h.disconnection(reason)
+	if !ok {
+		return "", false
+	}
+
+	j, err := json.Marshal(d)
+	if err != nil {
+		panic(err)
+	}
+
+	event := "event: " + reservedEventType + "\n"
+	if d.Retry != 0 {
+		event += "retry: " + strconv.FormatInt(d.Retry, 10) + "\n"
+	}
+
+	return event + "data: " + string(j) + "\n\n", true
+}
+
+// disconnection returns the data of the disconnect event, if the hub
+// initiated the disconnection.
+func (h *Hub) disconnection(reason DisconnectReason) (disconnection, bool) {
+	d := disconnection{Type: "Disconnection", Reason: reason}
+
+	switch reason {
+	case DisconnectReasonHubShutdown, DisconnectReasonTransportClosed, DisconnectReasonSlowConsumer:
+		if h.disconnectRetry > 0 {
+			d.Retry = (h.disconnectRetry/2 + rand.N(h.disconnectRetry/2+1)).Milliseconds() //nolint:gosec
+		}
+	case DisconnectReasonDeadline, DisconnectReasonTokenExpired, DisconnectReasonKicked:
+	default:
+		// The connection is already gone.
+		return d, false
+	}
+
+	return d, true
+}
+
+// closeConnection disconnects the subscriber and, when enabled, sends it its
+// statistics and the disconnect event. reason is ignored when the subscriber
+// has already been disconnected, by the transport for instance.
+func (h *Hub) closeConnection(ctx context.Context, rc *responseController, s *LocalSubscriber, reason DisconnectReason) {
+	s.DisconnectWithReason(reason)
+
+	if !h.disconnectEvents && !h.subscriberStats {
+		return
+	}
+
+	event, ok := h.disconnectEvent(s.disconnectReason)
+	if !ok {
+		return
+	}
+
+	if !h.disconnectEvents {
+		event = ""
+	}
+
+	if h.subscriberStats {
+		event = statsComment(s) + event
+	}
+
+	h.write(ctx, rc, event)
+}
@@ -0,0 +1,158 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscribeUntilDisconnected subscribes to the hub, calls disconnect once the
+// subscriber is connected, and returns the response body.
+func subscribeUntilDisconnected(t *testing.T, hub *Hub, disconnect func(cancel context.CancelFunc)) string {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1", nil).WithContext(ctx)
+	w := newSubscribeRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+	disconnect(cancel)
+	<-done
+
+	return w.Body.String()
+}
+
+func TestDisconnectEvents(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name       string
+		options    []Option
+		disconnect func(t *testing.T, hub *Hub, cancel context.CancelFunc)
+		reason     DisconnectReason
+	}{
+		{
+			name:       "deadline",
+			options:    []Option{WithWriteTimeout(200 * time.Millisecond), WithDispatchTimeout(50 * time.Millisecond)},
+			disconnect: func(*testing.T, *Hub, context.CancelFunc) {},
+			reason:     DisconnectReasonDeadline,
+		},
+		{
+			name: "kicked",
+			disconnect: func(t *testing.T, hub *Hub, _ context.CancelFunc) {
+				t.Helper()
+
+				_, err := hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Topics: []string{"https://example.com/books/1"}}, false)
+				require.NoError(t, err)
+			},
+			reason: DisconnectReasonKicked,
+		},
+		{
+			name:       "client",
+			disconnect: func(_ *testing.T, _ *Hub, cancel context.CancelFunc) { cancel() },
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			hub := createAnonymousDummy(t, append([]Option{WithDisconnectEvents(time.Second)}, tc.options...)...)
+			body := subscribeUntilDisconnected(t, hub, func(cancel context.CancelFunc) { tc.disconnect(t, hub, cancel) })
+
+			if tc.reason == "" {
+				assert.NotContains(t, body, "Disconnection")
+
+				return
+			}
+
+			assert.Equal(t, "event: mercure\ndata: {\"type\":\"Disconnection\",\"reason\":\""+string(tc.reason)+"\"}\n\n", body[strings.Index(body, "event: mercure"):])
+		})
+	}
+}
+
+func TestDisconnectEventTokenExpired(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithDispatchTimeout(200*time.Millisecond), WithDisconnectEvents(time.Second))
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Header["typ"] = atJWTType
+	token.Claims = &claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testResourceIdentifier},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Second)),
+		},
+		AuthorizationDetails: subscribeDetailsFromMatchers(nil, TopicMatcher{Type: MatcherTypeExact, Pattern: "*"}),
+	}
+
+	signedString, err := token.SignedString([]byte("subscriber"))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=foo", nil)
+	req.Header.Add("Authorization", bearerPrefix+signedString)
+
+	w := newSubscribeRecorder()
+	hub.SubscribeHandler(w, req)
+
+	assert.Contains(t, w.Body.String(), `"reason":"token_expired"`)
+}
+
+func TestDisconnectEventsDisabled(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+	body := subscribeUntilDisconnected(t, hub, func(context.CancelFunc) {
+		_, err := hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Topics: []string{"https://example.com/books/1"}}, false)
+		require.NoError(t, err)
+	})
+
+	assert.NotContains(t, body, "Disconnection")
+}
+
+func TestDisconnectEventRetry(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithDisconnectEvents(10*time.Second))
+
+	for range 10 {
+		event, ok := hub.disconnectEvent(DisconnectReasonHubShutdown)
+		require.True(t, ok)
+
+		lines := strings.Split(event, "\n")
+		require.Len(t, lines, 5)
+		assert.Equal(t, "event: mercure", lines[0])
+
+		retry, err := strconv.Atoi(strings.TrimPrefix(lines[1], "retry: "))
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, retry, 5000)
+		assert.LessOrEqual(t, retry, 10000)
+
+		var d disconnection
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[2], "data: ")), &d))
+		assert.Equal(t, disconnection{Type: "Disconnection", Reason: DisconnectReasonHubShutdown, Retry: int64(retry)}, d)
+	}
+
+	event, ok := hub.disconnectEvent(DisconnectReasonTokenExpired)
+	require.True(t, ok)
+	assert.NotContains(t, event, "retry")
+
+	_, ok = hub.disconnectEvent(DisconnectReasonWriteFailed)
+	assert.False(t, ok)
+}
@@ -0,0 +1,184 @@
+package mercure
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// discoveryURL is the endpoint serving the discovery document.
+	discoveryURL = defaultHubURL + "/discovery"
+
+	defaultHubLink = "<" + defaultHubURL + `>; rel="mercure"`
+)
+
+// ErrInvalidHubLink is returned when the URL or a relation type of the hub
+// link can't be written in a Link header.
+var ErrInvalidHubLink = errors.New("invalid hub link")
+
+// WithHubLink customizes the rel="mercure" Link header advertising the hub,
+// for instance when the subscribers reach it through an external URL. The
+// rels are additional relation types of the link, like "hub".
+//
+// The URL defaults to /.well-known/mercure, relative to the origin of the
+// request.
+func WithHubLink(hubURL string, rels ...string) Option {
+	return func(o *opt) error {
+		if hubURL == "" {
+			hubURL = defaultHubURL
+		}
+
+		if _, err := url.Parse(hubURL); err != nil || strings.ContainsAny(hubURL, "<> \t\r\n") {
+			return ErrInvalidHubLink
+		}
+
+		relTypes := []string{"mercure"}
+
+		for _, rel := range rels {
+			// RFC 8288 relation types are tokens or URIs, which contain
+			// neither spaces nor quotes.
+			if rel == "" || strings.ContainsFunc(rel, func(r rune) bool { return r <= ' ' || r == '"' || r == '\\' || r >= 0x7f }) {
+				return ErrInvalidHubLink
+			}
+
+			if rel != "mercure" {
+				relTypes = append(relTypes, rel)
+			}
+		}
+
+		o.hubURL = hubURL
+		o.hubLink = "<" + hubURL + `>; rel="` + strings.Join(relTypes, " ") + `"`
+
+		return nil
+	}
+}
+
+// WithDiscovery serves the discovery document at
+// /.well-known/mercure/discovery, letting the clients detect the features
+// of the hub.
+func WithDiscovery() Option {
+	return func(o *opt) error {
+		o.discovery = true
+
+		return nil
+	}
+}
+
+// discoveryDocument describes the hub.
+type discoveryDocument struct {
+	Hub       string              `json:"hub"`
+	Subscribe *discoverySubscribe `json:"subscribe,omitempty"`
+	Publish   *discoveryPublish   `json:"publish,omitempty"`
+	// Endpoints are the URLs of the optional endpoints the hub serves, by
+	// feature.
+	Endpoints map[string]string `json:"endpoints,omitempty"`
+}
+
+type discoverySubscribe struct {
+	// Formats are the media types of the streams.
+	Formats      []string `json:"formats"`
+	Methods      []string `json:"methods"`
+	MatcherTypes []string `json:"matcher_types"`
+	Anonymous    bool     `json:"anonymous"`
+	// Heartbeat is the interval of the keep-alive comments, in seconds, 0 if
+	// disabled.
+	Heartbeat float64 `json:"heartbeat"`
+}
+
+type discoveryPublish struct {
+	Formats []string `json:"formats"`
+	// MaxPayload is the maximum size of the requests, in bytes, 0 if
+	// unlimited.
+	MaxPayload int64 `json:"max_payload"`
+}
+
+// DiscoveryHandler serves the discovery document.
+func (h *Hub) DiscoveryHandler(w http.ResponseWriter, r *http.Request) {
+	doc := discoveryDocument{Hub: h.hubURL, Endpoints: make(map[string]string)}
+
+	if h.subscriberConfigured || h.anonymous || h.capabilityAEAD != nil {
+		doc.Subscribe = &discoverySubscribe{
+			Formats:      headerContentType,
+			Methods:      []string{http.MethodGet, methodQuery},
+			MatcherTypes: h.matcherTypes(),
+			Anonymous:    h.anonymous,
+			Heartbeat:    h.heartbeat.Seconds(),
+		}
+
+		if _, ok := h.transport.(TransportHistory); ok {
+			doc.Endpoints["history"] = h.absoluteURL(historyURL)
+		}
+
+		if h.webSocket {
+			doc.Endpoints["websocket"] = h.absoluteURL(webSocketURL)
+		}
+
+		if h.longPollingTimeout != 0 {
+			doc.Endpoints["poll"] = h.absoluteURL(pollURL)
+		}
+	}
+
+	if h.subscriberConfigured && h.capabilityAEAD != nil {
+		doc.Endpoints["capabilities"] = h.absoluteURL(capabilitiesURL)
+	}
+
+	if h.publisherConfigured {
+		doc.Publish = &discoveryPublish{
+			Formats:    []string{"application/x-www-form-urlencoded"},
+			MaxPayload: h.maxRequestBodySize,
+		}
+
+		if h.blobStore != nil {
+			doc.Publish.Formats = append(doc.Publish.Formats, "multipart/form-data")
+		}
+
+		if _, ok := h.transport.(TransportGroupDispatcher); ok {
+			doc.Endpoints["publish_group"] = h.absoluteURL(publishGroupURL)
+		}
+
+		if _, ok := h.transport.(TransportRetracter); ok {
+			doc.Endpoints["retract"] = h.absoluteURL(retractURL)
+		}
+
+		if h.subscriptionApproval != nil {
+			doc.Endpoints["approvals"] = h.absoluteURL(approvalsURL)
+		}
+	}
+
+	if h.broadcastScript != nil {
+		doc.Endpoints["broadcast_script"] = h.absoluteURL(broadcastScriptURL)
+	}
+
+	if _, ok := h.transport.(TransportSubscribers); ok && h.subscriptions {
+		doc.Endpoints["subscriptions"] = h.absoluteURL(subscriptionsURL)
+	}
+
+	if h.publisherConfigured || h.subscriberConfigured {
+		metadataURL := h.resourceMetadataURL
+		if metadataURL == "" {
+			metadataURL = protectedResourceMetadataPath
+		}
+
+		doc.Endpoints["resource_metadata"] = metadataURL
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(doc); err != nil && h.logger.Enabled(r.Context(), slog.LevelInfo) {
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "Failed to write discovery response", slog.Any("error", err))
+	}
+}
+
+// matcherTypes returns the matcher types the subscribers can use.
+func (h *Hub) matcherTypes() []string {
+	types := []string{string(MatcherTypeExact), string(MatcherTypeURLPattern)}
+	if h.topicMatcherStore.supportsMatcherType(MatcherTypeRegexp) {
+		types = append(types, string(MatcherTypeRegexp))
+	}
+
+	return types
+}
@@ -0,0 +1,113 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithHubLink(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithHubLink("https://hub.example.com/.well-known/mercure", "hub", "mercure"))
+	assert.Equal(t, "https://hub.example.com/.well-known/mercure", hub.hubURL)
+	assert.Equal(t, `<https://hub.example.com/.well-known/mercure>; rel="mercure hub"`, hub.hubLink)
+
+	hub = createDummy(t)
+	assert.Equal(t, defaultHubURL, hub.hubURL)
+	assert.Equal(t, defaultHubLink, hub.hubLink)
+
+	req := httptest.NewRequest(http.MethodGet, "https://example.com/demo/foo", nil)
+	w := httptest.NewRecorder()
+
+	h, err := NewHub(t.Context(), WithHubLink("", "hub"))
+	require.NoError(t, err)
+	h.Demo(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, []string{`</.well-known/mercure>; rel="mercure hub"`, `<https://example.com/demo/foo>; rel="self"`}, resp.Header["Link"])
+}
+
+func TestWithHubLinkInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, o := range []Option{
+		WithHubLink("https://example.com/>; rel=\"evil\""),
+		WithHubLink("https://example.com/\r\nSet-Cookie: foo"),
+		WithHubLink("", ""),
+		WithHubLink("", `hub"`),
+		WithHubLink("", "hub other"),
+	} {
+		_, err := NewHub(t.Context(), o)
+		require.ErrorIs(t, err, ErrInvalidHubLink)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t,
+		WithDiscovery(),
+		WithAnonymous(),
+		WithPublicURL("https://example.com/.well-known/mercure"),
+		WithHubLink("https://hub.example.com/.well-known/mercure"),
+		WithSubscriptions(),
+		WithWebSocket(),
+		WithMaxRequestBodySize(1024),
+	)
+
+	req := httptest.NewRequest(http.MethodGet, discoveryURL, nil)
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var doc discoveryDocument
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+
+	assert.Equal(t, "https://hub.example.com/.well-known/mercure", doc.Hub)
+
+	require.NotNil(t, doc.Subscribe)
+	assert.Equal(t, []string{"text/event-stream"}, doc.Subscribe.Formats)
+	assert.Equal(t, []string{http.MethodGet, methodQuery}, doc.Subscribe.Methods)
+	assert.Equal(t, []string{"exact", "urlpattern"}, doc.Subscribe.MatcherTypes)
+	assert.True(t, doc.Subscribe.Anonymous)
+	assert.InDelta(t, DefaultHeartbeat.Seconds(), doc.Subscribe.Heartbeat, 0)
+
+	require.NotNil(t, doc.Publish)
+	assert.Equal(t, []string{"application/x-www-form-urlencoded"}, doc.Publish.Formats)
+	assert.Equal(t, int64(1024), doc.Publish.MaxPayload)
+
+	assert.Equal(t, map[string]string{
+		"history":           "https://example.com/.well-known/mercure/history",
+		"websocket":         "https://example.com/.well-known/mercure/ws",
+		"publish_group":     "https://example.com/.well-known/mercure/group",
+		"subscriptions":     "https://example.com/.well-known/mercure/subscriptions",
+		"resource_metadata": "https://example.com/.well-known/oauth-protected-resource/.well-known/mercure",
+	}, doc.Endpoints)
+}
+
+func TestDiscoveryDisabled(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	req := httptest.NewRequest(http.MethodGet, discoveryURL, nil)
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
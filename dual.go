@@ -0,0 +1,460 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDualTransportUnsupported is returned by DualTransport when the transport
+// serving reads doesn't support the requested operation.
+var ErrDualTransportUnsupported = errors.New("the transport serving reads does not support this operation")
+
+// DualTransport writes the updates to two transports, to migrate from one to
+// the other without downtime. Subscribers and history requests are served by
+// the old transport until Cutover is called, and by the new one afterward.
+// Subscribers connected before the cutover stay on the old transport, which
+// keeps receiving every update, until they reconnect.
+//
+// The new transport only holds the updates published since the dual-write
+// started: keep writing to both transports for at least the retention period
+// of the history before cutting over.
+//
+// The transport serving reads is authoritative: its errors are returned,
+// while the errors of the other one are logged, so the hub keeps running if
+// the transport being migrated to fails. SetPartialDispatchPolicy allows
+// retrying the writes to the other transport, rolling back the updates it
+// failed to store, or sending them to a dead-letter target.
+type DualTransport struct {
+	// mu serializes writes, so both histories hold the updates in the same
+	// order.
+	mu sync.Mutex
+
+	from    Transport
+	to      Transport
+	logger  *slog.Logger
+	cutover atomic.Bool
+	policy  PartialDispatchPolicy
+	metrics PartialDispatchMetrics
+}
+
+// NewDualTransport creates a DualTransport writing to the old transport from,
+// and to the new transport to, serving reads from the new one when cutover is
+// true.
+func NewDualTransport(from, to Transport, logger *slog.Logger, cutover bool) *DualTransport {
+	t := &DualTransport{from: from, to: to, logger: logger}
+	t.cutover.Store(cutover)
+
+	return t
+}
+
+// Cutover serves the subscribers connecting from now on, and the history, from
+// the new transport.
+func (t *DualTransport) Cutover() {
+	if t.cutover.CompareAndSwap(false, true) && t.logger.Enabled(context.Background(), slog.LevelInfo) {
+		t.logger.LogAttrs(context.Background(), slog.LevelInfo, "Transport cutover, reads are now served by the new transport")
+	}
+}
+
+// IsCutover reports whether reads are served by the new transport.
+func (t *DualTransport) IsCutover() bool {
+	return t.cutover.Load()
+}
+
+// transports returns the transport serving reads, then the other one.
+func (t *DualTransport) transports() (primary, secondary Transport) { //nolint:ireturn
+	if t.cutover.Load() {
+		return t.to, t.from
+	}
+
+	return t.from, t.to
+}
+
+// secondaryFailed logs an error of the transport not serving reads.
+func (t *DualTransport) secondaryFailed(ctx context.Context, op string, err error) {
+	if t.logger.Enabled(ctx, slog.LevelError) {
+		t.logger.LogAttrs(ctx, slog.LevelError, "Dual-write: the secondary transport failed", slog.String("operation", op), slog.Any("error", err))
+	}
+}
+
+// Dispatch dispatches an update to both transports.
+func (t *DualTransport) Dispatch(ctx context.Context, u *Update) error {
+	// Both transports must store the same ID.
+	u.AssignUUID()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	primary, secondary := t.transports()
+	if err := primary.Dispatch(ctx, u); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return t.writeSecondary(ctx, "dispatch", primary, secondary, []*Update{u})
+}
+
+// DispatchGroup dispatches a group of updates to both transports. The
+// transport serving reads must implement TransportGroupDispatcher, otherwise
+// ErrGroupNotSupported is returned; the updates are dispatched one by one to
+// the other one if it doesn't.
+func (t *DualTransport) DispatchGroup(ctx context.Context, updates []*Update) error {
+	for _, u := range updates {
+		u.AssignUUID()
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	primary, secondary := t.transports()
+
+	gd, ok := primary.(TransportGroupDispatcher)
+	if !ok {
+		return ErrGroupNotSupported
+	}
+
+	if err := gd.DispatchGroup(ctx, updates); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return t.writeSecondary(ctx, "dispatch_group", primary, secondary, updates)
+}
+
+// AddSubscriber adds a new subscriber to the transport serving reads.
+func (t *DualTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	primary, _ := t.transports()
+
+	return primary.AddSubscriber(ctx, s) //nolint:wrapcheck
+}
+
+// RemoveSubscriber removes a subscriber from both transports, as it may
+// have been added before the cutover.
+func (t *DualTransport) RemoveSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	return errors.Join(t.from.RemoveSubscriber(ctx, s), t.to.RemoveSubscriber(ctx, s))
+}
+
+// GetSubscribers gets the last event ID of the transport serving reads, and
+// the subscribers of both transports.
+func (t *DualTransport) GetSubscribers(ctx context.Context) (string, []*Subscriber, error) {
+	primary, secondary := t.transports()
+
+	ps, ok := primary.(TransportSubscribers)
+	if !ok {
+		return "", nil, ErrDualTransportUnsupported
+	}
+
+	lastEventID, subscribers, err := ps.GetSubscribers(ctx)
+	if err != nil {
+		return "", nil, err //nolint:wrapcheck
+	}
+
+	if ss, ok := secondary.(TransportSubscribers); ok {
+		_, s, err := ss.GetSubscribers(ctx)
+		if err != nil {
+			return "", nil, err //nolint:wrapcheck
+		}
+
+		subscribers = append(subscribers, s...)
+	}
+
+	return lastEventID, subscribers, nil
+}
+
+// RetractableUpdate returns the update with the given ID from the history of
+// the transport serving reads.
+func (t *DualTransport) RetractableUpdate(ctx context.Context, id string) (*Update, error) {
+	primary, _ := t.transports()
+
+	tr, ok := primary.(TransportRetracter)
+	if !ok {
+		return nil, ErrRetractionNotSupported
+	}
+
+	return tr.RetractableUpdate(ctx, id) //nolint:wrapcheck
+}
+
+// Retract retracts the update in both transports. The update may be missing
+// from the other transport if it has been published before the dual-write
+// started.
+func (t *DualTransport) Retract(ctx context.Context, id string, retraction *Update) error {
+	retraction.AssignUUID()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	primary, secondary := t.transports()
+
+	tr, ok := primary.(TransportRetracter)
+	if !ok {
+		return ErrRetractionNotSupported
+	}
+
+	if err := tr.Retract(ctx, id, retraction); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	str, ok := secondary.(TransportRetracter)
+	if !ok {
+		return nil
+	}
+
+	if err := str.Retract(ctx, id, retraction); err != nil && !errors.Is(err, ErrUpdateNotFound) {
+		t.secondaryFailed(ctx, "retract", err)
+	}
+
+	return nil
+}
+
+// ReadHistory reads the history of the transport serving reads.
+func (t *DualTransport) ReadHistory(ctx context.Context, fn func(u *Update) error) error {
+	primary, _ := t.transports()
+
+	hr, ok := primary.(TransportHistoryReader)
+	if !ok {
+		return ErrDualTransportUnsupported
+	}
+
+	return hr.ReadHistory(ctx, fn) //nolint:wrapcheck
+}
+
+// EventIDCodec returns the codec of the IDs of the transport serving reads,
+// if any.
+func (t *DualTransport) EventIDCodec() EventIDCodec { //nolint:ireturn
+	primary, _ := t.transports()
+
+	return transportEventIDCodec(primary)
+}
+
+// FetchSince fetches the updates from the transport serving reads.
+func (t *DualTransport) FetchSince(ctx context.Context, lastEventID string, topics []string, limit int) ([]*Update, error) {
+	primary, _ := t.transports()
+
+	th, ok := primary.(TransportHistory)
+	if !ok {
+		return nil, ErrDualTransportUnsupported
+	}
+
+	return th.FetchSince(ctx, lastEventID, topics, limit) //nolint:wrapcheck
+}
+
+// DisconnectSubscribers disconnects the matching subscribers of both
+// transports.
+func (t *DualTransport) DisconnectSubscribers(ctx context.Context, sel *SubscriberSelector, dryRun bool) (int, error) {
+	var n int
+
+	supported := false
+
+	for _, tr := range []Transport{t.from, t.to} {
+		d, ok := tr.(TransportDisconnecter)
+		if !ok {
+			continue
+		}
+
+		supported = true
+
+		c, err := d.DisconnectSubscribers(ctx, sel, dryRun)
+		if err != nil {
+			return n, err //nolint:wrapcheck
+		}
+
+		n += c
+	}
+
+	if !supported {
+		return 0, ErrDisconnectNotSupported
+	}
+
+	return n, nil
+}
+
+// PurgeHistory purges the history of both transports, which must support
+// it: the updates copied to the new transport must be purged too. The larger
+// of the two counts is returned, the histories holding the same updates. The
+// transports are not purged atomically together.
+func (t *DualTransport) PurgeHistory(ctx context.Context, sel *HistoryPurgeSelector, dryRun bool) (int, error) {
+	purgers := make([]TransportHistoryPurger, 0, 2)
+
+	for _, tr := range []Transport{t.from, t.to} {
+		p, ok := tr.(TransportHistoryPurger)
+		if !ok {
+			return 0, ErrHistoryPurgeNotSupported
+		}
+
+		purgers = append(purgers, p)
+	}
+
+	var n int
+
+	for _, p := range purgers {
+		c, err := p.PurgeHistory(ctx, sel, dryRun)
+		if err != nil {
+			return n, err //nolint:wrapcheck
+		}
+
+		n = max(n, c)
+	}
+
+	return n, nil
+}
+
+// Redeliver dispatches the update to the matching subscribers of both
+// transports.
+func (t *DualTransport) Redeliver(ctx context.Context, sel *SubscriberSelector, u *Update) (int, error) {
+	var n int
+
+	supported := false
+
+	for _, tr := range []Transport{t.from, t.to} {
+		r, ok := tr.(TransportRedeliverer)
+		if !ok {
+			continue
+		}
+
+		supported = true
+
+		c, err := r.Redeliver(ctx, sel, u)
+		if err != nil {
+			return n, err //nolint:wrapcheck
+		}
+
+		n += c
+	}
+
+	if !supported {
+		return 0, ErrRedeliveryNotSupported
+	}
+
+	return n, nil
+}
+
+// Ready reports whether both transports can serve traffic.
+func (t *DualTransport) Ready(ctx context.Context) error {
+	return t.checkHealth(ctx, TransportHealthChecker.Ready)
+}
+
+// Live reports whether both transports are operational.
+func (t *DualTransport) Live(ctx context.Context) error {
+	return t.checkHealth(ctx, TransportHealthChecker.Live)
+}
+
+func (t *DualTransport) checkHealth(ctx context.Context, check func(TransportHealthChecker, context.Context) error) error {
+	var errs []error
+
+	for _, tr := range []Transport{t.from, t.to} {
+		if hc, ok := tr.(TransportHealthChecker); ok {
+			errs = append(errs, check(hc, ctx))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// SetSubscriberShards shards the subscribers of both transports.
+func (t *DualTransport) SetSubscriberShards(n int) {
+	for _, tr := range []Transport{t.from, t.to} {
+		if s, ok := tr.(TransportSubscriberSharder); ok {
+			s.SetSubscriberShards(n)
+		}
+	}
+}
+
+// SetTopicMatcherStore passes the store to both transports.
+func (t *DualTransport) SetTopicMatcherStore(store *TopicMatcherStore) {
+	for _, tr := range []Transport{t.from, t.to} {
+		if s, ok := tr.(TransportTopicMatcherStore); ok {
+			s.SetTopicMatcherStore(store)
+		}
+	}
+}
+
+// Close closes both transports, and returns the errors of both.
+func (t *DualTransport) Close(ctx context.Context) error {
+	return errors.Join(t.from.Close(ctx), t.to.Close(ctx))
+}
+
+// RememberIdempotencyKey records the idempotency key in the index of the
+// transport serving reads, which the hubs share.
+func (t *DualTransport) RememberIdempotencyKey(ctx context.Context, key, id string, ttl time.Duration) (string, bool, error) {
+	primary, _ := t.transports()
+
+	i, ok := primary.(TransportIdempotencyIndex)
+	if !ok {
+		return "", false, ErrDualTransportUnsupported
+	}
+
+	return i.RememberIdempotencyKey(ctx, key, id, ttl) //nolint:wrapcheck
+}
+
+// ForgetIdempotencyKey removes the idempotency key from the index of the
+// transport serving reads.
+func (t *DualTransport) ForgetIdempotencyKey(ctx context.Context, key string) error {
+	primary, _ := t.transports()
+
+	i, ok := primary.(TransportIdempotencyIndex)
+	if !ok {
+		return ErrDualTransportUnsupported
+	}
+
+	return i.ForgetIdempotencyKey(ctx, key) //nolint:wrapcheck
+}
+
+// VerifyHistoryChain verifies the hash chain of the history of the transport
+// serving reads.
+func (t *DualTransport) VerifyHistoryChain(ctx context.Context) (*HistoryChainReport, error) {
+	primary, _ := t.transports()
+
+	v, ok := primary.(TransportHistoryChainVerifier)
+	if !ok {
+		return nil, ErrDualTransportUnsupported
+	}
+
+	return v.VerifyHistoryChain(ctx) //nolint:wrapcheck
+}
+
+// SetRetentionExemptions passes the exemptions to both transports, which must
+// enforce them.
+func (t *DualTransport) SetRetentionExemptions(e RetentionExemptions) error {
+	for _, tr := range []Transport{t.from, t.to} {
+		r, ok := tr.(TransportRetentionExemptions)
+		if !ok {
+			return ErrRetentionExemptionsNotSupported
+		}
+
+		if err := r.SetRetentionExemptions(e); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return nil
+}
+
+// DispatchesSynchronously reports whether both transports dispatch the updates
+// synchronously: the subscribers connected before the cutover stay on the old
+// transport.
+func (t *DualTransport) DispatchesSynchronously() bool {
+	return dispatchesSynchronously(t.from) && dispatchesSynchronously(t.to)
+}
+
+// Interface guards.
+var (
+	_ Transport                      = (*DualTransport)(nil)
+	_ TransportSynchronousDispatcher = (*DualTransport)(nil)
+	_ TransportIdempotencyIndex      = (*DualTransport)(nil)
+	_ TransportHistoryChainVerifier  = (*DualTransport)(nil)
+	_ TransportRetentionExemptions   = (*DualTransport)(nil)
+	_ TransportSubscribers           = (*DualTransport)(nil)
+	_ TransportGroupDispatcher       = (*DualTransport)(nil)
+	_ TransportRetracter             = (*DualTransport)(nil)
+	_ TransportHistoryReader         = (*DualTransport)(nil)
+	_ TransportHistory               = (*DualTransport)(nil)
+	_ TransportDisconnecter          = (*DualTransport)(nil)
+	_ TransportEventIDCodec          = (*DualTransport)(nil)
+	_ TransportRedeliverer           = (*DualTransport)(nil)
+	_ TransportHistoryPurger         = (*DualTransport)(nil)
+	_ TransportHealthChecker         = (*DualTransport)(nil)
+	_ TransportTopicMatcherStore     = (*DualTransport)(nil)
+	_ TransportSubscriberSharder     = (*DualTransport)(nil)
+	_ TransportMetrics               = (*DualTransport)(nil)
+)
@@ -0,0 +1,115 @@
+package mercure
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readHistoryIDs(t *testing.T, r TransportHistoryReader) (ids []string) {
+	t.Helper()
+
+	require.NoError(t, r.ReadHistory(t.Context(), func(u *Update) error {
+		ids = append(ids, u.ID)
+
+		return nil
+	}))
+
+	return ids
+}
+
+func TestDualTransport(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	from := createBoltTransport(t, 0, 0)
+
+	to, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "to.db"), "", 0, 0)
+	require.NoError(t, err)
+
+	transport := NewDualTransport(from, to, slog.Default(), false)
+	defer transport.Close(ctx)
+
+	before := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	before.setMatchers(stringsToExactMatchers([]string{"*"}), nil)
+	require.NoError(t, transport.AddSubscriber(ctx, before))
+	assert.Equal(t, 1, from.subscribers.Len())
+	assert.Zero(t, to.subscribers.Len())
+
+	u := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, transport.Dispatch(ctx, u))
+	assert.Equal(t, u.ID, (<-before.Receive()).ID)
+
+	assert.False(t, transport.IsCutover())
+	transport.Cutover()
+	assert.True(t, transport.IsCutover())
+
+	after := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	after.setMatchers(stringsToExactMatchers([]string{"*"}), nil)
+	require.NoError(t, transport.AddSubscriber(ctx, after))
+	assert.Equal(t, 1, from.subscribers.Len())
+	assert.Equal(t, 1, to.subscribers.Len())
+
+	group := []*Update{{Topic: "https://example.com/books/2"}, {Topic: "https://example.com/books/3"}}
+	require.NoError(t, transport.DispatchGroup(ctx, group))
+
+	for _, s := range []*LocalSubscriber{before, after} {
+		assert.Equal(t, group[0].ID, (<-s.Receive()).ID)
+		assert.Equal(t, group[1].ID, (<-s.Receive()).ID)
+	}
+
+	lastEventID, subscribers, err := transport.GetSubscribers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, group[1].ID, lastEventID)
+	assert.Len(t, subscribers, 2)
+
+	// Both histories hold the same updates, with the same IDs.
+	ids := []string{u.ID, group[0].ID, group[1].ID}
+	assert.Equal(t, ids, readHistoryIDs(t, from))
+	assert.Equal(t, ids, readHistoryIDs(t, transport))
+
+	r, err := transport.RetractableUpdate(ctx, u.ID)
+	require.NoError(t, err)
+	require.NoError(t, transport.Retract(ctx, r.ID, &Update{Topic: r.Topic, Event: Event{Type: reservedEventType}}))
+	assert.Equal(t, readHistoryIDs(t, from), readHistoryIDs(t, to))
+
+	n, err := transport.DisconnectSubscribers(ctx, &SubscriberSelector{Topics: []string{"*"}}, true)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	require.NoError(t, transport.RemoveSubscriber(ctx, before))
+	require.NoError(t, transport.RemoveSubscriber(ctx, after))
+	assert.Zero(t, from.subscribers.Len())
+	assert.Zero(t, to.subscribers.Len())
+}
+
+func TestDualTransportSecondaryFailure(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	from := NewLocalTransport(NewSubscriberList(0))
+	to := NewLocalTransport(NewSubscriberList(0))
+	transport := NewDualTransport(from, to, slog.Default(), false)
+
+	require.NoError(t, to.Close(ctx))
+
+	// The hub keeps running when the transport being migrated to fails.
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topic: "https://example.com/books/1"}))
+	require.NoError(t, transport.DispatchGroup(ctx, []*Update{{Topic: "https://example.com/books/1"}}))
+
+	transport.Cutover()
+	require.ErrorIs(t, transport.Dispatch(ctx, &Update{Topic: "https://example.com/books/1"}), ErrClosedTransport)
+
+	_, err := transport.RetractableUpdate(ctx, "foo")
+	require.ErrorIs(t, err, ErrRetractionNotSupported)
+	require.ErrorIs(t, transport.ReadHistory(ctx, func(*Update) error { return nil }), ErrDualTransportUnsupported)
+}
+
+func TestDualTransportConcurrentClose(t *testing.T) {
+	t.Parallel()
+
+	testTransportConcurrentClose(t, NewDualTransport(NewLocalTransport(NewSubscriberList(0)), NewLocalTransport(NewSubscriberList(0)), slog.Default(), false))
+}
@@ -0,0 +1,412 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/maypok86/otter/v2"
+)
+
+const (
+	// defaultEnricherTimeout is how long the publication waits for an
+	// enricher when Enricher.Timeout is not set.
+	defaultEnricherTimeout = 100 * time.Millisecond
+	// httpEnricherCacheSize is the number of lookups an HTTPEnricherLookup
+	// keeps in its cache.
+	httpEnricherCacheSize = 10_000
+	// maxHTTPEnricherResponseSize bounds the responses of the lookup
+	// endpoints.
+	maxHTTPEnricherResponseSize = 1 << 20
+)
+
+var (
+	// ErrInvalidEnricher is returned by NewHub when an enricher is not valid.
+	ErrInvalidEnricher = errors.New("invalid enricher")
+	// errEnricherStatus is returned by HTTPEnricherLookup when the endpoint
+	// answers with an unexpected status code.
+	errEnricherStatus = errors.New("unexpected enricher status")
+)
+
+// EnricherLookup computes the fields to add to the published updates, such
+// as the display name of the user whose ID is in the data of the update.
+type EnricherLookup interface {
+	// Lookup returns the fields to add to the data of the update. It is
+	// called concurrently, must not modify the update, and must return when
+	// ctx is done.
+	Lookup(ctx context.Context, u *Update) (map[string]any, error)
+}
+
+// Enricher adds server-computed fields to the published updates whose data is
+// a JSON object, before their dispatch to the subscribers. The enrichers of
+// an update run concurrently, before the routing rules, so the latter see the
+// enriched data.
+//
+// The fields returned by the lookup replace the members of the data having
+// the same name, so publishers can't forge them; they are added in the order
+// of the enrichers, the last one winning. The update is dispatched without
+// the fields of the enrichers not answering in time or failing.
+type Enricher struct {
+	// Name identifies the enricher in the logs.
+	Name string
+	// Matchers restricts the enricher to the updates having a topic one of
+	// these matchers match. The enricher applies to all the updates when
+	// empty.
+	Matchers []TopicMatcher
+	// Lookup computes the fields.
+	Lookup EnricherLookup
+	// Timeout is how long the publication waits for the lookup, 100
+	// milliseconds by default.
+	Timeout time.Duration
+}
+
+// WithEnrichers sets enrichers adding server-computed fields to the published
+// updates.
+func WithEnrichers(enrichers ...Enricher) Option {
+	return func(o *opt) error {
+		o.enrichers = enrichers
+
+		return nil
+	}
+}
+
+// validateEnrichers checks the enrichers once the topic matcher store is
+// configured.
+func (o *opt) validateEnrichers() error {
+	for i := range o.enrichers {
+		e := &o.enrichers[i]
+
+		if e.Lookup == nil {
+			return fmt.Errorf("%w %d: missing lookup", ErrInvalidEnricher, i)
+		}
+
+		if e.Timeout < 0 {
+			return fmt.Errorf("%w %d: negative timeout", ErrInvalidEnricher, i)
+		}
+
+		if e.Timeout == 0 {
+			e.Timeout = defaultEnricherTimeout
+		}
+
+		for _, m := range e.Matchers {
+			if err := validateProtocolMatcher(o.topicMatcherStore, m); err != nil {
+				return fmt.Errorf("%w %d: %q: %w", ErrInvalidEnricher, i, m.Pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func (e *Enricher) matches(tms *TopicMatcherStore, u *Update) bool {
+	if len(e.Matchers) == 0 {
+		return true
+	}
+
+	topics := u.topics()
+	for _, m := range e.Matchers {
+		if tms.matches(topics, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// enrichment is the outcome of the lookup of an enricher.
+type enrichment struct {
+	index  int
+	fields map[string]any
+	err    error
+}
+
+// enrich adds the fields of the matching enrichers to the data of the update.
+// It waits for each lookup at most the timeout of its enricher.
+func (h *Hub) enrich(ctx context.Context, u *Update) {
+	var enrichers []*Enricher
+
+	for i := range h.enrichers {
+		if h.enrichers[i].matches(h.topicMatcherStore, u) {
+			enrichers = append(enrichers, &h.enrichers[i])
+		}
+	}
+
+	if len(enrichers) == 0 {
+		return
+	}
+
+	var data map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(u.Data), &data); err != nil || data == nil {
+		return
+	}
+
+	// The lookups answering late may still read the update once enriched.
+	c := *u
+
+	results := make(chan enrichment, len(enrichers))
+
+	for i, e := range enrichers {
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, e.Timeout)
+			defer cancel()
+
+			// Buffered, so the lookups not honoring the cancellation of
+			// their context don't leak their goroutine once they return.
+			done := make(chan enrichment, 1)
+
+			go func() {
+				fields, err := e.Lookup.Lookup(ctx, &c)
+				done <- enrichment{i, fields, err}
+			}()
+
+			select {
+			case r := <-done:
+				results <- r
+			case <-ctx.Done():
+				results <- enrichment{index: i, err: ctx.Err()}
+			}
+		}()
+	}
+
+	fields := make([]map[string]any, len(enrichers))
+
+	for range enrichers {
+		r := <-results
+		if r.err != nil {
+			if h.logger.Enabled(ctx, slog.LevelWarn) {
+				h.logger.LogAttrs(ctx, slog.LevelWarn, "Enricher failed, update dispatched without its fields", slog.String("enricher", enrichers[r.index].Name), slog.String("topic", u.Topic), slog.Any("error", r.err))
+			}
+
+			continue
+		}
+
+		fields[r.index] = r.fields
+	}
+
+	enriched := false
+
+	for i, f := range fields {
+		for k, v := range f {
+			b, err := json.Marshal(v)
+			if err != nil {
+				if h.logger.Enabled(ctx, slog.LevelWarn) {
+					h.logger.LogAttrs(ctx, slog.LevelWarn, "Enricher returned a field that can't be encoded", slog.String("enricher", enrichers[i].Name), slog.String("field", k), slog.Any("error", err))
+				}
+
+				continue
+			}
+
+			data[k] = b
+			enriched = true
+		}
+	}
+
+	if !enriched {
+		return
+	}
+
+	b, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+
+	u.Data = string(b)
+}
+
+// enrichGroup enriches the updates of a group concurrently.
+func (h *Hub) enrichGroup(ctx context.Context, updates []*Update) {
+	if len(h.enrichers) == 0 {
+		return
+	}
+
+	var wg sync.WaitGroup
+
+	for _, u := range updates {
+		wg.Go(func() {
+			h.enrich(ctx, u)
+		})
+	}
+
+	wg.Wait()
+}
+
+// HTTPEnricherLookup looks up the fields to add to the updates with an HTTP
+// endpoint answering with a JSON object.
+//
+// With a key, a JSONPath such as $.author_id selecting a string or a number in
+// the data of the update, the lookup is a GET request to the URL with the
+// selected value as the "key" query parameter, and its result can be cached.
+// Updates without key get no field. A 404 Not Found response means that
+// there is no field to add.
+//
+// Without key, the lookup POSTs the update to the URL as a JSON document,
+// like HTTPPublishHookTarget does, and its result is not cached.
+type HTTPEnricherLookup struct {
+	url    *url.URL
+	key    *jsonPredicate
+	header http.Header
+	client *http.Client
+	cache  *otter.Cache[string, map[string]any]
+}
+
+// NewHTTPEnricherLookup creates an EnricherLookup calling the endpoint at
+// rawURL, with the given additional headers (typically an Authorization
+// header). When cacheTTL is positive, the results of the lookups by key are
+// cached for this duration, and the lookups answering after the timeout of
+// the enricher keep running in the background to fill the cache. A nil client
+// uses a client with a 10 seconds timeout.
+func NewHTTPEnricherLookup(rawURL, key string, header http.Header, client *http.Client, cacheTTL time.Duration) (*HTTPEnricherLookup, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidEnricher, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: %q is not an absolute HTTP URL", ErrInvalidEnricher, rawURL)
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: defaultPublishHookTimeout}
+	}
+
+	l := &HTTPEnricherLookup{url: u, header: header, client: client}
+
+	if key != "" {
+		if l.key, err = parseJSONPredicate(key); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEnricher, err)
+		}
+
+		if l.key.op != "" {
+			return nil, fmt.Errorf("%w: the key %q must not compare values", ErrInvalidEnricher, key)
+		}
+	}
+
+	if l.key != nil && cacheTTL > 0 {
+		if l.cache, err = otter.New(&otter.Options[string, map[string]any]{
+			MaximumSize:      httpEnricherCacheSize,
+			ExpiryCalculator: otter.ExpiryWriting[string, map[string]any](cacheTTL),
+		}); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidEnricher, err)
+		}
+	}
+
+	return l, nil
+}
+
+// Lookup calls the endpoint, or returns the cached result of the lookup.
+func (l *HTTPEnricherLookup) Lookup(ctx context.Context, u *Update) (map[string]any, error) {
+	if l.key == nil {
+		body, err := marshalPublishHookUpdate(u)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := newPublishHookRequest(ctx, l.url.String(), "application/json", l.header, body)
+		if err != nil {
+			return nil, err
+		}
+
+		return l.do(req)
+	}
+
+	key, ok := l.lookupKey(u)
+	if !ok {
+		return nil, nil
+	}
+
+	if l.cache == nil {
+		return l.get(ctx, key)
+	}
+
+	type result struct {
+		fields map[string]any
+		err    error
+	}
+
+	done := make(chan result, 1)
+
+	// The lookup isn't canceled with the enrichment: its result is cached
+	// for the next updates.
+	go func() {
+		fields, err := l.cache.Get(context.WithoutCancel(ctx), key, otter.LoaderFunc[string, map[string]any](l.get))
+		done <- result{fields, err}
+	}()
+
+	select {
+	case r := <-done:
+		return r.fields, r.err //nolint:wrapcheck
+	case <-ctx.Done():
+		return nil, ctx.Err() //nolint:wrapcheck
+	}
+}
+
+// lookupKey returns the value the key selects in the data of the update.
+func (l *HTTPEnricherLookup) lookupKey(u *Update) (string, bool) {
+	var doc any
+	if err := json.Unmarshal([]byte(u.Data), &doc); err != nil {
+		return "", false
+	}
+
+	for _, v := range l.key.selectValues(doc) {
+		switch v := v.(type) {
+		case string:
+			return v, true
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), true
+		}
+	}
+
+	return "", false
+}
+
+func (l *HTTPEnricherLookup) get(ctx context.Context, key string) (map[string]any, error) {
+	u := *l.url
+	q := u.Query()
+	q.Set("key", key)
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create enricher request: %w", err)
+	}
+
+	for k, v := range l.header {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+
+	return l.do(req)
+}
+
+func (l *HTTPEnricherLookup) do(req *http.Request) (map[string]any, error) {
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to call enricher: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return map[string]any{}, nil
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return nil, fmt.Errorf("%w: %d", errEnricherStatus, resp.StatusCode)
+	}
+
+	var fields map[string]any
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxHTTPEnricherResponseSize)).Decode(&fields); err != nil {
+		return nil, fmt.Errorf("unable to decode enricher response: %w", err)
+	}
+
+	return fields, nil
+}
+
+var _ EnricherLookup = (*HTTPEnricherLookup)(nil)
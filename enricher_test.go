@@ -0,0 +1,226 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type enricherLookupFunc func(ctx context.Context, u *Update) (map[string]any, error)
+
+func (f enricherLookupFunc) Lookup(ctx context.Context, u *Update) (map[string]any, error) {
+	return f(ctx, u)
+}
+
+func TestEnrichersInvalid(t *testing.T) {
+	t.Parallel()
+
+	lookup := enricherLookupFunc(func(context.Context, *Update) (map[string]any, error) { return nil, nil })
+
+	for _, e := range []Enricher{
+		{},
+		{Lookup: lookup, Timeout: -time.Second},
+		{Lookup: lookup, Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/{"}}},
+	} {
+		_, err := NewHub(t.Context(), WithEnrichers(e))
+		require.ErrorIs(t, err, ErrInvalidEnricher, "%+v", e)
+	}
+}
+
+func TestEnrichers(t *testing.T) {
+	t.Parallel()
+
+	hooks := make(chanPublishHookTarget, 10)
+	blocked := make(chan struct{})
+	t.Cleanup(func() { close(blocked) })
+
+	hub := createDummy(t,
+		WithPublishHooks(PublishHook{Target: hooks}),
+		WithEnrichers(
+			Enricher{
+				Name:     "author",
+				Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/comments/:id"}},
+				Lookup: enricherLookupFunc(func(_ context.Context, u *Update) (map[string]any, error) {
+					var doc struct {
+						AuthorID int `json:"author_id"`
+					}
+					if err := json.Unmarshal([]byte(u.Data), &doc); err != nil {
+						return nil, err
+					}
+
+					return map[string]any{"author_name": map[int]string{1: "Kévin"}[doc.AuthorID]}, nil
+				}),
+			},
+			Enricher{
+				Name: "failing",
+				Lookup: enricherLookupFunc(func(context.Context, *Update) (map[string]any, error) {
+					return nil, errors.New("unavailable")
+				}),
+			},
+			Enricher{
+				Name:    "slow",
+				Timeout: 10 * time.Millisecond,
+				// Doesn't honor the cancellation of its context.
+				Lookup: enricherLookupFunc(func(context.Context, *Update) (map[string]any, error) {
+					<-blocked
+
+					return map[string]any{"slow": true}, nil
+				}),
+			},
+		),
+	)
+
+	// The fields of the enrichers replace the ones of the publisher.
+	start := time.Now()
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/comments/1", Event: Event{Data: `{"author_id":1,"author_name":"forged"}`}}))
+	assert.Less(t, time.Since(start), time.Second)
+	assert.JSONEq(t, `{"author_id":1,"author_name":"Kévin"}`, (<-hooks).Data)
+
+	// Not a JSON object: the update is dispatched as is.
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/comments/2", Event: Event{Data: "[1]"}}))
+	assert.Equal(t, "[1]", (<-hooks).Data)
+
+	// Not matching the topic selector of the author enricher.
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/posts/1", Event: Event{Data: `{"author_id":1}`}}))
+	assert.JSONEq(t, `{"author_id":1}`, (<-hooks).Data)
+
+	require.NoError(t, hub.PublishGroup(t.Context(), []*Update{
+		{Topic: "https://example.com/comments/3", Event: Event{Data: `{"author_id":1}`}},
+		{Topic: "https://example.com/comments/4", Event: Event{Data: `{"author_id":2}`}},
+	}))
+	assert.JSONEq(t, `{"author_id":1,"author_name":"Kévin"}`, (<-hooks).Data)
+	assert.JSONEq(t, `{"author_id":2,"author_name":""}`, (<-hooks).Data)
+}
+
+func TestEnrichersRouting(t *testing.T) {
+	t.Parallel()
+
+	hooks := make(chanPublishHookTarget, 10)
+	hub := createDummy(t,
+		WithPublishHooks(PublishHook{Target: hooks}),
+		WithEnrichers(Enricher{
+			Lookup: enricherLookupFunc(func(context.Context, *Update) (map[string]any, error) {
+				return map[string]any{"vip": true}, nil
+			}),
+		}),
+		WithRoutingRules(RoutingRule{Predicate: "$.vip", Action: RoutingAddTopic, Topic: "https://example.com/vip"}),
+	)
+
+	// The routing rules see the enriched data.
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/orders/1", Event: Event{Data: `{}`}}))
+	assert.JSONEq(t, `{"vip":true}`, (<-hooks).Data)
+	assert.Equal(t, "https://example.com/vip", (<-hooks).Topic)
+}
+
+func TestHTTPEnricherLookup(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		assert.Equal(t, http.MethodGet, r.Method)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		switch r.URL.Query().Get("key") {
+		case "1":
+			_, _ = w.Write([]byte(`{"author_name":"Kévin"}`))
+		case "2":
+			// Slower than the timeout of the enricher.
+			time.Sleep(50 * time.Millisecond)
+
+			_, _ = w.Write([]byte(`{"author_name":"Alice"}`))
+		case "3":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	l, err := NewHTTPEnricherLookup(ts.URL+"/users", "$.author_id", http.Header{"Authorization": {"Bearer secret"}}, nil, time.Minute)
+	require.NoError(t, err)
+
+	lookup := func(data string, timeout time.Duration) (map[string]any, error) {
+		ctx, cancel := context.WithTimeout(t.Context(), timeout)
+		defer cancel()
+
+		return l.Lookup(ctx, &Update{Event: Event{Data: data}})
+	}
+
+	fields, err := lookup(`{"author_id":1}`, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"author_name": "Kévin"}, fields)
+
+	// Cached.
+	fields, err = lookup(`{"author_id":"1"}`, time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"author_name": "Kévin"}, fields)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// The slow lookup completes in the background and fills the cache.
+	_, err = lookup(`{"author_id":2}`, time.Millisecond)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		fields, err := lookup(`{"author_id":2}`, time.Millisecond)
+		assert.NoError(c, err)
+		assert.Equal(c, map[string]any{"author_name": "Alice"}, fields)
+	}, time.Second, 10*time.Millisecond)
+
+	_, err = lookup(`{"author_id":3}`, time.Second)
+	require.ErrorIs(t, err, errEnricherStatus)
+
+	fields, err = lookup(`{"author_id":4}`, time.Second)
+	require.NoError(t, err)
+	assert.Empty(t, fields)
+
+	// No key: no lookup.
+	n := calls.Load()
+	fields, err = lookup(`{"author_id":null}`, time.Second)
+	require.NoError(t, err)
+	assert.Nil(t, fields)
+	assert.Equal(t, n, calls.Load())
+}
+
+func TestHTTPEnricherLookupPost(t *testing.T) {
+	t.Parallel()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+
+		var u publishHookJSON
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&u))
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"length": len(u.Data)})
+	}))
+	t.Cleanup(ts.Close)
+
+	l, err := NewHTTPEnricherLookup(ts.URL, "", nil, nil, time.Minute)
+	require.NoError(t, err)
+
+	fields, err := l.Lookup(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{Data: `{"a":1}`}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"length": float64(7)}, fields)
+}
+
+func TestNewHTTPEnricherLookupInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range [][2]string{
+		{"/relative", ""},
+		{"ftp://example.com", ""},
+		{"https://example.com", "author_id"},
+		{"https://example.com", "$.author_id == 1"},
+	} {
+		_, err := NewHTTPEnricherLookup(c[0], c[1], nil, nil, 0)
+		require.ErrorIs(t, err, ErrInvalidEnricher, c)
+	}
+}
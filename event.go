@@ -22,6 +22,11 @@ type Event struct {
 
 	// The reconnection time
 	Retry uint64
+
+	// The number of the update on its topic, will be attached to the
+	// "sequence" field, zero when the updates are not numbered (see
+	// WithTopicSequences)
+	Sequence uint64 `json:",omitempty"`
 }
 
 // String serializes the event in a "text/event-stream" representation.
@@ -36,6 +41,10 @@ func (e *Event) String() string {
 		_, _ = fmt.Fprintf(&b, "retry: %d\n", e.Retry)
 	}
 
+	if e.Sequence != 0 {
+		_, _ = fmt.Fprintf(&b, "sequence: %d\n", e.Sequence)
+	}
+
 	_, _ = fmt.Fprintf(&b, "id: %s\ndata: %s\n\n", e.ID, dataReplacer.Replace(e.Data))
 
 	return b.String()
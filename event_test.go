@@ -1,6 +1,7 @@
 package mercure
 
 import (
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -9,7 +10,7 @@ import (
 func TestEncodeFull(t *testing.T) {
 	t.Parallel()
 
-	e := &Event{"several\nlines\rwith\r\neol", "custom-id", "type", 5}
+	e := &Event{"several\nlines\rwith\r\neol", "custom-id", "type", 5, 0}
 
 	assert.Equal(t, "event: type\nretry: 5\nid: custom-id\ndata: several\ndata: lines\ndata: with\ndata: eol\n\n", e.String())
 }
@@ -17,7 +18,7 @@ func TestEncodeFull(t *testing.T) {
 func TestEncodeNoType(t *testing.T) {
 	t.Parallel()
 
-	e := &Event{"data", "custom-id", "", 5}
+	e := &Event{"data", "custom-id", "", 5, 0}
 
 	assert.Equal(t, "retry: 5\nid: custom-id\ndata: data\n\n", e.String())
 }
@@ -25,7 +26,63 @@ func TestEncodeNoType(t *testing.T) {
 func TestEncodeNoRetry(t *testing.T) {
 	t.Parallel()
 
-	e := &Event{"data", "custom-id", "", 0}
+	e := &Event{"data", "custom-id", "", 0, 0}
 
 	assert.Equal(t, "id: custom-id\ndata: data\n\n", e.String())
 }
+
+func TestEncodeSequence(t *testing.T) {
+	t.Parallel()
+
+	e := &Event{"data", "custom-id", "type", 0, 42}
+
+	assert.Equal(t, "event: type\nsequence: 42\nid: custom-id\ndata: data\n\n", e.String())
+}
+
+func FuzzEventString(f *testing.F) {
+	f.Add("several\nlines\rwith\r\neol", "custom-id", "type", uint64(5))
+	f.Add("", "id", "", uint64(0))
+	f.Add("data: injected\n\nid: other", "id", "", uint64(0))
+
+	f.Fuzz(func(t *testing.T, data, id, typ string, retry uint64) {
+		// Update.Validate rejects IDs and types spanning several lines.
+		if strings.ContainsAny(id+typ, "\r\n") {
+			t.Skip()
+		}
+
+		s := (&Event{data, id, typ, retry, 0}).String()
+		if !strings.HasSuffix(s, "\n\n") {
+			t.Fatalf("unterminated event %q", s)
+		}
+
+		// Parse the event as an EventSource client would.
+		var dataLines []string
+
+		fields := make(map[string]string)
+
+		for _, line := range strings.Split(strings.TrimSuffix(s, "\n\n"), "\n") {
+			if line == "" {
+				t.Fatalf("event %q dispatched early", s)
+			}
+
+			name, value, _ := strings.Cut(line, ":")
+			value = strings.TrimPrefix(value, " ")
+
+			if name == "data" {
+				dataLines = append(dataLines, value)
+
+				continue
+			}
+
+			fields[name] = value
+		}
+
+		if got := strings.Join(dataLines, "\n"); got != strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data) {
+			t.Fatalf("data %q parsed as %q", data, got)
+		}
+
+		if fields["id"] != id || fields["event"] != typ {
+			t.Fatalf("id %q and type %q parsed as %q and %q", id, typ, fields["id"], fields["event"])
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package mercure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidLastEventID is returned when a Last-Event-ID is malformed.
+var ErrInvalidLastEventID = errors.New("invalid Last-Event-ID")
+
+// EventIDCodec understands the IDs of a Last-Event-ID scheme, for transports
+// whose cursors are composite, such as a partition and an offset, rather than
+// opaque strings the hub can only compare for equality.
+type EventIDCodec interface {
+	// Parse checks an ID received from a client. ok is false when the ID
+	// isn't of the scheme: it is then handled as an opaque string. Otherwise,
+	// the canonical form of the ID is returned, or an error if it is
+	// malformed.
+	Parse(id string) (canonical string, ok bool, err error)
+	// Compare returns a negative number when the position a is before b, 0
+	// when they are the same, and a positive number when a is after b, a and
+	// b being canonical IDs of the scheme. ok is false when they can't be
+	// ordered, for instance when a is ahead of b on a partition and behind
+	// on another.
+	Compare(a, b string) (c int, ok bool)
+	// Advance returns the ID to resume from after u, an update received by a
+	// client resuming from the ID cursor. It can differ from the ID of u, for
+	// instance when u has a custom ID.
+	Advance(cursor string, u *Update) string
+}
+
+// TransportEventIDCodec may be implemented by transports whose Last-Event-ID
+// scheme isn't opaque. The hub then rejects the malformed IDs sent by the
+// clients with a 400 Bad Request response, canonicalizes the others before
+// passing them to the transport, and orders the positions with the codec.
+type TransportEventIDCodec interface {
+	// EventIDCodec returns the codec of the IDs of the transport, or nil if
+	// the IDs are opaque.
+	EventIDCodec() EventIDCodec
+}
+
+func (h *Hub) eventIDCodec() EventIDCodec { //nolint:ireturn
+	return transportEventIDCodec(h.transport)
+}
+
+func transportEventIDCodec(t Transport) EventIDCodec { //nolint:ireturn
+	if tc, ok := t.(TransportEventIDCodec); ok {
+		return tc.EventIDCodec()
+	}
+
+	return nil
+}
+
+// parseLastEventID canonicalizes a Last-Event-ID received from a client.
+func (h *Hub) parseLastEventID(id string) (string, error) {
+	if id == "" || id == EarliestLastEventID {
+		return id, nil
+	}
+
+	c := h.eventIDCodec()
+	if c == nil {
+		return id, nil
+	}
+
+	canonical, ok, err := c.Parse(id)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrInvalidLastEventID, err)
+	}
+
+	if !ok {
+		return id, nil
+	}
+
+	return canonical, nil
+}
+
+// compareEventIDs orders the positions of two IDs, see EventIDCodec.Compare.
+// Without codec, only equal IDs can be compared.
+func compareEventIDs(c EventIDCodec, a, b string) (int, bool) {
+	if a == b {
+		return 0, true
+	}
+
+	if c == nil {
+		return 0, false
+	}
+
+	if _, ok, err := c.Parse(a); !ok || err != nil {
+		return 0, false
+	}
+
+	if _, ok, err := c.Parse(b); !ok || err != nil {
+		return 0, false
+	}
+
+	return c.Compare(a, b)
+}
+
+// advanceEventID returns the ID to resume from after u, see
+// EventIDCodec.Advance. Without codec, it is the ID of u.
+func (h *Hub) advanceEventID(cursor string, u *Update) string {
+	if c := h.eventIDCodec(); c != nil {
+		return c.Advance(cursor, u)
+	}
+
+	return u.ID
+}
@@ -0,0 +1,121 @@
+package mercure
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// positionEventIDCodec handles the IDs "pos:<n>", ordered by n.
+type positionEventIDCodec struct{}
+
+func (positionEventIDCodec) Parse(id string) (string, bool, error) {
+	n, ok := strings.CutPrefix(id, "pos:")
+	if !ok {
+		return "", false, nil
+	}
+
+	p, err := strconv.Atoi(n)
+	if err != nil {
+		return "", true, errors.New("not a position")
+	}
+
+	return "pos:" + strconv.Itoa(p), true, nil
+}
+
+func (positionEventIDCodec) Compare(a, b string) (int, bool) {
+	x, _ := strconv.Atoi(strings.TrimPrefix(a, "pos:"))
+	y, _ := strconv.Atoi(strings.TrimPrefix(b, "pos:"))
+
+	return x - y, true
+}
+
+func (c positionEventIDCodec) Advance(cursor string, u *Update) string {
+	if _, ok, _ := c.Parse(u.ID); ok {
+		return u.ID
+	}
+
+	if _, ok, _ := c.Parse(cursor); ok {
+		return cursor
+	}
+
+	return u.ID
+}
+
+type positionTransport struct {
+	*BoltTransport
+}
+
+func (positionTransport) EventIDCodec() EventIDCodec { //nolint:ireturn
+	return positionEventIDCodec{}
+}
+
+func TestEventIDCodecInvalidLastEventID(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithTransport(positionTransport{createBoltTransport(t, 0, 0)}))
+
+	for _, target := range []string{defaultHubURL + "?topic=https://example.com/books/1", historyURL + "?match=*"} {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("Last-Event-ID", "pos:x")
+
+		w := httptest.NewRecorder()
+		hub.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code, target)
+		assert.Contains(t, w.Body.String(), `Invalid "Last-Event-ID"`)
+	}
+}
+
+func TestEventIDCodecHistory(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithTransport(positionTransport{createBoltTransport(t, 0, 0)}))
+
+	for _, id := range []string{"pos:1", "custom", "pos:2", "other"} {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: id}}))
+	}
+
+	// The ID is canonicalized, and the page ends at the last position.
+	req := httptest.NewRequest(http.MethodGet, historyURL+"?match=*&last_event_id=pos:01", nil)
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var page struct {
+		Updates []struct {
+			ID string `json:"id"`
+		} `json:"updates"`
+		LastEventID string `json:"last_event_id"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+
+	require.Len(t, page.Updates, 3)
+	assert.Equal(t, "custom", page.Updates[0].ID)
+	assert.Equal(t, "pos:2", page.LastEventID)
+}
+
+func TestCompareEventIDs(t *testing.T) {
+	t.Parallel()
+
+	c, ok := compareEventIDs(nil, "a", "a")
+	assert.True(t, ok)
+	assert.Zero(t, c)
+
+	_, ok = compareEventIDs(nil, "pos:1", "pos:2")
+	assert.False(t, ok)
+
+	_, ok = compareEventIDs(positionEventIDCodec{}, "pos:1", "custom")
+	assert.False(t, ok)
+
+	c, ok = compareEventIDs(positionEventIDCodec{}, "pos:3", "pos:2")
+	assert.True(t, ok)
+	assert.Positive(t, c)
+}
@@ -33,3 +33,33 @@ func Example() {
 	http.Handle("/.well-known/mercure", h)
 	log.Panic(http.ListenAndServe(":8080", nil))
 }
+
+// Applications embedding the hub can publish updates directly, without looping
+// back through their own HTTP listener. The update is validated and dispatched
+// through the configured transport, as with the publish endpoint.
+func ExampleHub_PublishUpdate() {
+	ctx := context.Background()
+
+	h, err := mercure.NewHub(ctx, mercure.WithAnonymous())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	defer func() {
+		if err := h.Stop(ctx); err != nil {
+			panic(err)
+		}
+	}()
+
+	u := &mercure.Update{
+		Topic: "https://example.com/books/1",
+		Event: mercure.Event{Data: `{"title": "The Go Programming Language"}`},
+	}
+
+	if err := h.PublishUpdate(ctx, u); err != nil {
+		log.Fatal(err)
+	}
+
+	// The transport assigned an ID to the update.
+	log.Print(u.ID)
+}
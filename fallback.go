@@ -0,0 +1,405 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	// ErrLocalFallback is wrapped, with ErrPartialDispatch, by the errors of
+	// the dispatches that FallbackTransport only delivered to the local
+	// subscribers. The publish endpoints answer with a 202 Accepted status
+	// code and the Mercure-Degraded header.
+	ErrLocalFallback = errors.New("update only dispatched to the local subscribers")
+	// ErrFallbackTransportUnsupported is returned by FallbackTransport when
+	// the transport doesn't support the requested operation.
+	ErrFallbackTransportUnsupported = errors.New("the transport does not support this operation")
+)
+
+// degradedHeader is the response header telling the publishers that their
+// updates have only been dispatched to the local subscribers.
+const degradedHeader = "Mercure-Degraded"
+
+// FallbackMetrics may be implemented by the Metrics collecting the dispatches
+// of FallbackTransport to the local subscribers only.
+type FallbackMetrics interface {
+	// TransportDegraded collects whether the updates are dispatched to the
+	// local subscribers only.
+	TransportDegraded(degraded bool)
+	// UpdateDispatchedLocally collects metrics about an update the transport
+	// failed to dispatch, delivered to the local subscribers only.
+	UpdateDispatchedLocally(u *Update)
+}
+
+// FallbackTransport fails open when the transport it wraps, typically a
+// remote broker, is unreachable: the updates it fails to dispatch are
+// delivered to the subscribers connected to this hub instead of failing the
+// publication, so the realtime delivery to them survives broker outages.
+//
+// The updates dispatched to the local subscribers only are neither stored in
+// the history nor received by the subscribers of the other hubs, and may be
+// delivered twice if the transport failed after dispatching them. The
+// transport is degraded until it dispatches an update again. The other
+// operations, adding subscribers and reading the history included, are
+// forwarded to the transport, and fail while it is unreachable.
+type FallbackTransport struct {
+	transport   Transport
+	subscribers *SubscriberList
+	logger      *slog.Logger
+	degraded    atomic.Bool
+	metrics     FallbackMetrics
+}
+
+// NewFallbackTransport creates a FallbackTransport wrapping transport.
+func NewFallbackTransport(transport Transport, logger *slog.Logger) *FallbackTransport {
+	return &FallbackTransport{transport: transport, subscribers: NewSubscriberList(0), logger: logger}
+}
+
+// IsDegraded reports whether the updates are dispatched to the local
+// subscribers only.
+func (t *FallbackTransport) IsDegraded() bool {
+	return t.degraded.Load()
+}
+
+// Dispatch dispatches the update, to the local subscribers only if the
+// transport fails.
+func (t *FallbackTransport) Dispatch(ctx context.Context, u *Update) error {
+	// The local subscribers must receive the ID the transport would store.
+	u.AssignUUID()
+
+	return t.fallback(ctx, []*Update{u}, t.transport.Dispatch(ctx, u))
+}
+
+// DispatchGroup dispatches the group of updates, to the local subscribers only
+// if the transport fails. The transport must implement
+// TransportGroupDispatcher.
+func (t *FallbackTransport) DispatchGroup(ctx context.Context, updates []*Update) error {
+	gd, ok := t.transport.(TransportGroupDispatcher)
+	if !ok {
+		return ErrGroupNotSupported
+	}
+
+	for _, u := range updates {
+		u.AssignUUID()
+	}
+
+	return t.fallback(ctx, updates, gd.DispatchGroup(ctx, updates))
+}
+
+// fallback dispatches the updates to the local subscribers when the transport
+// failed to.
+func (t *FallbackTransport) fallback(ctx context.Context, updates []*Update, err error) error {
+	if err == nil || errors.Is(err, ErrPartialDispatch) {
+		t.setDegraded(ctx, false, nil)
+
+		return err
+	}
+
+	if errors.Is(err, ErrClosedTransport) {
+		return err
+	}
+
+	t.setDegraded(ctx, true, err)
+
+	for _, u := range updates {
+		for _, s := range t.subscribers.MatchAny(u) {
+			s.Dispatch(ctx, u, false)
+		}
+
+		if t.metrics != nil {
+			t.metrics.UpdateDispatchedLocally(u)
+		}
+	}
+
+	return fmt.Errorf("%w: %w: %w", ErrPartialDispatch, ErrLocalFallback, err)
+}
+
+// setDegraded logs and reports the changes of mode.
+func (t *FallbackTransport) setDegraded(ctx context.Context, degraded bool, err error) {
+	if t.degraded.Swap(degraded) == degraded {
+		return
+	}
+
+	if t.metrics != nil {
+		t.metrics.TransportDegraded(degraded)
+	}
+
+	if degraded {
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Transport unreachable, dispatching the updates to the local subscribers only", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	if t.logger.Enabled(ctx, slog.LevelInfo) {
+		t.logger.LogAttrs(ctx, slog.LevelInfo, "Transport reachable again, leaving the degraded mode")
+	}
+}
+
+// AddSubscriber adds the subscriber to the transport, and to the local
+// subscribers.
+func (t *FallbackTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	if err := t.transport.AddSubscriber(ctx, s); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	t.subscribers.Add(s)
+
+	return nil
+}
+
+// RemoveSubscriber removes the subscriber.
+func (t *FallbackTransport) RemoveSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	t.subscribers.Remove(s)
+
+	return t.transport.RemoveSubscriber(ctx, s) //nolint:wrapcheck
+}
+
+// GetSubscribers gets the subscribers of the transport.
+func (t *FallbackTransport) GetSubscribers(ctx context.Context) (string, []*Subscriber, error) {
+	ts, ok := t.transport.(TransportSubscribers)
+	if !ok {
+		return "", nil, ErrFallbackTransportUnsupported
+	}
+
+	return ts.GetSubscribers(ctx) //nolint:wrapcheck
+}
+
+// DisconnectSubscribers disconnects the matching subscribers of the transport.
+func (t *FallbackTransport) DisconnectSubscribers(ctx context.Context, sel *SubscriberSelector, dryRun bool) (int, error) {
+	d, ok := t.transport.(TransportDisconnecter)
+	if !ok {
+		return 0, ErrDisconnectNotSupported
+	}
+
+	return d.DisconnectSubscribers(ctx, sel, dryRun) //nolint:wrapcheck
+}
+
+// PurgeHistory purges the history of the transport. The local fallback
+// stores no update.
+func (t *FallbackTransport) PurgeHistory(ctx context.Context, sel *HistoryPurgeSelector, dryRun bool) (int, error) {
+	p, ok := t.transport.(TransportHistoryPurger)
+	if !ok {
+		return 0, ErrHistoryPurgeNotSupported
+	}
+
+	return p.PurgeHistory(ctx, sel, dryRun) //nolint:wrapcheck
+}
+
+// Redeliver dispatches the update to the matching subscribers of the
+// transport.
+func (t *FallbackTransport) Redeliver(ctx context.Context, sel *SubscriberSelector, u *Update) (int, error) {
+	r, ok := t.transport.(TransportRedeliverer)
+	if !ok {
+		return 0, ErrRedeliveryNotSupported
+	}
+
+	return r.Redeliver(ctx, sel, u) //nolint:wrapcheck
+}
+
+// RetractableUpdate returns the update with the given ID from the history of
+// the transport.
+func (t *FallbackTransport) RetractableUpdate(ctx context.Context, id string) (*Update, error) {
+	r, ok := t.transport.(TransportRetracter)
+	if !ok {
+		return nil, ErrRetractionNotSupported
+	}
+
+	return r.RetractableUpdate(ctx, id) //nolint:wrapcheck
+}
+
+// Retract retracts the update in the transport.
+func (t *FallbackTransport) Retract(ctx context.Context, id string, retraction *Update) error {
+	r, ok := t.transport.(TransportRetracter)
+	if !ok {
+		return ErrRetractionNotSupported
+	}
+
+	return r.Retract(ctx, id, retraction) //nolint:wrapcheck
+}
+
+// RememberIdempotencyKey records the idempotency key in the index of the
+// transport.
+func (t *FallbackTransport) RememberIdempotencyKey(ctx context.Context, key, id string, ttl time.Duration) (string, bool, error) {
+	i, ok := t.transport.(TransportIdempotencyIndex)
+	if !ok {
+		return "", false, ErrIdempotencyNotSupported
+	}
+
+	return i.RememberIdempotencyKey(ctx, key, id, ttl) //nolint:wrapcheck
+}
+
+// ForgetIdempotencyKey removes the idempotency key from the index of the
+// transport.
+func (t *FallbackTransport) ForgetIdempotencyKey(ctx context.Context, key string) error {
+	i, ok := t.transport.(TransportIdempotencyIndex)
+	if !ok {
+		return ErrIdempotencyNotSupported
+	}
+
+	return i.ForgetIdempotencyKey(ctx, key) //nolint:wrapcheck
+}
+
+// VerifyHistoryChain verifies the hash chain of the history of the transport.
+func (t *FallbackTransport) VerifyHistoryChain(ctx context.Context) (*HistoryChainReport, error) {
+	v, ok := t.transport.(TransportHistoryChainVerifier)
+	if !ok {
+		return nil, ErrHistoryChainNotSupported
+	}
+
+	return v.VerifyHistoryChain(ctx) //nolint:wrapcheck
+}
+
+// SetRetentionExemptions passes the exemptions to the transport. The local
+// fallback stores no update.
+func (t *FallbackTransport) SetRetentionExemptions(e RetentionExemptions) error {
+	r, ok := t.transport.(TransportRetentionExemptions)
+	if !ok {
+		return ErrRetentionExemptionsNotSupported
+	}
+
+	return r.SetRetentionExemptions(e) //nolint:wrapcheck
+}
+
+// EnableTopicSequences enables the topic sequences of the transport. The
+// updates dispatched by the local fallback are not numbered.
+func (t *FallbackTransport) EnableTopicSequences() error {
+	s, ok := t.transport.(TransportTopicSequencer)
+	if !ok {
+		return ErrTopicSequencesNotSupported
+	}
+
+	return s.EnableTopicSequences() //nolint:wrapcheck
+}
+
+// forgetTopicSequence forgets the number of the topic kept by the
+// transport, if any.
+func (t *FallbackTransport) forgetTopicSequence(topic string) {
+	if f, ok := t.transport.(topicSequenceForgetter); ok {
+		f.forgetTopicSequence(topic)
+	}
+}
+
+// ReadHistory reads the history of the transport.
+func (t *FallbackTransport) ReadHistory(ctx context.Context, fn func(u *Update) error) error {
+	hr, ok := t.transport.(TransportHistoryReader)
+	if !ok {
+		return ErrFallbackTransportUnsupported
+	}
+
+	return hr.ReadHistory(ctx, fn) //nolint:wrapcheck
+}
+
+// FetchSince fetches the updates from the transport.
+func (t *FallbackTransport) FetchSince(ctx context.Context, lastEventID string, topics []string, limit int) ([]*Update, error) {
+	th, ok := t.transport.(TransportHistory)
+	if !ok {
+		return nil, ErrFallbackTransportUnsupported
+	}
+
+	return th.FetchSince(ctx, lastEventID, topics, limit) //nolint:wrapcheck
+}
+
+// HistoryVersion returns the version of the history of the transport, if it
+// can tell it.
+func (t *FallbackTransport) HistoryVersion(ctx context.Context) (string, time.Time, error) {
+	tv, ok := t.transport.(TransportHistoryVersion)
+	if !ok {
+		return "", time.Time{}, nil
+	}
+
+	return tv.HistoryVersion(ctx) //nolint:wrapcheck
+}
+
+// EventIDCodec returns the codec of the IDs of the wrapped transport, if any.
+func (t *FallbackTransport) EventIDCodec() EventIDCodec { //nolint:ireturn
+	return transportEventIDCodec(t.transport)
+}
+
+// Ready reports whether the transport can serve traffic.
+func (t *FallbackTransport) Ready(ctx context.Context) error {
+	if hc, ok := t.transport.(TransportHealthChecker); ok {
+		return hc.Ready(ctx) //nolint:wrapcheck
+	}
+
+	return nil
+}
+
+// Live reports whether the transport is operational.
+func (t *FallbackTransport) Live(ctx context.Context) error {
+	if hc, ok := t.transport.(TransportHealthChecker); ok {
+		return hc.Live(ctx) //nolint:wrapcheck
+	}
+
+	return nil
+}
+
+// SetSubscriberShards shards the subscribers of the transport.
+func (t *FallbackTransport) SetSubscriberShards(n int) {
+	if s, ok := t.transport.(TransportSubscriberSharder); ok {
+		s.SetSubscriberShards(n)
+	}
+}
+
+// SetTopicMatcherStore passes the store to the transport.
+func (t *FallbackTransport) SetTopicMatcherStore(store *TopicMatcherStore) {
+	if s, ok := t.transport.(TransportTopicMatcherStore); ok {
+		s.SetTopicMatcherStore(store)
+	}
+}
+
+// SetMetrics sets the metrics the local dispatches are reported to, and
+// passes them to the transport.
+func (t *FallbackTransport) SetMetrics(m Metrics) {
+	if fm, ok := m.(FallbackMetrics); ok {
+		t.metrics = fm
+	}
+
+	if tm, ok := t.transport.(TransportMetrics); ok {
+		tm.SetMetrics(m)
+	}
+}
+
+// Close closes the transport.
+func (t *FallbackTransport) Close(ctx context.Context) error {
+	t.subscribers.Close()
+
+	return t.transport.Close(ctx) //nolint:wrapcheck
+}
+
+// DispatchesSynchronously reports whether the transport dispatches the
+// updates synchronously, the updates dispatched to the local subscribers only
+// always are.
+func (t *FallbackTransport) DispatchesSynchronously() bool {
+	return dispatchesSynchronously(t.transport)
+}
+
+// Interface guards.
+var (
+	_ Transport                      = (*FallbackTransport)(nil)
+	_ TransportSynchronousDispatcher = (*FallbackTransport)(nil)
+	_ TransportIdempotencyIndex      = (*FallbackTransport)(nil)
+	_ TransportHistoryChainVerifier  = (*FallbackTransport)(nil)
+	_ TransportRetentionExemptions   = (*FallbackTransport)(nil)
+	_ TransportTopicSequencer        = (*FallbackTransport)(nil)
+	_ topicSequenceForgetter         = (*FallbackTransport)(nil)
+	_ TransportHistoryPurger         = (*FallbackTransport)(nil)
+	_ TransportSubscribers           = (*FallbackTransport)(nil)
+	_ TransportGroupDispatcher       = (*FallbackTransport)(nil)
+	_ TransportRetracter             = (*FallbackTransport)(nil)
+	_ TransportHistoryReader         = (*FallbackTransport)(nil)
+	_ TransportHistory               = (*FallbackTransport)(nil)
+	_ TransportHistoryVersion        = (*FallbackTransport)(nil)
+	_ TransportEventIDCodec          = (*FallbackTransport)(nil)
+	_ TransportDisconnecter          = (*FallbackTransport)(nil)
+	_ TransportRedeliverer           = (*FallbackTransport)(nil)
+	_ TransportHealthChecker         = (*FallbackTransport)(nil)
+	_ TransportTopicMatcherStore     = (*FallbackTransport)(nil)
+	_ TransportSubscriberSharder     = (*FallbackTransport)(nil)
+	_ TransportMetrics               = (*FallbackTransport)(nil)
+)
@@ -0,0 +1,133 @@
+package mercure
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fallbackMetrics records the changes of mode and the local dispatches.
+type fallbackMetrics struct {
+	NopMetrics
+
+	mu       sync.Mutex
+	degraded []bool
+	local    int
+}
+
+func (m *fallbackMetrics) TransportDegraded(degraded bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.degraded = append(m.degraded, degraded)
+}
+
+func (m *fallbackMetrics) UpdateDispatchedLocally(_ *Update) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.local++
+}
+
+// createFallbackTransport creates a FallbackTransport wrapping a transport
+// failing the first failures dispatches.
+func createFallbackTransport(t *testing.T, failures int) (*FallbackTransport, *failingTransport) {
+	t.Helper()
+
+	bt, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0)
+	require.NoError(t, err)
+
+	failing := &failingTransport{BoltTransport: bt, failures: failures}
+	transport := NewFallbackTransport(failing, slog.Default())
+
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(t.Context()))
+	})
+
+	return transport, failing
+}
+
+func TestFallbackTransport(t *testing.T) {
+	t.Parallel()
+
+	transport, failing := createFallbackTransport(t, 2)
+
+	m := &fallbackMetrics{}
+	transport.SetMetrics(m)
+
+	s := NewLocalSubscriber("", transport.logger, &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/books/1"}), stringsToExactMatchers(nil))
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	u1 := &Update{Topic: "https://example.com/books/1"}
+	err := transport.Dispatch(t.Context(), u1)
+	require.ErrorIs(t, err, ErrPartialDispatch)
+	require.ErrorIs(t, err, ErrLocalFallback)
+	require.ErrorIs(t, err, errTestStorage)
+	assert.True(t, transport.IsDegraded())
+	assert.Equal(t, u1.ID, (<-s.Receive()).ID)
+
+	g := []*Update{{Topic: "https://example.com/books/1"}, {Topic: "https://example.com/books/2"}}
+	require.ErrorIs(t, transport.DispatchGroup(t.Context(), g), ErrLocalFallback)
+	assert.Equal(t, g[0].ID, (<-s.Receive()).ID)
+
+	u2 := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, transport.Dispatch(t.Context(), u2))
+	assert.False(t, transport.IsDegraded())
+	assert.Equal(t, u2.ID, (<-s.Receive()).ID)
+
+	// The updates dispatched locally are not stored.
+	assert.Equal(t, []string{u2.ID}, readHistoryIDs(t, failing))
+
+	assert.Equal(t, []bool{true, false}, m.degraded)
+	assert.Equal(t, 3, m.local)
+
+	require.NoError(t, transport.RemoveSubscriber(t.Context(), s))
+	assert.Equal(t, 0, transport.subscribers.Len())
+}
+
+func TestFallbackTransportClosed(t *testing.T) {
+	t.Parallel()
+
+	transport, _ := createFallbackTransport(t, 0)
+	require.NoError(t, transport.Close(t.Context()))
+
+	require.ErrorIs(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}), ErrClosedTransport)
+	assert.False(t, transport.IsDegraded())
+}
+
+func TestFallbackTransportPublishHandler(t *testing.T) {
+	t.Parallel()
+
+	transport, _ := createFallbackTransport(t, 1)
+	hub := createDummy(t, WithTransport(transport))
+
+	publish := func() *httptest.ResponseRecorder {
+		form := url.Values{"topic": {"https://example.com/books/1"}, "data": {"Dune"}}
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w
+	}
+
+	w := publish()
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, "local", w.Header().Get(degradedHeader))
+
+	w = publish()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(degradedHeader))
+}
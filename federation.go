@@ -0,0 +1,394 @@
+package mercure
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// federationHandshakeURL is the endpoint the peers send their signed
+	// manifest to, to open a federation session.
+	federationHandshakeURL = defaultHubURL + "/federation/handshake"
+	// federationPublishURL is the endpoint the peers publish their updates
+	// to, within an open federation session.
+	federationPublishURL = defaultHubURL + "/federation/publish"
+	// federationSessionHeader holds the ID of the federation session of a
+	// request of a peer.
+	federationSessionHeader = "Mercure-Federation-Session"
+	// maxFederationManifestTTL bounds the lifetime of a federation session.
+	maxFederationManifestTTL = 24 * time.Hour
+)
+
+// federationManifestAlgorithms are the algorithms a manifest can be signed
+// with, one per type of key of the client certificates.
+var federationManifestAlgorithms = []string{"RS256", "PS256", "ES256", "ES384", "ES512", "EdDSA"} //nolint:gochecknoglobals
+
+var (
+	// ErrInvalidFederation is returned by NewHub when the federation is not
+	// valid.
+	ErrInvalidFederation = errors.New("invalid federation")
+	// errFederationPeerCertificate is returned when a peer doesn't present a
+	// valid client certificate.
+	errFederationPeerCertificate = errors.New("invalid federation peer certificate")
+	// errFederationManifest is returned when the manifest of a peer is not
+	// acceptable.
+	errFederationManifest = errors.New("invalid federation manifest")
+)
+
+// FederationPeer is a hub allowed to publish updates into some topic spaces
+// of this hub.
+type FederationPeer struct {
+	// Name identifies the peer: its client certificate must be valid for
+	// this DNS name, and its manifests issued by it.
+	Name string
+	// Matchers are the topic spaces the peer may publish into. A manifest can
+	// only claim some of them, and the updates of the peer are rejected
+	// unless all their topics are in the spaces of its manifest.
+	Matchers []TopicMatcher
+}
+
+// Federation lets other hubs publish into some topic spaces of the hub.
+//
+// A peer authenticates with a client certificate (mutual TLS), and opens a
+// session by sending a manifest: a JWT signed with the private key of its
+// certificate, issued by its name, whose audience is the resource identifier
+// of the hub when set, and whose match and match_urlpattern claims list the
+// topic spaces the peer will publish into. A compromised peer can then only
+// inject updates into the topic spaces it has been granted.
+//
+// The TLS configuration of the server must request client certificates:
+// the hub verifies them itself.
+type Federation struct {
+	// ClientCAs verifies the client certificates of the peers.
+	ClientCAs *x509.CertPool
+	// Peers are the hubs allowed to publish.
+	Peers []FederationPeer
+}
+
+// federationManifest is the signed manifest of a peer.
+type federationManifest struct {
+	jwt.RegisteredClaims
+
+	Match           []string `json:"match,omitempty"`
+	MatchURLPattern []string `json:"match_urlpattern,omitempty"`
+}
+
+func (m *federationManifest) matchers() []TopicMatcher {
+	matchers := make([]TopicMatcher, 0, len(m.Match)+len(m.MatchURLPattern))
+	for _, p := range m.Match {
+		matchers = append(matchers, TopicMatcher{Type: MatcherTypeExact, Pattern: p})
+	}
+
+	for _, p := range m.MatchURLPattern {
+		matchers = append(matchers, TopicMatcher{Type: MatcherTypeURLPattern, Pattern: p})
+	}
+
+	return matchers
+}
+
+// federationSessionJSON is the response to a successful handshake.
+type federationSessionJSON struct {
+	Session string    `json:"session"`
+	Expires time.Time `json:"expires"`
+}
+
+// federationSession is an open session of a peer.
+type federationSession struct {
+	peer        string
+	fingerprint [sha256.Size]byte
+	matchers    []TopicMatcher
+	expires     time.Time
+}
+
+// federation holds the state of the federation of a hub.
+type federation struct {
+	Federation
+
+	sync.Mutex
+
+	sessions map[string]*federationSession
+}
+
+// WithFederation lets other hubs publish into some topic spaces of the hub.
+func WithFederation(f Federation) Option {
+	return func(o *opt) error {
+		o.federation = &federation{Federation: f, sessions: make(map[string]*federationSession)}
+
+		return nil
+	}
+}
+
+// validateFederation checks the federation once the topic matcher store is
+// configured.
+func (o *opt) validateFederation() error {
+	f := o.federation
+	if f == nil {
+		return nil
+	}
+
+	if f.ClientCAs == nil {
+		return fmt.Errorf("%w: missing client CAs", ErrInvalidFederation)
+	}
+
+	for i, p := range f.Peers {
+		if p.Name == "" {
+			return fmt.Errorf("%w: peer %d: missing name", ErrInvalidFederation, i)
+		}
+
+		for _, m := range p.Matchers {
+			if err := validateProtocolMatcher(o.topicMatcherStore, m); err != nil {
+				return fmt.Errorf("%w: peer %q: %q: %w", ErrInvalidFederation, p.Name, m.Pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// peerCertificate returns the verified client certificate of the request.
+func (f *federation) peerCertificate(r *http.Request) (*x509.Certificate, error) {
+	if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("%w: no client certificate", errFederationPeerCertificate)
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, c := range r.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(c)
+	}
+
+	cert := r.TLS.PeerCertificates[0]
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         f.ClientCAs,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}); err != nil {
+		return nil, fmt.Errorf("%w: %w", errFederationPeerCertificate, err)
+	}
+
+	return cert, nil
+}
+
+// handshake checks the manifest of the peer holding the certificate, and
+// opens its session.
+func (f *federation) handshake(cert *x509.Certificate, encodedManifest, audience string) (string, *federationSession, error) {
+	opts := []jwt.ParserOption{jwt.WithValidMethods(federationManifestAlgorithms), jwt.WithExpirationRequired(), jwt.WithIssuedAt()}
+	if audience != "" {
+		opts = append(opts, jwt.WithAudience(audience))
+	}
+
+	var m federationManifest
+	if _, err := jwt.ParseWithClaims(encodedManifest, &m, func(*jwt.Token) (any, error) { return cert.PublicKey, nil }, opts...); err != nil {
+		return "", nil, fmt.Errorf("%w: %w", errFederationManifest, err)
+	}
+
+	i := slices.IndexFunc(f.Peers, func(p FederationPeer) bool { return p.Name == m.Issuer })
+	if i == -1 {
+		return "", nil, fmt.Errorf("%w: unknown peer %q", errFederationManifest, m.Issuer)
+	}
+
+	peer := f.Peers[i]
+	if err := cert.VerifyHostname(peer.Name); err != nil {
+		return "", nil, fmt.Errorf("%w: %w", errFederationPeerCertificate, err)
+	}
+
+	matchers := m.matchers()
+	for _, mm := range matchers {
+		if !slices.Contains(peer.Matchers, mm) {
+			return "", nil, fmt.Errorf("%w: topic space %q not granted to %q", errFederationManifest, mm.Pattern, peer.Name)
+		}
+	}
+
+	now := time.Now()
+	s := &federationSession{
+		peer:        peer.Name,
+		fingerprint: sha256.Sum256(cert.Raw),
+		matchers:    matchers,
+		expires:     m.ExpiresAt.Time,
+	}
+	if limit := now.Add(maxFederationManifestTTL); s.expires.After(limit) {
+		s.expires = limit
+	}
+
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	id := base64.RawURLEncoding.EncodeToString(b)
+
+	f.Lock()
+	defer f.Unlock()
+
+	for k, v := range f.sessions {
+		if now.After(v.expires) {
+			delete(f.sessions, k)
+		}
+	}
+
+	f.sessions[id] = s
+
+	return id, s, nil
+}
+
+// allows reports whether all the topics of the update are in the topic
+// spaces of the session.
+func (s *federationSession) allows(tms *TopicMatcherStore, u *Update) bool {
+	for _, t := range u.topics() {
+		if !slices.ContainsFunc(s.matchers, func(m TopicMatcher) bool { return tms.matches([]string{t}, m) }) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// session returns the open session of the peer holding the certificate.
+func (f *federation) session(id string, cert *x509.Certificate) (*federationSession, bool) {
+	f.Lock()
+	s, ok := f.sessions[id]
+	f.Unlock()
+
+	if !ok || time.Now().After(s.expires) || s.fingerprint != sha256.Sum256(cert.Raw) {
+		return nil, false
+	}
+
+	return s, true
+}
+
+// FederationHandshakeHandler opens the federation sessions of the peers. The
+// body of the request is the signed manifest of the peer, and the response a
+// JSON document holding the ID of the session and its expiration date.
+func (h *Hub) FederationHandshakeHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "mercure.federation.handshake", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	cert, err := h.federation.peerCertificate(r)
+	if err != nil {
+		h.writeFederationError(w, r, err, http.StatusUnauthorized)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	h.limitRequestBody(w, r)
+
+	manifest, err := io.ReadAll(r.Body)
+	if err != nil {
+		status := http.StatusBadRequest
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, http.StatusText(status), status)
+
+		return
+	}
+
+	id, s, err := h.federation.handshake(cert, string(manifest), h.resourceIdentifier)
+	if err != nil {
+		h.writeFederationError(w, r, err, http.StatusForbidden)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Federation session opened", slog.String("peer", s.peer), slog.Any("topics", logMatcherPatterns(s.matchers)), slog.Time("expires", s.expires))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(federationSessionJSON{Session: id, Expires: s.expires}); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write federation handshake response", slog.Any("error", err))
+	}
+}
+
+// FederationPublishHandler publishes the updates of the peers, sent as the
+// JSON documents of the HTTP publish hooks, within their federation session.
+// The response body is the ID of the update.
+func (h *Hub) FederationPublishHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "mercure.federation.publish", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	cert, err := h.federation.peerCertificate(r)
+	if err != nil {
+		h.writeFederationError(w, r, err, http.StatusUnauthorized)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	// The peers open a new session when theirs is unknown or expired.
+	s, ok := h.federation.session(r.Header.Get(federationSessionHeader), cert)
+	if !ok {
+		http.Error(w, "Invalid federation session", http.StatusUnauthorized)
+
+		return
+	}
+
+	h.limitRequestBody(w, r)
+
+	var p publishHookJSON
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil || p.Topic == "" {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+		return
+	}
+
+	u := &Update{
+		Event:         Event{Data: p.Data, ID: p.ID, Type: p.Type, Retry: p.Retry},
+		Topic:         p.Topic,
+		Private:       p.Private,
+		StateVersion:  p.StateVersion,
+		LocalizedData: p.LocalizedData,
+		CompactionKey: p.CompactionKey,
+		Expires:       p.Expires,
+		Priority:      p.Priority,
+		federatedFrom: s.peer,
+	}
+
+	if !s.allows(h.topicMatcherStore, u) {
+		if h.logger.Enabled(ctx, slog.LevelWarn) {
+			h.logger.LogAttrs(ctx, slog.LevelWarn, "Federation peer published outside its topic spaces", slog.String("peer", s.peer), slog.String("topic", u.Topic))
+		}
+
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+
+		return
+	}
+
+	if err := h.Publish(context.WithoutCancel(ctx), u); err != nil && !errors.Is(err, ErrPartialDispatch) {
+		writePublishError(w, err)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if _, err := io.WriteString(w, u.ID); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write federation publish response", slog.Any("error", err))
+	}
+}
+
+func (h *Hub) writeFederationError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if h.logger.Enabled(r.Context(), slog.LevelInfo) {
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "Federation peer rejected", slog.Any("error", err))
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,267 @@
+package mercure
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testCA issues client certificates.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return &testCA{cert, key}
+}
+
+func (ca *testCA) pool() *x509.CertPool {
+	p := x509.NewCertPool()
+	p.AddCert(ca.cert)
+
+	return p
+}
+
+func (ca *testCA) issue(t *testing.T, name string) tls.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+var testFederationMatchers = []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://peer.example.com/*"}} //nolint:gochecknoglobals
+
+// startFederatedHub starts a TLS server requesting client certificates for
+// a hub federated with the "peer.example.com" peer.
+func startFederatedHub(t *testing.T, ca *testCA, options ...Option) (*Hub, *httptest.Server) {
+	t.Helper()
+
+	hub := createDummy(t, append(options, WithFederation(Federation{
+		ClientCAs: ca.pool(),
+		Peers:     []FederationPeer{{Name: "peer.example.com", Matchers: testFederationMatchers}},
+	}))...)
+
+	srv := httptest.NewUnstartedServer(hub)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequestClientCert, MinVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	return hub, srv
+}
+
+func newTestFederationTarget(t *testing.T, srv *httptest.Server, cert tls.Certificate, name string, matchers []TopicMatcher, options ...func(*FederationPublishHookConfig)) *FederationPublishHookTarget {
+	t.Helper()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(srv.Certificate())
+
+	c := FederationPublishHookConfig{
+		Name:        name,
+		Audience:    testResourceIdentifier,
+		Certificate: cert,
+		RootCAs:     roots,
+		Matchers:    matchers,
+	}
+	for _, o := range options {
+		o(&c)
+	}
+
+	target, err := NewFederationPublishHookTarget(srv.URL+defaultHubURL, c)
+	require.NoError(t, err)
+
+	return target
+}
+
+func TestFederation(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	hub, srv := startFederatedHub(t, ca)
+
+	updates, err := hub.Subscribe(t.Context(), testFederationMatchers, testFederationMatchers)
+	require.NoError(t, err)
+
+	target := newTestFederationTarget(t, srv, ca.issue(t, "peer.example.com"), "peer.example.com", testFederationMatchers)
+
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://peer.example.com/books/1", Private: true, Event: Event{ID: "urn:uuid:1", Data: "federated"}}))
+
+	u := <-updates
+	assert.Equal(t, "urn:uuid:1", u.ID)
+	assert.Equal(t, "federated", u.Data)
+	assert.True(t, u.Private)
+	assert.Equal(t, "peer.example.com", u.federatedFrom)
+
+	// A compromised peer can't inject updates outside of its topic spaces.
+	require.ErrorIs(t, target.Send(t.Context(), &Update{Topic: "https://example.com/admin", Event: Event{Data: "injected"}}), errPublishHookStatus)
+
+	// The updates received from the peers are not sent back.
+	require.NoError(t, (&FederationPublishHookTarget{}).Send(t.Context(), u))
+
+	// A new session is opened when the peer forgot the current one.
+	hub.federation.Lock()
+	clear(hub.federation.sessions)
+	hub.federation.Unlock()
+
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://peer.example.com/books/2", Event: Event{Data: "again"}}))
+	assert.Equal(t, "again", (<-updates).Data)
+}
+
+func TestFederationRejectedHandshakes(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	_, srv := startFederatedHub(t, ca)
+
+	for name, target := range map[string]*FederationPublishHookTarget{
+		"untrusted CA":      newTestFederationTarget(t, srv, newTestCA(t).issue(t, "peer.example.com"), "peer.example.com", testFederationMatchers),
+		"unknown peer":      newTestFederationTarget(t, srv, ca.issue(t, "other.example.com"), "other.example.com", testFederationMatchers),
+		"other certificate": newTestFederationTarget(t, srv, ca.issue(t, "other.example.com"), "peer.example.com", testFederationMatchers),
+		"ungranted space":   newTestFederationTarget(t, srv, ca.issue(t, "peer.example.com"), "peer.example.com", []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/*"}}),
+	} {
+		require.ErrorIs(t, target.Send(t.Context(), &Update{Topic: "https://peer.example.com/books/1"}), errPublishHookStatus, name)
+	}
+}
+
+func TestFederationInvalid(t *testing.T) {
+	t.Parallel()
+
+	for name, f := range map[string]Federation{
+		"no client CAs": {Peers: []FederationPeer{{Name: "peer.example.com"}}},
+		"no peer name":  {ClientCAs: x509.NewCertPool(), Peers: []FederationPeer{{}}},
+	} {
+		_, err := NewHub(t.Context(), WithFederation(f))
+		require.ErrorIs(t, err, ErrInvalidFederation, name)
+	}
+
+	_, err := NewFederationPublishHookTarget("https://example.com/.well-known/mercure", FederationPublishHookConfig{Name: "peer.example.com"})
+	require.ErrorIs(t, err, ErrInvalidPublishHook)
+}
+
+func TestFederationRegionAffinity(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	received := make(chanPublishHookTarget, 10)
+	hub, srv := startFederatedHub(t, ca, WithPublishHooks(PublishHook{Target: received}))
+
+	target := newTestFederationTarget(t, srv, ca.issue(t, "peer.example.com"), "peer.example.com", testFederationMatchers, func(c *FederationPublishHookConfig) {
+		c.RegionAffinity = []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://peer.example.com/local/*"}}
+		c.InterestInterval = time.Nanosecond
+	})
+
+	// Nobody subscribed to the local topics of the peer.
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://peer.example.com/local/1", Event: Event{Data: "skipped"}}))
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://peer.example.com/global", Event: Event{Data: "global"}}))
+	assert.Equal(t, "global", (<-received).Data)
+
+	_, err := hub.Subscribe(t.Context(), []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://peer.example.com/local/*"}}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://peer.example.com/local/1", Event: Event{Data: "local"}}))
+	assert.Equal(t, "local", (<-received).Data)
+}
+
+func TestFederationSessionInterest(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(0)
+	require.NoError(t, err)
+
+	s := &federationSession{matchers: testFederationMatchers}
+	subscriber := func(matchers ...TopicMatcher) *Subscriber {
+		return &Subscriber{SubscribedMatchers: matchers}
+	}
+
+	assert.Equal(t, []TopicMatcher{
+		{Type: MatcherTypeExact, Pattern: "https://peer.example.com/books/1"},
+		{Type: MatcherTypeURLPattern, Pattern: "https://peer.example.com/books/*"},
+		{Type: MatcherTypeExact, Pattern: "*"},
+	}, s.interest(tms, []*Subscriber{
+		subscriber(TopicMatcher{Type: MatcherTypeExact, Pattern: "https://peer.example.com/books/1"}, TopicMatcher{Type: MatcherTypeExact, Pattern: "https://example.com/secret"}),
+		subscriber(TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://peer.example.com/books/*"}),
+		subscriber(TopicMatcher{Type: MatcherTypeExact, Pattern: "https://peer.example.com/books/1"}, TopicMatcher{Type: MatcherTypeExact, Pattern: "*"}),
+	}))
+}
+
+func TestFederationInterestFiltering(t *testing.T) {
+	t.Parallel()
+
+	ca := newTestCA(t)
+	received := make(chanPublishHookTarget, 10)
+	hub, srv := startFederatedHub(t, ca, WithPublishHooks(PublishHook{Target: received}))
+
+	target := newTestFederationTarget(t, srv, ca.issue(t, "peer.example.com"), "peer.example.com", testFederationMatchers, func(c *FederationPublishHookConfig) {
+		c.InterestFiltering = true
+		c.InterestInterval = time.Nanosecond
+	})
+
+	_, err := hub.Subscribe(t.Context(), []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://peer.example.com/books/1"}}, nil)
+	require.NoError(t, err)
+
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://peer.example.com/books/2", Event: Event{Data: "skipped"}}))
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://peer.example.com/books/1", Event: Event{Data: "subscribed"}}))
+	assert.Equal(t, "subscribed", (<-received).Data)
+
+	// The unchanged digest is not sent again.
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, target.interestURL, nil)
+	require.NoError(t, err)
+	req.Header.Set(federationSessionHeader, target.session)
+	req.Header.Set("If-None-Match", target.interestETag)
+
+	resp, err := target.client.Do(req)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	digest := target.interest
+	target.fetchInterest(t.Context())
+	assert.Same(t, digest, target.interest)
+}
@@ -0,0 +1,193 @@
+package mercure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// federationInterestURL is the endpoint the peers fetch the topic selectors
+// of the subscribers of the hub in their topic spaces from.
+const federationInterestURL = defaultHubURL + "/federation/interest"
+
+// defaultFederationInterestInterval is how often FederationPublishHookTarget
+// refreshes the interest of the peer when not set.
+const defaultFederationInterestInterval = 10 * time.Second
+
+// interest returns the topic selectors of the subscribers in the topic
+// spaces of the session, the selectors being taken as topics.
+func (s *federationSession) interest(tms *TopicMatcherStore, subscribers []*Subscriber) []TopicMatcher {
+	var matchers []TopicMatcher
+
+	for _, sub := range subscribers {
+		for _, m := range sub.SubscribedMatchers {
+			if m.Pattern != "*" && !slices.ContainsFunc(s.matchers, func(sm TopicMatcher) bool { return tms.matches([]string{m.Pattern}, sm) }) {
+				continue
+			}
+
+			if !slices.Contains(matchers, m) {
+				matchers = append(matchers, m)
+			}
+		}
+	}
+
+	return matchers
+}
+
+// FederationInterestHandler returns a digest of the topic selectors of the
+// active subscribers of the hub in the topic spaces of the federation session
+// of the peer, for it to only send the updates having subscribers. The digest
+// is revalidated using its ETag.
+func (h *Hub) FederationInterestHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "mercure.federation.interest", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	cert, err := h.federation.peerCertificate(r)
+	if err != nil {
+		h.writeFederationError(w, r, err, http.StatusUnauthorized)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	s, ok := h.federation.session(r.Header.Get(federationSessionHeader), cert)
+	if !ok {
+		http.Error(w, "Invalid federation session", http.StatusUnauthorized)
+
+		return
+	}
+
+	// Without the list of the subscribers, the peers send all the updates.
+	ts, ok := h.transport.(TransportSubscribers)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	_, subscribers, err := ts.GetSubscribers(ctx)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	body, err := json.Marshal(newInterestDigest(s.interest(h.topicMatcherStore, subscribers)))
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	sum := sha256.Sum256(body)
+	etag := `"` + base64.RawURLEncoding.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("ETag", etag)
+
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if _, err := w.Write(body); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write federation interest response", slog.Any("error", err))
+	}
+}
+
+// interested reports whether the peer may have subscribers for the update:
+// unless InterestFiltering is set, the topics without region affinity are
+// always sent, as well as all the updates when the interest of the peer is
+// unknown.
+func (t *FederationPublishHookTarget) interested(ctx context.Context, u *Update) bool {
+	topics := u.topics()
+	if !t.config.InterestFiltering && !slices.ContainsFunc(t.config.RegionAffinity, func(m TopicMatcher) bool { return t.tms.matches(topics, m) }) {
+		return true
+	}
+
+	if time.Since(t.interestFetched) >= t.config.InterestInterval {
+		t.fetchInterest(ctx)
+		t.interestFetched = time.Now()
+	}
+
+	if t.interest == nil {
+		return true
+	}
+
+	return t.interest.matches(topics)
+}
+
+// fetchInterest refreshes the digest of the topic selectors of the
+// subscribers of the peer, or forgets it when it is unknown.
+func (t *FederationPublishHookTarget) fetchInterest(ctx context.Context) {
+	d, etag, ok := t.requestInterest(ctx)
+	if !ok {
+		t.interest, t.interestETag = nil, ""
+
+		return
+	}
+
+	if d != nil {
+		t.interest, t.interestETag = d, etag
+	}
+}
+
+// requestInterest fetches the digest of the interest of the peer, which is
+// nil when the current one is still valid.
+func (t *FederationPublishHookTarget) requestInterest(ctx context.Context) (*interestDigest, string, bool) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.interestURL, nil)
+	if err != nil {
+		return nil, "", false
+	}
+
+	req.Header.Set(federationSessionHeader, t.session)
+
+	if t.interest != nil && t.interestETag != "" {
+		req.Header.Set("If-None-Match", t.interestETag)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return nil, "", false
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		return nil, "", t.interest != nil
+	case http.StatusOK:
+	default:
+		return nil, "", false
+	}
+
+	var d interestDigest
+	if err := json.NewDecoder(resp.Body).Decode(&d); err != nil {
+		return nil, "", false
+	}
+
+	return &d, resp.Header.Get("ETag"), true
+}
+
+// validateRegionAffinity checks the matchers of the topics with region
+// affinity.
+func validateRegionAffinity(tms *TopicMatcherStore, matchers []TopicMatcher) error {
+	for _, m := range matchers {
+		if err := validateProtocolMatcher(tms, m); err != nil {
+			return fmt.Errorf("%w: region affinity %q: %w", ErrInvalidPublishHook, m.Pattern, err)
+		}
+	}
+
+	return nil
+}
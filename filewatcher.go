@@ -0,0 +1,346 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// FileChangeOp is the kind of change of a file.
+type FileChangeOp string
+
+const (
+	// FileCreated is reported when a file appears.
+	FileCreated FileChangeOp = "created"
+	// FileModified is reported when the content of a file changes.
+	FileModified FileChangeOp = "modified"
+	// FileDeleted is reported when a file disappears.
+	FileDeleted FileChangeOp = "deleted"
+)
+
+const (
+	// defaultFileWatcherInterval is the minimum interval between two scans
+	// of a watched directory.
+	defaultFileWatcherInterval = 2 * time.Second
+	// fileChangeKeyPlaceholder is replaced with the path of the file in the
+	// topic.
+	fileChangeKeyPlaceholder = "{key}"
+	// fileChangeBucketPlaceholder is replaced with the bucket of the object
+	// in the topic.
+	fileChangeBucketPlaceholder = "{bucket}"
+)
+
+// ErrInvalidFileWatcher is returned by NewHub when a file watcher is not
+// valid.
+var ErrInvalidFileWatcher = errors.New("invalid file watcher")
+
+// errDirWatcherClosed is returned when the events of the directories can't
+// be read anymore.
+var errDirWatcherClosed = errors.New("the directory watcher stopped")
+
+// FileChange is a change of a file or of an object, published as the JSON
+// data of an update.
+type FileChange struct {
+	Op     FileChangeOp `json:"op"`
+	Bucket string       `json:"bucket,omitempty"`
+	// Path is the slash-separated path of the file relative to the watched
+	// directory, or the key of the object.
+	Path string `json:"path"`
+	Size int64  `json:"size,omitempty"`
+	ETag string `json:"etag,omitempty"`
+}
+
+// fileChangeTopic returns the topic of the change: {key} is replaced with the
+// path, each segment being percent-encoded, and {bucket} with the bucket.
+func fileChangeTopic(template string, c FileChange) string {
+	segments := strings.Split(c.Path, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+
+	return strings.NewReplacer(
+		fileChangeKeyPlaceholder, strings.Join(segments, "/"),
+		fileChangeBucketPlaceholder, url.PathEscape(c.Bucket),
+	).Replace(template)
+}
+
+// publishFileChange publishes the change on the topic template.
+func (h *Hub) publishFileChange(ctx context.Context, template string, private bool, c FileChange) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return
+	}
+
+	u := &Update{Topic: fileChangeTopic(template, c), Private: private, Event: Event{Data: string(data)}}
+	if err := h.Publish(ctx, u); err != nil && !errors.Is(err, ErrPartialDispatch) && h.logger.Enabled(ctx, slog.LevelError) {
+		h.logger.LogAttrs(ctx, slog.LevelError, "Failed to publish file change", slog.String("path", c.Path), slog.Any("error", err))
+	}
+}
+
+// FileWatcher publishes the changes of the files of a directory and its
+// subdirectories. On Linux, the directory is scanned when inotify reports a
+// change, and again while files are being written; it is scanned
+// periodically when inotify isn't available, or with Poll. A created or
+// modified file is reported once its size and modification time are the
+// same in two consecutive scans, so subscribers are only notified once the
+// file is completely written. The hub must have access to the directory. The
+// files present when the watcher starts are not reported.
+type FileWatcher struct {
+	// Dir is the watched directory.
+	Dir string
+	// Interval is the minimum interval between two scans, and the interval
+	// between two periodic scans, two seconds when zero.
+	Interval time.Duration
+	// Poll scans the directory periodically instead of waiting for the
+	// changes reported by inotify, which misses the changes made by the
+	// other machines of network filesystems.
+	Poll bool
+	// Topic of the published updates. "{key}" is replaced with the
+	// percent-encoded path of the file relative to Dir.
+	Topic string
+	// Private publishes private updates.
+	Private bool
+}
+
+// WithFileWatchers sets watchers publishing the changes of the files of
+// directories.
+func WithFileWatchers(watchers ...FileWatcher) Option {
+	return func(o *opt) error {
+		for i, w := range watchers {
+			if w.Dir == "" || w.Topic == "" {
+				return fmt.Errorf("%w %d: the directory and the topic are required", ErrInvalidFileWatcher, i)
+			}
+
+			if w.Interval < 0 {
+				return fmt.Errorf("%w %d: the interval must be positive", ErrInvalidFileWatcher, i)
+			}
+		}
+
+		o.fileWatchers = watchers
+
+		return nil
+	}
+}
+
+// startFileWatchers starts the watchers, stopped when the context of the hub
+// is done.
+func (h *Hub) startFileWatchers() {
+	for _, w := range h.fileWatchers {
+		if w.Interval == 0 {
+			w.Interval = defaultFileWatcherInterval
+		}
+
+		s := &dirScanner{FileWatcher: w, hub: h}
+
+		go s.run(h.ctx)
+	}
+}
+
+// fileState identifies a version of a file.
+type fileState struct {
+	size    int64
+	modTime int64
+}
+
+// dirScanner runs a file watcher.
+type dirScanner struct {
+	FileWatcher
+
+	hub *Hub
+	// dirs are the directories found by the last scan.
+	dirs []string
+	// reported holds the files as last reported, nil before the first scan.
+	reported map[string]fileState
+	// pending holds the files changed since they were last reported, as seen
+	// by the previous scan.
+	pending map[string]fileState
+}
+
+func (s *dirScanner) run(ctx context.Context) {
+	if !s.Poll {
+		w, err := newDirWatcher()
+		if err == nil {
+			err = s.watch(ctx, w)
+			_ = w.Close()
+		}
+
+		if ctx.Err() != nil {
+			return
+		}
+
+		if s.hub.logger.Enabled(ctx, slog.LevelWarn) {
+			s.hub.logger.LogAttrs(ctx, slog.LevelWarn, "Unable to watch the changes of the directory, scanning it periodically", slog.String("dir", s.Dir), slog.Any("error", err))
+		}
+	}
+
+	s.poll(ctx)
+}
+
+// poll scans the directory every interval.
+func (s *dirScanner) poll(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		s.scanLogged(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// watch scans the directory when the watcher reports a change, and again
+// after the interval while a scan failed, files are being written or
+// directories have appeared, until the context is done or the watcher fails.
+func (s *dirScanner) watch(ctx context.Context, w *dirWatcher) error {
+	timer := time.NewTimer(s.Interval)
+	defer timer.Stop()
+
+	for {
+		err := s.scanLogged(ctx)
+
+		// The files created in the new directories before they were watched
+		// are found by the next scan.
+		added, werr := w.sync(s.dirs)
+		if werr != nil {
+			return werr
+		}
+
+		rescan := err != nil || added || len(s.pending) > 0
+
+		// The scans are an interval apart at least, for the files to be
+		// reported once stable.
+		timer.Reset(s.Interval)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+		}
+
+		if rescan {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-w.changed:
+			if !ok {
+				return errDirWatcherClosed
+			}
+		}
+	}
+}
+
+// scanLogged scans the directory, logging the error.
+func (s *dirScanner) scanLogged(ctx context.Context) error {
+	err := s.scan(ctx)
+	if err != nil && s.hub.logger.Enabled(ctx, slog.LevelError) {
+		s.hub.logger.LogAttrs(ctx, slog.LevelError, "Failed to scan watched directory", slog.String("dir", s.Dir), slog.Any("error", err))
+	}
+
+	return err
+}
+
+// scan lists the files of the directory, and publishes the changes.
+func (s *dirScanner) scan(ctx context.Context) error {
+	var (
+		files = make(map[string]fileState)
+		dirs  []string
+	)
+
+	if err := filepath.WalkDir(s.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// A file deleted during the walk.
+			if errors.Is(err, fs.ErrNotExist) && path != s.Dir {
+				return nil
+			}
+
+			return err
+		}
+
+		if d.IsDir() {
+			dirs = append(dirs, path)
+
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil //nolint:nilerr
+		}
+
+		rel, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		files[filepath.ToSlash(rel)] = fileState{info.Size(), info.ModTime().UnixNano()}
+
+		return nil
+	}); err != nil {
+		return fmt.Errorf("unable to scan %q: %w", s.Dir, err)
+	}
+
+	s.dirs = dirs
+
+	if s.reported == nil {
+		s.reported, s.pending = files, make(map[string]fileState)
+
+		return nil
+	}
+
+	for _, path := range slices.Sorted(maps.Keys(s.reported)) {
+		if _, ok := files[path]; !ok {
+			delete(s.reported, path)
+			s.hub.publishFileChange(ctx, s.Topic, s.Private, FileChange{Op: FileDeleted, Path: path})
+		}
+	}
+
+	pending := make(map[string]fileState)
+
+	for _, path := range slices.Sorted(maps.Keys(files)) {
+		state := files[path]
+
+		reported, known := s.reported[path]
+		if known && reported == state {
+			continue
+		}
+
+		// Wait for the file to be stable.
+		if previous, ok := s.pending[path]; !ok || previous != state {
+			pending[path] = state
+
+			continue
+		}
+
+		op := FileCreated
+		if known {
+			op = FileModified
+		}
+
+		s.reported[path] = state
+		s.hub.publishFileChange(ctx, s.Topic, s.Private, FileChange{Op: op, Path: path, Size: state.size})
+	}
+
+	s.pending = pending
+
+	return nil
+}
@@ -0,0 +1,108 @@
+package mercure
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// inotifyMask selects the changes reported for the watched directories. The
+// writes themselves aren't: the files being written are scanned again until
+// they are stable.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_ATTRIB |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_DELETE | syscall.IN_ONLYDIR
+
+// dirWatcher reports the changes of directories with inotify.
+type dirWatcher struct {
+	fd   int
+	file *os.File
+	// watches are the watch descriptors of the directories.
+	watches map[int]struct{}
+	// changed receives a value when a change is reported, and is closed when
+	// the events can't be read anymore.
+	changed chan struct{}
+}
+
+func newDirWatcher() (*dirWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("unable to initialize inotify: %w", err)
+	}
+
+	w := &dirWatcher{
+		fd: fd,
+		// Non-blocking, the file is read through the runtime poller, and
+		// closing it interrupts the read.
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		watches: make(map[int]struct{}),
+		changed: make(chan struct{}, 1),
+	}
+
+	go w.read()
+
+	return w, nil
+}
+
+// read coalesces the events until the watcher is closed.
+func (w *dirWatcher) read() {
+	defer close(w.changed)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+
+	for {
+		if _, err := w.file.Read(buf); err != nil {
+			return
+		}
+
+		select {
+		case w.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// sync watches the directories, and stops watching the other ones. It
+// reports whether a directory wasn't watched yet.
+func (w *dirWatcher) sync(dirs []string) (bool, error) {
+	var (
+		watches = make(map[int]struct{}, len(dirs))
+		added   bool
+	)
+
+	// Watching again a directory has no effect, but watches it if another
+	// one has been moved in its place.
+	for _, dir := range dirs {
+		wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+		if err != nil {
+			// Deleted since the scan.
+			if errors.Is(err, syscall.ENOENT) || errors.Is(err, syscall.ENOTDIR) {
+				continue
+			}
+
+			return false, fmt.Errorf("unable to watch %q: %w", dir, err)
+		}
+
+		if _, ok := w.watches[wd]; !ok {
+			added = true
+		}
+
+		watches[wd] = struct{}{}
+	}
+
+	for wd := range w.watches {
+		if _, ok := watches[wd]; !ok {
+			// Fails for the deleted directories, not watched anymore.
+			_, _ = syscall.InotifyRmWatch(w.fd, uint32(wd)) //nolint:gosec
+		}
+	}
+
+	w.watches = watches
+
+	return added, nil
+}
+
+// Close stops watching the directories.
+func (w *dirWatcher) Close() error {
+	return w.file.Close() //nolint:wrapcheck
+}
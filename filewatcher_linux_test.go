@@ -0,0 +1,49 @@
+package mercure
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirWatcher(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	sub := filepath.Join(dir, "sub")
+	require.NoError(t, os.Mkdir(sub, 0o700))
+
+	w, err := newDirWatcher()
+	require.NoError(t, err)
+
+	added, err := w.sync([]string{dir, sub, filepath.Join(dir, "deleted")})
+	require.NoError(t, err)
+	assert.True(t, added)
+
+	added, err = w.sync([]string{dir, sub})
+	require.NoError(t, err)
+	assert.False(t, added, "the directories are already watched")
+
+	require.NoError(t, os.WriteFile(filepath.Join(sub, "new.txt"), []byte("foo"), 0o600))
+
+	select {
+	case _, ok := <-w.changed:
+		assert.True(t, ok)
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "change not reported")
+	}
+
+	require.NoError(t, w.Close())
+	assert.Eventually(t, func() bool {
+		select {
+		case _, ok := <-w.changed:
+			return !ok
+		default:
+			return false
+		}
+	}, 5*time.Second, 10*time.Millisecond, "closing the watcher stops the reads")
+}
@@ -0,0 +1,27 @@
+//go:build !linux
+
+package mercure
+
+import "errors"
+
+// errDirWatcherUnsupported is returned by newDirWatcher on the systems
+// without inotify: the watched directories are scanned periodically.
+var errDirWatcherUnsupported = errors.New("watching the changes of directories is only supported on Linux")
+
+// dirWatcher reports the changes of directories, on Linux only.
+type dirWatcher struct {
+	changed chan struct{}
+}
+
+func newDirWatcher() (*dirWatcher, error) {
+	return nil, errDirWatcherUnsupported
+}
+
+func (*dirWatcher) sync([]string) (bool, error) {
+	return false, nil
+}
+
+// Close stops watching the directories.
+func (*dirWatcher) Close() error {
+	return nil
+}
@@ -0,0 +1,93 @@
+package mercure
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileChangeTopic(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, "https://example.com/my%20bucket/videos/a%20b%3F.mp4", fileChangeTopic("https://example.com/{bucket}/{key}", FileChange{Bucket: "my bucket", Path: "videos/a b?.mp4"}))
+}
+
+func TestFileWatcher(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "existing.txt"), []byte("foo"), 0o600))
+
+	published := make(chanPublishHookTarget, 10)
+	h := createDummy(t, WithPublishHooks(PublishHook{Target: published}))
+	s := &dirScanner{FileWatcher: FileWatcher{Dir: dir, Topic: "https://example.com/files/{key}"}, hub: h}
+
+	require.NoError(t, s.scan(t.Context()))
+
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "new.txt"), []byte("foo"), 0o600))
+	require.NoError(t, s.scan(t.Context()))
+	assert.Empty(t, published, "a file is reported once stable")
+
+	require.NoError(t, s.scan(t.Context()))
+
+	u := <-published
+	assert.Equal(t, "https://example.com/files/sub/new.txt", u.Topic)
+	assert.JSONEq(t, `{"op":"created","path":"sub/new.txt","size":3}`, u.Data)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "existing.txt"), []byte("foobar"), 0o600))
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "existing.txt"), time.Time{}, time.Now().Add(time.Minute)))
+	require.NoError(t, os.Remove(filepath.Join(dir, "sub", "new.txt")))
+	require.NoError(t, s.scan(t.Context()))
+	require.NoError(t, s.scan(t.Context()))
+
+	assert.JSONEq(t, `{"op":"deleted","path":"sub/new.txt"}`, (<-published).Data)
+	assert.JSONEq(t, `{"op":"modified","path":"existing.txt","size":6}`, (<-published).Data)
+	assert.Empty(t, published)
+}
+
+func TestFileWatcherRun(t *testing.T) {
+	t.Parallel()
+
+	for name, poll := range map[string]bool{"events": false, "poll": true} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			published := make(chanPublishHookTarget, 10)
+			createDummy(t,
+				WithPublishHooks(PublishHook{Target: published}),
+				WithFileWatchers(FileWatcher{Dir: dir, Interval: 10 * time.Millisecond, Topic: "https://example.com/files/{key}", Poll: poll}),
+			)
+
+			// Created once the first scan has recorded the empty directory.
+			time.Sleep(50 * time.Millisecond)
+			require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0o700))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "new.txt"), []byte("foo"), 0o600))
+
+			select {
+			case u := <-published:
+				assert.JSONEq(t, `{"op":"created","path":"sub/new.txt","size":3}`, u.Data)
+			case <-time.After(5 * time.Second):
+				require.FailNow(t, "change not published")
+			}
+		})
+	}
+}
+
+func TestWithFileWatchersInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, w := range []FileWatcher{
+		{Dir: "foo"},
+		{Topic: "https://example.com/{key}"},
+		{Dir: "foo", Topic: "https://example.com/{key}", Interval: -time.Second},
+	} {
+		_, err := NewHub(t.Context(), WithFileWatchers(w))
+		assert.ErrorIs(t, err, ErrInvalidFileWatcher)
+	}
+}
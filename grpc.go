@@ -0,0 +1,376 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+
+	"github.com/dunglas/mercure/mercurepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// WithGRPC serves the gRPC API, defined in the mercurepb package, on the
+// listener until the hub stops.
+//
+// The gRPC API lets backend services publish, subscribe and list the active
+// subscriptions without parsing Server-Sent Events. The calls go through the
+// transport of the hub and are authorized like the HTTP requests, with the
+// JWT passed in the "authorization" metadata: the authorization webhook and
+// the subscription approval apply, and the subscriptions end when the token
+// expires. The server options configure
+// the server, for instance its TLS credentials: without, the API is served
+// in clear text.
+func WithGRPC(l net.Listener, opts ...grpc.ServerOption) Option {
+	return func(o *opt) error {
+		o.grpcListener = l
+		o.grpcServerOptions = opts
+
+		return nil
+	}
+}
+
+// grpcServer implements the gRPC API.
+type grpcServer struct {
+	mercurepb.UnimplementedHubServer
+
+	hub *Hub
+}
+
+// startGRPC serves the gRPC API, if enabled.
+func (h *Hub) startGRPC() {
+	if h.grpcListener == nil {
+		return
+	}
+
+	s := grpc.NewServer(h.grpcServerOptions...)
+	mercurepb.RegisterHubServer(s, &grpcServer{hub: h})
+
+	go func() {
+		<-h.ctx.Done()
+
+		// The subscription streams end with the hub.
+		s.GracefulStop()
+	}()
+
+	go func() {
+		if err := s.Serve(h.grpcListener); err != nil && h.logger.Enabled(h.ctx, slog.LevelError) {
+			h.logger.LogAttrs(h.ctx, slog.LevelError, "gRPC API stopped", slog.Any("error", err))
+		}
+	}()
+}
+
+var (
+	errGRPCUnauthenticated   = status.Error(codes.Unauthenticated, "invalid or missing token")
+	errGRPCTokenExpired      = status.Error(codes.Unauthenticated, "token expired")
+	errGRPCPermissionDenied  = status.Error(codes.PermissionDenied, "insufficient scope")
+	errGRPCSubscribeDisabled = status.Error(codes.Unimplemented, "subscriptions are disabled")
+	errGRPCPublishDisabled   = status.Error(codes.Unimplemented, "publications are disabled")
+	errGRPCSubscriptionsAPI  = status.Error(codes.Unimplemented, "the subscription API is disabled")
+)
+
+// claims returns the claims of the token passed in the authorization metadata
+// of the call, nil if there is none.
+func (s *grpcServer) claims(ctx context.Context, publish bool) (*claims, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, nil //nolint:nilnil
+	}
+
+	token, err := bearerToken(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.hub.validateJWT(token, publish)
+}
+
+// grpcCaller returns the caller of a call, for the authorization webhook.
+func grpcCaller(ctx context.Context) authorizationCaller {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var caller authorizationCaller
+	if token, err := bearerToken(md.Get("authorization")); err == nil {
+		caller.token = token
+	}
+
+	caller.client.UserAgent = firstValue(md.Get("user-agent"))
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			caller.client.RemoteAddr = host
+		}
+	}
+
+	return caller
+}
+
+// grpcAuthorizationError converts the error of authorizePublication or
+// authorizeSubscription.
+func grpcAuthorizationError(err error) error {
+	if errors.Is(err, errAuthorizationDenied) {
+		return errGRPCPermissionDenied
+	}
+
+	return status.Error(codes.Unavailable, http.StatusText(http.StatusServiceUnavailable))
+}
+
+// Subscribe streams the updates matching the request.
+func (s *grpcServer) Subscribe(req *mercurepb.SubscribeRequest, stream grpc.ServerStreamingServer[mercurepb.Update]) error {
+	h := s.hub
+	ctx := stream.Context()
+
+	if !h.subscriberConfigured && !h.anonymous {
+		return errGRPCSubscribeDisabled
+	}
+
+	var c *claims
+
+	if h.subscriberConfigured {
+		var err error
+		if c, err = s.claims(ctx, false); err != nil || (c == nil && !h.anonymous) {
+			return errGRPCUnauthenticated
+		}
+	}
+
+	matchers := make([]TopicMatcher, 0, len(req.GetMatch())+len(req.GetMatchUrlpattern()))
+	for _, pattern := range req.GetMatch() {
+		matchers = append(matchers, TopicMatcher{Type: MatcherTypeExact, Pattern: pattern})
+	}
+
+	for _, pattern := range req.GetMatchUrlpattern() {
+		matchers = append(matchers, TopicMatcher{Type: MatcherTypeURLPattern, Pattern: pattern})
+	}
+
+	switch {
+	case len(matchers) == 0:
+		return status.Error(codes.InvalidArgument, ErrMissingTopicMatchers.Error())
+	case len(matchers) > maxMatcherCount:
+		return status.Error(codes.InvalidArgument, errTooManyMatchers.Error())
+	}
+
+	for _, m := range matchers {
+		if err := validateProtocolMatcher(h.topicMatcherStore, m); err != nil {
+			return status.Errorf(codes.InvalidArgument, "%q: %s", m.Pattern, err)
+		}
+	}
+
+	c, err := h.authorizeSubscription(ctx, grpcCaller(ctx), c, matchers)
+	if err != nil {
+		return grpcAuthorizationError(err)
+	}
+
+	var privateMatchers []TopicMatcher
+	if c != nil {
+		privateMatchers = c.authz.subscribeMatchers()
+	}
+
+	lastEventID, err := h.parseLastEventID(req.GetLastEventId())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ls := NewLocalSubscriber(lastEventID, h.logger, h.topicMatcherStore)
+	ls.RequestLastEventIDSet = req.GetLastEventId() != ""
+	ls.Claims = c
+	ls.setMatchers(matchers, privateMatchers)
+
+	if p, ok := peer.FromContext(ctx); ok {
+		ls.AddressFamily = addrFamily(p.Addr)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	ls.Languages = preferredLanguages(c, firstValue(md.Get("accept-language")))
+
+	updates, err := h.addLocalSubscriber(ctx, ls, "New gRPC subscriber")
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrTenantQuotaExceeded):
+			return status.Error(codes.ResourceExhausted, err.Error())
+		case errors.Is(err, ErrSubscriptionRejected):
+			return status.Error(codes.PermissionDenied, err.Error())
+		case ctx.Err() != nil:
+			return nil
+		}
+
+		return status.Error(codes.Unavailable, "unable to add the subscriber")
+	}
+
+	for u := range updates {
+		if err := stream.Send(&mercurepb.Update{
+			Id:      u.ID,
+			Topic:   u.Topic,
+			Type:    u.Type,
+			Data:    u.DataFor(ls.Languages),
+			Private: u.Private,
+			Retry:   u.Retry,
+		}); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	// Read once the channel is closed, after the reason is set.
+	if ls.disconnectReason == DisconnectReasonTokenExpired {
+		return errGRPCTokenExpired
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	// The hub stopped, or the client didn't read the updates fast enough.
+	return status.Error(codes.Unavailable, "subscription ended by the hub")
+}
+
+// Publish publishes an update.
+func (s *grpcServer) Publish(ctx context.Context, req *mercurepb.PublishRequest) (*mercurepb.PublishResponse, error) {
+	h := s.hub
+
+	if !h.publisherConfigured {
+		return nil, errGRPCPublishDisabled
+	}
+
+	c, err := s.claims(ctx, true)
+	if err != nil || c == nil {
+		return nil, errGRPCUnauthenticated
+	}
+
+	topic := req.GetTopic()
+	if topic == "" {
+		return nil, status.Error(codes.InvalidArgument, "missing topic")
+	}
+
+	// Validated before reaching the shared match cache, see PublishHandler.
+	if !validProtocolString(topic) {
+		return nil, status.Error(codes.InvalidArgument, ErrInvalidTopic.Error())
+	}
+
+	if c, err = h.authorizePublication(ctx, grpcCaller(ctx), c, []string{topic}, req.GetPrivate()); err != nil {
+		return nil, grpcAuthorizationError(err)
+	}
+
+	if err := h.checkPublishRate(ctx, c, []string{topic}); err != nil {
+		return nil, grpcPublishError(err)
+	}
+
+	u := &Update{
+		Private:   req.GetPrivate(),
+		Debug:     h.debug,
+		Event:     Event{Data: req.GetData(), ID: req.GetId(), Type: req.GetType(), Retry: req.GetRetry()},
+		Publisher: publisherID(c),
+		Tenant:    h.tenantName(c),
+	}
+	u.setTopics([]string{topic})
+
+	if err := h.Publish(context.WithoutCancel(ctx), u); err != nil && !errors.Is(err, ErrPartialDispatch) {
+		return nil, grpcPublishError(err)
+	}
+
+	return &mercurepb.PublishResponse{Id: u.ID}, nil
+}
+
+// grpcPublishError converts the error of a failed publication to the gRPC
+// equivalent of the status code of the HTTP API.
+func grpcPublishError(err error) error {
+	switch publishErrorStatus(err) {
+	case http.StatusBadRequest:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case http.StatusPreconditionFailed:
+		return status.Error(codes.FailedPrecondition, err.Error())
+	case http.StatusTooManyRequests:
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case http.StatusServiceUnavailable:
+		return status.Error(codes.Unavailable, http.StatusText(http.StatusServiceUnavailable))
+	default:
+		return status.Error(codes.Internal, http.StatusText(http.StatusInternalServerError))
+	}
+}
+
+// GetSubscriptions returns the active subscriptions.
+func (s *grpcServer) GetSubscriptions(ctx context.Context, req *mercurepb.GetSubscriptionsRequest) (*mercurepb.GetSubscriptionsResponse, error) {
+	h := s.hub
+
+	transport, ok := h.transport.(TransportSubscribers)
+	if !h.subscriptions || !ok {
+		return nil, errGRPCSubscriptionsAPI
+	}
+
+	filter := subscriptionFilter{matchType: req.GetMatchType(), match: req.GetMatch()}
+	if (filter.matchType == "") != (filter.match == "") {
+		return nil, status.Error(codes.InvalidArgument, "match_type and match must be set together")
+	}
+
+	// The URL the token must allow subscribing to, like for the HTTP API.
+	resource := subscriptionsURL
+	if filter.matchType != "" {
+		if !h.topicMatcherStore.supportsMatcherType(MatcherType(filter.matchType)) {
+			return nil, status.Error(codes.InvalidArgument, ErrUnsupportedMatcherType.Error())
+		}
+
+		resource += "/" + escapeSubscriptionSegment(filter.matchType) + "/" + escapeSubscriptionSegment(filter.match)
+	}
+
+	if h.subscriberConfigured {
+		c, err := s.claims(ctx, false)
+		if err != nil || c == nil {
+			return nil, errGRPCUnauthenticated
+		}
+
+		if !c.authz.grants(h.topicMatcherStore, actionSubscribe, resource) {
+			return nil, errGRPCPermissionDenied
+		}
+	}
+
+	lastEventID, subscribers, err := transport.GetSubscribers(ctx)
+	if err != nil {
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Error retrieving subscribers", slog.Any("error", err))
+		}
+
+		return nil, status.Error(codes.Internal, http.StatusText(http.StatusInternalServerError))
+	}
+
+	resp := &mercurepb.GetSubscriptionsResponse{LastEventId: lastEventID}
+
+	for _, subscriber := range subscribers {
+		for _, sub := range subscriber.getSubscriptions(filter, true) {
+			ps := &mercurepb.Subscription{
+				Id:         sub.ID,
+				Subscriber: sub.Subscriber,
+				Match:      sub.Match,
+				MatchType:  sub.MatchType,
+			}
+
+			if sub.Topic != "" {
+				ps.Match = sub.Topic
+			}
+
+			if sub.Payload != nil {
+				if ps.Payload, err = json.Marshal(sub.Payload); err != nil {
+					return nil, status.Error(codes.Internal, http.StatusText(http.StatusInternalServerError))
+				}
+			}
+
+			resp.Subscriptions = append(resp.Subscriptions, ps)
+		}
+	}
+
+	return resp, nil
+}
+
+// firstValue returns the first of the values, or an empty string.
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
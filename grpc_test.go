@@ -0,0 +1,288 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/dunglas/mercure/mercurepb"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// createGRPCClient serves the gRPC API of a new hub and returns a client.
+func createGRPCClient(t *testing.T, options ...Option) (*Hub, mercurepb.HubClient) {
+	t.Helper()
+
+	l := bufconn.Listen(1 << 20)
+	hub := createDummy(t, append([]Option{WithGRPC(l)}, options...)...)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return l.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+
+	t.Cleanup(func() { assert.NoError(t, conn.Close()) })
+
+	return hub, mercurepb.NewHubClient(conn)
+}
+
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", bearerPrefix+token)
+}
+
+func TestGRPCPublishSubscribe(t *testing.T) {
+	t.Parallel()
+
+	hub, client := createGRPCClient(t)
+
+	ctx, cancel := context.WithCancel(withToken(t.Context(), createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"})))
+	defer cancel()
+
+	stream, err := client.Subscribe(ctx, &mercurepb.SubscribeRequest{
+		Match:           []string{"https://example.com/books/1"},
+		MatchUrlpattern: []string{"https://example.com/authors/:id"},
+	})
+	require.NoError(t, err)
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+	pubCtx := withToken(t.Context(), createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+	for _, req := range []*mercurepb.PublishRequest{
+		{Topic: "https://example.com/books/2", Data: "not subscribed"},
+		{Topic: "https://example.com/books/1", Data: "private", Private: true, Id: "a"},
+		{Topic: "https://example.com/authors/1", Data: "private not allowed", Private: true},
+		{Topic: "https://example.com/authors/1", Data: "public", Type: "author", Retry: 1000},
+	} {
+		_, err := client.Publish(pubCtx, req)
+		require.NoError(t, err)
+	}
+
+	u, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "a", u.GetId())
+	assert.Equal(t, "https://example.com/books/1", u.GetTopic())
+	assert.Equal(t, "private", u.GetData())
+	assert.True(t, u.GetPrivate())
+
+	u, err = stream.Recv()
+	require.NoError(t, err)
+	assert.NotEmpty(t, u.GetId())
+	assert.Equal(t, "https://example.com/authors/1", u.GetTopic())
+	assert.Equal(t, "public", u.GetData())
+	assert.Equal(t, "author", u.GetType())
+	assert.Equal(t, uint64(1000), u.GetRetry())
+	assert.False(t, u.GetPrivate())
+
+	cancel()
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+}
+
+func TestGRPCPublishResponse(t *testing.T) {
+	t.Parallel()
+
+	_, client := createGRPCClient(t, WithConditionalPublishing(0))
+
+	ctx := withToken(t.Context(), createDummyAuthorizedJWT(rolePublisher, []string{"https://example.com/books/1"}))
+
+	resp, err := client.Publish(ctx, &mercurepb.PublishRequest{Topic: "https://example.com/books/1", Id: "custom"})
+	require.NoError(t, err)
+	assert.Equal(t, "custom", resp.GetId())
+
+	for req, code := range map[*mercurepb.PublishRequest]codes.Code{
+		{}:                                     codes.InvalidArgument,
+		{Topic: "https://example.com/books/2"}: codes.PermissionDenied,
+		{Topic: "https://example.com/books/1", Type: reservedEventType}: codes.InvalidArgument,
+	} {
+		_, err := client.Publish(ctx, req)
+		assert.Equal(t, code, status.Code(err), req.String())
+	}
+}
+
+func TestGRPCUnauthenticated(t *testing.T) {
+	t.Parallel()
+
+	_, client := createGRPCClient(t)
+
+	for name, ctx := range map[string]context.Context{
+		"missing": t.Context(),
+		"invalid": withToken(t.Context(), "invalid"),
+		"role":    withToken(t.Context(), createDummyAuthorizedJWT(roleSubscriber, []string{"*"})),
+	} {
+		_, err := client.Publish(ctx, &mercurepb.PublishRequest{Topic: "https://example.com/books/1"})
+		assert.Equal(t, codes.Unauthenticated, status.Code(err), name)
+	}
+
+	stream, err := client.Subscribe(t.Context(), &mercurepb.SubscribeRequest{Match: []string{"https://example.com/books/1"}})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGRPCAnonymous(t *testing.T) {
+	t.Parallel()
+
+	hub, client := createGRPCClient(t, WithAnonymous())
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	stream, err := client.Subscribe(ctx, &mercurepb.SubscribeRequest{Match: []string{"https://example.com/books/1"}})
+	require.NoError(t, err)
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Private: true, Event: Event{ID: "private"}}))
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "public"}}))
+
+	u, err := stream.Recv()
+	require.NoError(t, err)
+	assert.Equal(t, "public", u.GetId())
+}
+
+func TestGRPCSubscribeInvalidArgument(t *testing.T) {
+	t.Parallel()
+
+	_, client := createGRPCClient(t)
+
+	ctx := withToken(t.Context(), createDummyAuthorizedJWT(roleSubscriber, []string{"*"}))
+
+	for _, req := range []*mercurepb.SubscribeRequest{
+		{},
+		{MatchUrlpattern: []string{"https://example.com/{"}},
+	} {
+		stream, err := client.Subscribe(ctx, req)
+		require.NoError(t, err)
+
+		_, err = stream.Recv()
+		assert.Equal(t, codes.InvalidArgument, status.Code(err), req.String())
+	}
+}
+
+func TestGRPCSubscribeHistory(t *testing.T) {
+	t.Parallel()
+
+	hub, client := createGRPCClient(t, WithTransport(createBoltTransport(t, 0, 0)))
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: id}}))
+	}
+
+	ctx := withToken(t.Context(), createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"}))
+
+	stream, err := client.Subscribe(ctx, &mercurepb.SubscribeRequest{Match: []string{"https://example.com/books/1"}, LastEventId: "1"})
+	require.NoError(t, err)
+
+	for _, id := range []string{"2", "3"} {
+		u, err := stream.Recv()
+		require.NoError(t, err)
+		assert.Equal(t, id, u.GetId())
+	}
+}
+
+func TestGRPCGetSubscriptions(t *testing.T) {
+	t.Parallel()
+
+	hub, client := createGRPCClient(t, WithSubscriptions())
+
+	subCtx, cancel := context.WithCancel(withToken(t.Context(), createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"})))
+	defer cancel()
+
+	_, err := client.Subscribe(subCtx, &mercurepb.SubscribeRequest{Match: []string{"https://example.com/books/1"}})
+	require.NoError(t, err)
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+	ctx := withToken(t.Context(), createDummyAuthorizedJWT(roleSubscriber, []string{subscriptionsURL + "/exact/https%3A%2F%2Fexample.com%2Fbooks%2F1"}))
+
+	resp, err := client.GetSubscriptions(ctx, &mercurepb.GetSubscriptionsRequest{MatchType: "exact", Match: "https://example.com/books/1"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.GetLastEventId())
+	require.Len(t, resp.GetSubscriptions(), 1)
+
+	sub := resp.GetSubscriptions()[0]
+	assert.Equal(t, "https://example.com/books/1", sub.GetMatch())
+	assert.Equal(t, "exact", sub.GetMatchType())
+	assert.Contains(t, sub.GetId(), subscriptionsURL+"/exact/https%3A%2F%2Fexample.com%2Fbooks%2F1/")
+	assert.NotEmpty(t, sub.GetSubscriber())
+
+	var payload map[string]string
+	require.NoError(t, json.Unmarshal(sub.GetPayload(), &payload))
+	assert.Equal(t, map[string]string{"foo": "bar"}, payload)
+
+	_, err = client.GetSubscriptions(ctx, &mercurepb.GetSubscriptionsRequest{})
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.GetSubscriptions(ctx, &mercurepb.GetSubscriptionsRequest{Match: "https://example.com/books/1"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = client.GetSubscriptions(t.Context(), &mercurepb.GetSubscriptionsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestGRPCSubscriptionsDisabled(t *testing.T) {
+	t.Parallel()
+
+	_, client := createGRPCClient(t)
+
+	_, err := client.GetSubscriptions(t.Context(), &mercurepb.GetSubscriptionsRequest{})
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+func TestGRPCSubscribeApproval(t *testing.T) {
+	t.Parallel()
+
+	target := make(chanPublishHookTarget, 1)
+	hub, client := createGRPCClient(t, WithSubscriptionApproval(testSubscriptionApproval(target)))
+
+	stream, err := client.Subscribe(withToken(t.Context(), createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/rooms/1"})), &mercurepb.SubscribeRequest{
+		Match: []string{"https://example.com/rooms/1"},
+	})
+	require.NoError(t, err)
+
+	rejectApprovalRequest(t, hub, target)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestGRPCSubscribeTokenExpired(t *testing.T) {
+	t.Parallel()
+
+	_, client := createGRPCClient(t)
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Header["typ"] = atJWTType
+	token.Claims = &claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testResourceIdentifier},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Second)),
+		},
+		AuthorizationDetails: subscribeDetailsFromMatchers(nil, TopicMatcher{Type: MatcherTypeExact, Pattern: "*"}),
+	}
+
+	signedString, err := token.SignedString([]byte("subscriber"))
+	require.NoError(t, err)
+
+	stream, err := client.Subscribe(withToken(t.Context(), signedString), &mercurepb.SubscribeRequest{
+		Match: []string{"https://example.com/books/1"},
+	})
+	require.NoError(t, err)
+
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, "token expired", status.Convert(err).Message())
+}
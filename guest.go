@@ -0,0 +1,110 @@
+package mercure
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// DefaultGuestCookieName is the default name of the cookie carrying the
+	// guest session ID. Plain-HTTP deployments must configure a prefix-less
+	// name, as for the authorization cookie.
+	DefaultGuestCookieName = "__Secure-mercure_guest"
+	// guestInboxPrefix prefixes the inbox topics of guest sessions (see
+	// addressesInbox).
+	guestInboxPrefix = defaultHubURL + "/guests/"
+	// minGuestIDLength and maxGuestIDLength bound the guest IDs accepted from
+	// cookies: IDs are bearer secrets, a short one could be guessed.
+	minGuestIDLength = 22
+	maxGuestIDLength = 64
+)
+
+// WithGuestSessions assigns a stable, ephemeral ID to anonymous subscribers,
+// stored in a session cookie named cookieName (DefaultGuestCookieName when
+// empty). Every guest is subscribed to its inbox topic (see GuestInboxTopic)
+// and allowed to receive its private updates, so an application can notify a
+// visitor that has no account yet.
+//
+// Guest IDs are secrets: anyone presenting the cookie of a guest receives its
+// inbox. The inbox and the "guest" member of subscriptions only expose the
+// public ID derived from it (see GuestPublicID). Applications served on the
+// same domain as the hub can read the cookie, or set it themselves with an
+// unguessable value, to know the ID of a visitor.
+func WithGuestSessions(cookieName string) Option {
+	return func(o *opt) error {
+		if cookieName == "" {
+			cookieName = DefaultGuestCookieName
+		}
+
+		o.guestCookieName = cookieName
+
+		return nil
+	}
+}
+
+// GuestInboxTopic returns the topic to publish updates for a guest session
+// to, from its public ID (see GuestPublicID). Inbox topics only accept
+// private updates: only the guest is allowed to receive them.
+func GuestInboxTopic(publicID string) string {
+	return guestInboxPrefix + publicID
+}
+
+// GuestPublicID returns the public ID of a guest session: the unpadded
+// base64url encoding of the SHA-256 hash of its ID. Unlike the ID, it can be
+// disclosed, as the ID can't be recovered from it.
+func GuestPublicID(guestID string) string {
+	sum := sha256.Sum256([]byte(guestID))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// validGuestID reports whether a guest ID read from a cookie is long enough
+// and made of URL-safe characters only, as it ends up in a topic.
+func validGuestID(id string) bool {
+	if len(id) < minGuestIDLength || len(id) > maxGuestIDLength {
+		return false
+	}
+
+	for i := range len(id) {
+		c := id[i]
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
+// guestSession returns the guest ID of the request, assigning a new one if it
+// has none.
+func (h *Hub) guestSession(w http.ResponseWriter, r *http.Request) string {
+	if c, err := r.Cookie(h.guestCookieName); err == nil && validGuestID(c.Value) {
+		return c.Value
+	}
+
+	id := strings.ReplaceAll(uuid.Must(uuid.NewV4()).String(), "-", "")
+
+	// A "__Secure-" prefixed name requires the Secure attribute, or user
+	// agents drop the cookie; see Demo for plain-HTTP development.
+	http.SetCookie(w, &http.Cookie{ //nolint:gosec
+		Name:     h.guestCookieName,
+		Value:    id,
+		Path:     "/",
+		Secure:   r.TLS != nil || strings.HasPrefix(h.guestCookieName, "__Secure-"),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return id
+}
+
+// addressesGuestInbox reports whether the topic is the inbox of a guest.
+func addressesGuestInbox(topic string) bool {
+	id, ok := strings.CutPrefix(topic, guestInboxPrefix)
+
+	return ok && validGuestID(id)
+}
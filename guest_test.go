@@ -0,0 +1,115 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuestSessions(t *testing.T) {
+	t.Parallel()
+
+	const guestID = "0123456789abcdefghijklmn"
+
+	hub := createAnonymousDummy(t, WithGuestSessions("mercure_guest"))
+
+	for name, tc := range map[string]struct {
+		cookie   string
+		assigned bool
+	}{
+		"new":     {"", true},
+		"known":   {guestID, false},
+		"invalid": {"short", true},
+	} {
+		ctx, cancel := context.WithCancel(t.Context())
+		w := newSubscribeRecorder()
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1", nil).WithContext(ctx)
+			if tc.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "mercure_guest", Value: tc.cookie})
+			}
+
+			hub.SubscribeHandler(w, req)
+		})
+
+		waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+		_, subscribers, err := hub.transport.(TransportSubscribers).GetSubscribers(t.Context())
+		require.NoError(t, err)
+
+		s := subscribers[0]
+		require.True(t, validGuestID(s.GuestID), name)
+
+		inbox := inboxMatcher(GuestInboxTopic(s.GuestID))
+		assert.Contains(t, s.SubscribedMatchers, inbox, name)
+		assert.Equal(t, []TopicMatcher{inbox}, s.AllowedPrivateMatchers, name)
+		assert.Equal(t, s.GuestID, s.getSubscriptions(subscriptionFilter{}, true)[0].Guest, name)
+
+		if !tc.assigned {
+			j, err := json.Marshal(s.getSubscriptions(subscriptionFilter{}, true))
+			require.NoError(t, err)
+			assert.NotContains(t, string(j), guestID, name)
+		}
+
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: GuestInboxTopic(s.GuestID), Private: true}), name)
+
+		cancel()
+		wg.Wait()
+
+		cookies := (&http.Response{Header: w.Header()}).Cookies()
+		if tc.assigned {
+			require.Len(t, cookies, 1, name)
+			assert.Equal(t, s.GuestID, GuestPublicID(cookies[0].Value), name)
+			assert.NotEqual(t, s.GuestID, cookies[0].Value, name)
+			assert.True(t, cookies[0].HttpOnly, name)
+		} else {
+			assert.Empty(t, cookies, name)
+			assert.Equal(t, GuestPublicID(guestID), s.GuestID, name)
+		}
+	}
+}
+
+func TestGuestSessionsAuthenticated(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithGuestSessions(""))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	w := newSubscribeRecorder()
+
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1", nil).WithContext(ctx)
+		req.Header.Set("Authorization", bearerPrefix+createDummyAuthorizedJWT(roleSubscriber, []string{"*"}))
+
+		hub.SubscribeHandler(w, req)
+	})
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+	_, subscribers, err := hub.transport.(TransportSubscribers).GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, subscribers[0].GuestID)
+
+	cancel()
+	wg.Wait()
+
+	assert.Empty(t, (&http.Response{Header: w.Header()}).Cookies())
+}
+
+func TestGuestInboxTopicValidation(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, (&Update{Topic: GuestInboxTopic("0123456789abcdefghijklmn"), Private: true}).Validate())
+	require.ErrorIs(t, (&Update{Topic: GuestInboxTopic("0123456789abcdefghijklmn")}).Validate(), ErrPublicInboxUpdate)
+	require.ErrorIs(t, (&Update{Topic: GuestInboxTopic("short")}).Validate(), ErrReservedTopic)
+	require.ErrorIs(t, (&Update{Topic: GuestInboxTopic("0123456789abcdefghijklmn/foo")}).Validate(), ErrReservedTopic)
+}
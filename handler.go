@@ -5,6 +5,8 @@ import (
 	"log/slog"
 	"net/http"
 	"slices"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/cors"
@@ -22,6 +24,8 @@ func (h *Hub) initHandler() {
 	router.UseEncodedPath()
 	router.SkipClean(true)
 
+	router.MethodNotAllowedHandler = methodNotAllowedHandler(router)
+
 	csp := "default-src 'self'"
 
 	if h.demo {
@@ -34,26 +38,80 @@ func (h *Hub) initHandler() {
 			panic(err)
 		}
 
-		router.PathPrefix(defaultUIURL).Handler(http.StripPrefix(defaultUIURL, http.FileServer(http.FS(public))))
+		router.PathPrefix(defaultUIURL).Handler(http.StripPrefix(defaultUIURL, http.FileServer(http.FS(public)))).Methods(http.MethodGet, http.MethodHead)
 
 		csp += " mercure.rocks cdn.jsdelivr.net"
 	}
 
 	h.registerSubscriptionHandlers(router)
 
-	if h.subscriberConfigured || h.anonymous {
+	if h.subscriberConfigured || h.anonymous || h.capabilityAEAD != nil {
 		router.HandleFunc(defaultHubURL, h.SubscribeHandler).Methods(http.MethodGet, http.MethodHead, methodQuery)
+
+		if _, ok := h.transport.(TransportHistory); ok {
+			router.HandleFunc(historyURL, h.HistoryHandler).Methods(http.MethodGet, http.MethodHead)
+		}
+
+		if h.webSocket {
+			router.HandleFunc(webSocketURL, h.WebSocketHandler).Methods(http.MethodGet)
+		}
+
+		if h.longPollingTimeout != 0 {
+			router.HandleFunc(pollURL, h.LongPollingHandler).Methods(http.MethodGet)
+		}
+	}
+
+	if h.subscriberConfigured && h.capabilityAEAD != nil {
+		router.HandleFunc(capabilitiesURL, h.CapabilitiesHandler).Methods(http.MethodPost)
 	}
 
 	if h.publisherConfigured {
-		router.HandleFunc(defaultHubURL, h.PublishHandler).Methods(http.MethodPost)
+		router.HandleFunc(defaultHubURL, h.withResponseHeaders(EndpointPublish, h.PublishHandler)).Methods(http.MethodPost)
+
+		if _, ok := h.transport.(TransportGroupDispatcher); ok {
+			router.HandleFunc(publishGroupURL, h.withResponseHeaders(EndpointPublish, h.PublishGroupHandler)).Methods(http.MethodPost)
+		}
+
+		if _, ok := h.transport.(TransportRetracter); ok {
+			router.HandleFunc(retractURL, h.withResponseHeaders(EndpointPublish, h.RetractHandler)).Methods(http.MethodPost)
+		}
+
+		if h.subscriptionApproval != nil {
+			router.HandleFunc(approvalsURL, h.withResponseHeaders(EndpointPublish, h.ApprovalsHandler)).Methods(http.MethodPost)
+		}
+
+		if h.blobStore != nil {
+			router.HandleFunc(attachmentURL, h.AttachmentHandler).Methods(http.MethodGet, http.MethodHead)
+		}
+	}
+
+	if h.federation != nil {
+		router.HandleFunc(federationHandshakeURL, h.FederationHandshakeHandler).Methods(http.MethodPost)
+		router.HandleFunc(federationPublishURL, h.FederationPublishHandler).Methods(http.MethodPost)
+		router.HandleFunc(federationInterestURL, h.FederationInterestHandler).Methods(http.MethodGet)
+	}
+
+	if h.s3Notifications != nil {
+		router.HandleFunc(s3NotificationsURL, h.S3NotificationsHandler).Methods(http.MethodPost)
+	}
+
+	if h.broadcastScript != nil {
+		router.HandleFunc(broadcastScriptURL, h.BroadcastScriptHandler).Methods(http.MethodGet, http.MethodHead)
+	}
+
+	if h.discovery {
+		router.HandleFunc(discoveryURL, h.DiscoveryHandler).Methods(http.MethodGet, http.MethodHead)
 	}
 
 	// Advertise OAuth 2.0 protected resource metadata (RFC 9728) only when the
 	// hub validates access tokens; a pure-anonymous hub is not a protected
 	// resource.
 	if h.publisherConfigured || h.subscriberConfigured {
-		router.HandleFunc(protectedResourceMetadataPath, h.ProtectedResourceMetadataHandler).Methods(http.MethodGet, http.MethodHead)
+		router.HandleFunc(protectedResourceMetadataPath, h.withResponseHeaders(EndpointResourceMetadata, h.ProtectedResourceMetadataHandler)).Methods(http.MethodGet, http.MethodHead)
+
+		if h.debug {
+			router.HandleFunc(tokenDebuggerURL, h.TokenDebuggerHandler).Methods(http.MethodPost)
+		}
 	}
 
 	secureMiddleware := secure.New(secure.Options{
@@ -66,6 +124,9 @@ func (h *Hub) initHandler() {
 	})
 
 	h.handler = secureMiddleware.Handler(h.corsHandler(router))
+	if h.queryTokenMaxLifetime != 0 {
+		h.handler = h.queryTokenHandler(h.handler)
+	}
 }
 
 // corsHandler wraps the router with CORS when origins are configured,
@@ -85,15 +146,80 @@ func (h *Hub) corsHandler(router http.Handler) http.Handler {
 	return cors.New(cors.Options{
 		AllowedOrigins:   h.corsOrigins,
 		AllowCredentials: allowCredentials,
-		AllowedMethods:   []string{http.MethodGet, http.MethodHead, http.MethodPost, methodQuery},
-		AllowedHeaders:   []string{authorizationHeader, "cache-control", "last-event-id"},
+		AllowedMethods:   allowableMethods,
+		AllowedHeaders:   []string{authorizationHeader, "cache-control", "last-event-id", "if-none-match"},
 		// Exposed so cross-origin subscribers can read the subscription API's
-		// rel="mercure" Link header, which carries the last-event-id cursor.
-		ExposedHeaders: []string{"Link"},
+		// rel="mercure" Link header, which carries the last-event-id cursor,
+		// its ETag, and the Mercure-Last-Event-ID of the streams.
+		ExposedHeaders: []string{"Link", "ETag", "Mercure-Last-Event-Id"},
+		MaxAge:         corsMaxAge(h.corsMaxAge),
 		Debug:          h.debug,
 	}).Handler(router)
 }
 
+// corsMaxAge converts the max age of preflight responses to the seconds
+// expected by rs/cors, where a negative value sends a 0 max age.
+func corsMaxAge(maxAge time.Duration) int {
+	if maxAge < 0 {
+		return -1
+	}
+
+	return int((maxAge + time.Second - 1) / time.Second)
+}
+
+// allowableMethods are the methods an endpoint may allow, in the order of the
+// Allow header. OPTIONS is always allowed.
+//
+//nolint:gochecknoglobals
+var allowableMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, methodQuery}
+
+// allow returns the value of the Allow header of the resource targeted by r,
+// or an empty string if the resource doesn't exist.
+func allow(router *mux.Router, r *http.Request) string {
+	var methods []string
+
+	for _, m := range allowableMethods {
+		req := r.Clone(r.Context())
+		req.Method = m
+
+		var match mux.RouteMatch
+		if router.Match(req, &match) && match.MatchErr == nil {
+			methods = append(methods, m)
+		}
+	}
+
+	if len(methods) == 0 {
+		return ""
+	}
+
+	return strings.Join(append(methods, http.MethodOptions), ", ")
+}
+
+// methodNotAllowedHandler answers the requests to an endpoint not supporting
+// their method. OPTIONS requests, except for CORS preflights, get a 204 and
+// the others a 405, both with the methods supported by the endpoint in an
+// Allow header (RFC 9110, sections 9.3.7 and 15.5.6).
+func methodNotAllowedHandler(router *mux.Router) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		a := allow(router, r)
+		if a == "" {
+			http.NotFound(w, r)
+
+			return
+		}
+
+		w.Header().Set("Allow", a)
+
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+
+			return
+		}
+
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
 func (h *Hub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.handler.ServeHTTP(w, r)
 }
@@ -115,7 +241,7 @@ func (h *Hub) registerSubscriptionHandlers(r *mux.Router) {
 	r.SkipClean(true)
 
 	// 3-segment route (more specific, registered first).
-	r.HandleFunc(subscriptionMatchURL, h.SubscriptionHandler).Methods(http.MethodGet)
+	r.HandleFunc(subscriptionMatchURL, h.withResponseHeaders(EndpointSubscriptions, h.SubscriptionHandler)).Methods(http.MethodGet, http.MethodHead)
 
 	// The collection route /subscriptions/{match_type}/{match} and the
 	// deprecated /subscriptions/{topic}/{subscriber} route have the same
@@ -125,8 +251,8 @@ func (h *Hub) registerSubscriptionHandlers(r *mux.Router) {
 	// deprecated registration guards the modern route with a MatcherFunc and
 	// adds the v8 routes.
 	if !h.registerDeprecatedSubscriptionHandlers(r) {
-		r.HandleFunc(subscriptionsForMatchURL, h.SubscriptionsHandler).Methods(http.MethodGet)
+		r.HandleFunc(subscriptionsForMatchURL, h.withResponseHeaders(EndpointSubscriptions, h.SubscriptionsHandler)).Methods(http.MethodGet, http.MethodHead)
 	}
 
-	r.HandleFunc(subscriptionsURL, h.SubscriptionsHandler).Methods(http.MethodGet)
+	r.HandleFunc(subscriptionsURL, h.withResponseHeaders(EndpointSubscriptions, h.SubscriptionsHandler)).Methods(http.MethodGet, http.MethodHead)
 }
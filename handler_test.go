@@ -0,0 +1,129 @@
+package mercure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptions(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithSubscriptions(), WithDemo())
+
+	for path, allow := range map[string]string{
+		defaultHubURL:                     "GET, HEAD, POST, QUERY, OPTIONS",
+		defaultHubURL + subscriptionsPath: "GET, HEAD, OPTIONS",
+		defaultHubURL + subscriptionsPath + "/topic/https%3A%2F%2Fexample.com%2Fbooks%2F1": "GET, HEAD, OPTIONS",
+		defaultDemoURL + "books/1.jsonld":                                                  "GET, HEAD, OPTIONS",
+		"/.well-known/oauth-protected-resource/.well-known/mercure":                        "GET, HEAD, OPTIONS",
+	} {
+		w := httptest.NewRecorder()
+		hub.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, path, nil))
+
+		assert.Equal(t, http.StatusNoContent, w.Code, path)
+		assert.Equal(t, allow, w.Header().Get("Allow"), path)
+	}
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, httptest.NewRequest(http.MethodOptions, "/not-found", nil))
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, w.Header().Get("Allow"))
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithSubscriptions())
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, httptest.NewRequest(http.MethodPost, defaultHubURL+subscriptionsPath, nil))
+
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "GET, HEAD, OPTIONS", w.Header().Get("Allow"))
+}
+
+func TestSubscriptionsHeadMethod(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithSubscriptions())
+
+	req := httptest.NewRequest(http.MethodHead, defaultHubURL+subscriptionsPath, nil)
+	req.Header.Set("Authorization", bearerPrefix+createDummyAuthorizedJWT(roleSubscriber, []string{"/.well-known/mercure/subscriptions"}))
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Link"), `rel="mercure"`)
+	assert.NotEmpty(t, w.Header()["ETag"])
+}
+
+func TestCORSPreflight(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		maxAge   time.Duration
+		expected string
+	}{
+		"default":  {0, ""},
+		"seconds":  {10 * time.Minute, "600"},
+		"rounded":  {1500 * time.Millisecond, "2"},
+		"disabled": {-1, "0"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			hub := createDummy(t, WithSubscriptions(), WithCORSOrigins([]string{"https://example.com"}), WithCORSMaxAge(tc.maxAge))
+
+			for _, path := range []string{defaultHubURL, defaultHubURL + subscriptionsPath} {
+				req := httptest.NewRequest(http.MethodOptions, path, nil)
+				req.Header.Set("Origin", "https://example.com")
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+				req.Header.Set("Access-Control-Request-Headers", "authorization,if-none-match")
+
+				w := httptest.NewRecorder()
+				hub.ServeHTTP(w, req)
+
+				resp := w.Result()
+				require.NoError(t, resp.Body.Close())
+
+				assert.Equal(t, http.StatusNoContent, resp.StatusCode, path)
+				assert.Equal(t, "https://example.com", resp.Header.Get("Access-Control-Allow-Origin"), path)
+				assert.Equal(t, "authorization,if-none-match", resp.Header.Get("Access-Control-Allow-Headers"), path)
+				assert.Equal(t, tc.expected, resp.Header.Get("Access-Control-Max-Age"), path)
+			}
+		})
+	}
+}
+
+func TestCORSExposedHeaders(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithSubscriptions(), WithCORSOrigins([]string{"https://example.com"}))
+
+	req := httptest.NewRequest(http.MethodHead, defaultHubURL+"?match=https://example.com/books/1", nil)
+	req.Header.Set("Origin", "https://example.com")
+	req.Header.Set("Authorization", bearerPrefix+createDummyAuthorizedJWT(roleSubscriber, []string{"*"}))
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "Link, Etag, Mercure-Last-Event-Id", w.Header().Get("Access-Control-Expose-Headers"))
+
+	// Plain OPTIONS requests aren't preflights.
+	req = httptest.NewRequest(http.MethodOptions, defaultHubURL, nil)
+	req.Header.Set("Origin", "https://example.com")
+
+	w = httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "GET, HEAD, POST, QUERY, OPTIONS", w.Header().Get("Allow"))
+}
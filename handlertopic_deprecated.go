@@ -26,12 +26,12 @@ func (h *Hub) registerDeprecatedSubscriptionHandlers(r *mux.Router) bool {
 		return false
 	}
 
-	r.HandleFunc(subscriptionsForMatchURL, h.SubscriptionsHandler).
-		Methods(http.MethodGet).
+	r.HandleFunc(subscriptionsForMatchURL, h.withResponseHeaders(EndpointSubscriptions, h.SubscriptionsHandler)).
+		Methods(http.MethodGet, http.MethodHead).
 		MatcherFunc(h.isKnownMatchType)
 
-	r.HandleFunc(subscriptionURL, h.SubscriptionHandler).Methods(http.MethodGet)
-	r.HandleFunc(subscriptionsForTopicURL, h.SubscriptionsHandler).Methods(http.MethodGet)
+	r.HandleFunc(subscriptionURL, h.withResponseHeaders(EndpointSubscriptions, h.SubscriptionHandler)).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc(subscriptionsForTopicURL, h.withResponseHeaders(EndpointSubscriptions, h.SubscriptionsHandler)).Methods(http.MethodGet, http.MethodHead)
 
 	return true
 }
@@ -64,5 +64,5 @@ func (h *Hub) isKnownMatchType(r *http.Request, _ *mux.RouteMatch) bool {
 		return false
 	}
 
-	return knownMatcherType(MatcherType(mt))
+	return h.topicMatcherStore.supportsMatcherType(MatcherType(mt))
 }
@@ -0,0 +1,211 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"time"
+)
+
+const (
+	// healthTopicPrefix prefixes the topics of the health samples, followed
+	// by the escaped name of the node.
+	healthTopicPrefix = defaultHubURL + "/health/"
+
+	// DefaultHealthTopicInterval is the default interval of the health
+	// samples.
+	DefaultHealthTopicInterval = 10 * time.Second
+
+	// healthCheckTimeout bounds the readiness and liveness checks of the
+	// transport.
+	healthCheckTimeout = 5 * time.Second
+)
+
+// ErrInvalidHealthTopic is returned by WithHealthTopic for an invalid
+// configuration.
+var ErrInvalidHealthTopic = errors.New("invalid health topic configuration")
+
+// HealthTopic configures the health samples the hub publishes about itself.
+type HealthTopic struct {
+	// Interval is the time between two samples, DefaultHealthTopicInterval
+	// when 0.
+	Interval time.Duration
+	// Node identifies the hub among the nodes of the cluster, its host name
+	// when empty.
+	Node string
+}
+
+// HealthSample is the data of the updates published by WithHealthTopic.
+type HealthSample struct {
+	Node      string    `json:"node"`
+	SampledAt time.Time `json:"sampled_at"`
+	// Lag is the time, in seconds, the previous sample took to go through
+	// the transport and back to the node, nil if it hasn't come back before
+	// this sample.
+	Lag *float64 `json:"lag"`
+	// Ready and Live are the results of the checks of the transport, true
+	// for the transports not implementing TransportHealthChecker. Ready is
+	// false until the self-check succeeds, see WithSelfCheck.
+	Ready bool `json:"ready"`
+	Live  bool `json:"live"`
+}
+
+// WithHealthTopic makes every node publish health samples (see HealthSample)
+// on its own topic, /.well-known/mercure/health/{node}, so monitoring agents
+// can subscribe to them like to any other topic, without a metrics stack.
+// The samples are private updates having the mercure type, like subscription
+// events: the token of the agents must grant subscribing to
+// /.well-known/mercure/health/{node}.
+//
+// The lag is measured by subscribing the node to its own topic: it is the
+// delay of the transport, the one of the publications between the nodes of
+// a cluster.
+func WithHealthTopic(c HealthTopic) Option {
+	return func(o *opt) error {
+		if c.Interval < 0 {
+			return ErrInvalidHealthTopic
+		}
+
+		if c.Interval == 0 {
+			c.Interval = DefaultHealthTopicInterval
+		}
+
+		if c.Node == "" {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return fmt.Errorf("%w: unable to get the host name: %w", ErrInvalidHealthTopic, err)
+			}
+
+			c.Node = hostname
+		}
+
+		o.healthTopic = &c
+
+		return nil
+	}
+}
+
+// HealthTopicURL returns the topic of the health samples of the node.
+func HealthTopicURL(node string) string {
+	return healthTopicPrefix + url.PathEscape(node)
+}
+
+// startHealthTopic publishes the health samples periodically, until the
+// context of the hub is done.
+func (h *Hub) startHealthTopic() {
+	if h.healthTopic == nil {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(h.healthTopic.Interval)
+		defer ticker.Stop()
+
+		var (
+			// samples are the samples of the node coming back through the
+			// transport, nil until subscribed.
+			samples    <-chan *Update
+			lastSample time.Time
+			// sentAt is when the last sample has been dispatched, with a
+			// monotonic clock reading.
+			sentAt time.Time
+			lag    *float64
+		)
+
+		for {
+			if samples == nil {
+				samples = h.subscribeHealthTopic()
+			}
+
+			select {
+			case <-h.ctx.Done():
+				return
+			case u, ok := <-samples:
+				if !ok {
+					// Subscribed again with the next sample.
+					samples = nil
+
+					continue
+				}
+
+				var sample HealthSample
+				if err := json.Unmarshal([]byte(u.Data), &sample); err == nil && sample.SampledAt.Equal(lastSample) {
+					l := time.Since(sentAt).Seconds()
+					lag = &l
+				}
+			case <-ticker.C:
+				sample := h.healthSample(lag)
+				lastSample, sentAt, lag = sample.SampledAt, time.Now(), nil
+
+				h.dispatchHealthSample(sample)
+			}
+		}
+	}()
+}
+
+// subscribeHealthTopic subscribes the node to its own samples. It returns nil
+// on failure.
+func (h *Hub) subscribeHealthTopic() <-chan *Update {
+	matchers := []TopicMatcher{{Type: MatcherTypeExact, Pattern: HealthTopicURL(h.healthTopic.Node)}}
+
+	samples, err := h.Subscribe(h.ctx, matchers, matchers)
+	if err != nil {
+		if h.logger.Enabled(h.ctx, slog.LevelError) {
+			h.logger.LogAttrs(h.ctx, slog.LevelError, "Unable to subscribe to the health topic", slog.Any("error", err))
+		}
+
+		return nil
+	}
+
+	return samples
+}
+
+// healthSample samples the health of the node, lag being the one of the
+// previous sample.
+func (h *Hub) healthSample(lag *float64) HealthSample {
+	sample := HealthSample{
+		Node:      h.healthTopic.Node,
+		SampledAt: time.Now().UTC(),
+		Lag:       lag,
+		Ready:     h.SelfCheckResult() == nil,
+		Live:      true,
+	}
+
+	if checker, ok := h.transport.(TransportHealthChecker); ok {
+		ctx, cancel := context.WithTimeout(h.ctx, healthCheckTimeout)
+		defer cancel()
+
+		sample.Ready = sample.Ready && checker.Ready(ctx) == nil
+		sample.Live = checker.Live(ctx) == nil
+	}
+
+	return sample
+}
+
+func (h *Hub) dispatchHealthSample(sample HealthSample) {
+	j, err := json.Marshal(sample)
+	if err != nil {
+		panic(err)
+	}
+
+	// Dispatched directly, like the subscription events: the topic belongs
+	// to the reserved namespace, and the type is the reserved one.
+	u := &Update{
+		Topic:   HealthTopicURL(sample.Node),
+		Private: true,
+		Debug:   h.debug,
+		Event:   Event{Data: string(j), Type: reservedEventType},
+	}
+
+	if err := h.transport.Dispatch(h.ctx, u); err != nil {
+		if h.logger.Enabled(h.ctx, slog.LevelError) {
+			h.logger.LogAttrs(h.ctx, slog.LevelError, "Failed to dispatch health sample", slog.Any("error", err))
+		}
+
+		h.recordDispatchError(err)
+	}
+}
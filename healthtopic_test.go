@@ -0,0 +1,66 @@
+package mercure
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthTopic(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithHealthTopic(HealthTopic{Interval: 10 * time.Millisecond, Node: "node 1"}))
+	assert.Equal(t, "/.well-known/mercure/health/node%201", HealthTopicURL("node 1"))
+
+	matchers := []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "/.well-known/mercure/health/:node"}}
+
+	updates, err := hub.Subscribe(t.Context(), matchers, matchers)
+	require.NoError(t, err)
+
+	timeout := time.After(5 * time.Second)
+
+	for {
+		var u *Update
+
+		select {
+		case u = <-updates:
+		case <-timeout:
+			require.FailNow(t, "no health sample measuring the lag")
+		}
+
+		assert.Equal(t, HealthTopicURL("node 1"), u.Topic)
+		assert.True(t, u.Private)
+		assert.Equal(t, reservedEventType, u.Type)
+
+		var sample HealthSample
+		require.NoError(t, json.Unmarshal([]byte(u.Data), &sample))
+		assert.Equal(t, "node 1", sample.Node)
+		assert.WithinDuration(t, time.Now(), sample.SampledAt, time.Second)
+		assert.True(t, sample.Ready)
+		assert.True(t, sample.Live)
+
+		if sample.Lag != nil {
+			assert.GreaterOrEqual(t, *sample.Lag, 0.0)
+
+			return
+		}
+	}
+}
+
+func TestWithHealthTopic(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithHealthTopic(HealthTopic{}))
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	assert.Equal(t, &HealthTopic{Interval: DefaultHealthTopicInterval, Node: hostname}, hub.healthTopic)
+
+	_, err = NewHub(t.Context(), WithHealthTopic(HealthTopic{Interval: -time.Second}))
+	require.ErrorIs(t, err, ErrInvalidHealthTopic)
+}
@@ -0,0 +1,314 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/text/language"
+)
+
+const (
+	// historyURL is the endpoint fetching the updates missed by a subscriber.
+	historyURL = defaultHubURL + "/history"
+
+	// paramLimit is the history query parameter holding the maximum number
+	// of updates returned.
+	paramLimit = "limit"
+
+	defaultHistoryLimit = 100
+	maxHistoryLimit     = 1000
+)
+
+// ErrHistoryNotSupported is returned by FetchSince when the transport does not
+// implement TransportHistory.
+var ErrHistoryNotSupported = errors.New("the transport does not support fetching the history")
+
+// historyUpdate is the representation of an update in a history page.
+type historyUpdate struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type,omitempty"`
+	Topics   []string `json:"topics"`
+	Data     string   `json:"data"`
+	Private  bool     `json:"private,omitempty"`
+	Sequence uint64   `json:"sequence,omitempty"`
+}
+
+// historyPage is a page of the history, in the format of the subscription
+// API. The next page is fetched passing last_event_id back.
+type historyPage struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Updates     []historyUpdate `json:"updates"`
+	LastEventID string          `json:"last_event_id"`
+	Next        string          `json:"next,omitempty"`
+}
+
+// FetchSince returns, oldest first, up to limit updates published after the
+// one with the ID lastEventID that the subscriber can receive, and whether
+// the limit has been reached, more updates being possibly available.
+//
+// The transport must implement TransportHistory, otherwise
+// ErrHistoryNotSupported is returned. ErrUpdateNotFound is returned if
+// lastEventID is not in the history anymore.
+func (h *Hub) FetchSince(ctx context.Context, s *Subscriber, lastEventID string, limit int) ([]*Update, bool, error) {
+	th, ok := h.transport.(TransportHistory)
+	if !ok {
+		return nil, false, ErrHistoryNotSupported
+	}
+
+	topics := exactTopics(s.SubscribedMatchers)
+
+	var updates []*Update
+
+	now := time.Now()
+
+	// The private updates the subscriber can't receive are skipped without
+	// disclosing their IDs: the hub fetches the next pages itself.
+	for {
+		page, err := th.FetchSince(ctx, lastEventID, topics, limit)
+		if err != nil {
+			return nil, false, err //nolint:wrapcheck
+		}
+
+		for _, u := range page {
+			if !s.Match(u) || u.expired(now) {
+				continue
+			}
+
+			updates = append(updates, u)
+			if len(updates) == limit {
+				return updates, true, nil
+			}
+		}
+
+		if len(page) < limit {
+			return updates, false, nil
+		}
+
+		lastEventID = page[len(page)-1].ID
+	}
+}
+
+// exactTopics returns the topics the transport can filter the history on: the
+// patterns of the matchers when they are all exact, nil otherwise.
+func exactTopics(matchers []TopicMatcher) []string {
+	topics := make([]string, 0, len(matchers))
+
+	for _, m := range matchers {
+		if m.Type != MatcherTypeExact || m.Pattern == "*" {
+			return nil
+		}
+
+		topics = append(topics, m.Pattern)
+	}
+
+	return topics
+}
+
+// HistoryHandler serves the updates published after the one given by the
+// last_event_id query parameter (or the Last-Event-ID header), since the
+// beginning of the history when not set, matching the selectors of the
+// subscribe endpoint, without opening an SSE connection.
+//
+// Up to the limit query parameter updates are returned, 100 by default and
+// 1000 at most. The response holds the ID of the last update of the page, to
+// pass back as last_event_id, and the URL of the next page when the limit is
+// reached. A 404 status code is returned when last_event_id is not in the
+// history anymore: the state must be fetched again.
+//
+// Authorization is the one of the subscribe endpoint: private updates are
+// only returned to subscribers allowed to receive them, and the requests
+// requiring approval (see WithSubscriptionApproval) wait for it.
+//
+// The pages have an ETag, and a Last-Modified date when the transport
+// implements TransportHistoryVersion, for the clients and the caches to
+// revalidate them with conditional requests: the history isn't even fetched
+// when the transport tells it didn't change.
+func (h *Hub) HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "mercure.history", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	values := r.URL.Query()
+
+	limit, err := parseHistoryLimit(values)
+	if err != nil {
+		http.Error(w, `Invalid "`+paramLimit+`" parameter`, http.StatusBadRequest)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	var claims *claims
+
+	if h.subscriberConfigured || h.capabilityAEAD != nil {
+		claims, err = h.authorizeSubscriber(r, values)
+		if err != nil || (claims == nil && !h.anonymous) {
+			h.writeAuthError(w, r, err)
+
+			if err != nil {
+				recordSpanError(span, err)
+			}
+
+			return
+		}
+	}
+
+	matchers, err := h.parseMatchers(values, h.isBackwardCompatiblyEnabledWith(8))
+	if err != nil {
+		h.writeMatcherParamError(ctx, w, err)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	if claims, err = h.authorizeSubscription(ctx, h.httpCaller(r), claims, matchers); err != nil {
+		h.writeAuthorizationError(w, r, err)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	var privateMatchers []TopicMatcher
+	if claims != nil {
+		privateMatchers = claims.authz.subscribeMatchers()
+	}
+
+	s := NewSubscriber(h.logger, h.topicMatcherStore)
+	s.ID = "urn:uuid:" + uuid.Must(uuid.NewV4()).String()
+	s.Claims = claims
+	s.setMatchers(matchers, privateMatchers)
+
+	if err := h.awaitApproval(ctx, s); err != nil {
+		writeApprovalError(w, err)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	lastEventID, _ := h.retrieveLastEventID(ctx, r, values)
+
+	lastEventID, err = h.parseLastEventID(lastEventID)
+	if err != nil {
+		http.Error(w, `Invalid "Last-Event-ID"`, http.StatusBadRequest)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	if lastEventID == "" {
+		lastEventID = EarliestLastEventID
+	}
+
+	languages := subscriberLanguages(claims, r)
+
+	validator := h.newHistoryValidator(ctx, r, lastEventID, privateMatchers, languages)
+	if etag, ok := validator.notModified(r, time.Now()); ok {
+		setHistoryCacheHeaders(w.Header(), etag, claims != nil)
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	updates, more, err := h.FetchSince(ctx, s, lastEventID, limit)
+	if err != nil {
+		writeHistoryError(w, err)
+		recordSpanError(span, err)
+
+		if !errors.Is(err, ErrUpdateNotFound) && h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Error fetching the history", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	page := h.newHistoryPage(r, updates, lastEventID, languages)
+	if more {
+		values.Set("last_event_id", page.LastEventID)
+		values.Set(paramLimit, strconv.Itoa(limit))
+		page.Next = r.URL.EscapedPath() + "?" + values.Encode()
+	}
+
+	j, err := json.MarshalIndent(page, "", "  ")
+	if err != nil {
+		// Can't happen
+		panic(err)
+	}
+
+	etag := validator.etag(updates, j)
+	setHistoryCacheHeaders(w.Header(), etag, claims != nil)
+
+	if modified, ok := validator.lastModified(etag); ok {
+		w.Header()["Last-Modified"] = []string{modified.UTC().Format(http.TimeFormat)}
+	}
+
+	if matchesETag(r, etag) {
+		w.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	w.Header()["Content-Type"] = subscriptionContentType
+
+	if _, err := w.Write(j); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write history response", slog.Any("error", err))
+	}
+}
+
+// parseHistoryLimit returns the limit query parameter, defaulting to
+// defaultHistoryLimit.
+func parseHistoryLimit(values url.Values) (int, error) {
+	v := values.Get(paramLimit)
+	if v == "" {
+		return defaultHistoryLimit, nil
+	}
+
+	limit, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	if limit <= 0 || limit > maxHistoryLimit {
+		return 0, strconv.ErrRange
+	}
+
+	return limit, nil
+}
+
+// newHistoryPage builds the page of the updates, with the variants of their
+// data matching the languages of the subscriber.
+func (h *Hub) newHistoryPage(r *http.Request, updates []*Update, lastEventID string, languages []language.Tag) historyPage {
+	page := historyPage{
+		ID:          r.URL.EscapedPath(),
+		Type:        "history",
+		Updates:     make([]historyUpdate, 0, len(updates)),
+		LastEventID: lastEventID,
+	}
+
+	for _, u := range updates {
+		page.Updates = append(page.Updates, newHistoryUpdate(u, languages))
+		page.LastEventID = h.advanceEventID(page.LastEventID, u)
+	}
+
+	return page
+}
+
+// newHistoryUpdate returns the representation of the update, with the variant
+// of its data matching the languages of the subscriber.
+func newHistoryUpdate(u *Update, languages []language.Tag) historyUpdate {
+	return historyUpdate{
+		ID:       u.ID,
+		Type:     u.Type,
+		Topics:   u.topics(),
+		Data:     u.DataFor(languages),
+		Private:  u.Private,
+		Sequence: u.Sequence,
+	}
+}
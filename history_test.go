@@ -0,0 +1,132 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// historyRequest fetches a page of the history, and returns the status code
+// and the decoded page.
+func historyRequest(t *testing.T, hub *Hub, token string, query url.Values) (int, historyPage) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, historyURL+"?"+query.Encode(), nil)
+	if token != "" {
+		req.Header.Set("Authorization", bearerPrefix+token)
+	}
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	var page historyPage
+	if w.Code == http.StatusOK {
+		assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	}
+
+	return w.Code, page
+}
+
+func TestHistoryHandler(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTransport(createBoltTransport(t, 0, 0)))
+
+	for _, u := range []*Update{
+		{Topic: "https://example.com/books/1", Event: Event{ID: "1", Data: "a"}},
+		{Topic: "https://example.com/books/1", Private: true, Event: Event{ID: "2"}},
+		{Topic: "https://example.com/books/2", Event: Event{ID: "3"}},
+		{Topic: "https://example.com/authors/1", Event: Event{ID: "4"}},
+		{Topic: "https://example.com/books/1", Event: Event{ID: "5", Type: "book"}},
+	} {
+		require.NoError(t, hub.Publish(t.Context(), u))
+	}
+
+	token := createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/authors/1"})
+
+	// The private update is skipped without disclosing its ID.
+	status, page := historyRequest(t, hub, token, url.Values{"match_urlpattern": {"https://example.com/books/*"}, "limit": {"2"}})
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []historyUpdate{
+		{ID: "1", Topics: []string{"https://example.com/books/1"}, Data: "a"},
+		{ID: "3", Topics: []string{"https://example.com/books/2"}},
+	}, page.Updates)
+	assert.Equal(t, "3", page.LastEventID)
+	require.NotEmpty(t, page.Next)
+
+	next, err := url.Parse(page.Next)
+	require.NoError(t, err)
+	assert.Equal(t, historyURL, next.Path)
+
+	status, page = historyRequest(t, hub, token, next.Query())
+	require.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []historyUpdate{{ID: "5", Type: "book", Topics: []string{"https://example.com/books/1"}}}, page.Updates)
+	assert.Equal(t, "5", page.LastEventID)
+	assert.Empty(t, page.Next)
+
+	// Nothing new: the cursor is kept.
+	status, page = historyRequest(t, hub, token, url.Values{"match": {"https://example.com/books/1"}, "last_event_id": {"5"}})
+	require.Equal(t, http.StatusOK, status)
+	assert.Empty(t, page.Updates)
+	assert.Equal(t, "5", page.LastEventID)
+
+	// Authorized to receive the private update.
+	status, page = historyRequest(t, hub, createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"}), url.Values{"match": {"https://example.com/books/1"}, "last_event_id": {"1"}})
+	require.Equal(t, http.StatusOK, status)
+	require.Len(t, page.Updates, 2)
+	assert.Equal(t, historyUpdate{ID: "2", Topics: []string{"https://example.com/books/1"}, Private: true}, page.Updates[0])
+
+	status, _ = historyRequest(t, hub, token, url.Values{"match": {"*"}, "last_event_id": {"unknown"}})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	status, _ = historyRequest(t, hub, token, url.Values{"match": {"*"}, "limit": {"0"}})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = historyRequest(t, hub, token, url.Values{})
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	status, _ = historyRequest(t, hub, "", url.Values{"match": {"*"}})
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestHistoryHandlerLocalizedData(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithTransport(createBoltTransport(t, 0, 0)))
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{
+		Topic:         "https://example.com/books/1",
+		Event:         Event{ID: "1", Data: "Dune"},
+		LocalizedData: map[string]string{"fr": "Dune, le livre"},
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, historyURL+"?match=*", nil)
+	req.Header.Set("Accept-Language", "fr-FR")
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var page historyPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Updates, 1)
+	assert.Equal(t, "Dune, le livre", page.Updates[0].Data)
+}
+
+func TestHistoryNotSupported(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithTransport(&addSubscriberErrorTransport{}))
+
+	_, _, err := hub.FetchSince(t.Context(), NewSubscriber(hub.logger, hub.topicMatcherStore), EarliestLastEventID, 10)
+	require.ErrorIs(t, err, ErrHistoryNotSupported)
+
+	status, _ := historyRequest(t, hub, "", url.Values{"match": {"*"}})
+	assert.Equal(t, http.StatusNotFound, status)
+}
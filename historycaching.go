@@ -0,0 +1,179 @@
+package mercure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/text/language"
+)
+
+// TransportHistoryVersion may be implemented by transports telling cheaply
+// whether their history changed, for the history endpoint to answer the
+// conditional requests without fetching the history.
+type TransportHistoryVersion interface {
+	// HistoryVersion returns an opaque version, changing every time the
+	// result of FetchSince may change, and the time of the last change. An
+	// empty version is returned when it can't be told, for instance because
+	// the updates expire with time.
+	HistoryVersion(ctx context.Context) (string, time.Time, error)
+}
+
+// historyVary lists the request headers the history pages depend on, in
+// addition to the URL.
+var historyVary = []string{"Authorization, Cookie, Accept-Language, Last-Event-ID"}
+
+// historyValidator computes the validators (RFC 9110) of a history page.
+type historyValidator struct {
+	// key identifies the request and the version of the history, empty when
+	// the transport can't tell the version.
+	key      string
+	modified time.Time
+}
+
+// newHistoryValidator returns the validator of the page requested by r, the
+// last event ID, the private matchers and the languages of the subscriber
+// being resolved.
+func (h *Hub) newHistoryValidator(ctx context.Context, r *http.Request, lastEventID string, privateMatchers []TopicMatcher, languages []language.Tag) historyValidator {
+	tv, ok := h.transport.(TransportHistoryVersion)
+	if !ok {
+		return historyValidator{}
+	}
+
+	version, modified, err := tv.HistoryVersion(ctx)
+	if err != nil {
+		if h.logger.Enabled(ctx, slog.LevelInfo) {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to get the history version", slog.Any("error", err))
+		}
+
+		return historyValidator{}
+	}
+
+	if version == "" {
+		return historyValidator{}
+	}
+
+	parts := []string{version, r.URL.EscapedPath(), r.URL.RawQuery, lastEventID}
+	for _, m := range privateMatchers {
+		parts = append(parts, string(m.Type), m.Pattern)
+	}
+
+	for _, l := range languages {
+		parts = append(parts, l.String())
+	}
+
+	return historyValidator{key: hashValidator(strings.Join(parts, "\x00")), modified: modified}
+}
+
+// etag returns the entity tag of the page. Without version, it is the hash of
+// the body. Otherwise, it is the key of the validator, followed by the time
+// the first update of the page expires at, if any, for the tag not to match
+// anymore once the page changed without the history having been written to.
+func (v historyValidator) etag(updates []*Update, body []byte) string {
+	if v.key == "" {
+		return `"` + hashValidator(string(body)) + `"`
+	}
+
+	var deadline time.Time
+
+	for _, u := range updates {
+		if !u.Expires.IsZero() && (deadline.IsZero() || u.Expires.Before(deadline)) {
+			deadline = u.Expires
+		}
+	}
+
+	if deadline.IsZero() {
+		return `"` + v.key + `"`
+	}
+
+	return `"` + v.key + "." + strconv.FormatInt(deadline.Unix(), 10) + `"`
+}
+
+// lastModified returns the time the history changed at, if the page can be
+// revalidated with it: without version, or when an update of the page
+// expires, the page changes with time.
+func (v historyValidator) lastModified(etag string) (time.Time, bool) {
+	if v.key == "" || v.modified.IsZero() || strings.Contains(etag, ".") {
+		return time.Time{}, false
+	}
+
+	return v.modified, true
+}
+
+// notModified reports whether the conditional request r can be answered
+// without fetching the page, and returns the matching entity tag.
+func (v historyValidator) notModified(r *http.Request, now time.Time) (string, bool) {
+	if v.key == "" {
+		return "", false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for tag := range strings.SplitSeq(inm, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" {
+				return `"` + v.key + `"`, true
+			}
+
+			key, deadline, expiring := strings.Cut(strings.Trim(tag, `"`), ".")
+			if key != v.key {
+				continue
+			}
+
+			if !expiring {
+				return `"` + v.key + `"`, true
+			}
+
+			if d, err := strconv.ParseInt(deadline, 10, 64); err == nil && now.Unix() < d {
+				return tag, true
+			}
+		}
+
+		// If-Modified-Since is ignored when If-None-Match is set.
+		return "", false
+	}
+
+	// Last-Modified is only sent for the pages not expiring: the tag is then
+	// the key.
+	if ims, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !v.modified.IsZero() && !v.modified.Truncate(time.Second).After(ims) {
+		return `"` + v.key + `"`, true
+	}
+
+	return "", false
+}
+
+// matchesETag reports whether the If-None-Match header of r holds etag.
+func matchesETag(r *http.Request, etag string) bool {
+	for tag := range strings.SplitSeq(r.Header.Get("If-None-Match"), ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setHistoryCacheHeaders sets the headers telling the caches to revalidate
+// the pages, only storing them in the cache of the client when the request is
+// authorized.
+func setHistoryCacheHeaders(header http.Header, etag string, authorized bool) {
+	header["Etag"] = []string{etag}
+	header["Vary"] = historyVary
+
+	if authorized {
+		header["Cache-Control"] = []string{"private, no-cache"}
+	} else {
+		header["Cache-Control"] = []string{"no-cache"}
+	}
+}
+
+func hashValidator(s string) string {
+	sum := sha256.Sum256([]byte(s))
+
+	return base64.RawURLEncoding.EncodeToString(sum[:18])
+}
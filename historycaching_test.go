@@ -0,0 +1,124 @@
+package mercure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conditionalHistoryRequest fetches the whole history with the given request
+// headers.
+func conditionalHistoryRequest(hub *Hub, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, historyURL+"?match=*", nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestHistoryHandlerConditionalRequests(t *testing.T) {
+	t.Parallel()
+
+	// Last-Modified has a precision of a second: the clock is advanced for the
+	// next update to change it.
+	synctest.Test(t, func(t *testing.T) {
+		hub := createAnonymousDummy(t, WithTransport(createBoltTransport(t, 0, 0)))
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "1"}}))
+
+		w := conditionalHistoryRequest(hub, nil)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		etag := w.Header().Get("ETag")
+		lastModified := w.Header().Get("Last-Modified")
+
+		assert.NotEmpty(t, etag)
+		assert.NotEmpty(t, lastModified)
+		assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+		assert.Equal(t, "Authorization, Cookie, Accept-Language, Last-Event-ID", w.Header().Get("Vary"))
+
+		w = conditionalHistoryRequest(hub, http.Header{"If-None-Match": {`"other", ` + etag}})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+		assert.Equal(t, etag, w.Header().Get("ETag"))
+		assert.Empty(t, w.Body.String())
+
+		w = conditionalHistoryRequest(hub, http.Header{"If-Modified-Since": {lastModified}})
+		assert.Equal(t, http.StatusNotModified, w.Code)
+
+		// If-Modified-Since is ignored when If-None-Match is set.
+		w = conditionalHistoryRequest(hub, http.Header{"If-None-Match": {`"other"`}, "If-Modified-Since": {lastModified}})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		// Another subscriber gets another tag.
+		w = conditionalHistoryRequest(hub, http.Header{"If-None-Match": {etag}, "Last-Event-Id": {"1"}})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		time.Sleep(time.Second)
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "2"}}))
+
+		w = conditionalHistoryRequest(hub, http.Header{"If-None-Match": {etag}})
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.NotEqual(t, etag, w.Header().Get("ETag"))
+		assert.Contains(t, w.Body.String(), `"id": "2"`)
+
+		w = conditionalHistoryRequest(hub, http.Header{"If-Modified-Since": {lastModified}})
+		assert.Equal(t, http.StatusOK, w.Code)
+
+	})
+}
+
+func TestHistoryHandlerConditionalRequestsExpiringUpdates(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithTransport(createBoltTransport(t, 0, 0)))
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/typing", Event: Event{ID: "1"}, Expires: time.Now().Add(time.Hour)}))
+
+	w := conditionalHistoryRequest(hub, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// The page changes once the update expired: it can't be revalidated with
+	// its date.
+	etag := w.Header().Get("ETag")
+	assert.Contains(t, etag, ".")
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+
+	w = conditionalHistoryRequest(hub, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	key, _, _ := strings.Cut(etag, ".")
+	w = conditionalHistoryRequest(hub, http.Header{"If-None-Match": {key + "." + strconv.FormatInt(time.Now().Unix()-1, 10) + `"`}})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestHistoryHandlerConditionalRequestsWithoutVersion(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	transport.eventTTL = time.Hour
+
+	hub := createAnonymousDummy(t, WithTransport(transport))
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "1"}}))
+
+	w := conditionalHistoryRequest(hub, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	etag := w.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	assert.Empty(t, w.Header().Get("Last-Modified"))
+
+	w = conditionalHistoryRequest(hub, http.Header{"If-None-Match": {etag}})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+
+	w = conditionalHistoryRequest(hub, http.Header{"If-None-Match": {`W/"other"`}})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
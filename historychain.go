@@ -0,0 +1,58 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrHistoryTampered is returned when the hash chain of the history
+	// doesn't match its content.
+	ErrHistoryTampered = errors.New("the history has been tampered with")
+	// ErrHistoryChainNotSupported is returned by Hub.VerifyHistoryChain when
+	// the transport doesn't implement TransportHistoryChainVerifier.
+	ErrHistoryChainNotSupported = errors.New("the transport doesn't support hash-chained history")
+)
+
+// HistoryChainReport is the outcome of the verification of a hash-chained
+// history.
+type HistoryChainReport struct {
+	// Verified is the number of updates whose content matches the chain.
+	Verified int `json:"verified"`
+	// Retracted is the number of chained updates replaced by the tombstone of
+	// a retraction or a purge, whose content can't be verified anymore.
+	Retracted int `json:"retracted"`
+	// Removed is the number of chained updates removed from the history by
+	// its cleanup (size limit, retention policies, compaction or TTL), whose
+	// hash is still in the chain.
+	Removed int `json:"removed"`
+	// Unchained is the number of updates stored before the chain was
+	// enabled.
+	Unchained int `json:"unchained"`
+	// Head is the hexadecimal SHA-256 hash ending the chain, covering all the
+	// chained updates. Auditors record it to detect a rewrite of the chain
+	// itself, or the removal of its most recent updates.
+	Head string `json:"head,omitempty"`
+	// HeadEventID is the ID of the update ending the chain.
+	HeadEventID string `json:"head_event_id,omitempty"`
+}
+
+// TransportHistoryChainVerifier may be implemented by transports
+// hash-chaining the updates they store.
+type TransportHistoryChainVerifier interface {
+	// VerifyHistoryChain checks the history against its hash chain. An
+	// error wrapping ErrHistoryTampered is returned on mismatch.
+	VerifyHistoryChain(ctx context.Context) (*HistoryChainReport, error)
+}
+
+// VerifyHistoryChain checks that the history stored by the transport hasn't
+// been tampered with, see BoltTransport.EnableHashChain.
+// Authorization is the caller's responsibility.
+func (h *Hub) VerifyHistoryChain(ctx context.Context) (*HistoryChainReport, error) {
+	v, ok := h.transport.(TransportHistoryChainVerifier)
+	if !ok {
+		return nil, ErrHistoryChainNotSupported
+	}
+
+	return v.VerifyHistoryChain(ctx) //nolint:wrapcheck
+}
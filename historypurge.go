@@ -0,0 +1,231 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+// historyPurgeConfirmationTimeout is how long a prepared purge of the history
+// can be confirmed.
+const historyPurgeConfirmationTimeout = 5 * time.Minute
+
+var (
+	// ErrHistoryPurgeNotSupported is returned by PrepareHistoryPurge when the
+	// transport does not implement TransportHistoryPurger.
+	ErrHistoryPurgeNotSupported = errors.New("the transport does not support purging the history")
+	// ErrInvalidHistoryPurgeSelector is returned by PrepareHistoryPurge when
+	// the selector has no criterion, to not purge everything by mistake, or
+	// has an invalid matcher.
+	ErrInvalidHistoryPurgeSelector = errors.New("invalid history purge selector")
+	// ErrHistoryPurgeNotFound is returned by ConfirmHistoryPurge when the
+	// purge has not been prepared, has already been confirmed or canceled, or
+	// has expired.
+	ErrHistoryPurgeNotFound = errors.New("history purge not found")
+)
+
+// HistoryPurgeSelector selects the updates of the history to purge. An update
+// is selected when it matches all the non-zero criteria.
+type HistoryPurgeSelector struct {
+	// Matchers selects the updates having a topic matched by one of them.
+	Matchers []TopicMatcher
+	// Before selects the updates published before this date. Only the
+	// updates with a hub-generated ID can be dated: the others never match.
+	Before time.Time
+}
+
+// Match reports whether the update is selected, its topics being matched with
+// the topic matcher store.
+func (sel *HistoryPurgeSelector) Match(tms *TopicMatcherStore, u *Update) bool {
+	if len(sel.Matchers) != 0 && !tms.matchesAny(u.topics(), sel.Matchers) {
+		return false
+	}
+
+	if sel.Before.IsZero() {
+		return true
+	}
+
+	published, ok := updateTime(u.ID)
+
+	return ok && published.Before(sel.Before)
+}
+
+func (sel *HistoryPurgeSelector) LogValue() slog.Value {
+	attrs := make([]slog.Attr, 0, 2)
+
+	if len(sel.Matchers) != 0 {
+		attrs = append(attrs, slog.Any("matchers", sel.Matchers))
+	}
+
+	if !sel.Before.IsZero() {
+		attrs = append(attrs, slog.Time("before", sel.Before))
+	}
+
+	return slog.GroupValue(attrs...)
+}
+
+// TransportHistoryPurger may be implemented by transports keeping a history,
+// to purge it while running.
+type TransportHistoryPurger interface {
+	// PurgeHistory replaces the updates of the history matching the selector
+	// with tombstones, in a single transaction, and returns their count, or
+	// only counts them when dryRun is true. Transports shared by several hubs
+	// purge the history of all of them.
+	PurgeHistory(ctx context.Context, sel *HistoryPurgeSelector, dryRun bool) (int, error)
+}
+
+// HistoryPurge is a purge of the history prepared by PrepareHistoryPurge,
+// waiting for its confirmation.
+type HistoryPurge struct {
+	// ID identifies the purge, to confirm or cancel it.
+	ID string `json:"id"`
+	// Updates is the number of updates the selector matched when the purge
+	// was prepared. The updates published since then are purged too when
+	// they match.
+	Updates int `json:"updates"`
+	// Expires is the date the purge can't be confirmed anymore after.
+	Expires time.Time `json:"expires"`
+
+	selector HistoryPurgeSelector
+}
+
+// historyPurges holds the prepared purges of the history of a hub.
+type historyPurges struct {
+	sync.Mutex
+
+	pending map[string]*HistoryPurge
+}
+
+// PrepareHistoryPurge starts the purge of the updates of the history matching
+// the selector: their number is returned, and nothing is purged until
+// ConfirmHistoryPurge is called with the ID of the purge, within 5 minutes.
+// Operators can so check what a purge will do before doing it.
+//
+// The transport must implement TransportHistoryPurger, otherwise
+// ErrHistoryPurgeNotSupported is returned. Authorization is the caller's
+// responsibility.
+func (h *Hub) PrepareHistoryPurge(ctx context.Context, sel HistoryPurgeSelector) (*HistoryPurge, error) {
+	if len(sel.Matchers) == 0 && sel.Before.IsZero() {
+		return nil, fmt.Errorf("%w: no criterion", ErrInvalidHistoryPurgeSelector)
+	}
+
+	for _, m := range sel.Matchers {
+		if err := validateProtocolMatcher(h.topicMatcherStore, m); err != nil {
+			return nil, fmt.Errorf("%w: %q: %w", ErrInvalidHistoryPurgeSelector, m.Pattern, err)
+		}
+	}
+
+	tr, ok := h.transport.(TransportHistoryPurger)
+	if !ok {
+		return nil, ErrHistoryPurgeNotSupported
+	}
+
+	n, err := tr.PurgeHistory(ctx, &sel, true)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	p := &HistoryPurge{
+		ID:       "urn:uuid:" + uuid.Must(uuid.NewV4()).String(),
+		Updates:  n,
+		Expires:  time.Now().Add(historyPurgeConfirmationTimeout),
+		selector: sel,
+	}
+
+	h.historyPurges.Lock()
+	if h.historyPurges.pending == nil {
+		h.historyPurges.pending = make(map[string]*HistoryPurge)
+	}
+
+	for id, pending := range h.historyPurges.pending {
+		if time.Now().After(pending.Expires) {
+			delete(h.historyPurges.pending, id)
+		}
+	}
+
+	h.historyPurges.pending[p.ID] = p
+	h.historyPurges.Unlock()
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "History purge prepared", slog.String("id", p.ID), slog.Any("selector", &p.selector), slog.Int("count", n))
+	}
+
+	return p, nil
+}
+
+// ConfirmHistoryPurge purges the updates of the history matching the selector
+// of a prepared purge, and returns their count. Like retracted updates, the
+// purged ones are replaced with tombstones, so subscribers reconnecting with
+// their ID resume from the right position. The retained values of the hub
+// matching the selector are forgotten too.
+//
+// A purge can only be confirmed once, ErrHistoryPurgeNotFound is returned
+// afterwards, when it has been canceled, and when it has expired.
+func (h *Hub) ConfirmHistoryPurge(ctx context.Context, id string) (int, error) {
+	p, ok := h.takeHistoryPurge(id)
+	if !ok {
+		return 0, ErrHistoryPurgeNotFound
+	}
+
+	n, err := h.transport.(TransportHistoryPurger).PurgeHistory(ctx, &p.selector, false)
+	if err != nil {
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to purge history", slog.String("id", id), slog.Any("selector", &p.selector), slog.Any("error", err))
+		}
+
+		h.recordDispatchError(err)
+
+		return 0, err //nolint:wrapcheck
+	}
+
+	h.forgetPurged(&p.selector)
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "History purged", slog.String("id", id), slog.Any("selector", &p.selector), slog.Int("count", n))
+	}
+
+	return n, nil
+}
+
+// CancelHistoryPurge cancels a prepared purge, and reports whether it was
+// pending.
+func (h *Hub) CancelHistoryPurge(id string) bool {
+	_, ok := h.takeHistoryPurge(id)
+
+	return ok
+}
+
+// takeHistoryPurge removes the prepared purge from the pending ones, and
+// returns it unless it has expired.
+func (h *Hub) takeHistoryPurge(id string) (*HistoryPurge, bool) {
+	h.historyPurges.Lock()
+	defer h.historyPurges.Unlock()
+
+	p, ok := h.historyPurges.pending[id]
+	if !ok {
+		return nil, false
+	}
+
+	delete(h.historyPurges.pending, id)
+
+	return p, time.Now().Before(p.Expires)
+}
+
+// forgetPurged forgets the retained values matching the selector.
+func (h *Hub) forgetPurged(sel *HistoryPurgeSelector) {
+	s := h.retained
+	if s == nil {
+		return
+	}
+
+	for _, u := range s.values.All() {
+		if sel.Match(h.topicMatcherStore, u) {
+			h.forget(u)
+		}
+	}
+}
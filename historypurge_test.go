@@ -0,0 +1,109 @@
+package mercure
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrepareHistoryPurgeInvalid(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	_, err := hub.PrepareHistoryPurge(t.Context(), HistoryPurgeSelector{})
+	require.ErrorIs(t, err, ErrInvalidHistoryPurgeSelector)
+
+	_, err = hub.PrepareHistoryPurge(t.Context(), HistoryPurgeSelector{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/{"}}})
+	require.ErrorIs(t, err, ErrInvalidHistoryPurgeSelector)
+
+	_, err = hub.PrepareHistoryPurge(t.Context(), HistoryPurgeSelector{Before: time.Now()})
+	require.ErrorIs(t, err, ErrHistoryPurgeNotSupported)
+
+	_, err = hub.ConfirmHistoryPurge(t.Context(), "urn:uuid:unknown")
+	assert.ErrorIs(t, err, ErrHistoryPurgeNotFound)
+}
+
+func TestHistoryPurge(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+	hub := createDummy(t, WithTransport(transport))
+
+	for _, u := range []*Update{
+		{Topic: "https://example.com/users/1", Event: Event{ID: "a"}},
+		{Topic: "https://example.com/books/1", Event: Event{ID: "b"}},
+		{Topic: "https://example.com/users/2", Event: Event{ID: "c"}},
+		{Topic: "https://example.com/books/2", Event: Event{ID: "d"}},
+	} {
+		require.NoError(t, hub.Publish(t.Context(), u))
+	}
+
+	sel := HistoryPurgeSelector{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/users/:id"}}}
+
+	p, err := hub.PrepareHistoryPurge(t.Context(), sel)
+	require.NoError(t, err)
+	assert.Equal(t, 2, p.Updates)
+
+	// Nothing is purged until the purge is confirmed.
+	ids, tombstones := historyIDs(t, transport)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, ids)
+	assert.Zero(t, tombstones)
+
+	assert.True(t, hub.CancelHistoryPurge(p.ID))
+	_, err = hub.ConfirmHistoryPurge(t.Context(), p.ID)
+	require.ErrorIs(t, err, ErrHistoryPurgeNotFound)
+
+	p, err = hub.PrepareHistoryPurge(t.Context(), sel)
+	require.NoError(t, err)
+
+	n, err := hub.ConfirmHistoryPurge(t.Context(), p.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	ids, tombstones = historyIDs(t, transport)
+	assert.Equal(t, []string{"b", "d"}, ids)
+	assert.Equal(t, 2, tombstones)
+
+	// A subscriber reconnecting with the ID of a purged update resumes after it.
+	updates, err := transport.FetchSince(t.Context(), "a", nil, 10)
+	require.NoError(t, err)
+	require.Len(t, updates, 2)
+	assert.Equal(t, "b", updates[0].ID)
+
+	_, err = hub.ConfirmHistoryPurge(t.Context(), p.ID)
+	assert.ErrorIs(t, err, ErrHistoryPurgeNotFound)
+}
+
+func TestHistoryPurgeExpired(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTransport(createBoltTransport(t, 0, 0)))
+
+	p, err := hub.PrepareHistoryPurge(t.Context(), HistoryPurgeSelector{Before: time.Now()})
+	require.NoError(t, err)
+
+	hub.historyPurges.pending[p.ID].Expires = time.Now().Add(-time.Second)
+
+	_, err = hub.ConfirmHistoryPurge(t.Context(), p.ID)
+	assert.ErrorIs(t, err, ErrHistoryPurgeNotFound)
+}
+
+func TestHistoryPurgeSelectorMatch(t *testing.T) {
+	t.Parallel()
+
+	tms := &TopicMatcherStore{}
+	u := &Update{Topic: "https://example.com/books/1"}
+	u.AssignUUID()
+
+	assert.True(t, (&HistoryPurgeSelector{Before: time.Now().Add(time.Minute)}).Match(tms, u))
+	assert.False(t, (&HistoryPurgeSelector{Before: time.Now().Add(-time.Minute)}).Match(tms, u))
+	assert.True(t, (&HistoryPurgeSelector{Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: u.Topic}}}).Match(tms, u))
+	assert.False(t, (&HistoryPurgeSelector{
+		Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: u.Topic}},
+		Before:   time.Now().Add(-time.Minute),
+	}).Match(tms, u))
+	assert.False(t, (&HistoryPurgeSelector{Before: time.Now()}).Match(tms, &Update{Event: Event{ID: "custom"}}))
+}
@@ -4,15 +4,18 @@ package mercure
 
 import (
 	"context"
+	"crypto/cipher"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
 )
 
 const (
@@ -51,6 +54,10 @@ var ErrDuplicateIssuer = errors.New("duplicate issuer identifier")
 // role, so no token could ever be verified for it.
 var ErrIssuerMissingKey = errors.New("an issuer must configure a publisher or subscriber verifier")
 
+// ErrInvalidSubscriberShards is returned by WithSubscriberShards when the
+// number of shards is lower than 1.
+var ErrInvalidSubscriberShards = errors.New("the number of subscriber shards must be at least 1")
+
 // ErrMissingAlgorithm is returned when a Static verifier is configured without
 // a signing algorithm.
 var ErrMissingAlgorithm = errors.New("a Static verifier requires a signing algorithm")
@@ -114,6 +121,16 @@ func WithMetrics(m Metrics) Option {
 	}
 }
 
+// WithSubscriberCallbacks registers lifecycle callbacks called for every
+// subscriber of the hub, connected through HTTP or Hub.Subscribe.
+func WithSubscriberCallbacks(c SubscriberCallbacks) Option {
+	return func(o *opt) error {
+		o.subscriberCallbacks = c
+
+		return nil
+	}
+}
+
 // WithSubscriptions allows to dispatch updates when subscriptions are created or terminated.
 func WithSubscriptions() Option {
 	return func(o *opt) error {
@@ -180,7 +197,9 @@ func WithMaxRequestBodySize(size int64) Option {
 // Each Issuer provides a Publisher and/or Subscriber Verifier (a nil Verifier
 // means that role is not accepted for the issuer). Setting AuthorizationServer
 // advertises the issuer in the hub's RFC 9728 protected resource metadata; a
-// self-issued issuer (a key shared out of band) leaves it false.
+// self-issued issuer (a key shared out of band) leaves it false. Audiences and
+// ClaimNamespace let hubs shared by several applications accept the tokens of
+// identity providers with their own audience names and claim conventions.
 func WithIssuers(issuers []Issuer) Option {
 	return func(o *opt) error {
 		if o.issuers == nil {
@@ -200,7 +219,7 @@ func WithIssuers(issuers []Issuer) Option {
 					return err
 				}
 
-				iv.publisher = roleVerifier{keyfunc: kf, algorithms: algs}
+				iv.publisher = roleVerifier{keyfunc: kf, algorithms: algs, audiences: iss.Audiences, claimNamespace: iss.ClaimNamespace}
 				o.publisherConfigured = true
 			}
 
@@ -210,7 +229,7 @@ func WithIssuers(issuers []Issuer) Option {
 					return err
 				}
 
-				iv.subscriber = roleVerifier{keyfunc: kf, algorithms: algs}
+				iv.subscriber = roleVerifier{keyfunc: kf, algorithms: algs, audiences: iss.Audiences, claimNamespace: iss.ClaimNamespace}
 				o.subscriberConfigured = true
 			}
 
@@ -307,6 +326,18 @@ func WithCORSOrigins(origins []string) Option {
 	}
 }
 
+// WithCORSMaxAge sets how long browsers may cache the responses to CORS
+// preflight requests, in the Access-Control-Max-Age header. Rounded up to
+// the second. When 0, the default, the header isn't sent and browsers cache
+// them for 5 seconds; a negative value disables the caching.
+func WithCORSMaxAge(maxAge time.Duration) Option {
+	return func(o *opt) error {
+		o.corsMaxAge = maxAge
+
+		return nil
+	}
+}
+
 // WithTransport sets the transport to use.
 func WithTransport(t Transport) Option {
 	return func(o *opt) error {
@@ -325,6 +356,24 @@ func WithTopicMatcherStore(tms *TopicMatcherStore) Option {
 	}
 }
 
+// WithSubscriberShards splits the subscribers of the transport in n shards,
+// each with its own lock, cache and matching worker, to spread the matching of
+// the updates over several CPUs on hubs having a very large number of
+// subscribers. Subscribers are assigned to shards by consistent hashing of
+// their ID, so changing n only moves a fraction of them. The transport must
+// implement TransportSubscriberSharder; it is ignored otherwise.
+func WithSubscriberShards(n int) Option {
+	return func(o *opt) error {
+		if n < 1 {
+			return ErrInvalidSubscriberShards
+		}
+
+		o.subscriberShards = n
+
+		return nil
+	}
+}
+
 // WithCookieName sets the name of the authorization cookie (defaults to
 // "__Secure-mercure_access_token"). The default "__Secure-" prefix makes user
 // agents refuse the cookie over insecure transport; plain-HTTP deployments
@@ -391,6 +440,12 @@ func WithResourceIdentifier(resourceIdentifier string) Option {
 type opt struct {
 	transport                    Transport
 	topicMatcherStore            *TopicMatcherStore
+	topicMatcherPersistence      *TopicMatcherPersistence
+	regexpTopicMatchers          bool
+	queryTokenMaxLifetime        time.Duration
+	deliveryReceipts             bool
+	idempotencyWindow            time.Duration
+	subscriberShards             int
 	anonymous                    bool
 	debug                        bool
 	subscriptions                bool
@@ -410,18 +465,84 @@ type opt struct {
 	publishOrigins               []string
 	publishWOrigins              []wildcard
 	corsOrigins                  []string
+	corsMaxAge                   time.Duration
 	cookieName                   string
 	protocolVersionCompatibility int
 	publicURL                    string
 	resourceIdentifier           string
 	resourceMetadataURL          string
 	authorizationServers         []string
+	alertRules                   []AlertRule
+	alertNotifiers               []AlertNotifier
+	alerter                      *alerter
+	responseHeaderRules          []ResponseHeaderRule
+	publishHooks                 []PublishHook
+	publishHookWorkers           []*publishHookWorker
+	enrichers                    []Enricher
+	jsonPatch                    *jsonPatchStore
+	retained                     *retainedStore
+	retentionExemptions          *RetentionExemptions
+	topicSequences               bool
+	historyPurges                historyPurges
+	publishRates                 publishRates
+	bandwidth                    *bandwidth
+	lastEventIDs                 *lastEventIDs
+	idleTopics                   *idleTopics
+	healthTopic                  *HealthTopic
+	selfCheck                    *selfCheck
+	topicCardinality             *topicCardinality
+	tenancy                      *tenancy
+	deadLetters                  *deadLetters
+	pollingConnectors            []PollingConnector
+	fileWatchers                 []FileWatcher
+	s3Notifications              *S3Notifications
+	sidecarListener              net.Listener
+	sidecarToken                 string
+	grpcListener                 net.Listener
+	grpcServerOptions            []grpc.ServerOption
+	cdnFanOut                    bool
+	cdnEdgeTTL                   time.Duration
+	blobStore                    BlobStore
+	attachmentSigningKey         []byte
+	attachmentURLTTL             time.Duration
+	capabilityAEAD               cipher.AEAD
+	capabilityMaxTTL             time.Duration
+	guestCookieName              string
+	userInboxes                  bool
+	subscriberCallbacks          SubscriberCallbacks
+	subscriberBufferSize         int
+	overflowPolicy               OverflowPolicy
+	dispatchWatermark            int
+	dispatchQueues               *DispatchQueues
+	profile                      *ProfileSettings
+	disconnectEvents             bool
+	disconnectRetry              time.Duration
+	subscriberStats              bool
+	maxReplayAge                 time.Duration
+	routingRules                 []RoutingRule
+	compiledRoutingRules         []*routingRule
+	subscriptionApproval         *subscriptionApprover
+	federation                   *federation
+	lameDuck                     *lameDuck
+	webSocket                    bool
+	webSocketPublishing          bool
+	hubURL                       string
+	hubLink                      string
+	discovery                    bool
+	broadcastScript              *BroadcastScript
+	resumes                      *resumes
+	introspector                 *tokenIntrospector
+	authorizationWebhook         *authorizationWebhook
+	longPollingTimeout           time.Duration
 }
 
 // roleVerifier holds the verification material for one role of one issuer.
 type roleVerifier struct {
 	keyfunc    jwt.Keyfunc
 	algorithms []string
+	// audiences and claimNamespace are the ones of the issuer, see Issuer.
+	audiences      []string
+	claimNamespace string
 }
 
 // issuerVerifier binds an issuer to its per-role verification material. A role
@@ -446,6 +567,10 @@ func (o *opt) configureIdentifiers() error {
 		return err
 	}
 
+	if o.regexpTopicMatchers {
+		o.topicMatcherStore.enableRegexps()
+	}
+
 	if o.resourceIdentifier == "" {
 		o.resourceIdentifier = o.publicURL
 	}
@@ -531,6 +656,10 @@ func NewHub(ctx context.Context, options ...Option) (*Hub, error) {
 		opt.logger = slog.New(mercureHandler{slog.Default().Handler()})
 	}
 
+	if err := opt.applyProfile(); err != nil {
+		return nil, err
+	}
+
 	if opt.topicMatcherStore == nil {
 		tms, err := NewTopicMatcherStore(DefaultTopicMatcherStoreCacheSize)
 		if err != nil {
@@ -544,35 +673,133 @@ func NewHub(ctx context.Context, options ...Option) (*Hub, error) {
 		return nil, err
 	}
 
+	if err := opt.validateResponseHeaderRules(); err != nil {
+		return nil, err
+	}
+
+	if err := opt.validatePublishHooks(); err != nil {
+		return nil, err
+	}
+
+	if err := opt.validateEnrichers(); err != nil {
+		return nil, err
+	}
+
+	if err := opt.validateJSONPatchDeltas(); err != nil {
+		return nil, err
+	}
+
+	if err := opt.validateRetainedValues(); err != nil {
+		return nil, err
+	}
+
+	if err := opt.compileRoutingRules(); err != nil {
+		return nil, err
+	}
+
+	if err := opt.validateSubscriptionApproval(); err != nil {
+		return nil, err
+	}
+
+	if err := opt.validateFederation(); err != nil {
+		return nil, err
+	}
+
 	if opt.transport == nil {
-		opt.transport = NewLocalTransport(NewSubscriberList(DefaultSubscriberListCacheSize))
+		opt.transport = NewLocalTransport(NewSubscriberList(0))
+	}
+
+	if err := opt.validateDeliveryReceipts(); err != nil {
+		return nil, err
+	}
+
+	if err := opt.validateIdempotentPublishing(); err != nil {
+		return nil, err
 	}
 
 	if ttss, ok := opt.transport.(TransportTopicMatcherStore); ok {
 		ttss.SetTopicMatcherStore(opt.topicMatcherStore)
 	}
 
+	if err := opt.configureRetentionExemptions(); err != nil {
+		return nil, err
+	}
+
+	if err := opt.configureTopicSequences(); err != nil {
+		return nil, err
+	}
+
+	if opt.subscriberShards > 0 {
+		if tss, ok := opt.transport.(TransportSubscriberSharder); ok {
+			tss.SetSubscriberShards(opt.subscriberShards)
+		}
+	}
+
 	if opt.metrics == nil {
 		opt.metrics = NopMetrics{}
 	}
 
+	if tm, ok := opt.transport.(TransportMetrics); ok {
+		tm.SetMetrics(opt.metrics)
+	}
+
+	if tm, ok := opt.metrics.(TopicMatcherStoreMetrics); ok {
+		tm.ObserveTopicMatcherStore(opt.topicMatcherStore)
+	}
+
 	if opt.cookieName == "" {
 		opt.cookieName = defaultCookieName
 	}
 
+	if opt.hubLink == "" {
+		opt.hubURL = defaultHubURL
+		opt.hubLink = defaultHubLink
+	}
+
+	opt.alerter = newAlerter(ctx, opt.logger, opt.alertRules, opt.alertNotifiers)
+	opt.publishHookWorkers = startPublishHooks(ctx, opt.logger, opt.publishHooks)
+	opt.startRoutingRules(ctx)
+	opt.startSubscriptionApproval(ctx)
+	opt.startDeadLetters(ctx)
+	opt.observeSubscriberBufferOverflows()
+	opt.startDispatchQueues(ctx)
+
 	h := &Hub{opt: opt, ctx: ctx}
 	h.initHandler()
+	h.startPollingConnectors()
+	h.startFileWatchers()
+	h.startSidecar()
+	h.startGRPC()
+	h.startIdleTopics()
+	h.startHealthTopic()
+	h.startSelfCheck()
+	h.startTopicMatcherPersistence()
+	h.startAttachmentPruning()
 
 	return h, nil
 }
 
-// Stop stops the hub.
+// Stop stops the hub: it saves the topic matchers when
+// WithTopicMatcherPersistence is set, closes the transport, once the in-flight
+// updates are dispatched, and disconnects the subscribers. The requests
+// received after, or during, the call get a 503 Service Unavailable response,
+// or are redirected to the peer hub configured with WithLameDuck. Stop can be
+// called several times.
+//
+// All the steps are run even when one of them fails, the returned error
+// joining the errors of all the failed steps.
 func (h *Hub) Stop(ctx context.Context) error {
+	var errs []error
+
+	if err := h.saveTopicMatchers(ctx); err != nil {
+		errs = append(errs, err)
+	}
+
 	if err := h.transport.Close(ctx); err != nil {
-		return fmt.Errorf("transport error: %w", err)
+		errs = append(errs, fmt.Errorf("transport error: %w", err))
 	}
 
-	return nil
+	return errors.Join(errs...)
 }
 
 // limitRequestBody bounds the request body per WithMaxRequestBodySize; the
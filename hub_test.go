@@ -2,6 +2,7 @@ package mercure
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -100,6 +101,43 @@ func TestStop(t *testing.T) {
 	})
 }
 
+var (
+	errTestTransportClose = errors.New("close failure")
+	errTestPersister      = errors.New("persister failure")
+)
+
+type closeErrorTransport struct {
+	*LocalTransport
+}
+
+func (t *closeErrorTransport) Close(ctx context.Context) error {
+	return errors.Join(t.LocalTransport.Close(ctx), errTestTransportClose)
+}
+
+type saveErrorTopicMatcherPersister struct{}
+
+func (saveErrorTopicMatcherPersister) LoadTopicMatchers(_ context.Context) ([]TopicMatcher, error) {
+	return nil, nil
+}
+
+func (saveErrorTopicMatcherPersister) SaveTopicMatchers(_ context.Context, _ []TopicMatcher) error {
+	return errTestPersister
+}
+
+func TestStopJoinsErrors(t *testing.T) {
+	t.Parallel()
+
+	hub, err := NewHub(t.Context(),
+		WithTransport(&closeErrorTransport{NewLocalTransport(NewSubscriberList(0))}),
+		WithTopicMatcherPersistence(TopicMatcherPersistence{Persister: saveErrorTopicMatcherPersister{}}),
+	)
+	require.NoError(t, err)
+
+	err = hub.Stop(t.Context())
+	require.ErrorIs(t, err, errTestTransportClose)
+	require.ErrorIs(t, err, errTestPersister)
+}
+
 func TestContextCancellation(t *testing.T) {
 	t.Parallel()
 
@@ -362,6 +400,22 @@ func TestSecurityHeaders(t *testing.T) {
 	require.NoError(t, resp3.Body.Close())
 }
 
+func TestWithSubscriberShards(t *testing.T) {
+	t.Parallel()
+
+	tr := NewLocalTransport(NewSubscriberList(0))
+
+	_, err := NewHub(t.Context(), WithAnonymous(), WithTransport(tr), WithSubscriberShards(0))
+	require.ErrorIs(t, err, ErrInvalidSubscriberShards)
+
+	_, err = NewHub(t.Context(), WithAnonymous(), WithTransport(tr), WithSubscriberShards(4))
+	require.NoError(t, err)
+	assert.Equal(t, 4, tr.subscribers.Shards())
+
+	require.NoError(t, tr.Close(t.Context()))
+	assert.Equal(t, 1, tr.subscribers.Shards())
+}
+
 func TestWithPublishDisabled(t *testing.T) {
 	t.Parallel()
 
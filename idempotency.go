@@ -0,0 +1,203 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultIdempotencyWindow is the default time during which the publications
+// repeating an idempotency key are deduplicated.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+var (
+	// ErrIdempotencyNotSupported is returned by NewHub when idempotent
+	// publishing is enabled and the transport doesn't implement
+	// TransportIdempotencyIndex.
+	ErrIdempotencyNotSupported = errors.New("the transport doesn't support idempotent publishing")
+	// ErrInvalidIdempotencyKey is returned by Publish when the idempotency key
+	// contains a forbidden control character or invalid UTF-8.
+	ErrInvalidIdempotencyKey = errors.New("idempotency key contains a forbidden control character or invalid UTF-8")
+)
+
+// TransportIdempotencyIndex may be implemented by transports remembering the
+// idempotency keys of the publications, see WithIdempotentPublishing.
+// Transports shared by several hubs must share the index too.
+type TransportIdempotencyIndex interface {
+	// RememberIdempotencyKey records that the update id is published with
+	// key, for ttl, unless the key is already recorded: the ID of the update
+	// published with it is then returned, with true. It must be atomic.
+	RememberIdempotencyKey(ctx context.Context, key, id string, ttl time.Duration) (string, bool, error)
+	// ForgetIdempotencyKey removes the key of a failed publication, so it can
+	// be published again.
+	ForgetIdempotencyKey(ctx context.Context, key string) error
+}
+
+// WithIdempotentPublishing deduplicates the publications: an update published
+// with the idempotency key of an update published less than window ago
+// (DefaultIdempotencyWindow when 0) isn't dispatched, and the ID of the
+// original update is returned instead. Publishers can then retry the
+// publications that timed out or failed without risking duplicates.
+//
+// The key is the Idempotency-Key header of the publish endpoint, or the id
+// field when the header isn't set. Keys are scoped to the publisher: the
+// same key sent with tokens having different subjects or issuers identifies
+// different publications. The transport must implement
+// TransportIdempotencyIndex.
+func WithIdempotentPublishing(window time.Duration) Option {
+	return func(o *opt) error {
+		if window <= 0 {
+			window = DefaultIdempotencyWindow
+		}
+
+		o.idempotencyWindow = window
+
+		return nil
+	}
+}
+
+// validateIdempotentPublishing checks that the transport supports idempotent
+// publishing, when enabled.
+func (o *opt) validateIdempotentPublishing() error {
+	if o.idempotencyWindow == 0 {
+		return nil
+	}
+
+	if _, ok := o.transport.(TransportIdempotencyIndex); !ok {
+		return ErrIdempotencyNotSupported
+	}
+
+	return nil
+}
+
+// idempotencyKey returns the idempotency key of a publication received by
+// the publish endpoint.
+func (h *Hub) idempotencyKey(r *http.Request, id string) string {
+	if h.idempotencyWindow == 0 {
+		return ""
+	}
+
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		return key
+	}
+
+	return id
+}
+
+// publishIdempotently publishes the update unless its idempotency key has
+// already been published with, the ID of the original update being assigned
+// to it then.
+func (h *Hub) publishIdempotently(ctx context.Context, span trace.Span, update *Update) error {
+	index := h.transport.(TransportIdempotencyIndex)
+
+	// Length-prefixed, for the key of a publisher not to collide with the
+	// one of another.
+	key := strconv.Itoa(len(update.Tenant)) + ":" + update.Tenant +
+		strconv.Itoa(len(update.Publisher)) + ":" + update.Publisher +
+		update.IdempotencyKey
+
+	// The ID is assigned before the dispatch to be recorded with the key.
+	update.AssignUUID()
+
+	id, found, err := index.RememberIdempotencyKey(ctx, key, update.ID, h.idempotencyWindow)
+	if err != nil {
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to record the idempotency key", slog.Any("error", err))
+		}
+
+		recordSpanError(span, err)
+
+		return err //nolint:wrapcheck
+	}
+
+	if found {
+		update.ID = id
+
+		if update.report != nil {
+			update.report.duplicate = true
+		}
+
+		if h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelDebug, "Update already published with this idempotency key")
+		}
+
+		return nil
+	}
+
+	err = h.publish(ctx, span, update)
+	if err != nil && !errors.Is(err, ErrPartialDispatch) {
+		if err := index.ForgetIdempotencyKey(context.WithoutCancel(ctx), key); err != nil && h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to forget the idempotency key", slog.Any("error", err))
+		}
+	}
+
+	return err
+}
+
+// idempotencyEntry is an idempotency key remembered by idempotencyIndex.
+type idempotencyEntry struct {
+	key       string
+	id        string
+	expiresAt time.Time
+}
+
+// idempotencyIndex is an in-memory TransportIdempotencyIndex.
+type idempotencyIndex struct {
+	mu      sync.Mutex
+	entries map[string]idempotencyEntry
+	// queue holds the entries in the order they have been recorded, to
+	// remove the expired ones. The TTL being the window of the hub, it is
+	// also the order of expiration.
+	queue []idempotencyEntry
+}
+
+func (i *idempotencyIndex) remember(key, id string, ttl time.Duration) (string, bool) {
+	now := time.Now()
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.removeExpired(now)
+
+	if e, ok := i.entries[key]; ok && now.Before(e.expiresAt) {
+		return e.id, true
+	}
+
+	if i.entries == nil {
+		i.entries = make(map[string]idempotencyEntry)
+	}
+
+	e := idempotencyEntry{key: key, id: id, expiresAt: now.Add(ttl)}
+	i.entries[key] = e
+	i.queue = append(i.queue, e)
+
+	return id, false
+}
+
+func (i *idempotencyIndex) forget(key string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.entries, key)
+}
+
+// removeExpired must be called with mu held.
+func (i *idempotencyIndex) removeExpired(now time.Time) {
+	n := 0
+	for ; n < len(i.queue) && !now.Before(i.queue[n].expiresAt); n++ {
+		e := i.queue[n]
+
+		// The key may have been forgotten, and recorded again since.
+		if current, ok := i.entries[e.key]; ok && current.expiresAt.Equal(e.expiresAt) {
+			delete(i.entries, e.key)
+		}
+	}
+
+	i.queue = i.queue[n:]
+}
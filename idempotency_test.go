@@ -0,0 +1,203 @@
+package mercure
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countHistory returns the number of updates stored by the transport.
+func countHistory(t *testing.T, transport TransportHistoryReader) int {
+	t.Helper()
+
+	var n int
+
+	require.NoError(t, transport.ReadHistory(t.Context(), func(*Update) error {
+		n++
+
+		return nil
+	}))
+
+	return n
+}
+
+func TestPublishIdempotently(t *testing.T) {
+	t.Parallel()
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(context.Background()))
+	})
+
+	hub := createDummy(t, WithTransport(transport), WithIdempotentPublishing(0))
+
+	u1 := &Update{Topic: "https://example.com/books/1", IdempotencyKey: "key"}
+	require.NoError(t, hub.Publish(t.Context(), u1))
+	require.NotEmpty(t, u1.ID)
+
+	u2 := &Update{Topic: "https://example.com/books/1", IdempotencyKey: "key"}
+	require.NoError(t, hub.Publish(t.Context(), u2))
+	assert.Equal(t, u1.ID, u2.ID)
+
+	// Another publisher.
+	u3 := &Update{Topic: "https://example.com/books/1", IdempotencyKey: "key", Publisher: "other"}
+	require.NoError(t, hub.Publish(t.Context(), u3))
+	assert.NotEqual(t, u1.ID, u3.ID)
+
+	u4 := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, hub.Publish(t.Context(), u4))
+
+	assert.Equal(t, 3, countHistory(t, transport))
+
+	require.ErrorIs(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", IdempotencyKey: "k\x00"}), ErrInvalidIdempotencyKey)
+}
+
+func TestPublishIdempotentlyFailure(t *testing.T) {
+	t.Parallel()
+
+	bt, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		assert.NoError(t, bt.Close(context.Background()))
+	})
+
+	hub := createDummy(t, WithTransport(&failingTransport{BoltTransport: bt, failures: 1}), WithIdempotentPublishing(time.Hour))
+
+	require.ErrorIs(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", IdempotencyKey: "key"}), errTestStorage)
+
+	// The key of the failed publication has been forgotten.
+	u := &Update{Topic: "https://example.com/books/1", IdempotencyKey: "key"}
+	require.NoError(t, hub.Publish(t.Context(), u))
+	assert.Equal(t, 1, countHistory(t, bt))
+}
+
+func TestPublishHandlerIdempotencyKey(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithIdempotentPublishing(0))
+
+	publish := func(key, id string) string {
+		form := url.Values{"topic": {"https://example.com/books/1"}, "data": {"Hello!"}}
+		if id != "" {
+			form.Set("id", id)
+		}
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+		if key != "" {
+			req.Header.Add("Idempotency-Key", key)
+		}
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		resp := w.Result()
+		defer resp.Body.Close()
+
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+
+		return string(body)
+	}
+
+	id := publish("key", "")
+	assert.Equal(t, id, publish("key", ""))
+	assert.NotEqual(t, id, publish("other", ""))
+
+	// The id field is the key when the header isn't set.
+	assert.Equal(t, "urn:uuid:foo", publish("", "urn:uuid:foo"))
+	assert.Equal(t, "urn:uuid:foo", publish("", "urn:uuid:foo"))
+	assert.Equal(t, id, publish("key", "urn:uuid:bar"))
+}
+
+func TestIdempotentPublishingNotSupported(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithTransport(&addSubscriberErrorTransport{}), WithIdempotentPublishing(0))
+	require.ErrorIs(t, err, ErrIdempotencyNotSupported)
+}
+
+func TestIdempotencyIndexExpiration(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		var index idempotencyIndex
+
+		id, found := index.remember("key", "1", time.Millisecond)
+		assert.Equal(t, "1", id)
+		assert.False(t, found)
+
+		id, found = index.remember("key", "2", time.Hour)
+		assert.Equal(t, "1", id)
+		assert.True(t, found)
+
+		time.Sleep(2 * time.Millisecond)
+
+		id, found = index.remember("key", "2", time.Hour)
+		assert.Equal(t, "2", id)
+		assert.False(t, found)
+
+		index.forget("key")
+
+		id, found = index.remember("key", "3", time.Hour)
+		assert.Equal(t, "3", id)
+		assert.False(t, found)
+		assert.Len(t, index.entries, 1)
+	})
+}
+
+func TestBoltIdempotencyKeyExpiration(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0)
+		require.NoError(t, err)
+
+		id, found, err := transport.RememberIdempotencyKey(t.Context(), "key", "1", time.Millisecond)
+		require.NoError(t, err)
+		assert.Equal(t, "1", id)
+		assert.False(t, found)
+
+		id, found, err = transport.RememberIdempotencyKey(t.Context(), "key", "2", time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, "1", id)
+		assert.True(t, found)
+
+		time.Sleep(2 * time.Millisecond)
+
+		id, found, err = transport.RememberIdempotencyKey(t.Context(), "key", "2", time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, "2", id)
+		assert.False(t, found)
+
+		require.NoError(t, transport.ForgetIdempotencyKey(t.Context(), "key"))
+
+		id, found, err = transport.RememberIdempotencyKey(t.Context(), "key", "3", time.Hour)
+		require.NoError(t, err)
+		assert.Equal(t, "3", id)
+		assert.False(t, found)
+
+		require.NoError(t, transport.Close(t.Context()))
+
+		_, _, err = transport.RememberIdempotencyKey(t.Context(), "key", "4", time.Hour)
+		require.ErrorIs(t, err, ErrClosedTransport)
+	})
+}
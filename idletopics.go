@@ -0,0 +1,233 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/maypok86/otter/v2"
+)
+
+const (
+	// defaultIdleTopicsMaxTopics is the number of topics tracked when
+	// IdleTopics.MaxTopics is 0.
+	defaultIdleTopicsMaxTopics = 100_000
+	// minIdleTopicsSweepInterval and maxIdleTopicsSweepInterval bound how
+	// often the idle topics are looked for, half of the TTL otherwise.
+	minIdleTopicsSweepInterval = time.Second
+	maxIdleTopicsSweepInterval = time.Minute
+)
+
+// ErrInvalidIdleTopics is returned by WithIdleTopics for an invalid
+// configuration.
+var ErrInvalidIdleTopics = errors.New("invalid idle topics configuration")
+
+// IdleTopics configures the tracking of the idle topics: the topics having no
+// subscribers that have not been published on for a while.
+type IdleTopics struct {
+	// TTL is how long a topic without subscribers must not be published on
+	// to be idle.
+	TTL time.Duration
+	// Collect makes the hub forget the state it keeps for the idle topics:
+	// their retained value, the last state the JSON Patch deltas are computed
+	// from, the ID of their last update for the conditional publications, the
+	// last number assigned by the local transport (see WithTopicSequences),
+	// and the cached results of the topic selectors.
+	Collect bool
+	// MaxTopics is the number of topics tracked, 100000 when 0. The least
+	// recently published ones are forgotten.
+	MaxTopics int
+}
+
+// IdleTopicsMetrics may be implemented by the Metrics collecting the number
+// of the tracked topics, passed to WithIdleTopics.
+type IdleTopicsMetrics interface {
+	// TopicsTracked collects the number of active and idle topics, after
+	// every look for the idle topics.
+	TopicsTracked(active, idle int)
+	// IdleTopicsCollected collects the number of idle topics whose state has
+	// been forgotten.
+	IdleTopicsCollected(n int)
+}
+
+// idleTopics remembers when the topics have been published on last.
+type idleTopics struct {
+	IdleTopics
+
+	lastPublished *otter.Cache[string, time.Time]
+}
+
+// WithIdleTopics tracks the topics published on, reports the number of
+// active and idle ones to the metrics implementing IdleTopicsMetrics, and,
+// when IdleTopics.Collect is set, forgets the state the hub keeps for the
+// idle ones, preventing its unbounded growth in deployments with a high
+// topic cardinality.
+//
+// A topic is active while a subscriber of the hub has a selector matching it.
+// With transports not implementing TransportSubscribers, only the
+// publications keep the topics active.
+func WithIdleTopics(c IdleTopics) Option {
+	return func(o *opt) error {
+		if c.TTL <= 0 || c.MaxTopics < 0 {
+			return ErrInvalidIdleTopics
+		}
+
+		if c.MaxTopics == 0 {
+			c.MaxTopics = defaultIdleTopicsMaxTopics
+		}
+
+		lastPublished, err := otter.New(&otter.Options[string, time.Time]{MaximumSize: c.MaxTopics})
+		if err != nil {
+			return fmt.Errorf("unable to create the idle topics cache: %w", err)
+		}
+
+		o.idleTopics = &idleTopics{IdleTopics: c, lastPublished: lastPublished}
+
+		return nil
+	}
+}
+
+// trackTopics records the publication of the updates. It must be called
+// before their topics' state is updated, for the collection not to forget
+// it.
+func (h *Hub) trackTopics(updates ...*Update) {
+	if h.idleTopics == nil {
+		return
+	}
+
+	now := time.Now()
+	for _, u := range updates {
+		h.idleTopics.lastPublished.Set(u.Topic, now)
+	}
+}
+
+// startIdleTopics looks for the idle topics periodically, until the context of
+// the hub is done.
+func (h *Hub) startIdleTopics() {
+	if h.idleTopics == nil {
+		return
+	}
+
+	interval := min(max(h.idleTopics.TTL/2, minIdleTopicsSweepInterval), maxIdleTopicsSweepInterval)
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.ctx.Done():
+				return
+			case <-ticker.C:
+				h.sweepIdleTopics(h.ctx)
+			}
+		}
+	}()
+}
+
+// sweepIdleTopics reports the number of active and idle topics, and collects
+// the idle ones when enabled.
+func (h *Hub) sweepIdleTopics(ctx context.Context) {
+	var subscribers []*Subscriber
+
+	if ts, ok := h.transport.(TransportSubscribers); ok {
+		var err error
+		if _, subscribers, err = ts.GetSubscribers(ctx); err != nil {
+			if h.logger.Enabled(ctx, slog.LevelWarn) {
+				h.logger.LogAttrs(ctx, slog.LevelWarn, "Unable to get the subscribers to look for the idle topics", slog.Any("error", err))
+			}
+
+			return
+		}
+	}
+
+	var (
+		now    = time.Now()
+		idle   []string
+		active int
+	)
+
+	for topic, at := range h.idleTopics.lastPublished.All() {
+		if now.Sub(at) < h.idleTopics.TTL || h.subscribed(subscribers, topic) {
+			active++
+
+			continue
+		}
+
+		idle = append(idle, topic)
+	}
+
+	m, _ := h.metrics.(IdleTopicsMetrics)
+	if m != nil {
+		m.TopicsTracked(active, len(idle))
+	}
+
+	if !h.idleTopics.Collect || len(idle) == 0 {
+		return
+	}
+
+	collected := h.collectTopics(now, idle)
+
+	if m != nil {
+		m.IdleTopicsCollected(collected)
+	}
+
+	if h.logger.Enabled(ctx, slog.LevelDebug) {
+		h.logger.LogAttrs(ctx, slog.LevelDebug, "Idle topics collected", slog.Int("count", collected), slog.Int("active", active))
+	}
+}
+
+// subscribed reports whether one of the subscribers has a selector matching
+// the topic.
+func (h *Hub) subscribed(subscribers []*Subscriber, topic string) bool {
+	topics := []string{topic}
+
+	return slices.ContainsFunc(subscribers, func(s *Subscriber) bool {
+		return slices.ContainsFunc(s.SubscribedMatchers, func(m TopicMatcher) bool {
+			return h.topicMatcherStore.matches(topics, m)
+		})
+	})
+}
+
+// collectTopics forgets the state of the topics still idle, and returns their
+// number.
+func (h *Hub) collectTopics(now time.Time, topics []string) int {
+	collected := make(map[string]struct{}, len(topics))
+	sequences, _ := h.transport.(topicSequenceForgetter)
+
+	for _, topic := range topics {
+		// Published meanwhile: its new state must be kept.
+		h.idleTopics.lastPublished.ComputeIfPresent(topic, func(at time.Time) (time.Time, otter.ComputeOp) {
+			if now.Sub(at) < h.idleTopics.TTL {
+				return at, otter.CancelOp
+			}
+
+			if h.retained != nil {
+				h.retained.values.Invalidate(topic)
+			}
+
+			if h.jsonPatch != nil {
+				h.jsonPatch.documents.Invalidate(topic)
+			}
+
+			if h.lastEventIDs != nil {
+				h.lastEventIDs.ids.Invalidate(topic)
+			}
+
+			if sequences != nil {
+				sequences.forgetTopicSequence(topic)
+			}
+
+			collected[topic] = struct{}{}
+
+			return at, otter.InvalidateOp
+		})
+	}
+
+	h.topicMatcherStore.forget(collected)
+
+	return len(collected)
+}
@@ -0,0 +1,162 @@
+package mercure
+
+import (
+	"sync"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// idleTopicsRecorder records the idle topics metrics.
+type idleTopicsRecorder struct {
+	NopMetrics
+
+	mu                      sync.Mutex
+	active, idle, collected int
+}
+
+func (r *idleTopicsRecorder) TopicsTracked(active, idle int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.active, r.idle = active, idle
+}
+
+func (r *idleTopicsRecorder) IdleTopicsCollected(n int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.collected += n
+}
+
+func TestIdleTopicsCollect(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		metrics := &idleTopicsRecorder{}
+		hub := createDummy(t,
+			WithIdleTopics(IdleTopics{TTL: time.Minute, Collect: true}),
+			WithRetainedValues(RetainedValues{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/:id"}}}),
+			WithConditionalPublishing(0),
+			WithMetrics(metrics),
+		)
+
+		for _, topic := range []string{"https://example.com/books/1", "https://example.com/books/2", "https://example.com/books/3"} {
+			require.NoError(t, hub.Publish(t.Context(), &Update{Topic: topic}))
+		}
+
+		s := NewLocalSubscriber("", hub.logger, hub.topicMatcherStore)
+		s.SetMatchers([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/books/2"}}, nil)
+		require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+
+		time.Sleep(45 * time.Second)
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/3"}))
+
+		time.Sleep(45 * time.Second)
+		synctest.Wait()
+
+		_, ok := hub.retained.values.GetIfPresent("https://example.com/books/1")
+		assert.False(t, ok, "the retained value of an idle topic must be forgotten")
+
+		_, ok = hub.lastEventIDs.ids.GetIfPresent("https://example.com/books/1")
+		assert.False(t, ok)
+
+		// Subscribed, or published recently.
+		for _, topic := range []string{"https://example.com/books/2", "https://example.com/books/3"} {
+			_, ok = hub.retained.values.GetIfPresent(topic)
+			assert.True(t, ok, topic)
+		}
+
+		metrics.mu.Lock()
+		assert.Equal(t, 2, metrics.active)
+		assert.Equal(t, 0, metrics.idle)
+		assert.Equal(t, 1, metrics.collected)
+		metrics.mu.Unlock()
+	})
+}
+
+func TestIdleTopicsCollectSequences(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		hub := createDummy(t,
+			WithIdleTopics(IdleTopics{TTL: time.Minute, Collect: true}),
+			WithTopicSequences(),
+		)
+
+		for range 2 {
+			require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/2"}))
+		}
+
+		time.Sleep(90 * time.Second)
+		synctest.Wait()
+
+		sequences := hub.transport.(*LocalTransport).sequences
+		sequences.mu.Lock()
+		assert.Empty(t, sequences.last, "the sequence of an idle topic must be forgotten")
+		sequences.mu.Unlock()
+
+		u := &Update{Topic: "https://example.com/books/2"}
+		require.NoError(t, hub.Publish(t.Context(), u))
+		assert.Equal(t, uint64(1), u.Sequence)
+	})
+}
+
+func TestIdleTopicsWithoutCollect(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		metrics := &idleTopicsRecorder{}
+		hub := createDummy(t,
+			WithIdleTopics(IdleTopics{TTL: time.Minute}),
+			WithConditionalPublishing(0),
+			WithMetrics(metrics),
+		)
+
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1"}))
+
+		time.Sleep(90 * time.Second)
+		synctest.Wait()
+
+		_, ok := hub.lastEventIDs.ids.GetIfPresent("https://example.com/books/1")
+		assert.True(t, ok)
+
+		metrics.mu.Lock()
+		assert.Equal(t, 0, metrics.active)
+		assert.Equal(t, 1, metrics.idle)
+		assert.Equal(t, 0, metrics.collected)
+		metrics.mu.Unlock()
+	})
+}
+
+func TestWithIdleTopicsInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []IdleTopics{{}, {TTL: time.Minute, MaxTopics: -1}} {
+		_, err := NewHub(t.Context(), WithIdleTopics(c))
+		require.ErrorIs(t, err, ErrInvalidIdleTopics, "%+v", c)
+	}
+}
+
+func TestTopicMatcherStoreForget(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(100)
+	require.NoError(t, err)
+
+	m := TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/:id"}
+	assert.True(t, tms.matches([]string{"https://example.com/books/1"}, m))
+	assert.True(t, tms.matches([]string{"https://example.com/books/2", "https://example.com/authors/1"}, m))
+
+	tms.forget(map[string]struct{}{"https://example.com/authors/1": {}})
+
+	var topics []string
+	for k := range tms.matchCache.Keys() {
+		topics = append(topics, k.Topics)
+	}
+
+	assert.Equal(t, []string{"https://example.com/books/1"}, topics)
+}
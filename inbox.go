@@ -0,0 +1,93 @@
+package mercure
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// userInboxPrefix prefixes the inbox topics of users.
+const userInboxPrefix = defaultHubURL + "/users/"
+
+// ErrPublicInboxUpdate is returned by Publish when an update addressing an
+// inbox topic is not private.
+var ErrPublicInboxUpdate = errors.New("updates addressing an inbox topic must be private")
+
+// WithUserInboxes gives every token subject an inbox topic (see
+// UserInboxTopic): subscribers are subscribed to the inbox of the subject of
+// their token and allowed to receive its private updates, without any grant
+// in the token. Subscribing to the inbox of another user is forbidden.
+//
+// Subjects are only unique per issuer: the inboxes are keyed by both, so the
+// users of different issuers (see WithIssuers) never share an inbox.
+func WithUserInboxes() Option {
+	return func(o *opt) error {
+		o.userInboxes = true
+
+		return nil
+	}
+}
+
+// UserInboxTopic returns the topic to publish updates for the user
+// identified by the given token issuer ("iss" claim) and subject ("sub"
+// claim) to. Inbox topics only accept private updates: only the user is
+// allowed to receive them.
+func UserInboxTopic(issuer, subject string) string {
+	return userInboxPrefix + url.PathEscape(issuer) + "/" + url.PathEscape(subject)
+}
+
+// addressesInbox reports whether the topic is an inbox topic. Inboxes live in
+// the reserved namespace, so only the hub decides who subscribes to them, but
+// they are the only topics of this namespace publishers can address.
+func addressesInbox(topic string) bool {
+	return addressesGuestInbox(topic) || addressesUserInbox(topic)
+}
+
+// addressesUserInbox reports whether the topic is the inbox of a user: two
+// escaped path segments after the prefix, the issuer, possibly empty, and
+// the subject.
+func addressesUserInbox(topic string) bool {
+	rest, ok := strings.CutPrefix(topic, userInboxPrefix)
+	if !ok {
+		return false
+	}
+
+	_, sub, ok := strings.Cut(rest, "/")
+
+	return ok && sub != "" && !strings.Contains(sub, "/")
+}
+
+// inboxMatcher returns the matcher of an inbox topic.
+func inboxMatcher(topic string) TopicMatcher {
+	return TopicMatcher{Type: MatcherTypeExact, Pattern: topic}
+}
+
+// withInbox subscribes to an inbox and allows receiving its private updates.
+func withInbox(matchers, privateMatchers []TopicMatcher, inbox TopicMatcher) ([]TopicMatcher, []TopicMatcher) {
+	if !slices.Contains(matchers, inbox) {
+		matchers = append(matchers, inbox)
+	}
+
+	return matchers, append(privateMatchers, inbox)
+}
+
+// userInbox returns the inbox of the issuer and subject of the claims, if
+// any.
+func userInbox(c *claims) (TopicMatcher, bool) {
+	if c == nil || c.Subject == "" {
+		return TopicMatcher{}, false
+	}
+
+	inbox := inboxMatcher(UserInboxTopic(c.Issuer, c.Subject))
+
+	return inbox, validateMatcherValue(inbox.Pattern) == nil
+}
+
+// subscribesToOtherUserInbox reports whether the matchers explicitly request
+// the inbox of a user other than own.
+func subscribesToOtherUserInbox(matchers []TopicMatcher, own TopicMatcher) bool {
+	return slices.ContainsFunc(matchers, func(m TopicMatcher) bool {
+		return m.Type == MatcherTypeExact && m != own && addressesUserInbox(m.Pattern)
+	})
+}
@@ -0,0 +1,158 @@
+package mercure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createSubjectJWT(subject string, topics []string) string {
+	return createIssuerSubjectJWT(testIssuer, []byte("subscriber"), subject, topics)
+}
+
+func createIssuerSubjectJWT(issuer string, key []byte, subject string, topics []string) string {
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Header["typ"] = atJWTType
+	token.Claims = &claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Subject:   subject,
+			Audience:  jwt.ClaimStrings{testResourceIdentifier},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		AuthorizationDetails: []authorizationDetail{{
+			Type:    authorizationDetailTypeMercure,
+			Actions: []mercureAction{actionSubscribe},
+			Topics:  stringsToDetailTopics(topics),
+		}},
+	}
+
+	tokenString, _ := token.SignedString(key)
+
+	return tokenString
+}
+
+func TestUserInboxes(t *testing.T) {
+	t.Parallel()
+
+	for name, tc := range map[string]struct {
+		options []Option
+		inbox   bool
+	}{
+		"enabled":  {[]Option{WithUserInboxes()}, true},
+		"disabled": {nil, false},
+	} {
+		hub := createDummy(t, tc.options...)
+
+		ctx, cancel := context.WithCancel(t.Context())
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1", nil).WithContext(ctx)
+			req.Header.Set("Authorization", bearerPrefix+createSubjectJWT("alice@example.com", []string{"https://example.com/books/1"}))
+
+			hub.SubscribeHandler(newSubscribeRecorder(), req)
+		})
+
+		waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+		_, subscribers, err := hub.transport.(TransportSubscribers).GetSubscribers(t.Context())
+		require.NoError(t, err)
+
+		inbox := inboxMatcher(defaultHubURL + "/users/https:%2F%2Fexample.com/alice@example.com")
+		if tc.inbox {
+			assert.Contains(t, subscribers[0].SubscribedMatchers, inbox, name)
+			assert.Contains(t, subscribers[0].AllowedPrivateMatchers, inbox, name)
+		} else {
+			assert.NotContains(t, subscribers[0].SubscribedMatchers, inbox, name)
+			assert.NotContains(t, subscribers[0].AllowedPrivateMatchers, inbox, name)
+		}
+
+		cancel()
+		wg.Wait()
+	}
+}
+
+func TestUserInboxesForbidOtherUsers(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithUserInboxes())
+
+	for name, tc := range map[string]struct {
+		topic  string
+		status int
+	}{
+		"other user":    {UserInboxTopic(testIssuer, "bob"), http.StatusForbidden},
+		"other issuer":  {UserInboxTopic("https://other.example", "alice"), http.StatusForbidden},
+		"granted topic": {"https://example.com/books/1", http.StatusOK},
+	} {
+		ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+		req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match="+url.QueryEscape(tc.topic), nil).WithContext(ctx)
+		req.Header.Set("Authorization", bearerPrefix+createSubjectJWT("alice", []string{"*"}))
+
+		w := newSubscribeRecorder()
+		hub.SubscribeHandler(w, req)
+		cancel()
+
+		assert.Equal(t, tc.status, w.Code, name)
+	}
+}
+
+func TestUserInboxesIssuers(t *testing.T) {
+	t.Parallel()
+
+	const otherIssuer = "https://other.example"
+
+	hub := createDummy(t, WithUserInboxes(), WithIssuers([]Issuer{{Identifier: otherIssuer, Subscriber: Static{Key: []byte("other"), Algorithm: "HS256"}}}))
+
+	for _, tc := range []struct{ issuer, token, otherIssuer string }{
+		{testIssuer, createSubjectJWT("alice", []string{"https://example.com/books/1"}), otherIssuer},
+		{otherIssuer, createIssuerSubjectJWT(otherIssuer, []byte("other"), "alice", []string{"https://example.com/books/1"}), testIssuer},
+	} {
+		ctx, cancel := context.WithCancel(t.Context())
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1", nil).WithContext(ctx)
+			req.Header.Set("Authorization", bearerPrefix+tc.token)
+
+			hub.SubscribeHandler(newSubscribeRecorder(), req)
+		})
+
+		waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+		_, subscribers, err := hub.transport.(TransportSubscribers).GetSubscribers(t.Context())
+		require.NoError(t, err)
+
+		s := subscribers[0]
+		assert.True(t, s.MatchTopics([]string{UserInboxTopic(tc.issuer, "alice")}, true), tc.issuer)
+		assert.False(t, s.MatchTopics([]string{UserInboxTopic(tc.otherIssuer, "alice")}, true), tc.issuer)
+
+		cancel()
+		wg.Wait()
+		waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+	}
+}
+
+func TestUserInboxTopicValidation(t *testing.T) {
+	t.Parallel()
+
+	assert.Equal(t, defaultHubURL+"/users/https:%2F%2Fexample.com/a%2Fb", UserInboxTopic(testIssuer, "a/b"))
+
+	require.NoError(t, (&Update{Topic: UserInboxTopic(testIssuer, "a/b"), Private: true}).Validate())
+	require.NoError(t, (&Update{Topic: UserInboxTopic("", "alice"), Private: true}).Validate())
+	require.ErrorIs(t, (&Update{Topic: UserInboxTopic(testIssuer, "alice")}).Validate(), ErrPublicInboxUpdate)
+	require.ErrorIs(t, (&Update{Topic: defaultHubURL + "/users/", Private: true}).Validate(), ErrReservedTopic)
+	require.ErrorIs(t, (&Update{Topic: defaultHubURL + "/users/alice", Private: true}).Validate(), ErrReservedTopic)
+	require.ErrorIs(t, (&Update{Topic: defaultHubURL + "/users/a/", Private: true}).Validate(), ErrReservedTopic)
+	require.ErrorIs(t, (&Update{Topic: defaultHubURL + "/users/a/b/c", Private: true}).Validate(), ErrReservedTopic)
+}
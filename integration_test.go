@@ -0,0 +1,148 @@
+//go:build integration
+
+package mercure
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dunglas/mercure/testsupport"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// integrationTransports are the transports the integration tests run the hub
+// with, against real brokers for the ones needing one.
+var integrationTransports = []struct {
+	name      string
+	transport func(t *testing.T) Transport
+}{
+	{"bolt", func(t *testing.T) Transport {
+		t.Helper()
+
+		transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "mercure.db"), defaultBoltBucketName, 0, BoltDefaultCleanupFrequency)
+		require.NoError(t, err)
+
+		t.Cleanup(func() { assert.NoError(t, transport.Close(t.Context())) })
+
+		return transport
+	}},
+	{"redis", func(t *testing.T) Transport {
+		t.Helper()
+
+		transport, err := NewRedisTransport(NewSubscriberList(0), slog.Default(), testsupport.Start(t, testsupport.Redis), testsupport.UniqueName(t), 0)
+		require.NoError(t, err)
+
+		t.Cleanup(func() { assert.NoError(t, transport.Close(t.Context())) })
+
+		return transport
+	}},
+	{"kafka", func(t *testing.T) Transport {
+		t.Helper()
+
+		// A topic per test: the broker is shared.
+		proxyURL := testsupport.Start(t, testsupport.Kafka)
+		topic := testsupport.UniqueName(t)
+		testsupport.CreateKafkaTopic(t, proxyURL, topic)
+
+		transport, err := NewKafkaTransport(NewSubscriberList(0), slog.Default(), proxyURL, topic, "", nil)
+		require.NoError(t, err)
+
+		t.Cleanup(func() { assert.NoError(t, transport.Close(t.Context())) })
+
+		return transport
+	}},
+}
+
+func TestIntegrationPublishSubscribe(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range integrationTransports {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			hub := createAnonymousDummy(t, WithTransport(tc.transport(t)))
+			srv := httptest.NewServer(hub)
+			t.Cleanup(srv.Close)
+
+			ids := make([]string, 3)
+			for i := range ids {
+				ids[i] = integrationPublish(t, srv.URL, string(rune('1'+i)))
+			}
+
+			// The updates following the Last-Event-ID, then the live ones.
+			data := integrationSubscribe(t, srv.URL, ids[0])
+			integrationPublish(t, srv.URL, "live")
+
+			for _, expected := range []string{"2", "3", "live"} {
+				select {
+				case d := <-data:
+					assert.Equal(t, expected, d)
+				case <-time.After(5 * time.Second):
+					require.FailNow(t, "update not received", expected)
+				}
+			}
+		})
+	}
+}
+
+// integrationPublish publishes data on the topic https://example.com/books/1
+// and returns the ID of the update.
+func integrationPublish(t *testing.T, base, data string) string {
+	t.Helper()
+
+	form := url.Values{"topic": {"https://example.com/books/1"}, "data": {data}}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, base+defaultHubURL, strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode, string(body))
+
+	return string(body)
+}
+
+// integrationSubscribe subscribes to https://example.com/books/1 from
+// lastEventID, once the subscription is effective, and returns the data of
+// the received updates.
+func integrationSubscribe(t *testing.T, base, lastEventID string) <-chan string {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, base+defaultHubURL+"?match="+url.QueryEscape("https://example.com/books/1"), nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", lastEventID)
+
+	resp, err := http.DefaultClient.Do(req) //nolint:bodyclose // closed by the reading goroutine
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	data := make(chan string, 10)
+
+	go func() {
+		defer resp.Body.Close()
+
+		for sc := bufio.NewScanner(resp.Body); sc.Scan(); {
+			if d, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+				data <- d
+			}
+		}
+	}()
+
+	return data
+}
@@ -0,0 +1,136 @@
+package mercure
+
+import (
+	"hash/fnv"
+	"math"
+	"slices"
+	"strings"
+)
+
+const (
+	// interestFalsePositiveRate is the target false positive rate of the
+	// Bloom filters of the interest digests.
+	interestFalsePositiveRate = 0.01
+	// minInterestBloomBits is the minimum size of the Bloom filters of the
+	// interest digests.
+	minInterestBloomBits = 64
+)
+
+// interestDigest is a compact summary of topic selectors, telling whether a
+// topic may be matched by one of them: the exact selectors are added to a
+// Bloom filter, and the other selectors reduced to their literal prefix. It
+// has false positives, but no false negatives.
+type interestDigest struct {
+	// All is set when a selector matches all the topics.
+	All bool `json:"all,omitempty"`
+	// Bloom is the Bloom filter of the exact selectors.
+	Bloom []byte `json:"bloom,omitempty"`
+	// Hashes is the number of hash functions of the Bloom filter.
+	Hashes uint `json:"k,omitempty"`
+	// Prefixes are the literal prefixes of the other selectors.
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// newInterestDigest summarizes the topic selectors.
+func newInterestDigest(matchers []TopicMatcher) *interestDigest {
+	d := &interestDigest{}
+
+	var exact []string
+
+	for _, m := range matchers {
+		switch {
+		case m.Pattern == "*":
+			return &interestDigest{All: true}
+		case m.Type == MatcherTypeExact:
+			exact = append(exact, m.Pattern)
+		default:
+			if p := literalPrefix(m.Pattern); !slices.Contains(d.Prefixes, p) {
+				d.Prefixes = append(d.Prefixes, p)
+			}
+		}
+	}
+
+	if len(exact) == 0 {
+		return d
+	}
+
+	bits := max(minInterestBloomBits, int(math.Ceil(-float64(len(exact))*math.Log(interestFalsePositiveRate)/(math.Ln2*math.Ln2))))
+	d.Bloom = make([]byte, (bits+7)/8)
+	d.Hashes = uint(math.Round(float64(len(d.Bloom)*8) / float64(len(exact)) * math.Ln2))
+	d.Hashes = min(max(d.Hashes, 1), 16)
+
+	for _, t := range exact {
+		d.forEachBit(t, func(i uint64) bool {
+			d.Bloom[i/8] |= 1 << (i % 8)
+
+			return true
+		})
+	}
+
+	return d
+}
+
+// forEachBit calls fn with the indexes of the bits of the Bloom filter of the
+// topic, using double hashing, until it returns false.
+func (d *interestDigest) forEachBit(topic string, fn func(i uint64) bool) {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(topic))
+	sum := h.Sum64()
+
+	h1, h2 := sum&math.MaxUint32, sum>>32|1
+	m := uint64(len(d.Bloom)) * 8
+
+	for i := range uint64(d.Hashes) {
+		if !fn((h1 + i*h2) % m) {
+			return
+		}
+	}
+}
+
+// matches reports whether one of the summarized selectors may match one of
+// the topics.
+func (d *interestDigest) matches(topics []string) bool {
+	if d.All {
+		return true
+	}
+
+	for _, t := range topics {
+		if slices.ContainsFunc(d.Prefixes, func(p string) bool { return strings.HasPrefix(t, p) }) {
+			return true
+		}
+
+		if len(d.Bloom) == 0 || d.Hashes == 0 {
+			continue
+		}
+
+		found := true
+		d.forEachBit(t, func(i uint64) bool {
+			found = d.Bloom[i/8]&(1<<(i%8)) != 0
+
+			return found
+		})
+
+		if found {
+			return true
+		}
+	}
+
+	return false
+}
+
+// literalPrefix returns the part of a URL Pattern, or of a URI template,
+// before its first special character: all the topics it matches start with
+// it.
+func literalPrefix(pattern string) string {
+	start := 0
+	if i := strings.Index(pattern, "://"); i != -1 && !strings.ContainsAny(pattern[:i], "*(){}\\?+:") {
+		// The colon of the scheme is not a named group.
+		start = i + 3
+	}
+
+	if i := strings.IndexAny(pattern[start:], "*(){}\\?+:"); i != -1 {
+		return pattern[:start+i]
+	}
+
+	return pattern
+}
@@ -0,0 +1,65 @@
+package mercure
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterestDigest(t *testing.T) {
+	t.Parallel()
+
+	d := newInterestDigest([]TopicMatcher{
+		{Type: MatcherTypeExact, Pattern: "https://example.com/books/1"},
+		{Type: MatcherTypeURLPattern, Pattern: "https://example.com/users/:id"},
+		{Type: MatcherTypeURLPattern, Pattern: "https://:host/reviews/*"},
+	})
+
+	assert.Equal(t, []string{"https://example.com/users/", "https://"}, d.Prefixes)
+	assert.True(t, d.matches([]string{"https://example.com/books/1"}))
+	assert.True(t, d.matches([]string{"https://example.com/users/dunglas"}))
+	assert.True(t, newInterestDigest([]TopicMatcher{{Type: MatcherTypeExact, Pattern: "*"}}).matches([]string{"foo"}))
+	assert.False(t, newInterestDigest(nil).matches([]string{"foo"}))
+}
+
+func TestInterestDigestBloomFilter(t *testing.T) {
+	t.Parallel()
+
+	matchers := make([]TopicMatcher, 1000)
+	for i := range matchers {
+		matchers[i] = TopicMatcher{Type: MatcherTypeExact, Pattern: fmt.Sprintf("https://example.com/books/%d", i)}
+	}
+
+	d := newInterestDigest(matchers)
+	assert.Less(t, len(d.Bloom), 2000)
+
+	for _, m := range matchers {
+		assert.True(t, d.matches([]string{m.Pattern}))
+	}
+
+	falsePositives := 0
+	for i := range 10000 {
+		if d.matches([]string{fmt.Sprintf("https://example.com/reviews/%d", i)}) {
+			falsePositives++
+		}
+	}
+
+	assert.Less(t, falsePositives, 300)
+}
+
+func TestLiteralPrefix(t *testing.T) {
+	t.Parallel()
+
+	for pattern, prefix := range map[string]string{
+		"https://example.com/books/1":     "https://example.com/books/1",
+		"https://example.com/books/:id":   "https://example.com/books/",
+		"https://example.com/books/{id}":  "https://example.com/books/",
+		"https://example.com:8080/*":      "https://example.com",
+		"*://example.com/books/*":         "",
+		"urn:example:books:1":             "urn",
+		"https://example.com/books(/.*)?": "https://example.com/books",
+	} {
+		assert.Equal(t, prefix, literalPrefix(pattern), pattern)
+	}
+}
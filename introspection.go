@@ -0,0 +1,343 @@
+package mercure
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/maypok86/otter/v2"
+)
+
+const (
+	// DefaultIntrospectionCacheTTL is the default time introspection responses
+	// are cached, see TokenIntrospection.
+	DefaultIntrospectionCacheTTL = time.Minute
+	// DefaultIntrospectionCacheSize is the default number of introspection
+	// responses cached, see TokenIntrospection.
+	DefaultIntrospectionCacheSize = 10_000
+
+	defaultIntrospectionTimeout = 5 * time.Second
+	// maxIntrospectionResponseSize bounds the size of the responses of the
+	// introspection endpoint.
+	maxIntrospectionResponseSize = 1 << 20
+)
+
+var (
+	// ErrInvalidTokenIntrospection is returned by WithTokenIntrospection when
+	// the configuration is not valid.
+	ErrInvalidTokenIntrospection = errors.New("invalid token introspection configuration")
+	// ErrIntrospectionFailed is returned when the introspection endpoint
+	// can't be reached, or doesn't answer with a valid introspection response.
+	ErrIntrospectionFailed = errors.New("token introspection failed")
+
+	// errInactiveToken is returned when the introspection endpoint reports
+	// the token as not active.
+	errInactiveToken = errors.New("inactive token")
+)
+
+// TokenIntrospection configures the validation of opaque access tokens by an
+// OAuth 2.0 token introspection endpoint (RFC 7662).
+type TokenIntrospection struct {
+	// Endpoint is the URL of the introspection endpoint.
+	Endpoint string
+	// ClientID and ClientSecret, when set, authenticate the hub to the
+	// endpoint with HTTP Basic authentication.
+	ClientID     string
+	ClientSecret string
+	// Client is the HTTP client calling the endpoint, a client with a timeout
+	// of 5 seconds by default. Custom clients must have a timeout too.
+	Client *http.Client
+	// CacheTTL is how long the introspection responses are cached,
+	// DefaultIntrospectionCacheTTL by default, the responses for active
+	// tokens being never cached past their expiration time. A negative
+	// value disables the cache.
+	CacheTTL time.Duration
+	// CacheSize is the maximum number of responses cached,
+	// DefaultIntrospectionCacheSize by default.
+	CacheSize int
+	// AuthorizationDetailsField is the member of the responses holding the
+	// RFC 9396 authorization details of the token, "authorization_details"
+	// by default.
+	AuthorizationDetailsField string
+	// SubscribeField and PublishField, when set, are members of the responses
+	// holding arrays of topic selectors the token may subscribe and publish
+	// to, in addition to the authorization details: exact topics as strings,
+	// or objects with the match and match_type members of the topics of the
+	// authorization details.
+	SubscribeField string
+	PublishField   string
+}
+
+// tokenIntrospector validates the opaque tokens with the introspection
+// endpoint.
+type tokenIntrospector struct {
+	TokenIntrospection
+
+	cache *otter.Cache[string, *introspectedToken]
+}
+
+// introspectedToken is the cached result of the introspection of a token.
+type introspectedToken struct {
+	claims *claims
+	// err is set for the tokens rejected by the endpoint, or by the hub.
+	err     error
+	expires time.Time
+}
+
+// WithTokenIntrospection validates the opaque access tokens, the ones that
+// aren't JWS, by calling an OAuth 2.0 token introspection endpoint (RFC 7662).
+// The tokens must be active, and their introspection responses follow the
+// rules of the JWT access tokens: in modern mode, they must have an exp
+// member, and an aud one containing the resource identifier of the hub. The
+// grants come from the members configured in TokenIntrospection. The iss
+// member isn't checked against the trusted issuers: the endpoint is trusted.
+//
+// The responses are cached, by hash of the token, to spare a round trip to
+// the endpoint on every request: a revoked token may be accepted until its
+// response expires. The failures of the endpoint aren't cached, and the
+// requests are then refused.
+func WithTokenIntrospection(ti TokenIntrospection) Option {
+	return func(o *opt) error {
+		u, err := url.Parse(ti.Endpoint)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidTokenIntrospection, err)
+		}
+
+		if !u.IsAbs() {
+			return fmt.Errorf("%w: the endpoint must be an absolute URL", ErrInvalidTokenIntrospection)
+		}
+
+		if ti.CacheSize < 0 {
+			return fmt.Errorf("%w: negative cache size", ErrInvalidTokenIntrospection)
+		}
+
+		if ti.Client == nil {
+			ti.Client = &http.Client{Timeout: defaultIntrospectionTimeout}
+		}
+
+		if ti.CacheTTL == 0 {
+			ti.CacheTTL = DefaultIntrospectionCacheTTL
+		}
+
+		if ti.CacheSize == 0 {
+			ti.CacheSize = DefaultIntrospectionCacheSize
+		}
+
+		if ti.AuthorizationDetailsField == "" {
+			ti.AuthorizationDetailsField = "authorization_details"
+		}
+
+		intr := &tokenIntrospector{TokenIntrospection: ti}
+
+		if ti.CacheTTL > 0 {
+			if intr.cache, err = otter.New(&otter.Options[string, *introspectedToken]{
+				MaximumSize: ti.CacheSize,
+				ExpiryCalculator: otter.ExpiryCreatingFunc(func(e otter.Entry[string, *introspectedToken]) time.Duration {
+					return time.Until(e.Value.expires)
+				}),
+			}); err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidTokenIntrospection, err)
+			}
+		}
+
+		o.introspector = intr
+		o.publisherConfigured = true
+		o.subscriberConfigured = true
+
+		return nil
+	}
+}
+
+// isJWS reports whether the token is in the JWS compact serialization.
+func isJWS(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// introspectToken validates an opaque token, using the cached introspection
+// response when there is one.
+func (h *Hub) introspectToken(encodedToken string) (*claims, error) {
+	ti := h.introspector
+	ctx := h.ctx
+
+	var (
+		it  *introspectedToken
+		err error
+	)
+
+	if ti.cache == nil {
+		it, err = h.introspect(ctx, encodedToken)
+	} else {
+		sum := sha256.Sum256([]byte(encodedToken))
+		it, err = ti.cache.Get(ctx, base64.RawURLEncoding.EncodeToString(sum[:]), otter.LoaderFunc[string, *introspectedToken](func(ctx context.Context, _ string) (*introspectedToken, error) {
+			return h.introspect(ctx, encodedToken)
+		}))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if it.err != nil {
+		return nil, it.err
+	}
+
+	// The claims of the cached responses are shared.
+	c := *it.claims
+
+	return &c, nil
+}
+
+// introspect calls the introspection endpoint. The returned error is set
+// when the endpoint failed: the tokens it rejects are reported in
+// introspectedToken.err, to be cached.
+func (h *Hub) introspect(ctx context.Context, encodedToken string) (*introspectedToken, error) {
+	ti := h.introspector
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ti.Endpoint, strings.NewReader(url.Values{"token": {encodedToken}, "token_type_hint": {"access_token"}}.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIntrospectionFailed, err)
+	}
+
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	if ti.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(ti.ClientID), url.QueryEscape(ti.ClientSecret))
+	}
+
+	resp, err := ti.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIntrospectionFailed, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: unexpected status code %d", ErrIntrospectionFailed, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxIntrospectionResponseSize))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIntrospectionFailed, err)
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrIntrospectionFailed, err)
+	}
+
+	now := time.Now()
+	it := &introspectedToken{expires: now.Add(ti.CacheTTL)}
+
+	c, err := h.introspectionClaims(body, members)
+	if err != nil {
+		it.err = fmt.Errorf("%w: %w", ErrInvalidJWT, err)
+
+		return it, nil
+	}
+
+	if c.ExpiresAt != nil && c.ExpiresAt.Before(it.expires) {
+		it.expires = c.ExpiresAt.Time
+	}
+
+	it.claims = c
+
+	return it, nil
+}
+
+// introspectionClaims validates an introspection response, and returns the
+// claims of the token.
+func (h *Hub) introspectionClaims(body []byte, members map[string]json.RawMessage) (*claims, error) {
+	ti := h.introspector
+
+	var active bool
+	if err := json.Unmarshal(members["active"], &active); err != nil || !active {
+		return nil, errInactiveToken
+	}
+
+	c := &claims{}
+	if err := json.Unmarshal(body, &c.RegisteredClaims); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if err := jwt.NewValidator(h.jwtParserOptions(roleVerifier{})...).Validate(c); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if v, ok := members[ti.AuthorizationDetailsField]; ok {
+		if err := json.Unmarshal(v, &c.AuthorizationDetails); err != nil {
+			return nil, fmt.Errorf("%q member: %w", ti.AuthorizationDetailsField, err)
+		}
+	}
+
+	for _, f := range []struct {
+		field  string
+		action mercureAction
+	}{{ti.SubscribeField, actionSubscribe}, {ti.PublishField, actionPublish}} {
+		field, action := f.field, f.action
+
+		v, ok := members[field]
+		if field == "" || !ok {
+			continue
+		}
+
+		topics, err := parseTopicSelectors(v)
+		if err != nil {
+			return nil, fmt.Errorf("%q member: %w", field, err)
+		}
+
+		if len(topics) != 0 {
+			c.AuthorizationDetails = append(c.AuthorizationDetails, authorizationDetail{
+				Type:    authorizationDetailTypeMercure,
+				Actions: []mercureAction{action},
+				Topics:  topics,
+			})
+		}
+	}
+
+	authz, err := validateAuthorizationDetails(h.topicMatcherStore, c.AuthorizationDetails)
+	if err != nil {
+		return nil, err
+	}
+
+	c.authz = authz
+
+	return c, nil
+}
+
+// parseTopicSelectors parses an array of topic selectors: exact topics as
+// strings, or objects like the topics of the authorization details.
+func parseTopicSelectors(v json.RawMessage) ([]detailTopic, error) {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(v, &raw); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	topics := make([]detailTopic, 0, len(raw))
+
+	for _, r := range raw {
+		var topic string
+		if err := json.Unmarshal(r, &topic); err == nil {
+			topics = append(topics, detailTopic{TopicMatcher{Type: MatcherTypeExact, Pattern: topic}})
+
+			continue
+		}
+
+		var t detailTopic
+		if err := json.Unmarshal(r, &t); err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		topics = append(topics, t)
+	}
+
+	return topics, nil
+}
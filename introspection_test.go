@@ -0,0 +1,166 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testActiveToken   = "active-" + strings.Repeat("a", 40)
+	testInactiveToken = "inactive-" + strings.Repeat("a", 40)
+	testOtherAudToken = "other-aud-" + strings.Repeat("a", 40)
+	testFailingToken  = "failing-" + strings.Repeat("a", 40)
+)
+
+// newIntrospectionServer starts an introspection endpoint answering for the
+// test tokens, and counting the requests.
+func newIntrospectionServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+
+		if id, secret, ok := r.BasicAuth(); !ok || id != "hub" || secret != "s3cr3t" {
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		exp := time.Now().Add(time.Hour).Unix()
+
+		var resp map[string]any
+
+		switch r.PostFormValue("token") {
+		case testActiveToken:
+			resp = map[string]any{
+				"active":            true,
+				"sub":               "alice",
+				"aud":               testResourceIdentifier,
+				"exp":               exp,
+				"mercure_subscribe": []any{"https://example.com/books/1", map[string]string{"match": "https://example.com/users/:id", "match_type": "urlpattern"}},
+				"mercure_publish":   []string{"https://example.com/books/1"},
+			}
+		case testOtherAudToken:
+			resp = map[string]any{"active": true, "aud": "https://other.example.com", "exp": exp}
+		case testFailingToken:
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		default:
+			resp = map[string]any{"active": false}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		assert.NoError(t, json.NewEncoder(w).Encode(resp))
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv, &calls
+}
+
+func createIntrospectionDummy(t *testing.T, endpoint string) *Hub {
+	t.Helper()
+
+	return createDummy(t, WithTokenIntrospection(TokenIntrospection{
+		Endpoint:       endpoint,
+		ClientID:       "hub",
+		ClientSecret:   "s3cr3t",
+		SubscribeField: "mercure_subscribe",
+		PublishField:   "mercure_publish",
+	}))
+}
+
+func TestWithTokenIntrospectionInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, ti := range []TokenIntrospection{
+		{Endpoint: "/introspect"},
+		{Endpoint: "https://example.com/introspect", CacheSize: -1},
+	} {
+		_, err := NewHub(t.Context(), WithTokenIntrospection(ti))
+		require.ErrorIs(t, err, ErrInvalidTokenIntrospection)
+	}
+}
+
+func TestTokenIntrospection(t *testing.T) {
+	t.Parallel()
+
+	srv, calls := newIntrospectionServer(t)
+	hub := createIntrospectionDummy(t, srv.URL)
+
+	for range 2 {
+		c, err := hub.validateJWT(testActiveToken, false)
+		require.NoError(t, err)
+
+		assert.Equal(t, "alice", c.Subject)
+		assert.True(t, c.authz.grants(hub.topicMatcherStore, actionSubscribe, "https://example.com/books/1"))
+		assert.True(t, c.authz.grants(hub.topicMatcherStore, actionSubscribe, "https://example.com/users/42"))
+		assert.True(t, c.authz.grants(hub.topicMatcherStore, actionPublish, "https://example.com/books/1"))
+		assert.False(t, c.authz.grants(hub.topicMatcherStore, actionPublish, "https://example.com/users/42"))
+	}
+
+	assert.Equal(t, int32(1), calls.Load())
+
+	for _, token := range []string{testInactiveToken, testOtherAudToken} {
+		for range 2 {
+			_, err := hub.validateJWT(token, false)
+			require.ErrorIs(t, err, ErrInvalidJWT, token)
+		}
+	}
+
+	// The rejections are cached too.
+	assert.Equal(t, int32(3), calls.Load())
+
+	for range 2 {
+		_, err := hub.validateJWT(testFailingToken, false)
+		require.ErrorIs(t, err, ErrIntrospectionFailed)
+	}
+
+	// The failures aren't.
+	assert.Equal(t, int32(5), calls.Load())
+}
+
+func TestTokenIntrospectionPublish(t *testing.T) {
+	t.Parallel()
+
+	srv, _ := newIntrospectionServer(t)
+	hub := createIntrospectionDummy(t, srv.URL)
+
+	for token, status := range map[string]int{
+		testActiveToken:   http.StatusOK,
+		testInactiveToken: http.StatusUnauthorized,
+		testFailingToken:  http.StatusServiceUnavailable,
+	} {
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(url.Values{"topic": {"https://example.com/books/1"}, "data": {"hello"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", bearerPrefix+token)
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		assert.Equal(t, status, w.Code, token)
+	}
+}
+
+func TestTokenIntrospectionJWT(t *testing.T) {
+	t.Parallel()
+
+	srv, calls := newIntrospectionServer(t)
+	hub := createIntrospectionDummy(t, srv.URL)
+
+	// The JWTs are still validated by the hub.
+	_, err := hub.validateJWT(mintAccessToken([]byte("subscriber"), testResourceIdentifier, nil), false)
+	require.NoError(t, err)
+	assert.Zero(t, calls.Load())
+}
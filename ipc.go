@@ -0,0 +1,589 @@
+package mercure
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// DefaultIPCScanInterval is the default interval between two scans of the
+	// directory of the sockets of the ring, see NewIPCTransport.
+	DefaultIPCScanInterval = time.Second
+	// DefaultIPCQueueSize is the default number of messages waiting to be sent
+	// to the next hub of the ring, see NewIPCTransport.
+	DefaultIPCQueueSize = 10_000
+
+	ipcSocketSuffix  = ".sock"
+	ipcDialTimeout   = time.Second
+	ipcWriteTimeout  = 5 * time.Second
+	maxIPCFrameSize  = 16 << 20
+	maxIPCSocketPath = 107 // sizeof(sockaddr_un.sun_path) - 1 on Linux
+)
+
+// errIPCFrameTooLarge is returned when a message received from the ring is
+// larger than maxIPCFrameSize.
+var errIPCFrameTooLarge = errors.New("ipc frame too large")
+
+// IPCTransport connects the hubs running on the same host, for instance one
+// process per core sharing a port with SO_REUSEPORT, without any broker.
+//
+// Each hub listens on a Unix socket of a shared directory. The sockets, sorted
+// by name, form a ring: a hub dispatches the updates published to it to its
+// own subscribers, then sends them to the next hub of the ring, which
+// dispatches and forwards them in turn, until they come back to the hub that
+// published them. The hubs scan the directory regularly to join the ring,
+// and to skip the hubs that left it.
+//
+// Like the local transport, the transport keeps no history. The updates in
+// flight while the ring changes, or sent to a hub that can't keep up, may be
+// lost or, more rarely, delivered twice.
+type IPCTransport struct {
+	local        *LocalTransport
+	logger       *slog.Logger
+	dir          string
+	id           string
+	listener     *net.UnixListener
+	scanInterval time.Duration
+	queue        chan *ipcMessage
+
+	ringMu sync.Mutex
+	size   int
+	next   string
+	conn   net.Conn
+
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+
+	closed     chan struct{}
+	closedOnce sync.Once
+	closeErr   error
+	wg         sync.WaitGroup
+}
+
+// ipcMessage is a group of updates traveling along the ring.
+type ipcMessage struct {
+	// Origin is the ID of the hub the updates have been published to.
+	Origin string `json:"origin"`
+	// Hops is the number of hubs the updates have been dispatched by.
+	Hops    int             `json:"hops"`
+	Updates json.RawMessage `json:"updates"`
+}
+
+// NewIPCTransport creates a new IPCTransport listening on a new socket of
+// dir, created if it doesn't exist. The directory must be shared by all the
+// hubs of the ring, and only by them: any process able to connect to the
+// sockets can publish updates. It is scanned every scanInterval, and up to
+// queueSize messages wait to be sent to the next hub, the updates forwarded
+// being dropped when the queue is full.
+func NewIPCTransport(subscriberList *SubscriberList, logger *slog.Logger, dir string, scanInterval time.Duration, queueSize int) (*IPCTransport, error) {
+	if scanInterval <= 0 {
+		scanInterval = DefaultIPCScanInterval
+	}
+
+	if queueSize <= 0 {
+		queueSize = DefaultIPCQueueSize
+	}
+
+	id := uuid.Must(uuid.NewV4()).String()
+	path := filepath.Join(dir, id+ipcSocketSuffix)
+
+	if len(path) > maxIPCSocketPath {
+		return nil, &TransportError{dsn: dir, msg: fmt.Sprintf("the socket path %q is longer than %d bytes", path, maxIPCSocketPath)}
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, &TransportError{dsn: dir, err: err}
+	}
+
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, &TransportError{dsn: dir, err: err}
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = listener.Close()
+
+		return nil, &TransportError{dsn: dir, err: err}
+	}
+
+	t := &IPCTransport{
+		local:        NewLocalTransport(subscriberList),
+		logger:       logger,
+		dir:          dir,
+		id:           id,
+		listener:     listener,
+		scanInterval: scanInterval,
+		queue:        make(chan *ipcMessage, queueSize),
+		conns:        make(map[net.Conn]struct{}),
+		closed:       make(chan struct{}),
+	}
+
+	t.scan()
+
+	t.wg.Add(3)
+
+	go t.accept()
+	go t.scanLoop()
+	go t.sendLoop()
+
+	return t, nil
+}
+
+// Dispatch dispatches an update to the subscribers of the hub, and sends it
+// to the next hub of the ring.
+func (t *IPCTransport) Dispatch(ctx context.Context, update *Update) error {
+	if err := t.local.Dispatch(ctx, update); err != nil {
+		return err
+	}
+
+	return t.publish(ctx, []*Update{update})
+}
+
+// DispatchGroup dispatches a group of updates to the subscribers of the hub,
+// and sends it to the next hub of the ring: every hub dispatches the updates
+// without any other update interleaved.
+func (t *IPCTransport) DispatchGroup(ctx context.Context, updates []*Update) error {
+	if err := t.local.DispatchGroup(ctx, updates); err != nil {
+		return err
+	}
+
+	return t.publish(ctx, updates)
+}
+
+// publish queues updates dispatched by the hub to be sent along the ring,
+// waiting for room in the queue. The updates having been dispatched to the
+// subscribers of the hub, the error returned if the context is done first
+// wraps ErrPartialDispatch.
+func (t *IPCTransport) publish(ctx context.Context, updates []*Update) error {
+	raw, err := json.Marshal(updates)
+	if err != nil {
+		return fmt.Errorf("error when marshaling updates: %w", err)
+	}
+
+	select {
+	case t.queue <- &ipcMessage{Origin: t.id, Hops: 1, Updates: raw}:
+	case <-t.closed:
+	case <-ctx.Done():
+		return fmt.Errorf("%w: unable to send the updates to the other hubs of the IPC ring: %w", ErrPartialDispatch, ctx.Err())
+	}
+
+	return nil
+}
+
+// accept accepts the connections of the previous hubs of the ring.
+func (t *IPCTransport) accept() {
+	defer t.wg.Done()
+
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if isClosed(t.closed) {
+				return
+			}
+
+			if t.logger.Enabled(context.Background(), slog.LevelError) {
+				t.logger.LogAttrs(context.Background(), slog.LevelError, "Unable to accept an IPC connection", slog.Any("error", err))
+			}
+
+			continue
+		}
+
+		t.connsMu.Lock()
+		if isClosed(t.closed) {
+			t.connsMu.Unlock()
+			_ = conn.Close()
+
+			return
+		}
+
+		t.conns[conn] = struct{}{}
+		t.wg.Add(1)
+		t.connsMu.Unlock()
+
+		go t.read(conn)
+	}
+}
+
+// read receives the messages of a previous hub of the ring, until the
+// connection is closed.
+func (t *IPCTransport) read(conn net.Conn) {
+	defer t.wg.Done()
+	defer func() {
+		t.connsMu.Lock()
+		delete(t.conns, conn)
+		t.connsMu.Unlock()
+
+		_ = conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+
+	for {
+		m, err := readIPCMessage(r)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !isClosed(t.closed) && t.logger.Enabled(context.Background(), slog.LevelError) {
+				t.logger.LogAttrs(context.Background(), slog.LevelError, "Unable to read from the IPC ring", slog.Any("error", err))
+			}
+
+			return
+		}
+
+		t.receive(m)
+	}
+}
+
+// receive dispatches the updates of a message to the subscribers of the hub,
+// and forwards it to the next hub unless all the hubs had it. The message is
+// dropped when the queue is full: waiting would deadlock the ring.
+func (t *IPCTransport) receive(m *ipcMessage) {
+	ctx := context.Background()
+
+	var updates []*Update
+	if err := json.Unmarshal(m.Updates, &updates); err != nil {
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal updates coming from the IPC ring", slog.String("origin", m.Origin), slog.Any("error", err))
+		}
+
+		return
+	}
+
+	if m.Origin == t.id {
+		return
+	}
+
+	if err := t.local.DispatchGroup(ctx, updates); err != nil {
+		return
+	}
+
+	m.Hops++
+
+	t.ringMu.Lock()
+	forward := m.Hops < t.size && t.next != m.Origin
+	t.ringMu.Unlock()
+
+	if !forward {
+		return
+	}
+
+	select {
+	case t.queue <- m:
+	default:
+		if t.logger.Enabled(ctx, slog.LevelWarn) {
+			t.logger.LogAttrs(ctx, slog.LevelWarn, "IPC queue full, updates not forwarded to the next hub of the ring", slog.String("origin", m.Origin))
+		}
+	}
+}
+
+// sendLoop sends the queued messages to the next hub of the ring.
+func (t *IPCTransport) sendLoop() {
+	defer t.wg.Done()
+
+	for {
+		select {
+		case <-t.closed:
+			return
+		case m := <-t.queue:
+			t.send(m)
+		}
+	}
+}
+
+// send sends a message to the next hub of the ring, trying the hub after it
+// once if it has left.
+func (t *IPCTransport) send(m *ipcMessage) {
+	frame, err := encodeIPCMessage(m)
+	if err != nil {
+		if t.logger.Enabled(context.Background(), slog.LevelError) {
+			t.logger.LogAttrs(context.Background(), slog.LevelError, "Unable to encode an IPC message", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	for range 2 {
+		var conn net.Conn
+
+		conn, err = t.nextConn(m.Origin)
+		if conn == nil && err == nil {
+			return
+		}
+
+		if err == nil {
+			_ = conn.SetWriteDeadline(time.Now().Add(ipcWriteTimeout))
+			if _, err = conn.Write(frame); err == nil {
+				return
+			}
+
+			t.dropConn(conn)
+		}
+
+		if isClosed(t.closed) {
+			return
+		}
+
+		t.scan()
+	}
+
+	if t.logger.Enabled(context.Background(), slog.LevelError) {
+		t.logger.LogAttrs(context.Background(), slog.LevelError, "Unable to send updates to the next hub of the IPC ring", slog.Any("error", err))
+	}
+}
+
+// nextConn returns the connection to the next hub of the ring, connecting to
+// it if needed, or nil if there is no other hub, or if the next hub is origin.
+// The sockets of the hubs not listening anymore are removed.
+func (t *IPCTransport) nextConn(origin string) (net.Conn, error) {
+	t.ringMu.Lock()
+	defer t.ringMu.Unlock()
+
+	if t.next == "" || t.next == origin {
+		return nil, nil //nolint:nilnil
+	}
+
+	if t.conn != nil {
+		return t.conn, nil
+	}
+
+	path := t.socketPath(t.next)
+
+	conn, err := net.DialTimeout("unix", path, ipcDialTimeout)
+	if err != nil {
+		if errors.Is(err, syscall.ECONNREFUSED) {
+			_ = os.Remove(path)
+		}
+
+		return nil, fmt.Errorf("unable to connect to the next hub of the IPC ring: %w", err)
+	}
+
+	t.conn = conn
+
+	return conn, nil
+}
+
+// dropConn closes the connection to the next hub, if it is still conn.
+func (t *IPCTransport) dropConn(conn net.Conn) {
+	t.ringMu.Lock()
+	defer t.ringMu.Unlock()
+
+	_ = conn.Close()
+
+	if t.conn == conn {
+		t.conn = nil
+	}
+}
+
+// scanLoop scans the directory of the sockets until the transport is closed.
+func (t *IPCTransport) scanLoop() {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(t.scanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.closed:
+			return
+		case <-ticker.C:
+			t.scan()
+		}
+	}
+}
+
+// scan lists the hubs of the ring, and finds the next one: the first one
+// sorted after this hub, or the first one of all.
+func (t *IPCTransport) scan() {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		if t.logger.Enabled(context.Background(), slog.LevelError) {
+			t.logger.LogAttrs(context.Background(), slog.LevelError, "Unable to scan the IPC ring directory", slog.String("dir", t.dir), slog.Any("error", err))
+		}
+
+		return
+	}
+
+	ids := []string{t.id}
+
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), ipcSocketSuffix); ok && id != t.id && e.Type()&os.ModeSocket != 0 {
+			ids = append(ids, id)
+		}
+	}
+
+	slices.Sort(ids)
+
+	var next string
+	if len(ids) > 1 {
+		next = ids[(slices.Index(ids, t.id)+1)%len(ids)]
+	}
+
+	t.ringMu.Lock()
+	defer t.ringMu.Unlock()
+
+	t.size = len(ids)
+
+	if next == t.next {
+		return
+	}
+
+	if t.conn != nil {
+		_ = t.conn.Close()
+		t.conn = nil
+	}
+
+	t.next = next
+}
+
+func (t *IPCTransport) socketPath(id string) string {
+	return filepath.Join(t.dir, id+ipcSocketSuffix)
+}
+
+// encodeIPCMessage encodes a message as a frame: its length as a 32-bit big
+// endian integer, followed by its JSON representation.
+func encodeIPCMessage(m *ipcMessage) ([]byte, error) {
+	body, err := json.Marshal(m)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if len(body) > maxIPCFrameSize {
+		return nil, errIPCFrameTooLarge
+	}
+
+	frame := make([]byte, 4, 4+len(body))
+	binary.BigEndian.PutUint32(frame, uint32(len(body))) //nolint:gosec
+
+	return append(frame, body...), nil
+}
+
+// readIPCMessage reads a frame written by encodeIPCMessage.
+func readIPCMessage(r io.Reader) (*ipcMessage, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	size := binary.BigEndian.Uint32(header[:])
+	if size > maxIPCFrameSize {
+		return nil, errIPCFrameTooLarge
+	}
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	var m ipcMessage
+	if err := json.Unmarshal(body, &m); err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return &m, nil
+}
+
+// AddSubscriber adds a new subscriber to the transport.
+func (t *IPCTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	return t.local.AddSubscriber(ctx, s)
+}
+
+// RemoveSubscriber removes a subscriber from the transport.
+func (t *IPCTransport) RemoveSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	return t.local.RemoveSubscriber(ctx, s)
+}
+
+// GetSubscribers gets the last event ID and the list of the subscribers of
+// the hub.
+func (t *IPCTransport) GetSubscribers(ctx context.Context) (string, []*Subscriber, error) {
+	return t.local.GetSubscribers(ctx)
+}
+
+// FetchSince returns no updates: the transport keeps no history, only the ID
+// of the last update the hub dispatched.
+func (t *IPCTransport) FetchSince(ctx context.Context, lastEventID string, topics []string, limit int) ([]*Update, error) {
+	return t.local.FetchSince(ctx, lastEventID, topics, limit)
+}
+
+// SetSubscriberShards splits the subscribers in n shards.
+func (t *IPCTransport) SetSubscriberShards(n int) {
+	t.local.SetSubscriberShards(n)
+}
+
+// Ready reports whether the socket of the hub still exists.
+func (t *IPCTransport) Ready(_ context.Context) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	if _, err := os.Stat(t.socketPath(t.id)); err != nil {
+		return fmt.Errorf("the IPC socket is gone: %w", err)
+	}
+
+	return nil
+}
+
+// Live reports whether the transport is open.
+func (t *IPCTransport) Live(_ context.Context) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	return nil
+}
+
+// Close leaves the ring, removing the socket of the hub, and disconnects all
+// the subscribers.
+func (t *IPCTransport) Close(ctx context.Context) error {
+	t.closedOnce.Do(func() {
+		close(t.closed)
+
+		if err := t.listener.Close(); err != nil {
+			t.closeErr = fmt.Errorf("unable to close the IPC socket: %w", err)
+		}
+
+		t.ringMu.Lock()
+		if t.conn != nil {
+			_ = t.conn.Close()
+			t.conn = nil
+		}
+		t.ringMu.Unlock()
+
+		t.connsMu.Lock()
+		for conn := range t.conns {
+			_ = conn.Close()
+		}
+		t.connsMu.Unlock()
+
+		t.wg.Wait()
+
+		if err := t.local.Close(ctx); err != nil && t.closeErr == nil {
+			t.closeErr = err
+		}
+	})
+
+	return t.closeErr
+}
+
+// Interface guards.
+var (
+	_ Transport                  = (*IPCTransport)(nil)
+	_ TransportSubscribers       = (*IPCTransport)(nil)
+	_ TransportGroupDispatcher   = (*IPCTransport)(nil)
+	_ TransportSubscriberSharder = (*IPCTransport)(nil)
+	_ TransportHistory           = (*IPCTransport)(nil)
+	_ TransportHealthChecker     = (*IPCTransport)(nil)
+)
@@ -0,0 +1,195 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIPCTestTransport(t *testing.T, dir string) *IPCTransport {
+	t.Helper()
+
+	transport, err := NewIPCTransport(NewSubscriberList(0), slog.Default(), dir, 10*time.Millisecond, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(t.Context()))
+	})
+
+	return transport
+}
+
+func newIPCTestSubscriber(t *testing.T, transport *IPCTransport, topic string) *LocalSubscriber {
+	t.Helper()
+
+	s := newTestSubscriber("", topic)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	return s
+}
+
+// waitIPCRing waits for all the transports to see a ring of size hubs.
+func waitIPCRing(t *testing.T, size int, transports ...*IPCTransport) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		for _, tr := range transports {
+			tr.ringMu.Lock()
+			n := tr.size
+			tr.ringMu.Unlock()
+
+			if n != size {
+				return false
+			}
+		}
+
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func receiveIPCUpdate(t *testing.T, s *LocalSubscriber) *Update {
+	t.Helper()
+
+	select {
+	case u := <-s.Receive():
+		return u
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "update not received")
+
+		return nil
+	}
+}
+
+func TestIPCTransportRing(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	transports := []*IPCTransport{newIPCTestTransport(t, dir), newIPCTestTransport(t, dir), newIPCTestTransport(t, dir)}
+	waitIPCRing(t, 3, transports...)
+
+	subscribers := make([]*LocalSubscriber, len(transports))
+	for i, tr := range transports {
+		subscribers[i] = newIPCTestSubscriber(t, tr, "https://example.com/books/1")
+	}
+
+	for i, tr := range transports {
+		u := &Update{Topic: "https://example.com/books/1", Private: true, Event: Event{Data: "from " + tr.id}}
+		require.NoError(t, tr.Dispatch(t.Context(), u))
+
+		// Every hub dispatches the update once.
+		for _, s := range subscribers {
+			received := receiveIPCUpdate(t, s)
+			assert.Equal(t, u.ID, received.ID, i)
+			assert.Equal(t, u.Data, received.Data)
+			assert.True(t, received.Private)
+		}
+	}
+
+	for _, s := range subscribers {
+		select {
+		case u := <-s.Receive():
+			assert.Failf(t, "unexpected update", "%#v", u)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	lastEventID, _, err := transports[0].GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.NotEqual(t, EarliestLastEventID, lastEventID)
+}
+
+func TestIPCTransportDispatchGroup(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	a, b := newIPCTestTransport(t, dir), newIPCTestTransport(t, dir)
+	waitIPCRing(t, 2, a, b)
+
+	s := newIPCTestSubscriber(t, b, "https://example.com/books/1")
+
+	require.NoError(t, a.DispatchGroup(t.Context(), []*Update{
+		{Topic: "https://example.com/books/1", Event: Event{Data: "1"}},
+		{Topic: "https://example.com/books/1", Event: Event{Data: "2"}},
+	}))
+
+	assert.Equal(t, "1", receiveIPCUpdate(t, s).Data)
+	assert.Equal(t, "2", receiveIPCUpdate(t, s).Data)
+}
+
+func TestIPCTransportPublishContextDone(t *testing.T) {
+	t.Parallel()
+
+	// Nothing drains the queue.
+	transport := &IPCTransport{queue: make(chan *ipcMessage), closed: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	err := transport.publish(ctx, []*Update{{Topic: "https://example.com/books/1"}})
+	require.ErrorIs(t, err, ErrPartialDispatch)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestIPCTransportLeave(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	a, b := newIPCTestTransport(t, dir), newIPCTestTransport(t, dir)
+
+	// The socket of a hub that crashed.
+	stale := filepath.Join(dir, "00000000-0000-0000-0000-000000000000"+ipcSocketSuffix)
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: stale, Net: "unix"})
+	require.NoError(t, err)
+	l.SetUnlinkOnClose(false)
+	require.NoError(t, l.Close())
+
+	c, err := NewIPCTransport(NewSubscriberList(0), slog.Default(), dir, 10*time.Millisecond, 0)
+	require.NoError(t, err)
+	waitIPCRing(t, 4, a, b, c)
+
+	sa, sb, sc := newIPCTestSubscriber(t, a, "https://example.com/books/1"), newIPCTestSubscriber(t, b, "https://example.com/books/1"), newIPCTestSubscriber(t, c, "https://example.com/books/1")
+
+	// The stale socket is skipped, and removed.
+	for _, tr := range []*IPCTransport{a, b, c} {
+		require.NoError(t, tr.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}))
+
+		for _, s := range []*LocalSubscriber{sa, sb, sc} {
+			receiveIPCUpdate(t, s)
+		}
+	}
+
+	_, err = os.Stat(stale)
+	require.ErrorIs(t, err, os.ErrNotExist)
+
+	require.NoError(t, c.Close(t.Context()))
+	_, err = os.Stat(c.socketPath(c.id))
+	require.ErrorIs(t, err, os.ErrNotExist)
+	require.ErrorIs(t, c.Ready(t.Context()), ErrClosedTransport)
+
+	// The ring is repaired.
+	for _, tr := range []*IPCTransport{a, b} {
+		require.NoError(t, tr.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}))
+		receiveIPCUpdate(t, sa)
+		receiveIPCUpdate(t, sb)
+	}
+
+	waitIPCRing(t, 2, a, b)
+	require.NoError(t, a.Ready(t.Context()))
+}
+
+func TestNewIPCTransportSocketPathTooLong(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewIPCTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), strings.Repeat("a", 100)), 0, 0)
+
+	var te *TransportError
+	require.ErrorAs(t, err, &te)
+}
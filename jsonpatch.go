@@ -0,0 +1,414 @@
+package mercure
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/url"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/maypok86/otter/v2"
+	"golang.org/x/text/language"
+)
+
+const (
+	// paramDelta is the subscribe query parameter asking the hub to send
+	// deltas instead of the full data of the updates.
+	paramDelta = "delta"
+	// deltaJSONPatch is the value of paramDelta for RFC 6902 JSON Patch
+	// deltas.
+	deltaJSONPatch = "jsonpatch"
+	// defaultJSONPatchMaxDocuments is the number of documents the hub retains
+	// when JSONPatchDeltas.MaxDocuments is not set.
+	defaultJSONPatchMaxDocuments = 10_000
+	// maxJSONPatchTopics is the number of topics for which a subscriber
+	// connection remembers the last update it received. Beyond that, it is
+	// sent full states until it received them again.
+	maxJSONPatchTopics = 1024
+)
+
+var (
+	// ErrInvalidJSONPatchDeltas is returned by NewHub when the JSON Patch
+	// deltas configuration is not valid.
+	ErrInvalidJSONPatchDeltas = errors.New("invalid JSON Patch deltas configuration")
+	// errInvalidDelta is returned when a subscriber requests an unsupported
+	// delta format.
+	errInvalidDelta = errors.New(`unsupported "delta" parameter`)
+)
+
+// JSONPatchDeltas lets publishers send the full new state of a resource,
+// while the subscribers requesting it with the delta=jsonpatch query
+// parameter receive an RFC 6902 JSON Patch from the previous state instead,
+// saving bandwidth for large documents updated frequently.
+//
+// The hub retains the data of the last update of each topic these matchers
+// match, when it is a JSON document, and computes the patch from it. The data
+// of the JSON updates sent to the subscribers in delta mode is always a JSON
+// Patch: when the subscriber didn't receive the previous state from the same
+// connection, or when the patch isn't smaller, it adds the full state at the
+// root of the document.
+//
+// The patches are computed by the hub receiving the publication: the updates
+// received from other hubs through the transport, and from the history, are
+// sent as full states.
+type JSONPatchDeltas struct {
+	// Matchers selects the topics whose updates are diffed.
+	Matchers []TopicMatcher
+	// MaxDocuments is the number of documents the hub retains, the least
+	// recently used ones being forgotten, 10000 by default.
+	MaxDocuments int
+}
+
+// jsonPatchStore retains the last data of the topics eligible to JSON Patch
+// deltas.
+type jsonPatchStore struct {
+	JSONPatchDeltas
+
+	documents *otter.Cache[string, retainedDocument]
+}
+
+// retainedDocument is the data of the last update of a topic.
+type retainedDocument struct {
+	id   string
+	data string
+}
+
+// jsonPatchDelta is the JSON Patch from the previous update of the topic to
+// an update.
+type jsonPatchDelta struct {
+	// baseID is the ID of the previous update, when it was retained.
+	baseID string
+	// base is the previous update, when it was published in the same group:
+	// its ID is only known once dispatched.
+	base *Update
+	// patch is the JSON Patch document.
+	patch string
+}
+
+func (d *jsonPatchDelta) appliesTo(id string) bool {
+	if d.base != nil {
+		return d.base.ID == id
+	}
+
+	return d.baseID == id
+}
+
+// WithJSONPatchDeltas computes JSON Patch deltas for the subscribers
+// requesting them.
+func WithJSONPatchDeltas(d JSONPatchDeltas) Option {
+	return func(o *opt) error {
+		o.jsonPatch = &jsonPatchStore{JSONPatchDeltas: d}
+
+		return nil
+	}
+}
+
+// validateJSONPatchDeltas checks the configuration once the topic matcher
+// store is configured, and creates the store of the retained documents.
+func (o *opt) validateJSONPatchDeltas() error {
+	s := o.jsonPatch
+	if s == nil {
+		return nil
+	}
+
+	if len(s.Matchers) == 0 {
+		return fmt.Errorf("%w: missing matchers", ErrInvalidJSONPatchDeltas)
+	}
+
+	for _, m := range s.Matchers {
+		if err := validateProtocolMatcher(o.topicMatcherStore, m); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrInvalidJSONPatchDeltas, m.Pattern, err)
+		}
+	}
+
+	if s.MaxDocuments < 0 {
+		return fmt.Errorf("%w: negative max documents", ErrInvalidJSONPatchDeltas)
+	}
+
+	if s.MaxDocuments == 0 {
+		s.MaxDocuments = defaultJSONPatchMaxDocuments
+	}
+
+	var err error
+	if s.documents, err = otter.New(&otter.Options[string, retainedDocument]{MaximumSize: s.MaxDocuments}); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidJSONPatchDeltas, err)
+	}
+
+	return nil
+}
+
+// diffable reports whether the update describes the JSON state of a topic
+// eligible to deltas.
+func (s *jsonPatchStore) diffable(tms *TopicMatcherStore, u *Update) bool {
+	if len(u.LocalizedData) != 0 || !json.Valid([]byte(u.Data)) {
+		return false
+	}
+
+	topics := u.topics()
+	for _, m := range s.Matchers {
+		if tms.matches(topics, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// diff attaches to the updates, in publication order, the JSON Patch from the
+// previous state of their topic.
+func (h *Hub) diff(updates ...*Update) {
+	s := h.jsonPatch
+	if s == nil {
+		return
+	}
+
+	// The previous updates of the group.
+	var pending map[string]*Update
+
+	for _, u := range updates {
+		if !s.diffable(h.topicMatcherStore, u) {
+			continue
+		}
+
+		var (
+			base       *Update
+			baseID     string
+			baseData   string
+			hasPending bool
+		)
+
+		if base, hasPending = pending[u.Topic]; hasPending {
+			baseData = base.Data
+		} else if d, ok := s.documents.GetIfPresent(u.Topic); ok {
+			baseID, baseData = d.id, d.data
+		}
+
+		if len(updates) > 1 {
+			if pending == nil {
+				pending = make(map[string]*Update)
+			}
+
+			pending[u.Topic] = u
+		}
+
+		if !hasPending && baseID == "" {
+			continue
+		}
+
+		if patch, ok := jsonPatch(baseData, u.Data); ok {
+			u.jsonPatch = &jsonPatchDelta{baseID: baseID, base: base, patch: patch}
+		}
+	}
+}
+
+// retain stores the data of the dispatched updates as the state of their
+// topic.
+func (s *jsonPatchStore) retain(tms *TopicMatcherStore, updates []*Update) {
+	for _, u := range updates {
+		if s.diffable(tms, u) {
+			s.documents.Set(u.Topic, retainedDocument{u.ID, u.Data})
+
+			continue
+		}
+
+		// Not to diff the next update against the state before this one.
+		s.documents.Invalidate(u.Topic)
+	}
+}
+
+// parseDelta reads the delta subscribe query parameter, and reports whether
+// JSON Patch deltas are requested.
+func parseDelta(values url.Values) (bool, error) {
+	switch values.Get(paramDelta) {
+	case "":
+		return false, nil
+	case deltaJSONPatch:
+		return true, nil
+	default:
+		return false, errInvalidDelta
+	}
+}
+
+// jsonPatchWriter tracks the updates received by a subscriber connection in
+// delta mode, to send it the patches it can apply.
+type jsonPatchWriter struct {
+	// lastIDs are the IDs of the last JSON updates sent, by topic.
+	lastIDs map[string]string
+}
+
+// eventFor serializes the event of the update for the subscriber: its data is
+// the JSON Patch from the last update of the topic the subscriber received,
+// or the full state when the subscriber can't apply it. Data that isn't JSON
+// is sent as is.
+func (w *jsonPatchWriter) eventFor(u *Update, languages []language.Tag) string {
+	data := u.DataFor(languages)
+	if !json.Valid([]byte(data)) {
+		delete(w.lastIDs, u.Topic)
+
+		return u.eventFor(languages)
+	}
+
+	e := u.Event
+
+	if d := u.jsonPatch; d != nil && d.appliesTo(w.lastIDs[u.Topic]) {
+		e.Data = d.patch
+	} else {
+		e.Data = fullStatePatch(data)
+	}
+
+	if w.lastIDs == nil {
+		w.lastIDs = make(map[string]string)
+	}
+
+	if _, ok := w.lastIDs[u.Topic]; !ok && len(w.lastIDs) >= maxJSONPatchTopics {
+		clear(w.lastIDs)
+	}
+
+	w.lastIDs[u.Topic] = u.ID
+
+	return e.String()
+}
+
+// fullStatePatch returns the JSON Patch replacing the whole document with
+// data.
+func fullStatePatch(data string) string {
+	return `[{"op":"add","path":"","value":` + data + `}]`
+}
+
+// jsonPatchOperation is an operation of an RFC 6902 JSON Patch.
+type jsonPatchOperation struct {
+	Op    string
+	Path  string
+	Value any
+}
+
+// jsonPatch computes the JSON Patch transforming from into to, and reports
+// whether it is smaller than the full state.
+func jsonPatch(from, to string) (string, bool) {
+	fromDoc, err := decodeJSONPatchDocument(from)
+	if err != nil {
+		return "", false
+	}
+
+	toDoc, err := decodeJSONPatchDocument(to)
+	if err != nil {
+		return "", false
+	}
+
+	ops := diffJSON(nil, "", fromDoc, toDoc)
+
+	var b bytes.Buffer
+
+	// Encoded by hand: the remove operations have no value, while the value
+	// of the others may be null.
+	b.WriteByte('[')
+
+	for i, op := range ops {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		path, _ := json.Marshal(op.Path)
+		b.WriteString(`{"op":"` + op.Op + `","path":`)
+		b.Write(path)
+
+		if op.Op != "remove" {
+			value, err := json.Marshal(op.Value)
+			if err != nil {
+				return "", false
+			}
+
+			b.WriteString(`,"value":`)
+			b.Write(value)
+		}
+
+		b.WriteByte('}')
+	}
+
+	b.WriteByte(']')
+
+	if b.Len() >= len(fullStatePatch(to)) {
+		return "", false
+	}
+
+	return b.String(), true
+}
+
+func decodeJSONPatchDocument(data string) (any, error) {
+	d := json.NewDecoder(strings.NewReader(data))
+	// Keeps the numbers as published.
+	d.UseNumber()
+
+	var doc any
+	if err := d.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("unable to decode JSON document: %w", err)
+	}
+
+	return doc, nil
+}
+
+// diffJSON appends to ops the operations transforming from into to, at path.
+func diffJSON(ops []jsonPatchOperation, path string, from, to any) []jsonPatchOperation {
+	switch from := from.(type) {
+	case map[string]any:
+		to, ok := to.(map[string]any)
+		if !ok {
+			break
+		}
+
+		for _, k := range slices.Sorted(maps.Keys(from)) {
+			if _, ok := to[k]; !ok {
+				ops = append(ops, jsonPatchOperation{Op: "remove", Path: path + "/" + escapeJSONPointer(k)})
+			}
+		}
+
+		for _, k := range slices.Sorted(maps.Keys(to)) {
+			p := path + "/" + escapeJSONPointer(k)
+
+			if f, ok := from[k]; ok {
+				ops = diffJSON(ops, p, f, to[k])
+			} else {
+				ops = append(ops, jsonPatchOperation{Op: "add", Path: p, Value: to[k]})
+			}
+		}
+
+		return ops
+	case []any:
+		to, ok := to.([]any)
+		if !ok {
+			break
+		}
+
+		common := min(len(from), len(to))
+		for i := range common {
+			ops = diffJSON(ops, path+"/"+strconv.Itoa(i), from[i], to[i])
+		}
+
+		// From the end, so the indexes stay valid.
+		for i := len(from) - 1; i >= common; i-- {
+			ops = append(ops, jsonPatchOperation{Op: "remove", Path: path + "/" + strconv.Itoa(i)})
+		}
+
+		for _, v := range to[common:] {
+			ops = append(ops, jsonPatchOperation{Op: "add", Path: path + "/-", Value: v})
+		}
+
+		return ops
+	}
+
+	if reflect.DeepEqual(from, to) {
+		return ops
+	}
+
+	return append(ops, jsonPatchOperation{Op: "replace", Path: path, Value: to})
+}
+
+// escapeJSONPointer escapes a reference token of an RFC 6901 JSON Pointer.
+func escapeJSONPointer(token string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(token)
+}
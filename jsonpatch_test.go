@@ -0,0 +1,250 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// applyJSONPatch applies the add, remove and replace operations of a JSON
+// Patch, as a subscriber does.
+func applyJSONPatch(t *testing.T, doc any, patch string) any {
+	t.Helper()
+
+	var ops []struct {
+		Op    string `json:"op"`
+		Path  string `json:"path"`
+		Value any    `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(patch), &ops))
+
+	for _, op := range ops {
+		if op.Path == "" {
+			doc = op.Value
+
+			continue
+		}
+
+		tokens := strings.Split(op.Path[1:], "/")
+		for i, token := range tokens {
+			tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		}
+
+		var set func(parent any, tokens []string) any
+
+		set = func(parent any, tokens []string) any {
+			token := tokens[0]
+
+			switch p := parent.(type) {
+			case map[string]any:
+				if len(tokens) > 1 {
+					p[token] = set(p[token], tokens[1:])
+				} else if op.Op == "remove" {
+					delete(p, token)
+				} else {
+					p[token] = op.Value
+				}
+
+				return p
+			case []any:
+				if token == "-" {
+					return append(p, op.Value)
+				}
+
+				i, err := strconv.Atoi(token)
+				require.NoError(t, err)
+
+				switch {
+				case len(tokens) > 1:
+					p[i] = set(p[i], tokens[1:])
+				case op.Op == "remove":
+					return append(p[:i], p[i+1:]...)
+				default:
+					p[i] = op.Value
+				}
+
+				return p
+			}
+
+			require.Fail(t, "invalid path", op.Path)
+
+			return nil
+		}
+
+		doc = set(doc, tokens)
+	}
+
+	return doc
+}
+
+func TestJSONPatch(t *testing.T) {
+	t.Parallel()
+
+	large := `"` + strings.Repeat("a", 100) + `"`
+
+	for _, tc := range []struct {
+		from, to string
+		patch    string
+	}{
+		{
+			`{"title":"Dune","author":"Frank Herbert","description":` + large + `}`,
+			`{"title":"Dune Messiah","author":"Frank Herbert","description":` + large + `}`,
+			`[{"op":"replace","path":"/title","value":"Dune Messiah"}]`,
+		},
+		{
+			`{"a":1,"b":{"c/d":1,"e~f":2},"description":` + large + `}`,
+			`{"a":1,"b":{"c/d":1,"e~f":3,"g":null},"description":` + large + `}`,
+			`[{"op":"replace","path":"/b/e~0f","value":3},{"op":"add","path":"/b/g","value":null}]`,
+		},
+		{
+			`{"tags":["a","b","c"],"removed":true,"description":` + large + `}`,
+			`{"tags":["a","x"],"description":` + large + `}`,
+			`[{"op":"remove","path":"/removed"},{"op":"replace","path":"/tags/1","value":"x"},{"op":"remove","path":"/tags/2"}]`,
+		},
+		{
+			`[1,2,` + large + `]`,
+			`[1,2,` + large + `,{"n":12345678901234567890}]`,
+			`[{"op":"add","path":"/-","value":{"n":12345678901234567890}}]`,
+		},
+	} {
+		patch, ok := jsonPatch(tc.from, tc.to)
+		require.True(t, ok, tc.to)
+		assert.JSONEq(t, tc.patch, patch)
+
+		var from, to any
+		require.NoError(t, json.Unmarshal([]byte(tc.from), &from))
+		require.NoError(t, json.Unmarshal([]byte(tc.to), &to))
+		assert.Equal(t, to, applyJSONPatch(t, from, patch), tc.to)
+	}
+
+	// Not smaller than the full state.
+	_, ok := jsonPatch(`{"a":1}`, `{"b":2}`)
+	assert.False(t, ok)
+
+	_, ok = jsonPatch(`{"a":1}`, `not JSON`)
+	assert.False(t, ok)
+}
+
+func TestWithJSONPatchDeltasInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, d := range []JSONPatchDeltas{
+		{},
+		{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/{"}}},
+		{Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/books/1"}}, MaxDocuments: -1},
+	} {
+		_, err := NewHub(t.Context(), WithJSONPatchDeltas(d))
+		require.ErrorIs(t, err, ErrInvalidJSONPatchDeltas, "%+v", d)
+	}
+}
+
+// booksSubscription subscribes to the books with the additional query
+// parameters, and returns a function ending the subscription and returning the
+// data of the received events.
+func booksSubscription(t *testing.T, hub *Hub, query string, subscribers int) func() []string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match_urlpattern="+url.QueryEscape("https://example.com/books/*")+query, nil).WithContext(t.Context())
+	w := newSubscribeRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), subscribers)
+
+	return func() []string {
+		_, err := hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Topics: []string{"https://example.com/books/1"}}, false)
+		require.NoError(t, err)
+		<-done
+
+		var data []string
+
+		for line := range strings.SplitSeq(w.Body.String(), "\n") {
+			if d, ok := strings.CutPrefix(line, "data: "); ok {
+				data = append(data, d)
+			}
+		}
+
+		return data
+	}
+}
+
+func TestJSONPatchDeltas(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithJSONPatchDeltas(JSONPatchDeltas{
+		Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/*"}},
+	}))
+
+	description := strings.Repeat("a", 100)
+	state := func(title string) string {
+		return `{"title":"` + title + `","description":"` + description + `"}`
+	}
+
+	publish := func(topic, data string) {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: topic, Event: Event{Data: data}}))
+	}
+
+	publish("https://example.com/books/1", state("Dune"))
+
+	deltas := booksSubscription(t, hub, "&delta=jsonpatch", 1)
+	full := booksSubscription(t, hub, "", 2)
+
+	// The subscriber doesn't have the previous state yet.
+	publish("https://example.com/books/1", state("Dune Messiah"))
+	publish("https://example.com/books/1", state("Children of Dune"))
+	publish("https://example.com/books/2", state("Hyperion"))
+	publish("https://example.com/books/2", "not JSON")
+
+	require.NoError(t, hub.PublishGroup(t.Context(), []*Update{
+		{Topic: "https://example.com/books/1", Event: Event{Data: state("God Emperor of Dune")}},
+		{Topic: "https://example.com/books/1", Event: Event{Data: state("Heretics of Dune")}},
+	}))
+
+	assert.Equal(t, []string{
+		fullStatePatch(state("Dune Messiah")),
+		`[{"op":"replace","path":"/title","value":"Children of Dune"}]`,
+		fullStatePatch(state("Hyperion")),
+		"not JSON",
+		`[{"op":"replace","path":"/title","value":"God Emperor of Dune"}]`,
+		`[{"op":"replace","path":"/title","value":"Heretics of Dune"}]`,
+	}, deltas())
+
+	assert.Equal(t, []string{
+		state("Dune Messiah"),
+		state("Children of Dune"),
+		state("Hyperion"),
+		"not JSON",
+		state("God Emperor of Dune"),
+		state("Heretics of Dune"),
+	}, full())
+}
+
+func TestSubscribeInvalidDelta(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?topic=foo&"+paramDelta+"=merge-patch", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	resp := w.Result()
+
+	t.Cleanup(func() {
+		require.NoError(t, resp.Body.Close())
+	})
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
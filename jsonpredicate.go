@@ -0,0 +1,208 @@
+package mercure
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var errInvalidJSONPredicate = errors.New("invalid JSONPath predicate")
+
+// jsonPathSegment is a step of a JSONPath: a member name, an array index, or
+// a wildcard selecting all the members or elements.
+type jsonPathSegment struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// jsonPredicate is a JSONPath expression supporting the $.member,
+// $['member'], $[index] and wildcard ($.* and $[*]) selectors, optionally
+// compared with a JSON literal using ==, !=, <, <=, > or >=.
+type jsonPredicate struct {
+	path  []jsonPathSegment
+	op    string
+	value any
+}
+
+// parseJSONPredicate parses expressions such as $.priority, $.order.total >
+// 1000 or $.tags[*] == "urgent".
+func parseJSONPredicate(expr string) (*jsonPredicate, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(expr), "$")
+	if !ok {
+		return nil, fmt.Errorf("%w %q: must start with $", errInvalidJSONPredicate, expr)
+	}
+
+	p := &jsonPredicate{}
+
+	for rest != "" && (rest[0] == '.' || rest[0] == '[') {
+		s, next, ok := parseJSONPathSegment(rest)
+		if !ok {
+			return nil, fmt.Errorf("%w %q: invalid selector %q", errInvalidJSONPredicate, expr, rest)
+		}
+
+		p.path = append(p.path, s)
+		rest = next
+	}
+
+	rest = strings.TrimSpace(rest)
+	if rest == "" {
+		return p, nil
+	}
+
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if literal, ok := strings.CutPrefix(rest, op); ok {
+			if err := json.Unmarshal([]byte(literal), &p.value); err != nil {
+				return nil, fmt.Errorf("%w %q: invalid literal: %w", errInvalidJSONPredicate, expr, err)
+			}
+
+			p.op = op
+
+			return p, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w %q: unexpected %q", errInvalidJSONPredicate, expr, rest)
+}
+
+// parseJSONPathSegment parses the selector at the beginning of expr, and
+// returns the rest of the expression.
+func parseJSONPathSegment(expr string) (s jsonPathSegment, rest string, ok bool) {
+	if name, ok := strings.CutPrefix(expr, "."); ok {
+		end := strings.IndexAny(name, ".[ =!<>")
+		if end == -1 {
+			end = len(name)
+		}
+
+		if end == 0 {
+			return s, "", false
+		}
+
+		if name[:end] == "*" {
+			return jsonPathSegment{wildcard: true}, name[end:], true
+		}
+
+		return jsonPathSegment{key: name[:end]}, name[end:], true
+	}
+
+	// Bracket notation.
+	inner := expr[1:]
+	if len(inner) > 0 && (inner[0] == '\'' || inner[0] == '"') {
+		quote := inner[0]
+
+		end := strings.IndexByte(inner[1:], quote)
+		if end == -1 || !strings.HasPrefix(inner[end+2:], "]") {
+			return s, "", false
+		}
+
+		return jsonPathSegment{key: inner[1 : end+1]}, inner[end+3:], true
+	}
+
+	end := strings.IndexByte(inner, ']')
+	if end == -1 {
+		return s, "", false
+	}
+
+	if inner[:end] == "*" {
+		return jsonPathSegment{wildcard: true}, inner[end+1:], true
+	}
+
+	index, err := strconv.Atoi(inner[:end])
+	if err != nil || index < 0 {
+		return s, "", false
+	}
+
+	return jsonPathSegment{index: index, isIndex: true}, inner[end+1:], true
+}
+
+// selectValues returns the values of the document the path selects.
+func (p *jsonPredicate) selectValues(doc any) []any {
+	values := []any{doc}
+
+	for _, s := range p.path {
+		var next []any
+
+		for _, v := range values {
+			switch v := v.(type) {
+			case map[string]any:
+				if s.wildcard {
+					for _, m := range v {
+						next = append(next, m)
+					}
+				} else if m, ok := v[s.key]; ok && !s.isIndex {
+					next = append(next, m)
+				}
+			case []any:
+				if s.wildcard {
+					next = append(next, v...)
+				} else if s.isIndex && s.index < len(v) {
+					next = append(next, v[s.index])
+				}
+			}
+		}
+
+		values = next
+	}
+
+	return values
+}
+
+// match reports whether one of the values selected in the document is
+// truthy (neither null nor false), or satisfies the comparison.
+func (p *jsonPredicate) match(doc any) bool {
+	for _, v := range p.selectValues(doc) {
+		if p.compare(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *jsonPredicate) compare(v any) bool {
+	switch p.op {
+	case "":
+		return v != nil && v != false
+	case "==":
+		return reflect.DeepEqual(v, p.value)
+	case "!=":
+		return !reflect.DeepEqual(v, p.value)
+	}
+
+	var c int
+
+	switch v := v.(type) {
+	case float64:
+		w, ok := p.value.(float64)
+		if !ok {
+			return false
+		}
+
+		c = cmp.Compare(v, w)
+	case string:
+		w, ok := p.value.(string)
+		if !ok {
+			return false
+		}
+
+		c = cmp.Compare(v, w)
+	default:
+		return false
+	}
+
+	switch p.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
@@ -0,0 +1,77 @@
+package mercure
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONPredicate(t *testing.T) {
+	t.Parallel()
+
+	var doc any
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"priority": "high",
+		"total": 1500,
+		"paid": false,
+		"customer": {"name": "Kévin", "vip": true},
+		"tags": ["urgent", "gift"],
+		"lines": [{"sku": "a", "qty": 1}, {"sku": "b", "qty": 3}],
+		"odd key": null
+	}`), &doc))
+
+	for _, tc := range []struct {
+		expr     string
+		expected bool
+	}{
+		{"$", true},
+		{"$.priority", true},
+		{"$.paid", false},
+		{"$.missing", false},
+		{"$['odd key']", false},
+		{`$.priority == "high"`, true},
+		{`$.priority != "high"`, false},
+		{`$.priority=="low"`, false},
+		{"$.total > 1000", true},
+		{"$.total >= 1500", true},
+		{"$.total < 1000", false},
+		{"$.total <= 1500", true},
+		{`$.total > "1000"`, false},
+		{`$.customer.name == "Kévin"`, true},
+		{`$["customer"]['vip'] == true`, true},
+		{"$.customer.*", true},
+		{`$.tags[0] == "urgent"`, true},
+		{`$.tags[5]`, false},
+		{`$.tags[*] == "gift"`, true},
+		{"$.lines[*].qty > 2", true},
+		{"$.lines[1].sku", true},
+		{"$.lines.sku", false},
+		{`$.customer == {"name": "Kévin", "vip": true}`, true},
+	} {
+		p, err := parseJSONPredicate(tc.expr)
+		require.NoError(t, err, tc.expr)
+		assert.Equal(t, tc.expected, p.match(doc), tc.expr)
+	}
+}
+
+func TestParseJSONPredicateInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, expr := range []string{
+		"",
+		"priority",
+		"$.",
+		"$[",
+		"$['unterminated]",
+		"$[-1]",
+		"$[a]",
+		"$.total > ",
+		"$.total ~ 3",
+		"$.total > high",
+	} {
+		_, err := parseJSONPredicate(expr)
+		require.ErrorIs(t, err, errInvalidJSONPredicate, expr)
+	}
+}
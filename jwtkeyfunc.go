@@ -19,6 +19,17 @@ type Issuer struct {
 	// resource metadata. Leave false for self-issued tokens (a key shared out
 	// of band, no authorization server).
 	AuthorizationServer bool
+	// Audiences, when set, are the audiences accepted for the tokens of this
+	// issuer, the aud claim having to contain one of them, instead of the
+	// resource identifier of the hub. Identity providers minting tokens for
+	// their own audience names can so share a hub.
+	Audiences []string
+	// ClaimNamespace, when set, prefixes the names of the claims specific to
+	// the hub in the tokens of this issuer (e.g. "https://mercure.example.com/"
+	// for "https://mercure.example.com/authorization_details"), for identity
+	// providers requiring custom claims to be namespaced. The unprefixed
+	// claims are then ignored.
+	ClaimNamespace string
 	// Publisher and Subscriber verify tokens for each role. A nil Verifier
 	// means the role is not accepted for this issuer.
 	Publisher  Verifier
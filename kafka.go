@@ -0,0 +1,873 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultKafkaTopic = "mercure"
+	// kafkaEventIDPrefix prefixes the IDs generated by the Kafka transport,
+	// followed by the offsets of the next records of the partitions.
+	kafkaEventIDPrefix = "urn:kafka:"
+	// kafkaPollTimeout is how long the REST Proxy waits for new records, in
+	// milliseconds.
+	kafkaPollTimeout = 1000
+	// kafkaRequestTimeout bounds the requests sent to the REST Proxy.
+	kafkaRequestTimeout = 30 * time.Second
+	// minKafkaReconnectDelay and maxKafkaReconnectDelay bound the delay
+	// between two attempts to recreate the consumer.
+	minKafkaReconnectDelay = 100 * time.Millisecond
+	maxKafkaReconnectDelay = 10 * time.Second
+	// kafkaHistoryEmptyPolls is the number of successive empty polls after
+	// which the remaining records of the history are considered deleted.
+	kafkaHistoryEmptyPolls = 3
+	// kafkaLiveTimeout is how long the consumer can fail before the transport
+	// isn't live anymore.
+	kafkaLiveTimeout = time.Minute
+)
+
+// KafkaTransport implements the TransportInterface using a Kafka topic,
+// through a Kafka REST Proxy (API v2), so several hubs share the history and
+// the fan-out of the updates.
+//
+// The records are keyed by the topic of the update: the updates of a topic
+// are stored in the same partition, and dispatched in order. Each hub
+// consumes all the partitions, and dispatches the records to its
+// subscribers, including the updates it published itself.
+//
+// The IDs generated by the transport are the offsets of the next records of
+// all the partitions, as consumed by the hub producing the update when it
+// produced it, the record being stored with them: the publisher and all the
+// hubs give the update the same ID. A subscriber reconnecting with such a
+// Last-Event-ID gets the records after these offsets, whatever the hub it
+// reconnects to. Custom IDs are kept, but the history can't be resumed from
+// them.
+//
+// The hub commits the offsets it consumed in the consumer group group. When no
+// group name is set, a random one is used. A set group name must be unique per
+// hub.
+type KafkaTransport struct {
+	sync.RWMutex
+
+	subscribers *SubscriberList
+	logger      *slog.Logger
+	proxy       *kafkaRESTProxy
+	group       string
+
+	readerMu    sync.Mutex
+	readErr     error
+	failingFrom time.Time
+
+	closed     chan struct{}
+	closedOnce sync.Once
+	cancel     context.CancelFunc
+	done       chan struct{}
+
+	// offsets are the offsets of the next records to dispatch, by partition.
+	offsets []int64
+}
+
+// NewKafkaTransport creates a new KafkaTransport producing to and consuming
+// the Kafka topic topic through the REST Proxy at proxyURL, committing its
+// offsets in the consumer group group. A nil client uses a client with a 30
+// seconds timeout; the credentials of proxyURL, if any, are sent with HTTP
+// Basic authentication.
+func NewKafkaTransport(
+	subscriberList *SubscriberList,
+	logger *slog.Logger,
+	proxyURL string,
+	topic string,
+	group string,
+	client *http.Client,
+) (*KafkaTransport, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return nil, &TransportError{err: err}
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, &TransportError{dsn: u.Redacted(), msg: "invalid REST Proxy URL"}
+	}
+
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+
+	if group == "" {
+		group = "mercure-" + uuid.Must(uuid.NewV4()).String()
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: kafkaRequestTimeout}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &KafkaTransport{
+		subscribers: subscriberList,
+		logger:      logger,
+		proxy:       &kafkaRESTProxy{url: u, topic: topic, client: client},
+		group:       group,
+		closed:      make(chan struct{}),
+		cancel:      cancel,
+		done:        make(chan struct{}),
+	}
+
+	// Connection errors are not *TransportError, the REST Proxy may come
+	// back.
+	c, err := t.init(ctx)
+	if err != nil {
+		cancel()
+
+		return nil, err
+	}
+
+	go t.read(ctx, c)
+
+	return t, nil
+}
+
+// init starts consuming the partitions after their last records.
+func (t *KafkaTransport) init(ctx context.Context) (*kafkaConsumer, error) {
+	ctx, cancel := context.WithTimeout(ctx, kafkaRequestTimeout)
+	defer cancel()
+
+	n, err := t.proxy.partitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the partitions of the kafka topic: %w", err)
+	}
+
+	offsets := make([]int64, n)
+
+	for partition := range offsets {
+		o, err := t.proxy.offsets(ctx, partition)
+		if err != nil {
+			return nil, fmt.Errorf("unable to get the offsets of the kafka partition %d: %w", partition, err)
+		}
+
+		offsets[partition] = o.EndOffset
+	}
+
+	t.offsets = offsets
+
+	return t.newConsumer(ctx)
+}
+
+// newConsumer creates a consumer of all the partitions, positioned at the
+// offsets of the next records to dispatch. The partitions created since are
+// consumed from their beginning.
+func (t *KafkaTransport) newConsumer(ctx context.Context) (*kafkaConsumer, error) {
+	n, err := t.proxy.partitions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the partitions of the kafka topic: %w", err)
+	}
+
+	t.Lock()
+	for len(t.offsets) < n {
+		t.offsets = append(t.offsets, 0)
+	}
+
+	offsets := slices.Clone(t.offsets)
+	t.Unlock()
+
+	partitions := make([]int, len(offsets))
+	for i := range partitions {
+		partitions[i] = i
+	}
+
+	c, err := t.proxy.newConsumer(ctx, t.group, partitions, offsets)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the kafka consumer: %w", err)
+	}
+
+	return c, nil
+}
+
+// Dispatch produces an update to the topic, the hubs dispatching it to their
+// subscribers when they consume it.
+//
+// The transport doesn't implement TransportGroupDispatcher: the records being
+// keyed by topic, the updates of a group would be spread over several
+// partitions, neither atomically nor contiguously.
+func (t *KafkaTransport) Dispatch(ctx context.Context, update *Update) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	t.RLock()
+	offsets := slices.Clone(t.offsets)
+	t.RUnlock()
+
+	updateJSON, err := marshalKafkaRecord(update, offsets)
+	if err != nil {
+		return err
+	}
+
+	records := []kafkaRecordJSON{{Key: update.Topic, Value: updateJSON}}
+
+	ctx, cancel := context.WithTimeout(ctx, kafkaRequestTimeout)
+	defer cancel()
+
+	resp, err := t.proxy.produce(ctx, records)
+	if err != nil {
+		return fmt.Errorf("unable to produce to the kafka topic: %w", err)
+	}
+
+	if update.ID == "" && len(resp.Offsets) != 0 {
+		update.ID = kafkaRecordEventID(offsets, resp.Offsets[0].Partition, resp.Offsets[0].Offset)
+	}
+
+	return nil
+}
+
+// marshalKafkaRecord returns the value of the record of the update, storing
+// the offsets consumed by the hub producing it if its ID must be generated.
+func marshalKafkaRecord(update *Update, offsets []int64) ([]byte, error) {
+	// Marshal through the pointer so Update's custom MarshalJSON applies.
+	value, err := json.Marshal(update)
+	if err != nil {
+		return nil, fmt.Errorf("error when marshaling update: %w", err)
+	}
+
+	if update.ID != "" {
+		return value, nil
+	}
+
+	positions, err := json.Marshal(kafkaRecordPositionsJSON{KafkaOffsets: offsets})
+	if err != nil {
+		return nil, fmt.Errorf("error when marshaling update: %w", err)
+	}
+
+	// Both are JSON objects: the fields are merged.
+	if len(value) > len("{}") {
+		value[len(value)-1] = ','
+	} else {
+		value = value[:1]
+	}
+
+	return append(value, positions[1:]...), nil
+}
+
+// kafkaRecordPositionsJSON holds the offsets stored in the records along with
+// the updates.
+type kafkaRecordPositionsJSON struct {
+	KafkaOffsets []int64
+}
+
+// kafkaRecordEventID returns the ID of the record at offset in partition,
+// produced by a hub having consumed offsets.
+func kafkaRecordEventID(offsets []int64, partition int, offset int64) string {
+	offsets = slices.Clone(offsets)
+	for len(offsets) <= partition {
+		offsets = append(offsets, 0)
+	}
+
+	offsets[partition] = max(offsets[partition], offset+1)
+
+	return kafkaEventID(offsets)
+}
+
+// read consumes the partitions until the transport is closed, recreating the
+// consumer when it fails.
+func (t *KafkaTransport) read(ctx context.Context, c *kafkaConsumer) {
+	defer close(t.done)
+
+	for delay := minKafkaReconnectDelay; ; delay = min(delay*2, maxKafkaReconnectDelay) {
+		var err error
+
+		if c == nil {
+			cctx, cancel := context.WithTimeout(ctx, kafkaRequestTimeout)
+			c, err = t.newConsumer(cctx)
+
+			cancel()
+		}
+
+		if c != nil {
+			delay = minKafkaReconnectDelay
+			err = t.consume(ctx, c)
+
+			cctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), kafkaRequestTimeout)
+			c.close(cctx)
+			cancel()
+
+			c = nil
+		}
+
+		if isClosed(t.closed) {
+			return
+		}
+
+		t.readerMu.Lock()
+		if t.readErr == nil {
+			t.failingFrom = time.Now()
+		}
+		t.readErr = err
+		t.readerMu.Unlock()
+
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Kafka consumer failed, reconnecting", slog.Any("error", err))
+		}
+
+		select {
+		case <-t.closed:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// consume fetches the records, dispatches them and commits their offsets
+// until the consumer fails.
+func (t *KafkaTransport) consume(ctx context.Context, c *kafkaConsumer) error {
+	for {
+		records, err := c.records(ctx, kafkaPollTimeout)
+		if err != nil {
+			return err
+		}
+
+		t.readerMu.Lock()
+		t.readErr = nil
+		t.readerMu.Unlock()
+
+		if len(records) == 0 {
+			continue
+		}
+
+		for _, r := range records {
+			t.dispatchRecord(ctx, r)
+		}
+
+		t.RLock()
+		offsets := slices.Clone(t.offsets)
+		t.RUnlock()
+
+		if err := c.commit(ctx, offsets); err != nil && t.logger.Enabled(ctx, slog.LevelWarn) {
+			t.logger.LogAttrs(ctx, slog.LevelWarn, "Unable to commit the Kafka offsets", slog.Any("error", err))
+		}
+	}
+}
+
+// dispatchRecord dispatches a record to the subscribers, unless it was
+// already dispatched or known when the hub started.
+func (t *KafkaTransport) dispatchRecord(ctx context.Context, r kafkaConsumerRecordJSON) {
+	update, err := unmarshalKafkaRecord(r)
+
+	t.Lock()
+	defer t.Unlock()
+
+	if r.Partition >= len(t.offsets) || r.Offset < t.offsets[r.Partition] {
+		return
+	}
+
+	t.offsets[r.Partition] = r.Offset + 1
+
+	if err != nil {
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from Kafka", slog.Int("partition", r.Partition), slog.Int64("offset", r.Offset), slog.Any("error", err))
+		}
+
+		return
+	}
+
+	if update.ID == "" {
+		update.ID = kafkaRecordID(r, t.offsets)
+	}
+
+	for _, s := range t.subscribers.MatchAny(update) {
+		s.Dispatch(ctx, update, false)
+	}
+}
+
+// unmarshalKafkaRecord unmarshals the update of a record. Its ID is empty
+// when it must be generated from the offsets.
+func unmarshalKafkaRecord(r kafkaConsumerRecordJSON) (*Update, error) {
+	var update *Update
+	if err := json.Unmarshal(r.Value, &update); err != nil {
+		return nil, fmt.Errorf("unable to unmarshal update: %w", err)
+	}
+
+	if update == nil {
+		return nil, errKafkaEmptyRecord
+	}
+
+	return update, nil
+}
+
+// unmarshalKafkaHistoryRecord unmarshals the update of a record of the
+// history, generating its ID if it has none.
+func unmarshalKafkaHistoryRecord(r kafkaConsumerRecordJSON, offsets []int64) (*Update, error) {
+	update, err := unmarshalKafkaRecord(r)
+	if err == nil && update.ID == "" {
+		update.ID = kafkaRecordID(r, offsets)
+	}
+
+	return update, err
+}
+
+// kafkaRecordID generates the ID of a record from the offsets stored in it.
+// The records produced by older versions have none: the offsets consumed by
+// the hub are used.
+func kafkaRecordID(r kafkaConsumerRecordJSON, consumed []int64) string {
+	var positions kafkaRecordPositionsJSON
+	if err := json.Unmarshal(r.Value, &positions); err != nil || positions.KafkaOffsets == nil {
+		return kafkaEventID(consumed)
+	}
+
+	return kafkaRecordEventID(positions.KafkaOffsets, r.Partition, r.Offset)
+}
+
+// kafkaEventID returns the ID of the position given by the offsets of the
+// next records of the partitions.
+func kafkaEventID(offsets []int64) string {
+	var b strings.Builder
+
+	b.WriteString(kafkaEventIDPrefix)
+
+	for i, o := range offsets {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+
+		b.WriteString(strconv.FormatInt(o, 10))
+	}
+
+	return b.String()
+}
+
+// parseKafkaEventID returns the offsets of the next records of the
+// partitions encoded in an ID generated by the transport.
+func parseKafkaEventID(id string) ([]int64, bool) {
+	list, ok := strings.CutPrefix(id, kafkaEventIDPrefix)
+	if !ok || list == "" {
+		return nil, false
+	}
+
+	parts := strings.Split(list, ",")
+	offsets := make([]int64, len(parts))
+
+	for i, p := range parts {
+		o, err := strconv.ParseInt(p, 10, 64)
+		if err != nil || o < 0 {
+			return nil, false
+		}
+
+		offsets[i] = o
+	}
+
+	return offsets, true
+}
+
+// EventIDCodec returns the codec of the offset vectors generated by the
+// transport.
+func (*KafkaTransport) EventIDCodec() EventIDCodec { //nolint:ireturn
+	return kafkaEventIDCodec{}
+}
+
+var errKafkaEventIDOffsets = errors.New("not a list of Kafka offsets")
+
+// kafkaEventIDCodec orders the IDs generated by the transport by their
+// offsets, the partitions missing from an ID being at offset 0.
+type kafkaEventIDCodec struct{}
+
+func (kafkaEventIDCodec) Parse(id string) (string, bool, error) {
+	if !strings.HasPrefix(id, kafkaEventIDPrefix) {
+		return "", false, nil
+	}
+
+	offsets, ok := parseKafkaEventID(id)
+	if !ok {
+		return "", true, errKafkaEventIDOffsets
+	}
+
+	return kafkaEventID(offsets), true, nil
+}
+
+func (kafkaEventIDCodec) Compare(a, b string) (int, bool) {
+	x, _ := parseKafkaEventID(a)
+	y, _ := parseKafkaEventID(b)
+
+	var before, after bool
+
+	for i := range max(len(x), len(y)) {
+		var ox, oy int64
+		if i < len(x) {
+			ox = x[i]
+		}
+
+		if i < len(y) {
+			oy = y[i]
+		}
+
+		before = before || ox < oy
+		after = after || ox > oy
+	}
+
+	switch {
+	case before && after:
+		return 0, false
+	case before:
+		return -1, true
+	case after:
+		return 1, true
+	}
+
+	return 0, true
+}
+
+// Advance merges the offsets of the cursor and of u: updates with a custom ID
+// don't move the cursor.
+func (kafkaEventIDCodec) Advance(cursor string, u *Update) string {
+	offsets, ok := parseKafkaEventID(u.ID)
+	if !ok {
+		if _, ok := parseKafkaEventID(cursor); ok {
+			return cursor
+		}
+
+		return u.ID
+	}
+
+	from, _ := parseKafkaEventID(cursor)
+	for i, o := range from {
+		if i >= len(offsets) {
+			offsets = append(offsets, o)
+		} else {
+			offsets[i] = max(offsets[i], o)
+		}
+	}
+
+	return kafkaEventID(offsets)
+}
+
+// AddSubscriber adds a new subscriber to the transport.
+func (t *KafkaTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	t.Lock()
+	// Checked again under the lock: a subscriber added after Close would never
+	// be disconnected.
+	if isClosed(t.closed) {
+		t.Unlock()
+
+		return ErrClosedTransport
+	}
+
+	t.subscribers.Add(s)
+	toOffsets := slices.Clone(t.offsets)
+	t.Unlock()
+
+	if s.RequestLastEventIDSet {
+		if err := t.dispatchHistory(ctx, s, toOffsets); err != nil {
+			return err
+		}
+	}
+
+	s.Ready(ctx)
+
+	return nil
+}
+
+// RemoveSubscriber removes a subscriber from the transport.
+func (t *KafkaTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber) error {
+	t.Lock()
+	defer t.Unlock()
+
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	t.subscribers.Remove(s)
+
+	return nil
+}
+
+// GetSubscribers gets the list of active subscribers.
+func (t *KafkaTransport) GetSubscribers(_ context.Context) (string, []*Subscriber, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return kafkaEventID(t.offsets), getSubscribers(t.subscribers), nil
+}
+
+// SetSubscriberShards splits the subscribers in n shards.
+func (t *KafkaTransport) SetSubscriberShards(n int) {
+	t.subscribers.SetShards(n)
+}
+
+// rangeHistory calls fn for the records of the partitions from the offsets
+// fromOffsets, or from their beginning if nil, up to toOffsets excluded,
+// until it returns false. The offsets passed to fn are the offsets of the
+// next records of the partitions once the record is dispatched.
+func (t *KafkaTransport) rangeHistory(ctx context.Context, fromOffsets, toOffsets []int64, fn func(r kafkaConsumerRecordJSON, offsets []int64) bool) error {
+	offsets := make([]int64, len(toOffsets))
+	if fromOffsets != nil {
+		copy(offsets, fromOffsets)
+	}
+
+	var partitions []int
+
+	for partition, to := range toOffsets {
+		if offsets[partition] < to {
+			partitions = append(partitions, partition)
+		}
+	}
+
+	if len(partitions) == 0 {
+		return nil
+	}
+
+	var start []int64
+	if fromOffsets != nil {
+		start = make([]int64, 0, len(partitions))
+		for _, partition := range partitions {
+			start = append(start, offsets[partition])
+		}
+	}
+
+	c, err := t.proxy.newConsumer(ctx, "mercure-history-"+uuid.Must(uuid.NewV4()).String(), partitions, start)
+	if err != nil {
+		return err
+	}
+	defer c.close(context.WithoutCancel(ctx))
+
+	// A partition is done once its records up to toOffsets are dispatched,
+	// or a later record is fetched: the records in between were deleted.
+	remaining := len(partitions)
+	done := make([]bool, len(toOffsets))
+
+	for partition := range done {
+		done[partition] = !slices.Contains(partitions, partition)
+	}
+
+	for empty := 0; remaining > 0 && empty < kafkaHistoryEmptyPolls; {
+		records, err := c.records(ctx, kafkaPollTimeout)
+		if err != nil {
+			return err
+		}
+
+		// The consumer may not have fetched anything yet: the remaining
+		// records are considered deleted after some empty polls only.
+		if len(records) == 0 {
+			empty++
+
+			continue
+		}
+
+		empty = 0
+
+		for _, r := range records {
+			if r.Partition >= len(toOffsets) || done[r.Partition] || r.Offset < offsets[r.Partition] {
+				continue
+			}
+
+			if r.Offset < toOffsets[r.Partition] {
+				offsets[r.Partition] = r.Offset + 1
+
+				if !fn(r, offsets) {
+					return nil
+				}
+			}
+
+			if r.Offset+1 >= toOffsets[r.Partition] {
+				done[r.Partition] = true
+				remaining--
+			}
+		}
+	}
+
+	return nil
+}
+
+func (t *KafkaTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber, toOffsets []int64) error {
+	ctx, span := startSpan(ctx, "mercure.transport.history",
+		trace.WithAttributes(
+			attribute.String("mercure.transport", "kafka"),
+			attribute.String("mercure.subscriber.id", s.ID),
+			attribute.String("mercure.last_event_id.requested", s.RequestLastEventID),
+		))
+	defer span.End()
+
+	var fromOffsets []int64
+
+	if s.RequestLastEventID != EarliestLastEventID {
+		var ok bool
+		if fromOffsets, ok = parseKafkaEventID(s.RequestLastEventID); !ok {
+			s.HistoryDispatched(kafkaEventID(toOffsets))
+
+			if t.logger.Enabled(ctx, slog.LevelInfo) {
+				t.logger.LogAttrs(ctx, slog.LevelInfo, "Can't find requested LastEventID")
+			}
+
+			return nil
+		}
+
+		// The partitions created since are replayed from their beginning.
+		for len(fromOffsets) < len(toOffsets) {
+			fromOffsets = append(fromOffsets, 0)
+		}
+	}
+
+	window := replayWindow{s: s}
+	disconnected := false
+
+	err := t.rangeHistory(ctx, fromOffsets, toOffsets, func(r kafkaConsumerRecordJSON, offsets []int64) bool {
+		update, err := unmarshalKafkaHistoryRecord(r, offsets)
+		if err != nil {
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from Kafka", slog.Int("partition", r.Partition), slog.Int64("offset", r.Offset), slog.Any("error", err))
+			}
+
+			return true
+		}
+
+		if !s.Match(update) || window.skip(update) {
+			return true
+		}
+
+		if !window.flush(ctx) || !s.Dispatch(ctx, update, true) {
+			disconnected = true
+
+			return false
+		}
+
+		return true
+	})
+
+	if err == nil && !disconnected {
+		window.flush(ctx)
+	}
+
+	// The subscriber already knows the requested position; echoing it is not a
+	// disclosure.
+	s.HistoryDispatched(s.RequestLastEventID)
+
+	if err != nil {
+		err = fmt.Errorf("unable to retrieve history from Kafka: %w", err)
+		recordSpanError(span, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// ReadHistory calls fn for every record of the partitions, partition after
+// partition.
+func (t *KafkaTransport) ReadHistory(ctx context.Context, fn func(u *Update) error) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	t.RLock()
+	toOffsets := slices.Clone(t.offsets)
+	t.RUnlock()
+
+	var fnErr error
+
+	for partition := range toOffsets {
+		to := make([]int64, len(toOffsets))
+		to[partition] = toOffsets[partition]
+
+		err := t.rangeHistory(ctx, nil, to, func(r kafkaConsumerRecordJSON, offsets []int64) bool {
+			var update *Update
+
+			if update, fnErr = unmarshalKafkaHistoryRecord(r, offsets); fnErr != nil {
+				return false
+			}
+
+			fnErr = fn(update)
+
+			return fnErr == nil
+		})
+		if err != nil {
+			return fmt.Errorf("unable to read history from Kafka: %w", err)
+		}
+
+		if fnErr != nil {
+			return fnErr
+		}
+	}
+
+	return nil
+}
+
+// Ready reports whether the REST Proxy answers.
+func (t *KafkaTransport) Ready(ctx context.Context) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+
+	if _, err := t.proxy.partitions(ctx); err != nil {
+		return fmt.Errorf("unable to reach the kafka rest proxy: %w", err)
+	}
+
+	return nil
+}
+
+// Live reports whether the topic could be consumed during the last minute.
+func (t *KafkaTransport) Live(_ context.Context) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	t.readerMu.Lock()
+	defer t.readerMu.Unlock()
+
+	if t.readErr != nil && time.Since(t.failingFrom) > kafkaLiveTimeout {
+		return fmt.Errorf("unable to consume the kafka topic since %s: %w", t.failingFrom, t.readErr)
+	}
+
+	return nil
+}
+
+// Close closes the Transport, deletes its consumer and disconnects all the
+// subscribers.
+func (t *KafkaTransport) Close(_ context.Context) error {
+	t.closedOnce.Do(func() {
+		close(t.closed)
+		t.cancel()
+
+		<-t.done
+
+		t.Lock()
+		defer t.Unlock()
+
+		t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
+			s.DisconnectWithReason(DisconnectReasonTransportClosed)
+
+			return true
+		})
+		t.subscribers.Close()
+	})
+
+	return nil
+}
+
+// Interface guards.
+var (
+	_ Transport                  = (*KafkaTransport)(nil)
+	_ TransportSubscribers       = (*KafkaTransport)(nil)
+	_ TransportHistoryReader     = (*KafkaTransport)(nil)
+	_ TransportHealthChecker     = (*KafkaTransport)(nil)
+	_ TransportSubscriberSharder = (*KafkaTransport)(nil)
+	_ TransportEventIDCodec      = (*KafkaTransport)(nil)
+)
@@ -0,0 +1,512 @@
+package mercure
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeKafkaRESTProxy implements the endpoints of the Kafka REST Proxy used by
+// KafkaTransport, for a single topic.
+type fakeKafkaRESTProxy struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	partitions [][]kafkaConsumerRecordJSON
+	consumers  map[string]*fakeKafkaConsumer
+	committed  map[string][]int64
+	produced   chan struct{}
+}
+
+type fakeKafkaConsumer struct {
+	group     string
+	positions map[int]int64
+}
+
+func newFakeKafkaRESTProxy(t *testing.T, partitions int) *fakeKafkaRESTProxy {
+	t.Helper()
+
+	p := &fakeKafkaRESTProxy{
+		partitions: make([][]kafkaConsumerRecordJSON, partitions),
+		consumers:  make(map[string]*fakeKafkaConsumer),
+		committed:  make(map[string][]int64),
+		produced:   make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /topics/mercure", p.produce)
+	mux.HandleFunc("GET /topics/mercure/partitions", p.listPartitions)
+	mux.HandleFunc("GET /topics/mercure/partitions/{partition}/offsets", p.offsets)
+	mux.HandleFunc("POST /consumers/{group}", p.createConsumer)
+	mux.HandleFunc("POST /consumers/{group}/instances/{instance}/assignments", p.assign)
+	mux.HandleFunc("POST /consumers/{group}/instances/{instance}/positions", p.seek)
+	mux.HandleFunc("POST /consumers/{group}/instances/{instance}/positions/beginning", p.seek)
+	mux.HandleFunc("GET /consumers/{group}/instances/{instance}/records", p.records)
+	mux.HandleFunc("POST /consumers/{group}/instances/{instance}/offsets", p.commit)
+	mux.HandleFunc("DELETE /consumers/{group}/instances/{instance}", p.deleteConsumer)
+
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+
+	return p
+}
+
+// dropConsumers deletes all the consumer instances, as a restart of the REST
+// Proxy does.
+func (p *fakeKafkaRESTProxy) dropConsumers() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	clear(p.consumers)
+}
+
+func (p *fakeKafkaRESTProxy) consumerCount() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.consumers)
+}
+
+func (p *fakeKafkaRESTProxy) produce(w http.ResponseWriter, r *http.Request) {
+	var req kafkaRecordsJSON
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	p.mu.Lock()
+
+	var resp kafkaProduceResponseJSON
+
+	for _, record := range req.Records {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(record.Key))
+		partition := int(h.Sum32() % uint32(len(p.partitions))) //nolint:gosec
+
+		offset := int64(len(p.partitions[partition]))
+		p.partitions[partition] = append(p.partitions[partition], kafkaConsumerRecordJSON{Key: record.Key, Value: record.Value, Partition: partition, Offset: offset})
+
+		resp.Offsets = append(resp.Offsets, struct {
+			Partition int     `json:"partition"`
+			Offset    int64   `json:"offset"`
+			ErrorCode *int    `json:"error_code"`
+			Error     *string `json:"error"`
+		}{Partition: partition, Offset: offset})
+	}
+
+	close(p.produced)
+	p.produced = make(chan struct{})
+	p.mu.Unlock()
+
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (p *fakeKafkaRESTProxy) listPartitions(w http.ResponseWriter, _ *http.Request) {
+	partitions := make([]kafkaPartitionJSON, len(p.partitions))
+	for i := range partitions {
+		partitions[i].Partition = i
+	}
+
+	_ = json.NewEncoder(w).Encode(partitions)
+}
+
+func (p *fakeKafkaRESTProxy) offsets(w http.ResponseWriter, r *http.Request) {
+	partition, _ := strconv.Atoi(r.PathValue("partition"))
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	_ = json.NewEncoder(w).Encode(kafkaOffsetsJSON{EndOffset: int64(len(p.partitions[partition]))})
+}
+
+func (p *fakeKafkaRESTProxy) createConsumer(w http.ResponseWriter, r *http.Request) {
+	id := uuid.Must(uuid.NewV4()).String()
+
+	p.mu.Lock()
+	p.consumers[id] = &fakeKafkaConsumer{group: r.PathValue("group"), positions: make(map[int]int64)}
+	p.mu.Unlock()
+
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"instance_id": id,
+		"base_uri":    p.URL + "/consumers/" + r.PathValue("group") + "/instances/" + id,
+	})
+}
+
+// consumer returns the consumer instance of the request, with the lock held.
+func (p *fakeKafkaRESTProxy) consumer(w http.ResponseWriter, r *http.Request) *fakeKafkaConsumer {
+	p.mu.Lock()
+
+	c, ok := p.consumers[r.PathValue("instance")]
+	if !ok {
+		p.mu.Unlock()
+		http.Error(w, `{"error_code":40403,"message":"Consumer instance not found."}`, http.StatusNotFound)
+	}
+
+	return c
+}
+
+func (p *fakeKafkaRESTProxy) assign(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Partitions []kafkaPartitionJSON `json:"partitions"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	c := p.consumer(w, r)
+	if c == nil {
+		return
+	}
+	defer p.mu.Unlock()
+
+	for _, a := range req.Partitions {
+		c.positions[a.Partition] = 0
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *fakeKafkaRESTProxy) seek(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Offsets []kafkaPartitionJSON `json:"offsets"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	c := p.consumer(w, r)
+	if c == nil {
+		return
+	}
+	defer p.mu.Unlock()
+
+	for _, o := range req.Offsets {
+		c.positions[o.Partition] = *o.Offset
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *fakeKafkaRESTProxy) records(w http.ResponseWriter, r *http.Request) {
+	timeout, _ := strconv.Atoi(r.URL.Query().Get("timeout"))
+	deadline := time.After(time.Duration(timeout) * time.Millisecond)
+
+	for {
+		c := p.consumer(w, r)
+		if c == nil {
+			return
+		}
+
+		records := []kafkaConsumerRecordJSON{}
+
+		for partition, position := range c.positions {
+			for _, record := range p.partitions[partition][position:] {
+				records = append(records, record)
+				c.positions[partition] = record.Offset + 1
+			}
+		}
+
+		produced := p.produced
+		p.mu.Unlock()
+
+		if len(records) > 0 {
+			_ = json.NewEncoder(w).Encode(records)
+
+			return
+		}
+
+		select {
+		case <-produced:
+		case <-deadline:
+			_, _ = w.Write([]byte("[]"))
+
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (p *fakeKafkaRESTProxy) commit(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Offsets []kafkaPartitionJSON `json:"offsets"`
+	}
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	c := p.consumer(w, r)
+	if c == nil {
+		return
+	}
+	defer p.mu.Unlock()
+
+	offsets := make([]int64, len(req.Offsets))
+	for _, o := range req.Offsets {
+		offsets[o.Partition] = *o.Offset
+	}
+
+	p.committed[c.group] = offsets
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (p *fakeKafkaRESTProxy) deleteConsumer(w http.ResponseWriter, r *http.Request) {
+	if p.consumer(w, r) == nil {
+		return
+	}
+	defer p.mu.Unlock()
+
+	delete(p.consumers, r.PathValue("instance"))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newTestKafkaTransport(t *testing.T, p *fakeKafkaRESTProxy, group string) *KafkaTransport {
+	t.Helper()
+
+	transport, err := NewKafkaTransport(NewSubscriberList(0), slog.Default(), p.URL, "", group, nil)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(t.Context()))
+	})
+
+	return transport
+}
+
+func TestKafkaTransportFanOut(t *testing.T) {
+	t.Parallel()
+
+	p := newFakeKafkaRESTProxy(t, 3)
+	publisher := newTestKafkaTransport(t, p, "")
+	transport := newTestKafkaTransport(t, p, "hub-2")
+
+	s := newTestSubscriber("", "https://example.com/books/1")
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	// The updates of a topic are dispatched in order by all the hubs.
+	published := make([]*Update, 3)
+	for i := range published {
+		published[i] = &Update{Topic: "https://example.com/books/1", Event: Event{Data: strconv.Itoa(i)}}
+		require.NoError(t, publisher.Dispatch(t.Context(), published[i]))
+	}
+
+	var lastID string
+
+	for i := range 3 {
+		u := <-s.Receive()
+		assert.Equal(t, strconv.Itoa(i), u.Data)
+		assert.True(t, strings.HasPrefix(u.ID, kafkaEventIDPrefix))
+		assert.NotEqual(t, lastID, u.ID)
+		// The publisher and the other hubs give the update the same ID.
+		assert.Equal(t, published[i].ID, u.ID)
+
+		lastID = u.ID
+	}
+
+	lastEventID, subscribers, err := transport.GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, lastID, lastEventID)
+	assert.Len(t, subscribers, 1)
+
+	// Custom IDs are kept.
+	require.NoError(t, publisher.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "custom"}}))
+	assert.Equal(t, "custom", (<-s.Receive()).ID)
+
+	require.NoError(t, transport.Ready(t.Context()))
+	require.NoError(t, transport.Live(t.Context()))
+
+	// The groups would be spread over several partitions.
+	assert.NotImplements(t, (*TransportGroupDispatcher)(nil), transport)
+	// The subscribers of the other hubs can't be disconnected.
+	assert.NotImplements(t, (*TransportDisconnecter)(nil), transport)
+
+	// The consumed offsets are committed in the group of the hub.
+	require.Eventually(t, func() bool {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		var n int64
+		for _, o := range p.committed["hub-2"] {
+			n += o
+		}
+
+		return n == 4
+	}, time.Second, time.Millisecond)
+
+	// The consumer is deleted on close.
+	require.NoError(t, publisher.Close(t.Context()))
+	assert.Equal(t, 1, p.consumerCount())
+	require.ErrorIs(t, publisher.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}), ErrClosedTransport)
+}
+
+func TestKafkaTransportHistory(t *testing.T) {
+	t.Parallel()
+
+	p := newFakeKafkaRESTProxy(t, 4)
+	transport := newTestKafkaTransport(t, p, "")
+
+	topics := []string{"https://example.com/books/1", "https://example.com/books/2", "https://example.com/books/3"}
+
+	s := newTestSubscriber("", topics...)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	// Every update is consumed before the next one is produced: its ID, made
+	// of the offsets consumed by the publisher, follows all the previous ones.
+	received := make([]*Update, 6)
+	for i := range received {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: topics[i%3], Event: Event{Data: strconv.Itoa(i)}}))
+		received[i] = <-s.Receive()
+	}
+
+	// Resuming after any update gets the updates received after it, whatever
+	// the partitions they are stored in.
+	for i, u := range received {
+		r := newTestSubscriber(u.ID, topics...)
+		require.NoError(t, transport.AddSubscriber(t.Context(), r))
+		assert.Equal(t, u.ID, <-r.responseLastEventID)
+
+		var replayed []string
+		for _, e := range received[i+1:] {
+			replayed = append(replayed, e.Data)
+		}
+
+		var got []string
+		for range received[i+1:] {
+			got = append(got, (<-r.Receive()).Data)
+		}
+
+		assert.ElementsMatch(t, replayed, got)
+	}
+
+	r := newTestSubscriber(EarliestLastEventID, topics[0])
+	require.NoError(t, transport.AddSubscriber(t.Context(), r))
+	assert.Equal(t, EarliestLastEventID, <-r.responseLastEventID)
+	assert.Equal(t, "0", (<-r.Receive()).Data)
+	assert.Equal(t, "3", (<-r.Receive()).Data)
+
+	// The history can't be resumed from unknown IDs.
+	lastEventID, _, err := transport.GetSubscribers(t.Context())
+	require.NoError(t, err)
+
+	r = newTestSubscriber("custom", topics...)
+	require.NoError(t, transport.AddSubscriber(t.Context(), r))
+	assert.Equal(t, lastEventID, <-r.responseLastEventID)
+
+	var read []string
+	require.NoError(t, transport.ReadHistory(t.Context(), func(u *Update) error {
+		read = append(read, u.Data)
+
+		return nil
+	}))
+	assert.ElementsMatch(t, []string{"0", "1", "2", "3", "4", "5"}, read)
+
+	// The history consumers are deleted.
+	require.Eventually(t, func() bool {
+		return p.consumerCount() == 1
+	}, time.Second, time.Millisecond)
+}
+
+func TestKafkaTransportReconnect(t *testing.T) {
+	t.Parallel()
+
+	p := newFakeKafkaRESTProxy(t, 2)
+	transport := newTestKafkaTransport(t, p, "")
+
+	s := newTestSubscriber("", "https://example.com/books/1")
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	p.dropConsumers()
+
+	// The update published while the hub recreates its consumer is
+	// dispatched once it resumed consuming.
+	u := &Update{Topic: "https://example.com/books/1", Event: Event{Data: "during the restart"}}
+	require.NoError(t, transport.Dispatch(t.Context(), u))
+
+	assert.Equal(t, "during the restart", (<-s.Receive()).Data)
+}
+
+func TestKafkaTransportErrors(t *testing.T) {
+	t.Parallel()
+
+	var te *TransportError
+
+	_, err := NewKafkaTransport(NewSubscriberList(0), slog.Default(), "ftp://example.com", "", "", nil)
+	require.ErrorAs(t, err, &te)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	// The REST Proxy may come back: the error is not a TransportError.
+	_, err = NewKafkaTransport(NewSubscriberList(0), slog.Default(), "http://"+l.Addr().String(), "", "", nil)
+	require.Error(t, err)
+	assert.NotErrorAs(t, err, &te)
+}
+
+func TestKafkaEventID(t *testing.T) {
+	t.Parallel()
+
+	offsets, ok := parseKafkaEventID(kafkaEventID([]int64{3, 0, 12}))
+	require.True(t, ok)
+	assert.Equal(t, []int64{3, 0, 12}, offsets)
+
+	for _, id := range []string{"", "urn:kafka:", "urn:kafka:1,a", "urn:kafka:-1", "urn:uuid:1"} {
+		_, ok := parseKafkaEventID(id)
+		assert.False(t, ok, id)
+	}
+
+	// The records produced by older versions don't store the offsets.
+	assert.Equal(t, "urn:kafka:1,3", kafkaRecordID(kafkaConsumerRecordJSON{Value: []byte(`{"Topics":["a"],"KafkaOffsets":[1]}`), Partition: 1, Offset: 2}, []int64{5, 5}))
+	assert.Equal(t, "urn:kafka:5,5", kafkaRecordID(kafkaConsumerRecordJSON{Value: []byte(`{"Topics":["a"]}`), Partition: 1, Offset: 2}, []int64{5, 5}))
+}
+
+func TestKafkaEventIDCodec(t *testing.T) {
+	t.Parallel()
+
+	c := (&KafkaTransport{}).EventIDCodec()
+
+	id, ok, err := c.Parse("urn:kafka:03,0,12")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "urn:kafka:3,0,12", id)
+
+	_, ok, err = c.Parse("urn:kafka:1,a")
+	assert.True(t, ok)
+	require.Error(t, err)
+
+	_, ok, err = c.Parse("urn:uuid:1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	for _, tc := range []struct {
+		a, b     string
+		expected int
+		ok       bool
+	}{
+		{"urn:kafka:1,2", "urn:kafka:1,2", 0, true},
+		{"urn:kafka:1,2", "urn:kafka:1,3", -1, true},
+		{"urn:kafka:2,2", "urn:kafka:1,2", 1, true},
+		// The partitions created since are at offset 0.
+		{"urn:kafka:1,2", "urn:kafka:1,2,0", 0, true},
+		{"urn:kafka:1,2", "urn:kafka:1,2,1", -1, true},
+		{"urn:kafka:2,1", "urn:kafka:1,2", 0, false},
+	} {
+		cmp, ok := c.Compare(tc.a, tc.b)
+		assert.Equal(t, tc.ok, ok, tc.a+" "+tc.b)
+		assert.Equal(t, tc.expected, cmp, tc.a+" "+tc.b)
+	}
+
+	assert.Equal(t, "urn:kafka:3,4", c.Advance("urn:kafka:3,1", &Update{Event: Event{ID: "urn:kafka:1,4"}}))
+	assert.Equal(t, "urn:kafka:3,1,5", c.Advance("urn:kafka:3,1", &Update{Event: Event{ID: "urn:kafka:2,0,5"}}))
+	assert.Equal(t, "urn:kafka:3,1", c.Advance("urn:kafka:3,1", &Update{Event: Event{ID: "custom"}}))
+	assert.Equal(t, "custom", c.Advance(EarliestLastEventID, &Update{Event: Event{ID: "custom"}}))
+}
@@ -0,0 +1,240 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+const (
+	kafkaJSONContentType = "application/vnd.kafka.json.v2+json"
+	kafkaContentType     = "application/vnd.kafka.v2+json"
+)
+
+var (
+	// errKafkaRESTProxy is returned when the Kafka REST Proxy answers with an
+	// error.
+	errKafkaRESTProxy = errors.New("kafka rest proxy error")
+	// errKafkaEmptyRecord is returned when a record holds no update.
+	errKafkaEmptyRecord = errors.New("empty kafka record")
+)
+
+// kafkaRESTProxy is a client of the API v2 of a Kafka REST Proxy, for a
+// topic.
+type kafkaRESTProxy struct {
+	url    *url.URL
+	topic  string
+	client *http.Client
+}
+
+type kafkaPartitionJSON struct {
+	Topic     string `json:"topic,omitempty"`
+	Partition int    `json:"partition"`
+	Offset    *int64 `json:"offset,omitempty"`
+}
+
+type kafkaOffsetsJSON struct {
+	BeginningOffset int64 `json:"beginning_offset"`
+	EndOffset       int64 `json:"end_offset"`
+}
+
+type kafkaProduceResponseJSON struct {
+	Offsets []struct {
+		Partition int     `json:"partition"`
+		Offset    int64   `json:"offset"`
+		ErrorCode *int    `json:"error_code"`
+		Error     *string `json:"error"`
+	} `json:"offsets"`
+}
+
+type kafkaConsumerRecordJSON struct {
+	Key       string          `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	Partition int             `json:"partition"`
+	Offset    int64           `json:"offset"`
+}
+
+// kafkaConsumer is a consumer instance of the REST Proxy.
+type kafkaConsumer struct {
+	proxy   *kafkaRESTProxy
+	baseURI string
+}
+
+// do sends a request to the REST Proxy, and decodes the JSON response in v
+// if not nil.
+func (p *kafkaRESTProxy) do(ctx context.Context, method, uri, contentType string, body, v any) error {
+	var r io.Reader
+
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("unable to marshal kafka rest proxy request: %w", err)
+		}
+
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, uri, r)
+	if err != nil {
+		return fmt.Errorf("unable to create kafka rest proxy request: %w", err)
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	req.Header.Set("Accept", kafkaJSONContentType+", "+kafkaContentType+", application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to call the kafka rest proxy: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var e struct {
+			ErrorCode int    `json:"error_code"`
+			Message   string `json:"message"`
+		}
+
+		_ = json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&e)
+
+		return fmt.Errorf("%w: %d %s", errKafkaRESTProxy, resp.StatusCode, e.Message)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("unable to decode kafka rest proxy response: %w", err)
+	}
+
+	return nil
+}
+
+func (p *kafkaRESTProxy) topicURL(elem ...string) string {
+	return p.url.JoinPath(append([]string{"topics", p.topic}, elem...)...).String()
+}
+
+// produce produces the records to the topic, and returns their partitions
+// and offsets.
+func (p *kafkaRESTProxy) produce(ctx context.Context, records []kafkaRecordJSON) (kafkaProduceResponseJSON, error) {
+	var resp kafkaProduceResponseJSON
+
+	if err := p.do(ctx, http.MethodPost, p.topicURL(), kafkaJSONContentType, kafkaRecordsJSON{records}, &resp); err != nil {
+		return resp, err
+	}
+
+	if len(resp.Offsets) != len(records) {
+		return resp, fmt.Errorf("%w: %d offsets for %d records", errKafkaRESTProxy, len(resp.Offsets), len(records))
+	}
+
+	var errs []error
+
+	for _, o := range resp.Offsets {
+		if o.Error != nil {
+			errs = append(errs, fmt.Errorf("%w: %s", errKafkaRESTProxy, *o.Error))
+		}
+	}
+
+	return resp, errors.Join(errs...)
+}
+
+// partitions returns the number of partitions of the topic.
+func (p *kafkaRESTProxy) partitions(ctx context.Context) (int, error) {
+	var partitions []kafkaPartitionJSON
+	if err := p.do(ctx, http.MethodGet, p.topicURL("partitions"), "", nil, &partitions); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, partition := range partitions {
+		n = max(n, partition.Partition+1)
+	}
+
+	return n, nil
+}
+
+// offsets returns the beginning and end offsets of a partition.
+func (p *kafkaRESTProxy) offsets(ctx context.Context, partition int) (kafkaOffsetsJSON, error) {
+	var o kafkaOffsetsJSON
+	err := p.do(ctx, http.MethodGet, p.topicURL("partitions", strconv.Itoa(partition), "offsets"), "", nil, &o)
+
+	return o, err
+}
+
+// newConsumer creates a consumer instance of the group, assigned to the
+// partitions and positioned at the offsets, or at the beginning of the
+// partitions when offsets is nil.
+func (p *kafkaRESTProxy) newConsumer(ctx context.Context, group string, partitions []int, offsets []int64) (*kafkaConsumer, error) {
+	var created struct {
+		BaseURI string `json:"base_uri"`
+	}
+
+	if err := p.do(ctx, http.MethodPost, p.url.JoinPath("consumers", group).String(), kafkaContentType, map[string]string{
+		"format":             "json",
+		"auto.offset.reset":  "earliest",
+		"auto.commit.enable": "false",
+	}, &created); err != nil {
+		return nil, err
+	}
+
+	c := &kafkaConsumer{proxy: p, baseURI: created.BaseURI}
+
+	assigned := make([]kafkaPartitionJSON, 0, len(partitions))
+	positions := make([]kafkaPartitionJSON, 0, len(offsets))
+
+	for i, partition := range partitions {
+		assigned = append(assigned, kafkaPartitionJSON{Topic: p.topic, Partition: partition})
+		if offsets != nil {
+			positions = append(positions, kafkaPartitionJSON{Topic: p.topic, Partition: partition, Offset: &offsets[i]})
+		}
+	}
+
+	err := p.do(ctx, http.MethodPost, c.baseURI+"/assignments", kafkaContentType, map[string]any{"partitions": assigned}, nil)
+	if err == nil && offsets != nil {
+		err = p.do(ctx, http.MethodPost, c.baseURI+"/positions", kafkaContentType, map[string]any{"offsets": positions}, nil)
+	}
+
+	if err == nil && offsets == nil {
+		err = p.do(ctx, http.MethodPost, c.baseURI+"/positions/beginning", kafkaContentType, map[string]any{"partitions": assigned}, nil)
+	}
+
+	if err != nil {
+		c.close(ctx)
+
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// records fetches the next records, waiting up to timeoutMS milliseconds.
+func (c *kafkaConsumer) records(ctx context.Context, timeoutMS int64) ([]kafkaConsumerRecordJSON, error) {
+	var records []kafkaConsumerRecordJSON
+	err := c.proxy.do(ctx, http.MethodGet, c.baseURI+"/records?timeout="+strconv.FormatInt(timeoutMS, 10), "", nil, &records)
+
+	return records, err
+}
+
+// commit commits the offsets of the next records to read in the partitions.
+func (c *kafkaConsumer) commit(ctx context.Context, offsets []int64) error {
+	committed := make([]kafkaPartitionJSON, 0, len(offsets))
+	for partition := range offsets {
+		committed = append(committed, kafkaPartitionJSON{Topic: c.proxy.topic, Partition: partition, Offset: &offsets[partition]})
+	}
+
+	return c.proxy.do(ctx, http.MethodPost, c.baseURI+"/offsets", kafkaContentType, map[string]any{"offsets": committed}, nil)
+}
+
+// close deletes the consumer instance, if the REST Proxy can be reached.
+func (c *kafkaConsumer) close(ctx context.Context) {
+	_ = c.proxy.do(ctx, http.MethodDelete, c.baseURI, kafkaContentType, struct{}{}, nil)
+}
@@ -0,0 +1,124 @@
+package mercure
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// defaultLameDuckRetryAfter is the delay advertised to the publishers when
+// LameDuck.RetryAfter is not set.
+const defaultLameDuckRetryAfter = 5 * time.Second
+
+// ErrInvalidLameDuck is returned by WithLameDuck when the configuration is
+// not valid.
+var ErrInvalidLameDuck = errors.New("invalid lame duck configuration")
+
+// LameDuck configures how the hub answers the publishers while it shuts down,
+// from the cancellation of the context passed to NewHub, so that their
+// retries don't lose updates during deploys.
+//
+// When PeerURL is set, the publication requests are redirected to this
+// peer hub with a 307 Temporary Redirect response, the publishers sending
+// them again, with their body, to the peer. Otherwise, the updates are
+// queued to the transport, storing them for the next instance of the hub,
+// and the hub answers with a 202 Accepted response.
+//
+// Once the transport is closed, the updates can't be queued anymore: the hub
+// answers with a 503 Service Unavailable response with a Retry-After header.
+type LameDuck struct {
+	// PeerURL is the base URL of the peer hub, such as
+	// https://hub-2.example.com. The path and the query of the request are
+	// appended to it.
+	PeerURL string
+	// RetryAfter is the delay advertised to the publishers once the
+	// transport is closed, 5 seconds by default.
+	RetryAfter time.Duration
+}
+
+// lameDuck holds the lame duck configuration of a hub.
+type lameDuck struct {
+	peerURL    *url.URL
+	retryAfter string
+}
+
+// WithLameDuck redirects or queues the publications received while the hub
+// shuts down, instead of rejecting them.
+func WithLameDuck(d LameDuck) Option {
+	return func(o *opt) error {
+		if d.RetryAfter < 0 {
+			return fmt.Errorf("%w: negative retry after", ErrInvalidLameDuck)
+		}
+
+		if d.RetryAfter == 0 {
+			d.RetryAfter = defaultLameDuckRetryAfter
+		}
+
+		ld := &lameDuck{retryAfter: strconv.Itoa(int((d.RetryAfter + time.Second - 1) / time.Second))}
+
+		if d.PeerURL != "" {
+			u, err := url.Parse(d.PeerURL)
+			if err != nil {
+				return fmt.Errorf("%w: %w", ErrInvalidLameDuck, err)
+			}
+
+			if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("%w: %q is not an absolute HTTP URL", ErrInvalidLameDuck, d.PeerURL)
+			}
+
+			ld.peerURL = u
+		}
+
+		o.lameDuck = ld
+
+		return nil
+	}
+}
+
+// isLameDuck reports whether the hub is shutting down and has a lame duck
+// configuration.
+func (h *Hub) isLameDuck() bool {
+	return h.lameDuck != nil && h.ctx.Err() != nil
+}
+
+// redirectToPeer redirects the publication request to the peer hub when the
+// hub shuts down, and reports whether it did. err is the error of the
+// publication, if it was attempted already: a closed transport means that
+// the hub shuts down, even if its context is not canceled.
+func (h *Hub) redirectToPeer(w http.ResponseWriter, r *http.Request, err error) bool {
+	if h.lameDuck == nil || h.lameDuck.peerURL == nil || (h.ctx.Err() == nil && !errors.Is(err, ErrClosedTransport)) {
+		return false
+	}
+
+	location := h.lameDuck.peerURL.JoinPath(r.URL.Path)
+	location.RawQuery = r.URL.RawQuery
+
+	if h.logger.Enabled(r.Context(), slog.LevelInfo) {
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "Redirecting publisher to the peer hub on shutdown", slog.String("location", location.Redacted()))
+	}
+
+	http.Redirect(w, r, location.String(), http.StatusTemporaryRedirect)
+
+	return true
+}
+
+// writeLameDuckError answers a publication that failed because the hub shuts
+// down, and reports whether it did.
+func (h *Hub) writeLameDuckError(w http.ResponseWriter, r *http.Request, err error) bool {
+	if h.lameDuck == nil || !errors.Is(err, ErrClosedTransport) {
+		return false
+	}
+
+	if h.redirectToPeer(w, r, err) {
+		return true
+	}
+
+	w.Header().Set("Retry-After", h.lameDuck.retryAfter)
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+	return true
+}
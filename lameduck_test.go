@@ -0,0 +1,115 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createLameDuckDummy(t *testing.T, d LameDuck) (*Hub, context.CancelFunc) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	t.Cleanup(cancel)
+
+	hub, err := NewHub(ctx, testIssuerOption(), WithResourceIdentifier(testResourceIdentifier), WithLameDuck(d))
+	require.NoError(t, err)
+
+	return hub, cancel
+}
+
+func lameDuckPublishRequest(t *testing.T, hub *Hub) *httptest.ResponseRecorder {
+	t.Helper()
+
+	form := url.Values{"topic": {"https://example.com/books/1"}, "data": {"book"}}
+
+	req := httptest.NewRequest(http.MethodPost, defaultHubURL+"?foo=bar", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestLameDuckRedirect(t *testing.T) {
+	t.Parallel()
+
+	hub, cancel := createLameDuckDummy(t, LameDuck{PeerURL: "https://hub-2.example.com/"})
+
+	assert.Equal(t, http.StatusOK, lameDuckPublishRequest(t, hub).Code)
+
+	cancel()
+
+	w := lameDuckPublishRequest(t, hub)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://hub-2.example.com/.well-known/mercure?foo=bar", w.Header().Get("Location"))
+
+	req := httptest.NewRequest(http.MethodPost, publishGroupURL, strings.NewReader(`[{"topic": "https://example.com/books/1"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+	w = httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://hub-2.example.com/.well-known/mercure/group", w.Header().Get("Location"))
+}
+
+func TestLameDuckRedirectClosedTransport(t *testing.T) {
+	t.Parallel()
+
+	hub, _ := createLameDuckDummy(t, LameDuck{PeerURL: "https://hub-2.example.com"})
+
+	// Stopping the hub without canceling its context starts the shutdown too.
+	require.NoError(t, hub.Stop(t.Context()))
+
+	w := lameDuckPublishRequest(t, hub)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://hub-2.example.com/.well-known/mercure?foo=bar", w.Header().Get("Location"))
+}
+
+func TestLameDuckQueue(t *testing.T) {
+	t.Parallel()
+
+	hub, cancel := createLameDuckDummy(t, LameDuck{RetryAfter: 1500 * time.Millisecond})
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/books/1"}), nil)
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+
+	cancel()
+
+	// The update is queued to the transport while it is open.
+	w := lameDuckPublishRequest(t, hub)
+	assert.Equal(t, http.StatusAccepted, w.Code)
+	assert.Equal(t, w.Body.String(), (<-s.Receive()).ID)
+
+	require.NoError(t, hub.Stop(t.Context()))
+
+	w = lameDuckPublishRequest(t, hub)
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+}
+
+func TestWithLameDuckInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, d := range []LameDuck{
+		{PeerURL: "/relative"},
+		{PeerURL: "ftp://hub-2.example.com"},
+		{PeerURL: "https://%zz"},
+		{RetryAfter: -time.Second},
+	} {
+		_, err := NewHub(t.Context(), WithLameDuck(d))
+		require.ErrorIs(t, err, ErrInvalidLameDuck, d)
+	}
+}
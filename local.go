@@ -2,7 +2,9 @@ package mercure
 
 import (
 	"context"
+	"fmt"
 	"sync"
+	"time"
 )
 
 // LocalTransport implements the TransportInterface without database and simply broadcast the live Updates.
@@ -13,6 +15,8 @@ type LocalTransport struct {
 	lastEventID string
 	closed      chan struct{}
 	closedOnce  sync.Once
+	idempotency idempotencyIndex
+	sequences   *topicSequences
 }
 
 // NewLocalTransport creates a new LocalTransport.
@@ -26,17 +30,32 @@ func NewLocalTransport(sl *SubscriberList) *LocalTransport {
 
 // Dispatch dispatches an update to all subscribers.
 func (t *LocalTransport) Dispatch(ctx context.Context, update *Update) error {
-	select {
-	case <-t.closed:
+	if isClosed(t.closed) {
 		return ErrClosedTransport
-	default:
+	}
+
+	// Numbered updates are dispatched one at a time, so that the subscribers
+	// receive them in the order of their numbers.
+	if t.sequences != nil {
+		return t.DispatchGroup(ctx, []*Update{update})
 	}
 
 	update.AssignUUID()
 
+	// Concurrent single updates fan out in parallel; the read lock only keeps
+	// them from interleaving with a group (see DispatchGroup), and from
+	// running while the transport closes.
+	t.RLock()
+	if isClosed(t.closed) {
+		t.RUnlock()
+
+		return ErrClosedTransport
+	}
+
 	for _, s := range t.subscribers.MatchAny(update) {
 		s.Dispatch(ctx, update, false)
 	}
+	t.RUnlock()
 
 	t.Lock()
 	t.lastEventID = update.ID
@@ -45,17 +64,58 @@ func (t *LocalTransport) Dispatch(ctx context.Context, update *Update) error {
 	return nil
 }
 
+// DispatchGroup dispatches a group of updates to all subscribers, without any
+// other update interleaved.
+func (t *LocalTransport) DispatchGroup(ctx context.Context, updates []*Update) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	for _, u := range updates {
+		u.AssignUUID()
+	}
+
+	// The write lock excludes concurrent single updates, which fan out under
+	// the read lock.
+	t.Lock()
+	defer t.Unlock()
+
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	if t.sequences != nil {
+		t.sequences.number(updates...)
+	}
+
+	for _, u := range updates {
+		for _, s := range t.subscribers.MatchAny(u) {
+			s.Dispatch(ctx, u, false)
+		}
+	}
+
+	if len(updates) > 0 {
+		t.lastEventID = updates[len(updates)-1].ID
+	}
+
+	return nil
+}
+
 // AddSubscriber adds a new subscriber to the transport.
 func (t *LocalTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
-	select {
-	case <-t.closed:
+	if isClosed(t.closed) {
 		return ErrClosedTransport
-	default:
 	}
 
 	t.Lock()
 	defer t.Unlock()
 
+	// Checked again under the lock: a subscriber added after Close would never
+	// be disconnected.
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
 	t.subscribers.Add(s)
 
 	if s.RequestLastEventIDSet {
@@ -69,15 +129,13 @@ func (t *LocalTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber)
 
 // RemoveSubscriber removes a subscriber from the transport.
 func (t *LocalTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber) error {
-	select {
-	case <-t.closed:
-		return ErrClosedTransport
-	default:
-	}
-
 	t.Lock()
 	defer t.Unlock()
 
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
 	t.subscribers.Remove(s)
 
 	return nil
@@ -91,22 +149,122 @@ func (t *LocalTransport) GetSubscribers(_ context.Context) (string, []*Subscribe
 	return t.lastEventID, getSubscribers(t.subscribers), nil
 }
 
-// Close closes the Transport.
-func (t *LocalTransport) Close(_ context.Context) (err error) {
+// FetchSince returns no updates: the local transport keeps no history, only
+// the ID of the last update, after which nothing has been published yet.
+func (t *LocalTransport) FetchSince(_ context.Context, lastEventID string, _ []string, _ int) ([]*Update, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	if lastEventID != EarliestLastEventID && lastEventID != t.lastEventID {
+		return nil, ErrUpdateNotFound
+	}
+
+	return nil, nil
+}
+
+// SetSubscriberShards splits the subscribers in n shards.
+func (t *LocalTransport) SetSubscriberShards(n int) {
+	t.subscribers.SetShards(n)
+}
+
+// DisconnectSubscribers disconnects the subscribers matching the selector.
+func (t *LocalTransport) DisconnectSubscribers(_ context.Context, sel *SubscriberSelector, dryRun bool) (int, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	if isClosed(t.closed) {
+		return 0, ErrClosedTransport
+	}
+
+	return disconnectSubscribers(t.subscribers, sel, dryRun), nil
+}
+
+// Redeliver dispatches the update to the subscribers matching the selector.
+func (t *LocalTransport) Redeliver(ctx context.Context, sel *SubscriberSelector, u *Update) (int, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	if isClosed(t.closed) {
+		return 0, ErrClosedTransport
+	}
+
+	return redeliver(ctx, t.subscribers, sel, u), nil
+}
+
+// Close closes the Transport, once the in-flight dispatches are done, and
+// disconnects all the subscribers.
+func (t *LocalTransport) Close(_ context.Context) error {
 	t.closedOnce.Do(func() {
 		t.Lock()
 		defer t.Unlock()
 
 		close(t.closed)
 		t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
-			s.Disconnect()
+			s.DisconnectWithReason(DisconnectReasonTransportClosed)
 
 			return true
 		})
+		t.subscribers.Close()
 	})
 
 	return nil
 }
 
-// Interface guard.
-var _ Transport = (*LocalTransport)(nil)
+// RememberIdempotencyKey records the idempotency key in memory.
+func (t *LocalTransport) RememberIdempotencyKey(_ context.Context, key, id string, ttl time.Duration) (string, bool, error) {
+	id, found := t.idempotency.remember(key, id, ttl)
+
+	return id, found, nil
+}
+
+// ForgetIdempotencyKey removes the idempotency key.
+func (t *LocalTransport) ForgetIdempotencyKey(_ context.Context, key string) error {
+	t.idempotency.forget(key)
+
+	return nil
+}
+
+// DispatchesSynchronously returns true: the subscribers are in memory.
+func (*LocalTransport) DispatchesSynchronously() bool {
+	return true
+}
+
+// SetRetentionExemptions accepts the forbidden topics, the transport storing
+// no update, but not the exempt ones, the transport keeping no history.
+func (*LocalTransport) SetRetentionExemptions(e RetentionExemptions) error {
+	if len(e.Exempt) != 0 {
+		return fmt.Errorf("%w: the local transport doesn't keep a history", ErrRetentionExemptionsNotSupported)
+	}
+
+	return nil
+}
+
+// EnableTopicSequences numbers the updates in memory: the numbers start over
+// when the transport is created again.
+func (t *LocalTransport) EnableTopicSequences() error {
+	t.sequences = newTopicSequences()
+
+	return nil
+}
+
+// forgetTopicSequence makes the numbering of the topic start over.
+func (t *LocalTransport) forgetTopicSequence(topic string) {
+	if t.sequences != nil {
+		t.sequences.forget(topic)
+	}
+}
+
+// Interface guards.
+var (
+	_ Transport                      = (*LocalTransport)(nil)
+	_ TransportSynchronousDispatcher = (*LocalTransport)(nil)
+	_ TransportIdempotencyIndex      = (*LocalTransport)(nil)
+	_ TransportGroupDispatcher       = (*LocalTransport)(nil)
+	_ TransportDisconnecter          = (*LocalTransport)(nil)
+	_ TransportRedeliverer           = (*LocalTransport)(nil)
+	_ TransportSubscriberSharder     = (*LocalTransport)(nil)
+	_ TransportHistory               = (*LocalTransport)(nil)
+	_ TransportRetentionExemptions   = (*LocalTransport)(nil)
+	_ TransportTopicSequencer        = (*LocalTransport)(nil)
+	_ topicSequenceForgetter         = (*LocalTransport)(nil)
+)
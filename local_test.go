@@ -168,3 +168,27 @@ func TestLocalTransportGetSubscribers(t *testing.T) {
 	assert.Contains(t, subscribers, &s1.Subscriber)
 	assert.Contains(t, subscribers, &s2.Subscriber)
 }
+
+func TestLocalTransportConcurrentClose(t *testing.T) {
+	t.Parallel()
+
+	testTransportConcurrentClose(t, NewLocalTransport(NewSubscriberList(0)))
+}
+
+func TestLocalTransportFetchSince(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0))
+	t.Cleanup(func() { require.NoError(t, transport.Close(t.Context())) })
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/1", Event: Event{ID: "1"}}))
+
+	for _, id := range []string{EarliestLastEventID, "1"} {
+		updates, err := transport.FetchSince(t.Context(), id, nil, 10)
+		require.NoError(t, err)
+		assert.Empty(t, updates)
+	}
+
+	_, err := transport.FetchSince(t.Context(), "unknown", nil, 10)
+	require.ErrorIs(t, err, ErrUpdateNotFound)
+}
@@ -0,0 +1,139 @@
+package mercure
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/language"
+)
+
+// ErrInvalidLocale is returned by Update.Validate when a key of LocalizedData
+// is not a valid BCP 47 language tag.
+var ErrInvalidLocale = errors.New("localized data key is not a valid BCP 47 language tag")
+
+// maxLocalizedVariants bounds the number of variants of an update, matched
+// against the languages of every subscriber it is sent to.
+const maxLocalizedVariants = 32
+
+// ErrTooManyLocalizedVariants is returned by Update.Validate when the update
+// has too many localized variants.
+var ErrTooManyLocalizedVariants = fmt.Errorf("too many localized variants in update (max %d)", maxLocalizedVariants)
+
+// DataFor returns the variant of the data of the update best matching the
+// languages, in decreasing order of preference, falling back to Data when
+// none of the variants of LocalizedData matches.
+func (u *Update) DataFor(languages []language.Tag) string {
+	if len(u.LocalizedData) == 0 || len(languages) == 0 {
+		return u.Data
+	}
+
+	// Data is the default variant, returned by the matcher when nothing
+	// matches.
+	locales := make([]string, 1, len(u.LocalizedData)+1)
+	tags := make([]language.Tag, 1, len(u.LocalizedData)+1)
+
+	for _, l := range slices.Sorted(maps.Keys(u.LocalizedData)) {
+		tag, err := language.Parse(l)
+		if err != nil {
+			continue
+		}
+
+		locales = append(locales, l)
+		tags = append(tags, tag)
+	}
+
+	_, i, confidence := language.NewMatcher(tags).Match(languages...)
+	if confidence == language.No || i == 0 {
+		return u.Data
+	}
+
+	return u.LocalizedData[locales[i]]
+}
+
+// eventFor serializes the event of the update with the variant of its data
+// matching the languages of a subscriber.
+func (u *Update) eventFor(languages []language.Tag) string {
+	if len(u.LocalizedData) == 0 {
+		return newSerializedUpdate(u).event
+	}
+
+	e := u.Event
+	e.Data = u.DataFor(languages)
+
+	return e.String()
+}
+
+// validateLocalizedData checks the localized variants of the data of an
+// update.
+func validateLocalizedData(data map[string]string) error {
+	if len(data) > maxLocalizedVariants {
+		return ErrTooManyLocalizedVariants
+	}
+
+	for l, d := range data {
+		if _, err := language.Parse(l); err != nil {
+			return fmt.Errorf("%q: %w", l, ErrInvalidLocale)
+		}
+
+		if !utf8.ValidString(d) {
+			return ErrInvalidData
+		}
+	}
+
+	return nil
+}
+
+// parseLocalizedData extracts the localized variants of the data from the
+// data[<locale>] publish form fields.
+func parseLocalizedData(form url.Values) map[string]string {
+	var data map[string]string
+
+	for k, v := range form {
+		l, ok := strings.CutPrefix(k, "data[")
+		if !ok || !strings.HasSuffix(l, "]") || len(v) == 0 {
+			continue
+		}
+
+		if data == nil {
+			data = make(map[string]string)
+		}
+
+		data[strings.TrimSuffix(l, "]")] = v[0]
+	}
+
+	return data
+}
+
+// subscriberLanguages returns the preferred languages of a subscriber: the
+// locale claim of its token, or else the languages of the Accept-Language
+// header.
+func subscriberLanguages(c *claims, r *http.Request) []language.Tag {
+	return preferredLanguages(c, r.Header.Get("Accept-Language"))
+}
+
+// preferredLanguages returns the locale claim of the token, or else the
+// languages of the acceptLanguage list, in the Accept-Language format.
+func preferredLanguages(c *claims, acceptLanguage string) []language.Tag {
+	if c != nil && c.Locale != "" {
+		if tag, err := language.Parse(c.Locale); err == nil {
+			return []language.Tag{tag}
+		}
+	}
+
+	if acceptLanguage == "" {
+		return nil
+	}
+
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil {
+		return nil
+	}
+
+	return tags
+}
@@ -0,0 +1,173 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/text/language"
+)
+
+func TestUpdateDataFor(t *testing.T) {
+	t.Parallel()
+
+	u := &Update{
+		Event:         Event{Data: "Hi"},
+		LocalizedData: map[string]string{"en": "Hello", "fr": "Bonjour", "pt-BR": "Olá"},
+	}
+
+	for _, tc := range []struct {
+		languages []string
+		expected  string
+	}{
+		{nil, "Hi"},
+		{[]string{"fr"}, "Bonjour"},
+		{[]string{"fr-CA"}, "Bonjour"},
+		{[]string{"en-GB"}, "Hello"},
+		{[]string{"pt"}, "Olá"},
+		{[]string{"de"}, "Hi"},
+		{[]string{"de", "fr"}, "Bonjour"},
+	} {
+		languages := make([]language.Tag, len(tc.languages))
+		for i, l := range tc.languages {
+			languages[i] = language.MustParse(l)
+		}
+
+		assert.Equal(t, tc.expected, u.DataFor(languages), "%v", tc.languages)
+	}
+
+	assert.Equal(t, "Hi", (&Update{Event: Event{Data: "Hi"}}).DataFor([]language.Tag{language.French}))
+}
+
+func TestValidateLocalizedData(t *testing.T) {
+	t.Parallel()
+
+	u := &Update{Topic: "https://example.com/books/1", LocalizedData: map[string]string{"fr": "Bonjour", "en-US": "Hello"}}
+	require.NoError(t, u.Validate())
+
+	u.LocalizedData = map[string]string{"not a tag": "Bonjour"}
+	require.ErrorIs(t, u.Validate(), ErrInvalidLocale)
+
+	u.LocalizedData = map[string]string{"fr": "\xff"}
+	require.ErrorIs(t, u.Validate(), ErrInvalidData)
+}
+
+func TestParseLocalizedData(t *testing.T) {
+	t.Parallel()
+
+	assert.Nil(t, parseLocalizedData(url.Values{"data": {"Hi"}}))
+	assert.Equal(t, map[string]string{"fr": "Bonjour", "en-US": "Hello"}, parseLocalizedData(url.Values{
+		"data":        {"Hi"},
+		"data[fr]":    {"Bonjour"},
+		"data[en-US]": {"Hello"},
+		"data[empty":  {"ignored"},
+	}))
+}
+
+func TestUpdateJSONLocalizedData(t *testing.T) {
+	t.Parallel()
+
+	u := &Update{Topic: "https://example.com/books/1", LocalizedData: map[string]string{"fr": "Bonjour"}}
+
+	b, err := json.Marshal(u)
+	require.NoError(t, err)
+
+	var decoded *Update
+	require.NoError(t, json.Unmarshal(b, &decoded))
+	assert.Equal(t, u.LocalizedData, decoded.LocalizedData)
+}
+
+func TestSubscribeLocalized(t *testing.T) {
+	t.Parallel()
+
+	token := jwt.New(jwt.SigningMethodHS256)
+	token.Header["typ"] = atJWTType
+	token.Claims = &claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testResourceIdentifier},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		AuthorizationDetails: subscribeDetailsFromMatchers(nil, TopicMatcher{Type: MatcherTypeExact, Pattern: "*"}),
+		Locale:               "en",
+	}
+
+	localeToken, err := token.SignedString([]byte("subscriber"))
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name     string
+		header   http.Header
+		expected string
+	}{
+		{"default", http.Header{}, "data: Hi\n"},
+		{"accept-language", http.Header{"Accept-Language": {"de;q=0.9, fr-CH, en;q=0.8"}}, "data: Bonjour\n"},
+		{"locale claim", http.Header{"Accept-Language": {"fr"}, "Authorization": {bearerPrefix + localeToken}}, "data: Hello\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			hub := createAnonymousDummy(t)
+
+			req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1", nil).WithContext(t.Context())
+			req.Header = tc.header
+
+			w := newSubscribeRecorder()
+			done := make(chan struct{})
+
+			go func() {
+				defer close(done)
+
+				hub.SubscribeHandler(w, req)
+			}()
+
+			waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+			require.NoError(t, hub.Publish(t.Context(), &Update{
+				Topic:         "https://example.com/books/1",
+				Event:         Event{Data: "Hi"},
+				LocalizedData: map[string]string{"en": "Hello", "fr": "Bonjour"},
+			}))
+
+			// The handler writes the updates received before the disconnection.
+			_, err := hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Topics: []string{"https://example.com/books/1"}}, false)
+			require.NoError(t, err)
+			<-done
+
+			assert.Contains(t, w.Body.String(), tc.expected)
+		})
+	}
+}
+
+func TestPublishLocalized(t *testing.T) {
+	t.Parallel()
+
+	hooks := make(chanPublishHookTarget, 1)
+	hub := createDummy(t, WithPublishHooks(PublishHook{Target: hooks}))
+
+	form := url.Values{"topic": {"https://example.com/books/1"}, "data": {"Hi"}, "data[fr]": {"Bonjour"}}
+	req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+	w := httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, map[string]string{"fr": "Bonjour"}, (<-hooks).LocalizedData)
+
+	form.Set("data[not a tag]", "Bonjour")
+	req = httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+	w = httptest.NewRecorder()
+	hub.PublishHandler(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,419 @@
+package mercure
+
+import (
+	"log/slog"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"testing/synctest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// simTopics are the topics of the updates of the simulation.
+//
+//nolint:gochecknoglobals
+var simTopics = []string{"https://example.com/a", "https://example.com/b", "https://example.com/c"}
+
+// simSubscriber is the model of a subscriber: its matchers, and the updates
+// it received.
+type simSubscriber struct {
+	s        *LocalSubscriber
+	topics   []string
+	private  []string
+	active   bool
+	closed   bool
+	received map[*Update]bool
+}
+
+func (m *simSubscriber) match(u *Update) bool {
+	return slices.Contains(m.topics, u.Topic) && (!u.Private || slices.Contains(m.private, u.Topic))
+}
+
+// simOp is a step of the simulation: a dispatch, a group, or the addition or
+// the removal of a subscriber.
+type simOp struct {
+	updates []*Update
+	group   bool
+	add     *simSubscriber
+	remove  *simSubscriber
+}
+
+// simulation drives a LocalTransport with random operations, some of them
+// running concurrently, and checks it against a model.
+type simulation struct {
+	t         *testing.T
+	rng       *rand.Rand
+	transport *LocalTransport
+	tms       *TopicMatcherStore
+
+	lastUpdate  int
+	subscribers []*simSubscriber
+}
+
+// TestLocalTransportSimulation checks that, whatever the interleaving of the
+// operations, the subscribers receive exactly the updates matching them once,
+// the updates of a group in order and without any other update in between,
+// nothing after their removal, and that closing the transport disconnects all
+// the subscribers and stops all the goroutines. Each seed is a reproducible
+// sequence of operations: run a failing one with -run 'TestLocalTransportSimulation/seed=N$'.
+func TestLocalTransportSimulation(t *testing.T) {
+	t.Parallel()
+
+	seeds := 100
+	if testing.Short() {
+		seeds = 10
+	}
+
+	for seed := range uint64(seeds) {
+		t.Run("seed="+strconv.FormatUint(seed, 10), func(t *testing.T) {
+			t.Parallel()
+
+			synctest.Test(t, func(t *testing.T) {
+				rng := rand.New(rand.NewPCG(seed, 0)) //nolint:gosec
+
+				cacheSize := 0
+				if rng.IntN(2) == 0 {
+					cacheSize = 10
+				}
+
+				sim := &simulation{t: t, rng: rng, transport: NewLocalTransport(NewSubscriberList(cacheSize)), tms: &TopicMatcherStore{}}
+				sim.run(100)
+			})
+		})
+	}
+}
+
+func (sim *simulation) run(steps int) {
+	for range steps {
+		if sim.rng.IntN(20) == 0 {
+			sim.transport.SetSubscriberShards(1 + sim.rng.IntN(3))
+		}
+
+		n := 1
+		if sim.rng.IntN(3) == 0 {
+			n = 2 + sim.rng.IntN(3)
+		}
+
+		ops := sim.newOps(n)
+		for _, err := range sim.exec(ops, nil) {
+			require.NoError(sim.t, err)
+		}
+
+		sim.check(ops, false)
+	}
+
+	sim.close()
+}
+
+// newOps creates n random operations, removing each subscriber at most once.
+func (sim *simulation) newOps(n int) []simOp {
+	ops := make([]simOp, 0, n)
+	removed := make(map[*simSubscriber]bool)
+
+	for range n {
+		switch r := sim.rng.IntN(9); {
+		case r < 4:
+			ops = append(ops, simOp{updates: []*Update{sim.newUpdate()}})
+		case r < 6:
+			updates := make([]*Update, 1+sim.rng.IntN(3))
+			for i := range updates {
+				updates[i] = sim.newUpdate()
+			}
+
+			ops = append(ops, simOp{updates: updates, group: true})
+		case r < 8:
+			ops = append(ops, simOp{add: sim.newSubscriber()})
+		default:
+			var candidates []*simSubscriber
+
+			for _, m := range sim.subscribers {
+				if m.active && !removed[m] {
+					candidates = append(candidates, m)
+				}
+			}
+
+			if len(candidates) == 0 {
+				ops = append(ops, simOp{updates: []*Update{sim.newUpdate()}})
+
+				continue
+			}
+
+			m := candidates[sim.rng.IntN(len(candidates))]
+			removed[m] = true
+
+			ops = append(ops, simOp{remove: m})
+		}
+	}
+
+	return ops
+}
+
+func (sim *simulation) newUpdate() *Update {
+	sim.lastUpdate++
+
+	return &Update{
+		Topic:   simTopics[sim.rng.IntN(len(simTopics))],
+		Private: sim.rng.IntN(4) == 0,
+		Event:   Event{ID: "urn:uuid:" + strconv.Itoa(sim.lastUpdate)},
+	}
+}
+
+func (sim *simulation) newSubscriber() *simSubscriber {
+	m := &simSubscriber{received: make(map[*Update]bool)}
+
+	for _, topic := range simTopics {
+		if sim.rng.IntN(2) == 0 {
+			m.topics = append(m.topics, topic)
+		}
+
+		if sim.rng.IntN(2) == 0 {
+			m.private = append(m.private, topic)
+		}
+	}
+
+	lastEventID := ""
+	if sim.rng.IntN(4) == 0 {
+		lastEventID = EarliestLastEventID
+	}
+
+	m.s = NewLocalSubscriber(lastEventID, slog.Default(), sim.tms)
+	m.s.setMatchers(stringsToExactMatchers(m.topics), stringsToExactMatchers(m.private))
+
+	return m
+}
+
+// exec runs the operations, concurrently when there are several, and extra
+// after the other operations have started.
+func (sim *simulation) exec(ops []simOp, extra func()) []error {
+	ctx := sim.t.Context()
+	errs := make([]error, len(ops))
+
+	for _, op := range ops {
+		if op.add != nil {
+			sim.subscribers = append(sim.subscribers, op.add)
+		}
+	}
+
+	run := func(i int) {
+		switch op := ops[i]; {
+		case op.add != nil:
+			errs[i] = sim.transport.AddSubscriber(ctx, op.add.s)
+		case op.remove != nil:
+			// As the hub does when a subscriber goes away.
+			op.remove.s.Disconnect()
+			errs[i] = sim.transport.RemoveSubscriber(ctx, op.remove.s)
+		case op.group:
+			errs[i] = sim.transport.DispatchGroup(ctx, op.updates)
+		default:
+			errs[i] = sim.transport.Dispatch(ctx, op.updates[0])
+		}
+	}
+
+	if len(ops) == 1 && extra == nil {
+		run(0)
+
+		return errs
+	}
+
+	var wg sync.WaitGroup
+	for i := range ops {
+		wg.Go(func() { run(i) })
+	}
+
+	if extra != nil {
+		wg.Go(extra)
+	}
+
+	wg.Wait()
+
+	return errs
+}
+
+// check drains the subscribers, and compares what they received during the
+// operations with the model.
+func (sim *simulation) check(ops []simOp, closing bool) {
+	t := sim.t
+	batch := make(map[*Update]bool)
+
+	for _, op := range ops {
+		for _, u := range op.updates {
+			batch[u] = true
+		}
+	}
+
+	for _, m := range sim.subscribers {
+		if m.closed {
+			continue
+		}
+
+		added := slices.ContainsFunc(ops, func(op simOp) bool { return op.add == m })
+		removed := slices.ContainsFunc(ops, func(op simOp) bool { return op.remove == m })
+		received := sim.drain(m)
+
+		for _, u := range received {
+			require.True(t, batch[u], "%s received an update of a previous step", m.s.ID)
+			require.True(t, m.match(u), "%s received an update not matching it", m.s.ID)
+			require.False(t, m.received[u], "%s received an update twice", m.s.ID)
+
+			m.received[u] = true
+		}
+
+		// The subscribers present during all the operations receive all the
+		// matching updates.
+		if !closing && !added && !removed {
+			for u := range batch {
+				assert.Equal(t, m.match(u), m.received[u], "%s and %s", m.s.ID, u.ID)
+			}
+		}
+
+		for _, op := range ops {
+			if op.group {
+				sim.checkGroup(m, op.updates, received, added || removed || closing)
+			}
+		}
+
+		if removed {
+			require.True(t, m.closed, "%s not disconnected after its removal", m.s.ID)
+
+			m.active = false
+
+			continue
+		}
+
+		if added {
+			m.active = true
+		}
+	}
+
+	if closing {
+		return
+	}
+
+	// The transport only keeps the active subscribers.
+	_, subscribers, err := sim.transport.GetSubscribers(t.Context())
+	require.NoError(t, err)
+
+	var want, got []string
+
+	for _, m := range sim.subscribers {
+		if m.active {
+			want = append(want, m.s.ID)
+		}
+	}
+
+	for _, s := range subscribers {
+		got = append(got, s.ID)
+	}
+
+	assert.ElementsMatch(t, want, got)
+	assert.Equal(t, len(want), sim.transport.subscribers.Len())
+
+	sim.checkLastEventID(ops)
+}
+
+// drain returns the updates the subscriber received, and whether it got
+// disconnected.
+func (sim *simulation) drain(m *simSubscriber) (received []*Update) {
+	for {
+		select {
+		case u, ok := <-m.s.Receive():
+			if !ok {
+				m.closed = true
+
+				return received
+			}
+
+			received = append(received, u)
+		default:
+			return received
+		}
+	}
+}
+
+// checkGroup checks that the subscriber received the matching updates of the
+// group in order and without any other update in between: all of them, or,
+// when partial is true, none of them or the first ones.
+func (sim *simulation) checkGroup(m *simSubscriber, group, received []*Update, partial bool) {
+	var matching []*Update
+
+	for _, u := range group {
+		if m.match(u) {
+			matching = append(matching, u)
+		}
+	}
+
+	start := slices.IndexFunc(received, func(u *Update) bool { return slices.Contains(matching, u) })
+	if start == -1 {
+		require.True(sim.t, partial || len(matching) == 0, "%s didn't receive the group", m.s.ID)
+
+		return
+	}
+
+	n := 0
+	for n < len(matching) && start+n < len(received) && received[start+n] == matching[n] {
+		n++
+	}
+
+	require.True(sim.t, n == len(matching) || partial, "%s received the group interleaved or incomplete", m.s.ID)
+
+	for _, u := range received[start+n:] {
+		require.NotContains(sim.t, matching, u, "%s received the group interleaved or out of order", m.s.ID)
+	}
+}
+
+// checkLastEventID checks that the last event ID of the transport is the one
+// of the last update of one of the dispatches of the step.
+func (sim *simulation) checkLastEventID(ops []simOp) {
+	var candidates []string
+
+	for _, op := range ops {
+		if len(op.updates) > 0 {
+			candidates = append(candidates, op.updates[len(op.updates)-1].ID)
+		}
+	}
+
+	if len(candidates) == 0 {
+		return
+	}
+
+	lastEventID, _, err := sim.transport.GetSubscribers(sim.t.Context())
+	require.NoError(sim.t, err)
+	assert.Contains(sim.t, candidates, lastEventID)
+}
+
+// close closes the transport while other operations are running, then checks
+// that all the subscribers got disconnected and the transport rejects new
+// operations.
+func (sim *simulation) close() {
+	t := sim.t
+	ctx := t.Context()
+
+	ops := sim.newOps(1 + sim.rng.IntN(4))
+	for i, err := range sim.exec(ops, func() { assert.NoError(t, sim.transport.Close(ctx)) }) {
+		if err == nil {
+			continue
+		}
+
+		require.ErrorIs(t, err, ErrClosedTransport)
+
+		// The rejected subscribers are left to the caller.
+		if m := ops[i].add; m != nil {
+			sim.subscribers = slices.DeleteFunc(sim.subscribers, func(s *simSubscriber) bool { return s == m })
+		}
+	}
+
+	sim.check(ops, true)
+
+	for _, m := range sim.subscribers {
+		require.True(t, m.closed, "%s not disconnected by Close", m.s.ID)
+	}
+
+	require.ErrorIs(t, sim.transport.Dispatch(ctx, sim.newUpdate()), ErrClosedTransport)
+	require.ErrorIs(t, sim.transport.DispatchGroup(ctx, []*Update{sim.newUpdate()}), ErrClosedTransport)
+
+	require.ErrorIs(t, sim.transport.AddSubscriber(ctx, sim.newSubscriber().s), ErrClosedTransport)
+}
@@ -3,8 +3,10 @@ package mercure
 import (
 	"context"
 	"log/slog"
+	"slices"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 )
@@ -13,15 +15,86 @@ import (
 type LocalSubscriber struct {
 	Subscriber
 
+	// AddressFamily is the network family the subscriber connected through.
+	AddressFamily AddressFamily
+
 	disconnected        atomic.Uint32
 	out                 chan *Update
 	mutex               sync.Mutex
 	responseLastEventID chan string
 	ready               atomic.Uint32
 	liveQueue           []*Update
+	callbacks           SubscriberCallbacks
+	delivered           bool
+	prioritized         bool
+	overflowPolicy      OverflowPolicy
+	overflows           int
+	shedding            *DispatchQueues
+	disconnectReason    DisconnectReason
+	counters            subscriberCounters
+	deliveryRates       deliveryRates
+	bandwidth           *subscriberBandwidth
+	timeTravel          bool
 }
 
-const outBufferLength = 1000
+// DisconnectReason is why a subscriber has been disconnected.
+type DisconnectReason string
+
+const (
+	// DisconnectReasonClient is reported when the client closed the
+	// connection, or when the context of Hub.Subscribe is done.
+	DisconnectReasonClient DisconnectReason = "client"
+	// DisconnectReasonSlowConsumer is reported when the subscriber doesn't
+	// receive the updates fast enough.
+	DisconnectReasonSlowConsumer DisconnectReason = "slow_consumer"
+	// DisconnectReasonDeadline is reported when the connection reached its
+	// write timeout.
+	DisconnectReasonDeadline DisconnectReason = "deadline"
+	// DisconnectReasonTokenExpired is reported when the token of the
+	// subscriber expired.
+	DisconnectReasonTokenExpired DisconnectReason = "token_expired"
+	// DisconnectReasonWriteFailed is reported when an update or a heartbeat
+	// couldn't be written to the connection.
+	DisconnectReasonWriteFailed DisconnectReason = "write_failed"
+	// DisconnectReasonKicked is reported when the subscriber has been
+	// disconnected by Hub.DisconnectSubscribers.
+	DisconnectReasonKicked DisconnectReason = "kicked"
+	// DisconnectReasonHubShutdown is reported when the hub stopped.
+	DisconnectReasonHubShutdown DisconnectReason = "hub_shutdown"
+	// DisconnectReasonTransportClosed is reported when the transport has been
+	// closed.
+	DisconnectReasonTransportClosed DisconnectReason = "transport_closed"
+	// DisconnectReasonUnknown is reported when Disconnect is called directly.
+	DisconnectReasonUnknown DisconnectReason = "unknown"
+)
+
+// SubscriberCallbacks are called during the lifecycle of a subscriber, for
+// instance to account application-level sessions. They are called
+// synchronously, from the goroutine dispatching the updates or disconnecting
+// the subscriber, and must not block. Nil callbacks are ignored.
+type SubscriberCallbacks struct {
+	// OnFirstDelivery is called when the first update, live or from the
+	// history, is handed to the subscriber.
+	OnFirstDelivery func(s *LocalSubscriber, u *Update)
+	// OnHistoryReplayed is called when the updates of the history requested
+	// with Last-Event-ID have all been dispatched, with the ID of the last
+	// event sent back to the client.
+	OnHistoryReplayed func(s *LocalSubscriber, lastEventID string)
+	// OnDisconnect is called once, when the subscriber is disconnected.
+	OnDisconnect func(s *LocalSubscriber, reason DisconnectReason)
+	// OnDrop is called for every update dropped because the subscriber
+	// doesn't receive the updates fast enough: the ones of lower priority
+	// making room for others (see Update.Priority), the one that didn't fit in
+	// its buffer, the ones shed above the dispatch watermark (see
+	// WithDispatchWatermark), and the ones dispatched until it is removed from
+	// the transport.
+	OnDrop func(s *LocalSubscriber, u *Update)
+	// OnOverflow is called every time an update doesn't fit in the buffer of
+	// the subscriber, with the overflow policy applied.
+	OnOverflow func(s *LocalSubscriber, policy OverflowPolicy)
+}
+
+const outBufferLength = DefaultSubscriberBufferSize
 
 // NewLocalSubscriber creates a new subscriber.
 func NewLocalSubscriber(lastEventID string, logger *slog.Logger, topicMatcherStore *TopicMatcherStore) *LocalSubscriber {
@@ -30,6 +103,7 @@ func NewLocalSubscriber(lastEventID string, logger *slog.Logger, topicMatcherSto
 		Subscriber:          *NewSubscriber(logger, topicMatcherStore),
 		responseLastEventID: make(chan string, 1),
 		out:                 make(chan *Update, outBufferLength),
+		overflowPolicy:      OverflowDisconnect,
 	}
 
 	s.ID = id
@@ -40,59 +114,316 @@ func NewLocalSubscriber(lastEventID string, logger *slog.Logger, topicMatcherSto
 	return s
 }
 
+// SetCallbacks registers the lifecycle callbacks of the subscriber. It must be
+// called before adding the subscriber to a transport.
+func (s *LocalSubscriber) SetCallbacks(c SubscriberCallbacks) {
+	s.callbacks = c
+}
+
 // Dispatch an update to the subscriber.
 // Security checks must (topics matching) be done before calling Dispatch,
 // for instance by calling Match.
 func (s *LocalSubscriber) Dispatch(ctx context.Context, u *Update, fromHistory bool) bool {
+	// The expired updates are only meaningful live.
+	if s.staleStateVersion(u) || (fromHistory && u.expired(time.Now())) {
+		return s.disconnected.Load() == 0
+	}
+
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	ok, first, disconnected, dropped := s.dispatch(ctx, u, fromHistory)
+	overflows := s.takeOverflows()
+	s.mutex.Unlock()
+
+	s.notifyOverflows(overflows)
 
+	// The callbacks are called without holding the lock, they may call the
+	// methods of the subscriber.
+	if first && s.callbacks.OnFirstDelivery != nil {
+		s.callbacks.OnFirstDelivery(s, u)
+	}
+
+	if disconnected {
+		s.notifyDisconnect()
+	}
+
+	if dropped != nil {
+		s.notifyDrop(dropped)
+	}
+
+	return ok
+}
+
+// dispatch must be called with mutex held. It also reports whether u is the
+// first update sent to the subscriber, whether the subscriber got
+// disconnected, and the update dropped, if any: u, or an update of lower
+// priority it replaced.
+func (s *LocalSubscriber) dispatch(ctx context.Context, u *Update, fromHistory bool) (ok, first, disconnected bool, dropped *Update) {
 	if s.disconnected.Load() > 0 {
-		return false
+		if s.disconnectReason == DisconnectReasonSlowConsumer {
+			s.countDrop(u)
+
+			return false, false, false, u
+		}
+
+		return false, false, false, nil
+	}
+
+	// Counted as dropped, but the update isn't handed to OnDrop: the
+	// subscriber isn't slow, its token limits what it receives.
+	if !fromHistory && s.rateLimited(u) {
+		s.countDrop(u)
+
+		return true, false, false, nil
 	}
 
 	if !fromHistory && s.ready.Load() < 1 {
 		s.liveQueue = append(s.liveQueue, u)
 
-		return true
+		if u.receipt != nil {
+			u.receipt.queued.Add(1)
+		}
+
+		return true, false, false, nil
+	}
+
+	if !fromHistory && s.shedding != nil && s.shedding.sheds(len(s.out)) {
+		s.countDrop(u)
+
+		return true, false, false, u
+	}
+
+	queued, dropped := s.send(u)
+	if !queued {
+		s.countDrop(u)
+
+		// u has the lowest priority, the subscriber stays connected.
+		if dropped != nil {
+			return true, false, false, u
+		}
+
+		s.handleFullChan(ctx)
+
+		return false, false, true, u
+	}
+
+	first = !s.delivered
+	s.delivered = true
+
+	s.counters.delivered.Add(1)
+
+	if u.receipt != nil {
+		u.receipt.delivered.Add(1)
+	}
+
+	if fromHistory {
+		s.counters.replayed.Add(1)
+	}
+
+	return true, first, false, dropped
+}
+
+// send must be called with mutex held. It queues u in the out channel. When
+// the channel is full, the overflow policy of the subscriber applies, the
+// updates of the lowest priority being dropped first: the update dropped to
+// make room, u included, is returned, the subscriber staying connected. The
+// drop of u is counted by the caller. Otherwise, queued is false and dropped
+// nil when u doesn't fit and the subscriber must be disconnected.
+func (s *LocalSubscriber) send(u *Update) (queued bool, dropped *Update) {
+	if u.Priority != 0 {
+		s.prioritized = true
 	}
 
 	select {
 	case s.out <- u:
-		return true
+		return true, nil
 	default:
-		s.handleFullChan(ctx)
+	}
+
+	s.overflows++
+
+	// Without priorities, the buffer doesn't need to be inspected.
+	if !s.prioritized {
+		switch s.overflowPolicy {
+		case OverflowDropNewest:
+			return false, u
+		case OverflowDropOldest:
+			select {
+			case dropped = <-s.out:
+				s.countEviction()
+			default:
+				// The client read the buffer meanwhile.
+			}
+
+			s.out <- u
+
+			return true, dropped
+		default:
+			return false, nil
+		}
+	}
+
+	// The client reads the buffer concurrently, but the updates are only
+	// sent while holding the mutex: once drained, the buffer can be refilled
+	// in order without blocking.
+	candidates := make([]*Update, 0, cap(s.out)+1)
+
+drain:
+	for {
+		select {
+		case b := <-s.out:
+			candidates = append(candidates, b)
+		default:
+			break drain
+		}
+	}
+
+	full := len(candidates) == cap(s.out)
+	candidates = append(candidates, u)
+
+	if !full {
+		// The client read some updates meanwhile.
+		for _, c := range candidates {
+			s.out <- c
+		}
+
+		return true, nil
+	}
+
+	victim := s.overflowVictim(candidates)
+	if victim == -1 {
+		for _, c := range candidates[:len(candidates)-1] {
+			s.out <- c
+		}
 
-		return false
+		return false, nil
+	}
+
+	for i, c := range candidates {
+		if i != victim {
+			s.out <- c
+		}
+	}
+
+	if victim == len(candidates)-1 {
+		return false, u
+	}
+
+	s.countEviction()
+
+	return true, candidates[victim]
+}
+
+// overflowVictim returns the index of the update to drop among candidates,
+// ordered from the oldest to the newest, or -1 if the subscriber must be
+// disconnected.
+func (s *LocalSubscriber) overflowVictim(candidates []*Update) int {
+	lowest, highest := candidates[0].Priority, candidates[0].Priority
+	for _, c := range candidates[1:] {
+		lowest, highest = min(lowest, c.Priority), max(highest, c.Priority)
+	}
+
+	switch s.overflowPolicy {
+	case OverflowDropNewest:
+		for i := len(candidates) - 1; i > 0; i-- {
+			if candidates[i].Priority == lowest {
+				return i
+			}
+		}
+
+		return 0
+	case OverflowDropOldest:
+	default:
+		if lowest == highest {
+			return -1
+		}
+	}
+
+	return slices.IndexFunc(candidates, func(c *Update) bool { return c.Priority == lowest })
+}
+
+// countEviction must be called with mutex held, when a queued update is
+// dropped. Its receipt, published earlier, has already been returned: only
+// the statistics of the subscriber are fixed.
+func (s *LocalSubscriber) countEviction() {
+	s.counters.delivered.Add(^uint64(0))
+	s.counters.dropped.Add(1)
+}
+
+// countDrop must be called with mutex held.
+func (s *LocalSubscriber) countDrop(u *Update) {
+	s.counters.dropped.Add(1)
+
+	if u.receipt != nil {
+		u.receipt.dropped.Add(1)
 	}
 }
 
 // Ready flips the ready flag to true and flushes queued live updates returning number of events flushed.
 func (s *LocalSubscriber) Ready(ctx context.Context) (n int) {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	n, first, disconnected, dropped := s.flushLiveQueue(ctx)
+	overflows := s.takeOverflows()
+	s.mutex.Unlock()
+
+	s.notifyOverflows(overflows)
+
+	if first != nil && s.callbacks.OnFirstDelivery != nil {
+		s.callbacks.OnFirstDelivery(s, first)
+	}
+
+	if disconnected {
+		s.notifyDisconnect()
+	}
+
+	for _, u := range dropped {
+		s.notifyDrop(u)
+	}
+
+	return n
+}
 
+// flushLiveQueue must be called with mutex held. It returns the updates
+// dropped to make room for others of higher priority, or when the subscriber
+// got disconnected.
+func (s *LocalSubscriber) flushLiveQueue(ctx context.Context) (n int, first *Update, disconnected bool, dropped []*Update) {
 	if s.disconnected.Load() > 0 || s.ready.Load() > 0 {
-		return 0
+		return 0, nil, false, nil
 	}
 
-	for _, u := range s.liveQueue {
-		select {
-		case s.out <- u:
-			n++
-		default:
-			s.ready.Store(1)
+	defer func() {
+		s.ready.Store(1)
+		s.liveQueue = nil
+	}()
+
+	for i, u := range s.liveQueue {
+		queued, d := s.send(u)
+		if d != nil {
+			dropped = append(dropped, d)
+		}
+
+		if !queued {
+			if d != nil {
+				s.counters.dropped.Add(1)
+
+				continue
+			}
+
+			s.counters.dropped.Add(uint64(len(s.liveQueue) - i))
 			s.handleFullChan(ctx)
-			s.liveQueue = nil
 
-			return n
+			return n, first, true, append(dropped, s.liveQueue[i:]...)
 		}
-	}
 
-	s.ready.Store(1)
-	s.liveQueue = nil
+		if !s.delivered {
+			s.delivered = true
+			first = u
+		}
 
-	return n
+		s.counters.delivered.Add(1)
+		n++
+	}
+
+	return n, first, false, dropped
 }
 
 // Receive returns a chan when incoming updates are dispatched.
@@ -103,30 +434,79 @@ func (s *LocalSubscriber) Receive() <-chan *Update {
 // HistoryDispatched must be called when all messages coming from the history have been dispatched.
 func (s *LocalSubscriber) HistoryDispatched(responseLastEventID string) {
 	s.responseLastEventID <- responseLastEventID
+
+	if s.callbacks.OnHistoryReplayed != nil {
+		s.callbacks.OnHistoryReplayed(s, responseLastEventID)
+	}
 }
 
 // Disconnect disconnects the subscriber.
 func (s *LocalSubscriber) Disconnect() {
+	s.DisconnectWithReason(DisconnectReasonUnknown)
+}
+
+// DisconnectWithReason disconnects the subscriber, reporting why to the
+// OnDisconnect callback. Only the first disconnection is reported.
+func (s *LocalSubscriber) DisconnectWithReason(reason DisconnectReason) {
 	s.mutex.Lock()
-	defer s.mutex.Unlock()
+	disconnected := s.doDisconnect(reason)
+	s.mutex.Unlock()
 
-	s.doDisconnect()
+	if disconnected {
+		s.notifyDisconnect()
+	}
 }
 
 // handleFullChan disconnects the subscriber when the out channel is full.
 func (s *LocalSubscriber) handleFullChan(ctx context.Context) {
-	s.doDisconnect()
+	s.doDisconnect(DisconnectReasonSlowConsumer)
 
 	if s.logger.Enabled(ctx, slog.LevelInfo) {
 		s.logger.LogAttrs(ctx, slog.LevelInfo, "Subscriber unable to receive updates fast enough")
 	}
 }
 
-func (s *LocalSubscriber) doDisconnect() {
+// doDisconnect must be called with mutex held. It reports whether the
+// subscriber got disconnected by this call.
+func (s *LocalSubscriber) doDisconnect(reason DisconnectReason) bool {
 	if s.disconnected.Load() > 0 {
-		return // already disconnected
+		return false // already disconnected
 	}
 
+	s.disconnectReason = reason
 	s.disconnected.Store(1)
 	close(s.out)
+
+	return true
+}
+
+func (s *LocalSubscriber) notifyDrop(u *Update) {
+	if s.callbacks.OnDrop != nil {
+		s.callbacks.OnDrop(s, u)
+	}
+}
+
+// takeOverflows must be called with mutex held. It returns the number of
+// overflows not notified yet.
+func (s *LocalSubscriber) takeOverflows() int {
+	n := s.overflows
+	s.overflows = 0
+
+	return n
+}
+
+func (s *LocalSubscriber) notifyOverflows(n int) {
+	if s.callbacks.OnOverflow == nil {
+		return
+	}
+
+	for range n {
+		s.callbacks.OnOverflow(s, s.overflowPolicy)
+	}
+}
+
+func (s *LocalSubscriber) notifyDisconnect() {
+	if s.callbacks.OnDisconnect != nil {
+		s.callbacks.OnDisconnect(s, s.disconnectReason)
+	}
 }
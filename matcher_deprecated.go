@@ -10,7 +10,17 @@ package mercure
 // parameter into a deprecated TopicMatcher (exact or URI Template matching).
 // Only called when the hub runs under WithProtocolVersionCompatibility. It
 // delegates to appendMatchers; validatePattern is a no-op for the deprecated
-// type, which keeps the v8 "exact or URI Template" fallback.
+// type, which keeps the v8 "exact or URI Template" fallback. Selectors
+// prefixed by "regexp:" are regexp matchers when they are enabled.
 func (h *Hub) appendDeprecatedTopicMatchers(matchers []TopicMatcher, values []string) ([]TopicMatcher, error) {
-	return h.appendMatchers(matchers, deprecatedMatcherTypeName, values)
+	for _, v := range values {
+		m := h.topicMatcherStore.v8Matcher(v)
+
+		var err error
+		if matchers, err = h.appendMatchers(matchers, m.Type, []string{m.Pattern}); err != nil {
+			return nil, err
+		}
+	}
+
+	return matchers, nil
 }
@@ -27,7 +27,8 @@ var errMissingMatchProperty = errors.New(`topic matcher object is missing the re
 type matcherClaim struct {
 	TopicMatcher
 
-	Payload any // Per-subscription payload, nil if not set
+	Payload any      // Per-subscription payload, nil if not set
+	MaxRate *float64 // Updates per second, unlimited if nil
 }
 
 // MarshalJSON serialises a claim back to the wire format: a plain string for
@@ -47,7 +48,8 @@ func (mc *matcherClaim) MarshalJSON() ([]byte, error) {
 		Match     string      `json:"match"`
 		MatchType MatcherType `json:"match_type,omitempty"`
 		Payload   any         `json:"payload,omitempty"`
-	}{mc.Pattern, mc.Type, mc.Payload}
+		MaxRate   *float64    `json:"max_rate,omitempty"`
+	}{mc.Pattern, mc.Type, mc.Payload, mc.MaxRate}
 
 	b, err := json.Marshal(obj)
 	if err != nil {
@@ -59,7 +61,8 @@ func (mc *matcherClaim) MarshalJSON() ([]byte, error) {
 
 // UnmarshalJSON handles both string and object formats in JWT claims.
 // String: v8 form, accepted only in backward-compatibility mode.
-// Object: {"match": "pattern", "match_type": "exact", "payload": {...}};
+// Object: {"match": "pattern", "match_type": "exact", "payload": {...},
+// "max_rate": 10};
 // match_type is case-sensitive and defaults to Exact.
 //
 // Always resets every field of the receiver before populating it, so reusing
@@ -89,6 +92,7 @@ func (mc *matcherClaim) UnmarshalJSON(data []byte) error {
 		Match     *string     `json:"match"`
 		MatchType MatcherType `json:"match_type"`
 		Payload   any         `json:"payload"`
+		MaxRate   *float64    `json:"max_rate"`
 	}
 
 	if err := json.Unmarshal(data, &obj); err != nil {
@@ -101,6 +105,7 @@ func (mc *matcherClaim) UnmarshalJSON(data []byte) error {
 
 	mc.Pattern = *obj.Match
 	mc.Payload = obj.Payload
+	mc.MaxRate = obj.MaxRate
 	mc.Type = obj.MatchType
 
 	if mc.Type == "" {
@@ -127,20 +132,27 @@ func resolveMatcherClaims(tms *TopicMatcherStore, claims []matcherClaim, depreca
 			return err
 		}
 
+		if _, err := validateMaxRate(claims[i].MaxRate); err != nil {
+			return err
+		}
+
 		switch claims[i].Type {
 		case "":
 			if !deprecated {
 				return errStringClaimRequiresCompat
 			}
 
-			claims[i].Type = deprecatedMatcherTypeName
+			claims[i].TopicMatcher = tms.v8Matcher(claims[i].Pattern)
+			if err := tms.validatePattern(claims[i].TopicMatcher); err != nil {
+				return fmt.Errorf("invalid matcher in JWT claim: %w", err)
+			}
 		case deprecatedMatcherTypeName:
 			// Only reachable through a forged object-form claim or a re-run
 			// of an already-resolved string claim; reject it in modern mode.
 			if !deprecated {
 				return errStringClaimRequiresCompat
 			}
-		case MatcherTypeExact, MatcherTypeURLPattern:
+		case MatcherTypeExact, MatcherTypeURLPattern, MatcherTypeRegexp:
 			if err := tms.validatePattern(claims[i].TopicMatcher); err != nil {
 				return fmt.Errorf("invalid matcher in JWT claim: %w", err)
 			}
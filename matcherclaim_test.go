@@ -52,6 +52,25 @@ func TestMatcherClaimUnmarshalObjectWithPayload(t *testing.T) {
 	assert.Equal(t, "alice", payloadMap["user"])
 }
 
+func TestMatcherClaimMaxRate(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(0)
+	require.NoError(t, err)
+
+	var mc matcherClaim
+	require.NoError(t, json.Unmarshal([]byte(`{"match": "https://example.com/foo", "payload": true, "max_rate": 3}`), &mc))
+	require.NotNil(t, mc.MaxRate)
+	assert.InDelta(t, 3, *mc.MaxRate, 0)
+
+	authz := mercureAuthzFromLegacy(mercureClaim{Subscribe: []matcherClaim{mc}})
+	assert.InDelta(t, 3, authz.details[0].maxRate, 0)
+	assert.Equal(t, true, authz.details[0].payload)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"match": "https://example.com/foo", "max_rate": 0}`), &mc))
+	require.ErrorIs(t, resolveMatcherClaims(tms, []matcherClaim{mc}, false), errInvalidMaxRate)
+}
+
 // TestMatcherClaimUnmarshalReset guards against state leaking between decode
 // calls when a matcherClaim is reused.
 func TestMatcherClaimUnmarshalReset(t *testing.T) {
@@ -111,3 +130,33 @@ func TestResolveMatcherClaims(t *testing.T) {
 	cs = []matcherClaim{{TopicMatcher: TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "{unclosed"}}}
 	assert.Error(t, resolveMatcherClaims(tms, cs, false))
 }
+
+func TestResolveRegexpMatcherClaims(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(0)
+	require.NoError(t, err)
+
+	cs := []matcherClaim{{TopicMatcher: TopicMatcher{Type: MatcherTypeRegexp, Pattern: "^https://example\\.com/"}}}
+	require.ErrorIs(t, resolveMatcherClaims(tms, cs, false), ErrUnsupportedMatcherType)
+
+	// The prefix of the v8 string claims is kept when regexps are disabled.
+	cs = []matcherClaim{{TopicMatcher: TopicMatcher{Pattern: "regexp:^https://example\\.com/"}}}
+	require.NoError(t, resolveMatcherClaims(tms, cs, true))
+	assert.Equal(t, TopicMatcher{Type: deprecatedMatcherTypeName, Pattern: "regexp:^https://example\\.com/"}, cs[0].TopicMatcher)
+
+	tms.enableRegexps()
+
+	cs = []matcherClaim{{TopicMatcher: TopicMatcher{Type: MatcherTypeRegexp, Pattern: "^https://example\\.com/"}}}
+	require.NoError(t, resolveMatcherClaims(tms, cs, false))
+
+	cs = []matcherClaim{{TopicMatcher: TopicMatcher{Type: MatcherTypeRegexp, Pattern: "(a"}}}
+	require.Error(t, resolveMatcherClaims(tms, cs, false))
+
+	cs = []matcherClaim{{TopicMatcher: TopicMatcher{Pattern: "regexp:^https://example\\.com/"}}}
+	require.NoError(t, resolveMatcherClaims(tms, cs, true))
+	assert.Equal(t, TopicMatcher{Type: MatcherTypeRegexp, Pattern: "^https://example\\.com/"}, cs[0].TopicMatcher)
+
+	cs = []matcherClaim{{TopicMatcher: TopicMatcher{Pattern: "regexp:(a"}}}
+	require.Error(t, resolveMatcherClaims(tms, cs, true))
+}
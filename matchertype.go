@@ -20,6 +20,11 @@ const (
 	// Living Standard, with the hub's public URL as the base URL.
 	MatcherTypeURLPattern MatcherType = "urlpattern"
 
+	// MatcherTypeRegexp selects matching with an RE2 regular expression. It
+	// is not part of the protocol and is only addressable from the wire on
+	// the hubs created with WithRegexpTopicMatchers.
+	MatcherTypeRegexp MatcherType = "regexp"
+
 	// deprecatedMatcherTypeName tags topic matchers created from the v8
 	// `topic=` query parameter or bare-string JWT claims (exact-or-URI-Template
 	// semantics). The underscore prefix keeps it out of the protocol namespace;
@@ -69,13 +74,15 @@ func validProtocolString(s string) bool {
 // wire (a token, a subscribe query parameter, or a subscription API URL). The
 // internal deprecated type is excluded. This is the single definition of the
 // protocol's matcher-type set; a new type is added here and to the per-type
-// dispatch in TopicMatcherStore.validatePattern and matches.
+// dispatch in TopicMatcherStore.validatePattern and matches. The opt-in
+// regexp type is gated by TopicMatcherStore.supportsMatcherType.
 func knownMatcherType(mt MatcherType) bool {
 	switch mt {
 	case MatcherTypeExact, MatcherTypeURLPattern:
 		return true
-	case deprecatedMatcherTypeName:
-		// The internal deprecated type is not addressable from the wire.
+	case deprecatedMatcherTypeName, MatcherTypeRegexp:
+		// The internal deprecated type is not addressable from the wire, the
+		// regexp type only when enabled.
 		return false
 	default:
 		return false
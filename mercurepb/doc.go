@@ -0,0 +1,7 @@
+// Package mercurepb contains the protobuf messages and the gRPC client and
+// server of the gRPC API of the Mercure hub, defined in mercure.proto.
+//
+// The API is served by hubs created with mercure.WithGRPC.
+package mercurepb
+
+//go:generate protoc -I.. --go_out=.. --go_opt=paths=source_relative --go-grpc_out=.. --go-grpc_opt=paths=source_relative mercurepb/mercure.proto
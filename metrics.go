@@ -2,6 +2,9 @@ package mercure
 
 import (
 	"errors"
+	"slices"
+	"sync"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -23,10 +26,27 @@ func (NopMetrics) UpdatePublished(_ *Update)                 {}
 
 // PrometheusMetrics store Hub collected metrics.
 type PrometheusMetrics struct {
-	registry         prometheus.Registerer
-	subscribersTotal prometheus.Counter
-	subscribers      prometheus.Gauge
-	updatesTotal     prometheus.Counter
+	registry                 prometheus.Registerer
+	subscribersTotal         prometheus.Counter
+	subscribers              prometheus.Gauge
+	subscribersByFamilyTotal *prometheus.CounterVec
+	subscribersByFamily      *prometheus.GaugeVec
+	updatesTotal             prometheus.Counter
+	partialDispatchesTotal   *prometheus.CounterVec
+	topics                   *prometheus.GaugeVec
+	idleTopicsCollectedTotal prometheus.Counter
+	transportDegraded        prometheus.Gauge
+	localFallbackTotal       prometheus.Counter
+	tenantSubscribers        *prometheus.GaugeVec
+	tenantTopics             *prometheus.GaugeVec
+	tenantHistoryBytes       *prometheus.GaugeVec
+	tenantUpdates            *prometheus.GaugeVec
+	tenantRejectionsTotal    *prometheus.CounterVec
+	topicMatcherStores       *topicMatcherStoreCollector
+	bufferOverflowsTotal     *prometheus.CounterVec
+	dispatchQueues           *dispatchQueueCollector
+	subscriberBytesTotal     *prometheus.CounterVec
+	throttledSecondsTotal    *prometheus.CounterVec
 }
 
 // NewPrometheusMetrics creates a Prometheus metrics collector.
@@ -50,12 +70,116 @@ func NewPrometheusMetrics(registry prometheus.Registerer) *PrometheusMetrics {
 				Help: "The current number of running subscribers",
 			},
 		),
+		subscribersByFamilyTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_subscribers_by_family_total",
+				Help: "Total number of handled subscribers, per network family of the connection",
+			},
+			[]string{"family"},
+		),
+		subscribersByFamily: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mercure_subscribers_connected_by_family",
+				Help: "The current number of running subscribers, per network family of the connection",
+			},
+			[]string{"family"},
+		),
 		updatesTotal: prometheus.NewCounter(
 			prometheus.CounterOpts{
 				Name: "mercure_updates_total",
 				Help: "Total number of handled updates",
 			},
 		),
+		partialDispatchesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_partial_dispatches_total",
+				Help: "Total number of updates a transport failed to store, per outcome",
+			},
+			[]string{"outcome"},
+		),
+		topics: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mercure_topics",
+				Help: "The number of topics tracked, per state (active or idle)",
+			},
+			[]string{"state"},
+		),
+		idleTopicsCollectedTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "mercure_idle_topics_collected_total",
+				Help: "Total number of idle topics whose state has been forgotten",
+			},
+		),
+		transportDegraded: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "mercure_transport_degraded",
+				Help: "Whether the updates are dispatched to the local subscribers only (1) or not (0)",
+			},
+		),
+		localFallbackTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "mercure_local_fallback_updates_total",
+				Help: "Total number of updates the transport failed to dispatch, delivered to the local subscribers only",
+			},
+		),
+		tenantSubscribers: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mercure_tenant_subscribers_connected",
+				Help: "The current number of subscribers, per tenant",
+			},
+			[]string{"tenant"},
+		),
+		tenantTopics: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mercure_tenant_topics",
+				Help: "The number of distinct topics published on during the current window, per tenant",
+			},
+			[]string{"tenant"},
+		),
+		tenantHistoryBytes: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mercure_tenant_history_bytes",
+				Help: "The number of bytes published during the current window, per tenant",
+			},
+			[]string{"tenant"},
+		),
+		tenantUpdates: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "mercure_tenant_updates",
+				Help: "The number of updates published during the current window, per tenant",
+			},
+			[]string{"tenant"},
+		),
+		tenantRejectionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_tenant_quota_rejections_total",
+				Help: "Total number of requests rejected because a tenant exceeded a quota, per tenant and quota",
+			},
+			[]string{"tenant", "quota"},
+		),
+		topicMatcherStores: newTopicMatcherStoreCollector(),
+		dispatchQueues:     newDispatchQueueCollector(),
+		bufferOverflowsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_subscriber_buffer_overflows_total",
+				Help: "Total number of updates that didn't fit in the buffer of a subscriber, per overflow policy",
+			},
+			[]string{"policy"},
+		),
+		subscriberBytesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_subscriber_bytes_sent_total",
+				Help: "Total number of bytes written to the subscribers, per tenant",
+			},
+			[]string{"tenant"},
+		),
+		throttledSecondsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "mercure_subscriber_throttled_seconds_total",
+				Help: "Total time the subscribers waited because of the bandwidth limits, per tenant",
+			},
+			[]string{"tenant"},
+		),
 	}
 
 	// https://github.com/caddyserver/caddy/pull/6820
@@ -74,18 +198,293 @@ func NewPrometheusMetrics(registry prometheus.Registerer) *PrometheusMetrics {
 		panic(err)
 	}
 
+	if err := m.registry.Register(m.subscribersByFamilyTotal); err != nil &&
+		!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		panic(err)
+	}
+
+	if err := m.registry.Register(m.subscribersByFamily); err != nil &&
+		!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		panic(err)
+	}
+
+	if err := m.registry.Register(m.partialDispatchesTotal); err != nil &&
+		!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		panic(err)
+	}
+
+	if err := m.registry.Register(m.topics); err != nil &&
+		!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		panic(err)
+	}
+
+	if err := m.registry.Register(m.idleTopicsCollectedTotal); err != nil &&
+		!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		panic(err)
+	}
+
+	if err := m.registry.Register(m.transportDegraded); err != nil &&
+		!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		panic(err)
+	}
+
+	if err := m.registry.Register(m.localFallbackTotal); err != nil &&
+		!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+		panic(err)
+	}
+
+	for _, c := range []prometheus.Collector{m.tenantSubscribers, m.tenantTopics, m.tenantHistoryBytes, m.tenantUpdates, m.tenantRejectionsTotal, m.topicMatcherStores, m.bufferOverflowsTotal, m.dispatchQueues, m.subscriberBytesTotal, m.throttledSecondsTotal} {
+		if err := m.registry.Register(c); err != nil &&
+			!errors.As(err, &prometheus.AlreadyRegisteredError{}) {
+			panic(err)
+		}
+	}
+
 	return m
 }
 
-func (m *PrometheusMetrics) SubscriberConnected(_ *LocalSubscriber) {
+func (m *PrometheusMetrics) SubscriberConnected(s *LocalSubscriber) {
 	m.subscribersTotal.Inc()
 	m.subscribers.Inc()
+
+	family := metricsAddressFamily(s)
+	m.subscribersByFamilyTotal.WithLabelValues(family).Inc()
+	m.subscribersByFamily.WithLabelValues(family).Inc()
 }
 
-func (m *PrometheusMetrics) SubscriberDisconnected(_ *LocalSubscriber) {
+func (m *PrometheusMetrics) SubscriberDisconnected(s *LocalSubscriber) {
 	m.subscribers.Dec()
+	m.subscribersByFamily.WithLabelValues(metricsAddressFamily(s)).Dec()
+}
+
+// metricsAddressFamily returns the family label of a subscriber.
+func metricsAddressFamily(s *LocalSubscriber) string {
+	if s.AddressFamily == "" {
+		return string(AddressFamilyUnknown)
+	}
+
+	return string(s.AddressFamily)
 }
 
 func (m *PrometheusMetrics) UpdatePublished(_ *Update) {
 	m.updatesTotal.Inc()
 }
+
+// UpdatePartiallyDispatched counts the updates a transport failed to store.
+func (m *PrometheusMetrics) UpdatePartiallyDispatched(_ *Update, outcome PartialDispatchOutcome) {
+	m.partialDispatchesTotal.WithLabelValues(string(outcome)).Inc()
+}
+
+// TopicsTracked sets the number of active and idle topics.
+func (m *PrometheusMetrics) TopicsTracked(active, idle int) {
+	m.topics.WithLabelValues("active").Set(float64(active))
+	m.topics.WithLabelValues("idle").Set(float64(idle))
+}
+
+// IdleTopicsCollected counts the idle topics whose state has been forgotten.
+func (m *PrometheusMetrics) IdleTopicsCollected(n int) {
+	m.idleTopicsCollectedTotal.Add(float64(n))
+}
+
+// TransportDegraded sets whether the updates are dispatched to the local
+// subscribers only.
+func (m *PrometheusMetrics) TransportDegraded(degraded bool) {
+	if degraded {
+		m.transportDegraded.Set(1)
+
+		return
+	}
+
+	m.transportDegraded.Set(0)
+}
+
+// UpdateDispatchedLocally counts the updates delivered to the local
+// subscribers only.
+func (m *PrometheusMetrics) UpdateDispatchedLocally(_ *Update) {
+	m.localFallbackTotal.Inc()
+}
+
+// TenantUsageChanged sets the resources used by the tenant.
+func (m *PrometheusMetrics) TenantUsageChanged(tenant string, usage TenantUsage) {
+	m.tenantSubscribers.WithLabelValues(tenant).Set(float64(usage.Connections))
+	m.tenantTopics.WithLabelValues(tenant).Set(float64(usage.Topics))
+	m.tenantHistoryBytes.WithLabelValues(tenant).Set(float64(usage.HistoryBytes))
+	m.tenantUpdates.WithLabelValues(tenant).Set(float64(usage.Updates))
+}
+
+// TenantQuotaExceeded counts the requests rejected because the tenant
+// exceeded the quota.
+func (m *PrometheusMetrics) TenantQuotaExceeded(tenant string, quota TenantQuota) {
+	m.tenantRejectionsTotal.WithLabelValues(tenant, string(quota)).Inc()
+}
+
+// SubscriberBufferOverflowed counts the updates that didn't fit in the buffer
+// of a subscriber.
+func (m *PrometheusMetrics) SubscriberBufferOverflowed(policy OverflowPolicy) {
+	m.bufferOverflowsTotal.WithLabelValues(string(policy)).Inc()
+}
+
+// SubscriberBytesSent counts the bytes written to a subscriber of the tenant.
+func (m *PrometheusMetrics) SubscriberBytesSent(tenant string, n int) {
+	m.subscriberBytesTotal.WithLabelValues(tenant).Add(float64(n))
+}
+
+// SubscriberThrottled sums the time the subscribers of the tenant waited
+// because of the bandwidth limits.
+func (m *PrometheusMetrics) SubscriberThrottled(tenant string, d time.Duration) {
+	m.throttledSecondsTotal.WithLabelValues(tenant).Add(d.Seconds())
+}
+
+// ObserveTopicMatcherStore collects the statistics of the caches of the
+// store, summed with the ones of the other stores observed.
+func (m *PrometheusMetrics) ObserveTopicMatcherStore(tms *TopicMatcherStore) {
+	m.topicMatcherStores.observe(tms)
+}
+
+// ObserveDispatchQueues collects the statistics of the queues of the
+// subscribers, summed with the ones of the other hubs observed.
+func (m *PrometheusMetrics) ObserveDispatchQueues(q *DispatchQueues) {
+	m.dispatchQueues.observe(q)
+}
+
+// topicMatcherStoreCollector collects the statistics of the caches of the
+// observed stores when the metrics are scraped.
+type topicMatcherStoreCollector struct {
+	hits      *prometheus.Desc
+	misses    *prometheus.Desc
+	evictions *prometheus.Desc
+	entries   *prometheus.Desc
+
+	mu     sync.Mutex
+	stores []*TopicMatcherStore
+}
+
+func newTopicMatcherStoreCollector() *topicMatcherStoreCollector {
+	labels := []string{"cache"}
+
+	return &topicMatcherStoreCollector{
+		hits:      prometheus.NewDesc("mercure_topic_matcher_cache_hits_total", "Total number of topic matcher cache hits, per cache", labels, nil),
+		misses:    prometheus.NewDesc("mercure_topic_matcher_cache_misses_total", "Total number of topic matcher cache misses, per cache", labels, nil),
+		evictions: prometheus.NewDesc("mercure_topic_matcher_cache_evictions_total", "Total number of topic matcher cache evictions, per cache", labels, nil),
+		entries:   prometheus.NewDesc("mercure_topic_matcher_cache_entries", "The approximate number of entries of the topic matcher cache, per cache", labels, nil),
+	}
+}
+
+func (c *topicMatcherStoreCollector) observe(tms *TopicMatcherStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !slices.Contains(c.stores, tms) {
+		c.stores = append(c.stores, tms)
+	}
+}
+
+func (c *topicMatcherStoreCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.evictions
+	ch <- c.entries
+}
+
+func (c *topicMatcherStoreCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	stores := slices.Clone(c.stores)
+	c.mu.Unlock()
+
+	total := make(map[TopicMatcherCache]TopicMatcherCacheStats)
+
+	for _, tms := range stores {
+		for cache, s := range tms.Stats() {
+			t := total[cache]
+			t.Hits += s.Hits
+			t.Misses += s.Misses
+			t.Evictions += s.Evictions
+			t.Size += s.Size
+			total[cache] = t
+		}
+	}
+
+	for cache, s := range total {
+		ch <- prometheus.MustNewConstMetric(c.hits, prometheus.CounterValue, float64(s.Hits), string(cache))
+		ch <- prometheus.MustNewConstMetric(c.misses, prometheus.CounterValue, float64(s.Misses), string(cache))
+		ch <- prometheus.MustNewConstMetric(c.evictions, prometheus.CounterValue, float64(s.Evictions), string(cache))
+		ch <- prometheus.MustNewConstMetric(c.entries, prometheus.GaugeValue, float64(s.Size), string(cache))
+	}
+}
+
+// dispatchQueueCollector collects the statistics of the queues of the
+// subscribers of the observed hubs when the metrics are scraped.
+type dispatchQueueCollector struct {
+	depth    *prometheus.Desc
+	maxDepth *prometheus.Desc
+	shedding *prometheus.Desc
+	shed     *prometheus.Desc
+
+	mu     sync.Mutex
+	queues []*DispatchQueues
+}
+
+func newDispatchQueueCollector() *dispatchQueueCollector {
+	return &dispatchQueueCollector{
+		depth:    prometheus.NewDesc("mercure_subscriber_queue_depth", "The number of updates waiting to be sent, all subscribers included", nil, nil),
+		maxDepth: prometheus.NewDesc("mercure_subscriber_queue_depth_max", "The number of updates waiting to be sent to the most lagging subscriber", nil, nil),
+		shedding: prometheus.NewDesc("mercure_subscriber_queue_shedding", "Whether the number of updates waiting to be sent is above the dispatch watermark of a hub", nil, nil),
+		shed:     prometheus.NewDesc("mercure_subscriber_queue_shed_total", "Total number of updates shed above the dispatch watermark", nil, nil),
+	}
+}
+
+func (c *dispatchQueueCollector) observe(q *DispatchQueues) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !slices.Contains(c.queues, q) {
+		c.queues = append(c.queues, q)
+	}
+}
+
+func (c *dispatchQueueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.depth
+	ch <- c.maxDepth
+	ch <- c.shedding
+	ch <- c.shed
+}
+
+func (c *dispatchQueueCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	queues := slices.Clone(c.queues)
+	c.mu.Unlock()
+
+	var total DispatchQueueStats
+
+	for _, q := range queues {
+		s := q.Stats()
+		total.Depth += s.Depth
+		total.MaxDepth = max(total.MaxDepth, s.MaxDepth)
+		total.Shedding = total.Shedding || s.Shedding
+		total.Shed += s.Shed
+	}
+
+	shedding := 0.
+	if total.Shedding {
+		shedding = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.depth, prometheus.GaugeValue, float64(total.Depth))
+	ch <- prometheus.MustNewConstMetric(c.maxDepth, prometheus.GaugeValue, float64(total.MaxDepth))
+	ch <- prometheus.MustNewConstMetric(c.shedding, prometheus.GaugeValue, shedding)
+	ch <- prometheus.MustNewConstMetric(c.shed, prometheus.CounterValue, float64(total.Shed))
+}
+
+// Interface guards.
+var (
+	_ PartialDispatchMetrics     = (*PrometheusMetrics)(nil)
+	_ IdleTopicsMetrics          = (*PrometheusMetrics)(nil)
+	_ FallbackMetrics            = (*PrometheusMetrics)(nil)
+	_ TenantMetrics              = (*PrometheusMetrics)(nil)
+	_ TopicMatcherStoreMetrics   = (*PrometheusMetrics)(nil)
+	_ SubscriberBufferMetrics    = (*PrometheusMetrics)(nil)
+	_ DispatchQueueMetrics       = (*PrometheusMetrics)(nil)
+	_ SubscriberBandwidthMetrics = (*PrometheusMetrics)(nil)
+	_ prometheus.Collector       = (*topicMatcherStoreCollector)(nil)
+	_ prometheus.Collector       = (*dispatchQueueCollector)(nil)
+)
@@ -2,11 +2,13 @@ package mercure
 
 import (
 	"log/slog"
+	"strings"
 	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNumberOfRunningSubscribers(t *testing.T) {
@@ -79,6 +81,48 @@ func TestTotalOfHandledUpdates(t *testing.T) {
 	assertCounterValue(t, 4.0, m.updatesTotal)
 }
 
+func TestPartialDispatches(t *testing.T) {
+	t.Parallel()
+
+	m := NewPrometheusMetrics(nil)
+
+	m.UpdatePartiallyDispatched(&Update{}, PartialDispatchDeadLettered)
+	m.UpdatePartiallyDispatched(&Update{}, PartialDispatchDeadLettered)
+	m.UpdatePartiallyDispatched(&Update{}, PartialDispatchRolledBack)
+
+	assertCounterValue(t, 2.0, m.partialDispatchesTotal.WithLabelValues(string(PartialDispatchDeadLettered)))
+	assertCounterValue(t, 1.0, m.partialDispatchesTotal.WithLabelValues(string(PartialDispatchRolledBack)))
+}
+
+func TestSubscribersByFamily(t *testing.T) {
+	t.Parallel()
+
+	m := NewPrometheusMetrics(nil)
+
+	tms := &TopicMatcherStore{}
+	logger := slog.Default()
+
+	s1 := NewLocalSubscriber("", logger, tms)
+	s1.AddressFamily = AddressFamilyIPv6
+	m.SubscriberConnected(s1)
+
+	s2 := NewLocalSubscriber("", logger, tms)
+	s2.AddressFamily = AddressFamilyIPv4
+	m.SubscriberConnected(s2)
+
+	s3 := NewLocalSubscriber("", logger, tms)
+	m.SubscriberConnected(s3)
+
+	assertGaugeValue(t, 1.0, m.subscribersByFamily.WithLabelValues("ipv6"))
+	assertGaugeValue(t, 1.0, m.subscribersByFamily.WithLabelValues("ipv4"))
+	assertGaugeValue(t, 1.0, m.subscribersByFamily.WithLabelValues("unknown"))
+
+	m.SubscriberDisconnected(s1)
+
+	assertGaugeValue(t, 0.0, m.subscribersByFamily.WithLabelValues("ipv6"))
+	assertCounterValue(t, 1.0, m.subscribersByFamilyTotal.WithLabelValues("ipv6"))
+}
+
 func assertGaugeValue(t *testing.T, v float64, g prometheus.Gauge) {
 	t.Helper()
 
@@ -100,3 +144,72 @@ func assertCounterValue(t *testing.T, v float64, c prometheus.Counter) {
 
 	assert.Equal(t, v, metricOut.GetCounter().GetValue()) // nolint:testifylint
 }
+
+func TestIdleTopicsMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := NewPrometheusMetrics(nil)
+
+	m.TopicsTracked(3, 2)
+	m.IdleTopicsCollected(2)
+	m.IdleTopicsCollected(1)
+
+	assertGaugeValue(t, 3.0, m.topics.WithLabelValues("active"))
+	assertGaugeValue(t, 2.0, m.topics.WithLabelValues("idle"))
+	assertCounterValue(t, 3.0, m.idleTopicsCollectedTotal)
+}
+
+func TestFallbackMetrics(t *testing.T) {
+	t.Parallel()
+
+	m := NewPrometheusMetrics(nil)
+
+	m.TransportDegraded(true)
+	m.UpdateDispatchedLocally(&Update{})
+	m.UpdateDispatchedLocally(&Update{})
+
+	assertGaugeValue(t, 1.0, m.transportDegraded)
+	assertCounterValue(t, 2.0, m.localFallbackTotal)
+
+	m.TransportDegraded(false)
+	assertGaugeValue(t, 0.0, m.transportDegraded)
+}
+
+func TestTopicMatcherStoreMetrics(t *testing.T) {
+	t.Parallel()
+
+	registry := prometheus.NewRegistry()
+	m := NewPrometheusMetrics(registry)
+
+	tms, err := NewTopicMatcherStore(10)
+	require.NoError(t, err)
+
+	_, err = NewHub(t.Context(), WithMetrics(m), WithTopicMatcherStore(tms))
+	require.NoError(t, err)
+
+	matcher := TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/:id"}
+	assert.True(t, tms.matches([]string{"https://example.com/books/1"}, matcher))
+	assert.True(t, tms.matches([]string{"https://example.com/books/1"}, matcher))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	values := make(map[string]float64)
+
+	for _, f := range families {
+		if !strings.HasPrefix(f.GetName(), "mercure_topic_matcher_cache_") {
+			continue
+		}
+
+		for _, metric := range f.GetMetric() {
+			if metric.GetLabel()[0].GetValue() == string(TopicMatcherCacheMatch) {
+				values[f.GetName()] = metric.GetCounter().GetValue() + metric.GetGauge().GetValue()
+			}
+		}
+	}
+
+	assert.InDelta(t, 1.0, values["mercure_topic_matcher_cache_hits_total"], 0)
+	assert.InDelta(t, 1.0, values["mercure_topic_matcher_cache_misses_total"], 0)
+	assert.InDelta(t, 0.0, values["mercure_topic_matcher_cache_evictions_total"], 0)
+	assert.Contains(t, values, "mercure_topic_matcher_cache_entries")
+}
@@ -0,0 +1,155 @@
+package mercure
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"log/slog"
+)
+
+// migrationBatchSize is the number of updates copied per group when the
+// destination transport implements TransportGroupDispatcher.
+const migrationBatchSize = 1000
+
+var (
+	// errStopHistory stops reading a history.
+	errStopHistory = errors.New("stop reading history")
+
+	// ErrMigrationDestinationNotEmpty is returned by MigrateHistory when the
+	// destination transport already has a history.
+	ErrMigrationDestinationNotEmpty = errors.New("the destination transport already has a history")
+	// ErrMigrationVerificationFailed is returned by MigrateHistory when the
+	// history read back from the destination transport differs from the
+	// source one.
+	ErrMigrationVerificationFailed = errors.New("the migrated history differs from the source one")
+)
+
+// MigrationReport describes a history migration.
+type MigrationReport struct {
+	// Copied is the number of updates copied.
+	Copied int
+	// Verified reports whether the history has been read back from the
+	// destination transport and compared with the source one. It is false
+	// when the destination doesn't implement TransportHistoryReader.
+	Verified bool
+}
+
+// MigrateHistory copies the history of a transport to another one, preserving
+// the order and the IDs of the updates, so subscribers reconnecting to the new
+// transport with a Last-Event-ID from the old one resume where they left off.
+// The destination must be empty. When it implements TransportHistoryReader,
+// its history is then read back and compared with the source one.
+//
+// Retracted updates are not copied: subscribers reconnecting with their ID
+// receive the whole history. No hub must use the transports meanwhile.
+func MigrateHistory(ctx context.Context, from TransportHistoryReader, to Transport, logger *slog.Logger) (*MigrationReport, error) {
+	reader, verifiable := to.(TransportHistoryReader)
+	if verifiable {
+		err := reader.ReadHistory(ctx, func(*Update) error { return errStopHistory })
+		if errors.Is(err, errStopHistory) {
+			return nil, ErrMigrationDestinationNotEmpty
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("unable to read the destination history: %w", err)
+		}
+	}
+
+	r := &MigrationReport{}
+	sum := sha256.New()
+	batch := make([]*Update, 0, migrationBatchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := dispatchGroup(ctx, to, batch); err != nil {
+			return err
+		}
+
+		r.Copied += len(batch)
+		batch = batch[:0]
+
+		if logger.Enabled(ctx, slog.LevelDebug) {
+			logger.LogAttrs(ctx, slog.LevelDebug, "Updates migrated", slog.Int("count", r.Copied))
+		}
+
+		return nil
+	}
+
+	if err := from.ReadHistory(ctx, func(u *Update) error {
+		if err := writeHistoryChecksum(sum, u); err != nil {
+			return err
+		}
+
+		if batch = append(batch, u); len(batch) == migrationBatchSize {
+			return flush()
+		}
+
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("unable to migrate history: %w", err)
+	}
+
+	if err := flush(); err != nil {
+		return nil, fmt.Errorf("unable to migrate history: %w", err)
+	}
+
+	if !verifiable {
+		return r, nil
+	}
+
+	destSum := sha256.New()
+
+	var n int
+
+	if err := reader.ReadHistory(ctx, func(u *Update) error {
+		n++
+
+		return writeHistoryChecksum(destSum, u)
+	}); err != nil {
+		return nil, fmt.Errorf("unable to read the destination history: %w", err)
+	}
+
+	if n != r.Copied || string(sum.Sum(nil)) != string(destSum.Sum(nil)) {
+		return nil, fmt.Errorf("%w: %d updates copied, %d read back", ErrMigrationVerificationFailed, r.Copied, n)
+	}
+
+	r.Verified = true
+
+	return r, nil
+}
+
+// dispatchGroup dispatches the updates as a group when the transport supports
+// it, and one by one otherwise.
+func dispatchGroup(ctx context.Context, to Transport, updates []*Update) error {
+	if gd, ok := to.(TransportGroupDispatcher); ok {
+		return gd.DispatchGroup(ctx, updates) //nolint:wrapcheck
+	}
+
+	for _, u := range updates {
+		// The updates were validated when first published.
+		if err := to.Dispatch(ctx, u); err != nil {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	return nil
+}
+
+// writeHistoryChecksum adds an update, ID included, to a history checksum.
+func writeHistoryChecksum(h hash.Hash, u *Update) error {
+	j, err := u.MarshalJSON()
+	if err != nil {
+		return err
+	}
+
+	// The length prefix keeps the concatenation unambiguous.
+	_, _ = fmt.Fprintf(h, "%d:", len(j))
+	_, _ = h.Write(j)
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package mercure
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateHistory(t *testing.T) {
+	t.Parallel()
+
+	from := createBoltTransport(t, 0, 0)
+
+	for range migrationBatchSize + 1 {
+		require.NoError(t, from.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}))
+	}
+
+	require.NoError(t, from.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/2", Private: true, Event: Event{ID: "last", Data: "foo"}}))
+
+	to, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "to.db"), "", 0, 0)
+	require.NoError(t, err)
+
+	defer to.Close(t.Context())
+
+	r, err := MigrateHistory(t.Context(), from, to, slog.Default())
+	require.NoError(t, err)
+	assert.Equal(t, &MigrationReport{Copied: migrationBatchSize + 2, Verified: true}, r)
+
+	var last *Update
+
+	require.NoError(t, to.ReadHistory(t.Context(), func(u *Update) error {
+		last = u
+
+		return nil
+	}))
+	assert.Equal(t, "last", last.ID)
+	assert.True(t, last.Private)
+	assert.Equal(t, "foo", last.Data)
+
+	// A subscriber reconnecting with an ID from the old transport resumes.
+	s := NewLocalSubscriber(from.lastEventID, slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"*"}), nil)
+	require.NoError(t, to.AddSubscriber(t.Context(), s))
+	assert.Equal(t, "last", <-s.responseLastEventID)
+
+	_, err = MigrateHistory(t.Context(), from, to, slog.Default())
+	require.ErrorIs(t, err, ErrMigrationDestinationNotEmpty)
+}
+
+func TestMigrateHistoryUnverifiable(t *testing.T) {
+	t.Parallel()
+
+	from := createBoltTransport(t, 0, 0)
+	require.NoError(t, from.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}))
+
+	to := NewLocalTransport(NewSubscriberList(0))
+
+	defer to.Close(t.Context())
+
+	r, err := MigrateHistory(t.Context(), from, to, slog.Default())
+	require.NoError(t, err)
+	assert.Equal(t, &MigrationReport{Copied: 1}, r)
+}
@@ -0,0 +1,251 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+const defaultPartialDispatchRetryDelay = 100 * time.Millisecond
+
+var (
+	// ErrPartialDispatch is wrapped by the errors of the dispatches that
+	// reached the subscribers, but that a transport failed to store. The
+	// update is published: Hub.Publish runs the publish hooks, and the
+	// publishers get a 202 Accepted response.
+	ErrPartialDispatch = errors.New("update partially dispatched")
+	// ErrDispatchRolledBack is wrapped by the errors of the dispatches that a
+	// transport failed to store, and that have been retracted from the other
+	// one. The publishers get a 503 Service Unavailable response, and should
+	// publish the update again.
+	ErrDispatchRolledBack = errors.New("update rolled back after a partial dispatch")
+	// ErrInvalidPartialDispatchPolicy is returned by
+	// DualTransport.SetPartialDispatchPolicy when the policy is not valid.
+	ErrInvalidPartialDispatchPolicy = errors.New("invalid partial dispatch policy")
+)
+
+// PartialDispatchAction is what DualTransport does with the updates dispatched
+// by the transport serving reads that the other transport failed to store.
+type PartialDispatchAction string
+
+const (
+	// PartialDispatchIgnore logs the failure: the other transport misses the
+	// updates.
+	PartialDispatchIgnore PartialDispatchAction = "ignore"
+	// PartialDispatchRollback retracts the updates from the transport serving
+	// reads, which must implement TransportRetracter, and fails the dispatch
+	// with ErrDispatchRolledBack.
+	PartialDispatchRollback PartialDispatchAction = "rollback"
+	// PartialDispatchDeadLetter sends the updates to the dead-letter target,
+	// to store them in the other transport later, and reports the dispatch
+	// with ErrPartialDispatch.
+	PartialDispatchDeadLetter PartialDispatchAction = "dead_letter"
+)
+
+// PartialDispatchOutcome is the outcome of a partial dispatch, reported to the
+// metrics.
+type PartialDispatchOutcome string
+
+const (
+	// PartialDispatchRecovered is reported when a retry succeeded.
+	PartialDispatchRecovered PartialDispatchOutcome = "recovered"
+	// PartialDispatchIgnored is reported when the failure was only logged.
+	PartialDispatchIgnored PartialDispatchOutcome = "ignored"
+	// PartialDispatchRolledBack is reported when the update was retracted.
+	PartialDispatchRolledBack PartialDispatchOutcome = "rolled_back"
+	// PartialDispatchDeadLettered is reported when the update was sent to the
+	// dead-letter target.
+	PartialDispatchDeadLettered PartialDispatchOutcome = "dead_lettered"
+	// PartialDispatchFailed is reported when the rollback or the dead-letter
+	// target failed too.
+	PartialDispatchFailed PartialDispatchOutcome = "failed"
+)
+
+// PartialDispatchPolicy is the behavior of DualTransport when the transport not
+// serving reads fails to store updates already dispatched by the other one.
+type PartialDispatchPolicy struct {
+	// Retries is the number of times the write is retried, waiting RetryDelay
+	// (100ms when zero), doubled after each attempt, in between. Writes are
+	// serialized: the next updates wait during the retries.
+	Retries    int
+	RetryDelay time.Duration
+	// Action is taken when all the attempts failed, PartialDispatchIgnore
+	// when empty.
+	Action PartialDispatchAction
+	// DeadLetter receives the updates when Action is
+	// PartialDispatchDeadLetter.
+	DeadLetter PublishHookTarget
+}
+
+// PartialDispatchMetrics may be implemented by the Metrics collecting the
+// outcomes of the partial dispatches.
+type PartialDispatchMetrics interface {
+	// UpdatePartiallyDispatched collects metrics about an update that a
+	// transport failed to store.
+	UpdatePartiallyDispatched(u *Update, outcome PartialDispatchOutcome)
+}
+
+// TransportMetrics may be implemented by transports reporting metrics.
+type TransportMetrics interface {
+	SetMetrics(m Metrics)
+}
+
+// SetPartialDispatchPolicy sets the behavior when the transport not serving
+// reads fails to store updates. By default, the failures are logged.
+func (t *DualTransport) SetPartialDispatchPolicy(p PartialDispatchPolicy) error {
+	if p.Retries < 0 || p.RetryDelay < 0 {
+		return fmt.Errorf("%w: the retries and their delay must be positive", ErrInvalidPartialDispatchPolicy)
+	}
+
+	switch p.Action {
+	case "", PartialDispatchIgnore:
+	case PartialDispatchRollback:
+		// Both transports serve reads at some point.
+		for _, tr := range []Transport{t.from, t.to} {
+			if _, ok := tr.(TransportRetracter); !ok {
+				return fmt.Errorf("%w: rolling back requires transports supporting retractions", ErrInvalidPartialDispatchPolicy)
+			}
+		}
+	case PartialDispatchDeadLetter:
+		if p.DeadLetter == nil {
+			return fmt.Errorf("%w: missing dead-letter target", ErrInvalidPartialDispatchPolicy)
+		}
+	default:
+		return fmt.Errorf("%w: unknown action %q", ErrInvalidPartialDispatchPolicy, p.Action)
+	}
+
+	if p.RetryDelay == 0 {
+		p.RetryDelay = defaultPartialDispatchRetryDelay
+	}
+
+	t.mu.Lock()
+	t.policy = p
+	t.mu.Unlock()
+
+	return nil
+}
+
+// SetMetrics sets the metrics the outcomes of the partial dispatches are
+// reported to.
+func (t *DualTransport) SetMetrics(m Metrics) {
+	if pm, ok := m.(PartialDispatchMetrics); ok {
+		t.metrics = pm
+	}
+}
+
+// writeSecondary stores the updates dispatched by the transport serving reads
+// in the other one, applying the partial dispatch policy. It must be called
+// with mu held.
+func (t *DualTransport) writeSecondary(ctx context.Context, op string, primary, secondary Transport, updates []*Update) error {
+	write := func() error {
+		if op == "dispatch" {
+			return secondary.Dispatch(ctx, updates[0]) //nolint:wrapcheck
+		}
+
+		return dispatchGroup(ctx, secondary, updates)
+	}
+
+	err := write()
+	if err == nil {
+		return nil
+	}
+
+	delay := t.policy.RetryDelay
+	for range t.policy.Retries {
+		timer := time.NewTimer(delay)
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+		case <-timer.C:
+			err = write()
+		}
+
+		if err == nil {
+			t.reportPartialDispatch(updates, PartialDispatchRecovered)
+
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			break
+		}
+
+		delay *= 2
+	}
+
+	t.secondaryFailed(ctx, op, err)
+
+	switch t.policy.Action {
+	case PartialDispatchRollback:
+		if rbErr := t.rollback(ctx, primary, secondary, updates); rbErr != nil {
+			t.logPartialDispatchFailure(ctx, "roll back", rbErr)
+			t.reportPartialDispatch(updates, PartialDispatchFailed)
+
+			return fmt.Errorf("%w: %w", ErrPartialDispatch, err)
+		}
+
+		t.reportPartialDispatch(updates, PartialDispatchRolledBack)
+
+		return fmt.Errorf("%w: %w", ErrDispatchRolledBack, err)
+	case PartialDispatchDeadLetter:
+		for _, u := range updates {
+			if dlErr := t.policy.DeadLetter.Send(ctx, u); dlErr != nil {
+				t.logPartialDispatchFailure(ctx, "send to the dead-letter target", dlErr)
+				t.reportPartialDispatch([]*Update{u}, PartialDispatchFailed)
+
+				continue
+			}
+
+			t.reportPartialDispatch([]*Update{u}, PartialDispatchDeadLettered)
+		}
+
+		return fmt.Errorf("%w: %w", ErrPartialDispatch, err)
+	default:
+		t.reportPartialDispatch(updates, PartialDispatchIgnored)
+
+		return nil
+	}
+}
+
+// rollback retracts the updates from both transports, the other one possibly
+// holding some of the updates of a group.
+func (t *DualTransport) rollback(ctx context.Context, primary, secondary Transport, updates []*Update) error {
+	var errs []error
+
+	for _, u := range updates {
+		// Both transports must store the same ID.
+		r := newRetraction(u)
+		r.AssignUUID()
+
+		if err := primary.(TransportRetracter).Retract(ctx, u.ID, r); err != nil {
+			errs = append(errs, err)
+
+			continue
+		}
+
+		if err := secondary.(TransportRetracter).Retract(ctx, u.ID, r); err != nil && !errors.Is(err, ErrUpdateNotFound) {
+			t.secondaryFailed(ctx, "retract", err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (t *DualTransport) logPartialDispatchFailure(ctx context.Context, action string, err error) {
+	if t.logger.Enabled(ctx, slog.LevelError) {
+		t.logger.LogAttrs(ctx, slog.LevelError, "Dual-write: unable to "+action+" the updates the secondary transport failed to store", slog.Any("error", err))
+	}
+}
+
+func (t *DualTransport) reportPartialDispatch(updates []*Update, outcome PartialDispatchOutcome) {
+	if t.metrics == nil {
+		return
+	}
+
+	for _, u := range updates {
+		t.metrics.UpdatePartiallyDispatched(u, outcome)
+	}
+}
@@ -0,0 +1,225 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestStorage = errors.New("storage failure")
+
+// failingTransport fails the first failures dispatches, all of them when
+// negative.
+type failingTransport struct {
+	*BoltTransport
+
+	mu       sync.Mutex
+	failures int
+}
+
+func (t *failingTransport) fail() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.failures == 0 {
+		return false
+	}
+
+	t.failures--
+
+	return true
+}
+
+func (t *failingTransport) Dispatch(ctx context.Context, u *Update) error {
+	if t.fail() {
+		return errTestStorage
+	}
+
+	return t.BoltTransport.Dispatch(ctx, u) //nolint:wrapcheck
+}
+
+func (t *failingTransport) DispatchGroup(ctx context.Context, updates []*Update) error {
+	if t.fail() {
+		return errTestStorage
+	}
+
+	return t.BoltTransport.DispatchGroup(ctx, updates) //nolint:wrapcheck
+}
+
+// outcomeMetrics records the outcomes of the partial dispatches.
+type outcomeMetrics struct {
+	NopMetrics
+
+	mu       sync.Mutex
+	outcomes []PartialDispatchOutcome
+}
+
+func (m *outcomeMetrics) UpdatePartiallyDispatched(_ *Update, outcome PartialDispatchOutcome) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.outcomes = append(m.outcomes, outcome)
+}
+
+// createFailingDualTransport creates a DualTransport whose new transport fails
+// the first failures dispatches.
+func createFailingDualTransport(t *testing.T, failures int, p PartialDispatchPolicy) (*DualTransport, *BoltTransport, *failingTransport, *outcomeMetrics) {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	from, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(dir, "from.db"), "", 0, 0)
+	require.NoError(t, err)
+
+	to, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(dir, "to.db"), "", 0, 0)
+	require.NoError(t, err)
+
+	failing := &failingTransport{BoltTransport: to, failures: failures}
+	transport := NewDualTransport(from, failing, slog.Default(), false)
+
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(context.Background()))
+	})
+
+	require.NoError(t, transport.SetPartialDispatchPolicy(p))
+
+	m := &outcomeMetrics{}
+	transport.SetMetrics(m)
+
+	return transport, from, failing, m
+}
+
+func TestDualTransportPartialDispatchRetry(t *testing.T) {
+	t.Parallel()
+
+	transport, _, to, m := createFailingDualTransport(t, 2, PartialDispatchPolicy{Retries: 2, RetryDelay: 1})
+
+	u := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, transport.Dispatch(t.Context(), u))
+	assert.Equal(t, []string{u.ID}, readHistoryIDs(t, to))
+	assert.Equal(t, []PartialDispatchOutcome{PartialDispatchRecovered}, m.outcomes)
+}
+
+func TestDualTransportPartialDispatchIgnore(t *testing.T) {
+	t.Parallel()
+
+	transport, from, to, m := createFailingDualTransport(t, -1, PartialDispatchPolicy{Retries: 1, RetryDelay: 1})
+
+	u := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, transport.Dispatch(t.Context(), u))
+	assert.Equal(t, []string{u.ID}, readHistoryIDs(t, from))
+	assert.Empty(t, readHistoryIDs(t, to))
+	assert.Equal(t, []PartialDispatchOutcome{PartialDispatchIgnored}, m.outcomes)
+}
+
+func TestDualTransportPartialDispatchDeadLetter(t *testing.T) {
+	t.Parallel()
+
+	deadLetter := make(chanPublishHookTarget, 10)
+	transport, _, _, m := createFailingDualTransport(t, -1, PartialDispatchPolicy{Action: PartialDispatchDeadLetter, DeadLetter: deadLetter})
+
+	updates := []*Update{{Topic: "https://example.com/books/1"}, {Topic: "https://example.com/books/2"}}
+	err := transport.DispatchGroup(t.Context(), updates)
+	require.ErrorIs(t, err, ErrPartialDispatch)
+	require.ErrorIs(t, err, errTestStorage)
+
+	assert.Equal(t, updates[0], <-deadLetter)
+	assert.Equal(t, updates[1], <-deadLetter)
+	assert.Equal(t, []PartialDispatchOutcome{PartialDispatchDeadLettered, PartialDispatchDeadLettered}, m.outcomes)
+}
+
+func TestDualTransportPartialDispatchRollback(t *testing.T) {
+	t.Parallel()
+
+	transport, from, _, m := createFailingDualTransport(t, -1, PartialDispatchPolicy{Action: PartialDispatchRollback})
+	ctx := t.Context()
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/books/1"}), nil)
+	require.NoError(t, transport.AddSubscriber(ctx, s))
+
+	u := &Update{Topic: "https://example.com/books/1"}
+	require.ErrorIs(t, transport.Dispatch(ctx, u), ErrDispatchRolledBack)
+
+	_, err := from.RetractableUpdate(ctx, u.ID)
+	require.ErrorIs(t, err, ErrUpdateNotFound)
+
+	// The subscribers already received the update, they receive its retraction.
+	assert.Equal(t, u, <-s.Receive())
+
+	r := <-s.Receive()
+	assert.Equal(t, reservedEventType, r.Type)
+	assert.Contains(t, r.Data, u.ID)
+
+	assert.Equal(t, []PartialDispatchOutcome{PartialDispatchRolledBack}, m.outcomes)
+}
+
+func TestDualTransportInvalidPartialDispatchPolicy(t *testing.T) {
+	t.Parallel()
+
+	transport := NewDualTransport(NewLocalTransport(NewSubscriberList(0)), NewLocalTransport(NewSubscriberList(0)), slog.Default(), false)
+
+	for _, p := range []PartialDispatchPolicy{
+		{Retries: -1},
+		{Action: "unknown"},
+		{Action: PartialDispatchDeadLetter},
+		{Action: PartialDispatchRollback},
+	} {
+		require.ErrorIs(t, transport.SetPartialDispatchPolicy(p), ErrInvalidPartialDispatchPolicy)
+	}
+}
+
+func TestPublishHandlerPartialDispatch(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name       string
+		policy     PartialDispatchPolicy
+		statusCode int
+	}{
+		{"ignore", PartialDispatchPolicy{}, http.StatusOK},
+		{"dead_letter", PartialDispatchPolicy{Action: PartialDispatchDeadLetter, DeadLetter: make(chanPublishHookTarget, 1)}, http.StatusAccepted},
+		{"rollback", PartialDispatchPolicy{Action: PartialDispatchRollback}, http.StatusServiceUnavailable},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport, _, _, _ := createFailingDualTransport(t, -1, tc.policy)
+			hooks := make(chanPublishHookTarget, 1)
+			hub := createDummy(t, WithTransport(transport), WithPublishHooks(PublishHook{Target: hooks}))
+
+			form := url.Values{"topic": {"https://example.com/books/1"}, "data": {"Hello!"}}
+
+			req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+			req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+			w := httptest.NewRecorder()
+			hub.PublishHandler(w, req)
+
+			resp := w.Result()
+			body, _ := io.ReadAll(resp.Body)
+			_ = resp.Body.Close()
+
+			assert.Equal(t, tc.statusCode, resp.StatusCode)
+
+			if tc.statusCode == http.StatusServiceUnavailable {
+				return
+			}
+
+			// The update is published.
+			assert.Equal(t, string(body), (<-hooks).ID)
+		})
+	}
+}
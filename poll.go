@@ -0,0 +1,170 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// pollURL is the long-polling endpoint.
+	pollURL = defaultHubURL + "/poll"
+
+	// paramTimeout is the poll query parameter holding the maximum number of
+	// seconds to wait for an update.
+	paramTimeout = "timeout"
+
+	// DefaultLongPollingTimeout is the default maximum duration of a poll.
+	DefaultLongPollingTimeout = 30 * time.Second
+)
+
+// WithLongPolling enables the long-polling endpoint,
+// /.well-known/mercure/poll, for the clients that can't keep SSE connections
+// open, serverless functions for instance. A poll waits up to timeout for an
+// update, DefaultLongPollingTimeout if 0. See LongPollingHandler.
+func WithLongPolling(timeout time.Duration) Option {
+	return func(o *opt) error {
+		if timeout <= 0 {
+			timeout = DefaultLongPollingTimeout
+		}
+
+		o.longPollingTimeout = timeout
+
+		return nil
+	}
+}
+
+// LongPollingHandler returns, in a JSON array, the updates received by a
+// subscriber, waiting for the first one up to the configured timeout or,
+// when shorter, the timeout query parameter, in seconds. An empty array is
+// returned when no update has been received before the timeout.
+//
+// The subscription is the one of the subscribe endpoint: the same query
+// parameters select the topics and the updates to replay, and the same
+// authorization applies. Clients pass the ID of the last update they
+// received as last_event_id to the next poll, to receive the updates
+// published meanwhile when the transport keeps a history. Up to the limit
+// query parameter updates are returned, 100 by default and 1000 at most,
+// in the format of the history endpoint.
+func (h *Hub) LongPollingHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+
+	limit, err := parseHistoryLimit(values)
+	if err != nil {
+		http.Error(w, `Invalid "`+paramLimit+`" parameter`, http.StatusBadRequest)
+
+		return
+	}
+
+	timeout, err := h.parsePollTimeout(values)
+	if err != nil {
+		http.Error(w, `Invalid "`+paramTimeout+`" parameter`, http.StatusBadRequest)
+
+		return
+	}
+
+	ctx := r.Context()
+
+	s, _ := h.addSubscriber(ctx, w, r, false)
+	if s == nil {
+		return
+	}
+
+	ctx = context.WithValue(ctx, SubscriberContextKey, &s.Subscriber)
+
+	reason := DisconnectReasonClient
+	defer func() { h.shutdown(ctx, s, reason) }()
+
+	h.subscriberConnected(ctx, s, "New long-polling subscriber")
+
+	// Stop before the token expires or the write timeout elapses.
+	if deadline, _ := h.getWriteDeadline(s); !deadline.IsZero() {
+		timeout = min(timeout, time.Until(deadline.Add(-h.dispatchTimeout)))
+	}
+
+	updates, reason := h.poll(ctx, s, timeout, limit)
+
+	header := w.Header()
+	if s.RequestLastEventIDSet {
+		header["Mercure-Last-Event-Id"] = []string{<-s.responseLastEventID}
+	}
+
+	header["Content-Type"] = []string{"application/json"}
+	header["Cache-Control"] = headerCacheControl
+	h.setResponseHeaders(header, EndpointSubscribe, s.SubscribedMatchers)
+
+	j, err := json.Marshal(updates)
+	if err != nil {
+		// Can't happen
+		panic(err)
+	}
+
+	if _, err := w.Write(j); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write poll response", slog.Any("error", err))
+	}
+}
+
+// poll returns the updates received by the subscriber, up to limit, waiting
+// up to timeout for the first one.
+func (h *Hub) poll(ctx context.Context, s *LocalSubscriber, timeout time.Duration, limit int) ([]historyUpdate, DisconnectReason) {
+	// The updates of the history have already been received.
+	updates, open := receiveAvailable(s, make([]historyUpdate, 0), limit)
+	if len(updates) != 0 || !open {
+		return updates, DisconnectReasonClient
+	}
+
+	timer := time.NewTimer(max(timeout, 0))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	case <-h.ctx.Done():
+		return updates, DisconnectReasonHubShutdown
+	case u, ok := <-s.Receive():
+		if ok {
+			updates, _ = receiveAvailable(s, append(updates, newSubscriberUpdate(s, u)), limit)
+		}
+	}
+
+	return updates, DisconnectReasonClient
+}
+
+// receiveAvailable appends the updates already received by the subscriber,
+// up to limit, and reports whether the subscriber is still connected.
+func receiveAvailable(s *LocalSubscriber, updates []historyUpdate, limit int) ([]historyUpdate, bool) {
+	for len(updates) < limit {
+		select {
+		case u, ok := <-s.Receive():
+			if !ok {
+				return updates, false
+			}
+
+			updates = append(updates, newSubscriberUpdate(s, u))
+		default:
+			return updates, true
+		}
+	}
+
+	return updates, true
+}
+
+// parsePollTimeout returns the timeout query parameter, bounded by the
+// configured timeout.
+func (h *Hub) parsePollTimeout(values url.Values) (time.Duration, error) {
+	v := values.Get(paramTimeout)
+	if v == "" {
+		return h.longPollingTimeout, nil
+	}
+
+	seconds, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, err //nolint:wrapcheck
+	}
+
+	return min(time.Duration(seconds)*time.Second, h.longPollingTimeout), nil
+}
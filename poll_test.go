@@ -0,0 +1,124 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func poll(t *testing.T, hub *Hub, query string, token string) (*http.Response, []historyUpdate) {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodGet, pollURL+"?"+query, nil)
+	if token != "" {
+		req.Header.Add("Authorization", bearerPrefix+token)
+	}
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	resp := w.Result()
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+
+	var updates []historyUpdate
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&updates))
+
+	return resp, updates
+}
+
+func TestLongPolling(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithLongPolling(time.Minute))
+
+	var wg sync.WaitGroup
+
+	wg.Go(func() {
+		resp, updates := poll(t, hub, "match_urlpattern=https%3A%2F%2Fexample.com%2Fbooks%2F%3Aid", createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"}))
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		assert.Equal(t, []historyUpdate{{ID: "a", Topics: []string{"https://example.com/books/1"}, Data: "private", Private: true}}, updates)
+	})
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/2", Private: true, Event: Event{ID: "b"}}))
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Private: true, Event: Event{ID: "a", Data: "private"}}))
+
+	wg.Wait()
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+}
+
+func TestLongPollingTimeout(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithLongPolling(10*time.Millisecond))
+
+	resp, updates := poll(t, hub, "match=*", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []historyUpdate{}, updates)
+
+	resp, updates = poll(t, hub, "match=*&timeout=3600", "")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, []historyUpdate{}, updates)
+}
+
+func TestLongPollingHistory(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithLongPolling(time.Minute), WithTransport(createBoltTransport(t, 0, 0)))
+
+	for _, id := range []string{"1", "2", "3", "4"} {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: id}}))
+	}
+
+	resp, updates := poll(t, hub, "match=https%3A%2F%2Fexample.com%2Fbooks%2F1&last_event_id=1&limit=2", "")
+	assert.Equal(t, "1", resp.Header.Get("Mercure-Last-Event-Id"))
+	require.Len(t, updates, 2)
+	assert.Equal(t, "2", updates[0].ID)
+	assert.Equal(t, "3", updates[1].ID)
+
+	_, updates = poll(t, hub, "match=https%3A%2F%2Fexample.com%2Fbooks%2F1&last_event_id=3&timeout=0", "")
+	require.Len(t, updates, 1)
+	assert.Equal(t, "4", updates[0].ID)
+}
+
+func TestLongPollingInvalidParameters(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithLongPolling(time.Minute))
+
+	for _, query := range []string{"match=*&timeout=-1", "match=*&timeout=foo", "match=*&limit=0", ""} {
+		resp, _ := poll(t, hub, query, "")
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, query)
+	}
+}
+
+func TestLongPollingUnauthorized(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithLongPolling(time.Minute))
+
+	resp, _ := poll(t, hub, "match=*", "")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestLongPollingDisabled(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	resp, _ := poll(t, hub, "match=*", "")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
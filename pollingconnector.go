@@ -0,0 +1,458 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// PollingFormat is the format of the documents a polling connector fetches.
+type PollingFormat string
+
+const (
+	// PollingFormatJSON is a JSON document. An array is a list of items
+	// identified by their IDField, any other value is a single item.
+	PollingFormatJSON PollingFormat = "json"
+	// PollingFormatAtom is an Atom feed, whose items are the entries.
+	PollingFormatAtom PollingFormat = "atom"
+	// PollingFormatRSS is an RSS feed, whose items are the items of the
+	// channel.
+	PollingFormatRSS PollingFormat = "rss"
+)
+
+const (
+	// defaultPollingInterval is the interval between two fetches of a
+	// polling connector.
+	defaultPollingInterval = time.Minute
+	// defaultPollingTimeout bounds a fetch of a polling connector.
+	defaultPollingTimeout = 10 * time.Second
+	// defaultPollingIDField is the field identifying the items of a JSON
+	// array.
+	defaultPollingIDField = "id"
+	// maxPolledDocumentSize bounds the size of the fetched documents.
+	maxPolledDocumentSize = 10 << 20
+	// pollingIDPlaceholder is replaced with the ID of the item in the topic.
+	pollingIDPlaceholder = "{id}"
+)
+
+var (
+	// ErrInvalidPollingConnector is returned by NewHub when a polling
+	// connector is not valid.
+	ErrInvalidPollingConnector = errors.New("invalid polling connector")
+	// errPollingStatus is returned when the polled endpoint answers with an
+	// unexpected status code.
+	errPollingStatus = errors.New("unexpected polling status")
+	// errUnknownPolledFormat is returned when the format of a fetched
+	// document can't be detected.
+	errUnknownPolledFormat = errors.New("unknown document format")
+)
+
+// PollingConnector periodically fetches a JSON document, an Atom or an RSS
+// feed, and publishes the items created or changed since the previous fetch.
+// The items of the first fetch are only recorded, deleted items are not
+// published. It surfaces read-only upstream APIs as realtime feeds.
+type PollingConnector struct {
+	// URL of the polled document.
+	URL string
+	// Interval between two fetches, one minute when zero.
+	Interval time.Duration
+	// Format of the document, detected from its content when empty.
+	Format PollingFormat
+	// IDField is the field identifying the items of a JSON array, "id" when
+	// empty. Items without it are identified by their content.
+	IDField string
+	// Topic of the published updates. "{id}" is replaced with the
+	// percent-encoded ID of the item.
+	Topic string
+	// Private publishes private updates.
+	Private bool
+	// Header holds the headers added to the requests, typically an
+	// Authorization header.
+	Header http.Header
+	// Client sends the requests. A nil client uses a client with a 10
+	// seconds timeout.
+	Client *http.Client
+}
+
+// polledItem is an item of a fetched document.
+type polledItem struct {
+	id   string
+	data string
+}
+
+// WithPollingConnectors sets connectors publishing the changes of external
+// documents.
+func WithPollingConnectors(connectors ...PollingConnector) Option {
+	return func(o *opt) error {
+		for i, c := range connectors {
+			switch c.Format {
+			case "", PollingFormatJSON, PollingFormatAtom, PollingFormatRSS:
+			default:
+				return fmt.Errorf("%w %d: unknown format %q", ErrInvalidPollingConnector, i, c.Format)
+			}
+
+			if c.URL == "" || c.Topic == "" {
+				return fmt.Errorf("%w %d: the URL and the topic are required", ErrInvalidPollingConnector, i)
+			}
+
+			if c.Interval < 0 {
+				return fmt.Errorf("%w %d: the interval must be positive", ErrInvalidPollingConnector, i)
+			}
+		}
+
+		o.pollingConnectors = connectors
+
+		return nil
+	}
+}
+
+// startPollingConnectors starts the connectors, stopped when the context of
+// the hub is done.
+func (h *Hub) startPollingConnectors() {
+	for _, c := range h.pollingConnectors {
+		if c.Interval == 0 {
+			c.Interval = defaultPollingInterval
+		}
+
+		if c.IDField == "" {
+			c.IDField = defaultPollingIDField
+		}
+
+		if c.Client == nil {
+			c.Client = &http.Client{Timeout: defaultPollingTimeout}
+		}
+
+		p := &poller{PollingConnector: c, hub: h}
+
+		go p.run(h.ctx)
+	}
+}
+
+// poller runs a polling connector.
+type poller struct {
+	PollingConnector
+
+	hub          *Hub
+	etag         string
+	lastModified string
+	// seen holds the hash of the data of the items of the previous fetch,
+	// nil before the first one.
+	seen map[string]uint64
+}
+
+func (p *poller) run(ctx context.Context) {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := p.poll(ctx); err != nil && ctx.Err() == nil && p.hub.logger.Enabled(ctx, slog.LevelError) {
+			p.hub.logger.LogAttrs(ctx, slog.LevelError, "Failed to poll", slog.String("url", p.URL), slog.Any("error", err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll fetches the document, and publishes the items created or changed since
+// the previous fetch.
+func (p *poller) poll(ctx context.Context) error {
+	items, err := p.fetch(ctx)
+	if err != nil || items == nil {
+		return err
+	}
+
+	seen := make(map[string]uint64, len(items))
+
+	for _, item := range items {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(item.data))
+		sum := h.Sum64()
+
+		if previous, ok := seen[item.id]; ok && previous == sum {
+			continue
+		}
+
+		seen[item.id] = sum
+
+		if p.seen == nil {
+			continue
+		}
+
+		if previous, ok := p.seen[item.id]; ok && previous == sum {
+			continue
+		}
+
+		u := &Update{
+			Topic:   strings.ReplaceAll(p.Topic, pollingIDPlaceholder, url.PathEscape(item.id)),
+			Private: p.Private,
+			Event:   Event{Data: item.data},
+		}
+
+		if err := p.hub.Publish(ctx, u); err != nil && !errors.Is(err, ErrPartialDispatch) {
+			// Publish again on the next fetch.
+			delete(seen, item.id)
+
+			if p.hub.logger.Enabled(ctx, slog.LevelError) {
+				p.hub.logger.LogAttrs(ctx, slog.LevelError, "Failed to publish polled item", slog.String("url", p.URL), slog.String("item", item.id), slog.Any("error", err))
+			}
+		}
+	}
+
+	p.seen = seen
+
+	return nil
+}
+
+// fetch returns the items of the document, nil if it didn't change.
+func (p *poller) fetch(ctx context.Context) ([]polledItem, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create polling request: %w", err)
+	}
+
+	for k, v := range p.Header {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+
+	if p.etag != "" {
+		req.Header.Set("If-None-Match", p.etag)
+	}
+
+	if p.lastModified != "" {
+		req.Header.Set("If-Modified-Since", p.lastModified)
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to poll: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, nil
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%w: %d", errPollingStatus, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPolledDocumentSize))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the polled document: %w", err)
+	}
+
+	items, err := parsePolledDocument(body, p.Format, p.IDField)
+	if err != nil {
+		return nil, err
+	}
+
+	p.etag, p.lastModified = resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+
+	return items, nil
+}
+
+// parsePolledDocument returns the items of the document, detecting its format
+// from its content if not set.
+func parsePolledDocument(body []byte, format PollingFormat, idField string) ([]polledItem, error) {
+	if format == "" {
+		var err error
+		if format, err = detectPolledFormat(body); err != nil {
+			return nil, err
+		}
+	}
+
+	switch format {
+	case PollingFormatJSON:
+		return parsePolledJSON(body, idField)
+	case PollingFormatAtom:
+		return parsePolledAtom(body)
+	default:
+		return parsePolledRSS(body)
+	}
+}
+
+func detectPolledFormat(body []byte) (PollingFormat, error) {
+	trimmed := bytes.TrimSpace(body)
+	if len(trimmed) != 0 && trimmed[0] != '<' {
+		return PollingFormatJSON, nil
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(trimmed))
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", errUnknownPolledFormat, err)
+		}
+
+		if se, ok := tok.(xml.StartElement); ok {
+			switch se.Name.Local {
+			case "feed":
+				return PollingFormatAtom, nil
+			case "rss":
+				return PollingFormatRSS, nil
+			default:
+				return "", fmt.Errorf("%w: root element %q", errUnknownPolledFormat, se.Name.Local)
+			}
+		}
+	}
+}
+
+func parsePolledJSON(body []byte, idField string) ([]polledItem, error) {
+	var doc json.RawMessage
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON document: %w", err)
+	}
+
+	var elements []json.RawMessage
+	if err := json.Unmarshal(doc, &elements); err != nil {
+		// Not an array: the whole document is the item.
+		data, err := compactJSON(doc)
+
+		return []polledItem{{data: data}}, err
+	}
+
+	items := make([]polledItem, 0, len(elements))
+
+	for _, e := range elements {
+		data, err := compactJSON(e)
+		if err != nil {
+			return nil, err
+		}
+
+		item := polledItem{id: data, data: data}
+
+		var fields map[string]any
+		if json.Unmarshal(e, &fields) == nil {
+			switch id := fields[idField].(type) {
+			case string:
+				item.id = id
+			case float64:
+				item.id = string(mustMarshalJSON(id))
+			}
+		}
+
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func compactJSON(raw json.RawMessage) (string, error) {
+	var b bytes.Buffer
+	if err := json.Compact(&b, raw); err != nil {
+		return "", fmt.Errorf("invalid JSON document: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+func mustMarshalJSON(v any) []byte {
+	b, _ := json.Marshal(v)
+
+	return b
+}
+
+// polledEntryJSON is the data of the updates published for the items of
+// feeds.
+type polledEntryJSON struct {
+	ID      string `json:"id"`
+	Title   string `json:"title,omitempty"`
+	Link    string `json:"link,omitempty"`
+	Updated string `json:"updated,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type atomFeedXML struct {
+	Entries []struct {
+		ID      string `xml:"id"`
+		Title   string `xml:"title"`
+		Updated string `xml:"updated"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+		Links   []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+	} `xml:"entry"`
+}
+
+func parsePolledAtom(body []byte) ([]polledItem, error) {
+	var feed atomFeedXML
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("invalid Atom feed: %w", err)
+	}
+
+	items := make([]polledItem, 0, len(feed.Entries))
+
+	for _, e := range feed.Entries {
+		entry := polledEntryJSON{ID: e.ID, Title: e.Title, Updated: e.Updated, Summary: e.Summary}
+		if entry.Summary == "" {
+			entry.Summary = e.Content
+		}
+
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				entry.Link = l.Href
+
+				break
+			}
+		}
+
+		items = append(items, polledFeedItem(entry))
+	}
+
+	return items, nil
+}
+
+type rssFeedXML struct {
+	Items []struct {
+		GUID        string `xml:"guid"`
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		PubDate     string `xml:"pubDate"`
+		Description string `xml:"description"`
+	} `xml:"channel>item"`
+}
+
+func parsePolledRSS(body []byte) ([]polledItem, error) {
+	var feed rssFeedXML
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, fmt.Errorf("invalid RSS feed: %w", err)
+	}
+
+	items := make([]polledItem, 0, len(feed.Items))
+
+	for _, i := range feed.Items {
+		entry := polledEntryJSON{ID: i.GUID, Title: i.Title, Link: i.Link, Updated: i.PubDate, Summary: i.Description}
+		if entry.ID == "" {
+			entry.ID = i.Link
+		}
+
+		items = append(items, polledFeedItem(entry))
+	}
+
+	return items, nil
+}
+
+func polledFeedItem(entry polledEntryJSON) polledItem {
+	data := string(mustMarshalJSON(entry))
+	if entry.ID == "" {
+		return polledItem{id: data, data: data}
+	}
+
+	return polledItem{id: entry.ID, data: data}
+}
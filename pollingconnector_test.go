@@ -0,0 +1,118 @@
+package mercure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolledDocument(t *testing.T) {
+	t.Parallel()
+
+	items, err := parsePolledDocument([]byte(`[{"id": 1, "title": "foo"}, {"uid": "b"}, {"id": "c"}]`), "", "id")
+	require.NoError(t, err)
+	assert.Equal(t, []polledItem{
+		{id: "1", data: `{"id":1,"title":"foo"}`},
+		{id: `{"uid":"b"}`, data: `{"uid":"b"}`},
+		{id: "c", data: `{"id":"c"}`},
+	}, items)
+
+	items, err = parsePolledDocument([]byte(` {"status": "ok"}`), "", "id")
+	require.NoError(t, err)
+	assert.Equal(t, []polledItem{{data: `{"status":"ok"}`}}, items)
+
+	items, err = parsePolledDocument([]byte(`<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+	<entry>
+		<id>urn:1</id>
+		<title>Foo</title>
+		<link rel="self" href="https://example.com/self"/>
+		<link href="https://example.com/1"/>
+		<updated>2026-01-01T00:00:00Z</updated>
+		<content>Bar</content>
+	</entry>
+</feed>`), "", "id")
+	require.NoError(t, err)
+	assert.Equal(t, []polledItem{{id: "urn:1", data: `{"id":"urn:1","title":"Foo","link":"https://example.com/1","updated":"2026-01-01T00:00:00Z","summary":"Bar"}`}}, items)
+
+	items, err = parsePolledDocument([]byte(`<rss version="2.0"><channel>
+	<item><title>Foo</title><link>https://example.com/1</link></item>
+	<item><guid>2</guid><title>Bar</title></item>
+</channel></rss>`), "", "id")
+	require.NoError(t, err)
+	assert.Equal(t, []polledItem{
+		{id: "https://example.com/1", data: `{"id":"https://example.com/1","title":"Foo","link":"https://example.com/1"}`},
+		{id: "2", data: `{"id":"2","title":"Bar"}`},
+	}, items)
+
+	_, err = parsePolledDocument([]byte(`<html></html>`), "", "id")
+	require.ErrorIs(t, err, errUnknownPolledFormat)
+}
+
+func TestPollingConnector(t *testing.T) {
+	t.Parallel()
+
+	var fetches atomic.Int32
+
+	docs := []string{
+		`[{"id": "a", "v": 1}, {"id": "b", "v": 1}]`,
+		`[{"id": "a", "v": 1}, {"id": "b", "v": 2}, {"id": "c/d", "v": 1}]`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer foo", r.Header.Get("Authorization"))
+
+		n := fetches.Add(1)
+		if n > 2 {
+			assert.Equal(t, `"2"`, r.Header.Get("If-None-Match"))
+			w.WriteHeader(http.StatusNotModified)
+
+			return
+		}
+
+		w.Header().Set("ETag", `"2"`)
+		_, _ = w.Write([]byte(docs[n-1]))
+	}))
+	defer srv.Close()
+
+	published := make(chanPublishHookTarget, 10)
+	createDummy(t,
+		WithPublishHooks(PublishHook{Target: published}),
+		WithPollingConnectors(PollingConnector{
+			URL:      srv.URL,
+			Interval: 10 * time.Millisecond,
+			Topic:    "https://example.com/items/{id}",
+			Header:   http.Header{"Authorization": {"Bearer foo"}},
+		}),
+	)
+
+	for _, want := range [][2]string{
+		{"https://example.com/items/b", `{"id":"b","v":2}`},
+		{"https://example.com/items/c%2Fd", `{"id":"c/d","v":1}`},
+	} {
+		u := <-published
+		assert.Equal(t, want[0], u.Topic)
+		assert.Equal(t, want[1], u.Data)
+	}
+
+	assert.Eventually(t, func() bool { return fetches.Load() > 3 }, time.Second, 10*time.Millisecond)
+	assert.Empty(t, published)
+}
+
+func TestWithPollingConnectorsInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, c := range []PollingConnector{
+		{URL: "https://example.com"},
+		{Topic: "https://example.com/foo"},
+		{URL: "https://example.com", Topic: "https://example.com/foo", Format: "csv"},
+		{URL: "https://example.com", Topic: "https://example.com/foo", Interval: -time.Second},
+	} {
+		_, err := NewHub(t.Context(), WithPollingConnectors(c))
+		assert.ErrorIs(t, err, ErrInvalidPollingConnector)
+	}
+}
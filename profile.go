@@ -0,0 +1,112 @@
+package mercure
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+)
+
+// ErrUnknownProfile is returned when a runtime profile doesn't exist.
+var ErrUnknownProfile = errors.New("unknown profile")
+
+// Profile is a named set of tuning settings, see WithProfile.
+type Profile string
+
+const (
+	// ProfileEmbedded minimizes the memory used by the hub, for gateways and
+	// other small devices serving a few subscribers: small buffers and
+	// caches, a single shard.
+	ProfileEmbedded Profile = "embedded"
+	// ProfileBroadcast maximizes the throughput of hubs fanning out the
+	// updates to a very large number of subscribers: large caches, one
+	// shard per CPU, and slow subscribers kept connected, losing their
+	// oldest updates, rather than reconnecting and replaying the history.
+	ProfileBroadcast Profile = "broadcast"
+)
+
+// ProfileSettings are the settings of a profile.
+type ProfileSettings struct {
+	// SubscriberBufferSize and OverflowPolicy are passed to
+	// WithSubscriberBuffer.
+	SubscriberBufferSize int
+	OverflowPolicy       OverflowPolicy
+	// DispatchWatermark is passed to WithDispatchWatermark.
+	DispatchWatermark int
+	// SubscriberShards is passed to WithSubscriberShards.
+	SubscriberShards int
+	// TopicMatcherCacheSize is the size of the cache of the topic matcher
+	// store created by NewHub, see NewTopicMatcherStore.
+	TopicMatcherCacheSize int
+}
+
+// Settings returns the settings of the profile.
+func (p Profile) Settings() (ProfileSettings, error) {
+	switch p {
+	case ProfileEmbedded:
+		return ProfileSettings{
+			SubscriberBufferSize:  64,
+			OverflowPolicy:        OverflowDisconnect,
+			DispatchWatermark:     4096,
+			SubscriberShards:      1,
+			TopicMatcherCacheSize: 1000,
+		}, nil
+	case ProfileBroadcast:
+		return ProfileSettings{
+			SubscriberBufferSize:  DefaultSubscriberBufferSize,
+			OverflowPolicy:        OverflowDropOldest,
+			DispatchWatermark:     1_000_000,
+			SubscriberShards:      runtime.GOMAXPROCS(0),
+			TopicMatcherCacheSize: 1_000_000,
+		}, nil
+	}
+
+	return ProfileSettings{}, fmt.Errorf("%w: %q", ErrUnknownProfile, p)
+}
+
+// WithProfile tunes the hub with the settings of a profile. The settings
+// configured explicitly, with the other options, take precedence whatever
+// their order. The profile doesn't change the durability of the transport.
+func WithProfile(p Profile) Option {
+	return func(o *opt) error {
+		s, err := p.Settings()
+		if err != nil {
+			return err
+		}
+
+		o.profile = &s
+
+		return nil
+	}
+}
+
+// applyProfile sets the settings of the profile not configured explicitly.
+func (o *opt) applyProfile() error {
+	s := o.profile
+	if s == nil {
+		return nil
+	}
+
+	if o.subscriberBufferSize == 0 {
+		o.subscriberBufferSize = s.SubscriberBufferSize
+		o.overflowPolicy = s.OverflowPolicy
+	}
+
+	if o.dispatchWatermark == 0 {
+		o.dispatchWatermark = s.DispatchWatermark
+	}
+
+	if o.subscriberShards == 0 {
+		o.subscriberShards = s.SubscriberShards
+	}
+
+	if o.topicMatcherStore == nil {
+		tms, err := NewTopicMatcherStore(s.TopicMatcherCacheSize)
+		if err != nil {
+			return err
+		}
+
+		o.topicMatcherStore = tms
+	}
+
+	return nil
+}
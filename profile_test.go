@@ -0,0 +1,37 @@
+package mercure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithProfile(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithProfile("tiny"))
+	require.ErrorIs(t, err, ErrUnknownProfile)
+
+	hub := createDummy(t, WithProfile(ProfileEmbedded))
+	assert.Equal(t, 64, hub.subscriberBufferSize)
+	assert.Equal(t, OverflowDisconnect, hub.overflowPolicy)
+	assert.Equal(t, 4096, hub.dispatchWatermark)
+	assert.Equal(t, 1, hub.subscriberShards)
+
+	matchers := []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/profile"}}
+	updates, err := hub.Subscribe(t.Context(), matchers, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 64, cap(updates))
+}
+
+func TestWithProfileExplicitSettings(t *testing.T) {
+	t.Parallel()
+
+	// The explicit settings win, whatever their order.
+	hub := createDummy(t, WithSubscriberBuffer(10, OverflowDropNewest), WithProfile(ProfileBroadcast), WithSubscriberShards(3))
+	assert.Equal(t, 10, hub.subscriberBufferSize)
+	assert.Equal(t, OverflowDropNewest, hub.overflowPolicy)
+	assert.Equal(t, 1_000_000, hub.dispatchWatermark)
+	assert.Equal(t, 3, hub.subscriberShards)
+}
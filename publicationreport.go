@@ -0,0 +1,172 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// preferRepresentation is the preference (RFC 7240) of the publishers
+// requesting a publication report.
+const preferRepresentation = "return=representation"
+
+// PublicationPersistence tells whether the transport stored an update.
+type PublicationPersistence string
+
+const (
+	// PublicationStored is reported when the transport stored the update in
+	// its history.
+	PublicationStored PublicationPersistence = "stored"
+	// PublicationPartiallyStored is reported when the update has been
+	// dispatched, but a transport failed to store it (see ErrPartialDispatch).
+	PublicationPartiallyStored PublicationPersistence = "partial"
+	// PublicationNotStored is reported when the transport doesn't keep a
+	// history.
+	PublicationNotStored PublicationPersistence = "not_stored"
+	// PublicationDuplicate is reported when the update has already been
+	// published with the same idempotency key, and has not been published
+	// again.
+	PublicationDuplicate PublicationPersistence = "duplicate"
+	// PublicationDropped is reported when a routing rule dropped the update.
+	PublicationDropped PublicationPersistence = "dropped"
+)
+
+// PublicationForwarding tells which subscribers an update has been dispatched
+// to.
+type PublicationForwarding string
+
+const (
+	// PublicationForwardedToCluster is reported when the transport forwards
+	// the update to all the nodes of the cluster, such as Redis or Kafka.
+	PublicationForwardedToCluster PublicationForwarding = "cluster"
+	// PublicationLocal is reported when the update has only been dispatched
+	// to the subscribers of this node, because the transport is not
+	// distributed or because the local fallback is in use.
+	PublicationLocal PublicationForwarding = "local"
+	// PublicationNotForwarded is reported when the update has not been
+	// dispatched, because it is a duplicate or has been dropped.
+	PublicationNotForwarded PublicationForwarding = "none"
+)
+
+// AppliedRoutingRule is a routing rule applied to a publication.
+type AppliedRoutingRule struct {
+	// Name is the name of the rule.
+	Name string `json:"name"`
+	// Action is what the rule did.
+	Action RoutingAction `json:"action"`
+	// Topic is the topic of the copy of the update created by the rule, for
+	// RoutingAddTopic.
+	Topic string `json:"topic,omitempty"`
+}
+
+// PublicationReport describes what the hub did with an update, see
+// Hub.PublishWithReport.
+type PublicationReport struct {
+	// ID is the ID of the update, generated by the hub if not set.
+	ID string `json:"id"`
+	// Topics are the topics the update has been published on.
+	Topics []string `json:"topics"`
+	// RoutingRules are the routing rules applied to the update, in order.
+	RoutingRules []AppliedRoutingRule `json:"routing_rules,omitempty"`
+	// Retained reports whether the update is the retained value of its topic
+	// (see WithRetainedValues).
+	Retained bool `json:"retained"`
+	// Persistence tells whether the transport stored the update.
+	Persistence PublicationPersistence `json:"persistence"`
+	// Forwarding tells which subscribers the update has been dispatched to.
+	Forwarding PublicationForwarding `json:"forwarding"`
+	// Delivery counts the subscribers the update has been handed to, when a
+	// delivery receipt has been requested too.
+	Delivery *DeliveryReceipt `json:"delivery,omitempty"`
+}
+
+// publicationReport collects what Hub.Publish does with an update.
+type publicationReport struct {
+	duplicate bool
+	dropped   bool
+	rules     []AppliedRoutingRule
+	retained  bool
+}
+
+// PublishWithReport publishes the update like Publish, and returns a report
+// describing what the hub did with it: the routing rules applied, whether it
+// is retained, stored by the transport and forwarded to the other nodes of the
+// cluster. The report is returned with the errors wrapping ErrPartialDispatch,
+// the update having been published.
+func (h *Hub) PublishWithReport(ctx context.Context, u *Update) (PublicationReport, error) {
+	return h.publishWithReport(ctx, u, false)
+}
+
+// publishWithReport publishes the update with a report, including a delivery
+// receipt if withReceipt is true.
+func (h *Hub) publishWithReport(ctx context.Context, u *Update, withReceipt bool) (PublicationReport, error) {
+	r := &publicationReport{}
+	u.report = r
+
+	var (
+		receipt DeliveryReceipt
+		err     error
+	)
+
+	if withReceipt {
+		receipt, err = h.PublishWithReceipt(ctx, u)
+	} else {
+		err = h.Publish(ctx, u)
+	}
+
+	if err != nil && !errors.Is(err, ErrPartialDispatch) {
+		return PublicationReport{}, err
+	}
+
+	report := PublicationReport{
+		ID:           u.ID,
+		Topics:       u.topics(),
+		RoutingRules: r.rules,
+		Retained:     r.retained,
+	}
+
+	if withReceipt {
+		report.Delivery = &receipt
+	}
+
+	switch {
+	case r.duplicate:
+		report.Persistence, report.Forwarding = PublicationDuplicate, PublicationNotForwarded
+
+		return report, err
+	case r.dropped:
+		report.Persistence, report.Forwarding = PublicationDropped, PublicationNotForwarded
+
+		return report, err
+	}
+
+	if _, ok := h.transport.(TransportHistoryReader); !ok {
+		report.Persistence = PublicationNotStored
+	} else if errors.Is(err, ErrPartialDispatch) {
+		report.Persistence = PublicationPartiallyStored
+	} else {
+		report.Persistence = PublicationStored
+	}
+
+	report.Forwarding = PublicationForwardedToCluster
+	if errors.Is(err, ErrLocalFallback) || dispatchesSynchronously(h.transport) {
+		report.Forwarding = PublicationLocal
+	}
+
+	return report, err
+}
+
+// prefers reports whether the request has the given preference (RFC 7240).
+func prefers(r *http.Request, preference string) bool {
+	for _, v := range r.Header.Values("Prefer") {
+		for p := range strings.SplitSeq(v, ",") {
+			token, _, _ := strings.Cut(p, ";")
+			if strings.EqualFold(strings.TrimSpace(token), preference) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
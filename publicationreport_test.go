@@ -0,0 +1,103 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPublishWithReport(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t,
+		WithRoutingRules(
+			RoutingRule{Name: "audit", Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/orders/*"}}, Action: RoutingAddTopic, Topic: "https://example.com/audit"},
+			RoutingRule{Name: "spam", Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/spam"}}, Action: RoutingDrop},
+		),
+		WithRetainedValues(RetainedValues{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/orders/*"}}}),
+		WithIdempotentPublishing(0),
+	)
+
+	report, err := hub.PublishWithReport(t.Context(), &Update{Topic: "https://example.com/orders/1", IdempotencyKey: "key"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, report.ID)
+	assert.Equal(t, PublicationReport{
+		ID:           report.ID,
+		Topics:       []string{"https://example.com/orders/1"},
+		RoutingRules: []AppliedRoutingRule{{Name: "audit", Action: RoutingAddTopic, Topic: "https://example.com/audit"}},
+		Retained:     true,
+		Persistence:  PublicationNotStored,
+		Forwarding:   PublicationLocal,
+	}, report)
+
+	duplicate, err := hub.PublishWithReport(t.Context(), &Update{Topic: "https://example.com/orders/1", IdempotencyKey: "key"})
+	require.NoError(t, err)
+	assert.Equal(t, report.ID, duplicate.ID)
+	assert.Equal(t, PublicationDuplicate, duplicate.Persistence)
+	assert.Equal(t, PublicationNotForwarded, duplicate.Forwarding)
+
+	report, err = hub.PublishWithReport(t.Context(), &Update{Topic: "https://example.com/spam"})
+	require.NoError(t, err)
+	assert.Equal(t, []AppliedRoutingRule{{Name: "spam", Action: RoutingDrop}}, report.RoutingRules)
+	assert.False(t, report.Retained)
+	assert.Equal(t, PublicationDropped, report.Persistence)
+	assert.Equal(t, PublicationNotForwarded, report.Forwarding)
+
+	_, err = hub.PublishWithReport(t.Context(), &Update{Topic: "/.well-known/mercure/foo"})
+	require.ErrorIs(t, err, ErrReservedTopic)
+
+	bolt := createDummy(t, WithTransport(createRetentionBoltTransport(t, 0)))
+
+	report, err = bolt.PublishWithReport(t.Context(), &Update{Topic: "https://example.com/orders/1"})
+	require.NoError(t, err)
+	assert.Equal(t, PublicationStored, report.Persistence)
+	assert.Equal(t, PublicationLocal, report.Forwarding)
+	assert.Nil(t, report.Delivery)
+}
+
+func TestPublishHandlerReport(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithDeliveryReceipts())
+	addReceiptSubscribers(t, hub)
+
+	publish := func(prefer string) *http.Response {
+		form := url.Values{"id": {"id"}, "topic": {receiptTopic}, "data": {"Hello!"}}
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+		req.Header.Add("Prefer", prefer)
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w.Result()
+	}
+
+	resp := publish("return=representation")
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Equal(t, "return=representation", resp.Header.Get("Preference-Applied"))
+
+	var report PublicationReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, PublicationReport{ID: "id", Topics: []string{receiptTopic}, Persistence: PublicationNotStored, Forwarding: PublicationLocal}, report)
+
+	resp = publish("receipt, return=representation")
+	t.Cleanup(func() { _ = resp.Body.Close() })
+
+	assert.Equal(t, "receipt, return=representation", resp.Header.Get("Preference-Applied"))
+
+	report = PublicationReport{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+	assert.Equal(t, &DeliveryReceipt{ID: "id", Delivered: 1, Queued: 1, Dropped: 1}, report.Delivery)
+}
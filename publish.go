@@ -2,6 +2,7 @@ package mercure
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -9,6 +10,7 @@ import (
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 	"unicode/utf8"
 
 	"go.opentelemetry.io/otel/trace"
@@ -52,7 +54,8 @@ var (
 // Hub.Publish, MUST call Validate first and reject the update on error.
 // Skipping it lets a CR, LF, or NUL in ID or Type inject arbitrary SSE
 // fields into subscribers' streams (CWE-93). Validate also rejects the
-// reserved "/.well-known/mercure" topic namespace, so it is meant for
+// reserved "/.well-known/mercure" topic namespace, except for private updates
+// to inbox topics (see GuestInboxTopic and UserInboxTopic), so it is meant for
 // publisher input, not hub-internal updates such as subscription events.
 func (u *Update) Validate() error {
 	topics := u.topics()
@@ -68,7 +71,13 @@ func (u *Update) Validate() error {
 		}
 
 		if addressesReservedNamespace(t) {
-			return fmt.Errorf("%q: %w", t, ErrReservedTopic)
+			if !addressesInbox(t) {
+				return fmt.Errorf("%q: %w", t, ErrReservedTopic)
+			}
+
+			if !u.Private {
+				return fmt.Errorf("%q: %w", t, ErrPublicInboxUpdate)
+			}
 		}
 
 		// "*" is the reserved wildcard matcher pattern, so a topic literally
@@ -107,11 +116,28 @@ func (u *Update) Validate() error {
 		return ErrInvalidData
 	}
 
-	return nil
+	if !validProtocolString(u.IdempotencyKey) {
+		return ErrInvalidIdempotencyKey
+	}
+
+	return validateLocalizedData(u.LocalizedData)
 }
 
 // Publish broadcasts the given update to all subscribers.
 // The id field of the Update instance can be updated by the underlying Transport.
+//
+// It is the in-process publishing API: applications embedding the hub call it
+// directly instead of looping back through the publish endpoint. The update
+// goes through the same validation (see Update.Validate), transport dispatch,
+// logging and metrics as an update received over HTTP; authorization is the
+// caller's responsibility.
+//
+// An error wrapping ErrPartialDispatch means that the update was published,
+// but not stored by all the transports.
+//
+// When idempotent publishing is enabled (see WithIdempotentPublishing), an
+// update having the IdempotencyKey of a recent publication isn't dispatched:
+// the ID of the original update is assigned to it instead.
 func (h *Hub) Publish(ctx context.Context, update *Update) error {
 	ctx, span := startSpan(ctx, "mercure.publish", trace.WithSpanKind(trace.SpanKindProducer))
 	// Deferred so the ID assigned by the transport via AssignUUID lands on the span.
@@ -133,25 +159,180 @@ func (h *Hub) Publish(ctx context.Context, update *Update) error {
 		return err
 	}
 
+	if update.IdempotencyKey != "" && h.idempotencyWindow != 0 {
+		return h.publishIdempotently(ctx, span, update)
+	}
+
+	return h.publish(ctx, span, update)
+}
+
+// PublishUpdate is the in-process publishing API: it validates and dispatches
+// the given update exactly like Publish, of which it is an alias.
+func (h *Hub) PublishUpdate(ctx context.Context, update *Update) error {
+	return h.Publish(ctx, update)
+}
+
+// publish publishes a validated update.
+func (h *Hub) publish(ctx context.Context, span trace.Span, update *Update) error {
+	h.enrich(ctx, update)
+
+	routed := h.route(ctx, update)
+	if update.report != nil {
+		update.report.rules, update.report.dropped = routed.applied, routed.dropped
+	}
+
+	if routed.dropped {
+		update.AssignUUID()
+
+		if h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelDebug, "Update dropped by a routing rule")
+		}
+
+		return nil
+	}
+
+	if err := h.checkTopicCardinality(ctx, update); err != nil {
+		recordSpanError(span, err)
+
+		return err
+	}
+
+	if err := h.checkTenantQuotas(ctx, update); err != nil {
+		recordSpanError(span, err)
+
+		return err
+	}
+
 	ctx = context.WithValue(ctx, UpdateContextKey, update)
 
-	if err := h.transport.Dispatch(ctx, update); err != nil {
+	unlock := h.lockTopics(update)
+	if err := h.checkConditions(update); err != nil {
+		unlock()
+
+		if h.logger.Enabled(ctx, slog.LevelInfo) {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, "Rejected conditional update", slog.Any("error", err))
+		}
+
+		recordSpanError(span, err)
+
+		return err
+	}
+
+	h.trackTopics(update)
+	h.diff(update)
+	h.sequence(update)
+
+	err := h.transport.Dispatch(ctx, update)
+	if err == nil || errors.Is(err, ErrPartialDispatch) {
+		h.recordLastEventIDs(update)
+	}
+
+	unlock()
+
+	if err != nil {
 		if h.logger.Enabled(ctx, slog.LevelError) {
 			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to dispatch update", slog.Any("error", err))
 		}
 
+		h.recordDispatchError(err)
 		recordSpanError(span, err)
 
-		return err //nolint:wrapcheck
+		if !errors.Is(err, ErrPartialDispatch) {
+			return err //nolint:wrapcheck
+		}
 	}
 
+	h.retain(update)
 	h.metrics.UpdatePublished(update)
+	h.runPublishHooks(ctx, update)
+	h.escalate(ctx, routed, update)
 
 	if h.logger.Enabled(ctx, slog.LevelDebug) {
 		h.logger.LogAttrs(ctx, slog.LevelDebug, "Update published")
 	}
 
-	return nil
+	for _, c := range routed.copies {
+		h.publishRouted(ctx, c)
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// publishRouted publishes a copy of an update created by a routing rule. The
+// copy is not routed again, and its failures don't affect the publication of
+// the original update. It is subject to the same limits as the original update.
+func (h *Hub) publishRouted(ctx context.Context, u *Update) {
+	if err := u.Validate(); err != nil {
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Invalid update created by a routing rule", slog.String("topic", u.Topic), slog.Any("error", err))
+		}
+
+		return
+	}
+
+	// The rejections are logged by the checks.
+	if h.checkTopicCardinality(ctx, u) != nil || h.checkTenantQuotas(ctx, u) != nil {
+		return
+	}
+
+	ctx = context.WithValue(ctx, UpdateContextKey, u)
+
+	unlock := h.lockTopics(u)
+
+	h.trackTopics(u)
+	h.diff(u)
+	h.sequence(u)
+
+	err := h.transport.Dispatch(ctx, u)
+	if err == nil || errors.Is(err, ErrPartialDispatch) {
+		h.recordLastEventIDs(u)
+	}
+
+	unlock()
+
+	if err != nil {
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to dispatch update created by a routing rule", slog.String("topic", u.Topic), slog.Any("error", err))
+		}
+
+		h.recordDispatchError(err)
+
+		if !errors.Is(err, ErrPartialDispatch) {
+			return
+		}
+	}
+
+	h.retain(u)
+	h.metrics.UpdatePublished(u)
+	h.runPublishHooks(ctx, u)
+}
+
+// canPublish reports whether the claims grant publishing an update on the
+// given topics. A nil claims means the publisher is not authenticated by the
+// hub (no publisher verifier configured).
+func (h *Hub) canPublish(ctx context.Context, claims *claims, topics []string, private bool) bool {
+	if claims == nil || claims.authz.grantsAll(h.topicMatcherStore, actionPublish, topics) {
+		return true
+	}
+
+	if private {
+		return false
+	}
+
+	infoEnabled := h.logger.Enabled(ctx, slog.LevelInfo)
+	if h.isBackwardCompatiblyEnabledWith(7) {
+		if infoEnabled {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, `Deprecated: posting public updates to topics not granted to the token is deprecated since the version 7 of the protocol, grant the "*" topic to allow publishing on all topics.`)
+		}
+
+		return true
+	}
+
+	if infoEnabled {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, `Unsupported: posting public updates to topics not granted to the token is not supported anymore, grant the "*" topic to allow publishing on all topics or enable backward compatibility with the version 7 of the protocol.`)
+	}
+
+	return false
 }
 
 // PublishHandler allows publisher to broadcast updates to all subscribers.
@@ -189,9 +370,18 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if h.redirectToPeer(w, r, nil) {
+		return
+	}
+
 	h.limitRequestBody(w, r)
 
-	if err := r.ParseForm(); err != nil {
+	attachments, err := parsePublishForm(r)
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll() //nolint:errcheck
+	}
+
+	if err != nil {
 		status := http.StatusBadRequest
 
 		var maxBytesErr *http.MaxBytesError
@@ -254,50 +444,116 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	private := len(r.PostForm["private"]) != 0
-	if claims != nil && !claims.authz.grantsAll(h.topicMatcherStore, actionPublish, topics) { //nolint:nestif
-		if private {
-			h.writeBearerError(w, bearerErrInsufficientScope, http.StatusForbidden)
+	stateVersion, err := parseStateVersion(r.PostForm, paramStateVersion)
+	if err != nil {
+		http.Error(w, `Invalid "`+paramStateVersion+`" parameter`, http.StatusBadRequest)
+
+		return
+	}
+
+	var expires time.Time
+
+	if expiresString := r.PostForm.Get("expires"); expiresString != "" {
+		if expires, err = time.Parse(time.RFC3339, expiresString); err != nil {
+			http.Error(w, `Invalid "expires" parameter`, http.StatusBadRequest)
 
 			return
 		}
+	}
 
-		infoEnabled := h.logger.Enabled(ctx, slog.LevelInfo)
-		if h.isBackwardCompatiblyEnabledWith(7) {
-			if infoEnabled {
-				h.logger.LogAttrs(ctx, slog.LevelInfo, `Deprecated: posting public updates to topics not granted to the token is deprecated since the version 7 of the protocol, grant the "*" topic to allow publishing on all topics.`)
-			}
-		} else {
-			if infoEnabled {
-				h.logger.LogAttrs(ctx, slog.LevelInfo, `Unsupported: posting public updates to topics not granted to the token is not supported anymore, grant the "*" topic to allow publishing on all topics or enable backward compatibility with the version 7 of the protocol.`)
+	var priority int
+
+	if priorityString := r.PostForm.Get("priority"); priorityString != "" {
+		if priority, err = strconv.Atoi(priorityString); err != nil {
+			http.Error(w, `Invalid "priority" parameter`, http.StatusBadRequest)
+
+			return
+		}
+	}
+
+	private := len(r.PostForm["private"]) != 0
+
+	if claims, err = h.authorizePublication(ctx, h.httpCaller(r), claims, topics, private); err != nil {
+		h.writeAuthorizationError(w, r, err)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	if err := h.checkPublishRate(ctx, claims, topics); err != nil {
+		writePublishError(w, err)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	data := r.PostForm.Get("data")
+
+	var attachmentKeys []string
+
+	if len(attachments) != 0 {
+		if data, attachmentKeys, err = h.storeAttachments(ctx, data, attachments); err != nil {
+			if errors.Is(err, ErrAttachmentsNotSupported) {
+				http.Error(w, ErrAttachmentsNotSupported.Error(), http.StatusBadRequest)
+			} else {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
 			}
 
-			h.writeBearerError(w, bearerErrInsufficientScope, http.StatusForbidden)
+			recordSpanError(span, err)
 
 			return
 		}
 	}
 
 	u = &Update{
-		Private: private,
-		Debug:   h.debug,
-		Event:   Event{r.PostForm.Get("data"), r.PostForm.Get("id"), r.PostForm.Get("type"), retry},
+		Private:        private,
+		Debug:          h.debug,
+		StateVersion:   stateVersion,
+		Event:          Event{Data: data, ID: r.PostForm.Get("id"), Type: r.PostForm.Get("type"), Retry: retry},
+		LocalizedData:  parseLocalizedData(r.PostForm),
+		CompactionKey:  r.PostForm.Get("compaction-key"),
+		Expires:        expires,
+		Priority:       priority,
+		IfMatch:        parseIfMatch(r),
+		IdempotencyKey: h.idempotencyKey(r, r.PostForm.Get("id")),
+		Publisher:      publisherID(claims),
+		Tenant:         h.tenantName(claims),
 	}
 	u.setTopics(topics)
 
 	dispatchCtx := context.WithoutCancel(ctx)
 
 	// Validation, dispatch, logging and metrics live in Hub.Publish.
-	if err := h.Publish(dispatchCtx, u); err != nil {
-		switch {
-		case errors.Is(err, ErrReservedTopic), errors.Is(err, ErrReservedWildcard),
-			errors.Is(err, ErrInvalidEventID), errors.Is(err, ErrInvalidEventType),
-			errors.Is(err, ErrReservedEventType),
-			errors.Is(err, ErrInvalidTopic), errors.Is(err, ErrTooManyTopics),
-			errors.Is(err, ErrInvalidData):
-			http.Error(w, err.Error(), http.StatusBadRequest)
-		default:
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	var (
+		result  any
+		applied []string
+	)
+
+	wantsReceipt := h.prefersReceipt(r)
+	if wantsReceipt {
+		applied = append(applied, preferReceipt)
+	}
+
+	switch {
+	case prefers(r, preferRepresentation):
+		var report PublicationReport
+
+		report, err = h.publishWithReport(dispatchCtx, u, wantsReceipt)
+		result, applied = &report, append(applied, preferRepresentation)
+	case wantsReceipt:
+		var receipt DeliveryReceipt
+
+		receipt, err = h.PublishWithReceipt(dispatchCtx, u)
+		result = &receipt
+	default:
+		err = h.Publish(dispatchCtx, u)
+	}
+
+	if err != nil && !errors.Is(err, ErrPartialDispatch) {
+		h.deleteAttachments(ctx, attachmentKeys)
+
+		if !h.writeLameDuckError(w, r, err) {
+			writePublishError(w, err)
 		}
 
 		// Mirror the error onto the handler span too; Hub.Publish's child
@@ -309,9 +565,41 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// The body is the update id; the protocol requires this exact media type.
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	// Publishers requesting a receipt or a report get it instead.
+	if result == nil {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Preference-Applied", strings.Join(applied, ", "))
+	}
 
-	if _, err := io.WriteString(w, u.ID); err != nil {
+	// Published, but not stored by all the transports, only dispatched to
+	// the local subscribers, or queued for the next instance of the hub.
+	switch {
+	case err != nil:
+		recordSpanError(span, err)
+
+		if errors.Is(err, ErrLocalFallback) {
+			w.Header().Set(degradedHeader, "local")
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	case h.isLameDuck():
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	body := u.ID
+	if result != nil {
+		j, err := json.Marshal(result)
+		if err != nil {
+			// Can't happen
+			panic(err)
+		}
+
+		body = string(j)
+	}
+
+	if _, err := io.WriteString(w, body); err != nil {
 		if h.logger.Enabled(ctx, slog.LevelInfo) {
 			h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write publish response", slog.Any("error", err))
 		}
@@ -319,3 +607,40 @@ func (h *Hub) PublishHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// writePublishError answers a failed publication: validation errors are the
+// publisher's fault (400) and their message is safe to disclose, a failed
+// If-Match condition is a 412, too many distinct topics, an exceeded tenant
+// quota or publish rate a 429, a closed transport, a rolled back update or a full warm-up
+// queue can be published again later (503), and anything else is a transport
+// failure (500).
+func writePublishError(w http.ResponseWriter, err error) {
+	switch status := publishErrorStatus(err); status {
+	case http.StatusServiceUnavailable, http.StatusInternalServerError:
+		http.Error(w, http.StatusText(status), status)
+	default:
+		http.Error(w, err.Error(), status)
+	}
+}
+
+// publishErrorStatus returns the status code of the answer to a failed
+// publication, see writePublishError.
+func publishErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrReservedTopic), errors.Is(err, ErrReservedWildcard), errors.Is(err, ErrPublicInboxUpdate),
+		errors.Is(err, ErrInvalidEventID), errors.Is(err, ErrInvalidEventType),
+		errors.Is(err, ErrReservedEventType),
+		errors.Is(err, ErrInvalidTopic), errors.Is(err, ErrTooManyTopics),
+		errors.Is(err, ErrInvalidData), errors.Is(err, ErrInvalidIdempotencyKey), errors.Is(err, ErrInvalidLocale), errors.Is(err, ErrTooManyLocalizedVariants),
+		errors.Is(err, ErrConditionalPublishingNotEnabled):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, ErrTopicCardinalityExceeded), errors.Is(err, ErrTenantQuotaExceeded), errors.Is(err, ErrPublishRateExceeded):
+		return http.StatusTooManyRequests
+	case errors.Is(err, ErrClosedTransport), errors.Is(err, ErrDispatchRolledBack), errors.Is(err, ErrWarmUpQueueFull), errors.Is(err, ErrTransportWarmingUp):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
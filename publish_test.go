@@ -10,6 +10,7 @@ import (
 	"strings"
 	"testing"
 	"testing/synctest"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"github.com/stretchr/testify/assert"
@@ -184,6 +185,76 @@ func TestPublishHandlerInvalidRetry(t *testing.T) {
 `, w.Body.String())
 }
 
+func TestPublishHandlerExpires(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	topics := []string{"https://example.com/typing"}
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), nil)
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+
+	publish := func(expires string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Add("topic", "https://example.com/typing")
+		form.Add("expires", expires)
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, topics))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w
+	}
+
+	w := publish("2100-01-02T15:04:05+01:00")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, time.Date(2100, 1, 2, 14, 4, 5, 0, time.UTC).Equal((<-s.Receive()).Expires))
+
+	w = publish("in 5 seconds")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `Invalid "expires" parameter
+`, w.Body.String())
+}
+
+func TestPublishHandlerPriority(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	topics := []string{"https://example.com/alerts"}
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), nil)
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+
+	publish := func(priority string) *httptest.ResponseRecorder {
+		form := url.Values{}
+		form.Add("topic", "https://example.com/alerts")
+		form.Add("priority", priority)
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, topics))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w
+	}
+
+	w := publish("-2")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, -2, (<-s.Receive()).Priority)
+
+	w = publish("high")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `Invalid "priority" parameter
+`, w.Body.String())
+}
+
 func TestPublishHandlerNotAuthorizedTopicMatcher(t *testing.T) {
 	t.Parallel()
 
@@ -408,8 +479,8 @@ func TestPublishHandlerWithErrorInTransport(t *testing.T) {
 
 	body, _ := io.ReadAll(resp.Body)
 
-	assert.Equal(t, http.StatusInternalServerError, resp.StatusCode)
-	assert.Equal(t, "Internal Server Error\n", string(body))
+	assert.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	assert.Equal(t, "Service Unavailable\n", string(body))
 }
 
 func FuzzPublish(f *testing.F) {
@@ -468,6 +539,40 @@ func FuzzPublish(f *testing.F) {
 	})
 }
 
+func FuzzPublishRequest(f *testing.F) {
+	hub := createDummy(f)
+	authorizationHeader := bearerPrefix + createDummyAuthorizedJWT(rolePublisher, []string{"*"})
+
+	for _, tc := range [][2]string{
+		{"application/x-www-form-urlencoded", "topic=https%3A%2F%2Flocalhost%2Ffoo&data=bar&private=on&retry=10"},
+		{"application/x-www-form-urlencoded; charset=utf-8", "topic=a&topic=b&id=%ZZ"},
+		{"application/x-www-form-urlencoded", "topic=https%3A%2F%2Flocalhost%2Ffoo&retry=-1&state_version=18446744073709551616"},
+		{"multipart/form-data; boundary=x", "--x\r\nContent-Disposition: form-data; name=\"topic\"\r\n\r\nhttps://localhost/foo\r\n--x--\r\n"},
+		{"text/plain", "foo"},
+		{"", ""},
+	} {
+		f.Add(tc[0], tc[1])
+	}
+
+	f.Fuzz(func(t *testing.T, contentType, body string) {
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", authorizationHeader)
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		resp := w.Result()
+
+		t.Cleanup(func() {
+			assert.NoError(t, resp.Body.Close())
+		})
+
+		// Malformed requests are the client's fault.
+		assert.Less(t, resp.StatusCode, http.StatusInternalServerError)
+	})
+}
+
 func TestUpdateValidate(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,388 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// publishGroupURL is the endpoint accepting a group of updates to publish
+// atomically.
+const publishGroupURL = defaultHubURL + "/group"
+
+// maxGroupUpdates caps the number of updates in a group: the whole group is
+// validated, persisted and dispatched while holding the transport lock.
+const maxGroupUpdates = 100
+
+var (
+	// ErrGroupNotSupported is returned by PublishGroup when the transport does
+	// not implement TransportGroupDispatcher.
+	ErrGroupNotSupported = errors.New("the transport does not support publishing groups of updates")
+	// ErrTooManyGroupUpdates is returned by PublishGroup when the group exceeds
+	// the maximum number of updates.
+	ErrTooManyGroupUpdates = fmt.Errorf("too many updates in group (max %d)", maxGroupUpdates)
+)
+
+// groupedUpdate is the JSON representation of an update in a group, using the
+// names of the publish form fields.
+type groupedUpdate struct {
+	Topic   string `json:"topic"`
+	Data    string `json:"data"`
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Retry   uint64 `json:"retry"`
+	Private bool   `json:"private"`
+	// StateVersion uses the name of the publish form field.
+	StateVersion uint64 `json:"state-version"`
+	// LocalizedData holds the data[<locale>] publish form fields.
+	LocalizedData map[string]string `json:"localized-data"`
+	// CompactionKey uses the name of the publish form field.
+	CompactionKey string `json:"compaction-key"`
+	// Expires uses the name of the publish form field.
+	Expires time.Time `json:"expires"`
+	// Priority uses the name of the publish form field.
+	Priority int `json:"priority"`
+	// IfMatch is the event ID the If-Match header holds for single
+	// publications.
+	IfMatch string `json:"if-match"`
+}
+
+// PublishGroup broadcasts a group of updates atomically: either all of them are
+// persisted and dispatched, in order and without any other update interleaved,
+// or none is. Subscribers never observe a partial group.
+//
+// Every update is validated (see Update.Validate) before anything is
+// dispatched. The transport must implement TransportGroupDispatcher, otherwise
+// ErrGroupNotSupported is returned. As with Publish, an error wrapping
+// ErrPartialDispatch means that the updates were published.
+func (h *Hub) PublishGroup(ctx context.Context, updates []*Update) error {
+	ctx, span := startSpan(ctx, "mercure.publish.group", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	if span.IsRecording() {
+		span.SetAttributes(attribute.Int("mercure.group.size", len(updates)))
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+
+	if len(updates) > maxGroupUpdates {
+		recordSpanError(span, ErrTooManyGroupUpdates)
+
+		return ErrTooManyGroupUpdates
+	}
+
+	gd, ok := h.transport.(TransportGroupDispatcher)
+	if !ok {
+		recordSpanError(span, ErrGroupNotSupported)
+
+		return ErrGroupNotSupported
+	}
+
+	for i, u := range updates {
+		if err := u.Validate(); err != nil {
+			err = fmt.Errorf("update %d: %w", i, err)
+
+			if h.logger.Enabled(ctx, slog.LevelInfo) {
+				h.logger.LogAttrs(ctx, slog.LevelInfo, "Rejected invalid group of updates", slog.Any("error", err))
+			}
+
+			recordSpanError(span, err)
+
+			return err
+		}
+	}
+
+	h.enrichGroup(ctx, updates)
+
+	updates, routed := h.routeGroup(ctx, updates)
+	if len(updates) == 0 {
+		return nil
+	}
+
+	if err := h.checkTopicCardinality(ctx, updates...); err != nil {
+		recordSpanError(span, err)
+
+		return err
+	}
+
+	if err := h.checkTenantQuotas(ctx, updates...); err != nil {
+		recordSpanError(span, err)
+
+		return err
+	}
+
+	unlock := h.lockTopics(updates...)
+	if err := h.checkConditions(updates...); err != nil {
+		unlock()
+
+		if h.logger.Enabled(ctx, slog.LevelInfo) {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, "Rejected conditional group of updates", slog.Any("error", err))
+		}
+
+		recordSpanError(span, err)
+
+		return err
+	}
+
+	h.trackTopics(updates...)
+	h.diff(updates...)
+	h.sequence(updates...)
+
+	err := gd.DispatchGroup(ctx, updates)
+	if err == nil || errors.Is(err, ErrPartialDispatch) {
+		h.recordLastEventIDs(updates...)
+	}
+
+	unlock()
+
+	if err != nil {
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to dispatch group of updates", slog.Any("error", err))
+		}
+
+		h.recordDispatchError(err)
+		recordSpanError(span, err)
+
+		if !errors.Is(err, ErrPartialDispatch) {
+			return err //nolint:wrapcheck
+		}
+	}
+
+	h.retain(updates...)
+
+	for _, u := range updates {
+		h.metrics.UpdatePublished(u)
+	}
+
+	h.runPublishHooks(ctx, updates...)
+
+	for i, r := range routed {
+		h.escalate(ctx, r, updates[i])
+	}
+
+	if h.logger.Enabled(ctx, slog.LevelDebug) {
+		h.logger.LogAttrs(ctx, slog.LevelDebug, "Group of updates published", slog.Int("size", len(updates)))
+	}
+
+	return err //nolint:wrapcheck
+}
+
+// routeGroup applies the routing rules to the updates of a group. It returns
+// the updates to dispatch atomically: the updates not dropped, followed by the
+// copies the rules created, and the outcome of the routing of the former.
+func (h *Hub) routeGroup(ctx context.Context, updates []*Update) ([]*Update, []routedUpdate) {
+	if len(h.compiledRoutingRules) == 0 {
+		return updates, nil
+	}
+
+	var (
+		kept   = make([]*Update, 0, len(updates))
+		routed = make([]routedUpdate, 0, len(updates))
+		copies []*Update
+	)
+
+	for _, u := range updates {
+		r := h.route(ctx, u)
+		if r.dropped {
+			// The ID is still part of the response.
+			u.AssignUUID()
+
+			continue
+		}
+
+		kept = append(kept, u)
+		routed = append(routed, r)
+
+		for _, c := range r.copies {
+			if err := c.Validate(); err != nil {
+				if h.logger.Enabled(ctx, slog.LevelError) {
+					h.logger.LogAttrs(ctx, slog.LevelError, "Invalid update created by a routing rule", slog.String("topic", c.Topic), slog.Any("error", err))
+				}
+
+				continue
+			}
+
+			copies = append(copies, c)
+		}
+	}
+
+	return append(kept, copies...), routed
+}
+
+// PublishGroupHandler allows publishers to broadcast a group of updates
+// atomically. The request body is a JSON array of objects having the members
+// "topic", "data", "id", "type", "retry", "private", "state-version",
+// "localized-data", "compaction-key", "expires" and "priority", with the
+// semantics of the publish form fields. The response body contains the IDs of
+// the updates, one per line, in order.
+//
+// The token must grant publishing every update of the group, otherwise nothing
+// is published.
+//
+//nolint:funlen
+func (h *Hub) PublishGroupHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "mercure.publish.group", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	r = r.WithContext(ctx)
+
+	var claims *claims
+
+	if h.publisherConfigured {
+		var err error
+
+		claims, err = h.authorize(r, true)
+		if err != nil || claims == nil {
+			h.writeAuthError(w, r, err)
+
+			if err != nil {
+				recordSpanError(span, err)
+			}
+
+			return
+		}
+	}
+
+	if h.redirectToPeer(w, r, nil) {
+		return
+	}
+
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt != "application/json" {
+		http.Error(w, `The request body must be of type "application/json"`, http.StatusUnsupportedMediaType)
+
+		return
+	}
+
+	h.limitRequestBody(w, r)
+
+	var grouped []groupedUpdate
+	if err := json.NewDecoder(r.Body).Decode(&grouped); err != nil {
+		status := http.StatusBadRequest
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, http.StatusText(status), status)
+
+		return
+	}
+
+	if len(grouped) == 0 {
+		http.Error(w, "The group must contain at least one update", http.StatusBadRequest)
+
+		return
+	}
+
+	if len(grouped) > maxGroupUpdates {
+		http.Error(w, ErrTooManyGroupUpdates.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	updates := make([]*Update, len(grouped))
+	caller := h.httpCaller(r)
+
+	for i, g := range grouped {
+		if g.Topic == "" {
+			http.Error(w, fmt.Sprintf(`update %d: missing "topic" member`, i), http.StatusBadRequest)
+
+			return
+		}
+
+		// Validate the topic before it reaches the shared match cache through
+		// the grant check, as PublishHandler does.
+		if !validProtocolString(g.Topic) {
+			http.Error(w, fmt.Errorf("update %d: %q: %w", i, g.Topic, ErrInvalidTopic).Error(), http.StatusBadRequest)
+
+			return
+		}
+
+		if _, err := h.authorizePublication(ctx, caller, claims, []string{g.Topic}, g.Private); err != nil {
+			h.writeAuthorizationError(w, r, err)
+			recordSpanError(span, err)
+
+			return
+		}
+
+		updates[i] = &Update{
+			Topic:         g.Topic,
+			Private:       g.Private,
+			Debug:         h.debug,
+			StateVersion:  g.StateVersion,
+			Event:         Event{Data: g.Data, ID: g.ID, Type: g.Type, Retry: g.Retry},
+			LocalizedData: g.LocalizedData,
+			CompactionKey: g.CompactionKey,
+			Expires:       g.Expires,
+			Priority:      g.Priority,
+			IfMatch:       g.IfMatch,
+			Publisher:     publisherID(claims),
+			Tenant:        h.tenantName(claims),
+		}
+	}
+
+	topics := make([][]string, len(updates))
+	for i, u := range updates {
+		topics[i] = []string{u.Topic}
+	}
+
+	// The rates are checked for all the updates at once: none of them is
+	// published when one would exceed them.
+	if err := h.checkPublishRate(ctx, claims, topics...); err != nil {
+		writePublishError(w, err)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	err := h.PublishGroup(context.WithoutCancel(ctx), updates)
+	if err != nil && !errors.Is(err, ErrPartialDispatch) {
+		if !h.writeLameDuckError(w, r, err) {
+			writePublishError(w, err)
+		}
+		recordSpanError(span, err)
+
+		return
+	}
+
+	ids := make([]string, len(updates))
+	for i, u := range updates {
+		ids[i] = u.ID
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	// Published, but not stored by all the transports, only dispatched to
+	// the local subscribers, or queued for the next instance of the hub.
+	switch {
+	case err != nil:
+		recordSpanError(span, err)
+
+		if errors.Is(err, ErrLocalFallback) {
+			w.Header().Set(degradedHeader, "local")
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	case h.isLameDuck():
+		w.WriteHeader(http.StatusAccepted)
+	}
+
+	if _, err := io.WriteString(w, strings.Join(ids, "\n")); err != nil {
+		if h.logger.Enabled(ctx, slog.LevelInfo) {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write publish response", slog.Any("error", err))
+		}
+	}
+}
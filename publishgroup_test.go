@@ -0,0 +1,126 @@
+package mercure
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func publishGroupRequest(t *testing.T, hub *Hub, token, body string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, publishGroupURL, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", bearerPrefix+token)
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	resp := w.Result()
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+
+	return resp
+}
+
+func TestPublishGroupHandlerOK(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	topics := []string{"https://example.com/books/1", "https://example.com/authors/1"}
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), stringsToExactMatchers(topics))
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+
+	resp := publishGroupRequest(t, hub, createDummyAuthorizedJWT(rolePublisher, []string{"*"}), `[
+		{"topic": "https://example.com/books/1", "data": "book", "id": "b1"},
+		{"topic": "https://example.com/authors/1", "data": "author", "id": "a1", "private": true}
+	]`)
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/plain; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	u := <-s.Receive()
+	assert.Equal(t, "b1", u.ID)
+	assert.Equal(t, "book", u.Data)
+
+	u = <-s.Receive()
+	assert.Equal(t, "a1", u.ID)
+	assert.True(t, u.Private)
+}
+
+func TestPublishGroupHandlerAllOrNothing(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	topics := []string{"https://example.com/books/1"}
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), nil)
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+
+	// The second topic is not granted: the first update must not be published.
+	resp := publishGroupRequest(t, hub, createDummyAuthorizedJWT(rolePublisher, topics), `[
+		{"topic": "https://example.com/books/1", "data": "book"},
+		{"topic": "https://example.com/authors/1", "data": "author"}
+	]`)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	// The second update is invalid: the first one must not be published.
+	resp = publishGroupRequest(t, hub, createDummyAuthorizedJWT(rolePublisher, []string{"*"}), `[
+		{"topic": "https://example.com/books/1", "data": "book"},
+		{"topic": "https://example.com/books/1", "data": "book", "type": "mercure"}
+	]`)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	require.NoError(t, hub.Stop(t.Context()))
+
+	_, ok := <-s.Receive()
+	assert.False(t, ok)
+}
+
+func TestPublishGroupHandlerBadRequests(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+	token := createDummyAuthorizedJWT(rolePublisher, []string{"*"})
+
+	for name, body := range map[string]string{
+		"malformed": `{`,
+		"empty":     `[]`,
+		"no topic":  `[{"data": "foo"}]`,
+		"too many":  "[" + strings.Repeat(`{"topic": "foo"},`, maxGroupUpdates) + `{"topic": "foo"}]`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, http.StatusBadRequest, publishGroupRequest(t, hub, token, body).StatusCode)
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, publishGroupURL, strings.NewReader(`[]`))
+	req.Header.Set("Authorization", bearerPrefix+token)
+
+	w := httptest.NewRecorder()
+	hub.PublishGroupHandler(w, req)
+	assert.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+}
+
+func TestPublishGroupNotSupported(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTransport(&addSubscriberErrorTransport{}))
+
+	err := hub.PublishGroup(t.Context(), []*Update{{Topic: "https://example.com/books/1"}})
+	require.ErrorIs(t, err, ErrGroupNotSupported)
+
+	resp := publishGroupRequest(t, hub, createDummyAuthorizedJWT(rolePublisher, []string{"*"}), `[{"topic": "foo"}]`)
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+}
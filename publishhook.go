@@ -0,0 +1,321 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultPublishHookTimeout bounds the delivery of an update to an HTTP
+	// publish hook.
+	defaultPublishHookTimeout = 10 * time.Second
+	// publishHookQueueSize is the number of updates waiting for delivery
+	// after which a publish hook drops the new ones.
+	publishHookQueueSize = 1024
+)
+
+var (
+	// ErrInvalidPublishHook is returned by NewHub when a publish hook is not
+	// valid.
+	ErrInvalidPublishHook = errors.New("invalid publish hook")
+	// errPublishHookStatus is returned by the HTTP-based publish hook targets
+	// when the endpoint answers with a non-2xx status code.
+	errPublishHookStatus = errors.New("unexpected publish hook status")
+)
+
+// PublishHookTarget is an external system receiving copies of the published
+// updates.
+type PublishHookTarget interface {
+	// Send delivers the update. It is called from the goroutine of the hook,
+	// one update at a time, in publication order.
+	Send(ctx context.Context, u *Update) error
+}
+
+// PublishHook sends a copy of the updates published on some topics to an
+// external system, in addition to their delivery to subscribers. Updates are
+// sent asynchronously, and never delay nor fail the publication: failed
+// deliveries are logged, and the updates published while the queue of the
+// hook is full are dropped.
+type PublishHook struct {
+	// Matchers restricts the hook to the updates having a topic one of these
+	// matchers match. The hook receives all the updates when empty.
+	Matchers []TopicMatcher
+	// Private also sends the private updates. They are not sent by default,
+	// as the external system doesn't enforce their authorization.
+	Private bool
+	// Target receives the updates.
+	Target PublishHookTarget
+}
+
+// matches reports whether the update must be sent to the hook.
+func (ph PublishHook) matches(tms *TopicMatcherStore, u *Update) bool {
+	if u.Private && !ph.Private {
+		return false
+	}
+
+	if len(ph.Matchers) == 0 {
+		return true
+	}
+
+	topics := u.topics()
+	for _, m := range ph.Matchers {
+		if tms.matches(topics, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// WithPublishHooks sets hooks sending copies of the published updates to
+// external systems, effectively making the hub a router.
+func WithPublishHooks(hooks ...PublishHook) Option {
+	return func(o *opt) error {
+		o.publishHooks = hooks
+
+		return nil
+	}
+}
+
+// validatePublishHooks checks the hooks once the topic matcher store is
+// configured.
+func (o *opt) validatePublishHooks() error {
+	for i, ph := range o.publishHooks {
+		if ph.Target == nil {
+			return fmt.Errorf("%w %d: missing target", ErrInvalidPublishHook, i)
+		}
+
+		for _, m := range ph.Matchers {
+			if err := validateProtocolMatcher(o.topicMatcherStore, m); err != nil {
+				return fmt.Errorf("%w %d: %q: %w", ErrInvalidPublishHook, i, m.Pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// publishHookWorker delivers the updates queued for a hook.
+type publishHookWorker struct {
+	PublishHook
+
+	queue chan *Update
+}
+
+// startPublishHooks starts the workers of the hooks, stopped when ctx is done.
+// The targets implementing io.Closer are then closed.
+func startPublishHooks(ctx context.Context, logger *slog.Logger, hooks []PublishHook) []*publishHookWorker {
+	workers := make([]*publishHookWorker, 0, len(hooks))
+
+	for _, ph := range hooks {
+		w := &publishHookWorker{PublishHook: ph, queue: make(chan *Update, publishHookQueueSize)}
+		workers = append(workers, w)
+
+		go w.run(ctx, logger)
+	}
+
+	return workers
+}
+
+func (w *publishHookWorker) run(ctx context.Context, logger *slog.Logger) {
+	for {
+		select {
+		case <-ctx.Done():
+			if c, ok := w.Target.(io.Closer); ok {
+				_ = c.Close()
+			}
+
+			return
+		case u := <-w.queue:
+			if err := w.Target.Send(ctx, u); err != nil && logger.Enabled(ctx, slog.LevelError) {
+				logger.LogAttrs(ctx, slog.LevelError, "Failed to send update to publish hook", slog.String("id", u.ID), slog.Any("error", err))
+			}
+		}
+	}
+}
+
+// runPublishHooks queues the published updates for the hooks they match.
+func (h *Hub) runPublishHooks(ctx context.Context, updates ...*Update) {
+	for _, w := range h.publishHookWorkers {
+		for _, u := range updates {
+			if !w.matches(h.topicMatcherStore, u) {
+				continue
+			}
+
+			// The transport may still reference the update.
+			c := *u
+
+			select {
+			case w.queue <- &c:
+			default:
+				if h.logger.Enabled(ctx, slog.LevelWarn) {
+					h.logger.LogAttrs(ctx, slog.LevelWarn, "Publish hook queue full, update dropped", slog.String("id", u.ID))
+				}
+			}
+		}
+	}
+}
+
+// publishHookJSON is the document the publish hook targets send.
+type publishHookJSON struct {
+	ID           string `json:"id"`
+	Topic        string `json:"topic"`
+	Type         string `json:"type,omitempty"`
+	Data         string `json:"data"`
+	Private      bool   `json:"private,omitempty"`
+	Retry        uint64 `json:"retry,omitempty"`
+	StateVersion uint64 `json:"state_version,omitempty"`
+	// LocalizedData holds the localized variants of Data.
+	LocalizedData map[string]string `json:"localized_data,omitempty"`
+	CompactionKey string            `json:"compaction_key,omitempty"`
+	Expires       time.Time         `json:"expires,omitzero"`
+	Priority      int               `json:"priority,omitempty"`
+}
+
+func marshalPublishHookUpdate(u *Update) ([]byte, error) {
+	b, err := json.Marshal(publishHookJSON{u.ID, u.Topic, u.Type, u.Data, u.Private, u.Retry, u.StateVersion, u.LocalizedData, u.CompactionKey, u.Expires, u.Priority})
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal update: %w", err)
+	}
+
+	return b, nil
+}
+
+// HTTPPublishHookTarget POSTs the updates as JSON documents to a URL.
+type HTTPPublishHookTarget struct {
+	url    string
+	header http.Header
+	client *http.Client
+}
+
+// NewHTTPPublishHookTarget creates a PublishHookTarget POSTing updates to url,
+// with the given additional headers (typically an Authorization header). A nil
+// client uses a client with a 10 seconds timeout.
+func NewHTTPPublishHookTarget(url string, header http.Header, client *http.Client) *HTTPPublishHookTarget {
+	if client == nil {
+		client = &http.Client{Timeout: defaultPublishHookTimeout}
+	}
+
+	return &HTTPPublishHookTarget{url: url, header: header, client: client}
+}
+
+// Send POSTs the update to the URL.
+func (t *HTTPPublishHookTarget) Send(ctx context.Context, u *Update) error {
+	body, err := marshalPublishHookUpdate(u)
+	if err != nil {
+		return err
+	}
+
+	return postPublishHook(ctx, t.client, t.url, "application/json", t.header, body)
+}
+
+// KafkaPublishHookTarget produces the updates to a Kafka topic through a
+// Kafka REST Proxy (API v2). The records are keyed by the topic of the
+// update, so the updates of a topic keep their order.
+type KafkaPublishHookTarget struct {
+	url    string
+	header http.Header
+	client *http.Client
+}
+
+// kafkaRecordsJSON is the body of a Kafka REST Proxy produce request.
+type kafkaRecordsJSON struct {
+	Records []kafkaRecordJSON `json:"records"`
+}
+
+type kafkaRecordJSON struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+// NewKafkaPublishHookTarget creates a PublishHookTarget producing updates to
+// the Kafka topic through the Kafka REST Proxy at proxyURL, with the given
+// additional headers. A nil client uses a client with a 10 seconds timeout.
+func NewKafkaPublishHookTarget(proxyURL, topic string, header http.Header, client *http.Client) (*KafkaPublishHookTarget, error) {
+	if topic == "" {
+		return nil, fmt.Errorf("%w: missing Kafka topic", ErrInvalidPublishHook)
+	}
+
+	u, err := url.JoinPath(proxyURL, "topics", topic)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublishHook, err)
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: defaultPublishHookTimeout}
+	}
+
+	return &KafkaPublishHookTarget{url: u, header: header, client: client}, nil
+}
+
+// Send produces the update to the Kafka topic.
+func (t *KafkaPublishHookTarget) Send(ctx context.Context, u *Update) error {
+	value, err := marshalPublishHookUpdate(u)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(kafkaRecordsJSON{[]kafkaRecordJSON{{u.Topic, value}}})
+	if err != nil {
+		return fmt.Errorf("unable to marshal Kafka records: %w", err)
+	}
+
+	return postPublishHook(ctx, t.client, t.url, "application/vnd.kafka.json.v2+json", t.header, body)
+}
+
+func postPublishHook(ctx context.Context, client *http.Client, url, contentType string, header http.Header, body []byte) error {
+	req, err := newPublishHookRequest(ctx, url, contentType, header, body)
+	if err != nil {
+		return err
+	}
+
+	return doPublishHookRequest(client, req)
+}
+
+func newPublishHookRequest(ctx context.Context, url, contentType string, header http.Header, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("unable to create publish hook request: %w", err)
+	}
+
+	for k, v := range header {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+
+	req.Header.Set("Content-Type", contentType)
+
+	return req, nil
+}
+
+func doPublishHookRequest(client *http.Client, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to call publish hook: %w", err)
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%w: %d", errPublishHookStatus, resp.StatusCode)
+	}
+
+	return nil
+}
+
+var (
+	_ PublishHookTarget = (*HTTPPublishHookTarget)(nil)
+	_ PublishHookTarget = (*KafkaPublishHookTarget)(nil)
+	_ PublishHookTarget = (*NATSPublishHookTarget)(nil)
+	_ PublishHookTarget = (*LambdaPublishHookTarget)(nil)
+	_ PublishHookTarget = (*SNSPublishHookTarget)(nil)
+	_ PublishHookTarget = (*PubSubPublishHookTarget)(nil)
+	_ PublishHookTarget = (*FederationPublishHookTarget)(nil)
+)
@@ -0,0 +1,196 @@
+package mercure
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chanPublishHookTarget chan *Update
+
+func (c chanPublishHookTarget) Send(_ context.Context, u *Update) error {
+	c <- u
+
+	return nil
+}
+
+func TestPublishHooks(t *testing.T) {
+	t.Parallel()
+
+	all := make(chanPublishHookTarget, 10)
+	books := make(chanPublishHookTarget, 10)
+	hub := createDummy(t, WithPublishHooks(
+		PublishHook{Target: all, Private: true},
+		PublishHook{Target: books, Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/*"}}},
+	))
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "a"}}))
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/authors/1", Event: Event{ID: "b"}}))
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/2", Private: true, Event: Event{ID: "c"}}))
+
+	for _, id := range []string{"a", "b", "c"} {
+		assert.Equal(t, id, (<-all).ID)
+	}
+
+	assert.Equal(t, "a", (<-books).ID)
+	assert.Empty(t, books)
+}
+
+func TestWithPublishHooksInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, ph := range []PublishHook{
+		{},
+		{Target: make(chanPublishHookTarget), Matchers: []TopicMatcher{{Type: "foo", Pattern: "bar"}}},
+	} {
+		_, err := NewHub(t.Context(), WithPublishHooks(ph))
+		assert.ErrorIs(t, err, ErrInvalidPublishHook)
+	}
+}
+
+func TestHTTPPublishHookTarget(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer foo", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	target := NewHTTPPublishHookTarget(srv.URL, http.Header{"Authorization": {"Bearer foo"}}, nil)
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "a", Data: "bar"}}))
+
+	assert.Equal(t, map[string]any{"id": "a", "topic": "https://example.com/books/1", "data": "bar"}, <-received)
+}
+
+func TestHTTPPublishHookTargetError(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	require.ErrorIs(t, NewHTTPPublishHookTarget(srv.URL, nil, nil).Send(t.Context(), &Update{}), errPublishHookStatus)
+}
+
+func TestKafkaPublishHookTarget(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan kafkaRecordsJSON, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/topics/updates", r.URL.Path)
+		assert.Equal(t, "application/vnd.kafka.json.v2+json", r.Header.Get("Content-Type"))
+
+		var body kafkaRecordsJSON
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+	}))
+	defer srv.Close()
+
+	_, err := NewKafkaPublishHookTarget(srv.URL, "", nil, nil)
+	require.ErrorIs(t, err, ErrInvalidPublishHook)
+
+	target, err := NewKafkaPublishHookTarget(srv.URL, "updates", nil, nil)
+	require.NoError(t, err)
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "a", Data: "bar"}}))
+
+	records := (<-received).Records
+	require.Len(t, records, 1)
+	assert.Equal(t, "https://example.com/books/1", records[0].Key)
+	assert.JSONEq(t, `{"id":"a","topic":"https://example.com/books/1","data":"bar"}`, string(records[0].Value))
+}
+
+// fakeNATSServer accepts a NATS connection, and sends the published messages
+// to the returned channel.
+func fakeNATSServer(t *testing.T, info string) (string, <-chan string) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	published := make(chan string, 10)
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, _ = conn.Write([]byte("INFO " + info + "\r\n"))
+
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			switch {
+			case strings.HasPrefix(line, "CONNECT "):
+				published <- strings.TrimSpace(line)
+			case line == "PING\r\n":
+				_, _ = conn.Write([]byte("PONG\r\n"))
+			case strings.HasPrefix(line, "PUB "):
+				payload, _ := r.ReadString('\n')
+				published <- strings.TrimSpace(line) + " " + strings.TrimSpace(payload)
+			}
+		}
+	}()
+
+	return "nats://" + l.Addr().String(), published
+}
+
+func TestNATSPublishHookTarget(t *testing.T) {
+	t.Parallel()
+
+	addr, published := fakeNATSServer(t, `{"server_id":"test"}`)
+
+	target, err := NewNATSPublishHookTarget(strings.Replace(addr, "nats://", "nats://user:pass@", 1), "mercure.updates")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = target.Close() })
+
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "a", Data: "bar"}}))
+
+	assert.Equal(t, `CONNECT {"verbose":false,"pedantic":false,"name":"mercure","lang":"go","user":"user","pass":"pass"}`, <-published)
+
+	payload := `{"id":"a","topic":"https://example.com/books/1","data":"bar"}`
+	assert.Equal(t, fmt.Sprintf("PUB mercure.updates %d %s", len(payload), payload), <-published)
+}
+
+func TestNATSPublishHookTargetErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, args := range [][2]string{
+		{"http://localhost", "foo"},
+		{"nats://localhost", ""},
+		{"nats://localhost", "foo bar"},
+	} {
+		_, err := NewNATSPublishHookTarget(args[0], args[1])
+		assert.ErrorIs(t, err, ErrInvalidPublishHook)
+	}
+
+	addr, _ := fakeNATSServer(t, `{"tls_required":true}`)
+
+	target, err := NewNATSPublishHookTarget(addr, "foo")
+	require.NoError(t, err)
+	require.ErrorIs(t, target.Send(t.Context(), &Update{}), errNATSTLSRequired)
+}
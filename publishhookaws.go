@@ -0,0 +1,284 @@
+package mercure
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// AWSPublishHookConfig configures the access to AWS of the Lambda and SNS
+// publish hook targets.
+type AWSPublishHookConfig struct {
+	// Region of the service. When empty, the region of the ARN of the function
+	// or of the topic is used.
+	Region string
+	// AccessKeyID, SecretAccessKey and the optional SessionToken are the
+	// credentials signing the requests.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Endpoint overrides the URL of the service, for instance to use
+	// LocalStack.
+	Endpoint string
+	// Client sends the requests. A nil client uses a client with a 10 seconds
+	// timeout.
+	Client *http.Client
+}
+
+// resolve returns the endpoint of the service, and the signer of the
+// requests.
+func (c AWSPublishHookConfig) resolve(service, arn string) (string, *awsSigner, error) {
+	region := c.Region
+	if region == "" {
+		// arn:partition:service:region:account-id:resource
+		if parts := strings.SplitN(arn, ":", 6); len(parts) == 6 && parts[0] == "arn" {
+			region = parts[3]
+		}
+	}
+
+	if region == "" {
+		return "", nil, fmt.Errorf("%w: missing AWS region", ErrInvalidPublishHook)
+	}
+
+	if c.AccessKeyID == "" || c.SecretAccessKey == "" {
+		return "", nil, fmt.Errorf("%w: missing AWS credentials", ErrInvalidPublishHook)
+	}
+
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://" + service + "." + region + ".amazonaws.com"
+	}
+
+	return strings.TrimSuffix(endpoint, "/"), &awsSigner{
+		accessKeyID:     c.AccessKeyID,
+		secretAccessKey: c.SecretAccessKey,
+		sessionToken:    c.SessionToken,
+		region:          region,
+		service:         service,
+	}, nil
+}
+
+func (c AWSPublishHookConfig) client() *http.Client {
+	if c.Client == nil {
+		return &http.Client{Timeout: defaultPublishHookTimeout}
+	}
+
+	return c.Client
+}
+
+// LambdaPublishHookTarget invokes an AWS Lambda function with the updates.
+// The invocations are asynchronous: Lambda queues the updates, and retries
+// the failed invocations of the function.
+type LambdaPublishHookTarget struct {
+	url    string
+	signer *awsSigner
+	client *http.Client
+}
+
+// NewLambdaPublishHookTarget creates a PublishHookTarget invoking the function
+// (name, ARN or partial ARN) with the updates as JSON documents.
+func NewLambdaPublishHookTarget(function string, c AWSPublishHookConfig) (*LambdaPublishHookTarget, error) {
+	if function == "" {
+		return nil, fmt.Errorf("%w: missing Lambda function", ErrInvalidPublishHook)
+	}
+
+	endpoint, signer, err := c.resolve("lambda", function)
+	if err != nil {
+		return nil, err
+	}
+
+	return &LambdaPublishHookTarget{
+		url:    endpoint + "/2015-03-31/functions/" + awsURIEncode(function) + "/invocations",
+		signer: signer,
+		client: c.client(),
+	}, nil
+}
+
+// Send invokes the function with the update.
+func (t *LambdaPublishHookTarget) Send(ctx context.Context, u *Update) error {
+	body, err := marshalPublishHookUpdate(u)
+	if err != nil {
+		return err
+	}
+
+	req, err := newPublishHookRequest(ctx, t.url, "application/json", http.Header{"X-Amz-Invocation-Type": {"Event"}}, body)
+	if err != nil {
+		return err
+	}
+
+	t.signer.sign(req, body, time.Now())
+
+	return doPublishHookRequest(t.client, req)
+}
+
+// SNSPublishHookTarget publishes the updates to an Amazon SNS topic, to fan
+// them out to Lambda functions, SQS queues or HTTP endpoints. The topic of
+// the update is set as the "topic" message attribute, so subscriptions can
+// filter on it. On FIFO topics, the topic of the update is the message group,
+// so the updates of a topic keep their order.
+type SNSPublishHookTarget struct {
+	url      string
+	topicARN string
+	fifo     bool
+	signer   *awsSigner
+	client   *http.Client
+}
+
+// NewSNSPublishHookTarget creates a PublishHookTarget publishing the updates
+// as JSON documents to the SNS topic.
+func NewSNSPublishHookTarget(topicARN string, c AWSPublishHookConfig) (*SNSPublishHookTarget, error) {
+	if !strings.HasPrefix(topicARN, "arn:") {
+		return nil, fmt.Errorf("%w: %q is not an SNS topic ARN", ErrInvalidPublishHook, topicARN)
+	}
+
+	endpoint, signer, err := c.resolve("sns", topicARN)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SNSPublishHookTarget{
+		url:      endpoint + "/",
+		topicARN: topicARN,
+		fifo:     strings.HasSuffix(topicARN, ".fifo"),
+		signer:   signer,
+		client:   c.client(),
+	}, nil
+}
+
+// Send publishes the update to the SNS topic.
+func (t *SNSPublishHookTarget) Send(ctx context.Context, u *Update) error {
+	message, err := marshalPublishHookUpdate(u)
+	if err != nil {
+		return err
+	}
+
+	form := url.Values{
+		"Action":                         {"Publish"},
+		"Version":                        {"2010-03-31"},
+		"TopicArn":                       {t.topicARN},
+		"Message":                        {string(message)},
+		"MessageAttributes.entry.1.Name": {"topic"},
+		"MessageAttributes.entry.1.Value.DataType":    {"String"},
+		"MessageAttributes.entry.1.Value.StringValue": {u.Topic},
+	}
+	if t.fifo {
+		form.Set("MessageGroupId", u.Topic)
+		form.Set("MessageDeduplicationId", u.ID)
+	}
+
+	body := []byte(form.Encode())
+
+	req, err := newPublishHookRequest(ctx, t.url, "application/x-www-form-urlencoded", nil, body)
+	if err != nil {
+		return err
+	}
+
+	t.signer.sign(req, body, time.Now())
+
+	return doPublishHookRequest(t.client, req)
+}
+
+// awsSigner signs requests with AWS Signature Version 4.
+type awsSigner struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	region          string
+	service         string
+}
+
+// sign adds the authentication headers to the request, whose headers must
+// all be set.
+func (s *awsSigner) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.Join(v, ",")
+	}
+
+	names := slices.Sorted(maps.Keys(headers))
+
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + strings.TrimSpace(headers[k]) + "\n")
+	}
+
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+
+	// The escaped path is encoded again, as for all the services but S3.
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsURIEncode(path),
+		strings.ReplaceAll(req.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := date + "/" + s.region + "/" + s.service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := []byte("AWS4" + s.secretAccessKey)
+	for _, v := range []string{date, s.region, s.service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+
+		", Signature="+hex.EncodeToString(hmacSHA256(key, stringToSign)))
+}
+
+// awsURIEncode percent-encodes all the characters but the unreserved ones and
+// the slashes.
+func awsURIEncode(s string) string {
+	var b strings.Builder
+
+	for i := range len(s) {
+		c := s[i]
+
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+func sha256Hex(b []byte) string {
+	h := sha256.Sum256(b)
+
+	return hex.EncodeToString(h[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+
+	return h.Sum(nil)
+}
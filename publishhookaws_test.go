@@ -0,0 +1,109 @@
+package mercure
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAWSSigner(t *testing.T) {
+	t.Parallel()
+
+	// The example of the AWS Signature Version 4 documentation.
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+
+	s := &awsSigner{accessKeyID: "AKIDEXAMPLE", secretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY", region: "us-east-1", service: "iam"}
+	s.sign(req, nil, time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, SignedHeaders=content-type;host;x-amz-date, Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7", req.Header.Get("Authorization"))
+}
+
+func TestLambdaPublishHookTarget(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan map[string]any, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/2015-03-31/functions/arn%3Aaws%3Alambda%3Aeu-west-3%3A123456789012%3Afunction%3Afoo/invocations", r.URL.EscapedPath())
+		assert.Equal(t, "Event", r.Header.Get("X-Amz-Invocation-Type"))
+		assert.Equal(t, "bar", r.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/"))
+		assert.Contains(t, r.Header.Get("Authorization"), "/eu-west-3/lambda/aws4_request, SignedHeaders=content-type;host;x-amz-date;x-amz-invocation-type;x-amz-security-token, ")
+
+		var body map[string]any
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	target, err := NewLambdaPublishHookTarget("arn:aws:lambda:eu-west-3:123456789012:function:foo", AWSPublishHookConfig{
+		AccessKeyID:     "AKID",
+		SecretAccessKey: "secret",
+		SessionToken:    "bar",
+		Endpoint:        srv.URL,
+	})
+	require.NoError(t, err)
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "a", Data: "bar"}}))
+
+	assert.Equal(t, map[string]any{"id": "a", "topic": "https://example.com/books/1", "data": "bar"}, <-received)
+}
+
+func TestSNSPublishHookTarget(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan url.Values, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		assert.Contains(t, r.Header.Get("Authorization"), "/us-east-1/sns/aws4_request, ")
+
+		body, _ := io.ReadAll(r.Body)
+		form, err := url.ParseQuery(string(body))
+		assert.NoError(t, err)
+		received <- form
+	}))
+	defer srv.Close()
+
+	target, err := NewSNSPublishHookTarget("arn:aws:sns:us-east-1:123456789012:updates.fifo", AWSPublishHookConfig{AccessKeyID: "AKID", SecretAccessKey: "secret", Endpoint: srv.URL})
+	require.NoError(t, err)
+	require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "a", Data: "bar"}}))
+
+	form := <-received
+	assert.Equal(t, "Publish", form.Get("Action"))
+	assert.Equal(t, "arn:aws:sns:us-east-1:123456789012:updates.fifo", form.Get("TopicArn"))
+	assert.JSONEq(t, `{"id":"a","topic":"https://example.com/books/1","data":"bar"}`, form.Get("Message"))
+	assert.Equal(t, "https://example.com/books/1", form.Get("MessageAttributes.entry.1.Value.StringValue"))
+	assert.Equal(t, "https://example.com/books/1", form.Get("MessageGroupId"))
+	assert.Equal(t, "a", form.Get("MessageDeduplicationId"))
+}
+
+func TestAWSPublishHookTargetsInvalid(t *testing.T) {
+	t.Parallel()
+
+	credentials := AWSPublishHookConfig{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+
+	_, err := NewLambdaPublishHookTarget("", credentials)
+	require.ErrorIs(t, err, ErrInvalidPublishHook)
+
+	_, err = NewLambdaPublishHookTarget("foo", credentials)
+	require.ErrorIs(t, err, ErrInvalidPublishHook)
+
+	_, err = NewLambdaPublishHookTarget("arn:aws:lambda:eu-west-3:123456789012:function:foo", AWSPublishHookConfig{})
+	require.ErrorIs(t, err, ErrInvalidPublishHook)
+
+	_, err = NewSNSPublishHookTarget("updates", credentials)
+	require.ErrorIs(t, err, ErrInvalidPublishHook)
+
+	credentials.Region = "eu-west-3"
+	_, err = NewLambdaPublishHookTarget("foo", credentials)
+	require.NoError(t, err)
+}
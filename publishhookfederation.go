@@ -0,0 +1,281 @@
+package mercure
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// defaultFederationManifestTTL is the lifetime of the manifests of
+	// FederationPublishHookTarget when not set.
+	defaultFederationManifestTTL = time.Hour
+	// federationSessionRenewal is how long before its expiration a federation
+	// session is renewed.
+	federationSessionRenewal = time.Minute
+)
+
+// FederationPublishHookConfig configures the federation of a hub with a peer.
+type FederationPublishHookConfig struct {
+	// Name is the name of the hub in the federation: the client certificate
+	// must be valid for this DNS name.
+	Name string
+	// Audience is the resource identifier of the peer, if it has one.
+	Audience string
+	// Certificate is the client certificate of the hub. Its private key
+	// signs the manifests.
+	Certificate tls.Certificate
+	// RootCAs verifies the certificate of the peer, the system roots being
+	// used when nil.
+	RootCAs *x509.CertPool
+	// Matchers are the topic spaces the manifests claim, which the peer must
+	// have granted to the hub.
+	Matchers []TopicMatcher
+	// ManifestTTL is the lifetime of the manifests, and of the sessions they
+	// open, 1 hour by default.
+	ManifestTTL time.Duration
+	// RegionAffinity selects the topics tied to a region: their updates are
+	// only sent while the peer has subscribers for them.
+	RegionAffinity []TopicMatcher
+	// InterestFiltering only sends the updates of all the topics while the
+	// peer has subscribers for them, not only those with region affinity.
+	InterestFiltering bool
+	// InterestInterval is how often the digest of the topic selectors of the
+	// subscribers of the peer is fetched, 10 seconds by default.
+	InterestInterval time.Duration
+}
+
+// FederationPublishHookTarget publishes the updates to a peer hub configured
+// with WithFederation. It opens a session on the first update, by sending a
+// manifest signed with the key of its client certificate, and renews it
+// before it expires. The updates received from the federation peers are not
+// sent.
+//
+// The updates of the topics with region affinity, or of all the topics when
+// InterestFiltering is set, are only sent while the peer may have subscribers
+// for them, which it reports every InterestInterval as a compact digest: a
+// Bloom filter of the exact selectors and the literal prefixes of the others.
+// The digest may let through some updates nobody subscribed to, but those
+// published after the first subscriber of the peer connected and before the
+// next refresh are not sent.
+type FederationPublishHookTarget struct {
+	handshakeURL string
+	publishURL   string
+	interestURL  string
+	config       FederationPublishHookConfig
+	method       jwt.SigningMethod
+	client       *http.Client
+	tms          *TopicMatcherStore
+
+	mu              sync.Mutex
+	session         string
+	expires         time.Time
+	interest        *interestDigest
+	interestETag    string
+	interestFetched time.Time
+}
+
+// NewFederationPublishHookTarget creates a PublishHookTarget publishing the
+// updates to the peer hub whose URL is hubURL, typically
+// https://example.com/.well-known/mercure.
+func NewFederationPublishHookTarget(hubURL string, c FederationPublishHookConfig) (*FederationPublishHookTarget, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("%w: missing federation name", ErrInvalidPublishHook)
+	}
+
+	method, err := federationSigningMethod(c.Certificate.PrivateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	handshakeURL, err := url.JoinPath(hubURL, "federation", "handshake")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublishHook, err)
+	}
+
+	publishURL, err := url.JoinPath(hubURL, "federation", "publish")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublishHook, err)
+	}
+
+	interestURL, err := url.JoinPath(hubURL, "federation", "interest")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublishHook, err)
+	}
+
+	tms, err := NewTopicMatcherStore(0)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateRegionAffinity(tms, c.RegionAffinity); err != nil {
+		return nil, err
+	}
+
+	if c.ManifestTTL == 0 {
+		c.ManifestTTL = defaultFederationManifestTTL
+	}
+
+	if c.InterestInterval == 0 {
+		c.InterestInterval = defaultFederationInterestInterval
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		Certificates: []tls.Certificate{c.Certificate},
+		RootCAs:      c.RootCAs,
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	return &FederationPublishHookTarget{
+		handshakeURL: handshakeURL,
+		publishURL:   publishURL,
+		interestURL:  interestURL,
+		config:       c,
+		method:       method,
+		client:       &http.Client{Timeout: defaultPublishHookTimeout, Transport: transport},
+		tms:          tms,
+	}, nil
+}
+
+// federationSigningMethod returns the algorithm signing the manifests with
+// the private key of a client certificate.
+//
+//nolint:ireturn
+func federationSigningMethod(key any) (jwt.SigningMethod, error) {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case *ecdsa.PrivateKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return jwt.SigningMethodES256, nil
+		case elliptic.P384():
+			return jwt.SigningMethodES384, nil
+		case elliptic.P521():
+			return jwt.SigningMethodES512, nil
+		}
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	}
+
+	return nil, fmt.Errorf("%w: unsupported private key type %T", ErrInvalidPublishHook, key)
+}
+
+// Send publishes the update to the peer, opening a new session when the
+// current one is about to expire or has been forgotten by the peer, unless
+// the peer has no subscribers for its topics.
+func (t *FederationPublishHookTarget) Send(ctx context.Context, u *Update) error {
+	if u.federatedFrom != "" {
+		return nil
+	}
+
+	body, err := marshalPublishHookUpdate(u)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for retried := false; ; retried = true {
+		if t.session == "" || time.Until(t.expires) < federationSessionRenewal {
+			if err := t.handshake(ctx); err != nil {
+				return err
+			}
+		}
+
+		if !retried && !t.interested(ctx, u) {
+			return nil
+		}
+
+		req, err := newPublishHookRequest(ctx, t.publishURL, "application/json", http.Header{federationSessionHeader: {t.session}}, body)
+		if err != nil {
+			return err
+		}
+
+		resp, err := t.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("unable to publish to federation peer: %w", err)
+		}
+
+		_ = resp.Body.Close()
+
+		if resp.StatusCode == http.StatusUnauthorized && !retried {
+			t.session = ""
+
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("%w: %d", errPublishHookStatus, resp.StatusCode)
+		}
+
+		return nil
+	}
+}
+
+// handshake opens a session with the peer.
+func (t *FederationPublishHookTarget) handshake(ctx context.Context) error {
+	now := time.Now()
+	m := federationManifest{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    t.config.Name,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(t.config.ManifestTTL)),
+		},
+	}
+	if t.config.Audience != "" {
+		m.Audience = jwt.ClaimStrings{t.config.Audience}
+	}
+
+	for _, tm := range t.config.Matchers {
+		if tm.Type == MatcherTypeURLPattern {
+			m.MatchURLPattern = append(m.MatchURLPattern, tm.Pattern)
+		} else {
+			m.Match = append(m.Match, tm.Pattern)
+		}
+	}
+
+	manifest, err := jwt.NewWithClaims(t.method, &m).SignedString(t.config.Certificate.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("unable to sign federation manifest: %w", err)
+	}
+
+	req, err := newPublishHookRequest(ctx, t.handshakeURL, "application/jwt", nil, []byte(manifest))
+	if err != nil {
+		return err
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to open federation session: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: federation handshake: %d", errPublishHookStatus, resp.StatusCode)
+	}
+
+	var s federationSessionJSON
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return fmt.Errorf("invalid federation handshake response: %w", err)
+	}
+
+	t.session = s.Session
+	t.expires = s.Expires
+
+	return nil
+}
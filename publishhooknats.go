@@ -0,0 +1,254 @@
+package mercure
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// natsDefaultPort is the port of NATS servers.
+const natsDefaultPort = "4222"
+
+var (
+	// errNATSTLSRequired is returned by NATSPublishHookTarget when the server
+	// requires TLS, which it doesn't support.
+	errNATSTLSRequired = errors.New("the NATS server requires TLS")
+	// errNATSServer is returned by NATSPublishHookTarget when the server
+	// answers with an error.
+	errNATSServer = errors.New("NATS server error")
+)
+
+// NATSPublishHookTarget publishes the updates to a NATS subject, using the
+// core NATS protocol (at-most-once delivery). The connection is established
+// on the first update, and re-established when it is lost.
+type NATSPublishHookTarget struct {
+	addr    string
+	subject string
+	connect []byte
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// natsInfoJSON holds the fields of the INFO message of the server used by
+// NATSPublishHookTarget.
+type natsInfoJSON struct {
+	TLSRequired bool `json:"tls_required"`
+}
+
+// natsConnectJSON is the CONNECT message NATSPublishHookTarget sends.
+type natsConnectJSON struct {
+	Verbose   bool   `json:"verbose"`
+	Pedantic  bool   `json:"pedantic"`
+	Name      string `json:"name"`
+	Lang      string `json:"lang"`
+	User      string `json:"user,omitempty"`
+	Pass      string `json:"pass,omitempty"`
+	AuthToken string `json:"auth_token,omitempty"`
+}
+
+// NewNATSPublishHookTarget creates a PublishHookTarget publishing updates to
+// the subject of the NATS server at serverURL (nats://[user:pass@]host[:port],
+// or nats://token@host[:port]).
+func NewNATSPublishHookTarget(serverURL, subject string) (*NATSPublishHookTarget, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPublishHook, err)
+	}
+
+	if u.Scheme != "nats" || u.Hostname() == "" {
+		return nil, fmt.Errorf("%w: %q is not a nats:// URL", ErrInvalidPublishHook, u.Redacted())
+	}
+
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("%w: invalid NATS subject %q", ErrInvalidPublishHook, subject)
+	}
+
+	c := natsConnectJSON{Name: "mercure", Lang: "go"}
+	if p, ok := u.User.Password(); ok {
+		c.User, c.Pass = u.User.Username(), p
+	} else if u.User != nil {
+		c.AuthToken = u.User.Username()
+	}
+
+	connect, err := json.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("unable to marshal NATS CONNECT message: %w", err)
+	}
+
+	port := u.Port()
+	if port == "" {
+		port = natsDefaultPort
+	}
+
+	return &NATSPublishHookTarget{addr: net.JoinHostPort(u.Hostname(), port), subject: subject, connect: connect}, nil
+}
+
+// Send publishes the update to the subject.
+func (t *NATSPublishHookTarget) Send(ctx context.Context, u *Update) error {
+	payload, err := marshalPublishHookUpdate(u)
+	if err != nil {
+		return err
+	}
+
+	msg := make([]byte, 0, len(payload)+len(t.subject)+32)
+	msg = fmt.Appendf(msg, "PUB %s %d\r\n", t.subject, len(payload))
+	msg = append(msg, payload...)
+	msg = append(msg, "\r\n"...)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Retry once on a new connection, the server may have closed the
+	// previous one.
+	for attempt := 0; ; attempt++ {
+		if t.conn == nil {
+			if err := t.dial(ctx); err != nil {
+				return err
+			}
+		}
+
+		_ = t.conn.SetWriteDeadline(time.Now().Add(defaultPublishHookTimeout))
+
+		if _, err = t.conn.Write(msg); err == nil {
+			return nil
+		}
+
+		_ = t.conn.Close()
+		t.conn = nil
+
+		if attempt > 0 {
+			return fmt.Errorf("unable to publish to NATS: %w", err)
+		}
+	}
+}
+
+// dial connects to the server, and starts answering its pings.
+func (t *NATSPublishHookTarget) dial(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, defaultPublishHookTimeout)
+	defer cancel()
+
+	var d net.Dialer
+
+	conn, err := d.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return fmt.Errorf("unable to connect to NATS: %w", err)
+	}
+
+	deadline, _ := ctx.Deadline()
+	_ = conn.SetDeadline(deadline)
+
+	r := bufio.NewReader(conn)
+	if err := t.handshake(conn, r); err != nil {
+		_ = conn.Close()
+
+		return err
+	}
+
+	_ = conn.SetDeadline(time.Time{})
+	t.conn = conn
+
+	go t.readLoop(conn, r)
+
+	return nil
+}
+
+func (t *NATSPublishHookTarget) handshake(conn net.Conn, r *bufio.Reader) error {
+	line, err := readNATSLine(r)
+	if err != nil {
+		return err
+	}
+
+	info, ok := strings.CutPrefix(line, "INFO ")
+	if !ok {
+		return fmt.Errorf("%w: unexpected message %q", errNATSServer, line)
+	}
+
+	var i natsInfoJSON
+	if err := json.Unmarshal([]byte(info), &i); err != nil {
+		return fmt.Errorf("%w: invalid INFO message: %w", errNATSServer, err)
+	}
+
+	if i.TLSRequired {
+		return errNATSTLSRequired
+	}
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %s\r\nPING\r\n", t.connect); err != nil {
+		return fmt.Errorf("unable to connect to NATS: %w", err)
+	}
+
+	for {
+		line, err := readNATSLine(r)
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return fmt.Errorf("%w: %s", errNATSServer, line)
+		}
+	}
+}
+
+// readLoop answers the pings of the server, and forgets the connection when
+// the server closes it or reports an error.
+func (t *NATSPublishHookTarget) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := readNATSLine(r)
+		if err != nil || strings.HasPrefix(line, "-ERR") {
+			break
+		}
+
+		if line == "PING" {
+			t.mu.Lock()
+			_ = conn.SetWriteDeadline(time.Now().Add(defaultPublishHookTimeout))
+			_, err = conn.Write([]byte("PONG\r\n"))
+			t.mu.Unlock()
+
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	_ = conn.Close()
+	if t.conn == conn {
+		t.conn = nil
+	}
+}
+
+func readNATSLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", fmt.Errorf("unable to read from NATS: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// Close closes the connection to the server.
+func (t *NATSPublishHookTarget) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn == nil {
+		return nil
+	}
+
+	err := t.conn.Close()
+	t.conn = nil
+
+	return err //nolint:wrapcheck
+}
@@ -0,0 +1,261 @@
+package mercure
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	pubSubDefaultEndpoint = "https://pubsub.googleapis.com"
+	pubSubScope           = "https://www.googleapis.com/auth/pubsub"
+	googleMetadataToken   = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	googleDefaultTokenURI = "https://oauth2.googleapis.com/token"
+)
+
+// errGoogleToken is returned by PubSubPublishHookTarget when no access token
+// can be obtained.
+var errGoogleToken = errors.New("unable to get a Google access token")
+
+// PubSubPublishHookConfig configures the access to Google Cloud of the Pub/Sub
+// publish hook target.
+type PubSubPublishHookConfig struct {
+	// ServiceAccountKey is the JSON key of the service account publishing the
+	// messages. When nil, the access tokens of the service account of the
+	// Google Cloud environment are retrieved from the metadata server.
+	ServiceAccountKey []byte
+	// Endpoint overrides the URL of the Pub/Sub API, for instance to use the
+	// emulator.
+	Endpoint string
+	// Unauthenticated sends the requests without access token, as expected by
+	// the emulator.
+	Unauthenticated bool
+	// Client sends the requests. A nil client uses a client with a 10 seconds
+	// timeout.
+	Client *http.Client
+}
+
+// PubSubPublishHookTarget publishes the updates to a Google Cloud Pub/Sub
+// topic, which can trigger Cloud Run functions. The topic and the ID of the
+// update are set as the "topic" and "id" attributes of the messages, so
+// subscriptions can filter on them.
+type PubSubPublishHookTarget struct {
+	url    string
+	tokens *googleTokenSource
+	client *http.Client
+}
+
+// pubSubPublishJSON is the body of a Pub/Sub publish request.
+type pubSubPublishJSON struct {
+	Messages []pubSubMessageJSON `json:"messages"`
+}
+
+type pubSubMessageJSON struct {
+	Data       []byte            `json:"data"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// NewPubSubPublishHookTarget creates a PublishHookTarget publishing the updates
+// as JSON documents to the topic (projects/<project>/topics/<topic>).
+func NewPubSubPublishHookTarget(topic string, c PubSubPublishHookConfig) (*PubSubPublishHookTarget, error) {
+	if parts := strings.Split(topic, "/"); len(parts) != 4 || parts[0] != "projects" || parts[1] == "" || parts[2] != "topics" || parts[3] == "" {
+		return nil, fmt.Errorf("%w: %q is not a Pub/Sub topic (projects/<project>/topics/<topic>)", ErrInvalidPublishHook, topic)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = &http.Client{Timeout: defaultPublishHookTimeout}
+	}
+
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = pubSubDefaultEndpoint
+	}
+
+	t := &PubSubPublishHookTarget{url: strings.TrimSuffix(endpoint, "/") + "/v1/" + topic + ":publish", client: client}
+
+	switch {
+	case c.Unauthenticated:
+	case c.ServiceAccountKey != nil:
+		tokens, err := newServiceAccountTokenSource(c.ServiceAccountKey, client)
+		if err != nil {
+			return nil, err
+		}
+
+		t.tokens = tokens
+	default:
+		t.tokens = &googleTokenSource{fetch: func(ctx context.Context) (*http.Request, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, googleMetadataToken, nil)
+			if err != nil {
+				return nil, err //nolint:wrapcheck
+			}
+
+			req.Header.Set("Metadata-Flavor", "Google")
+
+			return req, nil
+		}, client: client}
+	}
+
+	return t, nil
+}
+
+// Send publishes the update to the Pub/Sub topic.
+func (t *PubSubPublishHookTarget) Send(ctx context.Context, u *Update) error {
+	data, err := marshalPublishHookUpdate(u)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(pubSubPublishJSON{[]pubSubMessageJSON{{data, map[string]string{"topic": u.Topic, "id": u.ID}}}})
+	if err != nil {
+		return fmt.Errorf("unable to marshal Pub/Sub messages: %w", err)
+	}
+
+	var header http.Header
+
+	if t.tokens != nil {
+		token, err := t.tokens.token(ctx)
+		if err != nil {
+			return err
+		}
+
+		header = http.Header{"Authorization": {"Bearer " + token}}
+	}
+
+	return postPublishHook(ctx, t.client, t.url, "application/json", header, body)
+}
+
+// googleTokenSource caches the OAuth 2 access tokens returned by the requests
+// fetch creates.
+type googleTokenSource struct {
+	fetch  func(ctx context.Context) (*http.Request, error)
+	client *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expiry      time.Time
+}
+
+// googleTokenJSON is the response of the token endpoints.
+type googleTokenJSON struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// serviceAccountKeyJSON holds the fields of a service account key used to
+// get access tokens.
+type serviceAccountKeyJSON struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyID string `json:"private_key_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// newServiceAccountTokenSource exchanges JWTs signed with the key of the
+// service account for access tokens.
+func newServiceAccountTokenSource(key []byte, client *http.Client) (*googleTokenSource, error) {
+	var sa serviceAccountKeyJSON
+	if err := json.Unmarshal(key, &sa); err != nil {
+		return nil, fmt.Errorf("%w: invalid service account key: %w", ErrInvalidPublishHook, err)
+	}
+
+	if sa.ClientEmail == "" {
+		return nil, fmt.Errorf("%w: missing client_email in service account key", ErrInvalidPublishHook)
+	}
+
+	privateKey, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(sa.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid service account key: %w", ErrInvalidPublishHook, err)
+	}
+
+	if sa.TokenURI == "" {
+		sa.TokenURI = googleDefaultTokenURI
+	}
+
+	return &googleTokenSource{fetch: func(ctx context.Context) (*http.Request, error) {
+		assertion, err := signServiceAccountJWT(sa, privateKey, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		form := url.Values{"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"}, "assertion": {assertion}}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, sa.TokenURI, strings.NewReader(form.Encode()))
+		if err != nil {
+			return nil, err //nolint:wrapcheck
+		}
+
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		return req, nil
+	}, client: client}, nil
+}
+
+func signServiceAccountJWT(sa serviceAccountKeyJSON, key *rsa.PrivateKey, now time.Time) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   sa.ClientEmail,
+		"scope": pubSubScope,
+		"aud":   sa.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if sa.PrivateKeyID != "" {
+		t.Header["kid"] = sa.PrivateKeyID
+	}
+
+	s, err := t.SignedString(key)
+	if err != nil {
+		return "", fmt.Errorf("unable to sign service account JWT: %w", err)
+	}
+
+	return s, nil
+}
+
+// token returns a valid access token, fetching a new one a minute before the
+// previous one expires.
+func (s *googleTokenSource) token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.accessToken != "" && time.Now().Before(s.expiry) {
+		return s.accessToken, nil
+	}
+
+	req, err := s.fetch(ctx)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errGoogleToken, err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errGoogleToken, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: status %d", errGoogleToken, resp.StatusCode)
+	}
+
+	var t googleTokenJSON
+	if err := json.NewDecoder(resp.Body).Decode(&t); err != nil {
+		return "", fmt.Errorf("%w: invalid response: %w", errGoogleToken, err)
+	}
+
+	if t.AccessToken == "" {
+		return "", fmt.Errorf("%w: missing access token", errGoogleToken)
+	}
+
+	s.accessToken = t.AccessToken
+	s.expiry = time.Now().Add(time.Duration(t.ExpiresIn)*time.Second - time.Minute)
+
+	return s.accessToken, nil
+}
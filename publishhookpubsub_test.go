@@ -0,0 +1,90 @@
+package mercure
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPubSubPublishHookTarget(t *testing.T) {
+	t.Parallel()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	var tokens atomic.Int32
+
+	received := make(chan pubSubPublishJSON, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token", func(w http.ResponseWriter, r *http.Request) {
+		tokens.Add(1)
+
+		assert.Equal(t, "urn:ietf:params:oauth:grant-type:jwt-bearer", r.FormValue("grant_type"))
+
+		token, err := jwt.Parse(r.FormValue("assertion"), func(*jwt.Token) (any, error) { return &key.PublicKey, nil }, jwt.WithValidMethods([]string{"RS256"}))
+		if assert.NoError(t, err) {
+			assert.Equal(t, "key-1", token.Header["kid"])
+			assert.Equal(t, "mercure@example.iam.gserviceaccount.com", token.Claims.(jwt.MapClaims)["iss"])
+			assert.Equal(t, pubSubScope, token.Claims.(jwt.MapClaims)["scope"])
+		}
+
+		_, _ = w.Write([]byte(`{"access_token": "foo", "expires_in": 3600}`))
+	})
+	mux.HandleFunc("POST /v1/projects/my-project/topics/updates:publish", func(_ http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer foo", r.Header.Get("Authorization"))
+
+		var body pubSubPublishJSON
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		received <- body
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	serviceAccountKey, err := json.Marshal(serviceAccountKeyJSON{
+		ClientEmail:  "mercure@example.iam.gserviceaccount.com",
+		PrivateKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		PrivateKeyID: "key-1",
+		TokenURI:     srv.URL + "/token",
+	})
+	require.NoError(t, err)
+
+	target, err := NewPubSubPublishHookTarget("projects/my-project/topics/updates", PubSubPublishHookConfig{ServiceAccountKey: serviceAccountKey, Endpoint: srv.URL})
+	require.NoError(t, err)
+
+	for _, id := range []string{"a", "b"} {
+		require.NoError(t, target.Send(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: id, Data: "bar"}}))
+
+		messages := (<-received).Messages
+		require.Len(t, messages, 1)
+		assert.JSONEq(t, `{"id":"`+id+`","topic":"https://example.com/books/1","data":"bar"}`, string(messages[0].Data))
+		assert.Equal(t, map[string]string{"topic": "https://example.com/books/1", "id": id}, messages[0].Attributes)
+	}
+
+	assert.Equal(t, int32(1), tokens.Load())
+}
+
+func TestPubSubPublishHookTargetInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, topic := range []string{"updates", "projects/my-project/updates", "projects//topics/updates"} {
+		_, err := NewPubSubPublishHookTarget(topic, PubSubPublishHookConfig{})
+		assert.ErrorIs(t, err, ErrInvalidPublishHook)
+	}
+
+	_, err := NewPubSubPublishHookTarget("projects/my-project/topics/updates", PubSubPublishHookConfig{ServiceAccountKey: []byte(`{"client_email": "foo"}`)})
+	require.ErrorIs(t, err, ErrInvalidPublishHook)
+}
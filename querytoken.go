@@ -0,0 +1,114 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// paramAuthorization is the query parameter carrying the access token of
+	// the subscribers that can't set the Authorization header nor a cookie,
+	// see WithQueryTokens.
+	paramAuthorization = "authorization"
+
+	// DefaultQueryTokenMaxLifetime is the default lifetime of the access
+	// tokens passed in the query.
+	DefaultQueryTokenMaxLifetime = 5 * time.Minute
+)
+
+var (
+	// ErrInvalidQueryTokenMaxLifetime is returned by WithQueryTokens for a
+	// lifetime that isn't positive.
+	ErrInvalidQueryTokenMaxLifetime = errors.New("the maximum lifetime of query tokens must be positive")
+
+	errQueryTokenLifetime = errors.New("access tokens passed in the query must be short-lived")
+	errQueryTokenPublish  = errors.New("access tokens passed in the query can't be used to publish")
+)
+
+// queryTokenKey is the context key marking the requests whose access token
+// was passed in the query.
+type queryTokenKey struct{}
+
+// WithQueryTokens accepts the access token of the subscribers in the
+// "authorization" query parameter, for the clients that can't set the
+// Authorization header nor use the authorization cookie, such as a native
+// EventSource connecting to a hub on another site.
+//
+// URLs end up in browser histories, proxy logs and Referer headers: the
+// tokens must expire within maxLifetime (their exp claim, and their iat claim
+// when set, are checked), and only grant subscribing. The parameter is
+// removed from the request before it reaches the handlers of the hub, so that
+// it never appears in the logs, traces and metrics of the hub; the access logs
+// of the server in front of the hub must be filtered too.
+func WithQueryTokens(maxLifetime time.Duration) Option {
+	return func(o *opt) error {
+		if maxLifetime <= 0 {
+			return ErrInvalidQueryTokenMaxLifetime
+		}
+
+		o.queryTokenMaxLifetime = maxLifetime
+
+		return nil
+	}
+}
+
+// queryTokenHandler moves the access token passed in the query of the safe
+// requests to the Authorization header, and removes it from the URL. A
+// request having both is rejected by the authorization, like a request having
+// several Authorization headers.
+func (h *Hub) queryTokenHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		query, err := url.ParseQuery(r.URL.RawQuery)
+		tokens, ok := query[paramAuthorization]
+		if err != nil || !ok {
+			next.ServeHTTP(w, r)
+
+			return
+		}
+
+		query.Del(paramAuthorization)
+
+		r = r.Clone(context.WithValue(r.Context(), queryTokenKey{}, true))
+		r.URL.RawQuery = query.Encode()
+		r.RequestURI = r.URL.RequestURI()
+
+		for _, t := range tokens {
+			r.Header.Add("Authorization", bearerPrefix+t)
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// checkQueryToken enforces the restrictions of the access tokens passed in
+// the query.
+func (h *Hub) checkQueryToken(r *http.Request, c *claims, publish bool) error {
+	if fromQuery, _ := r.Context().Value(queryTokenKey{}).(bool); !fromQuery {
+		return nil
+	}
+
+	if publish {
+		return fmt.Errorf("%w: %w", ErrInvalidJWT, errQueryTokenPublish)
+	}
+
+	now := time.Now()
+
+	// A token whose iat is in the past can still be valid for long: the
+	// remaining lifetime is checked too.
+	if c.ExpiresAt == nil || c.ExpiresAt.Sub(now) > h.queryTokenMaxLifetime ||
+		(c.IssuedAt != nil && c.ExpiresAt.Sub(c.IssuedAt.Time) > h.queryTokenMaxLifetime) {
+		return fmt.Errorf("%w: %w (%s at most)", ErrInvalidJWT, errQueryTokenLifetime, h.queryTokenMaxLifetime)
+	}
+
+	return nil
+}
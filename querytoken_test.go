@@ -0,0 +1,98 @@
+package mercure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithQueryTokensInvalidLifetime(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithQueryTokens(0))
+	require.ErrorIs(t, err, ErrInvalidQueryTokenMaxLifetime)
+}
+
+func TestSubscribeQueryToken(t *testing.T) {
+	t.Parallel()
+
+	// The tokens of the tests expire in one hour.
+	query := "?match=https://example.com/books/1&" + paramAuthorization + "=" + url.QueryEscape(createDummyAuthorizedJWT(roleSubscriber, []string{"*"}))
+
+	for _, tc := range []struct {
+		name    string
+		options []Option
+		status  int
+	}{
+		{"disabled", nil, http.StatusUnauthorized},
+		{"short-lived", []Option{WithQueryTokens(2 * time.Hour)}, http.StatusOK},
+		{"long-lived", []Option{WithQueryTokens(time.Minute)}, http.StatusUnauthorized},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			w := httptest.NewRecorder()
+			createDummy(t, tc.options...).ServeHTTP(w, httptest.NewRequest(http.MethodHead, defaultHubURL+query, nil))
+
+			resp := w.Result()
+			require.NoError(t, resp.Body.Close())
+
+			assert.Equal(t, tc.status, resp.StatusCode)
+		})
+	}
+}
+
+func TestQueryTokenHandlerStripsToken(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithQueryTokens(time.Minute))
+
+	var got *http.Request
+
+	handler := hub.queryTokenHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { got = r }))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=foo&authorization=secret", nil))
+	assert.Equal(t, "match=foo", got.URL.RawQuery)
+	assert.Equal(t, defaultHubURL+"?match=foo", got.RequestURI)
+	assert.Equal(t, []string{bearerPrefix + "secret"}, got.Header.Values("Authorization"))
+
+	// A request can't carry two tokens.
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?authorization=secret", nil)
+	req.Header.Set("Authorization", bearerPrefix+"other")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Len(t, got.Header.Values("Authorization"), 2)
+
+	// Tokens are only accepted for subscribing.
+	req = httptest.NewRequest(http.MethodPost, defaultHubURL+"?authorization=secret", nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Same(t, req, got)
+	assert.Empty(t, got.Header.Values("Authorization"))
+}
+
+func TestCheckQueryToken(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithQueryTokens(time.Minute))
+	now := time.Now()
+
+	header := httptest.NewRequest(http.MethodGet, defaultHubURL, nil)
+	query := httptest.NewRequest(http.MethodGet, defaultHubURL+"?authorization=secret", nil)
+	hub.queryTokenHandler(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) { query = r })).ServeHTTP(httptest.NewRecorder(), query)
+
+	short := &claims{RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(now.Add(30 * time.Second))}}
+	long := &claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour))}}
+	backdated := &claims{RegisteredClaims: jwt.RegisteredClaims{IssuedAt: jwt.NewNumericDate(now.Add(-time.Hour)), ExpiresAt: jwt.NewNumericDate(now.Add(30 * time.Second))}}
+
+	require.NoError(t, hub.checkQueryToken(header, long, true))
+	require.NoError(t, hub.checkQueryToken(query, short, false))
+	require.ErrorIs(t, hub.checkQueryToken(query, short, true), ErrInvalidJWT)
+	require.ErrorIs(t, hub.checkQueryToken(query, long, false), ErrInvalidJWT)
+	require.ErrorIs(t, hub.checkQueryToken(query, backdated, false), ErrInvalidJWT)
+	require.ErrorIs(t, hub.checkQueryToken(query, &claims{}, false), ErrInvalidJWT)
+}
@@ -0,0 +1,704 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultRedisStreamKey = "mercure"
+	// redisReadBlock is how long XREAD blocks waiting for new entries.
+	redisReadBlock = 5 * time.Second
+	// redisReadCount is the maximum number of entries read at once.
+	redisReadCount = "100"
+	// redisHistoryBatch is the number of entries fetched at once when
+	// replaying the history.
+	redisHistoryBatch = 500
+	// minRedisReconnectDelay and maxRedisReconnectDelay bound the delay
+	// between two attempts to reconnect the reading connection.
+	minRedisReconnectDelay = 100 * time.Millisecond
+	maxRedisReconnectDelay = 10 * time.Second
+	// redisLiveTimeout is how long the reading connection can fail before the
+	// transport isn't live anymore.
+	redisLiveTimeout = time.Minute
+)
+
+// RedisTransport implements the TransportInterface using Redis Streams, so
+// several hubs share the history and the fan-out of the updates.
+//
+// Updates are appended to a stream, trimmed to about maxLen entries. Each hub
+// reads the whole stream with XREAD, and dispatches the entries to its
+// subscribers, including the updates it published itself: all the hubs
+// dispatch the updates in the order of the stream. When the connection is
+// lost, the hub reconnects and resumes after the last entry it dispatched, so
+// its subscribers don't miss the updates published meanwhile.
+//
+// No consumer group is used: the hubs don't share the entries, they all read
+// them, and nothing is left on the server when a hub crashes.
+type RedisTransport struct {
+	sync.RWMutex
+
+	subscribers *SubscriberList
+	logger      *slog.Logger
+	options     redisOptions
+	streamKey   string
+	maxLen      uint64
+
+	connMu     sync.Mutex
+	conn       *redisConn
+	connClosed bool
+
+	readerMu    sync.Mutex
+	reader      *redisConn
+	readErr     error
+	failingFrom time.Time
+
+	closed     chan struct{}
+	closedOnce sync.Once
+	done       chan struct{}
+
+	lastStreamID string
+	lastEventID  string
+}
+
+// NewRedisTransport creates a new RedisTransport connected to the server of
+// redisURL (redis://[[user]:password@]host[:port][/db], or rediss:// for TLS),
+// using the stream streamKey trimmed to about maxLen entries (0 for no limit).
+func NewRedisTransport(
+	subscriberList *SubscriberList,
+	logger *slog.Logger,
+	redisURL string,
+	streamKey string,
+	maxLen uint64,
+) (*RedisTransport, error) {
+	u, err := url.Parse(redisURL)
+	if err != nil {
+		return nil, &TransportError{err: err}
+	}
+
+	options, err := parseRedisURL(u)
+	if err != nil {
+		return nil, &TransportError{dsn: u.Redacted(), err: err}
+	}
+
+	if streamKey == "" {
+		streamKey = defaultRedisStreamKey
+	}
+
+	t := &RedisTransport{
+		subscribers:  subscriberList,
+		logger:       logger,
+		options:      options,
+		streamKey:    streamKey,
+		maxLen:       maxLen,
+		closed:       make(chan struct{}),
+		done:         make(chan struct{}),
+		lastStreamID: "0-0",
+		lastEventID:  EarliestLastEventID,
+	}
+
+	ctx, cancel := redisTimeout(context.Background())
+	defer cancel()
+
+	// Connection errors are not *TransportError, the server may come back.
+	if err := t.init(ctx); err != nil {
+		return nil, err
+	}
+
+	go t.read()
+
+	return t, nil
+}
+
+// init reads the last entry of the stream, the hub reading the stream after
+// it.
+func (t *RedisTransport) init(ctx context.Context) error {
+	return t.command(ctx, func(c *redisConn) error {
+		reply, err := c.command(ctx, "XREVRANGE", t.streamKey, "+", "-", "COUNT", "1")
+		if err != nil {
+			return fmt.Errorf("unable to read the last entry of the redis stream: %w", err)
+		}
+
+		entries, err := parseRedisStreamEntries(reply)
+		if err != nil {
+			return err
+		}
+
+		if len(entries) > 0 {
+			t.lastStreamID = entries[0].id
+			t.lastEventID = entries[0].fields["id"]
+		}
+
+		return nil
+	})
+}
+
+// command runs fn with the connection sending the commands, connecting it if
+// needed. The connection is dropped when it fails, and isn't connected again
+// once the transport is closed.
+func (t *RedisTransport) command(ctx context.Context, fn func(c *redisConn) error) error {
+	t.connMu.Lock()
+	defer t.connMu.Unlock()
+
+	if t.connClosed {
+		return ErrClosedTransport
+	}
+
+	if t.conn == nil {
+		c, err := dialRedis(ctx, t.options)
+		if err != nil {
+			return err
+		}
+
+		t.conn = c
+	}
+
+	err := fn(t.conn)
+	if err != nil && !errors.Is(err, errRedisServer) {
+		_ = t.conn.close()
+		t.conn = nil
+	}
+
+	return err
+}
+
+// Dispatch appends an update to the stream, the hubs dispatching it to their
+// subscribers when they read it.
+func (t *RedisTransport) Dispatch(ctx context.Context, update *Update) error {
+	return t.DispatchGroup(ctx, []*Update{update})
+}
+
+// DispatchGroup appends a group of updates to the stream in a transaction,
+// so they are all stored contiguously, or none of them.
+func (t *RedisTransport) DispatchGroup(ctx context.Context, updates []*Update) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	commands := make([][]string, 0, len(updates)+2)
+
+	for _, update := range updates {
+		update.AssignUUID()
+
+		// Marshal through the pointer so Update's custom MarshalJSON applies.
+		updateJSON, err := json.Marshal(update)
+		if err != nil {
+			return fmt.Errorf("error when marshaling update: %w", err)
+		}
+
+		args := []string{"XADD", t.streamKey}
+		if t.maxLen > 0 {
+			args = append(args, "MAXLEN", "~", strconv.FormatUint(t.maxLen, 10))
+		}
+
+		commands = append(commands, append(args, "*", "id", update.ID, "update", string(updateJSON)))
+	}
+
+	if len(commands) > 1 {
+		commands = append([][]string{{"MULTI"}}, append(commands, []string{"EXEC"})...)
+	}
+
+	ctx, cancel := redisTimeout(ctx)
+	defer cancel()
+
+	return t.command(ctx, func(c *redisConn) error {
+		for _, args := range commands {
+			if err := c.send(ctx, args...); err != nil {
+				return err
+			}
+		}
+
+		var errs []error
+
+		for range commands {
+			reply, err := c.receive()
+			if err != nil {
+				return err
+			}
+
+			if err, ok := reply.(error); ok {
+				errs = append(errs, err)
+			}
+
+			// The replies of the commands of a transaction.
+			if replies, ok := reply.([]any); ok {
+				for _, r := range replies {
+					if err, ok := r.(error); ok {
+						errs = append(errs, err)
+					}
+				}
+			}
+		}
+
+		if err := errors.Join(errs...); err != nil {
+			return fmt.Errorf("unable to append to the redis stream: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// read reads the stream until the transport is closed, reconnecting when the
+// connection is lost.
+func (t *RedisTransport) read() {
+	defer close(t.done)
+
+	for delay := minRedisReconnectDelay; ; delay = min(delay*2, maxRedisReconnectDelay) {
+		connected, err := t.readConn()
+		if isClosed(t.closed) {
+			return
+		}
+
+		if connected {
+			delay = minRedisReconnectDelay
+		}
+
+		t.readerMu.Lock()
+		if t.readErr == nil {
+			t.failingFrom = time.Now()
+		}
+		t.readErr = err
+		t.readerMu.Unlock()
+
+		if t.logger.Enabled(context.Background(), slog.LevelError) {
+			t.logger.LogAttrs(context.Background(), slog.LevelError, "Redis stream read failed, reconnecting", slog.Any("error", err))
+		}
+
+		select {
+		case <-t.closed:
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// readConn opens a connection and reads the stream with it until it fails,
+// reporting whether it has been established.
+func (t *RedisTransport) readConn() (bool, error) {
+	ctx, cancel := redisTimeout(context.Background())
+	c, err := dialRedis(ctx, t.options)
+
+	cancel()
+
+	if err != nil {
+		return false, err
+	}
+
+	t.readerMu.Lock()
+	if isClosed(t.closed) {
+		t.readerMu.Unlock()
+		_ = c.close()
+
+		return true, ErrClosedTransport
+	}
+
+	t.reader = c
+	t.readerMu.Unlock()
+
+	defer func() {
+		t.readerMu.Lock()
+		t.reader = nil
+		t.readerMu.Unlock()
+
+		_ = c.close()
+	}()
+
+	for {
+		if err := t.readEntries(c); err != nil {
+			return true, err
+		}
+
+		t.readerMu.Lock()
+		t.readErr = nil
+		t.readerMu.Unlock()
+	}
+}
+
+// readEntries waits for the entries after the last one dispatched, and
+// dispatches them.
+func (t *RedisTransport) readEntries(c *redisConn) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisReadBlock+5*time.Second)
+	defer cancel()
+
+	t.RLock()
+	after := t.lastStreamID
+	t.RUnlock()
+
+	reply, err := c.do(ctx, "XREAD", "COUNT", redisReadCount, "BLOCK", strconv.FormatInt(redisReadBlock.Milliseconds(), 10), "STREAMS", t.streamKey, after)
+	if err != nil {
+		return err
+	}
+
+	if err, ok := reply.(error); ok {
+		return err
+	}
+
+	streams, ok := reply.([]any)
+	if !ok || len(streams) == 0 {
+		return nil // Timeout
+	}
+
+	stream, ok := streams[0].([]any)
+	if !ok || len(stream) != 2 {
+		return errRedisProtocol
+	}
+
+	entries, err := parseRedisStreamEntries(stream[1])
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		t.dispatchEntry(ctx, e)
+	}
+
+	return nil
+}
+
+// dispatchEntry dispatches an entry read from the stream to the subscribers,
+// unless it was already known when the hub started.
+func (t *RedisTransport) dispatchEntry(ctx context.Context, e redisStreamEntry) {
+	var update *Update
+	if err := json.Unmarshal([]byte(e.fields["update"]), &update); err != nil {
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from the Redis stream", slog.String("stream_id", e.id), slog.Any("error", err))
+		}
+
+		return
+	}
+
+	t.Lock()
+	defer t.Unlock()
+
+	if !redisStreamIDAfter(e.id, t.lastStreamID) {
+		return
+	}
+
+	for _, s := range t.subscribers.MatchAny(update) {
+		s.Dispatch(ctx, update, false)
+	}
+
+	t.lastStreamID = e.id
+	t.lastEventID = update.ID
+}
+
+// redisStreamIDAfter reports whether the stream ID a is after b.
+func redisStreamIDAfter(a, b string) bool {
+	parse := func(id string) (ms, seq uint64) {
+		m, s, _ := strings.Cut(id, "-")
+		ms, _ = strconv.ParseUint(m, 10, 64)
+		seq, _ = strconv.ParseUint(s, 10, 64)
+
+		return ms, seq
+	}
+
+	ams, aseq := parse(a)
+	bms, bseq := parse(b)
+
+	return ams > bms || (ams == bms && aseq > bseq)
+}
+
+// AddSubscriber adds a new subscriber to the transport.
+func (t *RedisTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	t.Lock()
+	// Checked again under the lock: a subscriber added after Close would never
+	// be disconnected.
+	if isClosed(t.closed) {
+		t.Unlock()
+
+		return ErrClosedTransport
+	}
+
+	t.subscribers.Add(s)
+	toStreamID := t.lastStreamID
+	t.Unlock()
+
+	if s.RequestLastEventIDSet {
+		if err := t.dispatchHistory(ctx, s, toStreamID); err != nil {
+			return err
+		}
+	}
+
+	s.Ready(ctx)
+
+	return nil
+}
+
+// RemoveSubscriber removes a subscriber from the transport.
+func (t *RedisTransport) RemoveSubscriber(_ context.Context, s *LocalSubscriber) error {
+	t.Lock()
+	defer t.Unlock()
+
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	t.subscribers.Remove(s)
+
+	return nil
+}
+
+// GetSubscribers gets the list of active subscribers.
+func (t *RedisTransport) GetSubscribers(_ context.Context) (string, []*Subscriber, error) {
+	t.RLock()
+	defer t.RUnlock()
+
+	return t.lastEventID, getSubscribers(t.subscribers), nil
+}
+
+// SetSubscriberShards splits the subscribers in n shards.
+func (t *RedisTransport) SetSubscriberShards(n int) {
+	t.subscribers.SetShards(n)
+}
+
+// rangeHistory calls fn for the entries of the stream up to toStreamID
+// included, oldest first, until it returns false.
+func (t *RedisTransport) rangeHistory(ctx context.Context, toStreamID string, fn func(e redisStreamEntry) bool) error {
+	start := "-"
+
+	for {
+		var entries []redisStreamEntry
+
+		err := t.command(ctx, func(c *redisConn) error {
+			cctx, cancel := redisTimeout(ctx)
+			defer cancel()
+
+			reply, err := c.command(cctx, "XRANGE", t.streamKey, start, toStreamID, "COUNT", strconv.Itoa(redisHistoryBatch))
+			if err != nil {
+				return err
+			}
+
+			entries, err = parseRedisStreamEntries(reply)
+
+			return err
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			if !fn(e) {
+				return nil
+			}
+		}
+
+		if len(entries) < redisHistoryBatch {
+			return nil
+		}
+
+		start = "(" + entries[len(entries)-1].id
+	}
+}
+
+//nolint:gocognit
+func (t *RedisTransport) dispatchHistory(ctx context.Context, s *LocalSubscriber, toStreamID string) error {
+	ctx, span := startSpan(ctx, "mercure.transport.history",
+		trace.WithAttributes(
+			attribute.String("mercure.transport", "redis"),
+			attribute.String("mercure.subscriber.id", s.ID),
+			attribute.String("mercure.last_event_id.requested", s.RequestLastEventID),
+		))
+	defer span.End()
+
+	responseLastEventID := EarliestLastEventID
+	afterFromID := s.RequestLastEventID == EarliestLastEventID
+	scanned := 0
+	window := replayWindow{s: s}
+	disconnected := false
+
+	if toStreamID == "0-0" {
+		s.HistoryDispatched(responseLastEventID)
+
+		return nil
+	}
+
+	err := t.rangeHistory(ctx, toStreamID, func(e redisStreamEntry) bool {
+		if !afterFromID {
+			// DoS guard: cap the search-for-requested-ID phase only.
+			if scanned >= maxHistoryScan {
+				return false
+			}
+
+			scanned++
+
+			if e.fields["id"] == s.RequestLastEventID {
+				afterFromID = true
+				// The subscriber already knows this id; echoing it is not a
+				// disclosure.
+				responseLastEventID = s.RequestLastEventID
+
+				return true
+			}
+
+			// Only disclose the id of an event the subscriber is authorized
+			// to read.
+			var update *Update
+			if err := json.Unmarshal([]byte(e.fields["update"]), &update); err == nil && s.Match(update) {
+				responseLastEventID = update.ID
+			}
+
+			return true
+		}
+
+		var update *Update
+		if err := json.Unmarshal([]byte(e.fields["update"]), &update); err != nil {
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Unable to unmarshal update coming from the Redis stream", slog.String("stream_id", e.id), slog.Any("error", err))
+			}
+
+			return true
+		}
+
+		if !s.Match(update) || window.skip(update) {
+			return true
+		}
+
+		if !window.flush(ctx) || !s.Dispatch(ctx, update, true) {
+			disconnected = true
+
+			return false
+		}
+
+		return true
+	})
+
+	if err == nil && !disconnected {
+		window.flush(ctx)
+	}
+
+	s.HistoryDispatched(responseLastEventID)
+
+	if err != nil {
+		err = fmt.Errorf("unable to retrieve history from Redis: %w", err)
+		recordSpanError(span, err)
+
+		return err
+	}
+
+	if !afterFromID && t.logger.Enabled(ctx, slog.LevelInfo) {
+		t.logger.LogAttrs(ctx, slog.LevelInfo, "Can't find requested LastEventID")
+	}
+
+	return nil
+}
+
+// ReadHistory calls fn for every update of the stream, oldest first.
+func (t *RedisTransport) ReadHistory(ctx context.Context, fn func(u *Update) error) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	var fnErr error
+
+	err := t.rangeHistory(ctx, "+", func(e redisStreamEntry) bool {
+		var update *Update
+		if fnErr = json.Unmarshal([]byte(e.fields["update"]), &update); fnErr != nil {
+			fnErr = fmt.Errorf("unable to unmarshal update: %w", fnErr)
+
+			return false
+		}
+
+		fnErr = fn(update)
+
+		return fnErr == nil
+	})
+	if err != nil {
+		return fmt.Errorf("unable to read history from Redis: %w", err)
+	}
+
+	return fnErr
+}
+
+// Ready reports whether the Redis server answers.
+func (t *RedisTransport) Ready(ctx context.Context) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	ctx, cancel := redisTimeout(ctx)
+	defer cancel()
+
+	return t.command(ctx, func(c *redisConn) error {
+		_, err := c.command(ctx, "PING")
+
+		return err
+	})
+}
+
+// Live reports whether the stream could be read during the last minute.
+func (t *RedisTransport) Live(_ context.Context) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	t.readerMu.Lock()
+	defer t.readerMu.Unlock()
+
+	if t.readErr != nil && time.Since(t.failingFrom) > redisLiveTimeout {
+		return fmt.Errorf("unable to read the redis stream since %s: %w", t.failingFrom, t.readErr)
+	}
+
+	return nil
+}
+
+// Close closes the Transport, disconnects all the subscribers and closes the
+// connections.
+func (t *RedisTransport) Close(_ context.Context) error {
+	t.closedOnce.Do(func() {
+		close(t.closed)
+
+		t.readerMu.Lock()
+		if t.reader != nil {
+			_ = t.reader.close()
+		}
+		t.readerMu.Unlock()
+
+		<-t.done
+
+		t.Lock()
+		t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
+			s.DisconnectWithReason(DisconnectReasonTransportClosed)
+
+			return true
+		})
+		t.subscribers.Close()
+		t.Unlock()
+
+		t.connMu.Lock()
+		defer t.connMu.Unlock()
+
+		t.connClosed = true
+		if t.conn != nil {
+			_ = t.conn.close()
+			t.conn = nil
+		}
+	})
+
+	return nil
+}
+
+// Interface guards.
+var (
+	_ Transport                  = (*RedisTransport)(nil)
+	_ TransportSubscribers       = (*RedisTransport)(nil)
+	_ TransportGroupDispatcher   = (*RedisTransport)(nil)
+	_ TransportHistoryReader     = (*RedisTransport)(nil)
+	_ TransportHealthChecker     = (*RedisTransport)(nil)
+	_ TransportSubscriberSharder = (*RedisTransport)(nil)
+	_ TransportIdempotencyIndex  = (*RedisTransport)(nil)
+)
@@ -0,0 +1,450 @@
+package mercure
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedisServer implements the commands of Redis Streams used by
+// RedisTransport, for a single stream.
+type fakeRedisServer struct {
+	addr     string
+	password string
+
+	mu      sync.Mutex
+	entries []redisStreamEntry
+	seq     int
+	added   chan struct{}
+	conns   []net.Conn
+}
+
+type fakeRedisStatus string
+
+func newFakeRedisServer(t *testing.T, password string) *fakeRedisServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	srv := &fakeRedisServer{addr: l.Addr().String(), password: password, added: make(chan struct{})}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			srv.mu.Lock()
+			srv.conns = append(srv.conns, conn)
+			srv.mu.Unlock()
+
+			go srv.serve(conn)
+		}
+	}()
+
+	t.Cleanup(srv.dropConnections)
+
+	return srv
+}
+
+// dropConnections closes all the connections of the clients.
+func (srv *fakeRedisServer) dropConnections() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	for _, c := range srv.conns {
+		_ = c.Close()
+	}
+
+	srv.conns = nil
+}
+
+func (srv *fakeRedisServer) serve(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	authenticated := srv.password == ""
+
+	var queued [][]string
+
+	for {
+		args, err := readFakeRedisCommand(r)
+		if err != nil {
+			return
+		}
+
+		name := strings.ToUpper(args[0])
+
+		var reply any
+
+		switch {
+		case name == "AUTH":
+			authenticated = args[len(args)-1] == srv.password
+			reply = fakeRedisStatus("OK")
+			if !authenticated {
+				reply = fmt.Errorf("WRONGPASS invalid username-password pair")
+			}
+		case !authenticated:
+			reply = fmt.Errorf("NOAUTH Authentication required")
+		case name == "MULTI":
+			queued = [][]string{}
+			reply = fakeRedisStatus("OK")
+		case name == "EXEC":
+			replies := make([]any, 0, len(queued))
+			for _, c := range queued {
+				replies = append(replies, srv.run(c))
+			}
+
+			queued, reply = nil, replies
+		case queued != nil:
+			queued = append(queued, args)
+			reply = fakeRedisStatus("QUEUED")
+		default:
+			reply = srv.run(args)
+		}
+
+		if _, err := io.WriteString(conn, encodeFakeRedisReply(reply)); err != nil {
+			return
+		}
+	}
+}
+
+func (srv *fakeRedisServer) run(args []string) any { //nolint:gocognit
+	switch strings.ToUpper(args[0]) {
+	case "PING":
+		return fakeRedisStatus("PONG")
+	case "SELECT":
+		return fakeRedisStatus("OK")
+	case "XADD":
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+
+		i, maxLen := 2, 0
+		if args[i] == "MAXLEN" {
+			maxLen, _ = strconv.Atoi(args[i+2])
+			i += 3
+		}
+
+		srv.seq++
+		e := redisStreamEntry{id: fmt.Sprintf("%d-0", srv.seq), fields: map[string]string{}}
+
+		for j := i + 1; j+1 < len(args); j += 2 {
+			e.fields[args[j]] = args[j+1]
+		}
+
+		srv.entries = append(srv.entries, e)
+		if maxLen > 0 && len(srv.entries) > maxLen {
+			srv.entries = srv.entries[len(srv.entries)-maxLen:]
+		}
+
+		close(srv.added)
+		srv.added = make(chan struct{})
+
+		return e.id
+	case "XREVRANGE":
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+
+		if len(srv.entries) == 0 {
+			return []any{}
+		}
+
+		return []any{fakeRedisEntry(srv.entries[len(srv.entries)-1])}
+	case "XRANGE":
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+
+		count, _ := strconv.Atoi(args[5])
+		reply := []any{}
+
+		for _, e := range srv.entries {
+			if len(reply) == count {
+				break
+			}
+
+			start, end := args[2], args[3]
+			if (start != "-" && strings.HasPrefix(start, "(") && !redisStreamIDAfter(e.id, start[1:])) ||
+				(start != "-" && !strings.HasPrefix(start, "(") && redisStreamIDAfter(start, e.id)) ||
+				(end != "+" && redisStreamIDAfter(e.id, end)) {
+				continue
+			}
+
+			reply = append(reply, fakeRedisEntry(e))
+		}
+
+		return reply
+	case "XREAD":
+		return srv.read(args[4], args[7])
+	}
+
+	return fmt.Errorf("ERR unknown command %q", args[0])
+}
+
+func (srv *fakeRedisServer) read(block, after string) any {
+	ms, _ := strconv.Atoi(block)
+	timeout := time.After(time.Duration(ms) * time.Millisecond)
+
+	for {
+		srv.mu.Lock()
+
+		var entries []any
+
+		for _, e := range srv.entries {
+			if redisStreamIDAfter(e.id, after) {
+				entries = append(entries, fakeRedisEntry(e))
+			}
+		}
+
+		added := srv.added
+		srv.mu.Unlock()
+
+		if len(entries) > 0 {
+			return []any{[]any{"mercure", entries}}
+		}
+
+		select {
+		case <-added:
+		case <-timeout:
+			return []any(nil)
+		}
+	}
+}
+
+func fakeRedisEntry(e redisStreamEntry) []any {
+	keys := make([]string, 0, len(e.fields))
+	for k := range e.fields {
+		keys = append(keys, k)
+	}
+
+	slices.Sort(keys)
+
+	fields := make([]any, 0, 2*len(keys))
+	for _, k := range keys {
+		fields = append(fields, k, e.fields[k])
+	}
+
+	return []any{e.id, fields}
+}
+
+func readFakeRedisCommand(r *bufio.Reader) ([]string, error) {
+	c := &redisConn{r: r}
+
+	reply, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := reply.([]any)
+
+	args := make([]string, 0, len(items))
+	for _, i := range items {
+		s, _ := i.(string)
+		args = append(args, s)
+	}
+
+	return args, nil
+}
+
+func encodeFakeRedisReply(reply any) string {
+	switch v := reply.(type) {
+	case fakeRedisStatus:
+		return "+" + string(v) + "\r\n"
+	case error:
+		return "-" + v.Error() + "\r\n"
+	case int64:
+		return ":" + strconv.FormatInt(v, 10) + "\r\n"
+	case string:
+		return "$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n"
+	case []any:
+		if v == nil {
+			return "*-1\r\n"
+		}
+
+		var b strings.Builder
+
+		b.WriteString("*" + strconv.Itoa(len(v)) + "\r\n")
+
+		for _, i := range v {
+			b.WriteString(encodeFakeRedisReply(i))
+		}
+
+		return b.String()
+	}
+
+	return "$-1\r\n"
+}
+
+func newTestRedisTransport(t *testing.T, srv *fakeRedisServer, maxLen uint64) *RedisTransport {
+	t.Helper()
+
+	transport, err := NewRedisTransport(NewSubscriberList(0), slog.Default(), "redis://:"+srv.password+"@"+srv.addr+"/1", "mercure", maxLen)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(t.Context()))
+	})
+
+	return transport
+}
+
+func TestRedisTransportFanOut(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeRedisServer(t, "secret")
+	publisher := newTestRedisTransport(t, srv, 0)
+	transport := newTestRedisTransport(t, srv, 0)
+
+	s := newTestSubscriber("", "https://example.com/books/1")
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	// Both hubs dispatch the updates of the stream to their subscribers.
+	u := &Update{Topic: "https://example.com/books/1", Event: Event{Data: "shared"}}
+	require.NoError(t, publisher.Dispatch(t.Context(), u))
+
+	received := <-s.Receive()
+	assert.Equal(t, u.ID, received.ID)
+	assert.Equal(t, "shared", received.Data)
+
+	lastEventID, subscribers, err := transport.GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, u.ID, lastEventID)
+	assert.Len(t, subscribers, 1)
+
+	require.NoError(t, transport.Ready(t.Context()))
+	require.NoError(t, transport.Live(t.Context()))
+
+	// The subscribers of the other hubs can't be disconnected.
+	assert.NotImplements(t, (*TransportDisconnecter)(nil), transport)
+
+	require.NoError(t, publisher.Close(t.Context()))
+	require.ErrorIs(t, publisher.Dispatch(t.Context(), u), ErrClosedTransport)
+}
+
+func TestRedisTransportHistory(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeRedisServer(t, "")
+	transport := newTestRedisTransport(t, srv, 0)
+
+	updates := []*Update{
+		{Topic: "https://example.com/books/1"},
+		{Topic: "https://example.com/books/2"},
+		{Topic: "https://example.com/books/1"},
+	}
+	require.NoError(t, transport.DispatchGroup(t.Context(), updates))
+
+	require.Eventually(t, func() bool {
+		lastEventID, _, _ := transport.GetSubscribers(t.Context())
+
+		return lastEventID == updates[2].ID
+	}, time.Second, time.Millisecond)
+
+	s := newTestSubscriber(updates[0].ID, "https://example.com/books/1")
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, updates[0].ID, <-s.responseLastEventID)
+	assert.Equal(t, updates[2].ID, (<-s.Receive()).ID)
+
+	s = newTestSubscriber(EarliestLastEventID, "https://example.com/books/1")
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+	assert.Equal(t, updates[0].ID, (<-s.Receive()).ID)
+	assert.Equal(t, updates[2].ID, (<-s.Receive()).ID)
+
+	// A hub started later knows the last event.
+	lastEventID, _, err := newTestRedisTransport(t, srv, 0).GetSubscribers(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, updates[2].ID, lastEventID)
+
+	var read []string
+	require.NoError(t, transport.ReadHistory(t.Context(), func(u *Update) error {
+		read = append(read, u.ID)
+
+		return nil
+	}))
+	assert.Equal(t, []string{updates[0].ID, updates[1].ID, updates[2].ID}, read)
+}
+
+func TestRedisTransportMaxLen(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeRedisServer(t, "")
+	transport := newTestRedisTransport(t, srv, 2)
+
+	for i := range 5 {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: fmt.Sprintf("https://example.com/books/%d", i)}))
+	}
+
+	srv.mu.Lock()
+	assert.Len(t, srv.entries, 2)
+	srv.mu.Unlock()
+}
+
+func TestRedisTransportReconnect(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeRedisServer(t, "")
+	transport := newTestRedisTransport(t, srv, 0)
+
+	s := newTestSubscriber("", "https://example.com/books/1")
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	srv.dropConnections()
+
+	// The update published while the hub reconnects is dispatched once it
+	// resumed reading after the last entry it dispatched.
+	u := &Update{Topic: "https://example.com/books/1"}
+	require.Eventually(t, func() bool {
+		return transport.Dispatch(t.Context(), u) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	assert.Equal(t, u.ID, (<-s.Receive()).ID)
+}
+
+func TestRedisTransportConcurrentClose(t *testing.T) {
+	t.Parallel()
+
+	transport := newTestRedisTransport(t, newFakeRedisServer(t, ""), 0)
+	testTransportConcurrentClose(t, transport)
+
+	// The dispatches racing with Close don't connect again.
+	transport.connMu.Lock()
+	defer transport.connMu.Unlock()
+
+	assert.Nil(t, transport.conn)
+}
+
+func TestRedisTransportErrors(t *testing.T) {
+	t.Parallel()
+
+	srv := newFakeRedisServer(t, "secret")
+
+	_, err := NewRedisTransport(NewSubscriberList(0), slog.Default(), "redis://:wrong@"+srv.addr, "", 0)
+	require.ErrorIs(t, err, errRedisServer)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	require.NoError(t, l.Close())
+
+	// The server may come back: the error is not a TransportError.
+	_, err = NewRedisTransport(NewSubscriberList(0), slog.Default(), "redis://"+l.Addr().String(), "", 0)
+
+	var te *TransportError
+
+	require.Error(t, err)
+	assert.NotErrorAs(t, err, &te)
+
+	_, err = NewRedisTransport(NewSubscriberList(0), slog.Default(), "redis://"+srv.addr+"/foo", "", 0)
+	require.ErrorAs(t, err, &te)
+}
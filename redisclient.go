@@ -0,0 +1,273 @@
+package mercure
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisDefaultPort is the port of Redis servers.
+const redisDefaultPort = "6379"
+
+var (
+	// errRedisServer is returned when the Redis server answers with an error.
+	errRedisServer = errors.New("redis server error")
+	// errRedisProtocol is returned when the reply of the Redis server can't
+	// be parsed.
+	errRedisProtocol = errors.New("invalid redis reply")
+)
+
+// redisOptions holds how to connect to a Redis server.
+type redisOptions struct {
+	addr     string
+	tls      bool
+	username string
+	password string
+	db       int
+}
+
+// parseRedisURL parses a redis://[[user]:password@]host[:port][/db] or
+// rediss:// URL.
+func parseRedisURL(u *url.URL) (redisOptions, error) {
+	o := redisOptions{addr: u.Host, tls: u.Scheme == "rediss"}
+
+	if u.Port() == "" {
+		o.addr = net.JoinHostPort(u.Hostname(), redisDefaultPort)
+	}
+
+	if u.User != nil {
+		o.username = u.User.Username()
+		o.password, _ = u.User.Password()
+	}
+
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		n, err := strconv.Atoi(db)
+		if err != nil || n < 0 {
+			return o, fmt.Errorf("invalid redis database %q", db)
+		}
+
+		o.db = n
+	}
+
+	return o, nil
+}
+
+// redisConn is a connection to a Redis server speaking RESP2, not safe for
+// concurrent use.
+type redisConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialRedis connects to the server, authenticates and selects the database.
+func dialRedis(ctx context.Context, o redisOptions) (*redisConn, error) {
+	var (
+		conn net.Conn
+		err  error
+	)
+
+	if o.tls {
+		conn, err = (&tls.Dialer{Config: &tls.Config{MinVersion: tls.VersionTLS12}}).DialContext(ctx, "tcp", o.addr)
+	} else {
+		conn, err = (&net.Dialer{}).DialContext(ctx, "tcp", o.addr)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to connect to redis: %w", err)
+	}
+
+	c := &redisConn{conn: conn, r: bufio.NewReader(conn)}
+
+	if o.password != "" {
+		args := []string{"AUTH", o.password}
+		if o.username != "" {
+			args = []string{"AUTH", o.username, o.password}
+		}
+
+		if _, err := c.command(ctx, args...); err != nil {
+			_ = conn.Close()
+
+			return nil, err
+		}
+	}
+
+	if o.db != 0 {
+		if _, err := c.command(ctx, "SELECT", strconv.Itoa(o.db)); err != nil {
+			_ = conn.Close()
+
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// do sends a command and reads its reply: nil, a string, an int64, an error
+// of the server wrapping errRedisServer, or a []any of them.
+func (c *redisConn) do(ctx context.Context, args ...string) (any, error) {
+	if err := c.send(ctx, args...); err != nil {
+		return nil, err
+	}
+
+	return c.receive()
+}
+
+// send writes a command, the deadline of ctx applying to it and to its reply.
+func (c *redisConn) send(ctx context.Context, args ...string) error {
+	deadline, _ := ctx.Deadline()
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		return fmt.Errorf("unable to set redis deadline: %w", err)
+	}
+
+	var b strings.Builder
+
+	b.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+
+	for _, a := range args {
+		b.WriteString("$" + strconv.Itoa(len(a)) + "\r\n" + a + "\r\n")
+	}
+
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return fmt.Errorf("unable to send redis command: %w", err)
+	}
+
+	return nil
+}
+
+// receive reads a reply.
+func (c *redisConn) receive() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("unable to read redis reply: %w", err)
+	}
+
+	if len(line) < 3 || !strings.HasSuffix(line, "\r\n") {
+		return nil, errRedisProtocol
+	}
+
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return value, nil
+	case '-':
+		return fmt.Errorf("%w: %s", errRedisServer, value), nil
+	case ':':
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, errRedisProtocol
+		}
+
+		return n, nil
+	case '$':
+		n, err := strconv.Atoi(value)
+		if err != nil || n < -1 {
+			return nil, errRedisProtocol
+		}
+
+		if n == -1 {
+			return nil, nil
+		}
+
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, fmt.Errorf("unable to read redis reply: %w", err)
+		}
+
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(value)
+		if err != nil || n < -1 {
+			return nil, errRedisProtocol
+		}
+
+		if n == -1 {
+			return nil, nil
+		}
+
+		items := make([]any, n)
+		for i := range items {
+			if items[i], err = c.receive(); err != nil {
+				return nil, err
+			}
+		}
+
+		return items, nil
+	default:
+		return nil, errRedisProtocol
+	}
+}
+
+// command runs a command, an error reply being returned as an error.
+func (c *redisConn) command(ctx context.Context, args ...string) (any, error) {
+	reply, err := c.do(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err, ok := reply.(error); ok {
+		return nil, err
+	}
+
+	return reply, nil
+}
+
+func (c *redisConn) close() error {
+	return c.conn.Close() //nolint:wrapcheck
+}
+
+// redisStreamEntry is an entry of a Redis stream.
+type redisStreamEntry struct {
+	id     string
+	fields map[string]string
+}
+
+// parseRedisStreamEntries parses the entries of an XRANGE reply, or of a
+// stream of an XREAD reply.
+func parseRedisStreamEntries(reply any) ([]redisStreamEntry, error) {
+	items, ok := reply.([]any)
+	if !ok && reply != nil {
+		return nil, errRedisProtocol
+	}
+
+	entries := make([]redisStreamEntry, 0, len(items))
+
+	for _, item := range items {
+		pair, ok := item.([]any)
+		if !ok || len(pair) != 2 {
+			return nil, errRedisProtocol
+		}
+
+		id, ok := pair[0].(string)
+		if !ok {
+			return nil, errRedisProtocol
+		}
+
+		// The fields of an entry deleted while pending are nil.
+		kv, _ := pair[1].([]any)
+		e := redisStreamEntry{id: id, fields: make(map[string]string, len(kv)/2)}
+
+		for i := 0; i+1 < len(kv); i += 2 {
+			k, _ := kv[i].(string)
+			v, _ := kv[i+1].(string)
+			e.fields[k] = v
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil
+}
+
+// redisTimeout returns the context for a command not blocking on the server.
+func redisTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, 5*time.Second)
+}
@@ -0,0 +1,67 @@
+package mercure
+
+import (
+	"context"
+	"strconv"
+	"time"
+)
+
+// redisIdempotencyKeySuffix is appended to the stream key to prefix the keys
+// holding the IDs of the updates published with an idempotency key.
+const redisIdempotencyKeySuffix = ":idempotency:"
+
+// RememberIdempotencyKey records the idempotency key in a Redis key expiring
+// after ttl, shared by all the hubs using the stream.
+func (t *RedisTransport) RememberIdempotencyKey(ctx context.Context, key, id string, ttl time.Duration) (string, bool, error) {
+	if isClosed(t.closed) {
+		return "", false, ErrClosedTransport
+	}
+
+	ctx, cancel := redisTimeout(ctx)
+	defer cancel()
+
+	redisKey := t.streamKey + redisIdempotencyKeySuffix + key
+	found := false
+
+	err := t.command(ctx, func(c *redisConn) error {
+		// The key may expire between SET and GET, hence the retry.
+		for {
+			reply, err := c.command(ctx, "SET", redisKey, id, "NX", "PX", strconv.FormatInt(max(ttl.Milliseconds(), 1), 10))
+			if err != nil || reply != nil {
+				return err
+			}
+
+			reply, err = c.command(ctx, "GET", redisKey)
+			if err != nil {
+				return err
+			}
+
+			if original, ok := reply.(string); ok {
+				found, id = true, original
+
+				return nil
+			}
+		}
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	return id, found, nil
+}
+
+// ForgetIdempotencyKey deletes the Redis key of the idempotency key.
+func (t *RedisTransport) ForgetIdempotencyKey(ctx context.Context, key string) error {
+	if isClosed(t.closed) {
+		return ErrClosedTransport
+	}
+
+	ctx, cancel := redisTimeout(ctx)
+	defer cancel()
+
+	return t.command(ctx, func(c *redisConn) error {
+		_, err := c.command(ctx, "DEL", t.streamKey+redisIdempotencyKeySuffix+key)
+
+		return err
+	})
+}
@@ -0,0 +1,121 @@
+package mercure
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// regexpSelectorPrefix marks a v8 topic selector, a `topic` query parameter
+// or a bare-string JWT claim, as a regular expression when the regexp matchers
+// are enabled.
+const regexpSelectorPrefix = "regexp:"
+
+// WithRegexpTopicMatchers enables the regexp matcher type: subscribers and JWT
+// claims can then select topics with a regular expression, with
+// `match_regexp=` or `{"match_type": "regexp"}`, or with a v8 selector
+// prefixed by "regexp:".
+//
+// The expressions use the RE2 syntax of the regexp package, whose matching
+// time is linear in the size of the topic, and are not anchored: "^" and "$"
+// must be used to match whole topics. They are disabled by default because
+// they can't be indexed: the subscribers using them are evaluated for every
+// update.
+func WithRegexpTopicMatchers() Option {
+	return func(o *opt) error {
+		o.regexpTopicMatchers = true
+
+		return nil
+	}
+}
+
+// enableRegexps allows the regexp matcher type on the store. It can't be
+// disabled afterwards: the hubs sharing the store could hold such matchers.
+func (tms *TopicMatcherStore) enableRegexps() {
+	tms.regexpsEnabled.Store(true)
+}
+
+// supportsMatcherType reports whether mt is addressable from the wire on the
+// hubs using the store: the protocol types, and the regexp type when enabled.
+func (tms *TopicMatcherStore) supportsMatcherType(mt MatcherType) bool {
+	if mt == MatcherTypeRegexp {
+		return tms.regexpsEnabled.Load()
+	}
+
+	return knownMatcherType(mt)
+}
+
+// v8Matcher returns the matcher of a v8 topic selector.
+func (tms *TopicMatcherStore) v8Matcher(selector string) TopicMatcher {
+	if tms.regexpsEnabled.Load() {
+		if pattern, ok := strings.CutPrefix(selector, regexpSelectorPrefix); ok {
+			return TopicMatcher{Type: MatcherTypeRegexp, Pattern: pattern}
+		}
+	}
+
+	return TopicMatcher{Type: deprecatedMatcherTypeName, Pattern: selector}
+}
+
+func (tms *TopicMatcherStore) matchRegexp(topics []string, pattern string) bool {
+	r, err := tms.getOrCompileRegexp(pattern)
+	if err != nil {
+		return false
+	}
+
+	return slices.ContainsFunc(topics, r.MatchString)
+}
+
+func (tms *TopicMatcherStore) getOrCompileRegexp(pattern string) (*regexp.Regexp, error) {
+	if !tms.regexpsEnabled.Load() {
+		return nil, ErrUnsupportedMatcherType
+	}
+
+	if tms.regexpCache != nil {
+		if cached, ok := tms.regexpCache.GetIfPresent(pattern); ok {
+			return cached, nil
+		}
+	}
+
+	r, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+
+	if tms.regexpCache != nil {
+		tms.regexpCache.Set(pattern, r)
+	}
+
+	return r, nil
+}
+
+// regexpIndexKey returns the key of the topic index of a regexp matcher.
+func regexpIndexKey(pattern string) (topicIndexKey, bool) {
+	prefix := regexpLiteralPrefix(pattern)
+	if prefix == "" {
+		return topicIndexKey{}, false
+	}
+
+	return topicIndexKey{topicIndexPrefix, prefix}, true
+}
+
+// regexpLiteralPrefix returns the literal beginning of the topics matched by
+// an expression anchored at the beginning of the text, or an empty string.
+func regexpLiteralPrefix(pattern string) string {
+	rest, ok := strings.CutPrefix(pattern, "^")
+	if !ok {
+		return ""
+	}
+
+	// Without the anchor, the literal prefix of the expression is the one of
+	// its matches, hence of the topics. An alternation drops it: in "^a|b",
+	// "b" can be anywhere.
+	r, err := regexp.Compile(rest)
+	if err != nil {
+		return ""
+	}
+
+	prefix, _ := r.LiteralPrefix()
+
+	return prefix
+}
@@ -0,0 +1,139 @@
+package mercure
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegexpMatcherDisabledByDefault(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(DefaultTopicMatcherStoreCacheSize)
+	require.NoError(t, err)
+
+	m := TopicMatcher{Type: MatcherTypeRegexp, Pattern: "^https://example\\.com/"}
+	require.ErrorIs(t, validateProtocolMatcher(tms, m), ErrUnsupportedMatcherType)
+	assert.False(t, tms.matches([]string{"https://example.com/books/1"}, m))
+
+	_, ok := matcherTypeFromParam(tms, "match_regexp")
+	assert.False(t, ok)
+	assert.Equal(t, TopicMatcher{Type: deprecatedMatcherTypeName, Pattern: "regexp:^a"}, tms.v8Matcher("regexp:^a"))
+}
+
+func TestRegexpMatcher(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(DefaultTopicMatcherStoreCacheSize)
+	require.NoError(t, err)
+	tms.enableRegexps()
+
+	m := TopicMatcher{Type: MatcherTypeRegexp, Pattern: "^https://example\\.com/(books|authors)/[0-9]+$"}
+	require.NoError(t, validateProtocolMatcher(tms, m))
+	assert.True(t, tms.matches([]string{"https://example.com/books/1"}, m))
+	assert.True(t, tms.matches([]string{"urn:example:1", "https://example.com/authors/2"}, m))
+	assert.False(t, tms.matches([]string{"https://example.com/books/1/reviews"}, m))
+
+	// Expressions are not anchored.
+	assert.True(t, tms.matches([]string{"https://example.com/books/1"}, TopicMatcher{Type: MatcherTypeRegexp, Pattern: "books"}))
+
+	require.Error(t, validateProtocolMatcher(tms, TopicMatcher{Type: MatcherTypeRegexp, Pattern: "(a"}))
+	require.Error(t, validateProtocolMatcher(tms, TopicMatcher{Type: MatcherTypeRegexp, Pattern: "(a)\\1"}), "backreferences are not supported by RE2")
+
+	stats := tms.Stats()[TopicMatcherCacheRegexp]
+	assert.Equal(t, 2, stats.Size)
+	assert.Positive(t, stats.Hits)
+
+	mt, ok := matcherTypeFromParam(tms, "match_regexp")
+	assert.True(t, ok)
+	assert.Equal(t, MatcherTypeRegexp, mt)
+	assert.Equal(t, TopicMatcher{Type: MatcherTypeRegexp, Pattern: "^a"}, tms.v8Matcher("regexp:^a"))
+	assert.Equal(t, TopicMatcher{Type: deprecatedMatcherTypeName, Pattern: "https://example.com/{id}"}, tms.v8Matcher("https://example.com/{id}"))
+}
+
+func TestRegexpLiteralPrefix(t *testing.T) {
+	t.Parallel()
+
+	for pattern, expected := range map[string]string{
+		"^https://example\\.com/books/[0-9]+": "https://example.com/books/",
+		"^https://example\\.com/(books|bots)": "https://example.com/bo",
+		"^ab+":                                "ab",
+		"^ab*":                                "a",
+		"^a|b":                                "",
+		"https://example\\.com/":              "",
+		"(?i)^https://":                       "",
+		"^(?i)https://":                       "",
+		"^^a":                                 "a",
+		"^(":                                  "",
+	} {
+		assert.Equal(t, expected, regexpLiteralPrefix(pattern), pattern)
+	}
+}
+
+func TestSubscribeRegexpMatcher(t *testing.T) {
+	t.Parallel()
+
+	query := "?match_regexp=" + url.QueryEscape("^https://example\\.com/books/")
+
+	w := newSubscribeRecorder()
+	createDummy(t, WithAnonymous()).SubscribeHandler(w, httptest.NewRequest(http.MethodGet, defaultHubURL+query, nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	hub := createDummy(t, WithAnonymous(), WithRegexpTopicMatchers())
+	server := httptest.NewServer(hub)
+	t.Cleanup(server.Close)
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, server.URL+defaultHubURL+query, nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/authors/1", Event: Event{Data: "author"}}))
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{Data: "book"}}))
+
+	var data []string
+
+	for sc := bufio.NewScanner(resp.Body); sc.Scan(); {
+		if d, ok := strings.CutPrefix(sc.Text(), "data: "); ok {
+			if data = append(data, d); d == "book" {
+				break
+			}
+		}
+	}
+
+	assert.Equal(t, []string{"book"}, data)
+}
+
+func FuzzRegexpIndexKey(f *testing.F) {
+	for _, tc := range [][2]string{
+		{"^https://example\\.com/books/[0-9]+", "https://example.com/books/1"},
+		{"^a|b", "b"},
+		{"^ab*c", "ac"},
+		{"^(a)(b)", "ab"},
+	} {
+		f.Add(tc[0], tc[1])
+	}
+
+	f.Fuzz(func(t *testing.T, pattern, topic string) {
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return
+		}
+
+		// The index must not miss a matching topic.
+		if k, ok := regexpIndexKey(pattern); ok && r.MatchString(topic) {
+			assert.True(t, strings.HasPrefix(topic, k.key), "%q matches %q without the prefix %q", pattern, topic, k.key)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// paramMaxReplayAge is the subscribe query parameter limiting, in seconds, the
+// age of the updates replayed from the history.
+const paramMaxReplayAge = "max-replay-age"
+
+// WithMaxReplayAge prevents replaying the updates of the history published
+// more than maxAge ago, even when the Last-Event-ID of a subscriber points
+// further back, protecting the hub from the clients reconnecting after weeks
+// offline. Subscribers can lower the limit with the max-replay-age query
+// parameter.
+//
+// Only the updates having an ID generated by the hub (see Update.AssignUUID)
+// can be dated: the others are always replayed.
+func WithMaxReplayAge(maxAge time.Duration) Option {
+	return func(o *opt) error {
+		o.maxReplayAge = maxAge
+
+		return nil
+	}
+}
+
+// replayTruncation is the data of the event telling a subscriber that updates
+// too old to be replayed have been skipped.
+type replayTruncation struct {
+	Type  string    `json:"type"`
+	Since time.Time `json:"since"`
+}
+
+// parseReplaySince returns the publication date before which the updates of
+// the history are not replayed to the subscriber, the zero time meaning no
+// limit.
+func (h *Hub) parseReplaySince(values url.Values) (time.Time, error) {
+	maxAge := h.maxReplayAge
+
+	if v := values.Get(paramMaxReplayAge); v != "" {
+		seconds, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return time.Time{}, err //nolint:wrapcheck
+		}
+
+		if d := time.Duration(seconds) * time.Second; maxAge == 0 || d < maxAge {
+			maxAge = d
+		}
+	}
+
+	if maxAge == 0 {
+		return time.Time{}, nil
+	}
+
+	return time.Now().Add(-maxAge), nil
+}
+
+// replayWindow skips, while replaying the history, the updates published before
+// ReplaySince, and tells the subscriber once about them.
+type replayWindow struct {
+	s             *LocalSubscriber
+	lastIDSkipped string
+}
+
+// skip reports whether u must not be replayed to the subscriber.
+func (w *replayWindow) skip(u *Update) bool {
+	if w.s.ReplaySince.IsZero() {
+		return false
+	}
+
+	published, ok := updateTime(u.ID)
+	if !ok || !published.Before(w.s.ReplaySince) {
+		return false
+	}
+
+	w.lastIDSkipped = u.ID
+
+	return true
+}
+
+// flush sends the truncation event, when updates have been skipped since the
+// last call, and reports whether the subscriber is still connected. The event
+// has the ID of the last skipped update, so the clients don't ask for the
+// skipped updates again when reconnecting.
+func (w *replayWindow) flush(ctx context.Context) bool {
+	if w.lastIDSkipped == "" {
+		return true
+	}
+
+	j, err := json.Marshal(replayTruncation{Type: "ReplayTruncated", Since: w.s.ReplaySince.UTC()})
+	if err != nil {
+		panic(err)
+	}
+
+	u := &Update{Event: Event{Data: string(j), ID: w.lastIDSkipped, Type: reservedEventType}}
+	w.lastIDSkipped = ""
+
+	return w.s.Dispatch(ctx, u, true)
+}
@@ -0,0 +1,58 @@
+package mercure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseReplaySince(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	since, err := hub.parseReplaySince(url.Values{})
+	require.NoError(t, err)
+	assert.True(t, since.IsZero())
+
+	since, err = hub.parseReplaySince(url.Values{paramMaxReplayAge: {"60"}})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-time.Minute), since, 5*time.Second)
+
+	hub = createAnonymousDummy(t, WithMaxReplayAge(time.Hour))
+
+	since, err = hub.parseReplaySince(url.Values{})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), since, 5*time.Second)
+
+	// Subscribers can only lower the limit.
+	since, err = hub.parseReplaySince(url.Values{paramMaxReplayAge: {"7200"}})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-time.Hour), since, 5*time.Second)
+
+	since, err = hub.parseReplaySince(url.Values{paramMaxReplayAge: {"60"}})
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(-time.Minute), since, 5*time.Second)
+
+	for _, v := range []string{"-1", "1h", "foo"} {
+		_, err = hub.parseReplaySince(url.Values{paramMaxReplayAge: {v}})
+		require.Error(t, err, v)
+	}
+}
+
+func TestSubscribeInvalidMaxReplayAge(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?topic=foo&"+paramMaxReplayAge+"=foo", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
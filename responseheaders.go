@@ -0,0 +1,171 @@
+package mercure
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+)
+
+// Endpoint identifies a group of hub endpoints response header rules apply to.
+type Endpoint string
+
+const (
+	// EndpointSubscribe is the subscribe endpoint.
+	EndpointSubscribe Endpoint = "subscribe"
+	// EndpointPublish is the publish endpoint, and the group and retract
+	// endpoints.
+	EndpointPublish Endpoint = "publish"
+	// EndpointSubscriptions is the subscription API.
+	EndpointSubscriptions Endpoint = "subscriptions"
+	// EndpointResourceMetadata is the OAuth 2.0 protected resource metadata
+	// endpoint.
+	EndpointResourceMetadata Endpoint = "resource_metadata"
+)
+
+// ErrInvalidResponseHeaderRule is returned by NewHub when a response header
+// rule is not valid.
+var ErrInvalidResponseHeaderRule = errors.New("invalid response header rule")
+
+// ResponseHeaderRule adds headers to the successful responses of some
+// endpoints, replacing the values set by the hub. It is typically used to give
+// a CDN the headers it keys its behavior off.
+type ResponseHeaderRule struct {
+	// Endpoints the rule applies to. The rule applies to all endpoints when
+	// empty.
+	Endpoints []Endpoint
+	// Matchers restricts the rule to subscriptions requesting at least one of
+	// these topic matchers, or a topic these matchers match. It is only
+	// allowed for rules applying to the subscribe endpoint alone.
+	Matchers []TopicMatcher
+	// Header holds the headers to set.
+	Header http.Header
+}
+
+// applies reports whether the rule applies to an endpoint, and to a
+// subscription requesting the given matchers.
+func (r ResponseHeaderRule) applies(tms *TopicMatcherStore, e Endpoint, requested []TopicMatcher) bool {
+	if len(r.Endpoints) != 0 && !slices.Contains(r.Endpoints, e) {
+		return false
+	}
+
+	if len(r.Matchers) == 0 {
+		return true
+	}
+
+	for _, req := range requested {
+		for _, m := range r.Matchers {
+			if req == m || (req.Type == MatcherTypeExact && tms.matches([]string{req.Pattern}, m)) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// WithResponseHeaders sets rules adding headers to the responses of the hub.
+// Rules are applied in order, so a later rule replaces the headers of an
+// earlier one.
+func WithResponseHeaders(rules ...ResponseHeaderRule) Option {
+	return func(o *opt) error {
+		o.responseHeaderRules = rules
+
+		return nil
+	}
+}
+
+// validateResponseHeaderRules checks the rules once the topic matcher store is
+// configured.
+func (o *opt) validateResponseHeaderRules() error {
+	for i, r := range o.responseHeaderRules {
+		for _, e := range r.Endpoints {
+			switch e {
+			case EndpointSubscribe, EndpointPublish, EndpointSubscriptions, EndpointResourceMetadata:
+			default:
+				return fmt.Errorf("%w %d: unknown endpoint %q", ErrInvalidResponseHeaderRule, i, e)
+			}
+		}
+
+		if len(r.Matchers) == 0 {
+			continue
+		}
+
+		if !slices.Equal(r.Endpoints, []Endpoint{EndpointSubscribe}) {
+			return fmt.Errorf("%w %d: matchers are only allowed for the %q endpoint", ErrInvalidResponseHeaderRule, i, EndpointSubscribe)
+		}
+
+		for _, m := range r.Matchers {
+			if err := validateProtocolMatcher(o.topicMatcherStore, m); err != nil {
+				return fmt.Errorf("%w %d: %q: %w", ErrInvalidResponseHeaderRule, i, m.Pattern, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// setResponseHeaders sets the headers of the rules applying to the endpoint
+// and the requested matchers.
+func (h *Hub) setResponseHeaders(header http.Header, e Endpoint, requested []TopicMatcher) {
+	for _, r := range h.responseHeaderRules {
+		if !r.applies(h.topicMatcherStore, e, requested) {
+			continue
+		}
+
+		for k, v := range r.Header {
+			header[http.CanonicalHeaderKey(k)] = v
+		}
+	}
+}
+
+// withResponseHeaders wraps the handler of an endpoint to set the headers of
+// the rules applying to it, if any. The subscribe endpoint sets them itself,
+// once the requested matchers are known (see sendHeaders).
+func (h *Hub) withResponseHeaders(e Endpoint, next http.HandlerFunc) http.HandlerFunc {
+	if !slices.ContainsFunc(h.responseHeaderRules, func(r ResponseHeaderRule) bool {
+		return len(r.Endpoints) == 0 || slices.Contains(r.Endpoints, e)
+	}) {
+		return next
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		next(&headerResponseWriter{ResponseWriter: w, hub: h, endpoint: e}, r)
+	}
+}
+
+// headerResponseWriter sets the rule headers right before the status code is
+// written, so they replace the values set by the handler. Error responses are
+// left untouched.
+type headerResponseWriter struct {
+	http.ResponseWriter
+
+	hub         *Hub
+	endpoint    Endpoint
+	wroteHeader bool
+}
+
+func (w *headerResponseWriter) WriteHeader(statusCode int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+
+		if statusCode < http.StatusBadRequest {
+			w.hub.setResponseHeaders(w.Header(), w.endpoint, nil)
+		}
+	}
+
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *headerResponseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	return w.ResponseWriter.Write(b) //nolint:wrapcheck
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer.
+func (w *headerResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
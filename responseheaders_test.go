@@ -0,0 +1,97 @@
+package mercure
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseHeadersSubscribe(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithResponseHeaders(
+		ResponseHeaderRule{Header: http.Header{"x-vendor": {"mercure"}}},
+		ResponseHeaderRule{
+			Endpoints: []Endpoint{EndpointSubscribe},
+			Matchers:  []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/public/*"}},
+			Header:    http.Header{"Cache-Control": {"public, max-age=1"}},
+		},
+	))
+
+	for topic, cacheControl := range map[string]string{
+		"https://example.com/public/1":  "public, max-age=1",
+		"https://example.com/private/1": headerCacheControl[0],
+	} {
+		ctx, cancel := context.WithCancel(t.Context())
+		w := newSubscribeRecorder()
+
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match="+url.QueryEscape(topic), nil).WithContext(ctx)
+			hub.SubscribeHandler(w, req)
+		})
+
+		waitSubscribers(t, hub.transport.(*LocalTransport), 1)
+		cancel()
+		wg.Wait()
+
+		assert.Equal(t, cacheControl, w.Header().Get("Cache-Control"))
+		assert.Equal(t, "mercure", w.Header().Get("X-Vendor"))
+		assert.Equal(t, "text/event-stream", w.Header().Get("Content-Type"))
+	}
+}
+
+func TestResponseHeadersPublish(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithResponseHeaders(
+		ResponseHeaderRule{Endpoints: []Endpoint{EndpointPublish}, Header: http.Header{"Cache-Control": {"no-store"}}},
+		ResponseHeaderRule{Endpoints: []Endpoint{EndpointSubscriptions}, Header: http.Header{"X-Other": {"1"}}},
+	))
+
+	publish := func(token string) *http.Response {
+		form := url.Values{"topic": {"https://example.com/books/1"}, "data": {"foo"}}
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", bearerPrefix+token)
+
+		w := httptest.NewRecorder()
+		hub.ServeHTTP(w, req)
+
+		return w.Result()
+	}
+
+	resp := publish(createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+	assert.Empty(t, resp.Header.Get("X-Other"))
+
+	// Error responses are left untouched.
+	resp = publish(createDummyUnauthorizedJWT())
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.Empty(t, resp.Header.Get("Cache-Control"))
+}
+
+func TestResponseHeadersInvalidRules(t *testing.T) {
+	t.Parallel()
+
+	for _, r := range []ResponseHeaderRule{
+		{Endpoints: []Endpoint{"foo"}},
+		{Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "foo"}}},
+		{Endpoints: []Endpoint{EndpointSubscribe}, Matchers: []TopicMatcher{{Type: "foo", Pattern: "foo"}}},
+	} {
+		_, err := NewHub(t.Context(), WithResponseHeaders(r))
+		assert.ErrorIs(t, err, ErrInvalidResponseHeaderRule)
+	}
+}
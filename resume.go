@@ -0,0 +1,203 @@
+package mercure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// paramResumeToken is the subscribe query parameter resuming a subscription
+// parked by WithResumeGracePeriod.
+const paramResumeToken = "resume_token"
+
+// ErrInvalidResumeGracePeriod is returned by WithResumeGracePeriod when the
+// grace period isn't positive.
+var ErrInvalidResumeGracePeriod = errors.New("the resume grace period must be positive")
+
+// WithResumeGracePeriod keeps, during the grace period, the subscriptions of
+// the SSE subscribers whose connection has been lost, so that clients going
+// through a brief network blip, mobile ones typically, resume them at once,
+// without relying on the history nor missing any private update.
+//
+// When a connection opens, the hub sends an event of the reserved "mercure"
+// type holding a single-use resume token. When the client goes away, or when
+// a write fails, the subscriber stays registered with the transport, and its
+// updates are buffered (see WithSubscriberBuffer). A subscribe request
+// passing the token in the resume_token query parameter before the end of the
+// grace period gets the subscription back, with its selectors and its
+// authorization, and the buffered updates: the other parameters and the
+// credentials of the request are ignored. Otherwise, the request is handled
+// as a new subscription, and the parked one is removed.
+//
+// The subscriptions closed by the hub, when the token expires or when the
+// subscriber is too slow for instance, aren't kept. The parked subscriptions
+// live in the memory of the hub that served them: in a cluster, the clients
+// must resume on the same node.
+func WithResumeGracePeriod(d time.Duration) Option {
+	return func(o *opt) error {
+		if d <= 0 {
+			return ErrInvalidResumeGracePeriod
+		}
+
+		o.resumes = &resumes{grace: d, parked: make(map[string]*parkedSubscriber)}
+
+		return nil
+	}
+}
+
+// resumes holds the parked subscriptions, by resume token.
+type resumes struct {
+	grace time.Duration
+
+	sync.Mutex
+	parked map[string]*parkedSubscriber
+}
+
+// parkedSubscriber is a subscriber whose connection has been lost.
+type parkedSubscriber struct {
+	subscriber *LocalSubscriber
+	// pending is the update whose write failed, sent first on resume.
+	pending *Update
+	// ctx is the context of the lost connection, without its cancellation.
+	ctx     context.Context //nolint:containedctx
+	resumed chan struct{}
+}
+
+// resume is the data of the resume events.
+type resume struct {
+	Type  string `json:"type"`
+	Token string `json:"token"`
+	// Resumed is true when the connection resumed a parked subscription.
+	Resumed bool `json:"resumed"`
+	// GracePeriod is the time the subscription is kept after the connection
+	// is lost, in milliseconds.
+	GracePeriod int64 `json:"grace_period"`
+}
+
+// newResumeToken generates a resume token.
+func newResumeToken() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// resumeEvent returns the event giving its resume token to the subscriber.
+func (h *Hub) resumeEvent(token string, resumed bool) string {
+	j, err := json.Marshal(resume{Type: "Resume", Token: token, Resumed: resumed, GracePeriod: h.resumes.grace.Milliseconds()})
+	if err != nil {
+		panic(err)
+	}
+
+	return "event: " + reservedEventType + "\ndata: " + string(j) + "\n\n"
+}
+
+// parkSubscriber keeps the subscription of the subscriber during the grace
+// period, when its connection has been lost. It reports whether the
+// subscriber has been parked: it must be shut down otherwise.
+func (h *Hub) parkSubscriber(ctx context.Context, s *LocalSubscriber, token string, reason DisconnectReason, pending *Update) bool {
+	if h.resumes == nil || token == "" || h.ctx.Err() != nil || s.disconnected.Load() > 0 {
+		return false
+	}
+
+	switch reason {
+	case DisconnectReasonClient, DisconnectReasonWriteFailed:
+	default:
+		return false
+	}
+
+	p := &parkedSubscriber{subscriber: s, pending: pending, ctx: context.WithoutCancel(ctx), resumed: make(chan struct{})}
+
+	h.resumes.Lock()
+	h.resumes.parked[token] = p
+	h.resumes.Unlock()
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Subscriber parked", slog.String("reason", string(reason)))
+	}
+
+	go func() {
+		t := time.NewTimer(h.resumes.grace)
+		defer t.Stop()
+
+		select {
+		case <-p.resumed:
+			return
+		case <-t.C:
+		case <-h.ctx.Done():
+			reason = DisconnectReasonHubShutdown
+		}
+
+		if h.unparkSubscriber(token) != nil {
+			h.shutdown(p.ctx, s, reason)
+		}
+	}()
+
+	return true
+}
+
+// unparkSubscriber removes the parked subscriber of the resume token, if any.
+func (h *Hub) unparkSubscriber(token string) *parkedSubscriber {
+	h.resumes.Lock()
+	defer h.resumes.Unlock()
+
+	p, ok := h.resumes.parked[token]
+	if !ok {
+		return nil
+	}
+
+	delete(h.resumes.parked, token)
+
+	return p
+}
+
+// resumeSubscriber gives back the subscriber parked with the resume token of
+// the request, if any, after sending the headers of the stream. It returns nil
+// when the request must be handled as a new subscription.
+func (h *Hub) resumeSubscriber(ctx context.Context, w http.ResponseWriter, r *http.Request) (*LocalSubscriber, *responseController, *Update) {
+	if h.resumes == nil || r.Method != http.MethodGet {
+		return nil, nil, nil
+	}
+
+	token := r.URL.Query().Get(paramResumeToken)
+	if token == "" {
+		return nil, nil, nil
+	}
+
+	p := h.unparkSubscriber(token)
+	if p == nil {
+		return nil, nil, nil
+	}
+
+	close(p.resumed)
+
+	s := p.subscriber
+	if s.disconnected.Load() > 0 || (s.Claims != nil && s.Claims.ExpiresAt != nil && !s.Claims.ExpiresAt.After(time.Now())) {
+		// Too slow while parked, or not authorized anymore: the reason is
+		// ignored when the subscriber has already been disconnected.
+		h.shutdown(p.ctx, s, DisconnectReasonTokenExpired)
+
+		return nil, nil, nil
+	}
+
+	h.setStreamHeaders(w.Header(), s, false)
+
+	if _, err := w.Write([]byte{':', '\n'}); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write comment", slog.Any("error", err))
+	}
+
+	rc := h.newResponseController(w, s)
+	rc.flush(ctx)
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Subscriber resumed")
+	}
+
+	return s, rc, p.pending
+}
@@ -0,0 +1,130 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var resumeEventRegexp = regexp.MustCompile(`event: mercure\ndata: (\{"type":"Resume".*\})\n\n`)
+
+// resumeEventOf returns the resume event of a subscription.
+func resumeEventOf(t *testing.T, body string) resume {
+	t.Helper()
+
+	m := resumeEventRegexp.FindStringSubmatch(body)
+	require.NotNil(t, m, body)
+
+	var r resume
+	require.NoError(t, json.Unmarshal([]byte(m[1]), &r))
+
+	return r
+}
+
+func TestWithResumeGracePeriodInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithResumeGracePeriod(0))
+	require.ErrorIs(t, err, ErrInvalidResumeGracePeriod)
+}
+
+func TestSubscribeResume(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithResumeGracePeriod(time.Minute))
+	transport := hub.transport.(*LocalTransport)
+
+	body := subscribeUntilDisconnected(t, hub, func(cancel context.CancelFunc) {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	})
+
+	first := resumeEventOf(t, body)
+	assert.False(t, first.Resumed)
+	assert.Equal(t, int64(60000), first.GracePeriod)
+
+	// Parked: still receiving the updates.
+	waitSubscribers(t, transport, 1)
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: "a", Data: "missed"}}))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?resume_token="+first.Token, nil).WithContext(ctx)
+	w := newSubscribeRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	body = w.Body.String()
+	second := resumeEventOf(t, body)
+	assert.True(t, second.Resumed)
+	assert.NotEqual(t, first.Token, second.Token)
+	assert.Contains(t, body, "id: a\ndata: missed\n\n")
+
+	// The tokens are single-use.
+	assert.Nil(t, hub.unparkSubscriber(first.Token))
+	assert.NotNil(t, hub.unparkSubscriber(second.Token))
+}
+
+func TestSubscribeResumeExpired(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithResumeGracePeriod(10*time.Millisecond))
+	transport := hub.transport.(*LocalTransport)
+
+	body := subscribeUntilDisconnected(t, hub, func(cancel context.CancelFunc) {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	})
+	token := resumeEventOf(t, body).Token
+
+	waitSubscribers(t, transport, 0)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1&resume_token="+token, nil).WithContext(ctx)
+	w := newSubscribeRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	waitSubscribers(t, transport, 1)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	<-done
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, resumeEventOf(t, w.Body.String()).Resumed)
+}
+
+func TestSubscribeNotParkedWhenClosedByTheHub(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithResumeGracePeriod(time.Minute))
+
+	subscribeUntilDisconnected(t, hub, func(context.CancelFunc) {
+		time.Sleep(50 * time.Millisecond)
+		_, err := hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Topics: []string{"https://example.com/books/1"}}, false)
+		assert.NoError(t, err)
+	})
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+	assert.Empty(t, hub.resumes.parked)
+}
@@ -0,0 +1,253 @@
+package mercure
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/maypok86/otter/v2"
+)
+
+const (
+	// paramWithSnapshot is the subscribe query parameter asking the hub to
+	// send the retained values of the subscribed topics before the live
+	// updates.
+	paramWithSnapshot = "with-snapshot"
+	// defaultRetainedValuesMaxTopics is the number of topics whose value the
+	// hub retains when RetainedValues.MaxTopics is not set.
+	defaultRetainedValuesMaxTopics = 10_000
+)
+
+var (
+	// ErrInvalidRetainedValues is returned by NewHub when the retained values
+	// configuration is not valid.
+	ErrInvalidRetainedValues = errors.New("invalid retained values configuration")
+	// errInvalidWithSnapshot is returned when the with-snapshot subscribe
+	// parameter is not a boolean.
+	errInvalidWithSnapshot = errors.New(`invalid "with-snapshot" parameter`)
+)
+
+// RetainedValues makes the hub remember the last update published on each
+// topic these matchers match, its retained value. Subscribers passing the
+// with-snapshot=true query parameter receive the retained values of the
+// topics they subscribe to, and are authorized to receive, as their first
+// events, before the live updates: clients don't have to fetch the state of
+// the resources with a separate request, racing with the updates published
+// meanwhile.
+//
+// The values are retained by the hub receiving the publication: the updates
+// received from other hubs through the transport are not. The snapshot is not
+// sent to the subscribers reconnecting with a Last-Event-ID, which get the
+// history instead.
+type RetainedValues struct {
+	// Matchers selects the topics whose last update is retained.
+	Matchers []TopicMatcher
+	// MaxTopics is the number of topics whose value the hub retains, the
+	// least recently used ones being forgotten, 10000 by default.
+	MaxTopics int
+}
+
+// retainedStore holds the retained values.
+type retainedStore struct {
+	RetainedValues
+
+	values *otter.Cache[string, *Update]
+	// sequence numbers the publications, to tell the live updates a snapshot
+	// already includes.
+	sequence atomic.Uint64
+}
+
+// WithRetainedValues retains the last update of some topics, to send them to
+// the subscribers requesting a snapshot.
+func WithRetainedValues(r RetainedValues) Option {
+	return func(o *opt) error {
+		o.retained = &retainedStore{RetainedValues: r}
+
+		return nil
+	}
+}
+
+// validateRetainedValues checks the configuration once the topic matcher
+// store is configured, and creates the store of the retained values.
+func (o *opt) validateRetainedValues() error {
+	s := o.retained
+	if s == nil {
+		return nil
+	}
+
+	if len(s.Matchers) == 0 {
+		return fmt.Errorf("%w: missing matchers", ErrInvalidRetainedValues)
+	}
+
+	for _, m := range s.Matchers {
+		if err := validateProtocolMatcher(o.topicMatcherStore, m); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrInvalidRetainedValues, m.Pattern, err)
+		}
+	}
+
+	if s.MaxTopics < 0 {
+		return fmt.Errorf("%w: negative max topics", ErrInvalidRetainedValues)
+	}
+
+	if s.MaxTopics == 0 {
+		s.MaxTopics = defaultRetainedValuesMaxTopics
+	}
+
+	var err error
+	if s.values, err = otter.New(&otter.Options[string, *Update]{MaximumSize: s.MaxTopics}); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidRetainedValues, err)
+	}
+
+	return nil
+}
+
+func (s *retainedStore) matches(tms *TopicMatcherStore, u *Update) bool {
+	topics := u.topics()
+	for _, m := range s.Matchers {
+		if tms.matches(topics, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sequence numbers the updates before their dispatch, so the subscribers
+// requesting a snapshot can skip the live updates it already includes.
+func (h *Hub) sequence(updates ...*Update) {
+	s := h.retained
+	if s == nil {
+		return
+	}
+
+	for _, u := range updates {
+		u.sequence = s.sequence.Add(1)
+	}
+}
+
+// retain stores the dispatched updates as the last state of their topic.
+func (h *Hub) retain(updates ...*Update) {
+	if h.jsonPatch != nil {
+		h.jsonPatch.retain(h.topicMatcherStore, updates)
+	}
+
+	s := h.retained
+	if s == nil {
+		return
+	}
+
+	for _, u := range updates {
+		if !s.matches(h.topicMatcherStore, u) {
+			continue
+		}
+
+		if u.report != nil {
+			u.report.retained = true
+		}
+
+		// Concurrent publications on the same topic may be retained out of
+		// order.
+		s.values.Compute(u.Topic, func(old *Update, found bool) (*Update, otter.ComputeOp) {
+			if found && old.sequence > u.sequence {
+				return old, otter.CancelOp
+			}
+
+			return u, otter.WriteOp
+		})
+	}
+}
+
+// forget removes the retained value of the topic of u if it is u, for
+// instance when u is retracted.
+func (h *Hub) forget(u *Update) {
+	s := h.retained
+	if s == nil {
+		return
+	}
+
+	s.values.ComputeIfPresent(u.Topic, func(old *Update) (*Update, otter.ComputeOp) {
+		if old.ID == u.ID {
+			return nil, otter.InvalidateOp
+		}
+
+		return old, otter.CancelOp
+	})
+}
+
+// snapshot returns the retained values the subscriber can receive, in
+// publication order.
+func (h *Hub) snapshot(s *LocalSubscriber) []*Update {
+	r := h.retained
+	if r == nil {
+		return nil
+	}
+
+	var updates []*Update
+
+	for _, u := range r.values.All() {
+		if s.Match(u) && !s.staleStateVersion(u) {
+			updates = append(updates, u)
+		}
+	}
+
+	slices.SortFunc(updates, func(a, b *Update) int {
+		return cmp.Compare(a.sequence, b.sequence)
+	})
+
+	return updates
+}
+
+// parseWithSnapshot reads the with-snapshot subscribe query parameter.
+func parseWithSnapshot(values url.Values) (bool, error) {
+	v := values.Get(paramWithSnapshot)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errInvalidWithSnapshot
+	}
+
+	return b, nil
+}
+
+// snapshotFilter skips the live updates older than, or equal to, the retained
+// values a subscriber received in its snapshot: they were published while
+// the subscriber was being added.
+type snapshotFilter map[string]uint64
+
+func newSnapshotFilter(snapshot []*Update) snapshotFilter {
+	if len(snapshot) == 0 {
+		return nil
+	}
+
+	f := make(snapshotFilter, len(snapshot))
+	for _, u := range snapshot {
+		f[u.Topic] = u.sequence
+	}
+
+	return f
+}
+
+// skip reports whether the snapshot already includes u.
+func (f snapshotFilter) skip(u *Update) bool {
+	seq, ok := f[u.Topic]
+	if !ok {
+		return false
+	}
+
+	if u.sequence > seq {
+		// The next updates of the topic are newer too.
+		delete(f, u.Topic)
+
+		return false
+	}
+
+	// The updates received from other hubs are not numbered.
+	return u.sequence != 0
+}
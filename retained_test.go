@@ -0,0 +1,84 @@
+package mercure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRetainedValuesInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, r := range []RetainedValues{
+		{},
+		{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/{"}}},
+		{Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/books/1"}}, MaxTopics: -1},
+	} {
+		_, err := NewHub(t.Context(), WithRetainedValues(r))
+		require.ErrorIs(t, err, ErrInvalidRetainedValues, "%+v", r)
+	}
+}
+
+func TestSubscribeWithSnapshot(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithRetainedValues(RetainedValues{
+		Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/:id"}},
+	}))
+
+	publish := func(u *Update) {
+		require.NoError(t, hub.Publish(t.Context(), u))
+	}
+
+	publish(&Update{Topic: "https://example.com/books/1", Event: Event{Data: "Dune"}})
+	publish(&Update{Topic: "https://example.com/books/2", Event: Event{Data: "Hyperion"}})
+	publish(&Update{Topic: "https://example.com/books/1", Event: Event{Data: "Dune Messiah"}})
+	// Not authorized.
+	publish(&Update{Topic: "https://example.com/books/3", Private: true, Event: Event{Data: "Foundation"}})
+	// Not retained.
+	publish(&Update{Topic: "https://example.com/books/1/reviews", Event: Event{Data: "Great"}})
+
+	snapshot := booksSubscription(t, hub, "&"+paramWithSnapshot+"=true", 1)
+	live := booksSubscription(t, hub, "", 2)
+
+	// Sent once, from the snapshot or live.
+	publish(&Update{Topic: "https://example.com/books/4", Event: Event{Data: "Ubik"}})
+
+	assert.Equal(t, []string{"Hyperion", "Dune Messiah", "Ubik"}, snapshot())
+	assert.Equal(t, []string{"Ubik"}, live())
+}
+
+func TestSnapshotFilter(t *testing.T) {
+	t.Parallel()
+
+	f := newSnapshotFilter([]*Update{{Topic: "https://example.com/books/1", sequence: 2}})
+
+	assert.True(t, f.skip(&Update{Topic: "https://example.com/books/1", sequence: 1}))
+	assert.True(t, f.skip(&Update{Topic: "https://example.com/books/1", sequence: 2}))
+	assert.False(t, f.skip(&Update{Topic: "https://example.com/books/1"}))
+	assert.False(t, f.skip(&Update{Topic: "https://example.com/books/2", sequence: 1}))
+	assert.False(t, f.skip(&Update{Topic: "https://example.com/books/1", sequence: 3}))
+	// Newer than the snapshot.
+	assert.False(t, f.skip(&Update{Topic: "https://example.com/books/1", sequence: 1}))
+}
+
+func TestSubscribeInvalidWithSnapshot(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?topic=foo&"+paramWithSnapshot+"=maybe", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	resp := w.Result()
+
+	t.Cleanup(func() {
+		require.NoError(t, resp.Body.Close())
+	})
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
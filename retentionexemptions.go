@@ -0,0 +1,84 @@
+package mercure
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+var (
+	// ErrInvalidRetentionExemptions is returned by NewHub when a matcher of
+	// the retention exemptions is not valid.
+	ErrInvalidRetentionExemptions = errors.New("invalid retention exemptions")
+	// ErrRetentionExemptionsNotSupported is returned by NewHub when the
+	// transport can't enforce the retention exemptions.
+	ErrRetentionExemptionsNotSupported = errors.New("the transport doesn't support retention exemptions")
+)
+
+// RetentionExemptions overrides the retention of the history for compliance
+// topics.
+type RetentionExemptions struct {
+	// Exempt selects the topics whose updates are never removed from the
+	// history automatically, by the size limit, the retention policies, the
+	// TTLs, the expiration dates or the compaction, typically to satisfy
+	// audit-retention requirements. They can still be retracted.
+	Exempt []TopicMatcher
+	// Forbidden selects the topics whose updates are never persisted: they
+	// are only dispatched to the connected subscribers, typically to satisfy
+	// privacy requirements. Forbidden takes precedence over Exempt.
+	Forbidden []TopicMatcher
+}
+
+// TransportRetentionExemptions may be implemented by transports able to
+// enforce retention exemptions, see WithRetentionExemptions.
+type TransportRetentionExemptions interface {
+	// SetRetentionExemptions configures the exemptions, matched against the
+	// topics of the updates with the topic matcher store of the transport. An
+	// error wrapping ErrRetentionExemptionsNotSupported is returned if the
+	// transport can't enforce them.
+	SetRetentionExemptions(e RetentionExemptions) error
+}
+
+// WithRetentionExemptions marks topics as retention-exempt, never purged from
+// the history automatically, or retention-forbidden, never persisted. The
+// transport must implement TransportRetentionExemptions.
+func WithRetentionExemptions(e RetentionExemptions) Option {
+	return func(o *opt) error {
+		o.retentionExemptions = &e
+
+		return nil
+	}
+}
+
+// configureRetentionExemptions validates the exemptions and passes them to
+// the transport, which must have received the topic matcher store.
+func (o *opt) configureRetentionExemptions() error {
+	e := o.retentionExemptions
+	if e == nil {
+		return nil
+	}
+
+	for _, m := range slices.Concat(e.Exempt, e.Forbidden) {
+		if err := validateProtocolMatcher(o.topicMatcherStore, m); err != nil {
+			return fmt.Errorf("%w: %q: %w", ErrInvalidRetentionExemptions, m.Pattern, err)
+		}
+	}
+
+	t, ok := o.transport.(TransportRetentionExemptions)
+	if !ok {
+		return ErrRetentionExemptionsNotSupported
+	}
+
+	return t.SetRetentionExemptions(*e) //nolint:wrapcheck
+}
+
+// matchesAny reports whether one of the matchers matches one of the topics.
+func (tms *TopicMatcherStore) matchesAny(topics []string, matchers []TopicMatcher) bool {
+	for _, m := range matchers {
+		if tms.matches(topics, m) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,30 @@
+package mercure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithRetentionExemptions(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithRetentionExemptions(RetentionExemptions{
+		Forbidden: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/presence"}},
+	}))
+	require.NoError(t, err)
+
+	_, err = NewHub(t.Context(), WithRetentionExemptions(RetentionExemptions{
+		Exempt: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/audit"}},
+	}))
+	require.ErrorIs(t, err, ErrRetentionExemptionsNotSupported)
+
+	_, err = NewHub(t.Context(), WithRetentionExemptions(RetentionExemptions{
+		Exempt: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/{"}},
+	}))
+	require.ErrorIs(t, err, ErrInvalidRetentionExemptions)
+
+	_, err = NewHub(t.Context(), WithTransport(&addSubscriberErrorTransport{}), WithRetentionExemptions(RetentionExemptions{}))
+	assert.ErrorIs(t, err, ErrRetentionExemptionsNotSupported)
+}
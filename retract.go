@@ -0,0 +1,232 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// retractURL is the endpoint allowing publishers to retract an update.
+const retractURL = defaultHubURL + "/retract"
+
+// ErrRetractionNotSupported is returned by Retract when the transport does not
+// implement TransportRetracter.
+var ErrRetractionNotSupported = errors.New("the transport does not support retracting updates")
+
+// retraction is the payload of the update announcing that an update has been
+// retracted.
+type retraction struct {
+	Type      string `json:"type"`
+	Retracted string `json:"retracted"`
+}
+
+// Retract withdraws a previously published update, to fix an erroneous
+// broadcast. The update is omitted from history replay from now on, and a
+// retraction update is dispatched on the same topics, with the same privacy, so
+// subscribers that already received it can discard it. The retraction update
+// uses the reserved "mercure" event type and its data is a JSON document of
+// type "Retraction" holding the ID of the retracted update.
+//
+// The update must still be in the history, otherwise ErrUpdateNotFound is
+// returned. The transport must implement TransportRetracter, otherwise
+// ErrRetractionNotSupported is returned. Authorization is the caller's
+// responsibility.
+func (h *Hub) Retract(ctx context.Context, id string) (*Update, error) {
+	tr, ok := h.transport.(TransportRetracter)
+	if !ok {
+		return nil, ErrRetractionNotSupported
+	}
+
+	u, err := tr.RetractableUpdate(ctx, id)
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return h.retract(ctx, tr, u)
+}
+
+// retract dispatches the retraction of u.
+func (h *Hub) retract(ctx context.Context, tr TransportRetracter, u *Update) (*Update, error) {
+	ctx, span := startSpan(ctx, "mercure.retract", trace.WithSpanKind(trace.SpanKindProducer))
+	defer span.End()
+
+	if span.IsRecording() {
+		span.SetAttributes(attribute.String("mercure.retracted.id", u.ID))
+	}
+
+	r := newRetraction(u)
+	r.Debug = h.debug
+
+	h.trackTopics(r)
+
+	unlock := h.lockTopics(r)
+	err := tr.Retract(ctx, u.ID, r)
+
+	if err == nil {
+		h.recordLastEventIDs(r)
+	}
+
+	unlock()
+
+	if err != nil {
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to retract update", slog.String("retracted", u.ID), slog.Any("error", err))
+		}
+
+		h.recordDispatchError(err)
+		recordSpanError(span, err)
+
+		return nil, err //nolint:wrapcheck
+	}
+
+	h.forget(u)
+	h.metrics.UpdatePublished(r)
+
+	if h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Update retracted", slog.String("retracted", u.ID), slog.Any("update", r))
+	}
+
+	return r, nil
+}
+
+// newRetraction creates the update announcing the retraction of u.
+func newRetraction(u *Update) *Update {
+	j, err := json.Marshal(retraction{Type: "Retraction", Retracted: u.ID})
+	if err != nil {
+		panic(err)
+	}
+
+	// Dispatched without Update.Validate, which rejects the reserved event
+	// type: the topics come from the history, where they were validated when
+	// the retracted update was published, and the data is hub-built.
+	r := &Update{
+		Private: u.Private,
+		Event:   Event{Data: string(j), Type: reservedEventType},
+	}
+	r.setTopics(u.topics())
+
+	return r
+}
+
+// RetractHandler allows publishers to retract an update. The ID of the update
+// is read from the "id" form field, and the response body is the ID of the
+// retraction update.
+//
+// The token must grant publishing the retracted update.
+func (h *Hub) RetractHandler(w http.ResponseWriter, r *http.Request) {
+	ctx, span := startSpan(r.Context(), "mercure.retract.request", trace.WithSpanKind(trace.SpanKindServer))
+	defer span.End()
+
+	r = r.WithContext(ctx)
+
+	tr, ok := h.transport.(TransportRetracter)
+	if !ok {
+		http.NotFound(w, r)
+
+		return
+	}
+
+	var claims *claims
+
+	if h.publisherConfigured {
+		var err error
+
+		claims, err = h.authorize(r, true)
+		if err != nil || claims == nil {
+			h.writeAuthError(w, r, err)
+
+			if err != nil {
+				recordSpanError(span, err)
+			}
+
+			return
+		}
+	}
+
+	h.limitRequestBody(w, r)
+
+	if err := r.ParseForm(); err != nil {
+		status := http.StatusBadRequest
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, http.StatusText(status), status)
+
+		return
+	}
+
+	id := r.PostForm.Get("id")
+	if id == "" {
+		http.Error(w, `Missing "id" parameter`, http.StatusBadRequest)
+
+		return
+	}
+
+	u, err := tr.RetractableUpdate(ctx, id)
+	if err != nil {
+		writeHistoryError(w, err)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	// The same grant as publishing the update is required: a publisher must
+	// not be able to withdraw updates of topics it cannot publish to. The
+	// existence of updates the publisher is not allowed to retract is not
+	// disclosed.
+	if _, err := h.authorizePublication(ctx, h.httpCaller(r), claims, u.topics(), u.Private); err != nil {
+		if errors.Is(err, errAuthorizationDenied) {
+			http.NotFound(w, r)
+		} else {
+			h.writeAuthorizationError(w, r, err)
+		}
+
+		recordSpanError(span, err)
+
+		return
+	}
+
+	ru, err := h.retract(context.WithoutCancel(ctx), tr, u)
+	if err != nil {
+		writeHistoryError(w, err)
+		recordSpanError(span, err)
+
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if _, err := io.WriteString(w, ru.ID); err != nil {
+		if h.logger.Enabled(ctx, slog.LevelInfo) {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write retract response", slog.Any("error", err))
+		}
+	}
+}
+
+// writeHistoryError answers a failed retraction or history fetch: a missing
+// update is a 404, a transport still warming up can be retried later (503),
+// anything else is a transport failure (500).
+func writeHistoryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrUpdateNotFound) {
+		http.Error(w, ErrUpdateNotFound.Error(), http.StatusNotFound)
+
+		return
+	}
+
+	if errors.Is(err, ErrTransportWarmingUp) {
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+
+		return
+	}
+
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
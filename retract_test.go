@@ -0,0 +1,87 @@
+package mercure
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func retractRequest(t *testing.T, hub *Hub, token, id string) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, retractURL, strings.NewReader(url.Values{"id": {id}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Authorization", bearerPrefix+token)
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	resp := w.Result()
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+
+	return resp
+}
+
+func TestRetractHandler(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTransport(createBoltTransport(t, 0, 0)))
+
+	topics := []string{"https://example.com/books/1"}
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: topics[0], Private: true, Event: Event{ID: "b1"}}))
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), stringsToExactMatchers(topics))
+	require.NoError(t, hub.transport.AddSubscriber(t.Context(), s))
+
+	// Not granted on the topic: the update is not disclosed.
+	resp := retractRequest(t, hub, createDummyAuthorizedJWT(rolePublisher, []string{"https://example.com/authors/1"}), "b1")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = retractRequest(t, hub, createDummyAuthorizedJWT(rolePublisher, topics), "b1")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	u := <-s.Receive()
+	assert.Equal(t, string(body), u.ID)
+	assert.Equal(t, topics[0], u.Topic)
+	assert.True(t, u.Private)
+	assert.Equal(t, reservedEventType, u.Type)
+
+	var r retraction
+	require.NoError(t, json.Unmarshal([]byte(u.Data), &r))
+	assert.Equal(t, retraction{Type: "Retraction", Retracted: "b1"}, r)
+
+	resp = retractRequest(t, hub, createDummyAuthorizedJWT(rolePublisher, topics), "b1")
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp = retractRequest(t, hub, createDummyAuthorizedJWT(rolePublisher, topics), "")
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	resp = retractRequest(t, hub, createDummyAuthorizedJWT(roleSubscriber, topics), "b1")
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
+func TestRetractNotSupported(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	_, err := hub.Retract(t.Context(), "foo")
+	require.ErrorIs(t, err, ErrRetractionNotSupported)
+
+	resp := retractRequest(t, hub, createDummyAuthorizedJWT(rolePublisher, []string{"*"}), "foo")
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+}
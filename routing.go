@@ -0,0 +1,261 @@
+package mercure
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"text/template"
+)
+
+// ErrInvalidRoutingRule is returned by NewHub when a routing rule is not valid.
+var ErrInvalidRoutingRule = errors.New("invalid routing rule")
+
+// RoutingAction is what a routing rule does with the updates it applies to.
+type RoutingAction string
+
+const (
+	// RoutingAddTopic publishes a copy of the update on RoutingRule.Topic.
+	RoutingAddTopic RoutingAction = "add_topic"
+	// RoutingDrop discards the update: it is neither dispatched nor sent to
+	// the publish hooks, and the next rules are not applied.
+	RoutingDrop RoutingAction = "drop"
+	// RoutingTransform replaces the data of the update with the output of
+	// RoutingRule.Template.
+	RoutingTransform RoutingAction = "transform"
+	// RoutingEscalate sends the update to RoutingRule.Target, in addition to
+	// its delivery to the subscribers.
+	RoutingEscalate RoutingAction = "escalate"
+)
+
+// RoutingRule adapts the routing of the published updates to their topic
+// and content, without changing the code of the publishers. The rules are
+// applied in order at publish time, each one to the update as modified by the
+// previous ones.
+type RoutingRule struct {
+	// Name identifies the rule in the logs.
+	Name string
+	// Matchers restricts the rule to the updates having a topic one of these
+	// matchers match. The rule applies to all the updates when empty.
+	Matchers []TopicMatcher
+	// Predicate is a JSONPath expression evaluated against the data of the
+	// update parsed as JSON, such as $.priority == "high" or $.total > 1000.
+	// The rule applies when one of the values it selects satisfies the
+	// comparison or, without comparison, is neither null nor false. It never
+	// applies to updates whose data is not JSON. The rule applies to all the
+	// matching updates when empty.
+	Predicate string
+	// Action is what the rule does.
+	Action RoutingAction
+	// Topic receives the copies of the updates (RoutingAddTopic). The copies
+	// have their own ID, and are not routed again.
+	Topic string
+	// Template is a text/template producing the new data of the updates
+	// (RoutingTransform), executed with the data parsed as JSON, or the raw
+	// data when it is not JSON. The json function encodes a value as JSON.
+	Template string
+	// Target receives the updates (RoutingEscalate), private ones included,
+	// asynchronously like the targets of the publish hooks.
+	Target PublishHookTarget
+}
+
+// routingRule is a compiled RoutingRule.
+type routingRule struct {
+	RoutingRule
+
+	predicate  *jsonPredicate
+	template   *template.Template
+	escalation *publishHookWorker
+}
+
+// WithRoutingRules sets rules adapting the routing of the published updates
+// to their topic and content.
+func WithRoutingRules(rules ...RoutingRule) Option {
+	return func(o *opt) error {
+		o.routingRules = rules
+
+		return nil
+	}
+}
+
+// compileRoutingRules checks the rules once the topic matcher store is
+// configured, and compiles them.
+func (o *opt) compileRoutingRules() error {
+	o.compiledRoutingRules = make([]*routingRule, 0, len(o.routingRules))
+
+	for i, r := range o.routingRules {
+		c := &routingRule{RoutingRule: r}
+
+		for _, m := range r.Matchers {
+			if err := validateProtocolMatcher(o.topicMatcherStore, m); err != nil {
+				return fmt.Errorf("%w %d: %q: %w", ErrInvalidRoutingRule, i, m.Pattern, err)
+			}
+		}
+
+		if r.Predicate != "" {
+			var err error
+			if c.predicate, err = parseJSONPredicate(r.Predicate); err != nil {
+				return fmt.Errorf("%w %d: %w", ErrInvalidRoutingRule, i, err)
+			}
+		}
+
+		switch r.Action {
+		case RoutingDrop:
+		case RoutingAddTopic:
+			if !validProtocolString(r.Topic) || r.Topic == "" {
+				return fmt.Errorf("%w %d: invalid topic %q", ErrInvalidRoutingRule, i, r.Topic)
+			}
+		case RoutingTransform:
+			var err error
+			if c.template, err = template.New(r.Name).Funcs(template.FuncMap{"json": marshalTemplateJSON}).Option("missingkey=zero").Parse(r.Template); err != nil {
+				return fmt.Errorf("%w %d: %w", ErrInvalidRoutingRule, i, err)
+			}
+		case RoutingEscalate:
+			if r.Target == nil {
+				return fmt.Errorf("%w %d: missing target", ErrInvalidRoutingRule, i)
+			}
+		default:
+			return fmt.Errorf("%w %d: unknown action %q", ErrInvalidRoutingRule, i, r.Action)
+		}
+
+		o.compiledRoutingRules = append(o.compiledRoutingRules, c)
+	}
+
+	return nil
+}
+
+// startRoutingRules starts the workers sending the updates to the targets of
+// the escalation rules, stopped when ctx is done.
+func (o *opt) startRoutingRules(ctx context.Context) {
+	for _, r := range o.compiledRoutingRules {
+		if r.Action == RoutingEscalate {
+			r.escalation = startPublishHooks(ctx, o.logger, []PublishHook{{Private: true, Target: r.Target}})[0]
+		}
+	}
+}
+
+func marshalTemplateJSON(v any) (string, error) {
+	b, err := json.Marshal(v)
+
+	return string(b), err //nolint:wrapcheck
+}
+
+// routedUpdate is the outcome of the routing rules for a published update.
+type routedUpdate struct {
+	dropped bool
+	// copies are published after the update.
+	copies []*Update
+	// escalations receive the update once published.
+	escalations []*routingRule
+	// applied are the rules applied to the update, for the publication
+	// reports.
+	applied []AppliedRoutingRule
+}
+
+// route applies the routing rules to the update, transforming it in place.
+func (h *Hub) route(ctx context.Context, u *Update) routedUpdate {
+	var (
+		r      routedUpdate
+		doc    any
+		parsed bool
+		isJSON bool
+	)
+
+	for _, rule := range h.compiledRoutingRules {
+		if !rule.matchesTopic(h.topicMatcherStore, u) {
+			continue
+		}
+
+		if rule.predicate != nil || rule.template != nil {
+			if !parsed {
+				isJSON = json.Unmarshal([]byte(u.Data), &doc) == nil
+				parsed = true
+			}
+
+			if rule.predicate != nil && (!isJSON || !rule.predicate.match(doc)) {
+				continue
+			}
+		}
+
+		if h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelDebug, "Routing rule applied", slog.String("rule", rule.Name), slog.String("action", string(rule.Action)))
+		}
+
+		r.applied = append(r.applied, AppliedRoutingRule{Name: rule.Name, Action: rule.Action, Topic: rule.Topic})
+
+		switch rule.Action {
+		case RoutingDrop:
+			return routedUpdate{dropped: true, applied: r.applied}
+		case RoutingAddTopic:
+			c := &Update{
+				Event:         Event{Data: u.Data, Type: u.Type, Retry: u.Retry},
+				Topic:         rule.Topic,
+				Private:       u.Private,
+				StateVersion:  u.StateVersion,
+				LocalizedData: u.LocalizedData,
+				CompactionKey: u.CompactionKey,
+				Expires:       u.Expires,
+				Priority:      u.Priority,
+				Debug:         u.Debug,
+				Publisher:     u.Publisher,
+				Tenant:        u.Tenant,
+			}
+			r.copies = append(r.copies, c)
+		case RoutingTransform:
+			dot := doc
+			if !isJSON {
+				dot = u.Data
+			}
+
+			var b bytes.Buffer
+			if err := rule.template.Execute(&b, dot); err != nil {
+				if h.logger.Enabled(ctx, slog.LevelError) {
+					h.logger.LogAttrs(ctx, slog.LevelError, "Routing rule failed to transform the update", slog.String("rule", rule.Name), slog.Any("error", err))
+				}
+
+				continue
+			}
+
+			u.Data = b.String()
+			parsed = false
+		case RoutingEscalate:
+			r.escalations = append(r.escalations, rule)
+		}
+	}
+
+	return r
+}
+
+func (r *routingRule) matchesTopic(tms *TopicMatcherStore, u *Update) bool {
+	if len(r.Matchers) == 0 {
+		return true
+	}
+
+	topics := u.topics()
+	for _, m := range r.Matchers {
+		if tms.matches(topics, m) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// escalate queues the published update for the targets of the escalation
+// rules it matched.
+func (h *Hub) escalate(ctx context.Context, r routedUpdate, u *Update) {
+	for _, rule := range r.escalations {
+		// The transport may still reference the update.
+		c := *u
+
+		select {
+		case rule.escalation.queue <- &c:
+		default:
+			if h.logger.Enabled(ctx, slog.LevelWarn) {
+				h.logger.LogAttrs(ctx, slog.LevelWarn, "Escalation queue full, update dropped", slog.String("rule", rule.Name), slog.String("id", u.ID))
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package mercure
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoutingRulesInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, r := range []RoutingRule{
+		{Action: "reroute"},
+		{Action: RoutingDrop, Predicate: "priority"},
+		{Action: RoutingDrop, Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/{"}}},
+		{Action: RoutingAddTopic},
+		{Action: RoutingTransform, Template: "{{"},
+		{Action: RoutingEscalate},
+	} {
+		_, err := NewHub(t.Context(), WithRoutingRules(r))
+		require.ErrorIs(t, err, ErrInvalidRoutingRule, "%+v", r)
+	}
+}
+
+func TestRoutingRules(t *testing.T) {
+	t.Parallel()
+
+	hooks := make(chanPublishHookTarget, 10)
+	escalations := make(chanPublishHookTarget, 10)
+	hub := createDummy(t,
+		WithPublishHooks(PublishHook{Target: hooks}),
+		WithRoutingRules(
+			RoutingRule{
+				Name:      "drop-tests",
+				Predicate: "$.test",
+				Action:    RoutingDrop,
+			},
+			RoutingRule{
+				Name:     "redact",
+				Matchers: []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/orders/1"}},
+				Action:   RoutingTransform,
+				Template: `{"total":{{.total}},"customer":{{json .customer.name}}}`,
+			},
+			RoutingRule{
+				Name:      "big-orders",
+				Predicate: "$.total > 1000",
+				Action:    RoutingAddTopic,
+				Topic:     "https://example.com/big-orders",
+			},
+			RoutingRule{
+				Name:      "escalate-big-orders",
+				Predicate: "$.total > 1000",
+				Action:    RoutingEscalate,
+				Target:    escalations,
+			},
+		),
+	)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/orders/1", Event: Event{Data: `{"total":1500,"customer":{"name":"Kévin","card":"4242"}}`}}))
+
+	u := <-hooks
+	assert.Equal(t, "https://example.com/orders/1", u.Topic)
+	assert.JSONEq(t, `{"total":1500,"customer":"Kévin"}`, u.Data)
+
+	c := <-hooks
+	assert.Equal(t, "https://example.com/big-orders", c.Topic)
+	assert.Equal(t, u.Data, c.Data)
+	assert.NotEmpty(t, c.ID)
+	assert.NotEqual(t, u.ID, c.ID)
+
+	assert.Equal(t, u.ID, (<-escalations).ID)
+
+	dropped := &Update{Topic: "https://example.com/orders/2", Event: Event{Data: `{"total":2000,"test":true}`}}
+	require.NoError(t, hub.Publish(t.Context(), dropped))
+	assert.NotEmpty(t, dropped.ID)
+
+	// Not JSON: only the rules without predicate apply.
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/orders/3", Event: Event{Data: "total > 1000"}}))
+	assert.Equal(t, "https://example.com/orders/3", (<-hooks).Topic)
+	assert.Empty(t, hooks)
+	assert.Empty(t, escalations)
+}
+
+func TestRoutingRulesTransformError(t *testing.T) {
+	t.Parallel()
+
+	hooks := make(chanPublishHookTarget, 1)
+	hub := createDummy(t,
+		WithPublishHooks(PublishHook{Target: hooks}),
+		WithRoutingRules(RoutingRule{Action: RoutingTransform, Template: "{{.total.amount}}"}),
+	)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/orders/1", Event: Event{Data: `{"total":1500}`}}))
+	assert.JSONEq(t, `{"total":1500}`, (<-hooks).Data)
+}
+
+func TestRoutingRulesGroup(t *testing.T) {
+	t.Parallel()
+
+	hooks := make(chanPublishHookTarget, 10)
+	hub := createDummy(t,
+		WithPublishHooks(PublishHook{Target: hooks}),
+		WithRoutingRules(
+			RoutingRule{Predicate: `$.status == "draft"`, Action: RoutingDrop},
+			RoutingRule{Matchers: []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/:id"}}, Action: RoutingAddTopic, Topic: "https://example.com/books"},
+		),
+	)
+
+	draft := &Update{Topic: "https://example.com/books/1", Event: Event{Data: `{"status":"draft"}`}}
+	require.NoError(t, hub.PublishGroup(t.Context(), []*Update{
+		draft,
+		{Topic: "https://example.com/books/2", Event: Event{Data: `{"status":"published"}`}},
+	}))
+	assert.NotEmpty(t, draft.ID)
+
+	assert.Equal(t, "https://example.com/books/2", (<-hooks).Topic)
+	assert.Equal(t, "https://example.com/books", (<-hooks).Topic)
+	assert.Empty(t, hooks)
+
+	require.NoError(t, hub.PublishGroup(t.Context(), []*Update{draft}))
+	assert.Empty(t, hooks)
+}
@@ -0,0 +1,163 @@
+package mercure
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const s3NotificationsURL = defaultHubURL + "/s3-notifications"
+
+// ErrInvalidS3Notifications is returned by WithS3Notifications when the
+// configuration is not valid.
+var ErrInvalidS3Notifications = errors.New("invalid S3 notifications configuration")
+
+// S3Notifications publishes the changes of the objects of S3 buckets. The
+// hub receives the event notifications of the buckets on the
+// /.well-known/mercure/s3-notifications endpoint, either directly (webhooks of
+// S3-compatible servers such as MinIO) or through an Amazon SNS HTTP(S)
+// subscription.
+type S3Notifications struct {
+	// Token authenticates the notifications. It is sent in the Authorization
+	// header, with or without the Bearer scheme, or as the password of the
+	// basic authentication (the only one SNS supports).
+	Token string
+	// Topic of the published updates. "{bucket}" is replaced with the name of
+	// the bucket, "{key}" with the percent-encoded key of the object.
+	Topic string
+	// Private publishes private updates.
+	Private bool
+}
+
+// WithS3Notifications enables the endpoint receiving S3 event notifications.
+func WithS3Notifications(c S3Notifications) Option {
+	return func(o *opt) error {
+		if c.Token == "" || c.Topic == "" {
+			return ErrInvalidS3Notifications
+		}
+
+		o.s3Notifications = &c
+
+		return nil
+	}
+}
+
+// s3EventJSON is an S3 event notification.
+type s3EventJSON struct {
+	Records []struct {
+		EventName string `json:"eventName"`
+		S3        struct {
+			Bucket struct {
+				Name string `json:"name"`
+			} `json:"bucket"`
+			Object struct {
+				Key  string `json:"key"`
+				Size int64  `json:"size"`
+				ETag string `json:"eTag"`
+			} `json:"object"`
+		} `json:"s3"`
+	} `json:"Records"`
+}
+
+// snsMessageJSON is an Amazon SNS message, wrapping S3 event notifications.
+type snsMessageJSON struct {
+	Type         string `json:"Type"`
+	Message      string `json:"Message"`
+	SubscribeURL string `json:"SubscribeURL"`
+}
+
+// S3NotificationsHandler publishes the changes of the objects described by S3
+// event notifications.
+func (h *Hub) S3NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.authorizeS3Notification(r) {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mercure"`)
+		http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+
+		return
+	}
+
+	h.limitRequestBody(w, r)
+
+	var body struct {
+		snsMessageJSON
+		s3EventJSON
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+		return
+	}
+
+	ctx := context.WithoutCancel(r.Context())
+	event := body.s3EventJSON
+
+	switch body.Type {
+	case "":
+	case "SubscriptionConfirmation":
+		// Confirming would make the hub request a URL chosen by the client.
+		if h.logger.Enabled(ctx, slog.LevelWarn) {
+			h.logger.LogAttrs(ctx, slog.LevelWarn, "SNS subscription to confirm by visiting the subscribe URL", slog.String("subscribe_url", body.SubscribeURL))
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	case "Notification":
+		if err := json.Unmarshal([]byte(body.Message), &event); err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	for _, rec := range event.Records {
+		var op FileChangeOp
+
+		switch {
+		case strings.HasPrefix(rec.EventName, "ObjectCreated:"), strings.HasPrefix(rec.EventName, "s3:ObjectCreated:"):
+			op = FileCreated
+		case strings.HasPrefix(rec.EventName, "ObjectRemoved:"), strings.HasPrefix(rec.EventName, "s3:ObjectRemoved:"):
+			op = FileDeleted
+		default:
+			continue
+		}
+
+		// Keys are URL-encoded in notifications.
+		key, err := url.QueryUnescape(rec.S3.Object.Key)
+		if err != nil {
+			key = rec.S3.Object.Key
+		}
+
+		h.publishFileChange(ctx, h.s3Notifications.Topic, h.s3Notifications.Private, FileChange{
+			Op:     op,
+			Bucket: rec.S3.Bucket.Name,
+			Path:   key,
+			Size:   rec.S3.Object.Size,
+			ETag:   strings.Trim(rec.S3.Object.ETag, `"`),
+		})
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// authorizeS3Notification reports whether the request carries the token.
+func (h *Hub) authorizeS3Notification(r *http.Request) bool {
+	token := r.Header.Get("Authorization")
+	if _, password, ok := r.BasicAuth(); ok {
+		token = password
+	} else if t, ok := strings.CutPrefix(token, "Bearer "); ok {
+		token = t
+	}
+
+	return token != "" && subtle.ConstantTimeCompare([]byte(token), []byte(h.s3Notifications.Token)) == 1
+}
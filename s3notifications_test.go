@@ -0,0 +1,70 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testS3Event = `{"Records": [
+	{"eventName": "ObjectCreated:Put", "s3": {"bucket": {"name": "media"}, "object": {"key": "videos/a+b.mp4", "size": 42, "eTag": "\"abc\""}}},
+	{"eventName": "ObjectRestore:Post", "s3": {"bucket": {"name": "media"}, "object": {"key": "ignored"}}},
+	{"eventName": "s3:ObjectRemoved:Delete", "s3": {"bucket": {"name": "media"}, "object": {"key": "old.mp4"}}}
+]}`
+
+func TestS3NotificationsHandler(t *testing.T) {
+	t.Parallel()
+
+	published := make(chanPublishHookTarget, 10)
+	h := createDummy(t,
+		WithPublishHooks(PublishHook{Target: published}),
+		WithS3Notifications(S3Notifications{Token: "secret", Topic: "https://example.com/{bucket}/{key}"}),
+	)
+
+	sns, err := json.Marshal(snsMessageJSON{Type: "Notification", Message: testS3Event})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name string
+		body string
+		auth func(r *http.Request)
+	}{
+		{"bearer", testS3Event, func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }},
+		{"sns", string(sns), func(r *http.Request) { r.SetBasicAuth("sns", "secret") }},
+	} {
+		req := httptest.NewRequest(http.MethodPost, s3NotificationsURL, strings.NewReader(tc.body))
+		tc.auth(req)
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		require.Equal(t, http.StatusNoContent, w.Code, tc.name)
+
+		u := <-published
+		assert.Equal(t, "https://example.com/media/videos/a%20b.mp4", u.Topic)
+		assert.JSONEq(t, `{"op":"created","bucket":"media","path":"videos/a b.mp4","size":42,"etag":"abc"}`, u.Data)
+
+		u = <-published
+		assert.Equal(t, "https://example.com/media/old.mp4", u.Topic)
+		assert.JSONEq(t, `{"op":"deleted","bucket":"media","path":"old.mp4"}`, u.Data)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, s3NotificationsURL, strings.NewReader(testS3Event))
+	req.Header.Set("Authorization", "Bearer wrong")
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Empty(t, published)
+}
+
+func TestWithS3NotificationsInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithS3Notifications(S3Notifications{Topic: "https://example.com/{key}"}))
+	assert.ErrorIs(t, err, ErrInvalidS3Notifications)
+}
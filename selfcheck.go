@@ -0,0 +1,208 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+)
+
+const (
+	// DefaultSelfCheckTopic is the default topic of the self-check.
+	DefaultSelfCheckTopic = "urn:mercure:self-check"
+	// DefaultSelfCheckTimeout is the default timeout of an attempt of the
+	// self-check, and the default time between two attempts.
+	DefaultSelfCheckTimeout = 5 * time.Second
+)
+
+var (
+	// ErrSelfCheckPending is returned by Hub.SelfCheckResult until the
+	// self-check succeeds.
+	ErrSelfCheckPending = errors.New("the self-check hasn't succeeded yet")
+	// ErrSelfCheckFailed is wrapped by the errors of the failed attempts of
+	// the self-check.
+	ErrSelfCheckFailed = errors.New("self-check failed")
+)
+
+// SelfCheck configures the check the hub runs at startup, see WithSelfCheck.
+type SelfCheck struct {
+	// Topic is the loopback topic, DefaultSelfCheckTopic when empty.
+	Topic string
+	// PublisherToken and SubscriberToken, when set, must be valid for their
+	// role and grant publishing and subscribing to Topic. They are typically
+	// issued like the tokens of the applications, to detect the keys not
+	// matching the ones of the hub.
+	PublisherToken  string
+	SubscriberToken string
+	// Timeout bounds an attempt, and is the time between two attempts,
+	// DefaultSelfCheckTimeout when 0.
+	Timeout time.Duration
+}
+
+// selfCheck holds the result of the self-check.
+type selfCheck struct {
+	SelfCheck
+
+	mu  sync.Mutex
+	err error
+}
+
+// WithSelfCheck makes the hub check at startup that it works end to end: the
+// tokens of the configuration are authorized, and a private update published
+// on the loopback topic goes through the transport and is dispatched back to
+// the hub. Until an attempt succeeds, the hub isn't ready (see
+// Hub.SelfCheckResult): misconfigurations, such as wrong keys or a broken
+// transport, are caught before the traffic arrives. Failed attempts are
+// logged and retried.
+//
+// The update is published like any other one: transports keeping a history
+// store it, and the subscribers allowed to receive the private updates of the
+// loopback topic receive it.
+func WithSelfCheck(c SelfCheck) Option {
+	return func(o *opt) error {
+		if c.Topic == "" {
+			c.Topic = DefaultSelfCheckTopic
+		}
+
+		if c.Timeout <= 0 {
+			c.Timeout = DefaultSelfCheckTimeout
+		}
+
+		o.selfCheck = &selfCheck{SelfCheck: c, err: ErrSelfCheckPending}
+
+		return nil
+	}
+}
+
+// SelfCheckResult returns nil if the self-check succeeded or isn't enabled.
+// Otherwise, it returns the error of the last attempt, or
+// ErrSelfCheckPending.
+func (h *Hub) SelfCheckResult() error {
+	if h.selfCheck == nil {
+		return nil
+	}
+
+	h.selfCheck.mu.Lock()
+	defer h.selfCheck.mu.Unlock()
+
+	return h.selfCheck.err
+}
+
+// startSelfCheck runs the self-check until it succeeds or the context of the
+// hub is done.
+func (h *Hub) startSelfCheck() {
+	if h.selfCheck == nil {
+		return
+	}
+
+	go func() {
+		for {
+			err := h.runSelfCheck()
+
+			if h.setSelfCheckResult(err) {
+				return
+			}
+
+			select {
+			case <-h.ctx.Done():
+				return
+			case <-time.After(h.selfCheck.Timeout):
+			}
+		}
+	}()
+}
+
+// setSelfCheckResult records the result of an attempt, and reports whether
+// the self-check is over.
+func (h *Hub) setSelfCheckResult(err error) bool {
+	if h.ctx.Err() != nil {
+		return true
+	}
+
+	if err != nil {
+		if h.logger.Enabled(h.ctx, slog.LevelError) {
+			h.logger.LogAttrs(h.ctx, slog.LevelError, "Self-check failed", slog.Any("error", err))
+		}
+	} else if h.logger.Enabled(h.ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(h.ctx, slog.LevelInfo, "Self-check succeeded")
+	}
+
+	h.selfCheck.mu.Lock()
+	h.selfCheck.err = err
+	h.selfCheck.mu.Unlock()
+
+	return err == nil
+}
+
+// runSelfCheck runs an attempt of the self-check.
+func (h *Hub) runSelfCheck() error {
+	c := h.selfCheck
+	ctx, cancel := context.WithTimeout(h.ctx, c.Timeout)
+	defer cancel()
+
+	var publisherClaims *claims
+
+	if c.PublisherToken != "" {
+		var err error
+		if publisherClaims, err = h.validateJWT(c.PublisherToken, true); err != nil {
+			return fmt.Errorf("%w: invalid publisher token: %w", ErrSelfCheckFailed, err)
+		}
+
+		if !h.canPublish(ctx, publisherClaims, []string{c.Topic}, true) {
+			return fmt.Errorf("%w: the publisher token doesn't grant publishing to %q", ErrSelfCheckFailed, c.Topic)
+		}
+	}
+
+	if c.SubscriberToken != "" {
+		subscriberClaims, err := h.validateJWT(c.SubscriberToken, false)
+		if err != nil {
+			return fmt.Errorf("%w: invalid subscriber token: %w", ErrSelfCheckFailed, err)
+		}
+
+		if !subscriberClaims.authz.grants(h.topicMatcherStore, actionSubscribe, c.Topic) {
+			return fmt.Errorf("%w: the subscriber token doesn't grant subscribing to %q", ErrSelfCheckFailed, c.Topic)
+		}
+	}
+
+	matchers := []TopicMatcher{{Type: MatcherTypeExact, Pattern: c.Topic}}
+
+	updates, err := h.Subscribe(ctx, matchers, matchers)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrSelfCheckFailed, err)
+	}
+
+	// Tells the update of this attempt apart from the ones of the previous
+	// attempts and of the other nodes.
+	nonce := uuid.Must(uuid.NewV4()).String()
+
+	u := &Update{
+		Topic:     c.Topic,
+		Private:   true,
+		Event:     Event{Data: nonce},
+		Publisher: publisherID(publisherClaims),
+		Tenant:    h.tenantName(publisherClaims),
+	}
+
+	if err := h.Publish(ctx, u); err != nil && !errors.Is(err, ErrPartialDispatch) {
+		return fmt.Errorf("%w: %w", ErrSelfCheckFailed, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: the update hasn't been received: %w", ErrSelfCheckFailed, ctx.Err())
+		case u, ok := <-updates:
+			if !ok {
+				return fmt.Errorf("%w: the subscriber has been disconnected", ErrSelfCheckFailed)
+			}
+
+			if u.Data == nonce {
+				return nil
+			}
+		}
+	}
+}
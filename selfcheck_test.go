@@ -0,0 +1,64 @@
+package mercure
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelfCheck(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithSelfCheck(SelfCheck{
+		PublisherToken:  createDummyAuthorizedJWT(rolePublisher, []string{DefaultSelfCheckTopic}),
+		SubscriberToken: createDummyAuthorizedJWT(roleSubscriber, []string{"*"}),
+	}))
+
+	require.Eventually(t, func() bool { return hub.SelfCheckResult() == nil }, 5*time.Second, time.Millisecond)
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+}
+
+func TestSelfCheckDisabled(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+	assert.NoError(t, hub.SelfCheckResult())
+}
+
+func TestSelfCheckFailure(t *testing.T) {
+	t.Parallel()
+
+	for name, c := range map[string]SelfCheck{
+		"invalid publisher token":  {PublisherToken: createDummyUnauthorizedJWT()},
+		"publisher token scope":    {PublisherToken: createDummyAuthorizedJWT(rolePublisher, []string{"https://example.com/books/1"})},
+		"invalid subscriber token": {SubscriberToken: createDummyAuthorizedJWT(rolePublisher, []string{"*"})},
+		"subscriber token scope":   {SubscriberToken: createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"})},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			c.Timeout = 10 * time.Millisecond
+			hub := createDummy(t, WithSelfCheck(c))
+
+			require.Eventually(t, func() bool { return !errors.Is(hub.SelfCheckResult(), ErrSelfCheckPending) }, 5*time.Second, time.Millisecond)
+
+			require.ErrorIs(t, hub.SelfCheckResult(), ErrSelfCheckFailed)
+		})
+	}
+}
+
+func TestSelfCheckClosedTransport(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0))
+	require.NoError(t, transport.Close(t.Context()))
+
+	hub := createDummy(t, WithTransport(transport), WithSelfCheck(SelfCheck{Timeout: 10 * time.Millisecond}))
+
+	require.Eventually(t, func() bool { return !errors.Is(hub.SelfCheckResult(), ErrSelfCheckPending) }, 5*time.Second, time.Millisecond)
+	require.ErrorIs(t, hub.SelfCheckResult(), ErrSelfCheckFailed)
+}
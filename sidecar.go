@@ -0,0 +1,337 @@
+package mercure
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"sync"
+)
+
+// sidecarMaxMessageSize bounds the size of a request of the sidecar API.
+const sidecarMaxMessageSize = 1 << 20
+
+// JSON-RPC 2.0 error codes returned by the sidecar API.
+const (
+	sidecarParseError     = -32700
+	sidecarInvalidRequest = -32600
+	sidecarMethodNotFound = -32601
+	sidecarInvalidParams  = -32602
+	sidecarServerError    = -32000
+	sidecarUnauthorized   = -32001
+)
+
+// WithSidecar serves the sidecar API on the listener, typically a Unix domain
+// socket shared with the other containers of a pod, until the hub stops.
+//
+// The sidecar API lets colocated services publish and subscribe without HTTP
+// and JWTs: connections speak JSON-RPC 2.0, one JSON document per line, with
+// the methods authenticate, publish, subscribe, unsubscribe and health. Its
+// clients are trusted, they can publish and subscribe to all topics, private
+// ones included: restrict the access to the socket with its permissions, and,
+// when token is not empty, require connections to authenticate with it first.
+func WithSidecar(l net.Listener, token string) Option {
+	return func(o *opt) error {
+		o.sidecarListener = l
+		o.sidecarToken = token
+
+		return nil
+	}
+}
+
+// sidecarRequestJSON is a JSON-RPC 2.0 request or notification.
+type sidecarRequestJSON struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// sidecarResponseJSON is a JSON-RPC 2.0 response or notification.
+type sidecarResponseJSON struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id,omitempty"`
+	Method  string            `json:"method,omitempty"`
+	Params  any               `json:"params,omitempty"`
+	Result  any               `json:"result,omitempty"`
+	Error   *sidecarErrorJSON `json:"error,omitempty"`
+}
+
+type sidecarErrorJSON struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// sidecarSubscribeJSON holds the parameters of the subscribe method.
+type sidecarSubscribeJSON struct {
+	Match           []string `json:"match"`
+	MatchURLPattern []string `json:"match_urlpattern"`
+	// Private also receives the private updates.
+	Private bool `json:"private"`
+}
+
+// sidecarSubscriptionJSON identifies a subscription of the connection.
+type sidecarSubscriptionJSON struct {
+	Subscription string `json:"subscription"`
+}
+
+// sidecarUpdateJSON is the params of the update notifications.
+type sidecarUpdateJSON struct {
+	Subscription string `json:"subscription"`
+	publishHookJSON
+}
+
+// sidecarConn is a connection to the sidecar API.
+type sidecarConn struct {
+	hub  *Hub
+	conn net.Conn
+	ctx  context.Context //nolint:containedctx
+
+	authenticated bool
+
+	writeMu sync.Mutex
+	enc     *json.Encoder
+
+	mu               sync.Mutex
+	lastSubscription uint64
+	subscriptions    map[string]context.CancelFunc
+}
+
+// startSidecar serves the sidecar API, if enabled.
+func (h *Hub) startSidecar() {
+	if h.sidecarListener == nil {
+		return
+	}
+
+	go func() {
+		<-h.ctx.Done()
+
+		_ = h.sidecarListener.Close()
+	}()
+
+	go func() {
+		for {
+			conn, err := h.sidecarListener.Accept()
+			if err != nil {
+				if !errors.Is(err, net.ErrClosed) && h.logger.Enabled(h.ctx, slog.LevelError) {
+					h.logger.LogAttrs(h.ctx, slog.LevelError, "Sidecar API stopped", slog.Any("error", err))
+				}
+
+				return
+			}
+
+			c := &sidecarConn{
+				hub:           h,
+				conn:          conn,
+				authenticated: h.sidecarToken == "",
+				enc:           json.NewEncoder(conn),
+				subscriptions: make(map[string]context.CancelFunc),
+			}
+
+			go c.serve()
+		}
+	}()
+}
+
+// serve handles the requests of the connection, until it is closed or the
+// hub stops.
+func (c *sidecarConn) serve() {
+	ctx, cancel := context.WithCancel(c.hub.ctx)
+	defer cancel()
+
+	c.ctx = ctx
+
+	go func() {
+		<-ctx.Done()
+
+		_ = c.conn.Close()
+	}()
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 0, 4096), sidecarMaxMessageSize)
+
+	for scanner.Scan() {
+		var req sidecarRequestJSON
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			c.write(sidecarResponseJSON{Error: &sidecarErrorJSON{sidecarParseError, "parse error"}})
+
+			continue
+		}
+
+		if req.JSONRPC != "2.0" || req.Method == "" {
+			c.write(sidecarResponseJSON{ID: req.ID, Error: &sidecarErrorJSON{sidecarInvalidRequest, "invalid request"}})
+
+			continue
+		}
+
+		result, rpcErr := c.call(req)
+
+		// Notifications get no response.
+		if req.ID == nil {
+			continue
+		}
+
+		c.write(sidecarResponseJSON{ID: req.ID, Result: result, Error: rpcErr})
+	}
+}
+
+// call runs the method of the request.
+func (c *sidecarConn) call(req sidecarRequestJSON) (any, *sidecarErrorJSON) {
+	if req.Method == "authenticate" {
+		var params struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, &sidecarErrorJSON{sidecarInvalidParams, "invalid params"}
+		}
+
+		if subtle.ConstantTimeCompare([]byte(params.Token), []byte(c.hub.sidecarToken)) != 1 {
+			return nil, &sidecarErrorJSON{sidecarUnauthorized, "invalid token"}
+		}
+
+		c.authenticated = true
+
+		return true, nil
+	}
+
+	if !c.authenticated {
+		return nil, &sidecarErrorJSON{sidecarUnauthorized, "authentication required"}
+	}
+
+	switch req.Method {
+	case "publish":
+		return c.publish(req.Params)
+	case "subscribe":
+		return c.subscribe(req.Params)
+	case "unsubscribe":
+		return c.unsubscribe(req.Params)
+	case "health":
+		if checker, ok := c.hub.transport.(TransportHealthChecker); ok {
+			if err := checker.Ready(c.ctx); err != nil {
+				return nil, &sidecarErrorJSON{sidecarServerError, "transport not ready"}
+			}
+		}
+
+		return map[string]string{"status": "ok"}, nil
+	default:
+		return nil, &sidecarErrorJSON{sidecarMethodNotFound, "method not found"}
+	}
+}
+
+func (c *sidecarConn) publish(params json.RawMessage) (any, *sidecarErrorJSON) {
+	var p publishHookJSON
+	if err := json.Unmarshal(params, &p); err != nil || p.Topic == "" {
+		return nil, &sidecarErrorJSON{sidecarInvalidParams, "invalid params"}
+	}
+
+	u := &Update{
+		Event:         Event{Data: p.Data, ID: p.ID, Type: p.Type, Retry: p.Retry},
+		Topic:         p.Topic,
+		Private:       p.Private,
+		StateVersion:  p.StateVersion,
+		LocalizedData: p.LocalizedData,
+		CompactionKey: p.CompactionKey,
+		Expires:       p.Expires,
+		Priority:      p.Priority,
+	}
+
+	if err := c.hub.Publish(c.ctx, u); err != nil && !errors.Is(err, ErrPartialDispatch) {
+		return nil, &sidecarErrorJSON{sidecarServerError, err.Error()}
+	}
+
+	return map[string]string{"id": u.ID}, nil
+}
+
+func (c *sidecarConn) subscribe(params json.RawMessage) (any, *sidecarErrorJSON) {
+	var p sidecarSubscribeJSON
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &sidecarErrorJSON{sidecarInvalidParams, "invalid params"}
+	}
+
+	matchers := make([]TopicMatcher, 0, len(p.Match)+len(p.MatchURLPattern))
+	for _, pattern := range p.Match {
+		matchers = append(matchers, TopicMatcher{Type: MatcherTypeExact, Pattern: pattern})
+	}
+
+	for _, pattern := range p.MatchURLPattern {
+		matchers = append(matchers, TopicMatcher{Type: MatcherTypeURLPattern, Pattern: pattern})
+	}
+
+	var privateMatchers []TopicMatcher
+	if p.Private {
+		privateMatchers = matchers
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+
+	updates, err := c.hub.Subscribe(ctx, matchers, privateMatchers)
+	if err != nil {
+		cancel()
+
+		return nil, &sidecarErrorJSON{sidecarInvalidParams, err.Error()}
+	}
+
+	c.mu.Lock()
+	c.lastSubscription++
+	id := strconv.FormatUint(c.lastSubscription, 10)
+	c.subscriptions[id] = cancel
+	c.mu.Unlock()
+
+	go func() {
+		for u := range updates {
+			c.write(sidecarResponseJSON{Method: "update", Params: sidecarUpdateJSON{id, publishHookJSON{u.ID, u.Topic, u.Type, u.Data, u.Private, u.Retry, u.StateVersion, u.LocalizedData, u.CompactionKey, u.Expires, u.Priority}}})
+		}
+
+		c.mu.Lock()
+		_, active := c.subscriptions[id]
+		delete(c.subscriptions, id)
+		c.mu.Unlock()
+
+		// The hub ended the subscription, for instance because the client
+		// didn't read the updates fast enough.
+		if active && c.ctx.Err() == nil {
+			c.write(sidecarResponseJSON{Method: "unsubscribed", Params: sidecarSubscriptionJSON{id}})
+		}
+
+		cancel()
+	}()
+
+	return sidecarSubscriptionJSON{id}, nil
+}
+
+func (c *sidecarConn) unsubscribe(params json.RawMessage) (any, *sidecarErrorJSON) {
+	var p sidecarSubscriptionJSON
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &sidecarErrorJSON{sidecarInvalidParams, "invalid params"}
+	}
+
+	c.mu.Lock()
+	cancel, ok := c.subscriptions[p.Subscription]
+	delete(c.subscriptions, p.Subscription)
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, &sidecarErrorJSON{sidecarInvalidParams, fmt.Sprintf("unknown subscription %q", p.Subscription)}
+	}
+
+	cancel()
+
+	return true, nil
+}
+
+// write sends a message, closing the connection on failure.
+func (c *sidecarConn) write(m sidecarResponseJSON) {
+	m.JSONRPC = "2.0"
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if err := c.enc.Encode(m); err != nil {
+		_ = c.conn.Close()
+	}
+}
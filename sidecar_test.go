@@ -0,0 +1,106 @@
+package mercure
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// sidecarClient is a minimal client of the sidecar API.
+type sidecarClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Scanner
+}
+
+func newSidecarClient(t *testing.T, token string) *sidecarClient {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "mercure.sock")
+
+	l, err := net.Listen("unix", path)
+	require.NoError(t, err)
+
+	createDummy(t, WithSidecar(l, token))
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return &sidecarClient{t: t, conn: conn, r: bufio.NewScanner(conn)}
+}
+
+func (c *sidecarClient) send(m string) {
+	c.t.Helper()
+
+	_, err := c.conn.Write([]byte(m + "\n"))
+	require.NoError(c.t, err)
+}
+
+func (c *sidecarClient) receive() string {
+	c.t.Helper()
+
+	require.True(c.t, c.r.Scan())
+
+	return c.r.Text()
+}
+
+func TestSidecar(t *testing.T) {
+	t.Parallel()
+
+	c := newSidecarClient(t, "")
+
+	c.send(`{"jsonrpc": "2.0", "id": 1, "method": "health"}`)
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 1, "result": {"status": "ok"}}`, c.receive())
+
+	c.send(`{"jsonrpc": "2.0", "id": 2, "method": "subscribe", "params": {"match_urlpattern": ["https://example.com/books/*"], "private": true}}`)
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 2, "result": {"subscription": "1"}}`, c.receive())
+
+	c.send(`{"jsonrpc": "2.0", "id": 3, "method": "publish", "params": {"id": "a", "topic": "https://example.com/books/1", "data": "foo", "private": true}}`)
+
+	// The notification and the response can come in any order.
+	messages := []string{c.receive(), c.receive()}
+	assert.ElementsMatch(t, []string{
+		`{"jsonrpc":"2.0","id":3,"result":{"id":"a"}}`,
+		`{"jsonrpc":"2.0","method":"update","params":{"subscription":"1","id":"a","topic":"https://example.com/books/1","data":"foo","private":true}}`,
+	}, messages)
+
+	c.send(`{"jsonrpc": "2.0", "id": 4, "method": "unsubscribe", "params": {"subscription": "1"}}`)
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 4, "result": true}`, c.receive())
+
+	c.send(`{"jsonrpc": "2.0", "id": 5, "method": "unsubscribe", "params": {"subscription": "1"}}`)
+	assert.JSONEq(t, `{"jsonrpc": "2.0", "id": 5, "error": {"code": -32602, "message": "unknown subscription \"1\""}}`, c.receive())
+}
+
+func TestSidecarErrors(t *testing.T) {
+	t.Parallel()
+
+	c := newSidecarClient(t, "secret")
+
+	for _, tc := range [][2]string{
+		{`{"jsonrpc": "2.0", "id": 1, "method": "health"}`, `{"jsonrpc": "2.0", "id": 1, "error": {"code": -32001, "message": "authentication required"}}`},
+		{`{"jsonrpc": "2.0", "id": 2, "method": "authenticate", "params": {"token": "foo"}}`, `{"jsonrpc": "2.0", "id": 2, "error": {"code": -32001, "message": "invalid token"}}`},
+		{`{"jsonrpc": "2.0", "id": 3, "method": "authenticate", "params": {"token": "secret"}}`, `{"jsonrpc": "2.0", "id": 3, "result": true}`},
+		{`{"jsonrpc": "2.0", "id": 4, "method": "foo"}`, `{"jsonrpc": "2.0", "id": 4, "error": {"code": -32601, "message": "method not found"}}`},
+		{`{"id": 5, "method": "health"}`, `{"jsonrpc": "2.0", "id": 5, "error": {"code": -32600, "message": "invalid request"}}`},
+		{`{`, `{"jsonrpc": "2.0", "error": {"code": -32700, "message": "parse error"}}`},
+		{`{"jsonrpc": "2.0", "id": 6, "method": "publish", "params": {"data": "foo"}}`, `{"jsonrpc": "2.0", "id": 6, "error": {"code": -32602, "message": "invalid params"}}`},
+		{`{"jsonrpc": "2.0", "id": 7, "method": "subscribe", "params": {}}`, `{"jsonrpc": "2.0", "id": 7, "error": {"code": -32602, "message": "at least one topic matcher is required"}}`},
+	} {
+		c.send(tc[0])
+		assert.JSONEq(t, tc[1], c.receive(), tc[0])
+	}
+
+	// Notifications get no response.
+	c.send(`{"jsonrpc": "2.0", "method": "health"}`)
+	c.send(`{"jsonrpc": "2.0", "id": 8, "method": "health"}`)
+
+	var resp sidecarResponseJSON
+	require.NoError(t, json.Unmarshal([]byte(c.receive()), &resp))
+	assert.JSONEq(t, "8", string(resp.ID))
+}
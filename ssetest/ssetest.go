@@ -0,0 +1,209 @@
+// Package ssetest provides test vectors of the Server-Sent Events streams
+// written by the hub, for the authors of Mercure clients to check their
+// parsers against its actual output.
+//
+// Every vector holds the exact bytes of a stream, captured from the hub, and
+// the events and reconnection time a client conforming to the HTML Living
+// Standard must extract from it.
+package ssetest
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// VectorsDir is the directory holding the golden files, relative to the
+// package.
+const VectorsDir = "vectors"
+
+//go:embed vectors
+var vectors embed.FS
+
+// Event is an event dispatched by a client.
+type Event struct {
+	// Type is the event type, "message" when the stream sets none.
+	Type string `json:"type"`
+	// Data is the data of the event, its lines joined with "\n".
+	Data string `json:"data"`
+	// LastEventID is the last event ID of the stream when the event has been
+	// dispatched.
+	LastEventID string `json:"lastEventId"`
+}
+
+// Result is what a client extracts from a stream.
+type Result struct {
+	// Events are the dispatched events, in order.
+	Events []Event `json:"events"`
+	// Retry is the reconnection time set by the last retry field of the
+	// stream, in milliseconds, 0 when there is none.
+	Retry uint64 `json:"retry,omitempty"`
+}
+
+// Vector is a stream written by the hub and the result of parsing it.
+type Vector struct {
+	// Name identifies the vector, it is the name of its golden files.
+	Name string `json:"-"`
+	// Description is the scenario that produced the stream.
+	Description string `json:"description"`
+	// Stream is the exact bytes of the stream.
+	Stream []byte `json:"-"`
+
+	Result
+}
+
+// Parser parses a stream like a client.
+type Parser func(stream io.Reader) (Result, error)
+
+// Vectors returns the test vectors, sorted by name.
+func Vectors() ([]Vector, error) {
+	entries, err := vectors.ReadDir(VectorsDir)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the vectors: %w", err)
+	}
+
+	var vs []Vector
+
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".sse")
+		if !ok {
+			continue
+		}
+
+		v := Vector{Name: name}
+
+		if v.Stream, err = vectors.ReadFile(path.Join(VectorsDir, e.Name())); err != nil {
+			return nil, fmt.Errorf("%q: unable to read the stream: %w", name, err)
+		}
+
+		j, err := vectors.ReadFile(path.Join(VectorsDir, name+".json"))
+		if err != nil {
+			return nil, fmt.Errorf("%q: unable to read the result: %w", name, err)
+		}
+
+		if err := json.Unmarshal(j, &v); err != nil {
+			return nil, fmt.Errorf("%q: invalid result: %w", name, err)
+		}
+
+		vs = append(vs, v)
+	}
+
+	return vs, nil
+}
+
+// Run checks that parse extracts the expected result from every vector, with
+// the stream read at once and byte by byte, as it would arrive over a slow
+// network.
+func Run(t *testing.T, parse Parser) {
+	t.Helper()
+
+	vs, err := Vectors()
+	require.NoError(t, err)
+
+	for _, v := range vs {
+		t.Run(v.Name, func(t *testing.T) {
+			for name, r := range map[string]io.Reader{
+				"whole":   bytes.NewReader(v.Stream),
+				"bytes":   iotest.OneByteReader(bytes.NewReader(v.Stream)),
+				"halfway": iotest.HalfReader(bytes.NewReader(v.Stream)),
+			} {
+				result, err := parse(r)
+				require.NoError(t, err, name)
+
+				assert.Equal(t, normalize(v.Result), normalize(result), "%s: %s", name, v.Description)
+			}
+		})
+	}
+}
+
+// normalize makes an empty list of events equal to a nil one.
+func normalize(r Result) Result {
+	if len(r.Events) == 0 {
+		r.Events = nil
+	}
+
+	return r
+}
+
+// Parse is the reference parser, implementing the interpretation of event
+// streams of the HTML Living Standard. The event being received when the
+// stream ends is not dispatched.
+func Parse(stream io.Reader) (Result, error) {
+	b, err := io.ReadAll(stream)
+	if err != nil {
+		return Result{}, fmt.Errorf("unable to read the stream: %w", err)
+	}
+
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+
+	var (
+		result      Result
+		data        strings.Builder
+		eventType   string
+		lastEventID string
+	)
+
+	for len(b) > 0 {
+		i := bytes.IndexAny(b, "\r\n")
+		if i < 0 {
+			// Incomplete line at the end of the stream.
+			break
+		}
+
+		line := string(b[:i])
+		if b[i] == '\r' && i+1 < len(b) && b[i+1] == '\n' {
+			i++
+		}
+
+		b = b[i+1:]
+
+		if line == "" {
+			if data.Len() != 0 {
+				t := eventType
+				if t == "" {
+					t = "message"
+				}
+
+				result.Events = append(result.Events, Event{Type: t, Data: strings.TrimSuffix(data.String(), "\n"), LastEventID: lastEventID})
+			}
+
+			data.Reset()
+			eventType = ""
+
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+
+		switch field {
+		case "":
+			// Comment.
+		case "event":
+			eventType = value
+		case "data":
+			data.WriteString(value)
+			data.WriteByte('\n')
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				lastEventID = value
+			}
+		case "retry":
+			if r, err := strconv.ParseUint(value, 10, 64); err == nil {
+				result.Retry = r
+			}
+		}
+	}
+
+	return result, nil
+}
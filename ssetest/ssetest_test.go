@@ -0,0 +1,276 @@
+package ssetest_test
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/dunglas/mercure"
+	"github.com/dunglas/mercure/ssetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden files from the output of the hub")
+
+const topic = "https://example.com/books/1"
+
+// recorder is a response recorder supporting the write deadlines set by the
+// hub.
+type recorder struct {
+	*httptest.ResponseRecorder
+}
+
+func (*recorder) SetWriteDeadline(time.Time) error {
+	return nil
+}
+
+// scenario describes how to make the hub write a stream.
+type scenario struct {
+	name        string
+	description string
+	options     []mercure.Option
+	// history uses a Bolt transport instead of the local one.
+	history     bool
+	query       url.Values
+	lastEventID string
+	// before are published before the subscription, and during after.
+	before []*mercure.Update
+	during []*mercure.Update
+	// wait is how long the subscriber stays connected after the updates.
+	wait time.Duration
+	// kick ends the stream by disconnecting the subscriber instead of
+	// closing the connection.
+	kick bool
+}
+
+func newUpdate(id, data string) *mercure.Update {
+	return &mercure.Update{Topic: topic, Event: mercure.Event{ID: id, Data: data}}
+}
+
+var scenarios = []scenario{
+	{
+		name:        "message",
+		description: "A single update.",
+		during:      []*mercure.Update{newUpdate("1", "Dune")},
+	},
+	{
+		name:        "messages",
+		description: "Several updates, in order.",
+		during:      []*mercure.Update{newUpdate("1", "Dune"), newUpdate("2", "Hyperion"), newUpdate("3", "Foundation")},
+	},
+	{
+		name:        "multiline",
+		description: "Data containing LF, CRLF and CR line breaks, and empty lines, normalized to LF.",
+		during:      []*mercure.Update{newUpdate("1", "first\nsecond\r\nthird\rfourth\n\nsixth\n")},
+	},
+	{
+		name:        "type-retry",
+		description: "Updates having an event type and a reconnection time.",
+		during: []*mercure.Update{
+			{Topic: topic, Event: mercure.Event{ID: "1", Type: "book", Data: "Dune", Retry: 5000}},
+			{Topic: topic, Event: mercure.Event{ID: "2", Data: "Hyperion"}},
+		},
+	},
+	{
+		name:        "empty-data",
+		description: "An update without data, dispatched by clients as an event having empty data.",
+		during:      []*mercure.Update{newUpdate("1", ""), newUpdate("2", "Dune")},
+	},
+	{
+		name:        "unicode",
+		description: "Data containing non-ASCII characters, and leading and trailing spaces and colons.",
+		during:      []*mercure.Update{newUpdate("1", "  Ĥéllo, 世界 🌍 "), newUpdate("2", ": not a comment"), newUpdate("3", `{"title": "Dune"}`)},
+	},
+	{
+		name:        "heartbeat",
+		description: "Heartbeat comments, sent every 15 seconds while no update is sent.",
+		options:     []mercure.Option{mercure.WithHeartbeat(15 * time.Second)},
+		during:      []*mercure.Update{newUpdate("1", "Dune")},
+		wait:        31 * time.Second,
+	},
+	{
+		name:        "replay",
+		description: "The updates of the history published after the Last-Event-ID, then a live one.",
+		history:     true,
+		lastEventID: "1",
+		before:      []*mercure.Update{newUpdate("1", "Dune"), newUpdate("2", "Hyperion"), newUpdate("3", "Foundation")},
+		during:      []*mercure.Update{newUpdate("4", "Neuromancer")},
+	},
+	{
+		name:        "replay-earliest",
+		description: "The whole history, requested with the reserved earliest Last-Event-ID.",
+		history:     true,
+		lastEventID: "earliest",
+		before:      []*mercure.Update{newUpdate("1", "Dune"), newUpdate("2", "Hyperion")},
+	},
+	{
+		name:        "replay-truncated",
+		description: "Updates older than the max-replay-age skipped from the replay, and replaced by a ReplayTruncated event having the ID of the last skipped one.",
+		history:     true,
+		query:       url.Values{"max-replay-age": {"3600"}},
+		lastEventID: "earliest",
+		before: []*mercure.Update{
+			newUpdate("urn:uuid:00dc6a61-cf00-7000-8000-000000000001", "Dune"),
+			newUpdate("urn:uuid:00dc6ab4-34c0-7000-8000-000000000002", "Hyperion"),
+		},
+	},
+	{
+		name:        "disconnection",
+		description: "The event sent before closing the connection of a subscriber disconnected by an administrator.",
+		options:     []mercure.Option{mercure.WithDisconnectEvents(0)},
+		during:      []*mercure.Update{newUpdate("1", "Dune")},
+		kick:        true,
+	},
+}
+
+// record returns the stream the hub writes in the scenario. It runs in a
+// synctest bubble, so the heartbeats are deterministic.
+func record(t *testing.T, sc scenario) []byte {
+	t.Helper()
+
+	var stream []byte
+
+	synctest.Test(t, func(t *testing.T) {
+		var (
+			transport mercure.Transport = mercure.NewLocalTransport(mercure.NewSubscriberList(0))
+			err       error
+		)
+
+		if sc.history {
+			transport, err = mercure.NewBoltTransport(mercure.NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, mercure.BoltDefaultCleanupFrequency)
+			require.NoError(t, err)
+		}
+
+		hub, err := mercure.NewHub(t.Context(), append([]mercure.Option{mercure.WithAnonymous(), mercure.WithTransport(transport)}, sc.options...)...)
+		require.NoError(t, err)
+
+		defer func() { require.NoError(t, hub.Stop(context.Background())) }()
+
+		for _, u := range sc.before {
+			require.NoError(t, hub.Publish(t.Context(), u))
+		}
+
+		query := url.Values{"match": {topic}}
+		for k, v := range sc.query {
+			query[k] = v
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+
+		req := httptest.NewRequest(http.MethodGet, "/.well-known/mercure?"+query.Encode(), nil).WithContext(ctx)
+		if sc.lastEventID != "" {
+			req.Header.Set("Last-Event-ID", sc.lastEventID)
+		}
+
+		w := &recorder{httptest.NewRecorder()}
+		done := make(chan struct{})
+
+		go func() {
+			defer close(done)
+
+			hub.SubscribeHandler(w, req)
+		}()
+
+		synctest.Wait()
+
+		for _, u := range sc.during {
+			require.NoError(t, hub.Publish(t.Context(), u))
+			synctest.Wait()
+		}
+
+		time.Sleep(sc.wait)
+		synctest.Wait()
+
+		if sc.kick {
+			_, err := hub.DisconnectSubscribers(t.Context(), &mercure.SubscriberSelector{Topics: []string{topic}}, false)
+			require.NoError(t, err)
+		} else {
+			cancel()
+		}
+
+		<-done
+
+		require.Equal(t, http.StatusOK, w.Code)
+		stream = w.Body.Bytes()
+	})
+
+	return stream
+}
+
+// TestVectors checks that the golden files match the output of the hub.
+// Run with -update to regenerate them.
+func TestVectors(t *testing.T) {
+	t.Parallel()
+
+	for _, sc := range scenarios {
+		t.Run(sc.name, func(t *testing.T) {
+			t.Parallel()
+
+			stream := record(t, sc)
+			base := filepath.Join(ssetest.VectorsDir, sc.name)
+
+			if *update {
+				result, err := ssetest.Parse(strings.NewReader(string(stream)))
+				require.NoError(t, err)
+
+				j, err := json.MarshalIndent(ssetest.Vector{Description: sc.description, Result: result}, "", "  ")
+				require.NoError(t, err)
+
+				require.NoError(t, os.WriteFile(base+".sse", stream, 0o644))
+				require.NoError(t, os.WriteFile(base+".json", append(j, '\n'), 0o644))
+
+				return
+			}
+
+			golden, err := os.ReadFile(base + ".sse")
+			require.NoError(t, err)
+			assert.Equal(t, string(golden), string(stream))
+		})
+	}
+}
+
+func TestVectorsEmbedded(t *testing.T) {
+	t.Parallel()
+
+	vectors, err := ssetest.Vectors()
+	require.NoError(t, err)
+	require.Len(t, vectors, len(scenarios))
+
+	for _, v := range vectors {
+		assert.NotEmpty(t, v.Description, v.Name)
+		assert.NotEmpty(t, v.Stream, v.Name)
+	}
+}
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	ssetest.Run(t, ssetest.Parse)
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	result, err := ssetest.Parse(strings.NewReader("\xef\xbb\xbfretry: 1000\r\nretry: x\nid: a\x00b\nid: 1\nevent: foo\rdata\n:comment\ndata:bar\n\nid\ndata: baz\n\ndata: incomplete\n"))
+	require.NoError(t, err)
+
+	assert.Equal(t, ssetest.Result{
+		Events: []ssetest.Event{
+			{Type: "foo", Data: "\nbar", LastEventID: "1"},
+			{Type: "message", Data: "baz"},
+		},
+		Retry: 1000,
+	}, result)
+}
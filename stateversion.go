@@ -0,0 +1,33 @@
+package mercure
+
+import (
+	"net/url"
+	"strconv"
+)
+
+const (
+	// paramStateVersion is the publish form field holding the state version of
+	// an update.
+	paramStateVersion = "state-version"
+	// paramIfStateVersionGt is the subscribe query parameter asking the hub to
+	// skip the updates whose state version is not greater than its value.
+	paramIfStateVersionGt = "if-state-version-gt"
+)
+
+// parseStateVersion reads an optional state version parameter. Missing and
+// empty values are 0, meaning "no version".
+func parseStateVersion(values url.Values, name string) (uint64, error) {
+	v := values.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseUint(v, 10, 64) //nolint:wrapcheck
+}
+
+// staleStateVersion reports whether u describes a state older than, or equal
+// to, the one the subscriber already has. Updates without a state version are
+// never stale.
+func (s *Subscriber) staleStateVersion(u *Update) bool {
+	return u.StateVersion != 0 && u.StateVersion <= s.RequestStateVersion
+}
@@ -0,0 +1,87 @@
+package mercure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltTransportStateVersion(t *testing.T) {
+	t.Parallel()
+
+	transport := createBoltTransport(t, 0, 0)
+
+	topics := []string{"https://example.com/books/1"}
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Event:        Event{ID: strconv.Itoa(i)},
+			Topic:        topics[0],
+			StateVersion: uint64(i),
+		}))
+	}
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "unversioned"}, Topic: topics[0]}))
+
+	s := NewLocalSubscriber(EarliestLastEventID, transport.logger, &TopicMatcherStore{})
+	s.RequestStateVersion = 2
+	s.setMatchers(stringsToExactMatchers(topics), nil)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	u := <-s.Receive()
+	assert.Equal(t, "3", u.ID)
+	assert.Equal(t, uint64(3), u.StateVersion)
+	assert.Equal(t, "unversioned", (<-s.Receive()).ID)
+	assert.Equal(t, EarliestLastEventID, <-s.responseLastEventID)
+
+	// Live updates are filtered too.
+	assert.Zero(t, s.Ready(t.Context()))
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "stale"}, Topic: topics[0], StateVersion: 1}))
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Event: Event{ID: "4"}, Topic: topics[0], StateVersion: 4}))
+	assert.Equal(t, "4", (<-s.Receive()).ID)
+}
+
+func TestSubscribeInvalidStateVersion(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?topic=foo&"+paramIfStateVersionGt+"=-1", nil)
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	resp := w.Result()
+
+	t.Cleanup(func() {
+		require.NoError(t, resp.Body.Close())
+	})
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestPublishStateVersion(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	for stateVersion, expected := range map[string]int{"12": http.StatusOK, "v12": http.StatusBadRequest} {
+		form := url.Values{"topic": {"https://example.com/books/1"}, paramStateVersion: {stateVersion}}
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		resp := w.Result()
+		require.NoError(t, resp.Body.Close())
+
+		assert.Equal(t, expected, resp.StatusCode, stateVersion)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"slices"
 	"time"
 
 	"go.opentelemetry.io/otel/attribute"
@@ -34,8 +35,10 @@ type responseController struct {
 	disconnectionTime time.Time
 	// writeDeadline is the JWT expiration date or time.Now() + hub.writeTimeout
 	writeDeadline time.Time
-	hub           *Hub
-	subscriber    *LocalSubscriber
+	// tokenExpiry reports whether writeDeadline is the JWT expiration date
+	tokenExpiry bool
+	hub         *Hub
+	subscriber  *LocalSubscriber
 }
 
 func (rc *responseController) setDispatchWriteDeadline(ctx context.Context) bool {
@@ -78,19 +81,20 @@ func (rc *responseController) flush(ctx context.Context) bool {
 }
 
 func (h *Hub) newResponseController(w http.ResponseWriter, s *LocalSubscriber) *responseController {
-	wd := h.getWriteDeadline(s)
+	wd, tokenExpiry := h.getWriteDeadline(s)
 
 	return &responseController{
 		*http.NewResponseController(w), // nolint:bodyclose
 		w,
 		wd.Add(-h.dispatchTimeout),
 		wd,
+		tokenExpiry,
 		h,
 		s,
 	}
 }
 
-func (h *Hub) getWriteDeadline(s *LocalSubscriber) (deadline time.Time) {
+func (h *Hub) getWriteDeadline(s *LocalSubscriber) (deadline time.Time, tokenExpiry bool) {
 	if h.writeTimeout != 0 {
 		deadline = time.Now().Add(randomizeWriteDeadline(h.writeTimeout))
 	}
@@ -98,9 +102,10 @@ func (h *Hub) getWriteDeadline(s *LocalSubscriber) (deadline time.Time) {
 	if s.Claims != nil && s.Claims.ExpiresAt != nil && (deadline.Equal(time.Time{}) || s.Claims.ExpiresAt.Before(deadline)) {
 		now := time.Now()
 		deadline = now.Add(randomizeWriteDeadline(s.Claims.ExpiresAt.Sub(now)))
+		tokenExpiry = true
 	}
 
-	return deadline
+	return deadline, tokenExpiry
 }
 
 // SubscribeHandler creates a keep alive connection and sends the events to the subscribers.
@@ -109,17 +114,42 @@ func (h *Hub) getWriteDeadline(s *LocalSubscriber) (deadline time.Time) {
 func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	s, rc := h.registerSubscriber(ctx, w, r)
-	if s == nil {
-		return
+	s, rc, pending := h.resumeSubscriber(ctx, w, r)
+	resumed := s != nil
+
+	if !resumed {
+		if s, rc = h.registerSubscriber(ctx, w, r); s == nil {
+			return
+		}
 	}
 
 	ctx = context.WithValue(ctx, SubscriberContextKey, &s.Subscriber)
 
-	defer h.shutdown(ctx, s)
+	var resumeToken string
+
+	reason := DisconnectReasonClient
+	defer func() {
+		if h.parkSubscriber(ctx, s, resumeToken, reason, pending) {
+			return
+		}
+
+		h.closeConnection(ctx, rc, s, reason)
+		h.shutdown(ctx, s, reason)
+	}()
 
 	rc.setDefaultWriteDeadline(ctx)
 
+	if h.resumes != nil && !s.timeTravel {
+		token := newResumeToken()
+		if !h.write(ctx, rc, h.resumeEvent(token, resumed)) {
+			reason = DisconnectReasonWriteFailed
+
+			return
+		}
+
+		resumeToken = token
+	}
+
 	var (
 		heartbeatTimer      *time.Timer
 		heartbeatTimerC     <-chan time.Time
@@ -149,6 +179,37 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 
 	debugLevel := rc.hub.logger.Enabled(ctx, slog.LevelDebug)
 
+	// The updates sent in delta mode.
+	var deltas jsonPatchWriter
+
+	// Read once the subscriber is added to the transport, not to miss the
+	// updates published meanwhile.
+	var snapshot snapshotFilter
+
+	if s.WithSnapshot && !s.RequestLastEventIDSet && !resumed {
+		updates := h.snapshot(s)
+		for _, u := range updates {
+			if !h.write(ctx, rc, subscriberEvent(s, &deltas, u)) {
+				reason = DisconnectReasonWriteFailed
+
+				return
+			}
+		}
+
+		snapshot = newSnapshotFilter(updates)
+	}
+
+	// The update whose write failed before the subscription was parked.
+	if pending != nil {
+		if !h.write(ctx, rc, subscriberEvent(s, &deltas, pending)) {
+			reason = DisconnectReasonWriteFailed
+
+			return
+		}
+
+		pending = nil
+	}
+
 	// On hub shutdown (Caddy "stopping" event, pod SIGTERM, …) we prefer to
 	// let each subscriber drain on its own per-connection write deadline
 	// (derived from writeTimeout, and optionally shortened by JWT expiry)
@@ -173,6 +234,8 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 				rc.hub.logger.LogAttrs(ctx, slog.LevelDebug, "Hub is shutting down, closing connection")
 			}
 
+			reason = DisconnectReasonHubShutdown
+
 			return
 		case <-ctx.Done():
 			if debugLevel {
@@ -182,16 +245,44 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		case <-heartbeatTimerC:
 			// Send an SSE comment as a heartbeat, to prevent issues with some proxies and old browsers
-			if !h.write(ctx, rc, ":\n") {
+			heartbeat := ":\n"
+			if h.subscriberStats {
+				heartbeat = statsComment(s)
+			}
+
+			if !h.write(ctx, rc, heartbeat) {
+				reason = DisconnectReasonWriteFailed
+
 				return
 			}
 
 			heartbeatTimer.Reset(h.heartbeat)
 		case <-disconnectionTimerC:
 			// Cleanly close the HTTP connection before the write deadline to prevent client-side errors
+			switch {
+			case rc.tokenExpiry:
+				reason = DisconnectReasonTokenExpired
+			case h.ctx.Err() != nil:
+				reason = DisconnectReasonHubShutdown
+			default:
+				reason = DisconnectReasonDeadline
+			}
+
 			return
 		case update, ok := <-s.Receive():
-			if !ok || !h.write(ctx, rc, newSerializedUpdate(update).event) {
+			if !ok {
+				// Disconnected by the transport.
+				return
+			}
+
+			if snapshot.skip(update) {
+				continue
+			}
+
+			if !h.write(ctx, rc, subscriberEvent(s, &deltas, update)) {
+				reason = DisconnectReasonWriteFailed
+				pending = update
+
 				return
 			}
 
@@ -210,8 +301,131 @@ func (h *Hub) SubscribeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// subscriberEvent serializes the event of the update for the subscriber.
+func subscriberEvent(s *LocalSubscriber, deltas *jsonPatchWriter, u *Update) string {
+	var event string
+	if s.JSONPatchDelta {
+		event = deltas.eventFor(u, s.Languages)
+	} else {
+		event = u.eventFor(s.Languages)
+	}
+
+	if s.Shared {
+		return matchFields(s, u) + event
+	}
+
+	return event
+}
+
+// ErrMissingTopicMatchers is returned by Subscribe when no topic matcher is given.
+var ErrMissingTopicMatchers = errors.New("at least one topic matcher is required")
+
+// Subscribe registers an in-process subscriber and returns the channel on which
+// matching updates are delivered, so Go code embedding the hub (background
+// workers, for instance) can consume updates without an SSE connection.
+//
+// Updates are matched exactly like for an HTTP subscriber: matchers selects the
+// topics, and private updates are only delivered when one of privateMatchers
+// (the equivalent of the subscribe authorization details of a token) matches
+// them too. The caller is trusted: authorizing the subscription is up to it.
+// The subscriptions requiring approval (see WithSubscriptionApproval) wait for
+// it though, and ErrSubscriptionRejected is returned when it isn't granted.
+//
+// The subscription ends, and the channel is closed, when ctx is done, when the
+// hub stops, or when the consumer does not read updates fast enough.
+func (h *Hub) Subscribe(ctx context.Context, matchers, privateMatchers []TopicMatcher) (<-chan *Update, error) {
+	if len(matchers) == 0 {
+		return nil, ErrMissingTopicMatchers
+	}
+
+	for _, m := range slices.Concat(matchers, privateMatchers) {
+		if err := validateProtocolMatcher(h.topicMatcherStore, m); err != nil {
+			return nil, fmt.Errorf("%q: %w", m.Pattern, err)
+		}
+	}
+
+	s := NewLocalSubscriber("", h.logger, h.topicMatcherStore)
+	s.AddressFamily = AddressFamilyInProcess
+	s.setMatchers(matchers, privateMatchers)
+
+	return h.addLocalSubscriber(ctx, s, "New in-process subscriber")
+}
+
+// addLocalSubscriber adds a subscriber whose updates are consumed from the
+// returned channel, until ctx is done, the hub stops, or the token of its
+// claims expires. Its matchers, claims and requested last event ID must be
+// set.
+func (h *Hub) addLocalSubscriber(ctx context.Context, s *LocalSubscriber, message string) (<-chan *Update, error) {
+	h.configureSubscriber(s)
+
+	ctx = context.WithValue(ctx, SubscriberContextKey, &s.Subscriber)
+	addCtx := context.WithoutCancel(ctx)
+
+	if err := h.awaitApproval(ctx, &s.Subscriber); err != nil {
+		return nil, err
+	}
+
+	if !h.acquireTenantConnection(ctx, s) {
+		return nil, ErrTenantQuotaExceeded
+	}
+
+	h.dispatchSubscriptionUpdate(addCtx, s, true)
+
+	if err := h.transport.AddSubscriber(addCtx, s); err != nil {
+		h.dispatchSubscriptionUpdate(addCtx, s, false)
+		h.releaseTenantConnection(s)
+
+		return nil, fmt.Errorf("unable to add subscriber: %w", err)
+	}
+
+	h.subscriberConnected(ctx, s, message)
+
+	go func() {
+		var expiryC <-chan time.Time
+		if s.Claims != nil && s.Claims.ExpiresAt != nil {
+			expiry := time.NewTimer(time.Until(s.Claims.ExpiresAt.Time))
+			defer expiry.Stop()
+
+			expiryC = expiry.C
+		}
+
+		reason := DisconnectReasonClient
+
+		select {
+		case <-ctx.Done():
+		case <-h.ctx.Done():
+			reason = DisconnectReasonHubShutdown
+		case <-expiryC:
+			reason = DisconnectReasonTokenExpired
+		}
+
+		h.shutdown(ctx, s, reason)
+	}()
+
+	return s.Receive(), nil
+}
+
 // registerSubscriber initializes the connection.
-func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *http.Request) (*LocalSubscriber, *responseController) { //nolint:funlen
+func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *http.Request) (*LocalSubscriber, *responseController) {
+	s, shareable := h.addSubscriber(ctx, w, r, true)
+	if s == nil {
+		return nil, nil
+	}
+
+	h.sendHeaders(ctx, w, s, shareable)
+	rc := h.newResponseController(w, s)
+	rc.flush(ctx)
+
+	h.subscriberConnected(ctx, s, "New subscriber")
+
+	return s, rc
+}
+
+// addSubscriber authorizes the subscription request and adds the subscriber
+// to the transport. It returns nil, after answering the request, when the
+// subscription is refused or only checked by a HEAD request. When cdn is
+// true, the subscription may be shareable by CDNs, see WithCDNFanOut.
+func (h *Hub) addSubscriber(ctx context.Context, w http.ResponseWriter, r *http.Request, cdn bool) (*LocalSubscriber, bool) { //nolint:funlen
 	ctx, span := startSpan(ctx, "mercure.subscribe", trace.WithSpanKind(trace.SpanKindConsumer))
 	defer span.End()
 
@@ -229,20 +443,71 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 		http.Error(w, http.StatusText(status), status)
 		recordSpanError(span, err)
 
-		return nil, nil
+		return nil, false
 	}
 
 	lastEventID, lastEventIDSet := h.retrieveLastEventID(ctx, r, values)
+	if lastEventID, err = h.parseLastEventID(lastEventID); err != nil {
+		http.Error(w, `Invalid "Last-Event-ID"`, http.StatusBadRequest)
+		recordSpanError(span, err)
+
+		return nil, false
+	}
 
 	s := NewLocalSubscriber(lastEventID, h.logger, h.topicMatcherStore)
 	s.RequestLastEventIDSet = lastEventIDSet
+	s.AddressFamily = requestAddressFamily(r)
+	h.configureSubscriber(s)
+
+	if s.RequestStateVersion, err = parseStateVersion(values, paramIfStateVersionGt); err != nil {
+		http.Error(w, `Invalid "`+paramIfStateVersionGt+`" parameter`, http.StatusBadRequest)
+		recordSpanError(span, err)
+
+		return nil, false
+	}
+
+	if s.ReplaySince, err = h.parseReplaySince(values); err != nil {
+		http.Error(w, `Invalid "`+paramMaxReplayAge+`" parameter`, http.StatusBadRequest)
+		recordSpanError(span, err)
+
+		return nil, false
+	}
+
+	if s.JSONPatchDelta, err = parseDelta(values); err != nil {
+		http.Error(w, `Invalid "`+paramDelta+`" parameter`, http.StatusBadRequest)
+		recordSpanError(span, err)
+
+		return nil, false
+	}
+
+	if s.WithSnapshot, err = parseWithSnapshot(values); err != nil {
+		http.Error(w, `Invalid "`+paramWithSnapshot+`" parameter`, http.StatusBadRequest)
+		recordSpanError(span, err)
+
+		return nil, false
+	}
+
+	if s.Shared, err = parseShared(values); err != nil {
+		http.Error(w, `Invalid "`+paramShared+`" parameter`, http.StatusBadRequest)
+		recordSpanError(span, err)
+
+		return nil, false
+	}
+
+	tt, err := h.parseTimeTravel(values)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		recordSpanError(span, err)
+
+		return nil, false
+	}
 
 	var claims *claims
 
-	if h.subscriberConfigured { //nolint:nestif
+	if h.subscriberConfigured || h.capabilityAEAD != nil { //nolint:nestif
 		var err error
 
-		claims, err = h.authorize(r, false)
+		claims, err = h.authorizeSubscriber(r, values)
 		if claims != nil {
 			s.Claims = claims
 		}
@@ -254,10 +519,12 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 				recordSpanError(span, err)
 			}
 
-			return nil, nil
+			return nil, false
 		}
 	}
 
+	s.Languages = subscriberLanguages(claims, r)
+
 	deprecated := h.isBackwardCompatiblyEnabledWith(8)
 
 	matchers, err := h.parseMatchers(values, deprecated)
@@ -265,7 +532,33 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 		h.writeMatcherParamError(ctx, w, err)
 		recordSpanError(span, err)
 
-		return nil, nil
+		return nil, false
+	}
+
+	if h.authorizationWebhook != nil {
+		if claims, err = h.authorizeSubscription(ctx, h.httpCaller(r), claims, matchers); err != nil {
+			h.writeAuthorizationError(w, r, err)
+			recordSpanError(span, err)
+
+			return nil, false
+		}
+
+		s.Claims = claims
+	}
+
+	if claims == nil && h.guestCookieName != "" {
+		s.GuestID = GuestPublicID(h.guestSession(w, r))
+	}
+
+	shareable := cdn && tt == nil && !s.Shared && h.shareableSubscription(r, &s.Subscriber)
+	if shareable {
+		// CDNs key shared streams on the URL: make it a function of the
+		// matchers alone.
+		if q := canonicalSubscribeQuery(h.topicMatcherStore, values, deprecated); q != r.URL.RawQuery {
+			http.Redirect(w, r, r.URL.EscapedPath()+"?"+q, http.StatusPermanentRedirect)
+
+			return nil, false
+		}
 	}
 
 	var privateTopicMatchers []TopicMatcher
@@ -273,6 +566,23 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 		privateTopicMatchers = claims.authz.subscribeMatchers()
 	}
 
+	if s.GuestID != "" {
+		matchers, privateTopicMatchers = withInbox(matchers, privateTopicMatchers, inboxMatcher(GuestInboxTopic(s.GuestID)))
+	}
+
+	if h.userInboxes {
+		inbox, ok := userInbox(claims)
+		if subscribesToOtherUserInbox(matchers, inbox) {
+			h.writeBearerError(w, bearerErrInsufficientScope, http.StatusForbidden)
+
+			return nil, false
+		}
+
+		if ok {
+			matchers, privateTopicMatchers = withInbox(matchers, privateTopicMatchers, inbox)
+		}
+	}
+
 	s.setMatchers(matchers, privateTopicMatchers)
 
 	if span.IsRecording() {
@@ -282,12 +592,68 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 		)
 	}
 
+	// A HEAD request checks the subscription without opening the stream:
+	// nothing is awaited, reserved, or added to the transport.
+	if r.Method == http.MethodHead {
+		h.setStreamHeaders(w.Header(), s, shareable)
+		w.WriteHeader(http.StatusOK)
+
+		return nil, false
+	}
+
+	var window []*Update
+
+	if tt != nil {
+		if window, err = tt.load(ctx, h.transport, s); err != nil {
+			switch {
+			case errors.Is(err, errTimeTravelNotSupported):
+				http.Error(w, err.Error(), http.StatusNotImplemented)
+			case errors.Is(err, errTimeTravelFromNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+			default:
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			}
+
+			recordSpanError(span, err)
+
+			return nil, false
+		}
+	}
+
+	if err := h.awaitApproval(ctx, &s.Subscriber); err != nil {
+		writeApprovalError(w, err)
+		recordSpanError(span, err)
+
+		return nil, false
+	}
+
+	if !h.acquireTenantConnection(ctx, s) {
+		http.Error(w, ErrTenantQuotaExceeded.Error(), http.StatusTooManyRequests)
+
+		return nil, false
+	}
+
 	addCtx := context.WithoutCancel(ctx)
 	h.dispatchSubscriptionUpdate(addCtx, s, true)
 
+	if tt != nil {
+		// Time-travel subscribers don't receive the live updates: they are
+		// not added to the transport.
+		s.timeTravel = true
+
+		if s.RequestLastEventIDSet {
+			s.responseLastEventID <- s.RequestLastEventID
+		}
+
+		go tt.replay(ctx, s, window)
+
+		return s, false
+	}
+
 	if err := h.transport.AddSubscriber(addCtx, s); err != nil {
 		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
 		h.dispatchSubscriptionUpdate(addCtx, s, false)
+		h.releaseTenantConnection(s)
 
 		if h.logger.Enabled(ctx, slog.LevelError) {
 			h.logger.LogAttrs(ctx, slog.LevelError, "Unable to add subscriber", slog.Any("error", err))
@@ -295,24 +661,24 @@ func (h *Hub) registerSubscriber(ctx context.Context, w http.ResponseWriter, r *
 
 		recordSpanError(span, err)
 
-		return nil, nil
+		return nil, false
 	}
 
-	h.sendHeaders(ctx, w, s)
-	rc := h.newResponseController(w, s)
-	rc.flush(ctx)
+	return s, shareable
+}
 
+// subscriberConnected logs and records the connection of the subscriber.
+func (h *Hub) subscriberConnected(ctx context.Context, s *LocalSubscriber, message string) {
 	if h.logger.Enabled(ctx, slog.LevelInfo) {
-		if claims != nil && h.logger.Enabled(ctx, slog.LevelDebug) {
-			h.logger.LogAttrs(ctx, slog.LevelInfo, "New subscriber", slog.Any("payload", s.SubscriptionPayloads))
+		if s.Claims != nil && h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelInfo, message, slog.Any("payload", s.SubscriptionPayloads))
 		} else {
-			h.logger.LogAttrs(ctx, slog.LevelInfo, "New subscriber")
+			h.logger.LogAttrs(ctx, slog.LevelInfo, message)
 		}
 	}
 
+	h.dispatchQueues.add(s)
 	h.metrics.SubscriberConnected(s)
-
-	return s, rc
 }
 
 //nolint:gochecknoglobals
@@ -327,9 +693,25 @@ var (
 )
 
 // sendHeaders sends correct HTTP headers to create a keep-alive connection.
-func (h *Hub) sendHeaders(ctx context.Context, w http.ResponseWriter, s *LocalSubscriber) {
+// The stream is publicly cacheable when shareable (see WithCDNFanOut).
+func (h *Hub) sendHeaders(ctx context.Context, w http.ResponseWriter, s *LocalSubscriber, shareable bool) {
 	header := w.Header()
 
+	if s.RequestLastEventIDSet {
+		header["Mercure-Last-Event-Id"] = []string{<-s.responseLastEventID}
+	}
+
+	h.setStreamHeaders(header, s, shareable)
+
+	// Write a comment in the body
+	// Go currently doesn't provide a better way to flush the headers
+	if _, err := w.Write([]byte{':', '\n'}); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write comment", slog.Any("error", err))
+	}
+}
+
+// setStreamHeaders sets the headers of the stream of the subscriber.
+func (h *Hub) setStreamHeaders(header http.Header, s *LocalSubscriber, shareable bool) {
 	// Keep alive, useful only for HTTP 1 clients https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Keep-Alive
 	header["Connection"] = headerConnection
 
@@ -343,15 +725,11 @@ func (h *Hub) sendHeaders(ctx context.Context, w http.ResponseWriter, s *LocalSu
 	// NGINX support https://www.nginx.com/resources/wiki/start/topics/examples/x-accel/#x-accel-buffering
 	header["X-Accel-Buffering"] = headerXAccelBuffering
 
-	if s.RequestLastEventIDSet {
-		header["Mercure-Last-Event-Id"] = []string{<-s.responseLastEventID}
+	if shareable {
+		h.setCDNHeaders(header)
 	}
 
-	// Write a comment in the body
-	// Go currently doesn't provide a better way to flush the headers
-	if _, err := w.Write([]byte{':', '\n'}); err != nil && h.logger.Enabled(ctx, slog.LevelInfo) {
-		h.logger.LogAttrs(ctx, slog.LevelInfo, "Failed to write comment", slog.Any("error", err))
-	}
+	h.setResponseHeaders(header, EndpointSubscribe, s.SubscribedMatchers)
 }
 
 // subscribeValues returns the subscription parameters. For GET and HEAD they
@@ -421,11 +799,14 @@ func (h *Hub) retrieveLastEventID(ctx context.Context, r *http.Request, query ur
 // Write sends the given string to the client.
 // It returns false if the subscriber has been disconnected (e.g. timeout).
 func (h *Hub) write(ctx context.Context, rc *responseController, data string) bool {
-	if !rc.setDispatchWriteDeadline(ctx) {
+	if !h.throttleWrite(ctx, rc.subscriber, len(data)) || !rc.setDispatchWriteDeadline(ctx) {
 		return false
 	}
 
-	if _, err := rc.rw.Write([]byte(data)); err != nil && h.logger.Enabled(ctx, slog.LevelDebug) {
+	n, err := rc.rw.Write([]byte(data))
+	h.countWritten(rc.subscriber, n)
+
+	if err != nil && h.logger.Enabled(ctx, slog.LevelDebug) {
 		h.logger.LogAttrs(ctx, slog.LevelDebug, "Failed to write comment", slog.Any("error", err))
 
 		return false
@@ -434,9 +815,9 @@ func (h *Hub) write(ctx context.Context, rc *responseController, data string) bo
 	return rc.flush(ctx) && rc.setDefaultWriteDeadline(ctx)
 }
 
-func (h *Hub) shutdown(ctx context.Context, s *LocalSubscriber) {
+func (h *Hub) shutdown(ctx context.Context, s *LocalSubscriber, reason DisconnectReason) {
 	// Notify that the client is closing the connection
-	s.Disconnect()
+	s.DisconnectWithReason(reason)
 
 	ctx = context.WithoutCancel(ctx)
 
@@ -447,10 +828,14 @@ func (h *Hub) shutdown(ctx context.Context, s *LocalSubscriber) {
 	h.dispatchSubscriptionUpdate(ctx, s, false)
 
 	if h.logger.Enabled(ctx, slog.LevelInfo) {
-		h.logger.LogAttrs(ctx, slog.LevelInfo, "Subscriber disconnected")
+		h.logger.LogAttrs(ctx, slog.LevelInfo, "Subscriber disconnected", slog.String("reason", string(s.disconnectReason)))
 	}
 
+	h.releaseTenantConnection(s)
+	h.releaseBandwidth(s)
+	h.dispatchQueues.remove(s)
 	h.metrics.SubscriberDisconnected(s)
+	h.alerter.record(AlertConnectionDrop)
 }
 
 func (h *Hub) dispatchSubscriptionUpdate(ctx context.Context, s *LocalSubscriber, active bool) {
@@ -477,8 +862,12 @@ func (h *Hub) dispatchSubscriptionUpdate(ctx context.Context, s *LocalSubscriber
 			Event:   Event{Data: string(j), Type: reservedEventType},
 		}
 
-		if err := h.transport.Dispatch(ctx, u); err != nil && h.logger.Enabled(ctx, slog.LevelError) {
-			h.logger.LogAttrs(ctx, slog.LevelError, "Failed to dispatch update", slog.Any("update", u), slog.Any("subscription", subscription.ID), slog.Any("error", err))
+		if err := h.transport.Dispatch(ctx, u); err != nil {
+			if h.logger.Enabled(ctx, slog.LevelError) {
+				h.logger.LogAttrs(ctx, slog.LevelError, "Failed to dispatch update", slog.Any("update", u), slog.Any("subscription", subscription.ID), slog.Any("error", err))
+			}
+
+			h.recordDispatchError(err)
 		}
 	}
 }
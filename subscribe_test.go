@@ -499,6 +499,37 @@ func subscribe(tb testing.TB, numberOfSubscribers int) {
 	wg.Wait()
 }
 
+func TestSubscribeHeadMethod(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	req := httptest.NewRequest(http.MethodHead, defaultHubURL+"?match=https://example.com/books/1", nil)
+	req.Header.Set("Authorization", bearerPrefix+createDummyAuthorizedJWT(roleSubscriber, []string{"*"}))
+	req.Header.Set("Last-Event-ID", "a")
+
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	resp := w.Result()
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Mercure-Last-Event-Id"))
+	assert.Empty(t, w.Body.String())
+	assert.Zero(t, hub.transport.(*LocalTransport).subscribers.Len())
+
+	req = httptest.NewRequest(http.MethodHead, defaultHubURL+"?match=https://example.com/books/1", nil)
+	w = httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+
+	resp = w.Result()
+	require.NoError(t, resp.Body.Close())
+
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
+
 func TestSubscribe(t *testing.T) {
 	t.Parallel()
 
@@ -1347,3 +1378,126 @@ func TestShutdownClosesSubscribersWhenWriteTimeoutDisabled(t *testing.T) {
 		assert.Equal(t, 0, n, "subscriber must exit on hub shutdown when writeTimeout is 0")
 	})
 }
+
+func TestSubscribeInProcess(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+	transport := hub.transport.(*LocalTransport)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	updates, err := hub.Subscribe(ctx,
+		[]TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/:id"}},
+		[]TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/books/2"}},
+	)
+	require.NoError(t, err)
+	waitSubscribers(t, transport, 1)
+
+	for _, u := range []*Update{
+		{Topic: "https://example.com/books/1", Event: Event{Data: "public"}},
+		{Topic: "https://example.com/books/1", Private: true, Event: Event{Data: "private, not allowed"}},
+		{Topic: "https://example.com/authors/1", Event: Event{Data: "not subscribed"}},
+		{Topic: "https://example.com/books/2", Private: true, Event: Event{Data: "private, allowed"}},
+	} {
+		require.NoError(t, hub.Publish(t.Context(), u))
+	}
+
+	assert.Equal(t, "public", (<-updates).Data)
+	assert.Equal(t, "private, allowed", (<-updates).Data)
+
+	cancel()
+	waitSubscribers(t, transport, 0)
+
+	_, ok := <-updates
+	assert.False(t, ok)
+}
+
+func TestSubscribeInProcessCallbacks(t *testing.T) {
+	t.Parallel()
+
+	r := &callbackRecorder{}
+	hub := createAnonymousDummy(t, WithSubscriberCallbacks(r.callbacks()))
+	transport := hub.transport.(*LocalTransport)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	updates, err := hub.Subscribe(ctx, []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/books/1"}}, nil)
+	require.NoError(t, err)
+	waitSubscribers(t, transport, 1)
+
+	u := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, hub.Publish(t.Context(), u))
+	<-updates
+
+	cancel()
+	waitSubscribers(t, transport, 0)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	assert.Equal(t, []*Update{u}, r.firstDeliveries)
+	assert.Equal(t, []DisconnectReason{DisconnectReasonClient}, r.disconnectReasons)
+}
+
+func TestSubscribeInProcessInvalidMatchers(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t)
+
+	_, err := hub.Subscribe(t.Context(), nil, nil)
+	require.ErrorIs(t, err, ErrMissingTopicMatchers)
+
+	_, err = hub.Subscribe(t.Context(), []TopicMatcher{{Type: "regexp", Pattern: ".*"}}, nil)
+	require.ErrorIs(t, err, ErrUnsupportedMatcherType)
+
+	_, err = hub.Subscribe(t.Context(), []TopicMatcher{{Type: MatcherTypeExact, Pattern: "foo\x00"}}, nil)
+	require.ErrorIs(t, err, errInvalidMatcherValue)
+}
+
+func FuzzRetrieveLastEventID(f *testing.F) {
+	hub := createDummy(f)
+
+	for _, tc := range [][3]string{
+		{"", "", ""},
+		{"urn:uuid:4b6ee6ac-1b3d-4b5e-b5e6-0a3b0d5e6e4f", "", ""},
+		{"", EarliestLastEventID, ""},
+		{"a", "b", "c"},
+		{"", "", "legacy"},
+	} {
+		f.Add(tc[0], tc[1], tc[2])
+	}
+
+	f.Fuzz(func(t *testing.T, header, query, legacy string) {
+		values := url.Values{}
+		if query != "" {
+			values.Set("last_event_id", query)
+		}
+
+		if legacy != "" {
+			values.Set("Last-Event-ID", legacy)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, defaultHubURL, nil)
+		if header != "" {
+			req.Header.Set("Last-Event-ID", header)
+		}
+
+		id, ok := hub.retrieveLastEventID(t.Context(), req, values)
+
+		switch {
+		case header != "":
+			assert.Equal(t, header, id)
+			assert.True(t, ok)
+		case query != "":
+			assert.Equal(t, query, id)
+			assert.True(t, ok)
+		default:
+			// The legacy parameter is only honored in compatibility mode.
+			assert.Empty(t, id)
+			assert.False(t, ok)
+		}
+	})
+}
@@ -79,7 +79,7 @@ func (h *Hub) parseMatchers(query url.Values, deprecated bool) ([]TopicMatcher,
 			continue
 		}
 
-		matcherType, ok := matcherTypeFromParam(key)
+		matcherType, ok := matcherTypeFromParam(h.topicMatcherStore, key)
 		if !ok {
 			// Reject anything in the reserved "match" namespace that is not a
 			// valid matcher parameter (an unknown matcher type or a case typo
@@ -111,9 +111,9 @@ func (h *Hub) parseMatchers(query url.Values, deprecated bool) ([]TopicMatcher,
 // matcherTypeFromParam maps a subscribe query parameter name to its matcher
 // type. Bare "match" is the Exact default (mirroring the optional match_type of
 // authorization details); "match_<matcher_type>" selects that type. The boolean
-// is false when the name is not in the "match" namespace or names an unknown
-// matcher type.
-func matcherTypeFromParam(key string) (MatcherType, bool) {
+// is false when the name is not in the "match" namespace or names a matcher
+// type the store doesn't support.
+func matcherTypeFromParam(tms *TopicMatcherStore, key string) (MatcherType, bool) {
 	if key == paramMatch {
 		return MatcherTypeExact, true
 	}
@@ -127,7 +127,7 @@ func matcherTypeFromParam(key string) (MatcherType, bool) {
 	// deprecated type) is rejected.
 	mt := MatcherType(suffix)
 
-	return mt, knownMatcherType(mt)
+	return mt, tms.supportsMatcherType(mt)
 }
 
 // appendMatchers validates each value of one topic matcher query parameter
@@ -25,6 +25,24 @@ func TestParseMatchersDeprecatedTopic(t *testing.T) {
 	assert.Equal(t, "https://example.com/{id}", matchers[1].Pattern)
 }
 
+func TestParseMatchersDeprecatedTopicRegexp(t *testing.T) {
+	t.Parallel()
+
+	h := createDeprecatedDummy(t, WithRegexpTopicMatchers())
+
+	query := url.Values{"topic": {"regexp:^https://example\\.com/", "https://example.com/{id}"}}
+	matchers, err := h.parseMatchers(query, true)
+	require.NoError(t, err)
+
+	assert.Equal(t, []TopicMatcher{
+		{Type: MatcherTypeRegexp, Pattern: "^https://example\\.com/"},
+		{Type: deprecatedMatcherTypeName, Pattern: "https://example.com/{id}"},
+	}, matchers)
+
+	_, err = h.parseMatchers(url.Values{"topic": {"regexp:(a"}}, true)
+	require.ErrorIs(t, err, errInvalidMatcherPattern)
+}
+
 // TestParseMatchersURLPatternInCompatMode checks that the modern parameters
 // remain available when compatibility mode is enabled.
 func TestParseMatchersURLPatternInCompatMode(t *testing.T) {
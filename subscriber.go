@@ -4,6 +4,9 @@ import (
 	"log/slog"
 	"net/url"
 	"strings"
+	"time"
+
+	"golang.org/x/text/language"
 )
 
 // Subscriber represents a client subscribed to a list of topics on a remote or on the current hub.
@@ -17,6 +20,33 @@ type Subscriber struct {
 	// with an empty value: the protocol requires answering with a
 	// Mercure-Last-Event-ID response field whenever one was present.
 	RequestLastEventIDSet bool
+	// RequestStateVersion is the state version the subscriber already has,
+	// from the if-state-version-gt query parameter. Versioned updates not
+	// newer than it are skipped. Zero disables the filter.
+	RequestStateVersion uint64
+	// ReplaySince is the publication date before which the updates of the
+	// history are not replayed to the subscriber (see WithMaxReplayAge). The
+	// zero time means no limit.
+	ReplaySince time.Time
+	// GuestID is the public ID of the guest session of an anonymous
+	// subscriber, when guest sessions are enabled (see WithGuestSessions and
+	// GuestPublicID). The secret ID of the session is never stored.
+	GuestID string
+	// Languages are the preferred languages of the subscriber, selecting the
+	// variant of the localized updates it receives (see Update.LocalizedData).
+	Languages []language.Tag
+	// JSONPatchDelta reports whether the subscriber requested JSON Patch
+	// deltas instead of the full data of the JSON updates (see
+	// WithJSONPatchDeltas).
+	JSONPatchDelta bool
+	// WithSnapshot reports whether the subscriber requested the retained
+	// values of the subscribed topics before the live updates (see
+	// WithRetainedValues).
+	WithSnapshot bool
+	// Shared reports whether the connection is shared by several clients,
+	// the events carrying the subscribed matchers matching their topics (see
+	// WithBroadcastScript).
+	Shared bool
 
 	// SubscribedMatchers are the topic matchers from the topic and
 	// match_urlpattern query parameters (or from the v8 `topic` parameter,
@@ -231,6 +261,7 @@ func (s *Subscriber) getSubscriptions(filter subscriptionFilter, active bool) []
 			Type:       "subscription",
 			Subscriber: s.ID,
 			Active:     active,
+			Guest:      s.GuestID,
 		}
 
 		// Deprecated v8 subscriptions keep emitting the `topic` field (and
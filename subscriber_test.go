@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"log/slog"
 	"strconv"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -104,3 +105,141 @@ func TestSubscriberDoesNotBlockWhenChanIsFull(t *testing.T) {
 	for range s.Receive() { //nolint:revive
 	}
 }
+
+// callbackRecorder records the calls of the lifecycle callbacks.
+type callbackRecorder struct {
+	mu                sync.Mutex
+	firstDeliveries   []*Update
+	historyReplayed   []string
+	disconnectReasons []DisconnectReason
+}
+
+func (r *callbackRecorder) callbacks() SubscriberCallbacks {
+	return SubscriberCallbacks{
+		OnFirstDelivery: func(_ *LocalSubscriber, u *Update) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.firstDeliveries = append(r.firstDeliveries, u)
+		},
+		OnHistoryReplayed: func(_ *LocalSubscriber, lastEventID string) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.historyReplayed = append(r.historyReplayed, lastEventID)
+		},
+		OnDisconnect: func(_ *LocalSubscriber, reason DisconnectReason) {
+			r.mu.Lock()
+			defer r.mu.Unlock()
+
+			r.disconnectReasons = append(r.disconnectReasons, reason)
+		},
+	}
+}
+
+func TestSubscriberCallbacks(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	r := &callbackRecorder{}
+
+	s := NewLocalSubscriber("1", slog.Default(), &TopicMatcherStore{})
+	s.SetCallbacks(r.callbacks())
+
+	live := &Update{Event: Event{ID: "live"}}
+	history := &Update{Event: Event{ID: "history"}}
+
+	// Queued until the subscriber is ready.
+	assert.True(t, s.Dispatch(ctx, live, false))
+	assert.Empty(t, r.firstDeliveries)
+
+	assert.True(t, s.Dispatch(ctx, history, true))
+	s.HistoryDispatched("history")
+	assert.Equal(t, 1, s.Ready(ctx))
+	assert.True(t, s.Dispatch(ctx, &Update{}, false))
+
+	s.DisconnectWithReason(DisconnectReasonKicked)
+	s.Disconnect()
+
+	assert.Equal(t, []*Update{history}, r.firstDeliveries)
+	assert.Equal(t, []string{"history"}, r.historyReplayed)
+	assert.Equal(t, []DisconnectReason{DisconnectReasonKicked}, r.disconnectReasons)
+}
+
+func TestSubscriberCallbacksSlowConsumer(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	r := &callbackRecorder{}
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetCallbacks(r.callbacks())
+	s.Ready(ctx)
+
+	for i := 0; i <= outBufferLength; i++ {
+		s.Dispatch(ctx, &Update{}, false)
+	}
+
+	s.Disconnect()
+
+	assert.Len(t, r.firstDeliveries, 1)
+	assert.Empty(t, r.historyReplayed)
+	assert.Equal(t, []DisconnectReason{DisconnectReasonSlowConsumer}, r.disconnectReasons)
+}
+
+func TestSubscriberDropsLowPriorityUpdatesFirst(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+
+	var dropped []string
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetCallbacks(SubscriberCallbacks{OnDrop: func(_ *LocalSubscriber, u *Update) {
+		dropped = append(dropped, u.ID)
+	}})
+	s.Ready(ctx)
+
+	s.Dispatch(ctx, &Update{Event: Event{ID: "low"}, Priority: -1}, false)
+
+	for i := range outBufferLength - 1 {
+		s.Dispatch(ctx, &Update{Event: Event{ID: strconv.Itoa(i)}}, false)
+	}
+
+	// The buffer is full: the updates of the lowest priority are dropped
+	// first, the oldest if several have it, and the subscriber stays
+	// connected.
+	assert.True(t, s.Dispatch(ctx, &Update{Event: Event{ID: "high"}, Priority: 1}, false))
+	assert.True(t, s.Dispatch(ctx, &Update{Event: Event{ID: "low2"}, Priority: -1}, false))
+	assert.True(t, s.Dispatch(ctx, &Update{Event: Event{ID: "normal"}}, false))
+
+	assert.Equal(t, []string{"low", "low2", "0"}, dropped)
+	assert.Equal(t, SubscriberStats{Delivered: outBufferLength, Dropped: 3}, s.Stats())
+
+	s.Disconnect()
+
+	var ids []string
+	for u := range s.Receive() {
+		ids = append(ids, u.ID)
+	}
+
+	require.Len(t, ids, outBufferLength)
+	assert.Equal(t, "1", ids[0])
+	assert.Equal(t, []string{"998", "high", "normal"}, ids[outBufferLength-3:])
+}
+
+func TestSubscriberDisconnectedWhenPrioritiesAreEqual(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.Ready(ctx)
+
+	for range outBufferLength {
+		s.Dispatch(ctx, &Update{Priority: 1}, false)
+	}
+
+	assert.False(t, s.Dispatch(ctx, &Update{Priority: 1}, false))
+	assert.Equal(t, SubscriberStats{Delivered: outBufferLength, Dropped: 1}, s.Stats())
+}
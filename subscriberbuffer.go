@@ -0,0 +1,115 @@
+package mercure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// DefaultSubscriberBufferSize is the default number of updates waiting to be
+// sent to a subscriber.
+const DefaultSubscriberBufferSize = 1000
+
+// ErrInvalidSubscriberBuffer is returned by NewHub when the size or the
+// overflow policy of the buffer of the subscribers is not valid.
+var ErrInvalidSubscriberBuffer = errors.New("invalid subscriber buffer")
+
+// OverflowPolicy is what happens when an update doesn't fit in the buffer of a
+// subscriber not receiving the updates fast enough.
+type OverflowPolicy string
+
+const (
+	// OverflowDisconnect disconnects the subscriber, which catches up with
+	// the history when reconnecting (see DisconnectReasonSlowConsumer). It
+	// is the default.
+	OverflowDisconnect OverflowPolicy = "disconnect"
+	// OverflowDropOldest drops the oldest update of the buffer to make room,
+	// the subscriber staying connected.
+	OverflowDropOldest OverflowPolicy = "drop-oldest"
+	// OverflowDropNewest drops the update that doesn't fit, the subscriber
+	// staying connected.
+	OverflowDropNewest OverflowPolicy = "drop-newest"
+)
+
+// SubscriberBufferMetrics may be implemented by the Metrics counting the
+// overflows of the buffers of the subscribers.
+type SubscriberBufferMetrics interface {
+	// SubscriberBufferOverflowed collects an update that didn't fit in the
+	// buffer of a subscriber, with the overflow policy applied.
+	SubscriberBufferOverflowed(policy OverflowPolicy)
+}
+
+// WithSubscriberBuffer sets the number of updates waiting to be sent to a
+// subscriber (DefaultSubscriberBufferSize when 0), and what happens when a
+// subscriber not receiving them fast enough fills its buffer (OverflowDisconnect
+// when empty). Whatever the policy, the updates of the lowest priority are
+// dropped first (see Update.Priority).
+//
+// Larger buffers absorb longer bursts at the cost of memory: every subscriber
+// allocates its buffer when it connects.
+func WithSubscriberBuffer(size int, policy OverflowPolicy) Option {
+	return func(o *opt) error {
+		if size < 0 {
+			return fmt.Errorf("%w: negative size %d", ErrInvalidSubscriberBuffer, size)
+		}
+
+		switch policy {
+		case "":
+			policy = OverflowDisconnect
+		case OverflowDisconnect, OverflowDropOldest, OverflowDropNewest:
+		default:
+			return fmt.Errorf("%w: unknown overflow policy %q", ErrInvalidSubscriberBuffer, policy)
+		}
+
+		if size == 0 {
+			size = DefaultSubscriberBufferSize
+		}
+
+		o.subscriberBufferSize = size
+		o.overflowPolicy = policy
+
+		return nil
+	}
+}
+
+// SetBuffer sets the size of the buffer of the subscriber, and the overflow
+// policy applied when it is full. It must be called before adding the
+// subscriber to a transport.
+func (s *LocalSubscriber) SetBuffer(size int, policy OverflowPolicy) {
+	if size != cap(s.out) {
+		s.out = make(chan *Update, size)
+	}
+
+	s.overflowPolicy = policy
+}
+
+// configureSubscriber sets the buffer, the shedding and the callbacks of a
+// new subscriber.
+func (h *Hub) configureSubscriber(s *LocalSubscriber) {
+	if h.subscriberBufferSize != 0 {
+		s.SetBuffer(h.subscriberBufferSize, h.overflowPolicy)
+	}
+
+	if h.dispatchWatermark != 0 {
+		s.shedding = h.dispatchQueues
+	}
+
+	s.SetCallbacks(h.subscriberCallbacks)
+}
+
+// observeSubscriberBufferOverflows registers the callback collecting the
+// overflows, when the metrics support it.
+func (o *opt) observeSubscriberBufferOverflows() {
+	m, ok := o.metrics.(SubscriberBufferMetrics)
+	if !ok {
+		return
+	}
+
+	onOverflow := o.subscriberCallbacks.OnOverflow
+	o.subscriberCallbacks.OnOverflow = func(s *LocalSubscriber, policy OverflowPolicy) {
+		if onOverflow != nil {
+			onOverflow(s, policy)
+		}
+
+		m.SubscriberBufferOverflowed(policy)
+	}
+}
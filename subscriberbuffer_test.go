@@ -0,0 +1,96 @@
+package mercure
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithSubscriberBuffer(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithSubscriberBuffer(-1, ""))
+	require.ErrorIs(t, err, ErrInvalidSubscriberBuffer)
+
+	_, err = NewHub(t.Context(), WithSubscriberBuffer(10, "drop-all"))
+	require.ErrorIs(t, err, ErrInvalidSubscriberBuffer)
+
+	m := NewPrometheusMetrics(nil)
+	hub := createDummy(t, WithSubscriberBuffer(2, OverflowDropOldest), WithMetrics(m))
+
+	matchers := []TopicMatcher{{Type: MatcherTypeExact, Pattern: "https://example.com/metrics"}}
+	updates, err := hub.Subscribe(t.Context(), matchers, nil)
+	require.NoError(t, err)
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/metrics", Event: Event{ID: id}}))
+	}
+
+	assert.Equal(t, "2", (<-updates).ID)
+	assert.Equal(t, "3", (<-updates).ID)
+	assertCounterValue(t, 1.0, m.bufferOverflowsTotal.WithLabelValues(string(OverflowDropOldest)))
+}
+
+func TestSubscriberOverflowPolicies(t *testing.T) {
+	t.Parallel()
+
+	for _, tc := range []struct {
+		name        string
+		policy      OverflowPolicy
+		updates     []*Update
+		expectedIDs []string
+	}{
+		{"drop oldest", OverflowDropOldest, []*Update{{Event: Event{ID: "1"}}, {Event: Event{ID: "2"}}, {Event: Event{ID: "3"}}}, []string{"2", "3"}},
+		{"drop newest", OverflowDropNewest, []*Update{{Event: Event{ID: "1"}}, {Event: Event{ID: "2"}}, {Event: Event{ID: "3"}}}, []string{"1", "2"}},
+		// The updates of the lowest priority are dropped first.
+		{"drop oldest of lowest priority", OverflowDropOldest, []*Update{{Event: Event{ID: "1"}, Priority: 1}, {Event: Event{ID: "2"}}, {Event: Event{ID: "3"}, Priority: 1}}, []string{"1", "3"}},
+		{"drop newest of lowest priority", OverflowDropNewest, []*Update{{Event: Event{ID: "1"}}, {Event: Event{ID: "2"}, Priority: -1}, {Event: Event{ID: "3"}}}, []string{"1", "3"}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := t.Context()
+
+			var overflows []OverflowPolicy
+
+			s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+			s.SetBuffer(2, tc.policy)
+			s.SetCallbacks(SubscriberCallbacks{OnOverflow: func(_ *LocalSubscriber, policy OverflowPolicy) {
+				overflows = append(overflows, policy)
+			}})
+			s.Ready(ctx)
+
+			for _, u := range tc.updates {
+				assert.True(t, s.Dispatch(ctx, u, false))
+			}
+
+			assert.Equal(t, []OverflowPolicy{tc.policy}, overflows)
+			assert.Equal(t, SubscriberStats{Delivered: 2, Dropped: 1}, s.Stats())
+
+			s.Disconnect()
+
+			var ids []string
+			for u := range s.Receive() {
+				ids = append(ids, u.ID)
+			}
+
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestSubscriberOverflowDisconnect(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.SetBuffer(1, OverflowDisconnect)
+	s.Ready(ctx)
+
+	assert.True(t, s.Dispatch(ctx, &Update{}, false))
+	assert.False(t, s.Dispatch(ctx, &Update{}, false))
+	assert.Equal(t, DisconnectReasonSlowConsumer, s.disconnectReason)
+}
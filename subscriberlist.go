@@ -1,119 +1,279 @@
 package mercure
 
 import (
+	"cmp"
+	"hash/fnv"
+	"slices"
 	"sort"
-	"strings"
-
-	"github.com/dunglas/skipfilter"
+	"strconv"
+	"sync"
+	"sync/atomic"
 )
 
+// shardVirtualNodes is the number of points of each shard on the hash ring.
+const shardVirtualNodes = 128
+
+// shardQueueSize is the capacity of the matching queue of each shard.
+const shardQueueSize = 64
+
+// SubscriberList indexes the subscribers by the topics they match: an update
+// is only evaluated against the subscribers whose matchers can match its
+// topics, found with their exact topics and the literal prefixes of their
+// patterns. It can be split in shards, each with its own lock, index and
+// matching worker, for hubs having a very large number of subscribers.
 type SubscriberList struct {
-	skipfilter *skipfilter.SkipFilter[*LocalSubscriber, string]
+	// mu guards the shards and the ring, which change when resizing.
+	mu     sync.RWMutex
+	shards []*subscriberShard
+	ring   []ringPoint
+	// positions allocates the positions of the subscribers in all the
+	// shards, see Walk.
+	positions atomic.Uint64
 }
 
-// We choose a delimiter and an escape character which are unlikely to be used.
-const (
-	escape = '\x00'
-	delim  = '\x01'
-)
+type subscriberShard struct {
+	index *topicIndex
+	// queue is nil for a list having a single shard, which matches in the
+	// caller goroutine.
+	queue chan shardMatch
+}
 
-//nolint:gochecknoglobals
-var replacer = strings.NewReplacer(
-	string(escape), string([]rune{escape, escape}),
-	string(delim), string([]rune{escape, delim}),
-)
+// shardMatch asks a shard worker for the subscribers matching topics.
+type shardMatch struct {
+	topics  []string
+	private bool
+	result  chan<- []*LocalSubscriber
+}
+
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
 
-// DefaultSubscriberListCacheSize is the default size of the skipfilter cache.
+// DefaultSubscriberListCacheSize was the size of the cache of the subscribers
+// matching the topics.
 //
-// Let's say update topics take 100 bytes on average, a cache with
-// 100,000 entries will use about 10MB.
+// Deprecated: the subscribers are found with the topic index, the list has no
+// cache anymore.
 const DefaultSubscriberListCacheSize = 100_000
 
-func NewSubscriberList(cacheSize int) *SubscriberList {
-	return &SubscriberList{
-		skipfilter: skipfilter.New(func(s *LocalSubscriber, filter string) bool {
-			return s.MatchTopics(decode(filter))
-		}, cacheSize),
-	}
+// NewSubscriberList creates an empty list.
+//
+// The size parameter is ignored: it was the size of the cache of the list,
+// which finds the subscribers with its topic index instead. Pass 0.
+func NewSubscriberList(_ int) *SubscriberList {
+	sl := &SubscriberList{}
+	sl.shards = []*subscriberShard{sl.newShard()}
+	sl.ring = newRing(1)
+
+	return sl
 }
 
-func encode(topics []string, private bool) string {
-	sort.Strings(topics)
+func (sl *SubscriberList) newShard() *subscriberShard {
+	index := newTopicIndex()
+	index.positions = &sl.positions
 
-	parts := make([]string, len(topics)+1)
-	if private {
-		parts[0] = "1"
-	} else {
-		parts[0] = "0"
-	}
+	return &subscriberShard{index: index}
+}
 
-	for i, t := range topics {
-		parts[i+1] = replacer.Replace(t)
-	}
+func (sh *subscriberShard) start() {
+	queue := make(chan shardMatch, shardQueueSize)
+	sh.queue = queue
 
-	return strings.Join(parts, string(delim))
+	go func() {
+		for m := range queue {
+			m.result <- sh.index.match(m.topics, m.private)
+		}
+	}()
 }
 
-func decode(f string) (topics []string, private bool) {
-	var (
-		privateExtracted, inEscape bool
-		builder                    strings.Builder
-	)
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
 
-	for _, char := range f {
-		if inEscape {
-			builder.WriteRune(char)
+	// FNV spreads short and similar keys poorly, mix the bits (SplitMix64
+	// finalizer).
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
 
-			inEscape = false
+	return x ^ (x >> 31)
+}
+
+func newRing(shards int) []ringPoint {
+	ring := make([]ringPoint, 0, shards*shardVirtualNodes)
+	for i := range shards {
+		for v := range shardVirtualNodes {
+			ring = append(ring, ringPoint{hashKey(strconv.Itoa(i) + "-" + strconv.Itoa(v)), i})
+		}
+	}
 
-			continue
+	slices.SortFunc(ring, func(a, b ringPoint) int {
+		switch {
+		case a.hash < b.hash:
+			return -1
+		case a.hash > b.hash:
+			return 1
+		default:
+			return 0
 		}
+	})
+
+	return ring
+}
 
-		switch char {
-		case escape:
-			inEscape = true
+// shardOf returns the shard of a subscriber: the first point of the ring
+// following the hash of its ID, so that adding or removing a shard only moves
+// the subscribers of the ring segments it gains or loses.
+func shardOf(ring []ringPoint, s *LocalSubscriber) int {
+	h := hashKey(s.ID)
 
-		case delim:
-			if !privateExtracted {
-				private = builder.String() == "1"
-				builder.Reset()
+	i := sort.Search(len(ring), func(i int) bool { return ring[i].hash >= h })
+	if i == len(ring) {
+		i = 0
+	}
+
+	return ring[i].shard
+}
+
+// SetShards splits the list in n shards, moving the subscribers whose shard
+// changed. Each shard has its own index and a worker goroutine matching the
+// updates; a single shard (the default) matches in the caller goroutine.
+func (sl *SubscriberList) SetShards(n int) {
+	n = max(n, 1)
 
-				privateExtracted = true
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
 
-				break
+	if n == len(sl.shards) {
+		return
+	}
+
+	shards := make([]*subscriberShard, n)
+	copy(shards, sl.shards)
+
+	for i := range shards {
+		if shards[i] == nil {
+			shards[i] = sl.newShard()
+		}
+	}
+
+	ring := newRing(n)
+
+	// The moved subscribers keep their position, for the walks to resume.
+	for i, sh := range sl.shards {
+		for _, ps := range sh.index.snapshot(0) {
+			if j := shardOf(ring, ps.subscriber); j != i {
+				sh.index.remove(ps.subscriber)
+				shards[j].index.addAt(ps.subscriber, &ps.position)
 			}
+		}
+	}
 
-			topics = append(topics, builder.String())
-			builder.Reset()
+	for _, sh := range shards {
+		switch {
+		case n == 1 && sh.queue != nil:
+			close(sh.queue)
+			sh.queue = nil
+		case n > 1 && sh.queue == nil:
+			sh.start()
+		}
+	}
 
-		default:
-			builder.WriteRune(char)
+	for _, sh := range sl.shards[min(n, len(sl.shards)):] {
+		if sh.queue != nil {
+			close(sh.queue)
 		}
 	}
 
-	topics = append(topics, builder.String())
+	sl.shards = shards
+	sl.ring = ring
+}
+
+// Shards returns the number of shards.
+func (sl *SubscriberList) Shards() int {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	return len(sl.shards)
+}
 
-	return topics, private
+// Close stops the shard workers. The list keeps working, as a single shard.
+func (sl *SubscriberList) Close() {
+	sl.SetShards(1)
 }
 
 func (sl *SubscriberList) MatchAny(u *Update) []*LocalSubscriber {
-	return sl.skipfilter.MatchAny(encode(u.topics(), u.Private))
+	topics := u.topics()
+
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	if len(sl.shards) == 1 {
+		return sl.shards[0].index.match(topics, u.Private)
+	}
+
+	result := make(chan []*LocalSubscriber, len(sl.shards))
+	for _, sh := range sl.shards {
+		sh.queue <- shardMatch{topics, u.Private, result}
+	}
+
+	var subscribers []*LocalSubscriber
+	for range sl.shards {
+		subscribers = append(subscribers, <-result...)
+	}
+
+	return subscribers
 }
 
+// Walk calls callback for every subscriber, in the order they were added,
+// starting at position start until it returns false, and returns the
+// position following the last visited subscriber: pass it as start to resume
+// the walk.
 func (sl *SubscriberList) Walk(start uint64, callback func(s *LocalSubscriber) bool) uint64 {
-	return sl.skipfilter.Walk(start, func(val *LocalSubscriber) bool {
-		return callback(val)
+	// The callback may remove subscribers: don't hold the lock while walking.
+	sl.mu.RLock()
+	shards := sl.shards
+	sl.mu.RUnlock()
+
+	if len(shards) == 1 {
+		return shards[0].index.walk(start, callback)
+	}
+
+	var subscribers []positionedSubscriber
+	for _, sh := range shards {
+		subscribers = append(subscribers, sh.index.snapshot(start)...)
+	}
+
+	slices.SortFunc(subscribers, func(a, b positionedSubscriber) int {
+		return cmp.Compare(a.position, b.position)
 	})
+
+	return walkPositioned(subscribers, start, callback)
 }
 
 func (sl *SubscriberList) Add(s *LocalSubscriber) {
-	sl.skipfilter.Add(s)
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	sl.shards[shardOf(sl.ring, s)].index.add(s)
 }
 
 func (sl *SubscriberList) Remove(s *LocalSubscriber) {
-	sl.skipfilter.Remove(s)
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	sl.shards[shardOf(sl.ring, s)].index.remove(s)
 }
 
 func (sl *SubscriberList) Len() int {
-	return sl.skipfilter.Len()
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	var n int
+	for _, sh := range sl.shards {
+		n += sh.index.len()
+	}
+
+	return n
 }
@@ -6,22 +6,114 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
-func TestEncode(t *testing.T) {
+func TestSubscriberListShards(t *testing.T) {
 	t.Parallel()
 
-	e := encode([]string{"Foo\x00\x01Bar\x00Baz\x01", "\x01bar"}, true)
-	assert.Equal(t, "1\x01\x00\x01bar\x01Foo\x00\x00\x00\x01Bar\x00\x00Baz\x00\x01", e)
+	tms := &TopicMatcherStore{}
+	l := NewSubscriberList(DefaultSubscriberListCacheSize)
+
+	subscribers := make([]*LocalSubscriber, 1000)
+	for i := range subscribers {
+		s := NewLocalSubscriber("", slog.Default(), tms)
+		s.setMatchers(stringsToExactMatchers([]string{fmt.Sprintf("https://example.com/%d", i%10)}), nil)
+
+		l.Add(s)
+		subscribers[i] = s
+	}
+
+	u := &Update{Topic: "https://example.com/3"}
+	expected := l.MatchAny(u)
+	require.Len(t, expected, 100)
+
+	shardOfAll := func() []int {
+		shards := make([]int, len(subscribers))
+		for i, s := range subscribers {
+			shards[i] = shardOf(l.ring, s)
+		}
+
+		return shards
+	}
+
+	l.SetShards(4)
+	assert.Equal(t, 4, l.Shards())
+	assert.Equal(t, 1000, l.Len())
+	assert.ElementsMatch(t, expected, l.MatchAny(u))
+
+	for _, sh := range l.shards {
+		assert.NotZero(t, sh.index.len())
+	}
+
+	// Adding a shard only moves the subscribers it takes over.
+	before := shardOfAll()
+	l.SetShards(5)
+	after := shardOfAll()
+
+	var moved int
+	for i := range before {
+		if before[i] != after[i] {
+			assert.Equal(t, 4, after[i])
+
+			moved++
+		}
+	}
+
+	assert.Less(t, moved, 400)
+	assert.Equal(t, 1000, l.Len())
+	assert.ElementsMatch(t, expected, l.MatchAny(u))
+
+	l.Remove(expected[0])
+	assert.Len(t, l.MatchAny(u), 99)
+
+	var walked int
+
+	l.Walk(0, func(*LocalSubscriber) bool {
+		walked++
+
+		return true
+	})
+	assert.Equal(t, 999, walked)
+
+	l.Close()
+	assert.Equal(t, 1, l.Shards())
+	assert.Len(t, l.MatchAny(u), 99)
 }
 
-func TestDecode(t *testing.T) {
+func TestSubscriberListWalkShards(t *testing.T) {
 	t.Parallel()
 
-	topics, private := decode("1\x01\x00\x01bar\x01Foo\x00\x00\x00\x01Bar\x00\x00Baz\x00\x01")
+	tms := &TopicMatcherStore{}
+	l := NewSubscriberList(0)
+	l.SetShards(4)
+
+	subscribers := make([]*LocalSubscriber, 20)
+	for i := range subscribers {
+		subscribers[i] = NewLocalSubscriber("", slog.Default(), tms)
+		subscribers[i].setMatchers(stringsToExactMatchers([]string{fmt.Sprintf("https://example.com/%d", i)}), nil)
+
+		l.Add(subscribers[i])
+	}
+
+	var walked []*LocalSubscriber
+
+	walk := func(start uint64, n int) uint64 {
+		return l.Walk(start, func(s *LocalSubscriber) bool {
+			walked = append(walked, s)
+
+			return len(walked)%n != 0
+		})
+	}
+
+	// The walk resumes across the shards, even once resized.
+	next := walk(0, 5)
+	l.SetShards(3)
+	next = walk(next, 5)
+	l.SetShards(1)
+	walk(next, 100)
 
-	assert.Equal(t, []string{"\x01bar", "Foo\x00\x01Bar\x00Baz\x01"}, topics)
-	assert.True(t, private)
+	assert.Equal(t, subscribers, walked)
 }
 
 func BenchmarkSubscriberList(b *testing.B) {
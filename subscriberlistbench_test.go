@@ -0,0 +1,131 @@
+package mercure
+
+import (
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// benchTopics is the number of distinct topics the benchmark subscribers
+// subscribe to.
+const benchTopics = 1000
+
+// newSubscriberListBench returns a list of n subscribers split in shards, each
+// subscribing to one of benchTopics topics, and one in a hundred to all of
+// them with a URL pattern. The topic matcher cache is warmed up: the
+// benchmarks measure the steady state, not the first match of every topic.
+func newSubscriberListBench(b *testing.B, n, shards int) (*SubscriberList, chan *LocalSubscriber) {
+	b.Helper()
+
+	l := NewSubscriberList(DefaultSubscriberListCacheSize)
+	l.SetShards(shards)
+	b.Cleanup(l.Close)
+
+	subscribers := make(chan *LocalSubscriber, n)
+	for i := range n {
+		s := newBenchSubscriber(i)
+		l.Add(s)
+		subscribers <- s
+	}
+
+	for i := range benchTopics {
+		l.MatchAny(&Update{Topic: "https://example.com/books/" + strconv.Itoa(i)})
+	}
+
+	return l, subscribers
+}
+
+// benchTopicMatcherStore is the store of the benchmark subscribers, with the
+// default cache like the hub.
+var benchTopicMatcherStore = sync.OnceValue(func() *TopicMatcherStore {
+	tms, err := NewTopicMatcherStore(DefaultTopicMatcherStoreCacheSize)
+	if err != nil {
+		panic(err)
+	}
+
+	return tms
+})
+
+// newBenchSubscriber creates a subscriber without buffer, only the lists being
+// benchmarked.
+func newBenchSubscriber(i int) *LocalSubscriber {
+	s := &LocalSubscriber{Subscriber: *NewSubscriber(slog.Default(), benchTopicMatcherStore())}
+	s.ID = "urn:uuid:bench-" + strconv.Itoa(i)
+
+	if i%100 == 0 {
+		s.setMatchers([]TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/:id"}}, nil)
+	} else {
+		s.setMatchers(stringsToExactMatchers([]string{"https://example.com/books/" + strconv.Itoa(i%benchTopics)}), nil)
+	}
+
+	return s
+}
+
+// subscriberListBenchCases returns the numbers of subscribers and shards to
+// benchmark: a single shard, and one per CPU.
+func subscriberListBenchCases() [][2]int {
+	var cases [][2]int
+
+	for _, n := range []int{10_000, 100_000} {
+		cases = append(cases, [2]int{n, 1})
+
+		if p := runtime.GOMAXPROCS(0); p > 1 {
+			cases = append(cases, [2]int{n, p})
+		}
+	}
+
+	return cases
+}
+
+// BenchmarkSubscriberListFanOut measures the matching of the updates
+// published concurrently on random topics.
+func BenchmarkSubscriberListFanOut(b *testing.B) {
+	for _, c := range subscriberListBenchCases() {
+		b.Run(fmt.Sprintf("subscribers=%d/shards=%d", c[0], c[1]), func(b *testing.B) {
+			l, _ := newSubscriberListBench(b, c[0], c[1])
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					l.MatchAny(&Update{Topic: "https://example.com/books/" + strconv.Itoa(rand.Intn(benchTopics))})
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkSubscriberListChurn measures the matching while subscribers
+// connect and disconnect, one operation in ten. The number of subscribers
+// stays the same: the oldest one disconnects when a new one connects.
+func BenchmarkSubscriberListChurn(b *testing.B) {
+	for _, c := range subscriberListBenchCases() {
+		b.Run(fmt.Sprintf("subscribers=%d/shards=%d", c[0], c[1]), func(b *testing.B) {
+			l, subscribers := newSubscriberListBench(b, c[0], c[1])
+
+			var next atomic.Int64
+			next.Store(int64(c[0]))
+
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if i%10 != 0 {
+						l.MatchAny(&Update{Topic: "https://example.com/books/" + strconv.Itoa(rand.Intn(benchTopics))})
+
+						continue
+					}
+
+					l.Remove(<-subscribers)
+
+					s := newBenchSubscriber(int(next.Add(1)))
+					l.Add(s)
+					subscribers <- s
+				}
+			})
+		})
+	}
+}
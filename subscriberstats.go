@@ -0,0 +1,73 @@
+package mercure
+
+import (
+	"encoding/json"
+	"sync/atomic"
+)
+
+// SubscriberStats counts the updates sent to a subscriber since it connected.
+type SubscriberStats struct {
+	// Delivered is the number of updates handed to the subscriber, replayed
+	// ones included.
+	Delivered uint64 `json:"delivered"`
+	// Replayed is the number of updates of the history handed to the
+	// subscriber.
+	Replayed uint64 `json:"replayed"`
+	// Dropped is the number of updates the subscriber missed because it
+	// didn't receive them fast enough: dropped to make room for updates of
+	// higher priority, or after it got disconnected, and the ones exceeding
+	// the max_rate of its token.
+	Dropped uint64 `json:"dropped"`
+}
+
+// subscriberCounters are the counters behind SubscriberStats, updated while
+// holding the mutex of the subscriber, and read without it.
+type subscriberCounters struct {
+	delivered atomic.Uint64
+	replayed  atomic.Uint64
+	dropped   atomic.Uint64
+
+	// bytesSent is updated by the goroutine writing to the connection, see
+	// BytesSent.
+	bytesSent atomic.Uint64
+}
+
+// Stats returns the delivery statistics of the subscriber.
+func (s *LocalSubscriber) Stats() SubscriberStats {
+	return SubscriberStats{
+		Delivered: s.counters.delivered.Load(),
+		Replayed:  s.counters.replayed.Load(),
+		Dropped:   s.counters.dropped.Load(),
+	}
+}
+
+// WithSubscriberStats sends their own delivery statistics (see
+// SubscriberStats) to the subscribers, so client apps can detect and report
+// data loss. The statistics are sent as an SSE comment instead of the empty
+// one of the heartbeats, and before the connection is closed by the hub:
+//
+//	: stats {"delivered":12,"replayed":3,"dropped":0}
+//
+// The statistics of the periodic comments don't include the updates not
+// written yet.
+func WithSubscriberStats() Option {
+	return func(o *opt) error {
+		o.subscriberStats = true
+
+		return nil
+	}
+}
+
+// statsComment returns the SSE comment holding the statistics of the updates
+// written to the subscriber.
+func statsComment(s *LocalSubscriber) string {
+	stats := s.Stats()
+	stats.Delivered -= min(stats.Delivered, uint64(len(s.out)))
+
+	j, err := json.Marshal(stats)
+	if err != nil {
+		panic(err)
+	}
+
+	return ": stats " + string(j) + "\n"
+}
@@ -0,0 +1,66 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSubscriberStats(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+
+	s.Dispatch(ctx, &Update{}, true)
+	s.Dispatch(ctx, &Update{}, true)
+	s.Dispatch(ctx, &Update{}, false)
+	assert.Equal(t, SubscriberStats{Delivered: 2, Replayed: 2}, s.Stats())
+
+	s.Ready(ctx)
+	assert.Equal(t, SubscriberStats{Delivered: 3, Replayed: 2}, s.Stats())
+
+	for range outBufferLength {
+		s.Dispatch(ctx, &Update{}, false)
+	}
+
+	s.Dispatch(ctx, &Update{}, false)
+	assert.Equal(t, SubscriberStats{Delivered: outBufferLength, Replayed: 2, Dropped: 4}, s.Stats())
+}
+
+func TestSubscriberStatsDroppedLiveQueue(t *testing.T) {
+	t.Parallel()
+
+	ctx := t.Context()
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+
+	for range outBufferLength + 2 {
+		s.Dispatch(ctx, &Update{}, false)
+	}
+
+	s.Ready(ctx)
+	assert.Equal(t, SubscriberStats{Delivered: outBufferLength, Dropped: 2}, s.Stats())
+}
+
+func TestSubscribeStatsComments(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithHeartbeat(20*time.Millisecond), WithSubscriberStats())
+	body := subscribeUntilDisconnected(t, hub, func(context.CancelFunc) {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1"}))
+		time.Sleep(100 * time.Millisecond)
+
+		_, err := hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Topics: []string{"https://example.com/books/1"}}, false)
+		require.NoError(t, err)
+	})
+
+	comments := strings.Count(body, "\n: stats {\"delivered\":1,\"replayed\":0,\"dropped\":0}\n")
+	assert.GreaterOrEqual(t, comments, 2, body)
+	assert.NotContains(t, body, ":\n:")
+	assert.True(t, strings.HasSuffix(body, ": stats {\"delivered\":1,\"replayed\":0,\"dropped\":0}\n"), body)
+}
@@ -20,7 +20,7 @@ const (
 	subscriptionsForMatchURL = defaultHubURL + subscriptionsPath + "/{match_type}/{match}"
 
 	// reservedEventType is the SSE "event" field value the hub sets on every
-	// update it generates itself (currently subscription events). Publishers
+	// update it generates itself (subscription and retraction events). Publishers
 	// are forbidden from using it (see Update.Validate) so that a client
 	// listening for it over a shared connection cannot receive forged events.
 	reservedEventType = "mercure"
@@ -81,6 +81,7 @@ type subscription struct {
 	Match      string `json:"match,omitempty"`
 	MatchType  string `json:"match_type,omitempty"`
 	Active     bool   `json:"active"`
+	Guest      string `json:"guest,omitempty"`
 	Payload    any    `json:"payload,omitempty"`
 }
 
@@ -105,7 +106,7 @@ type subscriptionFilter struct {
 // an error if any of the URL-encoded segments contains invalid escape
 // sequences — the caller should answer 400 rather than silently serving an
 // unfiltered listing.
-func filterFromVars(vars map[string]string) (subscriptionFilter, error) {
+func filterFromVars(tms *TopicMatcherStore, vars map[string]string) (subscriptionFilter, error) {
 	var f subscriptionFilter
 
 	for _, seg := range []struct {
@@ -122,7 +123,7 @@ func filterFromVars(vars map[string]string) (subscriptionFilter, error) {
 
 	// Reject unknown matcher types with a 400 instead of silently serving an
 	// empty listing. match_type is empty on the deprecated /{topic} routes.
-	if f.matchType != "" && !knownMatcherType(MatcherType(f.matchType)) {
+	if f.matchType != "" && !tms.supportsMatcherType(MatcherType(f.matchType)) {
 		return subscriptionFilter{}, ErrUnsupportedMatcherType
 	}
 
@@ -132,7 +133,7 @@ func filterFromVars(vars map[string]string) (subscriptionFilter, error) {
 func (h *Hub) SubscriptionsHandler(w http.ResponseWriter, r *http.Request) {
 	// Validate the URL shape before authorizing or fetching subscribers, so a
 	// malformed request answers 400 without any response headers being set.
-	filter, err := filterFromVars(mux.Vars(r))
+	filter, err := filterFromVars(h.topicMatcherStore, mux.Vars(r))
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
@@ -185,7 +186,7 @@ func (h *Hub) SubscriptionHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	filter, err := filterFromVars(vars)
+	filter, err := filterFromVars(h.topicMatcherStore, vars)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 
@@ -304,7 +305,7 @@ func (h *Hub) initSubscription(w http.ResponseWriter, r *http.Request) (span tra
 	// property. Subscribers pass it back as the last_event_id query parameter.
 	// Subscription events are a homogeneous stream (reserved "mercure" type, JSON
 	// body), so the type and content-type attributes are advertised too.
-	header["Link"] = []string{hubLink +
+	header["Link"] = []string{h.hubLink +
 		`; last-event-id="` + linkQuote(lastEventID) +
 		`"; type="` + reservedEventType +
 		`"; content-type="` + subscriptionContentType[0] + `"`}
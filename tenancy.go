@@ -0,0 +1,438 @@
+package mercure
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// defaultTenancyWindow is the period over which the topics and the history
+// bytes of the tenants are counted when TenancyPolicy.Window is 0.
+const defaultTenancyWindow = time.Hour
+
+var (
+	// ErrTenantQuotaExceeded is returned by Publish and PublishGroup when the
+	// updates would make their tenant exceed one of its quotas (see
+	// WithTenancy).
+	ErrTenantQuotaExceeded = errors.New("tenant quota exceeded")
+	// ErrInvalidTenancyPolicy is returned by WithTenancy for an invalid
+	// policy.
+	ErrInvalidTenancyPolicy = errors.New("invalid tenancy policy")
+	// ErrUnknownTenant is returned by Hub.TenantUsage for a tenant not in
+	// the tenancy policy.
+	ErrUnknownTenant = errors.New("unknown tenant")
+)
+
+// TenantQuota identifies one of the quotas of a tenant.
+type TenantQuota string
+
+const (
+	// TenantQuotaConnections is the quota of concurrent subscribers.
+	TenantQuotaConnections TenantQuota = "connections"
+	// TenantQuotaTopics is the quota of distinct topics published on.
+	TenantQuotaTopics TenantQuota = "topics"
+	// TenantQuotaHistoryBytes is the quota of bytes published.
+	TenantQuotaHistoryBytes TenantQuota = "history_bytes"
+	// TenantQuotaPublishRate is the quota of updates published per second.
+	TenantQuotaPublishRate TenantQuota = "publish_rate"
+)
+
+// TenantQuotas are the resource limits of a tenant. A zero value means no
+// limit.
+type TenantQuotas struct {
+	// MaxConnections is the number of subscribers of the tenant connected at
+	// the same time.
+	MaxConnections int
+	// MaxTopics is the number of distinct topics the publishers of the tenant
+	// can publish on during a window.
+	MaxTopics int
+	// MaxHistoryBytes is the number of bytes the publishers of the tenant can
+	// add to the history during a window: the size of the ID, type, topics,
+	// data and localized variants of their updates.
+	MaxHistoryBytes int64
+	// PublishRate is the number of updates per second the publishers of the
+	// tenant can publish, on average.
+	PublishRate float64
+	// PublishBurst is the number of updates that can be published at once,
+	// PublishRate rounded up when 0.
+	PublishBurst int
+}
+
+// Tenant is a customer of a shared hub, owning the tokens of some issuers.
+type Tenant struct {
+	// Name identifies the tenant in the metrics and in Update.Tenant.
+	Name string
+	// Issuers are the identifiers of the issuers (see WithIssuers) whose
+	// tokens belong to the tenant.
+	Issuers []string
+	// Quotas are the resource limits of the tenant.
+	Quotas TenantQuotas
+}
+
+// TenancyPolicy defines the tenants of a shared hub and their quotas.
+type TenancyPolicy struct {
+	Tenants []Tenant
+	// Window is the period over which the topics and the history bytes are
+	// counted, one hour when 0. The counts are reset at the end of every
+	// window.
+	Window time.Duration
+}
+
+// TenantUsage is the resources used by a tenant.
+type TenantUsage struct {
+	// Connections is the number of subscribers connected.
+	Connections int
+	// Topics is the number of distinct topics published on during the
+	// current window.
+	Topics int
+	// HistoryBytes is the number of bytes published during the current
+	// window.
+	HistoryBytes int64
+	// Updates is the number of updates published during the current window.
+	Updates int
+	// WindowStart is the beginning of the current window.
+	WindowStart time.Time
+}
+
+// TenantMetrics may be implemented by the Metrics collecting the resources
+// used by the tenants, passed to WithTenancy.
+type TenantMetrics interface {
+	// TenantUsageChanged collects the resources used by a tenant, every time
+	// they change.
+	TenantUsageChanged(tenant string, usage TenantUsage)
+	// TenantQuotaExceeded collects the requests rejected because a tenant
+	// exceeded one of its quotas.
+	TenantQuotaExceeded(tenant string, quota TenantQuota)
+}
+
+// tenant holds the resources used by a tenant.
+type tenant struct {
+	Tenant
+
+	sync.Mutex
+	connections  int
+	windowStart  time.Time
+	topics       map[string]struct{}
+	historyBytes int64
+	updates      int
+	// tokens is the number of updates that can be published, refilled at
+	// PublishRate since tokensAt.
+	tokens   float64
+	tokensAt time.Time
+}
+
+// tenancy maps the issuers to their tenants.
+type tenancy struct {
+	window   time.Duration
+	byIssuer map[string]*tenant
+	byName   map[string]*tenant
+}
+
+// WithTenancy enables the multi-tenant mode: the subscribers and the
+// publishers are accounted to the tenant owning the issuer of their token,
+// and the requests exceeding the quotas of the tenant are rejected with a 429
+// status code, the publications with ErrTenantQuotaExceeded.
+//
+// The publish endpoints set the Tenant field of the updates; the updates
+// published in-process are accounted to the tenant in their Tenant field,
+// if any. The usage of every tenant is reported to the metrics implementing
+// TenantMetrics, and returned by Hub.TenantUsage.
+//
+// The resources are counted by each hub: the hubs sharing a transport, and
+// the nodes of a cluster, don't share the counts.
+func WithTenancy(p TenancyPolicy) Option {
+	return func(o *opt) error {
+		if p.Window < 0 {
+			return fmt.Errorf("%w: negative window", ErrInvalidTenancyPolicy)
+		}
+
+		if p.Window == 0 {
+			p.Window = defaultTenancyWindow
+		}
+
+		t := &tenancy{
+			window:   p.Window,
+			byIssuer: make(map[string]*tenant),
+			byName:   make(map[string]*tenant, len(p.Tenants)),
+		}
+
+		for _, tc := range p.Tenants {
+			q := tc.Quotas
+			switch {
+			case tc.Name == "":
+				return fmt.Errorf("%w: a tenant has no name", ErrInvalidTenancyPolicy)
+			case len(tc.Issuers) == 0:
+				return fmt.Errorf("%w: %q: no issuer", ErrInvalidTenancyPolicy, tc.Name)
+			case q.MaxConnections < 0 || q.MaxTopics < 0 || q.MaxHistoryBytes < 0 || q.PublishRate < 0 || q.PublishBurst < 0:
+				return fmt.Errorf("%w: %q: negative quota", ErrInvalidTenancyPolicy, tc.Name)
+			}
+
+			if _, ok := t.byName[tc.Name]; ok {
+				return fmt.Errorf("%w: duplicate tenant %q", ErrInvalidTenancyPolicy, tc.Name)
+			}
+
+			if q.PublishRate != 0 && q.PublishBurst == 0 {
+				tc.Quotas.PublishBurst = int(math.Ceil(q.PublishRate))
+			}
+
+			tn := &tenant{Tenant: tc, topics: make(map[string]struct{}), tokens: float64(tc.Quotas.PublishBurst)}
+			t.byName[tc.Name] = tn
+
+			for _, iss := range tc.Issuers {
+				if _, ok := t.byIssuer[iss]; ok {
+					return fmt.Errorf("%w: issuer %q belongs to several tenants", ErrInvalidTenancyPolicy, iss)
+				}
+
+				t.byIssuer[iss] = tn
+			}
+		}
+
+		o.tenancy = t
+
+		return nil
+	}
+}
+
+// tenantName returns the name of the tenant owning the issuer of the token,
+// or an empty string.
+func (h *Hub) tenantName(c *claims) string {
+	if tn := h.tenantOf(c); tn != nil {
+		return tn.Name
+	}
+
+	return ""
+}
+
+// tenantOf returns the tenant owning the issuer of the token, or nil.
+func (h *Hub) tenantOf(c *claims) *tenant {
+	if h.tenancy == nil || c == nil {
+		return nil
+	}
+
+	return h.tenancy.byIssuer[c.Issuer]
+}
+
+// TenantUsage returns the resources currently used by the tenant.
+func (h *Hub) TenantUsage(name string) (TenantUsage, error) {
+	if h.tenancy == nil {
+		return TenantUsage{}, ErrUnknownTenant
+	}
+
+	tn, ok := h.tenancy.byName[name]
+	if !ok {
+		return TenantUsage{}, fmt.Errorf("%w: %q", ErrUnknownTenant, name)
+	}
+
+	tn.Lock()
+	defer tn.Unlock()
+
+	tn.rollWindow(time.Now(), h.tenancy.window)
+
+	return tn.usage(), nil
+}
+
+// acquireTenantConnection reports whether the subscriber can connect without
+// exceeding the connection quota of its tenant, and counts it if so. The
+// subscribers accepted must be released with releaseTenantConnection.
+func (h *Hub) acquireTenantConnection(ctx context.Context, s *LocalSubscriber) bool {
+	tn := h.tenantOf(s.Claims)
+	if tn == nil {
+		return true
+	}
+
+	tn.Lock()
+	defer tn.Unlock()
+
+	if tn.Quotas.MaxConnections != 0 && tn.connections >= tn.Quotas.MaxConnections {
+		h.tenantQuotaExceeded(ctx, tn, TenantQuotaConnections)
+
+		return false
+	}
+
+	tn.connections++
+	h.reportTenantUsage(tn)
+
+	return true
+}
+
+// releaseTenantConnection stops counting a subscriber accepted by
+// acquireTenantConnection.
+func (h *Hub) releaseTenantConnection(s *LocalSubscriber) {
+	tn := h.tenantOf(s.Claims)
+	if tn == nil {
+		return
+	}
+
+	tn.Lock()
+	defer tn.Unlock()
+
+	tn.connections--
+	h.reportTenantUsage(tn)
+}
+
+// checkTenantQuotas returns ErrTenantQuotaExceeded if publishing the updates
+// would make their tenants exceed their quotas, and counts them otherwise. The
+// updates are counted for all their tenants, or none of them.
+func (h *Hub) checkTenantQuotas(ctx context.Context, updates ...*Update) error {
+	if h.tenancy == nil {
+		return nil
+	}
+
+	pending := make(map[*tenant][]*Update)
+	for _, u := range updates {
+		if tn, ok := h.tenancy.byName[u.Tenant]; ok {
+			pending[tn] = append(pending[tn], u)
+		}
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	// Locked in order, not to deadlock with concurrent publications.
+	tenants := slices.SortedFunc(maps.Keys(pending), func(a, b *tenant) int { return cmp.Compare(a.Name, b.Name) })
+
+	for _, tn := range tenants {
+		tn.Lock()
+		defer tn.Unlock()
+	}
+
+	now := time.Now()
+	topics := make(map[*tenant]map[string]struct{}, len(tenants))
+	bytes := make(map[*tenant]int64, len(tenants))
+
+	for _, tn := range tenants {
+		tn.rollWindow(now, h.tenancy.window)
+		tn.refill(now)
+
+		q := tn.Quotas
+		newTopics := make(map[string]struct{})
+
+		for _, u := range pending[tn] {
+			for _, topic := range u.topics() {
+				if _, ok := tn.topics[topic]; !ok {
+					newTopics[topic] = struct{}{}
+				}
+			}
+
+			bytes[tn] += updateSize(u)
+		}
+
+		var exceeded TenantQuota
+
+		switch {
+		case q.PublishRate != 0 && tn.tokens < float64(len(pending[tn])):
+			exceeded = TenantQuotaPublishRate
+		case q.MaxTopics != 0 && len(tn.topics)+len(newTopics) > q.MaxTopics:
+			exceeded = TenantQuotaTopics
+		case q.MaxHistoryBytes != 0 && tn.historyBytes+bytes[tn] > q.MaxHistoryBytes:
+			exceeded = TenantQuotaHistoryBytes
+		}
+
+		if exceeded != "" {
+			h.tenantQuotaExceeded(ctx, tn, exceeded)
+
+			return fmt.Errorf("%q: %w: %s", tn.Name, ErrTenantQuotaExceeded, exceeded)
+		}
+
+		topics[tn] = newTopics
+	}
+
+	for _, tn := range tenants {
+		for topic := range topics[tn] {
+			tn.topics[topic] = struct{}{}
+		}
+
+		if tn.Quotas.PublishRate != 0 {
+			tn.tokens -= float64(len(pending[tn]))
+		}
+
+		tn.historyBytes += bytes[tn]
+		tn.updates += len(pending[tn])
+		h.reportTenantUsage(tn)
+	}
+
+	return nil
+}
+
+// tenantQuotaExceeded logs and collects a request rejected because the tenant
+// exceeded the quota. It must be called with the tenant locked.
+func (h *Hub) tenantQuotaExceeded(ctx context.Context, tn *tenant, quota TenantQuota) {
+	if h.logger.Enabled(ctx, slog.LevelWarn) {
+		h.logger.LogAttrs(ctx, slog.LevelWarn, "Tenant quota exceeded", slog.String("tenant", tn.Name), slog.String("quota", string(quota)))
+	}
+
+	if m, ok := h.metrics.(TenantMetrics); ok {
+		m.TenantQuotaExceeded(tn.Name, quota)
+	}
+}
+
+// reportTenantUsage reports the usage of the tenant to the metrics. It must
+// be called with the tenant locked.
+func (h *Hub) reportTenantUsage(tn *tenant) {
+	if m, ok := h.metrics.(TenantMetrics); ok {
+		m.TenantUsageChanged(tn.Name, tn.usage())
+	}
+}
+
+// rollWindow starts a new window when the current one is over. It must be
+// called with the tenant locked.
+func (tn *tenant) rollWindow(now time.Time, window time.Duration) {
+	if now.Sub(tn.windowStart) < window {
+		return
+	}
+
+	tn.windowStart = now
+	tn.topics = make(map[string]struct{})
+	tn.historyBytes = 0
+	tn.updates = 0
+}
+
+// refill adds the updates that can be published since the last refill. It
+// must be called with the tenant locked.
+func (tn *tenant) refill(now time.Time) {
+	if tn.Quotas.PublishRate == 0 {
+		return
+	}
+
+	if !tn.tokensAt.IsZero() {
+		tn.tokens = min(float64(tn.Quotas.PublishBurst), tn.tokens+now.Sub(tn.tokensAt).Seconds()*tn.Quotas.PublishRate)
+	}
+
+	tn.tokensAt = now
+}
+
+// usage returns the resources used by the tenant. It must be called with the
+// tenant locked.
+func (tn *tenant) usage() TenantUsage {
+	return TenantUsage{
+		Connections:  tn.connections,
+		Topics:       len(tn.topics),
+		HistoryBytes: tn.historyBytes,
+		Updates:      tn.updates,
+		WindowStart:  tn.windowStart,
+	}
+}
+
+// updateSize returns the number of bytes an update counts towards the history
+// bytes quota.
+func updateSize(u *Update) (n int64) {
+	n = int64(len(u.ID) + len(u.Type) + len(u.Data))
+
+	for _, topic := range u.topics() {
+		n += int64(len(topic))
+	}
+
+	for lang, data := range u.LocalizedData {
+		n += int64(len(lang) + len(data))
+	}
+
+	return n
+}
@@ -0,0 +1,169 @@
+package mercure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTenancyInvalid(t *testing.T) {
+	t.Parallel()
+
+	for name, p := range map[string]TenancyPolicy{
+		"negative window":  {Window: -time.Second},
+		"no name":          {Tenants: []Tenant{{Issuers: []string{"a"}}}},
+		"no issuer":        {Tenants: []Tenant{{Name: "acme"}}},
+		"negative quota":   {Tenants: []Tenant{{Name: "acme", Issuers: []string{"a"}, Quotas: TenantQuotas{MaxTopics: -1}}}},
+		"duplicate name":   {Tenants: []Tenant{{Name: "acme", Issuers: []string{"a"}}, {Name: "acme", Issuers: []string{"b"}}}},
+		"duplicate issuer": {Tenants: []Tenant{{Name: "acme", Issuers: []string{"a"}}, {Name: "globex", Issuers: []string{"a"}}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewHub(t.Context(), WithTenancy(p))
+			require.ErrorIs(t, err, ErrInvalidTenancyPolicy)
+		})
+	}
+}
+
+func TestTenantPublishQuotas(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewPrometheusMetrics(nil)
+	hub := createAnonymousDummy(t, WithMetrics(metrics), WithTenancy(TenancyPolicy{Tenants: []Tenant{
+		{Name: "topics", Issuers: []string{"https://topics.example.com"}, Quotas: TenantQuotas{MaxTopics: 2}},
+		{Name: "bytes", Issuers: []string{"https://bytes.example.com"}, Quotas: TenantQuotas{MaxHistoryBytes: 26}},
+		{Name: "rate", Issuers: []string{"https://rate.example.com"}, Quotas: TenantQuotas{PublishRate: 0.001, PublishBurst: 2}},
+	}}))
+
+	publish := func(tenant, topic, data string) error {
+		return hub.Publish(t.Context(), &Update{Topic: topic, Tenant: tenant, Event: Event{ID: "1", Data: data}})
+	}
+
+	require.NoError(t, publish("topics", "https://example.com/1", ""))
+	require.NoError(t, publish("topics", "https://example.com/2", ""))
+	require.NoError(t, publish("topics", "https://example.com/1", ""))
+	require.ErrorIs(t, publish("topics", "https://example.com/3", ""), ErrTenantQuotaExceeded)
+
+	// The group is rejected as a whole.
+	err := hub.PublishGroup(t.Context(), []*Update{
+		{Topic: "https://example.com/1", Tenant: "topics"},
+		{Topic: "https://example.com/4", Tenant: "topics"},
+	})
+	require.ErrorIs(t, err, ErrTenantQuotaExceeded)
+
+	usage, err := hub.TenantUsage("topics")
+	require.NoError(t, err)
+	assert.Equal(t, 2, usage.Topics)
+	assert.Equal(t, 3, usage.Updates)
+
+	// The ID, topic and data: 7 and 17 bytes.
+	require.NoError(t, publish("bytes", "a", "abcde"))
+	require.NoError(t, publish("bytes", "b", "abcdefghijklmno"))
+	require.ErrorIs(t, publish("bytes", "c", "a"), ErrTenantQuotaExceeded)
+
+	require.NoError(t, publish("rate", "a", ""))
+	require.NoError(t, publish("rate", "a", ""))
+	require.ErrorIs(t, publish("rate", "a", ""), ErrTenantQuotaExceeded)
+
+	// Updates without tenant, or of unknown tenants, aren't limited.
+	require.NoError(t, publish("", "https://example.com/5", ""))
+	require.NoError(t, publish("unknown", "https://example.com/5", ""))
+
+	assertGaugeValue(t, 2, metrics.tenantTopics.WithLabelValues("topics"))
+	assertGaugeValue(t, 24, metrics.tenantHistoryBytes.WithLabelValues("bytes"))
+	assertCounterValue(t, 2, metrics.tenantRejectionsTotal.WithLabelValues("topics", string(TenantQuotaTopics)))
+	assertCounterValue(t, 1, metrics.tenantRejectionsTotal.WithLabelValues("rate", string(TenantQuotaPublishRate)))
+
+	_, err = hub.TenantUsage("unknown")
+	require.ErrorIs(t, err, ErrUnknownTenant)
+}
+
+func TestTenantQuotasRoutedCopies(t *testing.T) {
+	t.Parallel()
+
+	hooks := make(chanPublishHookTarget, 10)
+	hub := createAnonymousDummy(t,
+		WithPublishHooks(PublishHook{Target: hooks}),
+		WithTenancy(TenancyPolicy{Tenants: []Tenant{{Name: "topics", Issuers: []string{"https://topics.example.com"}, Quotas: TenantQuotas{MaxTopics: 1}}}}),
+		WithRoutingRules(RoutingRule{Action: RoutingAddTopic, Topic: "https://example.com/all"}),
+	)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/1", Tenant: "topics"}))
+	assert.Equal(t, "https://example.com/1", (<-hooks).Topic)
+
+	// The copy is accounted to the tenant of the update.
+	assert.Empty(t, hooks)
+
+	usage, err := hub.TenantUsage("topics")
+	require.NoError(t, err)
+	assert.Equal(t, 1, usage.Topics)
+}
+
+func TestTenantPublishHandler(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTenancy(TenancyPolicy{Tenants: []Tenant{
+		{Name: "acme", Issuers: []string{testIssuer}, Quotas: TenantQuotas{MaxTopics: 1}},
+	}}))
+
+	publish := func(topic string) int {
+		form := url.Values{"topic": {topic}, "data": {"Dune"}}
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, publish("https://example.com/books/1"))
+	assert.Equal(t, http.StatusTooManyRequests, publish("https://example.com/books/2"))
+}
+
+func TestTenantConnectionQuota(t *testing.T) {
+	t.Parallel()
+
+	metrics := NewPrometheusMetrics(nil)
+	hub := createDummy(t, WithMetrics(metrics), WithTenancy(TenancyPolicy{Tenants: []Tenant{
+		{Name: "acme", Issuers: []string{testIssuer}, Quotas: TenantQuotas{MaxConnections: 1}},
+	}}))
+
+	newSubscriber := func(issuer string) *LocalSubscriber {
+		s := NewLocalSubscriber("", hub.logger, hub.topicMatcherStore)
+		s.Claims = &claims{RegisteredClaims: jwt.RegisteredClaims{Issuer: issuer}}
+
+		return s
+	}
+
+	s := newSubscriber(testIssuer)
+	require.True(t, hub.acquireTenantConnection(t.Context(), s))
+	assert.False(t, hub.acquireTenantConnection(t.Context(), newSubscriber(testIssuer)))
+	assert.True(t, hub.acquireTenantConnection(t.Context(), newSubscriber("https://other.example.com")))
+	assertGaugeValue(t, 1, metrics.tenantSubscribers.WithLabelValues("acme"))
+
+	// The connection is refused before opening the stream.
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=https://example.com/books/1", nil)
+	req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(roleSubscriber, []string{"*"}))
+
+	w := httptest.NewRecorder()
+	hub.SubscribeHandler(w, req)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	hub.releaseTenantConnection(s)
+
+	usage, err := hub.TenantUsage("acme")
+	require.NoError(t, err)
+	assert.Zero(t, usage.Connections)
+	assert.True(t, hub.acquireTenantConnection(t.Context(), newSubscriber(testIssuer)))
+}
@@ -0,0 +1,242 @@
+// Package testsupport starts the brokers the integration tests of the
+// transports run against, with Docker Compose.
+//
+// Every service can also be provided by the environment: when the variable of
+// a service, such as MERCURE_TEST_REDIS_URL, is set, its value is used and
+// Docker isn't needed. Otherwise, the service is started with the compose file
+// of the package the first time a test asks for it, and left running for the
+// next runs:
+//
+//	docker compose --project-name mercure-testsupport down
+//
+// stops it.
+package testsupport
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ProjectName is the name of the Docker Compose project of the services.
+const ProjectName = "mercure-testsupport"
+
+// StartTimeout is how long Start waits for a service to be healthy.
+const StartTimeout = 2 * time.Minute
+
+//go:embed compose.yaml
+var composeFile []byte
+
+// Service is a broker started by Start.
+type Service struct {
+	// Name is the name of the service in the compose file.
+	Name string
+	// Env is the environment variable providing the URL of an already
+	// running instance.
+	Env string
+	// URL is the URL of the service started with Docker Compose.
+	URL string
+}
+
+// Redis is a Redis server.
+var Redis = Service{Name: "redis", Env: "MERCURE_TEST_REDIS_URL", URL: "redis://127.0.0.1:6379"}
+
+// Kafka is a Kafka broker, reached through a Kafka REST Proxy. Its topics
+// must be created with CreateKafkaTopic.
+var Kafka = Service{Name: "kafka-rest-proxy", Env: "MERCURE_TEST_KAFKA_URL", URL: "http://127.0.0.1:8082"}
+
+var (
+	startMu sync.Mutex
+	started = make(map[string]error)
+)
+
+// Start returns the URL of the service, starting it if needed. The test is
+// skipped when the service isn't provided by the environment and Docker isn't
+// available, and fails if the service doesn't start.
+func Start(t testing.TB, s Service) string {
+	t.Helper()
+
+	if u := os.Getenv(s.Env); u != "" {
+		return u
+	}
+
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skipf("%s is not set and docker is not available", s.Env)
+	}
+
+	startMu.Lock()
+	defer startMu.Unlock()
+
+	err, ok := started[s.Name]
+	if !ok {
+		err = compose("up", "--detach", "--wait", "--wait-timeout", strconv.Itoa(int(StartTimeout.Seconds())), s.Name)
+		started[s.Name] = err
+	}
+
+	if err != nil {
+		t.Fatalf("unable to start %s: %v", s.Name, err)
+	}
+
+	WaitForTCP(t, s.URL, StartTimeout)
+
+	return s.URL
+}
+
+// compose runs a Docker Compose command on the compose file of the package.
+func compose(args ...string) error {
+	dir, err := os.MkdirTemp("", ProjectName)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "compose.yaml")
+	if err := os.WriteFile(file, composeFile, 0o600); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), StartTimeout+time.Minute)
+	defer cancel()
+
+	var out bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, "docker", append([]string{"compose", "--project-name", ProjectName, "--file", file}, args...)...)
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker compose %s: %w: %s", strings.Join(args, " "), err, out.String())
+	}
+
+	return nil
+}
+
+// WaitForTCP waits until the host of rawURL, a URL or a host:port address,
+// accepts TCP connections, and fails the test after timeout.
+func WaitForTCP(t testing.TB, rawURL string, timeout time.Duration) {
+	t.Helper()
+
+	addr := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		addr = u.Host
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			_ = conn.Close()
+
+			return
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("%s is not reachable: %v", addr, err)
+		}
+
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// CreateKafkaTopic creates the Kafka topic name, with a single partition,
+// with the API v3 of the REST Proxy at proxyURL, and fails the test if it
+// can't.
+func CreateKafkaTopic(t testing.TB, proxyURL, name string) {
+	t.Helper()
+
+	var clusters struct {
+		Data []struct {
+			ClusterID string `json:"cluster_id"`
+		} `json:"data"`
+	}
+
+	if err := kafkaRequest(t, http.MethodGet, proxyURL+"/v3/clusters", nil, &clusters); err != nil {
+		t.Fatalf("unable to get the Kafka cluster: %v", err)
+	}
+
+	if len(clusters.Data) == 0 {
+		t.Fatalf("no Kafka cluster behind %s", proxyURL)
+	}
+
+	topic := map[string]any{"topic_name": name, "partitions_count": 1, "replication_factor": 1}
+	if err := kafkaRequest(t, http.MethodPost, proxyURL+"/v3/clusters/"+clusters.Data[0].ClusterID+"/topics", topic, nil); err != nil {
+		t.Fatalf("unable to create the Kafka topic %s: %v", name, err)
+	}
+}
+
+// kafkaRequest sends the JSON body to the REST Proxy, and decodes the
+// response in v if not nil.
+func kafkaRequest(t testing.TB, method, rawURL string, body, v any) error {
+	t.Helper()
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		r = bytes.NewReader(b)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), StartTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, r)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err //nolint:wrapcheck
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		b, _ := io.ReadAll(resp.Body)
+
+		return fmt.Errorf("%s: %s", resp.Status, b) //nolint:err113
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v) //nolint:wrapcheck
+}
+
+var (
+	invalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]+`)
+	names            atomic.Uint64
+)
+
+// UniqueName returns a name, for instance of a stream or a topic of the
+// broker, not used by the other tests nor by the previous runs of the test,
+// the services being shared.
+func UniqueName(t testing.TB) string {
+	t.Helper()
+
+	return fmt.Sprintf("mercure-%s-%d-%d", invalidNameChars.ReplaceAllString(t.Name(), "-"), time.Now().UnixNano(), names.Add(1))
+}
@@ -0,0 +1,63 @@
+package testsupport
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStartFromEnvironment(t *testing.T) {
+	t.Setenv("MERCURE_TEST_EXAMPLE_URL", "redis://redis.example:6379")
+
+	// The service isn't started: it is in the environment.
+	s := Service{Name: "unknown", Env: "MERCURE_TEST_EXAMPLE_URL", URL: "redis://127.0.0.1:1"}
+	assert.Equal(t, "redis://redis.example:6379", Start(t, s))
+}
+
+func TestWaitForTCP(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+
+	WaitForTCP(t, "redis://"+l.Addr().String(), time.Second)
+	WaitForTCP(t, l.Addr().String(), time.Second)
+}
+
+func TestCreateKafkaTopic(t *testing.T) {
+	t.Parallel()
+
+	var created map[string]any
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /v3/clusters":
+			_, _ = w.Write([]byte(`{"data":[{"cluster_id":"c1"}]}`))
+		case "POST /v3/clusters/c1/topics":
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	CreateKafkaTopic(t, srv.URL, "mercure-test")
+	assert.Equal(t, map[string]any{"topic_name": "mercure-test", "partitions_count": 1.0, "replication_factor": 1.0}, created)
+}
+
+func TestUniqueName(t *testing.T) {
+	t.Parallel()
+
+	name := UniqueName(t)
+	assert.True(t, strings.HasPrefix(name, "mercure-TestUniqueName-"), name)
+	assert.NotEqual(t, name, UniqueName(t))
+}
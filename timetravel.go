@@ -0,0 +1,186 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// paramReplaySpeed is the subscribe query parameter setting how fast a
+	// time-travel subscription replays the history, such as 2x.
+	paramReplaySpeed = "replay-speed"
+	// paramFrom is the subscribe query parameter holding the ID of the first
+	// update replayed by a time-travel subscription.
+	paramFrom = "from"
+	// paramTo is the subscribe query parameter holding the ID of the last
+	// update replayed by a time-travel subscription.
+	paramTo = "to"
+
+	// maxReplaySpeed caps the replay speed of time-travel subscriptions.
+	maxReplaySpeed = 1000
+	// maxTimeTravelUpdates caps the updates replayed by a time-travel
+	// subscription, as they are held in memory during the replay.
+	maxTimeTravelUpdates = maxHistoryScan
+)
+
+var (
+	// errInvalidReplaySpeed is returned when the replay-speed subscribe
+	// parameter is not a positive number, optionally followed by "x".
+	errInvalidReplaySpeed = errors.New(`invalid "replay-speed" parameter`)
+	// errTimeTravelNotSupported is returned when the transport can't read
+	// its history.
+	errTimeTravelNotSupported = errors.New("the transport doesn't support time travel")
+	// errTimeTravelFromNotFound is returned when the "from" update isn't in
+	// the history.
+	errTimeTravelFromNotFound = errors.New(`the "from" update is not in the history`)
+)
+
+// timeTravel is a time-travel subscription: it replays a window of the
+// history, paced by the publication dates of the updates, instead of
+// receiving the live updates.
+type timeTravel struct {
+	speed float64
+	from  string
+	to    string
+}
+
+// timeTravelEnd is the data of the event telling a time-travel subscriber
+// that the whole window has been replayed.
+type timeTravelEnd struct {
+	Type string `json:"type"`
+}
+
+// parseTimeTravel reads the time-travel subscribe parameters, only supported
+// in debug mode. It returns nil if the subscription is a regular one.
+func (h *Hub) parseTimeTravel(values url.Values) (*timeTravel, error) {
+	if !h.debug || (!values.Has(paramReplaySpeed) && !values.Has(paramFrom) && !values.Has(paramTo)) {
+		return nil, nil
+	}
+
+	tt := &timeTravel{speed: 1, from: values.Get(paramFrom), to: values.Get(paramTo)}
+
+	if v := values.Get(paramReplaySpeed); v != "" {
+		speed, err := strconv.ParseFloat(strings.TrimSuffix(v, "x"), 64)
+		if err != nil || !(speed > 0 && speed <= maxReplaySpeed) {
+			return nil, errInvalidReplaySpeed
+		}
+
+		tt.speed = speed
+	}
+
+	return tt, nil
+}
+
+// load returns the updates of the window the subscriber is allowed to
+// receive, oldest first, resuming after its Last-Event-ID when it reconnects.
+func (tt *timeTravel) load(ctx context.Context, transport Transport, s *LocalSubscriber) ([]*Update, error) {
+	reader, ok := transport.(TransportHistoryReader)
+	if !ok {
+		return nil, errTimeTravelNotSupported
+	}
+
+	var updates []*Update
+
+	codec := transportEventIDCodec(transport)
+	started := tt.from == ""
+	resumed := !s.RequestLastEventIDSet
+
+	err := reader.ReadHistory(ctx, func(u *Update) error {
+		if !started {
+			if u.ID != tt.from {
+				return nil
+			}
+
+			started = true
+		}
+
+		include := resumed
+		if !resumed {
+			// The updates after the position of the Last-Event-ID are
+			// included, when the scheme of the IDs orders them.
+			c, ok := compareEventIDs(codec, u.ID, s.RequestLastEventID)
+			resumed = ok && c >= 0
+			include = ok && c > 0
+		}
+
+		if include && s.Match(u) {
+			updates = append(updates, u)
+		}
+
+		if u.ID == tt.to || len(updates) >= maxTimeTravelUpdates {
+			return errStopHistory
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStopHistory) {
+		return nil, err //nolint:wrapcheck
+	}
+
+	if !started {
+		return nil, errTimeTravelFromNotFound
+	}
+
+	return updates, nil
+}
+
+// replay dispatches the updates to the subscriber, waiting between two of
+// them for the time elapsed between their publications divided by the
+// speed, then tells it that the replay is over. The updates without an ID
+// generated by the hub (see Update.AssignUUID) can't be dated, and are
+// dispatched without waiting.
+func (tt *timeTravel) replay(ctx context.Context, s *LocalSubscriber, updates []*Update) {
+	var (
+		previous time.Time
+		timer    *time.Timer
+	)
+
+	lastID := s.RequestLastEventID
+
+	for _, u := range updates {
+		if published, ok := updateTime(u.ID); ok {
+			if !previous.IsZero() && published.After(previous) {
+				d := time.Duration(float64(published.Sub(previous)) / tt.speed)
+
+				if timer == nil {
+					timer = time.NewTimer(d)
+					defer timer.Stop()
+				} else {
+					timer.Reset(d)
+				}
+
+				select {
+				case <-ctx.Done():
+					return
+				case <-timer.C:
+				}
+			}
+
+			previous = published
+		}
+
+		if !s.Dispatch(ctx, u, true) {
+			return
+		}
+
+		lastID = u.ID
+	}
+
+	j, err := json.Marshal(timeTravelEnd{Type: "TimeTravelEnded"})
+	if err != nil {
+		panic(err)
+	}
+
+	// The ID lets the client reconnecting resume after the end of the window.
+	s.Dispatch(ctx, &Update{Event: Event{Data: string(j), ID: lastID, Type: reservedEventType}}, true)
+
+	if s.logger.Enabled(ctx, slog.LevelDebug) {
+		s.logger.LogAttrs(ctx, slog.LevelDebug, "Time travel replayed", slog.Int("count", len(updates)))
+	}
+}
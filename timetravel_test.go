@@ -0,0 +1,194 @@
+package mercure
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// timeTravelID returns a hub-generated ID published at t.
+func timeTravelID(t *testing.T, at time.Time) string {
+	t.Helper()
+
+	u, err := uuid.NewV7AtTime(at)
+	require.NoError(t, err)
+
+	return "urn:uuid:" + u.String()
+}
+
+// createTimeTravelTransport creates a Bolt transport holding updates
+// published a second apart, on the books 1 to 5, the third one being private.
+func createTimeTravelTransport(t *testing.T) (*BoltTransport, []string) {
+	t.Helper()
+
+	transport, err := NewBoltTransport(NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, 0)
+	require.NoError(t, err)
+
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(context.Background()))
+	})
+
+	start := time.Now().Add(-time.Hour)
+	ids := make([]string, 5)
+
+	for i := range ids {
+		ids[i] = timeTravelID(t, start.Add(time.Duration(i)*time.Second))
+
+		require.NoError(t, transport.Dispatch(t.Context(), &Update{
+			Topic:   "https://example.com/books/" + string(rune('1'+i)),
+			Private: i == 2,
+			Event:   Event{ID: ids[i], Data: string(rune('1' + i))},
+		}))
+	}
+
+	return transport, ids
+}
+
+func TestParseTimeTravel(t *testing.T) {
+	t.Parallel()
+
+	debug := createDummy(t, WithDebug())
+
+	tt, err := debug.parseTimeTravel(url.Values{paramReplaySpeed: {"2x"}, paramFrom: {"a"}, paramTo: {"b"}})
+	require.NoError(t, err)
+	assert.Equal(t, &timeTravel{speed: 2, from: "a", to: "b"}, tt)
+
+	tt, err = debug.parseTimeTravel(url.Values{paramFrom: {"a"}})
+	require.NoError(t, err)
+	assert.InDelta(t, 1, tt.speed, 0)
+
+	tt, err = debug.parseTimeTravel(url.Values{"topic": {"a"}})
+	require.NoError(t, err)
+	assert.Nil(t, tt)
+
+	for _, speed := range []string{"0", "-1x", "fast", "1001x", "NaN"} {
+		_, err = debug.parseTimeTravel(url.Values{paramReplaySpeed: {speed}})
+		require.ErrorIs(t, err, errInvalidReplaySpeed, speed)
+	}
+
+	// Debug mode only.
+	tt, err = createDummy(t).parseTimeTravel(url.Values{paramReplaySpeed: {"2x"}})
+	require.NoError(t, err)
+	assert.Nil(t, tt)
+}
+
+func TestTimeTravelLoad(t *testing.T) {
+	t.Parallel()
+
+	transport, ids := createTimeTravelTransport(t)
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers([]TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/*"}}, nil)
+
+	data := func(updates []*Update) (data []string) {
+		for _, u := range updates {
+			data = append(data, u.Data)
+		}
+
+		return data
+	}
+
+	updates, err := (&timeTravel{from: ids[1], to: ids[3]}).load(t.Context(), transport, s)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2", "4"}, data(updates))
+
+	updates, err = (&timeTravel{to: ids[1]}).load(t.Context(), transport, s)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1", "2"}, data(updates))
+
+	// Reconnection.
+	r := NewLocalSubscriber(ids[1], slog.Default(), &TopicMatcherStore{})
+	r.setMatchers([]TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "https://example.com/books/*"}}, nil)
+
+	updates, err = (&timeTravel{from: ids[0]}).load(t.Context(), transport, r)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"4", "5"}, data(updates))
+
+	_, err = (&timeTravel{from: "unknown"}).load(t.Context(), transport, s)
+	require.ErrorIs(t, err, errTimeTravelFromNotFound)
+
+	_, err = (&timeTravel{}).load(t.Context(), NewLocalTransport(NewSubscriberList(0)), s)
+	require.ErrorIs(t, err, errTimeTravelNotSupported)
+}
+
+func TestTimeTravelReplay(t *testing.T) {
+	t.Parallel()
+
+	start := time.Now()
+	updates := []*Update{
+		{Event: Event{ID: timeTravelID(t, start)}},
+		{Event: Event{ID: "not-dated"}},
+		{Event: Event{ID: timeTravelID(t, start.Add(2*time.Second))}},
+	}
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+
+	begin := time.Now()
+	(&timeTravel{speed: 20}).replay(t.Context(), s, updates)
+
+	assert.GreaterOrEqual(t, time.Since(begin), 100*time.Millisecond)
+
+	for _, u := range updates {
+		assert.Same(t, u, <-s.Receive())
+	}
+
+	end := <-s.Receive()
+	assert.Equal(t, reservedEventType, end.Type)
+	assert.Equal(t, updates[2].ID, end.ID)
+	assert.JSONEq(t, `{"type":"TimeTravelEnded"}`, end.Data)
+}
+
+func TestSubscribeTimeTravel(t *testing.T) {
+	t.Parallel()
+
+	transport, ids := createTimeTravelTransport(t)
+	hub := createAnonymousDummy(t, WithDebug(), WithTransport(transport))
+
+	ctx, cancel := context.WithCancel(t.Context())
+	defer cancel()
+
+	req := httptest.NewRequest(http.MethodGet, defaultHubURL+"?"+url.Values{
+		"match_urlpattern": {"https://example.com/books/*"},
+		paramReplaySpeed:   {"1000x"},
+		paramFrom:          {ids[1]},
+		paramTo:            {ids[3]},
+	}.Encode(), nil).WithContext(ctx)
+	w := newSubscribeRecorder()
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		hub.SubscribeHandler(w, req)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	body := w.Body.String()
+	assert.Contains(t, body, "id: "+ids[1]+"\ndata: 2\n")
+	assert.Contains(t, body, "id: "+ids[3]+"\ndata: 4\n")
+	assert.NotContains(t, body, "data: 3\n")
+	assert.NotContains(t, body, "data: 5\n")
+	assert.Contains(t, body, "event: mercure\nid: "+ids[3]+"\ndata: {\"type\":\"TimeTravelEnded\"}\n")
+
+	// The live updates are not received.
+	assert.Equal(t, 0, transport.subscribers.Len())
+
+	req = httptest.NewRequest(http.MethodGet, defaultHubURL+"?match=foo&"+paramFrom+"=unknown", nil)
+	rec := httptest.NewRecorder()
+	hub.SubscribeHandler(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.True(t, strings.HasPrefix(rec.Body.String(), errTimeTravelFromNotFound.Error()))
+}
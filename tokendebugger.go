@@ -0,0 +1,241 @@
+package mercure
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// tokenDebuggerURL is the debug-mode endpoint explaining how the hub
+// interprets an access token.
+const tokenDebuggerURL = defaultHubURL + "/debug/token"
+
+// maxDebuggedTopics caps the topics a single token debugger request can
+// evaluate, like the subscribe-side matcher cap.
+const maxDebuggedTopics = maxMatcherCount
+
+// errRoleNotConfigured is reported by the token debugger for a role the hub
+// has no verifier for.
+var errRoleNotConfigured = errors.New("no verifier is configured for this role")
+
+// tokenDebugReport is the token debugger response document.
+type tokenDebugReport struct {
+	// Valid reports whether the token is accepted for at least one role.
+	Valid     bool       `json:"valid"`
+	Algorithm string     `json:"algorithm,omitempty"`
+	Type      string     `json:"typ,omitempty"`
+	Issuer    string     `json:"issuer,omitempty"`
+	Subject   string     `json:"subject,omitempty"`
+	Audience  []string   `json:"audience,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	Publisher  tokenDebugRole `json:"publisher"`
+	Subscriber tokenDebugRole `json:"subscriber"`
+
+	// AuthorizationDetails lists the mercure authorization details the hub
+	// resolved from the verified token (including, in compatibility mode, the
+	// legacy mercure claim).
+	AuthorizationDetails []tokenDebugDetail `json:"authorization_details"`
+	Topics               []tokenDebugTopic  `json:"topics"`
+}
+
+type tokenDebugRole struct {
+	Valid bool   `json:"valid"`
+	Error string `json:"error,omitempty"`
+}
+
+type tokenDebugDetail struct {
+	Actions []mercureAction `json:"actions"`
+	Topics  []string        `json:"topics"`
+	Payload any             `json:"payload,omitempty"`
+}
+
+type tokenDebugTopic struct {
+	Topic     string             `json:"topic"`
+	Subscribe tokenDebugDecision `json:"subscribe"`
+	Publish   tokenDebugDecision `json:"publish"`
+}
+
+type tokenDebugDecision struct {
+	Allowed bool   `json:"allowed"`
+	Reason  string `json:"reason"`
+}
+
+// TokenDebuggerHandler explains how the hub interprets an access token: whether
+// it is valid for each role, the algorithm and claims it carries, and, for each
+// given topic, whether private updates could be received and updates published,
+// and why. The token is read from the "token" form field and the topics from
+// the repeated "topic" form field of a POST request, so the token never ends up
+// in access logs.
+//
+// It is only registered in debug mode (see WithDebug): error messages are
+// returned verbatim and would disclose configuration details in production.
+func (h *Hub) TokenDebuggerHandler(w http.ResponseWriter, r *http.Request) {
+	h.limitRequestBody(w, r)
+
+	if err := r.ParseForm(); err != nil {
+		status := http.StatusBadRequest
+
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			status = http.StatusRequestEntityTooLarge
+		}
+
+		http.Error(w, http.StatusText(status), status)
+
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		http.Error(w, `Missing "token" parameter`, http.StatusBadRequest)
+
+		return
+	}
+
+	topics := r.PostForm["topic"]
+	if len(topics) > maxDebuggedTopics {
+		http.Error(w, fmt.Sprintf("too many topics (max %d)", maxDebuggedTopics), http.StatusBadRequest)
+
+		return
+	}
+
+	report := h.debugToken(token, topics)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(report); err != nil && h.logger.Enabled(r.Context(), slog.LevelInfo) {
+		h.logger.LogAttrs(r.Context(), slog.LevelInfo, "Failed to write token debugger response", slog.Any("error", err))
+	}
+}
+
+// debugToken builds the report by running the token through the same
+// validation path as the publish and subscribe handlers.
+func (h *Hub) debugToken(token string, topics []string) tokenDebugReport {
+	report := tokenDebugReport{
+		AuthorizationDetails: []tokenDebugDetail{},
+		Topics:               make([]tokenDebugTopic, 0, len(topics)),
+	}
+
+	// The header and registered claims are displayed even when verification
+	// fails: a mismatch between them and the configuration is usually the
+	// reason the token is rejected.
+	var unverified claims
+	if t, _, err := jwt.NewParser().ParseUnverified(token, &unverified); err == nil {
+		report.Algorithm, _ = t.Header["alg"].(string)
+		report.Type, _ = t.Header["typ"].(string)
+		report.Issuer = unverified.Issuer
+		report.Subject = unverified.Subject
+		report.Audience = unverified.Audience
+
+		if unverified.ExpiresAt != nil {
+			report.ExpiresAt = &unverified.ExpiresAt.Time
+		}
+	}
+
+	publisherClaims, publisherErr := h.debugRole(token, true, &report.Publisher)
+	subscriberClaims, subscriberErr := h.debugRole(token, false, &report.Subscriber)
+
+	report.Valid = report.Publisher.Valid || report.Subscriber.Valid
+
+	verified := subscriberClaims
+	if verified == nil {
+		verified = publisherClaims
+	}
+
+	if verified != nil && verified.authz != nil {
+		for _, d := range verified.authz.details {
+			dd := tokenDebugDetail{Topics: logMatcherPatterns(d.topics), Payload: d.payload}
+
+			if d.publish {
+				dd.Actions = append(dd.Actions, actionPublish)
+			}
+
+			if d.subscribe {
+				dd.Actions = append(dd.Actions, actionSubscribe)
+			}
+
+			report.AuthorizationDetails = append(report.AuthorizationDetails, dd)
+		}
+	}
+
+	for _, topic := range topics {
+		report.Topics = append(report.Topics, tokenDebugTopic{
+			Topic:     topic,
+			Subscribe: h.debugDecision(topic, actionSubscribe, subscriberClaims, subscriberErr),
+			Publish:   h.debugDecision(topic, actionPublish, publisherClaims, publisherErr),
+		})
+	}
+
+	return report
+}
+
+// debugRole validates the token for one role and records the outcome.
+func (h *Hub) debugRole(token string, publish bool, role *tokenDebugRole) (*claims, error) {
+	configured := h.subscriberConfigured
+	if publish {
+		configured = h.publisherConfigured
+	}
+
+	if !configured {
+		role.Error = errRoleNotConfigured.Error()
+
+		return nil, errRoleNotConfigured
+	}
+
+	c, err := h.validateJWT(token, publish)
+	if err != nil {
+		role.Error = err.Error()
+
+		return nil, err
+	}
+
+	role.Valid = true
+
+	return c, nil
+}
+
+// debugDecision explains whether the verified claims grant the action on the
+// topic.
+func (h *Hub) debugDecision(topic string, action mercureAction, c *claims, roleErr error) tokenDebugDecision {
+	// Reject invalid topics before they reach the shared match cache, as the
+	// publish handler does.
+	if !validProtocolString(topic) {
+		return tokenDebugDecision{Reason: ErrInvalidTopic.Error()}
+	}
+
+	if action == actionPublish {
+		if err := (&Update{Topic: topic}).Validate(); err != nil {
+			return tokenDebugDecision{Reason: err.Error()}
+		}
+	}
+
+	if roleErr != nil {
+		return tokenDebugDecision{Reason: fmt.Sprintf("the token is not valid for this role: %s", roleErr)}
+	}
+
+	if m, ok := c.authz.grantingMatcher(h.topicMatcherStore, action, topic); ok {
+		return tokenDebugDecision{
+			Allowed: true,
+			Reason:  fmt.Sprintf("granted by the %s matcher %q of a %s authorization detail", m.Type, m.Pattern, action),
+		}
+	}
+
+	if action == actionSubscribe {
+		return tokenDebugDecision{Reason: "no subscribe authorization detail matches this topic: only public updates will be received"}
+	}
+
+	if h.isBackwardCompatiblyEnabledWith(7) {
+		return tokenDebugDecision{
+			Allowed: true,
+			Reason:  "no publish authorization detail matches this topic: only public updates can be published (deprecated behavior of the version 7 of the protocol)",
+		}
+	}
+
+	return tokenDebugDecision{Reason: "no publish authorization detail matches this topic"}
+}
@@ -0,0 +1,132 @@
+package mercure
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func debugTokenRequest(t *testing.T, hub *Hub, token string, topics ...string) *http.Response {
+	t.Helper()
+
+	form := url.Values{"token": {token}, "topic": topics}
+
+	req := httptest.NewRequest(http.MethodPost, tokenDebuggerURL, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	w := httptest.NewRecorder()
+	hub.ServeHTTP(w, req)
+
+	return w.Result()
+}
+
+func TestTokenDebuggerSubscriber(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithDebug())
+
+	resp := debugTokenRequest(t, hub,
+		createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"}),
+		"https://example.com/books/1", "https://example.com/books/2",
+	)
+	defer resp.Body.Close()
+
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var report tokenDebugReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+
+	assert.True(t, report.Valid)
+	assert.Equal(t, "HS256", report.Algorithm)
+	assert.Equal(t, atJWTType, report.Type)
+	assert.Equal(t, testIssuer, report.Issuer)
+	assert.Equal(t, []string{testResourceIdentifier}, report.Audience)
+	assert.NotNil(t, report.ExpiresAt)
+
+	assert.True(t, report.Subscriber.Valid)
+	assert.False(t, report.Publisher.Valid)
+	assert.Contains(t, report.Publisher.Error, "invalid JWT")
+
+	require.Len(t, report.AuthorizationDetails, 1)
+	assert.Equal(t, []mercureAction{actionSubscribe}, report.AuthorizationDetails[0].Actions)
+	assert.Equal(t, []string{"exact:https://example.com/books/1"}, report.AuthorizationDetails[0].Topics)
+
+	require.Len(t, report.Topics, 2)
+	assert.True(t, report.Topics[0].Subscribe.Allowed)
+	assert.Contains(t, report.Topics[0].Subscribe.Reason, `exact matcher "https://example.com/books/1"`)
+	assert.False(t, report.Topics[0].Publish.Allowed)
+	assert.Contains(t, report.Topics[0].Publish.Reason, "not valid for this role")
+	assert.False(t, report.Topics[1].Subscribe.Allowed)
+	assert.Contains(t, report.Topics[1].Subscribe.Reason, "only public updates")
+}
+
+func TestTokenDebuggerPublisher(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithDebug())
+
+	resp := debugTokenRequest(t, hub,
+		createDummyAuthorizedJWT(rolePublisher, []string{"*"}),
+		"https://example.com/books/1", "/.well-known/mercure/subscriptions",
+	)
+	defer resp.Body.Close()
+
+	var report tokenDebugReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+
+	assert.True(t, report.Valid)
+	assert.True(t, report.Publisher.Valid)
+	assert.False(t, report.Subscriber.Valid)
+
+	require.Len(t, report.Topics, 2)
+	assert.True(t, report.Topics[0].Publish.Allowed)
+	assert.False(t, report.Topics[1].Publish.Allowed)
+	assert.Contains(t, report.Topics[1].Publish.Reason, "reserved")
+}
+
+func TestTokenDebuggerInvalidToken(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithDebug())
+
+	resp := debugTokenRequest(t, hub, createDummyUnauthorizedJWT(), "https://example.com/books/1")
+	defer resp.Body.Close()
+
+	var report tokenDebugReport
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&report))
+
+	assert.False(t, report.Valid)
+	assert.Equal(t, "HS256", report.Algorithm)
+	assert.Contains(t, report.Subscriber.Error, "untrusted issuer")
+	assert.Empty(t, report.AuthorizationDetails)
+	assert.False(t, report.Topics[0].Subscribe.Allowed)
+}
+
+func TestTokenDebuggerMissingToken(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithDebug())
+
+	resp := debugTokenRequest(t, hub, "")
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestTokenDebuggerDisabledWithoutDebug(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t)
+
+	resp := debugTokenRequest(t, hub, createDummyAuthorizedJWT(roleSubscriber, []string{"foo"}))
+	defer resp.Body.Close()
+
+	assert.NotEqual(t, http.StatusOK, resp.StatusCode)
+}
@@ -0,0 +1,201 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// defaultTopicCardinalityWindow is the period over which the distinct topics
+// are counted when TopicCardinalityLimits.Window is 0.
+const defaultTopicCardinalityWindow = time.Hour
+
+var (
+	// ErrTopicCardinalityExceeded is returned by Publish and PublishGroup when
+	// an update would make the number of distinct topics published on exceed
+	// the limits set by WithTopicCardinalityLimits.
+	ErrTopicCardinalityExceeded = errors.New("too many distinct topics published on")
+	// ErrInvalidTopicCardinalityLimits is returned by
+	// WithTopicCardinalityLimits for an invalid configuration.
+	ErrInvalidTopicCardinalityLimits = errors.New("invalid topic cardinality limits")
+)
+
+// TopicCardinalityLimits bounds the number of distinct topics published on
+// during a window of time.
+type TopicCardinalityLimits struct {
+	// MaxTopics is the number of distinct topics that can be published on by
+	// all the publishers, unlimited when 0.
+	MaxTopics int
+	// MaxTopicsPerPublisher is the number of distinct topics that can be
+	// published on by a single publisher, unlimited when 0.
+	MaxTopicsPerPublisher int
+	// Window is the period over which the distinct topics are counted, one
+	// hour when 0. The counts are reset at the end of every window.
+	Window time.Duration
+	// LogOnly logs the updates exceeding the limits instead of rejecting
+	// them.
+	LogOnly bool
+}
+
+// topicCardinality counts the distinct topics published on during the
+// current window.
+type topicCardinality struct {
+	TopicCardinalityLimits
+
+	sync.Mutex
+	windowStart time.Time
+	topics      map[string]struct{}
+	publishers  map[string]map[string]struct{}
+}
+
+// WithTopicCardinalityLimits limits the number of distinct topics published
+// on, globally and per publisher, protecting shared hubs from publishers
+// interpolating unbounded identifiers in the topics. The updates exceeding
+// the limits are rejected with ErrTopicCardinalityExceeded, and the publish
+// endpoints answer with a 429 status code, unless LogOnly is set.
+//
+// The publisher of an update is identified by its Publisher field, set by
+// the publish endpoints to the subject of the JWT, or its ID if it has no
+// subject. The updates without publisher only count towards the global limit.
+//
+// The topics are counted by each hub: the hubs sharing a transport don't
+// share the counts.
+func WithTopicCardinalityLimits(l TopicCardinalityLimits) Option {
+	return func(o *opt) error {
+		if l.MaxTopics < 0 || l.MaxTopicsPerPublisher < 0 || l.Window < 0 ||
+			(l.MaxTopics == 0 && l.MaxTopicsPerPublisher == 0) {
+			return ErrInvalidTopicCardinalityLimits
+		}
+
+		if l.Window == 0 {
+			l.Window = defaultTopicCardinalityWindow
+		}
+
+		o.topicCardinality = &topicCardinality{TopicCardinalityLimits: l}
+
+		return nil
+	}
+}
+
+// publisherID returns the identifier of the publisher the topic cardinality
+// limits apply to.
+func publisherID(c *claims) string {
+	if c == nil {
+		return ""
+	}
+
+	if c.Subject != "" {
+		return c.Subject
+	}
+
+	return c.ID
+}
+
+// checkTopicCardinality returns ErrTopicCardinalityExceeded if publishing the
+// updates would exceed the topic cardinality limits, and counts their topics
+// otherwise. When LogOnly is set, the excess is logged and the exceeding
+// topics are not counted, for the memory used to stay bounded.
+func (h *Hub) checkTopicCardinality(ctx context.Context, updates ...*Update) error {
+	tc := h.topicCardinality
+	if tc == nil {
+		return nil
+	}
+
+	tc.Lock()
+	defer tc.Unlock()
+
+	if now := time.Now(); now.Sub(tc.windowStart) >= tc.Window {
+		tc.windowStart = now
+		tc.topics = make(map[string]struct{})
+		tc.publishers = make(map[string]map[string]struct{})
+	}
+
+	var (
+		topics     map[string]struct{}
+		publishers map[string]map[string]struct{}
+	)
+
+	for _, u := range updates {
+		if tc.MaxTopics != 0 {
+			if _, ok := tc.topics[u.Topic]; !ok {
+				if topics == nil {
+					topics = make(map[string]struct{})
+				}
+
+				if _, ok := topics[u.Topic]; !ok && len(tc.topics)+len(topics) >= tc.MaxTopics {
+					if err := h.topicCardinalityExceeded(ctx, u, fmt.Errorf("%q: %w: more than %d topics", u.Topic, ErrTopicCardinalityExceeded, tc.MaxTopics)); err != nil {
+						return err
+					}
+
+					continue
+				}
+
+				topics[u.Topic] = struct{}{}
+			}
+		}
+
+		if tc.MaxTopicsPerPublisher == 0 || u.Publisher == "" {
+			continue
+		}
+
+		known := tc.publishers[u.Publisher]
+		if _, ok := known[u.Topic]; ok {
+			continue
+		}
+
+		if publishers == nil {
+			publishers = make(map[string]map[string]struct{})
+		}
+
+		pending := publishers[u.Publisher]
+		if pending == nil {
+			pending = make(map[string]struct{})
+			publishers[u.Publisher] = pending
+		}
+
+		if _, ok := pending[u.Topic]; !ok && len(known)+len(pending) >= tc.MaxTopicsPerPublisher {
+			if err := h.topicCardinalityExceeded(ctx, u, fmt.Errorf("%q: %w: more than %d topics for the publisher", u.Topic, ErrTopicCardinalityExceeded, tc.MaxTopicsPerPublisher)); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		pending[u.Topic] = struct{}{}
+	}
+
+	for topic := range topics {
+		tc.topics[topic] = struct{}{}
+	}
+
+	for publisher, pending := range publishers {
+		known := tc.publishers[publisher]
+		if known == nil {
+			known = make(map[string]struct{}, len(pending))
+			tc.publishers[publisher] = known
+		}
+
+		for topic := range pending {
+			known[topic] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+// topicCardinalityExceeded logs the update exceeding the limits, and returns
+// the error rejecting it unless LogOnly is set.
+func (h *Hub) topicCardinalityExceeded(ctx context.Context, u *Update, err error) error {
+	if h.logger.Enabled(ctx, slog.LevelWarn) {
+		h.logger.LogAttrs(ctx, slog.LevelWarn, "Topic cardinality limit exceeded", slog.String("publisher", u.Publisher), slog.Bool("rejected", !h.topicCardinality.LogOnly), slog.Any("error", err))
+	}
+
+	if h.topicCardinality.LogOnly {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,125 @@
+package mercure
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTopicCardinalityGlobal(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		hub := createDummy(t, WithTopicCardinalityLimits(TopicCardinalityLimits{MaxTopics: 2, Window: time.Minute}))
+
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/1"}))
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/2"}))
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/1"}))
+		require.ErrorIs(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/3"}), ErrTopicCardinalityExceeded)
+
+		// All or nothing.
+		require.ErrorIs(t, hub.PublishGroup(t.Context(), []*Update{{Topic: "https://example.com/1"}, {Topic: "https://example.com/3"}}), ErrTopicCardinalityExceeded)
+
+		time.Sleep(time.Minute)
+
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/3"}))
+	})
+}
+
+func TestTopicCardinalityPerPublisher(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTopicCardinalityLimits(TopicCardinalityLimits{MaxTopicsPerPublisher: 1}))
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/1", Publisher: "a"}))
+	require.ErrorIs(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/2", Publisher: "a"}), ErrTopicCardinalityExceeded)
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/2", Publisher: "b"}))
+
+	// Only the global limit applies to the updates without publisher.
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/3"}))
+}
+
+func TestTopicCardinalityRoutedCopies(t *testing.T) {
+	t.Parallel()
+
+	hooks := make(chanPublishHookTarget, 10)
+	hub := createDummy(t,
+		WithPublishHooks(PublishHook{Target: hooks}),
+		WithTopicCardinalityLimits(TopicCardinalityLimits{MaxTopicsPerPublisher: 1}),
+		WithRoutingRules(RoutingRule{Action: RoutingAddTopic, Topic: "https://example.com/all"}),
+	)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/1", Publisher: "a"}))
+	assert.Equal(t, "https://example.com/1", (<-hooks).Topic)
+
+	// The copy is accounted to the publisher of the update.
+	assert.Empty(t, hooks)
+	assert.NotContains(t, hub.topicCardinality.publishers["a"], "https://example.com/all")
+}
+
+func TestTopicCardinalityLogOnly(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTopicCardinalityLimits(TopicCardinalityLimits{MaxTopics: 1, LogOnly: true}))
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/1"}))
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/2"}))
+
+	// The exceeding topics are not counted.
+	assert.Len(t, hub.topicCardinality.topics, 1)
+}
+
+func TestTopicCardinalityPublishHandler(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithTopicCardinalityLimits(TopicCardinalityLimits{MaxTopics: 1}))
+
+	publish := func(topic string) int {
+		form := url.Values{"topic": {topic}, "data": {"Dune"}}
+
+		req := httptest.NewRequest(http.MethodPost, defaultHubURL, strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Add("Authorization", bearerPrefix+createDummyAuthorizedJWT(rolePublisher, []string{"*"}))
+
+		w := httptest.NewRecorder()
+		hub.PublishHandler(w, req)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, publish("https://example.com/books/1"))
+	assert.Equal(t, http.StatusTooManyRequests, publish("https://example.com/books/2"))
+}
+
+func TestPublisherID(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, publisherID(nil))
+
+	c := &claims{}
+	c.ID = "jti"
+	assert.Equal(t, "jti", publisherID(c))
+
+	c.Subject = "sub"
+	assert.Equal(t, "sub", publisherID(c))
+}
+
+func TestWithTopicCardinalityLimitsInvalid(t *testing.T) {
+	t.Parallel()
+
+	for _, l := range []TopicCardinalityLimits{
+		{},
+		{MaxTopics: -1},
+		{MaxTopicsPerPublisher: 1, Window: -time.Second},
+	} {
+		_, err := NewHub(t.Context(), WithTopicCardinalityLimits(l))
+		require.ErrorIs(t, err, ErrInvalidTopicCardinalityLimits, "%+v", l)
+	}
+}
@@ -0,0 +1,512 @@
+package mercure
+
+import (
+	"cmp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// topicIndexKind is the kind of the topics an index key stands for.
+type topicIndexKind int
+
+const (
+	// topicIndexExact keys are the topic itself.
+	topicIndexExact topicIndexKind = iota
+	// topicIndexPrefix keys are a prefix of the topics, as written by the
+	// publisher.
+	topicIndexPrefix
+	// topicIndexURLPrefix keys are a prefix of the topics once parsed as
+	// URLs. They are only looked up for the topics the parsing leaves
+	// untouched, see plainURLTopic.
+	topicIndexURLPrefix
+)
+
+// topicIndexKey is the part of the topics a matcher can match that is known
+// without evaluating it.
+type topicIndexKey struct {
+	kind topicIndexKind
+	key  string
+}
+
+// indexKey returns the key of the topic index of a matcher, and false when
+// the matcher can match any topic: the subscribers having such a matcher are
+// evaluated for all the updates.
+func (tms *TopicMatcherStore) indexKey(m TopicMatcher) (topicIndexKey, bool) {
+	if m.Pattern == "*" {
+		return topicIndexKey{}, false
+	}
+
+	switch m.Type {
+	case MatcherTypeExact:
+		return topicIndexKey{topicIndexExact, m.Pattern}, true
+	case MatcherTypeURLPattern:
+		if p := urlPatternPrefix(m.Pattern, tms.base()); p != "" {
+			return topicIndexKey{topicIndexURLPrefix, p}, true
+		}
+	case MatcherTypeRegexp:
+		return regexpIndexKey(m.Pattern)
+	case deprecatedMatcherTypeName:
+		return tms.deprecatedIndexKey(m.Pattern)
+	}
+
+	return topicIndexKey{}, false
+}
+
+// overlaps reports whether a topic can match both matchers. When this can't
+// be ruled out by comparing the keys of the topic index, the matchers are
+// assumed to overlap.
+func (tms *TopicMatcherStore) overlaps(a, b TopicMatcher) bool {
+	switch {
+	case a.Pattern == "*", b.Pattern == "*":
+		return true
+	case a.Type == MatcherTypeExact:
+		return tms.matches([]string{a.Pattern}, b)
+	case b.Type == MatcherTypeExact:
+		return tms.matches([]string{b.Pattern}, a)
+	}
+
+	ka, ok := tms.indexKey(a)
+	if !ok {
+		return true
+	}
+
+	kb, ok := tms.indexKey(b)
+	if !ok || ka.kind != kb.kind {
+		return true
+	}
+
+	// The topics matching both start with both keys.
+	return strings.HasPrefix(ka.key, kb.key) || strings.HasPrefix(kb.key, ka.key)
+}
+
+// urlPatternPrefix returns the literal beginning of an http(s) URL pattern,
+// relative patterns being resolved against base, or an empty string. The
+// prefix only contains the characters a URL parser doesn't normalize:
+// lowercase schemes and hosts, and RFC 3986 unreserved characters in the
+// path.
+func urlPatternPrefix(pattern, base string) string {
+	var origin string
+
+	switch {
+	case strings.HasPrefix(pattern, "/") && !strings.HasPrefix(pattern, "//"):
+		if origin = plainURLOrigin(base); origin == "" {
+			return ""
+		}
+	case hasPrefixFold(pattern, "http://"), hasPrefixFold(pattern, "https://"):
+		i := strings.Index(pattern, "://") + len("://")
+		origin = strings.ToLower(pattern[:i])
+
+		host := i
+
+		for ; i < len(pattern) && pattern[i] != '/'; i++ {
+			c := lowerASCII(pattern[i])
+			if isHostChar(c) {
+				continue
+			}
+
+			// A port, a group or the end of the host: what precedes is
+			// literal. Credentials, escaped or internationalized hosts are
+			// normalized by the parser.
+			if i == host || strings.IndexByte(`:*({?#\`, c) < 0 {
+				return ""
+			}
+
+			return origin + strings.ToLower(pattern[host:i])
+		}
+
+		if i == host {
+			return ""
+		}
+
+		origin += strings.ToLower(pattern[host:i])
+		pattern = pattern[i:]
+	default:
+		return ""
+	}
+
+	// The URL parser removes the dot segments, and the segments they follow,
+	// from the path.
+	if strings.Contains(pattern, "/.") || strings.Contains(strings.ToLower(pattern), "%2e") || strings.Contains(pattern, `\`) {
+		return origin
+	}
+
+	i := 0
+	for i < len(pattern) && isUnreservedOrSlash(pattern[i]) {
+		i++
+	}
+
+	return origin + pattern[:i]
+}
+
+// plainURLOrigin returns the scheme and host of an http(s) URL whose parsing
+// leaves them untouched, or an empty string.
+func plainURLOrigin(u string) string {
+	var rest string
+
+	switch {
+	case strings.HasPrefix(u, "http://"):
+		rest = u[len("http://"):]
+	case strings.HasPrefix(u, "https://"):
+		rest = u[len("https://"):]
+	default:
+		return ""
+	}
+
+	host, _, _ := strings.Cut(rest, "/")
+	if host == "" {
+		return ""
+	}
+
+	for i := range len(host) {
+		if !isHostChar(host[i]) {
+			return ""
+		}
+	}
+
+	// IPv4 addresses have several forms.
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	if last := labels[len(labels)-1]; last == "" || isDigit(last[0]) {
+		return ""
+	}
+
+	return u[:len(u)-len(rest)+len(host)]
+}
+
+// plainURLTopic reports whether a topic is an http(s) URL that a URL parser
+// leaves as is up to the first character that can't be part of a URL
+// pattern prefix: the URL prefixes of the index can then be compared with
+// the topic as published.
+func plainURLTopic(topic string) bool {
+	origin := plainURLOrigin(topic)
+	if origin == "" || !strings.HasPrefix(topic[len(origin):], "/") {
+		return false
+	}
+
+	return !strings.ContainsAny(topic, `%\`) && !strings.Contains(topic, "/.")
+}
+
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+func lowerASCII(c byte) byte {
+	if c >= 'A' && c <= 'Z' {
+		return c + 'a' - 'A'
+	}
+
+	return c
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isHostChar(c byte) bool {
+	return (c >= 'a' && c <= 'z') || isDigit(c) || c == '-' || c == '.'
+}
+
+func isUnreservedOrSlash(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || isDigit(c) || strings.IndexByte("-._~/", c) >= 0
+}
+
+// topicIndex is an inverted index of the subscribers by the keys of their
+// matchers, so that only the subscribers that can match the topics of an
+// update are evaluated. It also keeps the subscribers in the order they were
+// added, for walk.
+type topicIndex struct {
+	mu      sync.RWMutex
+	entries map[*LocalSubscriber]topicIndexEntry
+	// order lists the subscribers by position, the removed ones being nil
+	// until there are more of them than subscribers.
+	order   []positionedSubscriber
+	removed int
+	// positions allocates the positions. The shards of a list share it, so
+	// that the positions order the subscribers of all of them.
+	positions *atomic.Uint64
+	buckets   [3]map[string]map[*LocalSubscriber]struct{}
+	// prefixLengths counts the keys of the prefix buckets by length.
+	prefixLengths [3]map[int]int
+	any           map[*LocalSubscriber]struct{}
+	// multiKey is the number of subscribers in several buckets.
+	multiKey int
+}
+
+type topicIndexEntry struct {
+	// keys are the keys of the subscriber, nil for the ones evaluated for all
+	// the updates.
+	keys     []topicIndexKey
+	position uint64
+}
+
+type positionedSubscriber struct {
+	position   uint64
+	subscriber *LocalSubscriber
+}
+
+func newTopicIndex() *topicIndex {
+	ti := &topicIndex{
+		entries:   make(map[*LocalSubscriber]topicIndexEntry),
+		any:       make(map[*LocalSubscriber]struct{}),
+		positions: &atomic.Uint64{},
+	}
+
+	for i := range ti.buckets {
+		ti.buckets[i] = make(map[string]map[*LocalSubscriber]struct{})
+		ti.prefixLengths[i] = make(map[int]int)
+	}
+
+	return ti
+}
+
+func subscriberIndexKeys(s *LocalSubscriber) []topicIndexKey {
+	keys := make([]topicIndexKey, 0, len(s.SubscribedMatchers))
+
+	for _, m := range s.SubscribedMatchers {
+		k, ok := s.topicMatcherStore.indexKey(m)
+		if !ok {
+			return nil
+		}
+
+		if !containsKey(keys, k) {
+			keys = append(keys, k)
+		}
+	}
+
+	return keys
+}
+
+func containsKey(keys []topicIndexKey, k topicIndexKey) bool {
+	for _, key := range keys {
+		if key == k {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (ti *topicIndex) add(s *LocalSubscriber) {
+	ti.addAt(s, nil)
+}
+
+// addAt adds the subscriber at the given position, or after all the others
+// when position is nil.
+func (ti *topicIndex) addAt(s *LocalSubscriber, position *uint64) {
+	keys := subscriberIndexKeys(s)
+
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+
+	if _, ok := ti.entries[s]; ok {
+		return
+	}
+
+	// Allocated under the lock, for the order to stay sorted.
+	if position == nil {
+		p := ti.positions.Add(1) - 1
+		ti.order = append(ti.order, positionedSubscriber{p, s})
+		ti.entries[s] = topicIndexEntry{keys, p}
+	} else {
+		ti.order = slices.Insert(ti.order, ti.search(*position), positionedSubscriber{*position, s})
+		ti.entries[s] = topicIndexEntry{keys, *position}
+	}
+
+	if keys == nil {
+		ti.any[s] = struct{}{}
+
+		return
+	}
+
+	if len(keys) > 1 {
+		ti.multiKey++
+	}
+
+	for _, k := range keys {
+		bucket := ti.buckets[k.kind][k.key]
+		if bucket == nil {
+			bucket = make(map[*LocalSubscriber]struct{})
+			ti.buckets[k.kind][k.key] = bucket
+
+			if k.kind != topicIndexExact {
+				ti.prefixLengths[k.kind][len(k.key)]++
+			}
+		}
+
+		bucket[s] = struct{}{}
+	}
+}
+
+func (ti *topicIndex) remove(s *LocalSubscriber) {
+	ti.mu.Lock()
+	defer ti.mu.Unlock()
+
+	entry, ok := ti.entries[s]
+	if !ok {
+		return
+	}
+
+	delete(ti.entries, s)
+	ti.removeFromOrder(entry.position)
+
+	keys := entry.keys
+
+	if keys == nil {
+		delete(ti.any, s)
+
+		return
+	}
+
+	if len(keys) > 1 {
+		ti.multiKey--
+	}
+
+	for _, k := range keys {
+		bucket := ti.buckets[k.kind][k.key]
+		delete(bucket, s)
+
+		if len(bucket) != 0 {
+			continue
+		}
+
+		delete(ti.buckets[k.kind], k.key)
+
+		if k.kind != topicIndexExact {
+			if ti.prefixLengths[k.kind][len(k.key)]--; ti.prefixLengths[k.kind][len(k.key)] == 0 {
+				delete(ti.prefixLengths[k.kind], len(k.key))
+			}
+		}
+	}
+}
+
+// search returns the index in the order of the subscriber at position, or
+// of the first one after it.
+func (ti *topicIndex) search(position uint64) int {
+	i, _ := slices.BinarySearchFunc(ti.order, position, func(ps positionedSubscriber, p uint64) int {
+		return cmp.Compare(ps.position, p)
+	})
+
+	return i
+}
+
+func (ti *topicIndex) removeFromOrder(position uint64) {
+	ti.order[ti.search(position)].subscriber = nil
+
+	if ti.removed++; ti.removed <= len(ti.entries) {
+		return
+	}
+
+	ti.order = slices.DeleteFunc(ti.order, func(ps positionedSubscriber) bool { return ps.subscriber == nil })
+	ti.removed = 0
+}
+
+func (ti *topicIndex) len() int {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+
+	return len(ti.entries)
+}
+
+// snapshot returns the subscribers from position start, in the order they
+// were added.
+func (ti *topicIndex) snapshot(start uint64) []positionedSubscriber {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+
+	snapshot := make([]positionedSubscriber, 0, len(ti.entries))
+
+	for _, ps := range ti.order[ti.search(start):] {
+		if ps.subscriber != nil {
+			snapshot = append(snapshot, ps)
+		}
+	}
+
+	return snapshot
+}
+
+// walk calls callback for the subscribers, in the order they were added,
+// starting at position start until it returns false, and returns the
+// position following the last visited subscriber. The callback is called
+// without holding the lock: it may add or remove subscribers.
+func (ti *topicIndex) walk(start uint64, callback func(s *LocalSubscriber) bool) uint64 {
+	return walkPositioned(ti.snapshot(start), start, callback)
+}
+
+// walkPositioned calls callback for the subscribers until it returns false,
+// and returns the position following the last visited one, start if none.
+func walkPositioned(subscribers []positionedSubscriber, start uint64, callback func(s *LocalSubscriber) bool) uint64 {
+	next := start
+
+	for _, ps := range subscribers {
+		next = ps.position + 1
+
+		if !callback(ps.subscriber) {
+			break
+		}
+	}
+
+	return next
+}
+
+// match returns the subscribers matching the topics, evaluating only the
+// candidates found in the index.
+func (ti *topicIndex) match(topics []string, private bool) []*LocalSubscriber {
+	ti.mu.RLock()
+	defer ti.mu.RUnlock()
+
+	var (
+		matching []*LocalSubscriber
+		seen     map[*LocalSubscriber]struct{}
+	)
+
+	if len(topics) > 1 || ti.multiKey > 0 {
+		seen = make(map[*LocalSubscriber]struct{})
+	}
+
+	// Subscribers found with an exact key match the topics: only the
+	// private updates need to be checked against the allowed matchers.
+	visit := func(bucket map[*LocalSubscriber]struct{}, exact bool) {
+		for s := range bucket {
+			if seen != nil {
+				if _, ok := seen[s]; ok {
+					continue
+				}
+
+				seen[s] = struct{}{}
+			}
+
+			if (exact && !private) || s.MatchTopics(topics, private) {
+				matching = append(matching, s)
+			}
+		}
+	}
+
+	for _, topic := range topics {
+		visit(ti.buckets[topicIndexExact][topic], true)
+		ti.visitPrefixes(topicIndexPrefix, topic, visit)
+
+		if plainURLTopic(topic) {
+			ti.visitPrefixes(topicIndexURLPrefix, topic, visit)
+
+			continue
+		}
+
+		// The URL prefixes can't be compared with this topic.
+		for _, bucket := range ti.buckets[topicIndexURLPrefix] {
+			visit(bucket, false)
+		}
+	}
+
+	visit(ti.any, false)
+
+	return matching
+}
+
+func (ti *topicIndex) visitPrefixes(kind topicIndexKind, topic string, visit func(map[*LocalSubscriber]struct{}, bool)) {
+	for l := range ti.prefixLengths[kind] {
+		if l <= len(topic) {
+			visit(ti.buckets[kind][topic[:l]], false)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package mercure
+
+import (
+	"log/slog"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLPatternPrefix(t *testing.T) {
+	t.Parallel()
+
+	for pattern, expected := range map[string]string{
+		"https://example.com/books/:id":      "https://example.com/books/",
+		"HTTPS://Example.COM/Books/:id":      "https://example.com/Books/",
+		"https://example.com/books/*":        "https://example.com/books/",
+		"https://example.com:8443/books/:id": "https://example.com",
+		"https://*.example.com/books":        "",
+		"https://user@example.com/books":     "",
+		"https://exämple.com/books":          "",
+		"https://example.com/books/../:id":   "https://example.com",
+		"https://example.com/a/%2E%2E/books": "https://example.com",
+		"https://example.com/caf%C3%A9/:id":  "https://example.com/caf",
+		"https://example.com":                "https://example.com",
+		"/books/:id":                         "https://hub.example.com/books/",
+		"books/:id":                          "",
+		"//example.com/books":                "",
+		"urn:example:*":                      "",
+	} {
+		assert.Equal(t, expected, urlPatternPrefix(pattern, "https://hub.example.com/.well-known/mercure"), pattern)
+	}
+
+	assert.Empty(t, urlPatternPrefix("/books/:id", "https://hub.example.com:8443/"))
+}
+
+func TestPlainURLTopic(t *testing.T) {
+	t.Parallel()
+
+	for topic, expected := range map[string]bool{
+		"https://example.com/books/1":       true,
+		"https://example.com/books/1?q=a#b": true,
+		"https://example.com":               false,
+		"https://Example.com/books/1":       false,
+		"HTTPS://example.com/books/1":       false,
+		"https://example.com:443/books/1":   false,
+		"https://127.0.0.1/books/1":         false,
+		"https://0x7f.1/books/1":            false,
+		"https://example.com/books/%31":     false,
+		"https://example.com/a/../books/1":  false,
+		`https://example.com\books\1`:       false,
+		"/books/1":                          false,
+		"urn:example:1":                     false,
+	} {
+		assert.Equal(t, expected, plainURLTopic(topic), topic)
+	}
+}
+
+func TestTopicIndexMatchesLikeSubscribers(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(DefaultTopicMatcherStoreCacheSize)
+	require.NoError(t, err)
+	require.NoError(t, tms.setBaseURL("https://example.com/.well-known/mercure"))
+	tms.enableRegexps()
+
+	matchers := []TopicMatcher{
+		{MatcherTypeExact, "https://example.com/books/1"},
+		{MatcherTypeExact, "urn:example:1"},
+		{MatcherTypeExact, "*"},
+		{MatcherTypeURLPattern, "https://example.com/books/:id"},
+		{MatcherTypeURLPattern, "https://EXAMPLE.com/books/:id"},
+		{MatcherTypeURLPattern, "https://example.com:443/books/:id"},
+		{MatcherTypeURLPattern, "https://*.example.com/books/:id"},
+		{MatcherTypeURLPattern, "/books/:id"},
+		{MatcherTypeURLPattern, "https://example.com/caf%C3%A9/:id"},
+		{MatcherTypeURLPattern, "https://example.com/authors/../books/:id"},
+		{MatcherTypeURLPattern, "https://127.0.0.1/books/:id"},
+		{MatcherTypeURLPattern, "urn\\:example\\:*"},
+		{MatcherTypeURLPattern, "https://example.com/authors/%2e%2e/books/:id"},
+		{MatcherTypeURLPattern, "https://example.com/books/\\:id"},
+		{deprecatedMatcherTypeName, "https://example.com/books/{id}"},
+		{deprecatedMatcherTypeName, "{scheme}://example.com/books/{id}"},
+		{deprecatedMatcherTypeName, "urn:example:1"},
+		{MatcherTypeRegexp, `^https://example\.com/books/[0-9]+$`},
+		{MatcherTypeRegexp, `^https://example\.com/(books|authors)/`},
+		{MatcherTypeRegexp, `^urn:example:|books`},
+		{MatcherTypeRegexp, `(?i)^HTTPS://EXAMPLE\.COM/`},
+		{MatcherTypeRegexp, `books/1`},
+	}
+
+	topics := []string{
+		"https://example.com/books/1",
+		"https://Example.com/books/2",
+		"https://example.com:443/books/3",
+		"https://www.example.com/books/4",
+		"/books/5",
+		"https://example.com/café/6",
+		"https://example.com/caf%C3%A9/7",
+		"https://example.com/authors/../books/8",
+		"https://example.com/./books/9",
+		"https://0x7f.0.0.1/books/10",
+		"https://127.0.0.1/books/11",
+		"urn:example:1",
+		"https://example.com/authors/12",
+		"https://example.com/books/:id",
+		"https://example.com/books/a%2Fb",
+		"https://example.com/authors/%2e%2e/books/13",
+	}
+
+	ti := newTopicIndex()
+	subscribers := make([]*LocalSubscriber, 0, len(matchers)+1)
+
+	for i, m := range matchers {
+		s := NewLocalSubscriber("", slog.Default(), tms)
+		s.ID = strconv.Itoa(i)
+		s.setMatchers([]TopicMatcher{m}, []TopicMatcher{{MatcherTypeURLPattern, "https://example.com/books/:id"}})
+		subscribers = append(subscribers, s)
+	}
+
+	// Several matchers.
+	s := NewLocalSubscriber("", slog.Default(), tms)
+	s.ID = "several"
+	s.setMatchers([]TopicMatcher{matchers[1], matchers[3], matchers[8]}, nil)
+	subscribers = append(subscribers, s)
+
+	for _, s := range subscribers {
+		ti.add(s)
+	}
+
+	for _, topic := range topics {
+		for _, ts := range [][]string{{topic}, {topic, "urn:example:1"}} {
+			for _, private := range []bool{false, true} {
+				var expected, actual []string
+
+				for _, s := range subscribers {
+					if s.MatchTopics(ts, private) {
+						expected = append(expected, s.ID)
+					}
+				}
+
+				for _, s := range ti.match(ts, private) {
+					actual = append(actual, s.ID)
+				}
+
+				assert.ElementsMatch(t, expected, actual, "%v private=%t", ts, private)
+			}
+		}
+	}
+
+	for _, s := range subscribers {
+		ti.remove(s)
+	}
+
+	assert.Empty(t, ti.match([]string{"https://example.com/books/1"}, false))
+	assert.Empty(t, ti.entries)
+
+	for i := range ti.buckets {
+		assert.Empty(t, ti.buckets[i])
+		assert.Empty(t, ti.prefixLengths[i])
+	}
+}
+
+func TestTopicIndexWalk(t *testing.T) {
+	t.Parallel()
+
+	ti := newTopicIndex()
+
+	subscribers := make([]*LocalSubscriber, 10)
+	for i := range subscribers {
+		subscribers[i] = newTestSubscriber("", "https://example.com/"+strconv.Itoa(i))
+		ti.add(subscribers[i])
+	}
+
+	// Removing most of the subscribers compacts the order.
+	for _, s := range subscribers[:8] {
+		ti.remove(s)
+	}
+
+	ti.add(subscribers[0])
+	assert.Equal(t, 3, ti.len())
+
+	var walked []*LocalSubscriber
+
+	next := ti.walk(0, func(s *LocalSubscriber) bool {
+		walked = append(walked, s)
+
+		return len(walked) < 2
+	})
+	assert.Equal(t, subscribers[8:], walked)
+
+	// The walk resumes after the last visited subscriber, and the callback
+	// can remove subscribers.
+	walked = nil
+	ti.walk(next, func(s *LocalSubscriber) bool {
+		walked = append(walked, s)
+		ti.remove(s)
+
+		return true
+	})
+	assert.Equal(t, subscribers[:1], walked)
+	assert.Equal(t, 2, ti.len())
+}
+
+func FuzzTopicIndex(f *testing.F) {
+	tms, err := NewTopicMatcherStore(0)
+	require.NoError(f, err)
+	require.NoError(f, tms.setBaseURL("https://example.com/.well-known/mercure"))
+
+	for _, tc := range [][2]string{
+		{"https://example.com/books/:id", "https://example.com/books/123"},
+		{"https://example.com/books/:id", "https://EXAMPLE.com/books/123"},
+		{"https://example.com/a/../books/:id", "https://example.com/books/1"},
+		{"https://example.com/caf%C3%A9/:id", "https://example.com/café/1"},
+		{"/books/:id", "https://example.com/books/1"},
+		{"https://example.com:443/*", "https://example.com/books/1"},
+	} {
+		f.Add(tc[0], tc[1])
+	}
+
+	f.Fuzz(func(t *testing.T, pattern, topic string) {
+		m := urlPatternMatcher(pattern)
+		if validateProtocolMatcher(tms, m) != nil || !validProtocolString(topic) {
+			return
+		}
+
+		s := NewLocalSubscriber("", slog.Default(), tms)
+		s.setMatchers([]TopicMatcher{m}, nil)
+
+		ti := newTopicIndex()
+		ti.add(s)
+
+		// The index must not miss a matching subscriber.
+		assert.Equal(t, s.MatchTopics([]string{topic}, false), len(ti.match([]string{topic}, false)) == 1)
+	})
+}
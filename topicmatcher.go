@@ -7,9 +7,11 @@ import (
 	"regexp"
 	"slices"
 	"strings"
+	"sync/atomic"
 
 	urlpattern "github.com/dunglas/go-urlpattern"
 	"github.com/maypok86/otter/v2"
+	"github.com/maypok86/otter/v2/stats"
 )
 
 // DefaultTopicMatcherStoreCacheSize bounds the (matcher_type, pattern, topics)
@@ -53,46 +55,60 @@ type TopicMatcherStore struct {
 	matchCache    *otter.Cache[matchCacheKey, bool]
 	templateCache *otter.Cache[string, *regexp.Regexp]
 	urlPatterns   *otter.Cache[string, *urlpattern.URLPattern]
+	regexpCache   *otter.Cache[string, *regexp.Regexp]
 
-	baseURL string
+	baseURL        string
+	regexpsEnabled atomic.Bool
 }
 
 // NewTopicMatcherStore creates a TopicMatcherStore.
-// If cacheSize > 0, match results, compiled templates and compiled URL
-// patterns are cached; otherwise nothing is memoised.
+// If cacheSize > 0, match results, compiled templates, URL patterns and
+// regular expressions are cached, and their statistics are recorded (see Stats);
+// otherwise nothing is memoised.
 func NewTopicMatcherStore(cacheSize int) (*TopicMatcherStore, error) {
 	if cacheSize <= 0 {
 		return &TopicMatcherStore{}, nil
 	}
 
 	matchCache, err := otter.New(&otter.Options[matchCacheKey, bool]{
-		MaximumSize: cacheSize,
+		StatsRecorder: stats.NewCounter(),
+		MaximumSize:   cacheSize,
 	})
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
 
-	// Compiled templates and URL patterns are fewer but larger than match
+	// Compiled templates, URL patterns and regexps are fewer but larger than match
 	// results. Size them at a fraction of the match cache, with a floor of 1:
 	// otter treats MaximumSize == 0 as unbounded, which would let an attacker
 	// stream distinct patterns until OOM.
 	auxSize := max(cacheSize/10, 1)
 
 	templateCache, err := otter.New(&otter.Options[string, *regexp.Regexp]{
-		MaximumSize: auxSize,
+		StatsRecorder: stats.NewCounter(),
+		MaximumSize:   auxSize,
 	})
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
 
 	urlPatterns, err := otter.New(&otter.Options[string, *urlpattern.URLPattern]{
-		MaximumSize: auxSize,
+		StatsRecorder: stats.NewCounter(),
+		MaximumSize:   auxSize,
 	})
 	if err != nil {
 		return nil, err //nolint:wrapcheck
 	}
 
-	return &TopicMatcherStore{matchCache: matchCache, templateCache: templateCache, urlPatterns: urlPatterns}, nil
+	regexpCache, err := otter.New(&otter.Options[string, *regexp.Regexp]{
+		StatsRecorder: stats.NewCounter(),
+		MaximumSize:   auxSize,
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck
+	}
+
+	return &TopicMatcherStore{matchCache: matchCache, templateCache: templateCache, urlPatterns: urlPatterns, regexpCache: regexpCache}, nil
 }
 
 // ErrConflictingBaseURL is returned by setBaseURL (via NewHub) when a store
@@ -153,6 +169,10 @@ func (tms *TopicMatcherStore) validatePattern(m TopicMatcher) error {
 	case MatcherTypeURLPattern:
 		_, err := tms.getOrCompileURLPattern(m.Pattern)
 
+		return err
+	case MatcherTypeRegexp:
+		_, err := tms.getOrCompileRegexp(m.Pattern)
+
 		return err
 	default:
 		return ErrUnsupportedMatcherType
@@ -174,6 +194,8 @@ func (tms *TopicMatcherStore) matches(topics []string, m TopicMatcher) bool {
 		return slices.Contains(topics, m.Pattern)
 	case MatcherTypeURLPattern:
 		return tms.cachedMatch(topics, m, tms.matchURLPattern)
+	case MatcherTypeRegexp:
+		return tms.cachedMatch(topics, m, tms.matchRegexp)
 	case deprecatedMatcherTypeName:
 		return tms.matchDeprecated(topics, m)
 	default:
@@ -198,6 +220,24 @@ func (tms *TopicMatcherStore) cachedMatch(topics []string, m TopicMatcher, fn fu
 	return r
 }
 
+// forget removes the cached match results of the topic sets including one
+// of the topics.
+func (tms *TopicMatcherStore) forget(topics map[string]struct{}) {
+	if tms.matchCache == nil || len(topics) == 0 {
+		return
+	}
+
+	for k := range tms.matchCache.Keys() {
+		for _, t := range strings.Split(k.Topics, topicsKeySeparator) {
+			if _, ok := topics[t]; ok {
+				tms.matchCache.Invalidate(k)
+
+				break
+			}
+		}
+	}
+}
+
 func (tms *TopicMatcherStore) matchURLPattern(topics []string, pattern string) bool {
 	p, err := tms.getOrCompileURLPattern(pattern)
 	if err != nil {
@@ -33,6 +33,28 @@ func (tms *TopicMatcherStore) matchDeprecated(topics []string, m TopicMatcher) b
 	})
 }
 
+// warmDeprecated compiles the URI Template of a v8 selector, and reports
+// whether it is one.
+func (tms *TopicMatcherStore) warmDeprecated(pattern string) bool {
+	return tms.getRegexp(pattern) != nil
+}
+
+// deprecatedIndexKey returns the topic index key of a v8 selector: the
+// selector itself, or the literal beginning of its URI Template, which the
+// template regexp anchors at the start of the topics.
+func (tms *TopicMatcherStore) deprecatedIndexKey(pattern string) (topicIndexKey, bool) {
+	if tms.getRegexp(pattern) == nil {
+		return topicIndexKey{topicIndexExact, pattern}, true
+	}
+
+	prefix, _, _ := strings.Cut(pattern, "{")
+	if prefix == "" {
+		return topicIndexKey{}, false
+	}
+
+	return topicIndexKey{topicIndexPrefix, prefix}, true
+}
+
 // getRegexp retrieves the regexp for this v8 template selector.
 func (tms *TopicMatcherStore) getRegexp(pattern string) *regexp.Regexp {
 	// If it's definitely not a URI template, skip to save some resources
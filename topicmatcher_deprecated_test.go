@@ -39,3 +39,35 @@ func TestMatchDeprecated(t *testing.T) {
 	})
 	assert.True(t, found)
 }
+
+func FuzzMatchURITemplate(f *testing.F) {
+	cached, err := NewTopicMatcherStore(DefaultTopicMatcherStoreCacheSize)
+	require.NoError(f, err)
+
+	uncached, err := NewTopicMatcherStore(0)
+	require.NoError(f, err)
+
+	for _, tc := range [][2]string{
+		{"https://example.com/{foo}/bar", "https://example.com/foo/bar"},
+		{"https://example.com/{firstname}/{lastname}", "https://example.com/kevin/dunglas"},
+		{"https://example.com/books{/id*}{?query*}", "https://example.com/books/1/2?foo=bar"},
+		{"https://example.com/{+path}", "https://example.com/a/b"},
+		{"{invalid", "{invalid"},
+		{"*", "foo"},
+	} {
+		f.Add(tc[0], tc[1])
+	}
+
+	f.Fuzz(func(t *testing.T, pattern, topic string) {
+		m := deprecatedMatcher(pattern)
+
+		want := uncached.matches([]string{topic}, m)
+		assert.Equal(t, want, cached.matches([]string{topic}, m))
+		assert.Equal(t, want, cached.matches([]string{topic}, m))
+
+		// v8 selectors are compared exactly first.
+		if pattern == topic {
+			assert.True(t, want)
+		}
+	})
+}
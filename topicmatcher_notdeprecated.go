@@ -7,3 +7,15 @@ package mercure
 func (tms *TopicMatcherStore) matchDeprecated([]string, TopicMatcher) bool {
 	return false
 }
+
+// warmDeprecated is the stub compiled without the deprecated_topic build
+// tag: v8 matchers are not in the binary, so nothing is compiled.
+func (tms *TopicMatcherStore) warmDeprecated(string) bool {
+	return false
+}
+
+// deprecatedIndexKey is the stub compiled without the deprecated_topic build
+// tag: v8 matchers are not in the binary, so they aren't indexed.
+func (tms *TopicMatcherStore) deprecatedIndexKey(string) (topicIndexKey, bool) {
+	return topicIndexKey{}, false
+}
@@ -127,3 +127,63 @@ func TestValidatePattern(t *testing.T) {
 	// Unknown matcher types are rejected.
 	assert.ErrorIs(t, tms.validatePattern(TopicMatcher{Type: "Regexp", Pattern: "fo+"}), ErrUnsupportedMatcherType)
 }
+
+func FuzzMatchURLPattern(f *testing.F) {
+	cached, err := NewTopicMatcherStore(DefaultTopicMatcherStoreCacheSize)
+	require.NoError(f, err)
+
+	uncached, err := NewTopicMatcherStore(0)
+	require.NoError(f, err)
+
+	for _, tc := range [][2]string{
+		{"https://example.com/books/:id", "https://example.com/books/123"},
+		{"https://example.com/*", "https://example.com/a/b/c"},
+		{"https://example.com/users/:uid/posts/:pid", "https://example.com/users/42"},
+		{"/.well-known/mercure/subscriptions/:type/:match/:subscriber", "/.well-known/mercure/subscriptions/exact/foo/bar"},
+		{"https://example.com/books/{:id}?*", "https://EXAMPLE.com/books/1?foo=bar"},
+		{"*", "foo"},
+		{"(", "foo"},
+	} {
+		f.Add(tc[0], tc[1])
+	}
+
+	f.Fuzz(func(t *testing.T, pattern, topic string) {
+		m := urlPatternMatcher(pattern)
+
+		if err := validateProtocolMatcher(cached, m); err != nil {
+			assert.Equal(t, pattern == "*", cached.matches([]string{topic}, m))
+
+			return
+		}
+
+		// The cached result must be the computed one.
+		want := uncached.matches([]string{topic}, m)
+		assert.Equal(t, want, cached.matches([]string{topic}, m))
+		assert.Equal(t, want, cached.matches([]string{topic}, m))
+
+		// A topic matches a set of topics containing it.
+		if want {
+			assert.True(t, cached.matches([]string{"https://example.com/unrelated", topic}, m))
+		}
+	})
+}
+
+func TestTopicMatcherStoreStats(t *testing.T) {
+	t.Parallel()
+
+	tms, err := NewTopicMatcherStore(10)
+	require.NoError(t, err)
+
+	m := TopicMatcher{Type: MatcherTypeURLPattern, Pattern: "/books/:id"}
+	assert.True(t, tms.matches([]string{"/books/1"}, m))
+	assert.True(t, tms.matches([]string{"/books/1"}, m))
+	assert.False(t, tms.matches([]string{"/authors/1"}, m))
+
+	stats := tms.Stats()
+	assert.Equal(t, TopicMatcherCacheStats{Hits: 1, Misses: 2, Size: 2}, stats[TopicMatcherCacheMatch])
+	assert.Equal(t, TopicMatcherCacheStats{Hits: 1, Misses: 1, Size: 1}, stats[TopicMatcherCacheURLPattern])
+
+	tms, err = NewTopicMatcherStore(0)
+	require.NoError(t, err)
+	assert.Nil(t, tms.Stats())
+}
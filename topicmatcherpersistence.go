@@ -0,0 +1,299 @@
+package mercure
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTopicMatcherPersistenceMaxMatchers is the default number of
+	// matchers saved by WithTopicMatcherPersistence.
+	DefaultTopicMatcherPersistenceMaxMatchers = 1000
+	// DefaultTopicMatcherPersistenceInterval is the default time between two
+	// saves of the matchers.
+	DefaultTopicMatcherPersistenceInterval = time.Minute
+
+	// topicMatcherPersistenceTimeout bounds the loads and the saves.
+	topicMatcherPersistenceTimeout = 10 * time.Second
+)
+
+// ErrInvalidTopicMatcherPersistence is returned by
+// WithTopicMatcherPersistence for an invalid configuration.
+var ErrInvalidTopicMatcherPersistence = errors.New("invalid topic matcher persistence configuration")
+
+// TopicMatcherPersister stores the hottest matchers of a TopicMatcherStore
+// across restarts, see WithTopicMatcherPersistence.
+type TopicMatcherPersister interface {
+	// LoadTopicMatchers returns the matchers of the last save, hottest
+	// first, or no matcher if nothing has been saved yet.
+	LoadTopicMatchers(ctx context.Context) ([]TopicMatcher, error)
+	// SaveTopicMatchers replaces the saved matchers.
+	SaveTopicMatchers(ctx context.Context, matchers []TopicMatcher) error
+}
+
+// TopicMatcherPersistence configures WithTopicMatcherPersistence.
+type TopicMatcherPersistence struct {
+	Persister TopicMatcherPersister
+	// MaxMatchers is the number of matchers saved,
+	// DefaultTopicMatcherPersistenceMaxMatchers when 0.
+	MaxMatchers int
+	// Interval is the time between two saves,
+	// DefaultTopicMatcherPersistenceInterval when 0.
+	Interval time.Duration
+}
+
+// WithTopicMatcherPersistence saves the hottest compiled matchers (URL
+// patterns, regular expressions, and URI Templates of the v8 selectors) of the TopicMatcherStore
+// periodically, when the hub stops and when its context is done, and compiles
+// the saved ones when the hub is created. A restarted hub doesn't have to
+// recompile the matchers of all the subscribers reconnecting at once.
+//
+// Only the compiled matchers are saved: the match results are computed again.
+// Nothing is saved when caching is disabled.
+func WithTopicMatcherPersistence(c TopicMatcherPersistence) Option {
+	return func(o *opt) error {
+		if c.Persister == nil || c.MaxMatchers < 0 || c.Interval < 0 {
+			return ErrInvalidTopicMatcherPersistence
+		}
+
+		if c.MaxMatchers == 0 {
+			c.MaxMatchers = DefaultTopicMatcherPersistenceMaxMatchers
+		}
+
+		if c.Interval == 0 {
+			c.Interval = DefaultTopicMatcherPersistenceInterval
+		}
+
+		o.topicMatcherPersistence = &c
+
+		return nil
+	}
+}
+
+// hottest returns up to n compiled matchers of the caches, hottest first.
+func (tms *TopicMatcherStore) hottest(n int) []TopicMatcher {
+	if tms.urlPatterns == nil {
+		return nil
+	}
+
+	matchers := make([]TopicMatcher, 0, min(n, tms.urlPatterns.EstimatedSize()+tms.regexpCache.EstimatedSize()+tms.templateCache.EstimatedSize()))
+
+	// Patterns compiled against another base URL belong to another hub
+	// sharing the store.
+	prefix := tms.base() + topicsKeySeparator
+
+	for e := range tms.urlPatterns.Hottest() {
+		if len(matchers) >= n {
+			return matchers
+		}
+
+		if pattern, ok := strings.CutPrefix(e.Key, prefix); ok {
+			matchers = append(matchers, TopicMatcher{Type: MatcherTypeURLPattern, Pattern: pattern})
+		}
+	}
+
+	for e := range tms.regexpCache.Hottest() {
+		if len(matchers) >= n {
+			return matchers
+		}
+
+		matchers = append(matchers, TopicMatcher{Type: MatcherTypeRegexp, Pattern: e.Key})
+	}
+
+	for e := range tms.templateCache.Hottest() {
+		if len(matchers) >= n {
+			break
+		}
+
+		matchers = append(matchers, TopicMatcher{Type: deprecatedMatcherTypeName, Pattern: e.Key})
+	}
+
+	return matchers
+}
+
+// warm compiles the matchers, and reports how many were valid.
+func (tms *TopicMatcherStore) warm(matchers []TopicMatcher) int {
+	if tms.urlPatterns == nil {
+		return 0
+	}
+
+	var n int
+
+	for _, m := range matchers {
+		switch m.Type {
+		case MatcherTypeURLPattern:
+			if _, err := tms.getOrCompileURLPattern(m.Pattern); err == nil {
+				n++
+			}
+		case MatcherTypeRegexp:
+			if _, err := tms.getOrCompileRegexp(m.Pattern); err == nil {
+				n++
+			}
+		case deprecatedMatcherTypeName:
+			if tms.warmDeprecated(m.Pattern) {
+				n++
+			}
+		default:
+		}
+	}
+
+	return n
+}
+
+// startTopicMatcherPersistence compiles the saved matchers, then saves them
+// periodically until the context of the hub is done.
+func (h *Hub) startTopicMatcherPersistence() {
+	p := h.topicMatcherPersistence
+	if p == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(h.ctx, topicMatcherPersistenceTimeout)
+	matchers, err := p.Persister.LoadTopicMatchers(ctx)
+
+	cancel()
+
+	switch {
+	case err != nil:
+		if h.logger.Enabled(h.ctx, slog.LevelError) {
+			h.logger.LogAttrs(h.ctx, slog.LevelError, "Unable to load the topic matchers", slog.Any("error", err))
+		}
+	case len(matchers) > 0:
+		n := h.topicMatcherStore.warm(matchers[:min(len(matchers), p.MaxMatchers)])
+
+		if h.logger.Enabled(h.ctx, slog.LevelInfo) {
+			h.logger.LogAttrs(h.ctx, slog.LevelInfo, "Topic matchers loaded", slog.Int("count", n))
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(p.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-h.ctx.Done():
+				h.logTopicMatchersSaveError(h.saveTopicMatchers(context.WithoutCancel(h.ctx)))
+
+				return
+			case <-ticker.C:
+				h.logTopicMatchersSaveError(h.saveTopicMatchers(h.ctx))
+			}
+		}
+	}()
+}
+
+// saveTopicMatchers saves the hottest matchers of the store.
+func (h *Hub) saveTopicMatchers(ctx context.Context) error {
+	p := h.topicMatcherPersistence
+	if p == nil || h.topicMatcherStore.urlPatterns == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, topicMatcherPersistenceTimeout)
+	defer cancel()
+
+	if err := p.Persister.SaveTopicMatchers(ctx, h.topicMatcherStore.hottest(p.MaxMatchers)); err != nil {
+		return fmt.Errorf("unable to save the topic matchers: %w", err)
+	}
+
+	return nil
+}
+
+// logTopicMatchersSaveError logs the errors of the periodic saves, which have
+// no caller to report them to.
+func (h *Hub) logTopicMatchersSaveError(err error) {
+	if err != nil && h.logger.Enabled(h.ctx, slog.LevelError) {
+		h.logger.LogAttrs(h.ctx, slog.LevelError, "Unable to save the topic matchers", slog.Any("error", err))
+	}
+}
+
+// persistedTopicMatcher is the JSON representation of a matcher saved by
+// FileTopicMatcherPersister.
+type persistedTopicMatcher struct {
+	Type    MatcherType `json:"type"`
+	Pattern string      `json:"pattern"`
+}
+
+// FileTopicMatcherPersister saves the matchers in a JSON file.
+type FileTopicMatcherPersister struct {
+	path string
+}
+
+// NewFileTopicMatcherPersister creates a FileTopicMatcherPersister saving the
+// matchers in path. The directory must exist.
+func NewFileTopicMatcherPersister(path string) *FileTopicMatcherPersister {
+	return &FileTopicMatcherPersister{path: path}
+}
+
+// LoadTopicMatchers reads the file, a missing file meaning that nothing has
+// been saved yet.
+func (p *FileTopicMatcherPersister) LoadTopicMatchers(_ context.Context) ([]TopicMatcher, error) {
+	data, err := os.ReadFile(p.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the topic matchers: %w", err)
+	}
+
+	var persisted []persistedTopicMatcher
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		return nil, fmt.Errorf("unable to decode the topic matchers: %w", err)
+	}
+
+	matchers := make([]TopicMatcher, 0, len(persisted))
+	for _, m := range persisted {
+		matchers = append(matchers, TopicMatcher{Type: m.Type, Pattern: m.Pattern})
+	}
+
+	return matchers, nil
+}
+
+// SaveTopicMatchers writes the matchers to a temporary file, then renames
+// it, so LoadTopicMatchers never sees a partial file.
+func (p *FileTopicMatcherPersister) SaveTopicMatchers(_ context.Context, matchers []TopicMatcher) error {
+	persisted := make([]persistedTopicMatcher, 0, len(matchers))
+	for _, m := range matchers {
+		persisted = append(persisted, persistedTopicMatcher{Type: m.Type, Pattern: m.Pattern})
+	}
+
+	data, err := json.Marshal(persisted)
+	if err != nil {
+		return fmt.Errorf("unable to encode the topic matchers: %w", err)
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(p.path), filepath.Base(p.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("unable to save the topic matchers: %w", err)
+	}
+
+	defer os.Remove(f.Name()) //nolint:errcheck
+
+	if _, err := f.Write(data); err != nil {
+		_ = f.Close()
+
+		return fmt.Errorf("unable to save the topic matchers: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("unable to save the topic matchers: %w", err)
+	}
+
+	if err := os.Rename(f.Name(), p.path); err != nil {
+		return fmt.Errorf("unable to save the topic matchers: %w", err)
+	}
+
+	return nil
+}
+
+// Interface guards.
+var _ TopicMatcherPersister = (*FileTopicMatcherPersister)(nil)
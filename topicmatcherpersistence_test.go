@@ -0,0 +1,90 @@
+package mercure
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileTopicMatcherPersister(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "matchers.json")
+	p := NewFileTopicMatcherPersister(path)
+
+	matchers, err := p.LoadTopicMatchers(t.Context())
+	require.NoError(t, err)
+	assert.Empty(t, matchers)
+
+	saved := []TopicMatcher{{Type: MatcherTypeURLPattern, Pattern: "/books/:id"}, {Type: MatcherTypeURLPattern, Pattern: "/authors/:id"}}
+	require.NoError(t, p.SaveTopicMatchers(t.Context(), saved))
+
+	matchers, err = p.LoadTopicMatchers(t.Context())
+	require.NoError(t, err)
+	assert.Equal(t, saved, matchers)
+
+	require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+
+	_, err = p.LoadTopicMatchers(t.Context())
+	require.Error(t, err)
+}
+
+func TestTopicMatcherPersistence(t *testing.T) {
+	t.Parallel()
+
+	p := NewFileTopicMatcherPersister(filepath.Join(t.TempDir(), "matchers.json"))
+
+	tms, err := NewTopicMatcherStore(100)
+	require.NoError(t, err)
+
+	hub, err := NewHub(t.Context(), WithTopicMatcherStore(tms), WithTopicMatcherPersistence(TopicMatcherPersistence{Persister: p, MaxMatchers: 2}))
+	require.NoError(t, err)
+
+	for _, pattern := range []string{"/books/:id", "/authors/:id", "/reviews/:id"} {
+		for range 3 {
+			tms.matches([]string{"/books/1"}, TopicMatcher{Type: MatcherTypeURLPattern, Pattern: pattern})
+		}
+	}
+
+	require.NoError(t, hub.Stop(t.Context()))
+
+	matchers, err := p.LoadTopicMatchers(t.Context())
+	require.NoError(t, err)
+	assert.Len(t, matchers, 2)
+
+	tms, err = NewTopicMatcherStore(100)
+	require.NoError(t, err)
+
+	_, err = NewHub(t.Context(), WithTopicMatcherStore(tms), WithTopicMatcherPersistence(TopicMatcherPersistence{Persister: p}))
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, tms.Stats()[TopicMatcherCacheURLPattern].Size)
+
+	for _, m := range matchers {
+		_, err := tms.getOrCompileURLPattern(m.Pattern)
+		require.NoError(t, err)
+	}
+
+	assert.Equal(t, uint64(2), tms.Stats()[TopicMatcherCacheURLPattern].Hits)
+}
+
+func TestWithTopicMatcherPersistence(t *testing.T) {
+	t.Parallel()
+
+	p := NewFileTopicMatcherPersister(filepath.Join(t.TempDir(), "matchers.json"))
+
+	hub := createDummy(t, WithTopicMatcherPersistence(TopicMatcherPersistence{Persister: p}))
+	assert.Equal(t, &TopicMatcherPersistence{
+		Persister:   p,
+		MaxMatchers: DefaultTopicMatcherPersistenceMaxMatchers,
+		Interval:    DefaultTopicMatcherPersistenceInterval,
+	}, hub.topicMatcherPersistence)
+
+	for _, c := range []TopicMatcherPersistence{{}, {Persister: p, MaxMatchers: -1}, {Persister: p, Interval: -1}} {
+		_, err := NewHub(t.Context(), WithTopicMatcherPersistence(c))
+		require.ErrorIs(t, err, ErrInvalidTopicMatcherPersistence)
+	}
+}
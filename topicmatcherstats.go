@@ -0,0 +1,57 @@
+package mercure
+
+import (
+	"github.com/maypok86/otter/v2/stats"
+)
+
+// TopicMatcherCache identifies a cache of the TopicMatcherStore.
+type TopicMatcherCache string
+
+const (
+	// TopicMatcherCacheMatch is the cache of the match results.
+	TopicMatcherCacheMatch TopicMatcherCache = "match"
+	// TopicMatcherCacheTemplate is the cache of the compiled URI Templates
+	// of the v8 selectors.
+	TopicMatcherCacheTemplate TopicMatcherCache = "template"
+	// TopicMatcherCacheURLPattern is the cache of the compiled URL patterns.
+	TopicMatcherCacheURLPattern TopicMatcherCache = "url_pattern"
+	// TopicMatcherCacheRegexp is the cache of the compiled regular
+	// expressions, see WithRegexpTopicMatchers.
+	TopicMatcherCacheRegexp TopicMatcherCache = "regexp"
+)
+
+// TopicMatcherCacheStats are the statistics of a cache of the
+// TopicMatcherStore, since its creation.
+type TopicMatcherCacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	// Size is the approximate number of entries in the cache.
+	Size int
+}
+
+// TopicMatcherStoreMetrics may be implemented by the Metrics collecting the
+// statistics of the caches of the TopicMatcherStore of the hub.
+type TopicMatcherStoreMetrics interface {
+	// ObserveTopicMatcherStore is called by NewHub with the store of the hub.
+	// The statistics are read from the store, see TopicMatcherStore.Stats.
+	ObserveTopicMatcherStore(tms *TopicMatcherStore)
+}
+
+// Stats returns the statistics of the caches, nil if caching is disabled.
+func (tms *TopicMatcherStore) Stats() map[TopicMatcherCache]TopicMatcherCacheStats {
+	if tms.matchCache == nil {
+		return nil
+	}
+
+	return map[TopicMatcherCache]TopicMatcherCacheStats{
+		TopicMatcherCacheMatch:      newTopicMatcherCacheStats(tms.matchCache.Stats(), tms.matchCache.EstimatedSize()),
+		TopicMatcherCacheTemplate:   newTopicMatcherCacheStats(tms.templateCache.Stats(), tms.templateCache.EstimatedSize()),
+		TopicMatcherCacheURLPattern: newTopicMatcherCacheStats(tms.urlPatterns.Stats(), tms.urlPatterns.EstimatedSize()),
+		TopicMatcherCacheRegexp:     newTopicMatcherCacheStats(tms.regexpCache.Stats(), tms.regexpCache.EstimatedSize()),
+	}
+}
+
+func newTopicMatcherCacheStats(s stats.Stats, size int) TopicMatcherCacheStats {
+	return TopicMatcherCacheStats{Hits: s.Hits, Misses: s.Misses, Evictions: s.Evictions, Size: size}
+}
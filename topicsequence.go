@@ -0,0 +1,100 @@
+package mercure
+
+import (
+	"errors"
+	"sync"
+)
+
+// ErrTopicSequencesNotSupported is returned by NewHub when the transport
+// can't number the updates of the topics.
+var ErrTopicSequencesNotSupported = errors.New("the transport doesn't support topic sequences")
+
+// TransportTopicSequencer may be implemented by transports able to number the
+// updates of each topic, see WithTopicSequences.
+type TransportTopicSequencer interface {
+	// EnableTopicSequences makes the transport set the Sequence field of the
+	// updates it dispatches. An error wrapping ErrTopicSequencesNotSupported
+	// is returned if it can't.
+	EnableTopicSequences() error
+}
+
+// WithTopicSequences numbers the updates of each topic: the transport assigns
+// to every update the number following the one of the previous update
+// published on its canonical topic, starting at 1, and the subscribers receive
+// it in the "sequence" field of the events and in the "sequence" attribute of
+// the JSON representations of the updates. Clients can so detect the updates
+// they missed, and the ones received out of order, without parsing the event
+// IDs.
+//
+// The transport must implement TransportTopicSequencer. With the local
+// transport, the numbering of the topics forgotten by the collection of the
+// idle topics (see WithIdleTopics) starts over at 1.
+func WithTopicSequences() Option {
+	return func(o *opt) error {
+		o.topicSequences = true
+
+		return nil
+	}
+}
+
+// configureTopicSequences enables the topic sequences of the transport.
+func (o *opt) configureTopicSequences() error {
+	if !o.topicSequences {
+		return nil
+	}
+
+	return enableTopicSequences(o.transport)
+}
+
+// enableTopicSequences enables the topic sequences of the transport, if it
+// supports them.
+func enableTopicSequences(t Transport) error {
+	s, ok := t.(TransportTopicSequencer)
+	if !ok {
+		return ErrTopicSequencesNotSupported
+	}
+
+	return s.EnableTopicSequences() //nolint:wrapcheck
+}
+
+// topicSequenceForgetter is implemented by the transports numbering the
+// updates in memory, for the collection of the idle topics to bound it.
+type topicSequenceForgetter interface {
+	forgetTopicSequence(topic string)
+}
+
+// sequenceTopic returns the topic the update is numbered on.
+func sequenceTopic(u *Update) string {
+	return u.topics()[0]
+}
+
+// topicSequences holds the last number assigned on each topic in memory.
+type topicSequences struct {
+	mu   sync.Mutex
+	last map[string]uint64
+}
+
+func newTopicSequences() *topicSequences {
+	return &topicSequences{last: make(map[string]uint64)}
+}
+
+// number sets the Sequence field of the updates.
+func (s *topicSequences) number(updates ...*Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, u := range updates {
+		topic := sequenceTopic(u)
+
+		s.last[topic]++
+		u.Sequence = s.last[topic]
+	}
+}
+
+// forget drops the last number assigned on the topic.
+func (s *topicSequences) forget(topic string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.last, topic)
+}
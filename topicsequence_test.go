@@ -0,0 +1,59 @@
+package mercure
+
+import (
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWithTopicSequences(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewHub(t.Context(), WithTopicSequences())
+	require.NoError(t, err)
+
+	_, err = NewHub(t.Context(), WithTransport(&addSubscriberErrorTransport{}), WithTopicSequences())
+	assert.ErrorIs(t, err, ErrTopicSequencesNotSupported)
+}
+
+func TestLocalTransportTopicSequences(t *testing.T) {
+	t.Parallel()
+
+	transport := NewLocalTransport(NewSubscriberList(0))
+	require.NoError(t, transport.EnableTopicSequences())
+	ctx := t.Context()
+
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(ctx))
+	})
+
+	s := NewLocalSubscriber("", slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers([]string{"https://example.com/1", "https://example.com/2"}), nil)
+	require.NoError(t, transport.AddSubscriber(ctx, s))
+
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topic: "https://example.com/1"}))
+	require.NoError(t, transport.DispatchGroup(ctx, []*Update{
+		{Topic: "https://example.com/2"},
+		{Topic: "https://example.com/1"},
+	}))
+	require.NoError(t, transport.Dispatch(ctx, &Update{Topic: "https://example.com/1"}))
+
+	for _, want := range []uint64{1, 1, 2, 3} {
+		assert.Equal(t, want, (<-s.Receive()).Sequence)
+	}
+}
+
+func TestHistoryUpdateSequence(t *testing.T) {
+	t.Parallel()
+
+	b, err := json.Marshal(newHistoryUpdate(&Update{Topic: "https://example.com/1", Event: Event{ID: "a", Sequence: 3}}, nil))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"id":"a","topics":["https://example.com/1"],"data":"","sequence":3}`, string(b))
+
+	b, err = json.Marshal(newHistoryUpdate(&Update{Topic: "https://example.com/1", Event: Event{ID: "a"}}, nil))
+	require.NoError(t, err)
+	assert.NotContains(t, string(b), "sequence")
+}
@@ -28,7 +28,12 @@ type Transport interface {
 	// RemoveSubscriber removes a subscriber from the transport.
 	RemoveSubscriber(ctx context.Context, s *LocalSubscriber) error
 
-	// Close closes the Transport.
+	// Close closes the Transport. It waits for the in-flight dispatches and
+	// disconnects all the subscribers: once it returns, the channels of the
+	// subscribers added successfully are closed, and the other methods return
+	// ErrClosedTransport. Close is safe to call concurrently with the other
+	// methods, and several times: the next calls return the error of the first
+	// one.
 	Close(ctx context.Context) error
 }
 
@@ -43,6 +48,97 @@ type TransportTopicMatcherStore interface {
 	SetTopicMatcherStore(store *TopicMatcherStore)
 }
 
+// TransportSubscriberSharder may be implemented by transports keeping their
+// subscribers in a SubscriberList, to split it in shards.
+type TransportSubscriberSharder interface {
+	// SetSubscriberShards splits the subscribers in n shards, moving the
+	// existing ones if the number of shards changed.
+	SetSubscriberShards(n int)
+}
+
+// TransportGroupDispatcher may be implemented by transports able to dispatch a
+// group of updates atomically.
+type TransportGroupDispatcher interface {
+	// DispatchGroup persists and dispatches all the updates, or none of them.
+	// The updates are dispatched in order, without any other update
+	// interleaved, so subscribers never observe a partial group and the
+	// history holds the group contiguously.
+	//
+	// The trust rules of Dispatch apply to every update.
+	DispatchGroup(ctx context.Context, updates []*Update) error
+}
+
+// TransportRetracter may be implemented by transports keeping a history, to
+// retract updates published by mistake.
+type TransportRetracter interface {
+	// RetractableUpdate returns the update with the given ID from the history.
+	// It returns ErrUpdateNotFound if the update is not in the history anymore
+	// or has already been retracted.
+	RetractableUpdate(ctx context.Context, id string) (*Update, error)
+
+	// Retract marks the update with the given ID as retracted, so history
+	// replay omits it, and dispatches the retraction update, atomically.
+	//
+	// The retraction update is hub-built and trusted (it uses the reserved
+	// event type that Update.Validate rejects).
+	Retract(ctx context.Context, id string, retraction *Update) error
+}
+
+// TransportHistoryReader may be implemented by transports keeping a history,
+// to read it back, for instance to migrate it to another transport.
+type TransportHistoryReader interface {
+	// ReadHistory calls fn for every update of the history, oldest first,
+	// until fn returns an error, which is returned. Retracted updates are
+	// omitted.
+	ReadHistory(ctx context.Context, fn func(u *Update) error) error
+}
+
+// TransportHistory may be implemented by transports able to fetch the updates
+// published after a given one, for the hub to serve the missed updates
+// without opening an SSE connection.
+type TransportHistory interface {
+	// FetchSince returns, oldest first, up to limit updates published after
+	// the one with the ID lastEventID, or since the beginning of the history
+	// for EarliestLastEventID, having one of the topics, or any topic when
+	// topics is empty. Retracted updates are omitted. It returns
+	// ErrUpdateNotFound if lastEventID is not in the history.
+	//
+	// The private updates are returned too: the caller must check that they
+	// can be disclosed.
+	FetchSince(ctx context.Context, lastEventID string, topics []string, limit int) ([]*Update, error)
+}
+
+// TransportDisconnecter may be implemented by transports to disconnect
+// subscribers in bulk.
+type TransportDisconnecter interface {
+	// DisconnectSubscribers disconnects the subscribers matching the selector
+	// and returns their count, or only counts them when dryRun is true.
+	// Transports shared by several hubs must disconnect the matching
+	// subscribers of all of them and return the total count.
+	DisconnectSubscribers(ctx context.Context, sel *SubscriberSelector, dryRun bool) (int, error)
+}
+
+// TransportRedeliverer may be implemented by transports to deliver an update
+// again to some subscribers, such as the updates they missed (see
+// WithDeadLetters).
+type TransportRedeliverer interface {
+	// Redeliver dispatches the update, without storing it, to the connected
+	// subscribers matching the selector and allowed to receive it, and returns
+	// their count. Transports shared by several hubs must deliver it to the
+	// matching subscribers of all of them and return the total count.
+	Redeliver(ctx context.Context, sel *SubscriberSelector, u *Update) (int, error)
+}
+
+// TransportSynchronousDispatcher may be implemented by transports handing the
+// updates to their local subscribers before Dispatch returns, instead of
+// receiving them back from a broker, which the delivery receipts require (see
+// Hub.PublishWithReceipt).
+type TransportSynchronousDispatcher interface {
+	// DispatchesSynchronously reports whether Dispatch hands the update to
+	// the local subscribers before returning.
+	DispatchesSynchronously() bool
+}
+
 // TransportHealthChecker may be implemented by transports that support health checking.
 // Transports that do not implement this interface are assumed to always be healthy.
 type TransportHealthChecker interface {
@@ -61,6 +157,22 @@ type TransportHealthChecker interface {
 // ErrClosedTransport is returned by the Transport's Dispatch and AddSubscriber methods after a call to Close.
 var ErrClosedTransport = errors.New("hub: read/write on closed Transport")
 
+// isClosed reports whether the channel signaling the closing of a transport is
+// closed.
+func isClosed(closed <-chan struct{}) bool {
+	select {
+	case <-closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// ErrUpdateNotFound is returned by TransportRetracter's methods when the
+// update is not in the history or has already been retracted, and by
+// TransportHistory's when the update is not in the history.
+var ErrUpdateNotFound = errors.New("update not found in history")
+
 // TransportError is returned when the Transport's DSN is invalid.
 type TransportError struct {
 	dsn string
@@ -7,31 +7,30 @@ import (
 	"log/slog"
 	"net/url"
 	"strconv"
-	"sync"
 )
 
-var (
-	// Deprecated: directly instantiate the transport or use transports Caddy modules.
-	transportFactories   = make(map[string]TransportFactory) //nolint:gochecknoglobals
-	transportFactoriesMu sync.RWMutex                        //nolint:gochecknoglobals
-)
-
-func init() { //nolint:gochecknoinits
-	//mercure:deadlock
-	RegisterTransportFactory("bolt", DeprecatedNewBoltTransport)
-	RegisterTransportFactory("local", DeprecatedNewLocalTransport)
+// Deprecated: directly instantiate the transport or use transports Caddy modules.
+//
+//nolint:gochecknoglobals
+var deprecatedTransportFactories = map[string]TransportFactory{
+	"bolt":  DeprecatedNewBoltTransport,
+	"local": DeprecatedNewLocalTransport,
 }
 
-// Deprecated: TransportFactory is the factory to initialize a new transport.
-type TransportFactory = func(u *url.URL, l *slog.Logger) (Transport, error)
-
+// NewTransport creates the transport with the factory registered for the
+// scheme with RegisterTransportFactory, the deprecated bolt and local
+// factories being used instead of the built-in ones.
+//
 // Deprecated: directly instantiate the transport or use transports Caddy modules.
 func NewTransport(u *url.URL, l *slog.Logger) (Transport, error) { //nolint:ireturn
-	transportFactoriesMu.RLock()
-
-	f, ok := transportFactories[u.Scheme]
+	f, ok := lookupRegisteredTransportFactory(u.Scheme)
+	if !ok {
+		f, ok = deprecatedTransportFactories[u.Scheme]
+	}
 
-	transportFactoriesMu.RUnlock()
+	if !ok {
+		f, ok = lookupTransportFactory(u.Scheme)
+	}
 
 	if !ok {
 		return nil, &TransportError{dsn: u.Redacted(), msg: "no such transport available"}
@@ -40,15 +39,6 @@ func NewTransport(u *url.URL, l *slog.Logger) (Transport, error) { //nolint:iret
 	return f(u, l)
 }
 
-// Deprecated: directly instantiate the transport or use transports Caddy modules.
-func RegisterTransportFactory(scheme string, factory TransportFactory) {
-	transportFactoriesMu.Lock()
-
-	transportFactories[scheme] = factory
-
-	transportFactoriesMu.Unlock()
-}
-
 // DeprecatedNewBoltTransport creates a new BoltTransport.
 //
 // Deprecated: use NewBoltTransport() instead.
@@ -90,12 +80,12 @@ func DeprecatedNewBoltTransport(u *url.URL, l *slog.Logger) (Transport, error) {
 		return nil, &TransportError{u.Redacted(), "missing path", err}
 	}
 
-	return NewBoltTransport(NewSubscriberList(DefaultSubscriberListCacheSize), l, path, bucketName, size, cleanupFrequency)
+	return NewBoltTransport(NewSubscriberList(0), l, path, bucketName, size, cleanupFrequency)
 }
 
 // DeprecatedNewLocalTransport creates a new LocalTransport.
 //
 // Deprecated: use NewLocalTransport() instead.
 func DeprecatedNewLocalTransport(_ *url.URL, _ *slog.Logger) (Transport, error) { //nolint:ireturn
-	return NewLocalTransport(NewSubscriberList(DefaultSubscriberListCacheSize)), nil
+	return NewLocalTransport(NewSubscriberList(0)), nil
 }
@@ -0,0 +1,590 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrUnknownTransport is returned by NewTransportFromDSN when no factory is
+	// registered for the scheme of the DSN.
+	ErrUnknownTransport = errors.New("unknown scheme")
+	// ErrUnknownTransportParameter is returned by NewTransportFromDSN when the
+	// DSN has a parameter the transport doesn't support.
+	ErrUnknownTransportParameter = errors.New("unknown parameter")
+	// ErrInvalidTransportParameter is returned by NewTransportFromDSN when a
+	// parameter of the DSN has an invalid value.
+	ErrInvalidTransportParameter = errors.New("invalid parameter")
+)
+
+// TransportFactory creates the transport described by a DSN, the scheme of u
+// being the one it is registered for with RegisterTransportFactory.
+type TransportFactory = func(u *url.URL, l *slog.Logger) (Transport, error)
+
+var (
+	// builtinTransportFactories are the factories of the transports of this
+	// package, used for the schemes having no registered factory.
+	builtinTransportFactories = make(map[string]TransportFactory) //nolint:gochecknoglobals
+	transportFactories        = make(map[string]TransportFactory) //nolint:gochecknoglobals
+	transportFactoriesMu      sync.RWMutex                        //nolint:gochecknoglobals
+)
+
+func init() { //nolint:gochecknoinits
+	//mercure:deadlock
+	builtinTransportFactories["bolt"] = newBoltTransportFromDSN
+	builtinTransportFactories["local"] = newLocalTransportFromDSN
+	builtinTransportFactories["redis"] = newRedisTransportFromDSN
+	builtinTransportFactories["rediss"] = newRedisTransportFromDSN
+	builtinTransportFactories["kafka"] = newKafkaTransportFromDSN
+	builtinTransportFactories["kafkas"] = newKafkaTransportFromDSN
+	builtinTransportFactories["dual"] = newDualTransportFromDSN
+	builtinTransportFactories["warmup"] = newWarmUpTransportFromDSN
+	builtinTransportFactories["fallback"] = newFallbackTransportFromDSN
+	builtinTransportFactories["ipc"] = newIPCTransportFromDSN
+}
+
+// RegisterTransportFactory makes NewTransportFromDSN, and so the transport_url
+// directive of the Caddy module and mercure migrate, create the transports of
+// the DSNs with the given scheme with factory. It is usually called from the
+// init function of the package providing the transport, and replaces the
+// factory previously registered for the scheme, the built-in ones included.
+//
+// The factory must accept the subscriber_shards parameter common to all
+// transports, and the deprecated subscriber_list_cache_size one.
+func RegisterTransportFactory(scheme string, factory TransportFactory) {
+	transportFactoriesMu.Lock()
+
+	transportFactories[scheme] = factory
+
+	transportFactoriesMu.Unlock()
+}
+
+// lookupTransportFactory returns the factory registered for the scheme, or
+// the built-in one.
+func lookupTransportFactory(scheme string) (TransportFactory, bool) {
+	if f, ok := lookupRegisteredTransportFactory(scheme); ok {
+		return f, true
+	}
+
+	f, ok := builtinTransportFactories[scheme]
+
+	return f, ok
+}
+
+// lookupRegisteredTransportFactory returns the factory registered for the
+// scheme with RegisterTransportFactory.
+func lookupRegisteredTransportFactory(scheme string) (TransportFactory, bool) {
+	transportFactoriesMu.RLock()
+	defer transportFactoriesMu.RUnlock()
+
+	f, ok := transportFactories[scheme]
+
+	return f, ok
+}
+
+// NewTransportFromDSN creates the transport described by a DSN. Errors are
+// of type *TransportError, wrapping ErrUnknownTransport,
+// ErrUnknownTransportParameter or ErrInvalidTransportParameter when the DSN
+// is invalid.
+//
+// Supported DSNs are:
+//
+//   - bolt:///absolute/path.db or bolt://relative.db, with the optional
+//     bucket_name, size, cleanup_frequency, integrity_check, recover,
+//     compaction, compaction_tail, event_ttl and hash_chain parameters of the
+//     bolt transport
+//   - local://
+//   - redis://[[user]:password@]host[:port][/db], or rediss:// for TLS, with
+//     the optional stream and max_length parameters of the Redis transport
+//   - kafka://[user:password@]host[:port][/path], or kafkas:// for HTTPS, the
+//     address of a Kafka REST Proxy, with the optional topic and group
+//     parameters of the Kafka transport
+//   - dual://?old=<dsn>&new=<dsn>[&cutover=1], the DSNs being URL-encoded
+//   - warmup://?transport=<dsn>[&queue_size=10000], opening the transport in
+//     the background with a WarmUpTransport
+//   - ipc:///absolute/directory or ipc://relative-directory, the directory of
+//     the sockets of an IPCTransport ring, with the optional scan_interval and
+//     queue_size parameters
+//
+// All of them but dual accept the subscriber_shards parameter, and the
+// deprecated subscriber_list_cache_size one, which is ignored. Other schemes can be registered with
+// RegisterTransportFactory.
+func NewTransportFromDSN(dsn string, logger *slog.Logger) (Transport, error) { //nolint:ireturn
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, &TransportError{dsn: dsn, err: err}
+	}
+
+	f, ok := lookupTransportFactory(u.Scheme)
+	if !ok {
+		return nil, &TransportError{dsn: u.Redacted(), err: ErrUnknownTransport}
+	}
+
+	return f(u, logger)
+}
+
+func newBoltTransportFromDSN(u *url.URL, logger *slog.Logger) (Transport, error) { //nolint:ireturn
+	p := newDSNParameters(u)
+
+	path := p.url.Path // absolute path (bolt:///path.db)
+	if path == "" {
+		path = p.url.Host // relative path (bolt://path.db)
+	}
+
+	if path == "" {
+		return nil, &TransportError{dsn: p.url.Redacted(), msg: "missing path"}
+	}
+
+	newList, err := p.subscriberList()
+	if err != nil {
+		return nil, err
+	}
+
+	size, err := p.uint("size", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	cleanupFrequency, err := p.float("cleanup_frequency", BoltDefaultCleanupFrequency)
+	if err != nil {
+		return nil, err
+	}
+
+	integrityCheck, err := p.bool("integrity_check")
+	if err != nil {
+		return nil, err
+	}
+
+	recoverDB, err := p.bool("recover")
+	if err != nil {
+		return nil, err
+	}
+
+	compaction, err := p.bool("compaction")
+	if err != nil {
+		return nil, err
+	}
+
+	compactionTail, err := p.uint("compaction_tail", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	eventTTL, err := p.duration("event_ttl", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	hashChain, err := p.bool("hash_chain")
+	if err != nil {
+		return nil, err
+	}
+
+	bucketName := p.string("bucket_name")
+
+	if err := p.checkUnknown(); err != nil {
+		return nil, err
+	}
+
+	if integrityCheck || recoverDB {
+		if err := VerifyBoltDatabase(path, recoverDB, logger); err != nil {
+			return nil, &TransportError{dsn: p.url.Redacted(), err: err}
+		}
+	}
+
+	sl := newList()
+
+	t, err := NewBoltTransport(sl, logger, path, bucketName, size, cleanupFrequency)
+	if err != nil {
+		sl.Close()
+
+		return nil, err
+	}
+
+	if compaction {
+		t.EnableCompaction(compactionTail)
+	}
+
+	t.SetEventTTL(eventTTL)
+
+	if hashChain {
+		t.EnableHashChain()
+	}
+
+	return t, nil
+}
+
+func newLocalTransportFromDSN(u *url.URL, _ *slog.Logger) (Transport, error) { //nolint:ireturn
+	p := newDSNParameters(u)
+
+	newList, err := p.subscriberList()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.checkUnknown(); err != nil {
+		return nil, err
+	}
+
+	return NewLocalTransport(newList()), nil
+}
+
+func newRedisTransportFromDSN(u *url.URL, logger *slog.Logger) (Transport, error) { //nolint:ireturn
+	p := newDSNParameters(u)
+
+	if p.url.Host == "" {
+		return nil, &TransportError{dsn: p.url.Redacted(), msg: "missing host"}
+	}
+
+	newList, err := p.subscriberList()
+	if err != nil {
+		return nil, err
+	}
+
+	maxLen, err := p.uint("max_length", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := p.string("stream")
+
+	if err := p.checkUnknown(); err != nil {
+		return nil, err
+	}
+
+	redisURL := *p.url
+	redisURL.RawQuery = ""
+
+	sl := newList()
+
+	t, err := NewRedisTransport(sl, logger, redisURL.String(), stream, maxLen)
+	if err != nil {
+		sl.Close()
+
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func newKafkaTransportFromDSN(u *url.URL, logger *slog.Logger) (Transport, error) { //nolint:ireturn
+	p := newDSNParameters(u)
+
+	if p.url.Host == "" {
+		return nil, &TransportError{dsn: p.url.Redacted(), msg: "missing host"}
+	}
+
+	newList, err := p.subscriberList()
+	if err != nil {
+		return nil, err
+	}
+
+	topic, group := p.string("topic"), p.string("group")
+
+	if err := p.checkUnknown(); err != nil {
+		return nil, err
+	}
+
+	proxyURL := *p.url
+	proxyURL.RawQuery = ""
+
+	proxyURL.Scheme = "http"
+	if p.url.Scheme == "kafkas" {
+		proxyURL.Scheme = "https"
+	}
+
+	sl := newList()
+
+	t, err := NewKafkaTransport(sl, logger, proxyURL.String(), topic, group, nil)
+	if err != nil {
+		sl.Close()
+
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func newIPCTransportFromDSN(u *url.URL, logger *slog.Logger) (Transport, error) { //nolint:ireturn
+	p := newDSNParameters(u)
+
+	dir := p.url.Path // absolute path (ipc:///run/mercure)
+	if dir == "" {
+		dir = p.url.Host // relative path (ipc://mercure)
+	}
+
+	if dir == "" {
+		return nil, &TransportError{dsn: p.url.Redacted(), msg: "missing directory"}
+	}
+
+	newList, err := p.subscriberList()
+	if err != nil {
+		return nil, err
+	}
+
+	scanInterval, err := p.duration("scan_interval", DefaultIPCScanInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	queueSize, err := p.int("queue_size", DefaultIPCQueueSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.checkUnknown(); err != nil {
+		return nil, err
+	}
+
+	sl := newList()
+
+	t, err := NewIPCTransport(sl, logger, dir, scanInterval, queueSize)
+	if err != nil {
+		sl.Close()
+
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func newDualTransportFromDSN(u *url.URL, logger *slog.Logger) (Transport, error) { //nolint:ireturn
+	p := newDSNParameters(u)
+
+	oldDSN, newDSN := p.string("old"), p.string("new")
+	if oldDSN == "" || newDSN == "" {
+		return nil, &TransportError{dsn: p.url.Redacted(), msg: `the "old" and "new" parameters are required`}
+	}
+
+	cutover, err := p.bool("cutover")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := p.checkUnknown(); err != nil {
+		return nil, err
+	}
+
+	from, err := NewTransportFromDSN(oldDSN, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := NewTransportFromDSN(newDSN, logger)
+	if err != nil {
+		_ = from.Close(context.Background())
+
+		return nil, err
+	}
+
+	return NewDualTransport(from, to, logger, cutover), nil
+}
+
+func newWarmUpTransportFromDSN(u *url.URL, logger *slog.Logger) (Transport, error) { //nolint:ireturn
+	p := newDSNParameters(u)
+
+	dsn := p.string("transport")
+	if dsn == "" {
+		return nil, &TransportError{dsn: p.url.Redacted(), msg: `the "transport" parameter is required`}
+	}
+
+	queueSize, err := p.int("queue_size", DefaultWarmUpQueueSize)
+	if err != nil {
+		return nil, err
+	}
+
+	if queueSize < 1 {
+		return nil, p.invalid("queue_size", ErrWarmUpQueueFull)
+	}
+
+	// The parameters common to all transports apply to the warmed up one,
+	// unless its DSN sets them.
+	dsn = p.forwardCommon(dsn)
+
+	if err := p.checkUnknown(); err != nil {
+		return nil, err
+	}
+
+	return NewWarmUpTransport(func(context.Context) (Transport, error) {
+		return NewTransportFromDSN(dsn, logger)
+	}, logger, queueSize), nil
+}
+
+func newFallbackTransportFromDSN(u *url.URL, logger *slog.Logger) (Transport, error) { //nolint:ireturn
+	p := newDSNParameters(u)
+
+	dsn := p.string("transport")
+	if dsn == "" {
+		return nil, &TransportError{dsn: p.url.Redacted(), msg: `the "transport" parameter is required`}
+	}
+
+	// The parameters common to all transports apply to the wrapped one,
+	// unless its DSN sets them.
+	dsn = p.forwardCommon(dsn)
+
+	if err := p.checkUnknown(); err != nil {
+		return nil, err
+	}
+
+	t, err := NewTransportFromDSN(dsn, logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFallbackTransport(t, logger), nil
+}
+
+// dsnParameters reads the query parameters of a DSN, and remembers the ones
+// read to report the unknown ones.
+type dsnParameters struct {
+	url   *url.URL
+	query url.Values
+	read  []string
+}
+
+func newDSNParameters(u *url.URL) *dsnParameters {
+	return &dsnParameters{url: u, query: u.Query()}
+}
+
+func (p *dsnParameters) string(name string) string {
+	p.read = append(p.read, name)
+
+	return p.query.Get(name)
+}
+
+func (p *dsnParameters) invalid(name string, err error) error {
+	return &TransportError{dsn: p.url.Redacted(), err: fmt.Errorf("%w %q: %w", ErrInvalidTransportParameter, name, err)}
+}
+
+func (p *dsnParameters) uint(name string, def uint64) (uint64, error) {
+	v := p.string(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		return 0, p.invalid(name, err)
+	}
+
+	return n, nil
+}
+
+func (p *dsnParameters) int(name string, def int) (int, error) {
+	v := p.string(name)
+	if v == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, p.invalid(name, err)
+	}
+
+	return n, nil
+}
+
+func (p *dsnParameters) float(name string, def float64) (float64, error) {
+	v := p.string(name)
+	if v == "" {
+		return def, nil
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, p.invalid(name, err)
+	}
+
+	return f, nil
+}
+
+func (p *dsnParameters) duration(name string, def time.Duration) (time.Duration, error) {
+	v := p.string(name)
+	if v == "" {
+		return def, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, p.invalid(name, err)
+	}
+
+	if d < 0 {
+		return 0, p.invalid(name, fmt.Errorf("%q: %w", v, strconv.ErrRange))
+	}
+
+	return d, nil
+}
+
+func (p *dsnParameters) bool(name string) (bool, error) {
+	v := p.string(name)
+	if v == "" {
+		return false, nil
+	}
+
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, p.invalid(name, err)
+	}
+
+	return b, nil
+}
+
+// forwardCommon adds the parameters common to all transports to the DSN of a
+// wrapped transport not setting them.
+func (p *dsnParameters) forwardCommon(dsn string) string {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return dsn
+	}
+
+	query := u.Query()
+	if v := p.string("subscriber_shards"); v != "" && !query.Has("subscriber_shards") {
+		query.Set("subscriber_shards", v)
+	}
+
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// subscriberList reads the parameters common to all transports, and returns
+// a function creating the subscriber list they describe, to call once all
+// the parameters are valid.
+func (p *dsnParameters) subscriberList() (func() *SubscriberList, error) {
+	// Deprecated: the list has no cache anymore.
+	p.string("subscriber_list_cache_size")
+
+	shards, err := p.int("subscriber_shards", 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if shards < 1 {
+		return nil, p.invalid("subscriber_shards", ErrInvalidSubscriberShards)
+	}
+
+	return func() *SubscriberList {
+		sl := NewSubscriberList(0)
+		sl.SetShards(shards)
+
+		return sl
+	}, nil
+}
+
+func (p *dsnParameters) checkUnknown() error {
+	for name := range p.query {
+		if !slices.Contains(p.read, name) {
+			return &TransportError{dsn: p.url.Redacted(), err: fmt.Errorf("%w %q", ErrUnknownTransportParameter, name)}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,181 @@
+package mercure
+
+import (
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTransportFromDSN(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	tr, err := NewTransportFromDSN("local://?subscriber_shards=4", slog.Default())
+	require.NoError(t, err)
+	require.IsType(t, &LocalTransport{}, tr)
+	assert.Equal(t, 4, tr.(*LocalTransport).subscribers.Shards())
+	require.NoError(t, tr.Close(t.Context()))
+
+	tr, err = NewTransportFromDSN("bolt://"+filepath.Join(dir, "bolt.db")+"?bucket_name=foo&size=10&cleanup_frequency=0.5&integrity_check=1", slog.Default())
+	require.NoError(t, err)
+
+	bt := tr.(*BoltTransport)
+	assert.Equal(t, "foo", bt.bucketName)
+	assert.Equal(t, uint64(10), bt.size)
+	assert.InDelta(t, 0.5, bt.cleanupFrequency, 0)
+	assert.False(t, bt.compaction)
+	assert.False(t, bt.hashChain)
+	require.NoError(t, tr.Close(t.Context()))
+
+	tr, err = NewTransportFromDSN("bolt://"+filepath.Join(dir, "compacted.db")+"?compaction=1&compaction_tail=100&event_ttl=1h&hash_chain=1", slog.Default())
+	require.NoError(t, err)
+
+	bt = tr.(*BoltTransport)
+	assert.True(t, bt.compaction)
+	assert.Equal(t, uint64(100), bt.compactionTail)
+	assert.Equal(t, time.Hour, bt.eventTTL)
+	assert.True(t, bt.hashChain)
+	require.NoError(t, tr.Close(t.Context()))
+
+	tr, err = NewTransportFromDSN("ipc://"+filepath.Join(dir, "ring")+"?scan_interval=10ms&queue_size=10&subscriber_shards=2", slog.Default())
+	require.NoError(t, err)
+
+	it := tr.(*IPCTransport)
+	assert.Equal(t, 10*time.Millisecond, it.scanInterval)
+	assert.Equal(t, 10, cap(it.queue))
+	assert.Equal(t, 2, it.local.subscribers.Shards())
+	require.NoError(t, tr.Close(t.Context()))
+
+	dual := "dual://?" + url.Values{
+		"old":     {"bolt://" + filepath.Join(dir, "old.db")},
+		"new":     {"local://"},
+		"cutover": {"true"},
+	}.Encode()
+
+	tr, err = NewTransportFromDSN(dual, slog.Default())
+	require.NoError(t, err)
+	require.IsType(t, &DualTransport{}, tr)
+	assert.True(t, tr.(*DualTransport).IsCutover())
+	require.NoError(t, tr.Close(t.Context()))
+
+	srv := newFakeRedisServer(t, "")
+
+	tr, err = NewTransportFromDSN("redis://"+srv.addr+"?stream=updates&max_length=100&subscriber_shards=2", slog.Default())
+	require.NoError(t, err)
+
+	rt := tr.(*RedisTransport)
+	assert.Equal(t, "updates", rt.streamKey)
+	assert.Equal(t, uint64(100), rt.maxLen)
+	assert.Equal(t, 2, rt.subscribers.Shards())
+	require.NoError(t, tr.Close(t.Context()))
+
+	proxy := newFakeKafkaRESTProxy(t, 2)
+
+	tr, err = NewTransportFromDSN(strings.Replace(proxy.URL, "http://", "kafka://", 1)+"?topic=mercure&group=hub-1&subscriber_shards=2", slog.Default())
+	require.NoError(t, err)
+
+	kt := tr.(*KafkaTransport)
+	assert.Equal(t, "mercure", kt.proxy.topic)
+	assert.Equal(t, "http", kt.proxy.url.Scheme)
+	assert.Equal(t, "hub-1", kt.group)
+	assert.Equal(t, 2, kt.subscribers.Shards())
+	require.NoError(t, tr.Close(t.Context()))
+
+	tr, err = NewTransportFromDSN("fallback://?subscriber_shards=2&transport="+url.QueryEscape("bolt://"+filepath.Join(dir, "fallback.db")), slog.Default())
+	require.NoError(t, err)
+	require.IsType(t, &FallbackTransport{}, tr)
+	assert.Equal(t, 2, tr.(*FallbackTransport).transport.(*BoltTransport).subscribers.Shards())
+	require.NoError(t, tr.Close(t.Context()))
+
+	tr, err = NewTransportFromDSN("warmup://?queue_size=10&subscriber_shards=2&transport="+url.QueryEscape("bolt://"+filepath.Join(dir, "warmup.db")), slog.Default())
+	require.NoError(t, err)
+	require.IsType(t, &WarmUpTransport{}, tr)
+	assert.Equal(t, 10, tr.(*WarmUpTransport).queueSize)
+	require.Eventually(t, tr.(*WarmUpTransport).IsWarmedUp, time.Second, time.Millisecond)
+	assert.Equal(t, 2, tr.(*WarmUpTransport).transport.(*BoltTransport).subscribers.Shards())
+	require.NoError(t, tr.Close(t.Context()))
+}
+
+func TestNewTransportFromDSNErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	for dsn, expected := range map[string]error{
+		"foo://":                                          ErrUnknownTransport,
+		"local://?foo=bar":                                ErrUnknownTransportParameter,
+		"local://?subscriber_shards=0":                    ErrInvalidTransportParameter,
+		"bolt://" + dir + "/a.db?size=-1":                 ErrInvalidTransportParameter,
+		"bolt://" + dir + "/b.db?recover=maybe":           ErrInvalidTransportParameter,
+		"bolt://" + dir + "/c.db?cleanup_frequency":       nil,
+		"bolt://" + dir + "/d.db?event_ttl=-1s":           ErrInvalidTransportParameter,
+		"bolt://" + dir + "/e.db?event_ttl=forever":       ErrInvalidTransportParameter,
+		"dual://?old=local%3A%2F%2F&new=foo%3A%2F%2F":     ErrUnknownTransport,
+		"warmup://?transport=local%3A%2F%2F&queue_size=0": ErrInvalidTransportParameter,
+		"fallback://?transport=foo%3A%2F%2F":              ErrUnknownTransport,
+		"fallback://?transport=local%3A%2F%2F&foo=bar":    ErrUnknownTransportParameter,
+		"redis://localhost?max_length=-1":                 ErrInvalidTransportParameter,
+		"redis://localhost?foo=bar":                       ErrUnknownTransportParameter,
+		"kafka://localhost?foo=bar":                       ErrUnknownTransportParameter,
+	} {
+		tr, err := NewTransportFromDSN(dsn, slog.Default())
+		if expected == nil {
+			require.NoError(t, err, dsn)
+			require.NoError(t, tr.Close(t.Context()))
+
+			continue
+		}
+
+		var te *TransportError
+
+		require.ErrorAs(t, err, &te, dsn)
+		require.ErrorIs(t, err, expected, dsn)
+	}
+
+	_, err := NewTransportFromDSN("bolt://", slog.Default())
+	require.EqualError(t, err, `"bolt:": invalid transport: missing path`)
+
+	_, err = NewTransportFromDSN("dual://?old=local%3A%2F%2F", slog.Default())
+	require.Error(t, err)
+
+	_, err = NewTransportFromDSN("redis://", slog.Default())
+	require.EqualError(t, err, `"redis:": invalid transport: missing host`)
+
+	_, err = NewTransportFromDSN("kafka://?topic=mercure", slog.Default())
+	require.EqualError(t, err, `"kafka:?topic=mercure": invalid transport: missing host`)
+
+	_, err = NewTransportFromDSN("warmup://", slog.Default())
+	require.EqualError(t, err, `"warmup:": invalid transport: the "transport" parameter is required`)
+}
+
+func TestRegisterTransportFactory(t *testing.T) {
+	t.Parallel()
+
+	RegisterTransportFactory("registered", func(u *url.URL, _ *slog.Logger) (Transport, error) {
+		if u.Query().Get("fail") != "" {
+			return nil, &TransportError{dsn: u.Redacted(), err: ErrInvalidTransportParameter}
+		}
+
+		return NewLocalTransport(NewSubscriberList(0)), nil
+	})
+
+	tr, err := NewTransportFromDSN("registered://", slog.Default())
+	require.NoError(t, err)
+	require.IsType(t, &LocalTransport{}, tr)
+	require.NoError(t, tr.Close(t.Context()))
+
+	_, err = NewTransportFromDSN("registered://?fail=1", slog.Default())
+	require.ErrorIs(t, err, ErrInvalidTransportParameter)
+
+	// Usable by the composite transports.
+	tr, err = NewTransportFromDSN("dual://?old=registered%3A%2F%2F&new=local%3A%2F%2F", slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, tr.Close(t.Context()))
+}
@@ -0,0 +1,93 @@
+package mercure
+
+import (
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSubscriber creates a subscriber to the given topics, allowed to
+// receive their private updates.
+func newTestSubscriber(lastEventID string, topics ...string) *LocalSubscriber {
+	s := NewLocalSubscriber(lastEventID, slog.Default(), &TopicMatcherStore{})
+	s.setMatchers(stringsToExactMatchers(topics), stringsToExactMatchers(topics))
+
+	return s
+}
+
+// testTransportConcurrentClose closes the transport while updates are
+// dispatched and subscribers added, then checks that all the subscribers added
+// successfully are disconnected, and that the transport rejects the next
+// operations.
+func testTransportConcurrentClose(t *testing.T, transport Transport) {
+	t.Helper()
+
+	ctx := t.Context()
+	tms := &TopicMatcherStore{}
+	topic := "https://example.com/foo"
+
+	newSubscriber := func() *LocalSubscriber {
+		s := NewLocalSubscriber("", slog.Default(), tms)
+		s.setMatchers(stringsToExactMatchers([]string{topic}), nil)
+
+		return s
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		added []*LocalSubscriber
+	)
+
+	for i := range 100 {
+		wg.Go(func() {
+			s := newSubscriber()
+			if err := transport.AddSubscriber(ctx, s); err != nil {
+				assert.ErrorIs(t, err, ErrClosedTransport)
+
+				return
+			}
+
+			mu.Lock()
+			added = append(added, s)
+			mu.Unlock()
+		})
+
+		wg.Go(func() {
+			if err := transport.Dispatch(ctx, &Update{Topic: topic}); err != nil {
+				assert.ErrorIs(t, err, ErrClosedTransport)
+			}
+		})
+
+		if i%25 == 10 {
+			wg.Go(func() { assert.NoError(t, transport.Close(ctx)) })
+		}
+	}
+
+	wg.Wait()
+
+	for _, s := range added {
+		timeout := time.After(5 * time.Second)
+
+	drain:
+		for {
+			select {
+			case _, ok := <-s.Receive():
+				if !ok {
+					break drain
+				}
+			case <-timeout:
+				require.Fail(t, "subscriber not disconnected by Close")
+			}
+		}
+	}
+
+	require.NoError(t, transport.Close(ctx))
+	require.ErrorIs(t, transport.Dispatch(ctx, &Update{Topic: topic}), ErrClosedTransport)
+	require.ErrorIs(t, transport.AddSubscriber(ctx, newSubscriber()), ErrClosedTransport)
+	require.ErrorIs(t, transport.RemoveSubscriber(ctx, newSubscriber()), ErrClosedTransport)
+}
@@ -0,0 +1,29 @@
+//go:build integration
+
+package transporttest_test
+
+import (
+	"log/slog"
+	"testing"
+
+	"github.com/dunglas/mercure"
+	"github.com/dunglas/mercure/testsupport"
+	"github.com/dunglas/mercure/transporttest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisTransportIntegration(t *testing.T) {
+	t.Parallel()
+
+	redisURL := testsupport.Start(t, testsupport.Redis)
+
+	transporttest.RunConformanceTests(t, func(t *testing.T) mercure.Transport {
+		t.Helper()
+
+		// A stream per test: the server is shared.
+		transport, err := mercure.NewRedisTransport(mercure.NewSubscriberList(0), slog.Default(), redisURL, testsupport.UniqueName(t), 0)
+		require.NoError(t, err)
+
+		return transport
+	})
+}
@@ -0,0 +1,373 @@
+// Package transporttest provides a conformance test suite for the implementations of mercure.Transport.
+package transporttest
+
+import (
+	"context"
+	"log/slog"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dunglas/mercure"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// receiveTimeout is how long the suite waits for an update.
+const receiveTimeout = 5 * time.Second
+
+// Factory creates a new, empty, transport for a test. The suite closes it,
+// but the factory must release the other resources it allocates, for instance
+// with t.Cleanup.
+type Factory func(t *testing.T) mercure.Transport
+
+// RunConformanceTests checks that the transports created by factory implement
+// the semantics of mercure.Transport the hub relies on: dispatch to the
+// matching subscribers, ordering, concurrent subscribers and Close.
+//
+// The history replay and Last-Event-ID tests run when the transport
+// implements mercure.TransportHistoryReader, and the group dispatch test when
+// it implements mercure.TransportGroupDispatcher.
+func RunConformanceTests(t *testing.T, factory Factory) {
+	t.Helper()
+
+	tests := []struct {
+		name string
+		test func(t *testing.T, transport *conformanceTransport)
+	}{
+		{"Dispatch", testDispatch},
+		{"DispatchOrder", testDispatchOrder},
+		{"DispatchGroup", testDispatchGroup},
+		{"RemoveSubscriber", testRemoveSubscriber},
+		{"ConcurrentSubscribers", testConcurrentSubscribers},
+		{"History", testHistory},
+		{"EarliestLastEventID", testEarliestLastEventID},
+		{"UnknownLastEventID", testUnknownLastEventID},
+		{"Close", testClose},
+		{"ConcurrentClose", testConcurrentClose},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			transport := &conformanceTransport{factory(t), &mercure.TopicMatcherStore{}}
+			if ts, ok := transport.Transport.(mercure.TransportTopicMatcherStore); ok {
+				ts.SetTopicMatcherStore(transport.tms)
+			}
+
+			t.Cleanup(func() {
+				assert.NoError(t, transport.Close(context.Background()))
+			})
+
+			tc.test(t, transport)
+		})
+	}
+}
+
+// conformanceTransport is the transport under test, with the topic matcher
+// store passed to its subscribers like the hub does.
+type conformanceTransport struct {
+	mercure.Transport
+
+	tms *mercure.TopicMatcherStore
+}
+
+// addSubscriber adds a subscriber to the given topics to the transport.
+func addSubscriber(t *testing.T, transport *conformanceTransport, lastEventID string, topics ...string) *mercure.LocalSubscriber {
+	t.Helper()
+
+	s := newSubscriber(transport, lastEventID, topics...)
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+
+	return s
+}
+
+func newSubscriber(transport *conformanceTransport, lastEventID string, topics ...string) *mercure.LocalSubscriber {
+	matchers := make([]mercure.TopicMatcher, 0, len(topics))
+	for _, topic := range topics {
+		matchers = append(matchers, mercure.TopicMatcher{Type: mercure.MatcherTypeExact, Pattern: topic})
+	}
+
+	s := mercure.NewLocalSubscriber(lastEventID, slog.Default(), transport.tms)
+	s.SetMatchers(matchers, nil)
+
+	return s
+}
+
+func dispatch(t *testing.T, transport *conformanceTransport, topic, data string) *mercure.Update {
+	t.Helper()
+
+	u := &mercure.Update{Topic: topic, Event: mercure.Event{Data: data}}
+	require.NoError(t, transport.Dispatch(t.Context(), u))
+
+	return u
+}
+
+// receive returns the next update received by the subscriber.
+func receive(t *testing.T, s *mercure.LocalSubscriber) *mercure.Update {
+	t.Helper()
+
+	select {
+	case u, ok := <-s.Receive():
+		require.True(t, ok, "subscriber disconnected")
+
+		return u
+	case <-time.After(receiveTimeout):
+		require.FailNow(t, "no update received")
+
+		return nil
+	}
+}
+
+// receiveData returns the data of the next n updates received by the
+// subscriber.
+func receiveData(t *testing.T, s *mercure.LocalSubscriber, n int) []string {
+	t.Helper()
+
+	data := make([]string, 0, n)
+	for range n {
+		data = append(data, receive(t, s).Data)
+	}
+
+	return data
+}
+
+func testDispatch(t *testing.T, transport *conformanceTransport) {
+	foo := addSubscriber(t, transport, "", "https://example.com/foo")
+	bar := addSubscriber(t, transport, "", "https://example.com/bar")
+
+	u := dispatch(t, transport, "https://example.com/foo", "foo")
+	assert.NotEmpty(t, u.ID, "the transport must assign an ID to the updates")
+
+	dispatch(t, transport, "https://example.com/bar", "bar")
+
+	received := receive(t, foo)
+	assert.Equal(t, "foo", received.Data)
+	assert.Equal(t, u.ID, received.ID)
+
+	// The update of foo is not dispatched to the subscriber of bar.
+	assert.Equal(t, "bar", receive(t, bar).Data)
+}
+
+func testDispatchOrder(t *testing.T, transport *conformanceTransport) {
+	s := addSubscriber(t, transport, "", "https://example.com/foo")
+
+	expected := make([]string, 100)
+	for i := range expected {
+		expected[i] = strconv.Itoa(i)
+		dispatch(t, transport, "https://example.com/foo", expected[i])
+	}
+
+	assert.Equal(t, expected, receiveData(t, s, len(expected)))
+}
+
+func testDispatchGroup(t *testing.T, transport *conformanceTransport) {
+	gd, ok := transport.Transport.(mercure.TransportGroupDispatcher)
+	if !ok {
+		t.Skip("the transport does not implement mercure.TransportGroupDispatcher")
+	}
+
+	s := addSubscriber(t, transport, "", "https://example.com/foo", "https://example.com/bar")
+
+	var wg sync.WaitGroup
+
+	// Concurrent single updates must not be interleaved with the group.
+	wg.Go(func() {
+		for i := range 10 {
+			assert.NoError(t, transport.Dispatch(t.Context(), &mercure.Update{Topic: "https://example.com/bar", Event: mercure.Event{Data: "single " + strconv.Itoa(i)}}))
+		}
+	})
+
+	group := []*mercure.Update{
+		{Topic: "https://example.com/foo", Event: mercure.Event{Data: "group 0"}},
+		{Topic: "https://example.com/foo", Event: mercure.Event{Data: "group 1"}},
+		{Topic: "https://example.com/foo", Event: mercure.Event{Data: "group 2"}},
+	}
+	require.NoError(t, gd.DispatchGroup(t.Context(), group))
+
+	wg.Wait()
+
+	data := receiveData(t, s, 13)
+	for i, d := range data {
+		if d == "group 0" {
+			require.Less(t, i+2, len(data))
+			assert.Equal(t, []string{"group 0", "group 1", "group 2"}, data[i:i+3])
+
+			return
+		}
+	}
+
+	assert.Fail(t, "group not received", data)
+}
+
+func testRemoveSubscriber(t *testing.T, transport *conformanceTransport) {
+	removed := addSubscriber(t, transport, "", "https://example.com/foo")
+	s := addSubscriber(t, transport, "", "https://example.com/foo")
+
+	require.NoError(t, transport.RemoveSubscriber(t.Context(), removed))
+
+	dispatch(t, transport, "https://example.com/foo", "foo")
+	assert.Equal(t, "foo", receive(t, s).Data)
+
+	select {
+	case u, ok := <-removed.Receive():
+		if ok {
+			assert.Fail(t, "update dispatched to a removed subscriber", u.Data)
+		}
+	default:
+	}
+}
+
+func testConcurrentSubscribers(t *testing.T, transport *conformanceTransport) {
+	var (
+		wg          sync.WaitGroup
+		subscribers = make([]*mercure.LocalSubscriber, 50)
+	)
+
+	for i := range subscribers {
+		wg.Go(func() {
+			subscribers[i] = newSubscriber(transport, "", "https://example.com/foo")
+			assert.NoError(t, transport.AddSubscriber(t.Context(), subscribers[i]))
+		})
+
+		// Subscribers come and go meanwhile.
+		wg.Go(func() {
+			s := newSubscriber(transport, "", "https://example.com/foo")
+			if assert.NoError(t, transport.AddSubscriber(t.Context(), s)) {
+				assert.NoError(t, transport.RemoveSubscriber(t.Context(), s))
+			}
+		})
+	}
+
+	wg.Wait()
+
+	expected := make([]string, 10)
+	for i := range expected {
+		expected[i] = strconv.Itoa(i)
+		dispatch(t, transport, "https://example.com/foo", expected[i])
+	}
+
+	for _, s := range subscribers {
+		assert.Equal(t, expected, receiveData(t, s, len(expected)))
+	}
+}
+
+// dispatchHistory dispatches n updates and returns their IDs.
+func dispatchHistory(t *testing.T, transport *conformanceTransport, n int) []string {
+	t.Helper()
+
+	if _, ok := transport.Transport.(mercure.TransportHistoryReader); !ok {
+		t.Skip("the transport does not implement mercure.TransportHistoryReader")
+	}
+
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = dispatch(t, transport, "https://example.com/foo", strconv.Itoa(i)).ID
+	}
+
+	// Not matching the subscribers.
+	dispatch(t, transport, "https://example.com/bar", "bar")
+
+	return ids
+}
+
+func testHistory(t *testing.T, transport *conformanceTransport) {
+	ids := dispatchHistory(t, transport, 10)
+
+	s := addSubscriber(t, transport, ids[4], "https://example.com/foo")
+	dispatch(t, transport, "https://example.com/foo", "live")
+
+	// The updates following the Last-Event-ID, then the live ones.
+	assert.Equal(t, []string{"5", "6", "7", "8", "9", "live"}, receiveData(t, s, 6))
+}
+
+func testEarliestLastEventID(t *testing.T, transport *conformanceTransport) {
+	dispatchHistory(t, transport, 3)
+
+	s := addSubscriber(t, transport, mercure.EarliestLastEventID, "https://example.com/foo")
+	dispatch(t, transport, "https://example.com/foo", "live")
+
+	assert.Equal(t, []string{"0", "1", "2", "live"}, receiveData(t, s, 4))
+}
+
+func testUnknownLastEventID(t *testing.T, transport *conformanceTransport) {
+	dispatchHistory(t, transport, 3)
+
+	s := addSubscriber(t, transport, "unknown", "https://example.com/foo")
+	dispatch(t, transport, "https://example.com/foo", "live")
+
+	// Whether the history is replayed or not, the live updates are received
+	// last.
+	for {
+		if u := receive(t, s); u.Data == "live" {
+			return
+		}
+	}
+}
+
+func testClose(t *testing.T, transport *conformanceTransport) {
+	s := addSubscriber(t, transport, "", "https://example.com/foo")
+
+	err := transport.Close(t.Context())
+	require.NoError(t, err)
+
+	select {
+	case _, ok := <-s.Receive():
+		assert.False(t, ok, "update received after Close")
+	case <-time.After(receiveTimeout):
+		assert.Fail(t, "subscriber not disconnected by Close")
+	}
+
+	require.ErrorIs(t, transport.Dispatch(t.Context(), &mercure.Update{Topic: "https://example.com/foo"}), mercure.ErrClosedTransport)
+	require.ErrorIs(t, transport.AddSubscriber(t.Context(), newSubscriber(transport, "", "https://example.com/foo")), mercure.ErrClosedTransport)
+	assert.Equal(t, err, transport.Close(t.Context()), "the next calls to Close must return the error of the first one")
+}
+
+func testConcurrentClose(t *testing.T, transport *conformanceTransport) {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		added []*mercure.LocalSubscriber
+	)
+
+	for i := range 100 {
+		wg.Go(func() {
+			s := newSubscriber(transport, "", "https://example.com/foo")
+			if err := transport.AddSubscriber(t.Context(), s); err != nil {
+				assert.ErrorIs(t, err, mercure.ErrClosedTransport)
+
+				return
+			}
+
+			mu.Lock()
+			added = append(added, s)
+			mu.Unlock()
+		})
+
+		wg.Go(func() {
+			if err := transport.Dispatch(t.Context(), &mercure.Update{Topic: "https://example.com/foo"}); err != nil {
+				assert.ErrorIs(t, err, mercure.ErrClosedTransport)
+			}
+		})
+
+		if i%25 == 10 {
+			wg.Go(func() { assert.NoError(t, transport.Close(t.Context())) })
+		}
+	}
+
+	wg.Wait()
+
+	// Once Close returned, all the subscribers added successfully are
+	// disconnected.
+	for _, s := range added {
+		timeout := time.After(receiveTimeout)
+
+		for open := true; open; {
+			select {
+			case _, open = <-s.Receive():
+			case <-timeout:
+				require.FailNow(t, "subscriber not disconnected by Close")
+			}
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package transporttest_test
+
+import (
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/dunglas/mercure"
+	"github.com/dunglas/mercure/transporttest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalTransport(t *testing.T) {
+	t.Parallel()
+
+	transporttest.RunConformanceTests(t, func(*testing.T) mercure.Transport {
+		return mercure.NewLocalTransport(mercure.NewSubscriberList(0))
+	})
+}
+
+func TestBoltTransport(t *testing.T) {
+	t.Parallel()
+
+	transporttest.RunConformanceTests(t, func(t *testing.T) mercure.Transport {
+		t.Helper()
+
+		transport, err := mercure.NewBoltTransport(mercure.NewSubscriberList(0), slog.Default(), filepath.Join(t.TempDir(), "bolt.db"), "", 0, mercure.BoltDefaultCleanupFrequency)
+		require.NoError(t, err)
+
+		return transport
+	})
+}
+
+func TestIPCTransport(t *testing.T) {
+	t.Parallel()
+
+	transporttest.RunConformanceTests(t, func(t *testing.T) mercure.Transport {
+		t.Helper()
+
+		transport, err := mercure.NewIPCTransport(mercure.NewSubscriberList(0), slog.Default(), t.TempDir(), 0, 0)
+		require.NoError(t, err)
+
+		return transport
+	})
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/gofrs/uuid/v5"
 	"go.opentelemetry.io/otel/attribute"
@@ -22,8 +23,77 @@ type Update struct {
 	// Private updates can only be dispatched to subscribers authorized to receive them.
 	Private bool
 
+	// StateVersion is the version of the state of the resource the update
+	// describes, typically the version a REST API exposes in its ETag. Zero
+	// means the update is not versioned. Subscribers that already fetched a
+	// given version skip the updates not newer than it (see the
+	// if-state-version-gt subscribe parameter).
+	StateVersion uint64
+
+	// LocalizedData holds variants of Data indexed by BCP 47 language tags.
+	// Subscribers receive the variant best matching the locale claim of their
+	// token or their Accept-Language header, and Data when none matches.
+	LocalizedData map[string]string
+
+	// CompactionKey identifies the entity the update describes. When the
+	// transport compacts its history, only the most recent update having a
+	// given topic and compaction key is kept, the previous ones being
+	// superseded by it.
+	CompactionKey string
+
+	// Expires is the time the update becomes meaningless at, zero when it
+	// never does, typically for presence or typing indicators. Expired updates
+	// are not replayed from the history anymore, and the transports supporting
+	// it remove them when cleaning up their history.
+	Expires time.Time
+
+	// Priority tells which updates to drop first when a subscriber doesn't
+	// receive them fast enough: when its buffer is full, the oldest update of
+	// the lowest priority is dropped to make room, instead of disconnecting
+	// the subscriber. Higher values are more important, 0 is the default.
+	Priority int
+
+	// IfMatch makes the publication conditional: the update is only published
+	// if it is the ID of the last update published on the topic (see
+	// WithConditionalPublishing). It is not stored.
+	IfMatch string
+
+	// IdempotencyKey deduplicates the publications (see
+	// WithIdempotentPublishing). It is not stored.
+	IdempotencyKey string
+
+	// Publisher identifies the publisher of the update for the topic
+	// cardinality limits (see WithTopicCardinalityLimits), the publish
+	// endpoints set it to the subject of the JWT. It is not stored.
+	Publisher string
+
+	// Tenant is the name of the tenant the update is accounted to (see
+	// WithTenancy), the publish endpoints set it from the issuer of the JWT.
+	// It is not stored.
+	Tenant string
+
 	// To print debug information
 	Debug bool
+
+	// federatedFrom is the name of the federation peer the update has been
+	// received from, not to send it back to the peers.
+	federatedFrom string
+
+	// jsonPatch is the JSON Patch from the previous state of the topic, sent
+	// to the subscribers in delta mode (see WithJSONPatchDeltas).
+	jsonPatch *jsonPatchDelta
+
+	// sequence numbers the publications of the hub when values are retained
+	// (see WithRetainedValues).
+	sequence uint64
+
+	// receipt collects the outcomes of the dispatch to the local
+	// subscribers, see Hub.PublishWithReceipt.
+	receipt *deliveryReceipt
+
+	// report collects what the hub does with the update, see
+	// Hub.PublishWithReport.
+	report *publicationReport
 }
 
 // updateJSON preserves the historic wire shape (a "Topics" array holding the
@@ -32,13 +102,18 @@ type Update struct {
 type updateJSON struct {
 	Event
 
-	Topics  []string
-	Private bool
-	Debug   bool
+	Topics        []string
+	Private       bool
+	Debug         bool
+	StateVersion  uint64            `json:",omitempty"`
+	LocalizedData map[string]string `json:",omitempty"`
+	CompactionKey string            `json:",omitempty"`
+	Expires       time.Time         `json:",omitzero"`
+	Priority      int               `json:",omitempty"`
 }
 
 func (u *Update) MarshalJSON() ([]byte, error) {
-	b, err := json.Marshal(updateJSON{Event: u.Event, Topics: u.topics(), Private: u.Private, Debug: u.Debug})
+	b, err := json.Marshal(updateJSON{Event: u.Event, Topics: u.topics(), Private: u.Private, Debug: u.Debug, StateVersion: u.StateVersion, LocalizedData: u.LocalizedData, CompactionKey: u.CompactionKey, Expires: u.Expires, Priority: u.Priority})
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal update: %w", err)
 	}
@@ -52,7 +127,7 @@ func (u *Update) UnmarshalJSON(data []byte) error {
 		return err //nolint:wrapcheck
 	}
 
-	*u = Update{Event: j.Event, Private: j.Private, Debug: j.Debug}
+	*u = Update{Event: j.Event, Private: j.Private, Debug: j.Debug, StateVersion: j.StateVersion, LocalizedData: j.LocalizedData, CompactionKey: j.CompactionKey, Expires: j.Expires, Priority: j.Priority}
 	u.setTopics(j.Topics)
 
 	return nil
@@ -67,6 +142,22 @@ func (u *Update) LogValue() slog.Value {
 		slog.Bool("private", u.Private),
 	}
 
+	if u.StateVersion != 0 {
+		attrs = append(attrs, slog.Uint64("state_version", u.StateVersion))
+	}
+
+	if u.CompactionKey != "" {
+		attrs = append(attrs, slog.String("compaction_key", u.CompactionKey))
+	}
+
+	if !u.Expires.IsZero() {
+		attrs = append(attrs, slog.Time("expires", u.Expires))
+	}
+
+	if u.Priority != 0 {
+		attrs = append(attrs, slog.Int("priority", u.Priority))
+	}
+
 	if u.Debug {
 		attrs = append(attrs, slog.String("data", u.Data))
 	}
@@ -74,6 +165,11 @@ func (u *Update) LogValue() slog.Value {
 	return slog.GroupValue(attrs...)
 }
 
+// expired reports whether the update is meaningless at now.
+func (u *Update) expired(now time.Time) bool {
+	return !u.Expires.IsZero() && !now.Before(u.Expires)
+}
+
 type serializedUpdate struct {
 	*Update
 
@@ -0,0 +1,743 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultWarmUpQueueSize is the number of updates WarmUpTransport queues
+	// while the transport warms up when not set.
+	DefaultWarmUpQueueSize = 10_000
+
+	// minWarmUpRetryDelay and maxWarmUpRetryDelay bound the delay between two
+	// attempts to open the transport.
+	minWarmUpRetryDelay = time.Second
+	maxWarmUpRetryDelay = time.Minute
+)
+
+var (
+	// ErrTransportWarmingUp is returned by WarmUpTransport for the operations
+	// needing the transport while it warms up, such as reading the history.
+	ErrTransportWarmingUp = errors.New("the transport is warming up")
+	// ErrWarmUpQueueFull is returned by WarmUpTransport when too many updates
+	// have been published while the transport warms up.
+	ErrWarmUpQueueFull = errors.New("too many updates published while the transport warms up")
+	// ErrWarmUpTransportUnsupported is returned by WarmUpTransport when the
+	// warmed up transport doesn't support the requested operation.
+	ErrWarmUpTransportUnsupported = errors.New("the warmed up transport does not support this operation")
+)
+
+// queuedDispatch is a dispatch waiting for the transport to warm up.
+type queuedDispatch struct {
+	ctx     context.Context //nolint:containedctx
+	updates []*Update
+	group   bool
+}
+
+// WarmUpTransport opens a slow transport, such as a large Bolt database or a
+// remote broker, in the background, so the hub serves the subscribers right
+// after a restart instead of waiting for it.
+//
+// While the transport warms up, the subscribers are accepted and receive
+// heartbeats, the ones requesting the history waiting for it to be available,
+// and the published updates are queued. Once the transport is open, the
+// subscribers are added to it, then the queued updates are dispatched, in
+// order. The history can't be read, retracted nor purged meanwhile, and the
+// idempotency keys can't be recorded.
+//
+// Opening the transport is retried with an exponential backoff, unless the
+// error is a *TransportError, as retrying wouldn't fix an invalid DSN.
+type WarmUpTransport struct {
+	mu sync.RWMutex
+
+	logger    *slog.Logger
+	queueSize int
+	cancel    context.CancelFunc
+	done      chan struct{}
+	closed    bool
+	closeErr  error
+
+	transport   Transport
+	subscribers *SubscriberList
+	queue       []queuedDispatch
+	queued      int
+	lastErr     error
+	fatal       error
+
+	shards         int
+	store          *TopicMatcherStore
+	metrics        Metrics
+	topicSequences bool
+}
+
+// NewWarmUpTransport creates a WarmUpTransport warming up the transport
+// created by open in the background, queueing at most queueSize updates
+// meanwhile (DefaultWarmUpQueueSize when 0).
+func NewWarmUpTransport(open func(ctx context.Context) (Transport, error), logger *slog.Logger, queueSize int) *WarmUpTransport {
+	if queueSize <= 0 {
+		queueSize = DefaultWarmUpQueueSize
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t := &WarmUpTransport{
+		logger:      logger,
+		queueSize:   queueSize,
+		cancel:      cancel,
+		done:        make(chan struct{}),
+		subscribers: NewSubscriberList(0),
+	}
+
+	go t.warmUp(ctx, open)
+
+	return t
+}
+
+// warmUp opens the transport, retrying until it succeeds or the
+// WarmUpTransport is closed.
+func (t *WarmUpTransport) warmUp(ctx context.Context, open func(ctx context.Context) (Transport, error)) {
+	defer close(t.done)
+
+	start := time.Now()
+
+	for delay := minWarmUpRetryDelay; ; delay = min(delay*2, maxWarmUpRetryDelay) {
+		tr, err := open(ctx)
+		if err == nil {
+			t.warmedUp(ctx, tr, time.Since(start))
+
+			return
+		}
+
+		var te *TransportError
+
+		fatal := errors.As(err, &te)
+
+		t.mu.Lock()
+		t.lastErr = err
+		if fatal {
+			t.fatal = err
+		}
+		t.mu.Unlock()
+
+		if t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Failed to warm up the transport", slog.Any("error", err), slog.Bool("retrying", !fatal))
+		}
+
+		if fatal {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+	}
+}
+
+// warmedUp adds the waiting subscribers to the transport, then dispatches the
+// queued updates.
+func (t *WarmUpTransport) warmedUp(ctx context.Context, tr Transport, duration time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		// The context is canceled by Close.
+		if err := tr.Close(context.WithoutCancel(ctx)); err != nil && t.logger.Enabled(ctx, slog.LevelError) {
+			t.logger.LogAttrs(ctx, slog.LevelError, "Failed to close the transport warmed up after closing", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	if s, ok := tr.(TransportSubscriberSharder); ok && t.shards > 0 {
+		s.SetSubscriberShards(t.shards)
+	}
+
+	if s, ok := tr.(TransportTopicMatcherStore); ok && t.store != nil {
+		s.SetTopicMatcherStore(t.store)
+	}
+
+	if m, ok := tr.(TransportMetrics); ok && t.metrics != nil {
+		m.SetMetrics(t.metrics)
+	}
+
+	// Before dispatching the queued updates, for them to be numbered.
+	if t.topicSequences {
+		if err := enableTopicSequences(tr); err != nil {
+			t.lastErr, t.fatal = err, err
+
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Failed to enable the topic sequences of the warmed up transport", slog.Any("error", err))
+			}
+
+			if err := tr.Close(ctx); err != nil && t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Failed to close the warmed up transport", slog.Any("error", err))
+			}
+
+			return
+		}
+	}
+
+	t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
+		if s.disconnected.Load() > 0 {
+			return true
+		}
+
+		if err := tr.AddSubscriber(ctx, s); err != nil {
+			s.DisconnectWithReason(DisconnectReasonTransportClosed)
+
+			if t.logger.Enabled(ctx, slog.LevelError) {
+				t.logger.LogAttrs(ctx, slog.LevelError, "Failed to add a subscriber to the warmed up transport", slog.Any("error", err))
+			}
+		}
+
+		return true
+	})
+	t.subscribers.Close()
+
+	for _, q := range t.queue {
+		if err := t.dispatchQueued(tr, q); err != nil && t.logger.Enabled(q.ctx, slog.LevelError) {
+			t.logger.LogAttrs(q.ctx, slog.LevelError, "Failed to dispatch an update queued during the warm-up", slog.Any("error", err))
+		}
+	}
+
+	if t.logger.Enabled(ctx, slog.LevelInfo) {
+		t.logger.LogAttrs(ctx, slog.LevelInfo, "Transport warmed up", slog.Duration("duration", duration), slog.Int("queued_updates", t.queued))
+	}
+
+	t.transport, t.subscribers, t.queue, t.lastErr = tr, nil, nil, nil
+}
+
+func (t *WarmUpTransport) dispatchQueued(tr Transport, q queuedDispatch) error {
+	if !q.group {
+		return tr.Dispatch(q.ctx, q.updates[0]) //nolint:wrapcheck
+	}
+
+	if gd, ok := tr.(TransportGroupDispatcher); ok {
+		return gd.DispatchGroup(q.ctx, q.updates) //nolint:wrapcheck
+	}
+
+	return ErrGroupNotSupported
+}
+
+// warm returns the warmed up transport, or nil with the read lock held while
+// the transport warms up.
+func (t *WarmUpTransport) warm() Transport { //nolint:ireturn
+	t.mu.RLock()
+	if t.transport != nil {
+		tr := t.transport
+		t.mu.RUnlock()
+
+		return tr
+	}
+
+	return nil
+}
+
+// IsWarmedUp reports whether the transport has been opened.
+func (t *WarmUpTransport) IsWarmedUp() bool {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.transport != nil
+}
+
+// enqueue queues a dispatch while the transport warms up, the write lock
+// being held.
+func (t *WarmUpTransport) enqueue(ctx context.Context, updates []*Update, group bool) error {
+	if t.closed {
+		return ErrClosedTransport
+	}
+
+	if t.fatal != nil {
+		return t.fatal
+	}
+
+	if t.queued+len(updates) > t.queueSize {
+		return ErrWarmUpQueueFull
+	}
+
+	for _, u := range updates {
+		u.AssignUUID()
+	}
+
+	t.queue = append(t.queue, queuedDispatch{ctx: context.WithoutCancel(ctx), updates: updates, group: group})
+	t.queued += len(updates)
+
+	return nil
+}
+
+// Dispatch dispatches the update, or queues it while the transport warms up.
+func (t *WarmUpTransport) Dispatch(ctx context.Context, u *Update) error {
+	if tr := t.warm(); tr != nil {
+		return tr.Dispatch(ctx, u) //nolint:wrapcheck
+	}
+
+	t.mu.RUnlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.transport != nil {
+		return t.transport.Dispatch(ctx, u) //nolint:wrapcheck
+	}
+
+	return t.enqueue(ctx, []*Update{u}, false)
+}
+
+// DispatchGroup dispatches the group of updates, or queues it while the
+// transport warms up. The warmed up transport must implement
+// TransportGroupDispatcher.
+func (t *WarmUpTransport) DispatchGroup(ctx context.Context, updates []*Update) error {
+	if tr := t.warm(); tr != nil {
+		return t.dispatchQueued(tr, queuedDispatch{ctx: ctx, updates: updates, group: true})
+	}
+
+	t.mu.RUnlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.transport != nil {
+		return t.dispatchQueued(t.transport, queuedDispatch{ctx: ctx, updates: updates, group: true})
+	}
+
+	return t.enqueue(ctx, updates, true)
+}
+
+// AddSubscriber adds the subscriber to the transport, or keeps it until the
+// transport is warmed up.
+func (t *WarmUpTransport) AddSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	if tr := t.warm(); tr != nil {
+		return tr.AddSubscriber(ctx, s) //nolint:wrapcheck
+	}
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return ErrClosedTransport
+	}
+
+	t.subscribers.Add(s)
+
+	return nil
+}
+
+// RemoveSubscriber removes the subscriber.
+func (t *WarmUpTransport) RemoveSubscriber(ctx context.Context, s *LocalSubscriber) error {
+	if tr := t.warm(); tr != nil {
+		return tr.RemoveSubscriber(ctx, s) //nolint:wrapcheck
+	}
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return ErrClosedTransport
+	}
+
+	t.subscribers.Remove(s)
+
+	return nil
+}
+
+// GetSubscribers gets the subscribers of the transport, or the ones waiting
+// for it while it warms up.
+func (t *WarmUpTransport) GetSubscribers(ctx context.Context) (string, []*Subscriber, error) {
+	if tr := t.warm(); tr != nil {
+		ts, ok := tr.(TransportSubscribers)
+		if !ok {
+			return "", nil, ErrWarmUpTransportUnsupported
+		}
+
+		return ts.GetSubscribers(ctx) //nolint:wrapcheck
+	}
+	defer t.mu.RUnlock()
+
+	return EarliestLastEventID, getSubscribers(t.subscribers), nil
+}
+
+// DisconnectSubscribers disconnects the matching subscribers.
+func (t *WarmUpTransport) DisconnectSubscribers(ctx context.Context, sel *SubscriberSelector, dryRun bool) (int, error) {
+	if tr := t.warm(); tr != nil {
+		d, ok := tr.(TransportDisconnecter)
+		if !ok {
+			return 0, ErrDisconnectNotSupported
+		}
+
+		return d.DisconnectSubscribers(ctx, sel, dryRun) //nolint:wrapcheck
+	}
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return 0, ErrClosedTransport
+	}
+
+	return disconnectSubscribers(t.subscribers, sel, dryRun), nil
+}
+
+// Redeliver dispatches the update to the matching subscribers, of the
+// warmed up transport once opened.
+func (t *WarmUpTransport) Redeliver(ctx context.Context, sel *SubscriberSelector, u *Update) (int, error) {
+	if tr := t.warm(); tr != nil {
+		r, ok := tr.(TransportRedeliverer)
+		if !ok {
+			return 0, ErrRedeliveryNotSupported
+		}
+
+		return r.Redeliver(ctx, sel, u) //nolint:wrapcheck
+	}
+	defer t.mu.RUnlock()
+
+	if t.closed {
+		return 0, ErrClosedTransport
+	}
+
+	return redeliver(ctx, t.subscribers, sel, u), nil
+}
+
+// RetractableUpdate returns the update with the given ID from the history of
+// the warmed up transport.
+func (t *WarmUpTransport) RetractableUpdate(ctx context.Context, id string) (*Update, error) {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return nil, ErrTransportWarmingUp
+	}
+
+	r, ok := tr.(TransportRetracter)
+	if !ok {
+		return nil, ErrRetractionNotSupported
+	}
+
+	return r.RetractableUpdate(ctx, id) //nolint:wrapcheck
+}
+
+// Retract retracts the update in the warmed up transport.
+func (t *WarmUpTransport) Retract(ctx context.Context, id string, retraction *Update) error {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return ErrTransportWarmingUp
+	}
+
+	r, ok := tr.(TransportRetracter)
+	if !ok {
+		return ErrRetractionNotSupported
+	}
+
+	return r.Retract(ctx, id, retraction) //nolint:wrapcheck
+}
+
+// PurgeHistory purges the history of the warmed up transport.
+func (t *WarmUpTransport) PurgeHistory(ctx context.Context, sel *HistoryPurgeSelector, dryRun bool) (int, error) {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return 0, ErrTransportWarmingUp
+	}
+
+	p, ok := tr.(TransportHistoryPurger)
+	if !ok {
+		return 0, ErrHistoryPurgeNotSupported
+	}
+
+	return p.PurgeHistory(ctx, sel, dryRun) //nolint:wrapcheck
+}
+
+// RememberIdempotencyKey records the idempotency key in the index of the
+// warmed up transport.
+func (t *WarmUpTransport) RememberIdempotencyKey(ctx context.Context, key, id string, ttl time.Duration) (string, bool, error) {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return "", false, ErrTransportWarmingUp
+	}
+
+	i, ok := tr.(TransportIdempotencyIndex)
+	if !ok {
+		return "", false, ErrIdempotencyNotSupported
+	}
+
+	return i.RememberIdempotencyKey(ctx, key, id, ttl) //nolint:wrapcheck
+}
+
+// ForgetIdempotencyKey removes the idempotency key from the index of the
+// warmed up transport.
+func (t *WarmUpTransport) ForgetIdempotencyKey(ctx context.Context, key string) error {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return ErrTransportWarmingUp
+	}
+
+	i, ok := tr.(TransportIdempotencyIndex)
+	if !ok {
+		return ErrIdempotencyNotSupported
+	}
+
+	return i.ForgetIdempotencyKey(ctx, key) //nolint:wrapcheck
+}
+
+// VerifyHistoryChain verifies the hash chain of the history of the warmed up
+// transport.
+func (t *WarmUpTransport) VerifyHistoryChain(ctx context.Context) (*HistoryChainReport, error) {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return nil, ErrTransportWarmingUp
+	}
+
+	v, ok := tr.(TransportHistoryChainVerifier)
+	if !ok {
+		return nil, ErrHistoryChainNotSupported
+	}
+
+	return v.VerifyHistoryChain(ctx) //nolint:wrapcheck
+}
+
+// EnableTopicSequences enables the topic sequences of the transport once
+// warmed up, before dispatching the queued updates. The transport failing to
+// enable them is closed, as when it can't be opened.
+func (t *WarmUpTransport) EnableTopicSequences() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.transport != nil {
+		return enableTopicSequences(t.transport)
+	}
+
+	t.topicSequences = true
+
+	return nil
+}
+
+// forgetTopicSequence forgets the number of the topic kept by the warmed up
+// transport, if any.
+func (t *WarmUpTransport) forgetTopicSequence(topic string) {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return
+	}
+
+	if f, ok := tr.(topicSequenceForgetter); ok {
+		f.forgetTopicSequence(topic)
+	}
+}
+
+// ReadHistory reads the history of the warmed up transport.
+func (t *WarmUpTransport) ReadHistory(ctx context.Context, fn func(u *Update) error) error {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return ErrTransportWarmingUp
+	}
+
+	hr, ok := tr.(TransportHistoryReader)
+	if !ok {
+		return ErrWarmUpTransportUnsupported
+	}
+
+	return hr.ReadHistory(ctx, fn) //nolint:wrapcheck
+}
+
+// FetchSince fetches the updates from the warmed up transport.
+func (t *WarmUpTransport) FetchSince(ctx context.Context, lastEventID string, topics []string, limit int) ([]*Update, error) {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return nil, ErrTransportWarmingUp
+	}
+
+	th, ok := tr.(TransportHistory)
+	if !ok {
+		return nil, ErrWarmUpTransportUnsupported
+	}
+
+	return th.FetchSince(ctx, lastEventID, topics, limit) //nolint:wrapcheck
+}
+
+// HistoryVersion returns the version of the history of the warmed up
+// transport, if it can tell it.
+func (t *WarmUpTransport) HistoryVersion(ctx context.Context) (string, time.Time, error) {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return "", time.Time{}, nil
+	}
+
+	tv, ok := tr.(TransportHistoryVersion)
+	if !ok {
+		return "", time.Time{}, nil
+	}
+
+	return tv.HistoryVersion(ctx) //nolint:wrapcheck
+}
+
+// EventIDCodec returns the codec of the IDs of the warmed up transport, if
+// any. The IDs are opaque while the transport warms up.
+func (t *WarmUpTransport) EventIDCodec() EventIDCodec { //nolint:ireturn
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return nil
+	}
+
+	return transportEventIDCodec(tr)
+}
+
+// DispatchesSynchronously reports whether the warmed up transport dispatches
+// the updates synchronously. The updates queued while it warms up aren't.
+func (t *WarmUpTransport) DispatchesSynchronously() bool {
+	tr := t.warm()
+	if tr == nil {
+		t.mu.RUnlock()
+
+		return false
+	}
+
+	return dispatchesSynchronously(tr)
+}
+
+// Ready reports whether the transport can serve traffic: while it warms up,
+// subscribers are served unless the last attempt to open it failed.
+func (t *WarmUpTransport) Ready(ctx context.Context) error {
+	if tr := t.warm(); tr != nil {
+		if hc, ok := tr.(TransportHealthChecker); ok {
+			return hc.Ready(ctx) //nolint:wrapcheck
+		}
+
+		return nil
+	}
+	defer t.mu.RUnlock()
+
+	return t.lastErr
+}
+
+// Live reports whether the transport is operational: it isn't anymore when it
+// can't be opened.
+func (t *WarmUpTransport) Live(ctx context.Context) error {
+	if tr := t.warm(); tr != nil {
+		if hc, ok := tr.(TransportHealthChecker); ok {
+			return hc.Live(ctx) //nolint:wrapcheck
+		}
+
+		return nil
+	}
+	defer t.mu.RUnlock()
+
+	return t.fatal
+}
+
+// SetSubscriberShards shards the subscribers of the transport, once warmed
+// up.
+func (t *WarmUpTransport) SetSubscriberShards(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.shards = n
+	if s, ok := t.transport.(TransportSubscriberSharder); ok {
+		s.SetSubscriberShards(n)
+	}
+}
+
+// SetTopicMatcherStore passes the store to the transport, once warmed up.
+func (t *WarmUpTransport) SetTopicMatcherStore(store *TopicMatcherStore) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.store = store
+	if s, ok := t.transport.(TransportTopicMatcherStore); ok {
+		s.SetTopicMatcherStore(store)
+	}
+}
+
+// SetMetrics passes the metrics to the transport, once warmed up.
+func (t *WarmUpTransport) SetMetrics(m Metrics) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.metrics = m
+	if tm, ok := t.transport.(TransportMetrics); ok {
+		tm.SetMetrics(m)
+	}
+}
+
+// Close stops the warm-up, disconnecting the waiting subscribers and
+// dropping the queued updates, or closes the warmed up transport.
+func (t *WarmUpTransport) Close(ctx context.Context) error {
+	t.mu.Lock()
+
+	if t.closed {
+		defer t.mu.Unlock()
+
+		return t.closeErr
+	}
+
+	t.closed = true
+	t.cancel()
+
+	if t.transport != nil {
+		t.closeErr = t.transport.Close(ctx)
+		t.mu.Unlock()
+
+		return t.closeErr
+	}
+
+	t.subscribers.Walk(0, func(s *LocalSubscriber) bool {
+		s.DisconnectWithReason(DisconnectReasonTransportClosed)
+
+		return true
+	})
+	t.subscribers.Close()
+
+	if t.queued > 0 && t.logger.Enabled(ctx, slog.LevelError) {
+		t.logger.LogAttrs(ctx, slog.LevelError, "Transport closed before warming up, dropping the queued updates", slog.Int("queued_updates", t.queued))
+	}
+
+	t.queue = nil
+	t.mu.Unlock()
+
+	// Wait for the transport being opened, if any, to be closed.
+	select {
+	case <-t.done:
+	case <-ctx.Done():
+	}
+
+	return nil
+}
+
+// Interface guards.
+var (
+	_ Transport                      = (*WarmUpTransport)(nil)
+	_ TransportSynchronousDispatcher = (*WarmUpTransport)(nil)
+	_ TransportIdempotencyIndex      = (*WarmUpTransport)(nil)
+	_ TransportHistoryChainVerifier  = (*WarmUpTransport)(nil)
+	_ TransportTopicSequencer        = (*WarmUpTransport)(nil)
+	_ topicSequenceForgetter         = (*WarmUpTransport)(nil)
+	_ TransportHistoryPurger         = (*WarmUpTransport)(nil)
+	_ TransportSubscribers           = (*WarmUpTransport)(nil)
+	_ TransportGroupDispatcher       = (*WarmUpTransport)(nil)
+	_ TransportRetracter             = (*WarmUpTransport)(nil)
+	_ TransportHistoryReader         = (*WarmUpTransport)(nil)
+	_ TransportHistory               = (*WarmUpTransport)(nil)
+	_ TransportHistoryVersion        = (*WarmUpTransport)(nil)
+	_ TransportEventIDCodec          = (*WarmUpTransport)(nil)
+	_ TransportDisconnecter          = (*WarmUpTransport)(nil)
+	_ TransportRedeliverer           = (*WarmUpTransport)(nil)
+	_ TransportHealthChecker         = (*WarmUpTransport)(nil)
+	_ TransportTopicMatcherStore     = (*WarmUpTransport)(nil)
+	_ TransportSubscriberSharder     = (*WarmUpTransport)(nil)
+	_ TransportMetrics               = (*WarmUpTransport)(nil)
+)
@@ -0,0 +1,268 @@
+package mercure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+	"testing/synctest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errTestWarmUp = errors.New("broker unreachable")
+
+func TestWarmUpTransport(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	transport := NewWarmUpTransport(func(context.Context) (Transport, error) {
+		<-release
+
+		return NewLocalTransport(NewSubscriberList(0)), nil
+	}, slog.Default(), 0)
+
+	ctx := t.Context()
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(ctx))
+	})
+
+	// The subscribers are accepted before the transport is warmed up.
+	s := newTestSubscriber("", "https://example.com/books/1")
+	require.NoError(t, transport.AddSubscriber(ctx, s))
+
+	_, subscribers, err := transport.GetSubscribers(ctx)
+	require.NoError(t, err)
+	assert.Len(t, subscribers, 1)
+
+	queued := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, transport.Dispatch(ctx, queued))
+	assert.NotEmpty(t, queued.ID)
+	assert.False(t, transport.IsWarmedUp())
+
+	_, err = transport.RetractableUpdate(ctx, queued.ID)
+	require.ErrorIs(t, err, ErrTransportWarmingUp)
+
+	close(release)
+
+	assert.Same(t, queued, <-s.Receive())
+	assert.True(t, transport.IsWarmedUp())
+
+	live := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, transport.Dispatch(ctx, live))
+	assert.Same(t, live, <-s.Receive())
+
+	require.NoError(t, transport.RemoveSubscriber(ctx, s))
+
+	_, subscribers, err = transport.GetSubscribers(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, subscribers)
+}
+
+func TestWarmUpTransportOptionalInterfaces(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	inner := positionTransport{createBoltTransport(t, 0, 0)}
+	transport := NewWarmUpTransport(func(context.Context) (Transport, error) {
+		<-release
+
+		return inner, nil
+	}, slog.Default(), 0)
+
+	ctx := t.Context()
+	t.Cleanup(func() {
+		assert.NoError(t, transport.Close(ctx))
+	})
+
+	// The topic sequences are enabled once warmed up.
+	require.NoError(t, transport.EnableTopicSequences())
+
+	_, _, err := transport.RememberIdempotencyKey(ctx, "key", "id", time.Minute)
+	require.ErrorIs(t, err, ErrTransportWarmingUp)
+	require.ErrorIs(t, transport.ForgetIdempotencyKey(ctx, "key"), ErrTransportWarmingUp)
+
+	sel := &HistoryPurgeSelector{Matchers: stringsToExactMatchers([]string{"https://example.com/books/1"})}
+	_, err = transport.PurgeHistory(ctx, sel, true)
+	require.ErrorIs(t, err, ErrTransportWarmingUp)
+
+	_, err = transport.VerifyHistoryChain(ctx)
+	require.ErrorIs(t, err, ErrTransportWarmingUp)
+
+	version, _, err := transport.HistoryVersion(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, version)
+	assert.Nil(t, transport.EventIDCodec())
+	assert.False(t, transport.DispatchesSynchronously())
+
+	s := newTestSubscriber("", "https://example.com/books/1")
+	require.NoError(t, transport.AddSubscriber(ctx, s))
+
+	queued := &Update{Topic: "https://example.com/books/1"}
+	require.NoError(t, transport.Dispatch(ctx, queued))
+
+	close(release)
+
+	assert.Equal(t, uint64(1), (<-s.Receive()).Sequence)
+	assert.Equal(t, positionEventIDCodec{}, transport.EventIDCodec())
+	assert.True(t, transport.DispatchesSynchronously())
+
+	_, found, err := transport.RememberIdempotencyKey(ctx, "key", queued.ID, time.Minute)
+	require.NoError(t, err)
+	assert.False(t, found)
+	require.NoError(t, transport.ForgetIdempotencyKey(ctx, "key"))
+
+	n, err := transport.PurgeHistory(ctx, sel, true)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	report, err := transport.VerifyHistoryChain(ctx)
+	require.NoError(t, err)
+	assert.NotNil(t, report)
+
+	version, _, err = transport.HistoryVersion(ctx)
+	require.NoError(t, err)
+	assert.NotEmpty(t, version)
+}
+
+func TestWarmUpTransportTopicSequencesNotSupported(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := NewWarmUpTransport(func(context.Context) (Transport, error) {
+			return &addSubscriberErrorTransport{}, nil
+		}, slog.Default(), 0)
+
+		require.NoError(t, transport.EnableTopicSequences())
+		synctest.Wait()
+
+		// The transport can't be used.
+		assert.False(t, transport.IsWarmedUp())
+		require.ErrorIs(t, transport.Live(t.Context()), ErrTopicSequencesNotSupported)
+		require.NoError(t, transport.Close(t.Context()))
+	})
+}
+
+func TestWarmUpTransportQueueFull(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	transport := NewWarmUpTransport(func(context.Context) (Transport, error) {
+		<-release
+
+		return NewLocalTransport(NewSubscriberList(0)), nil
+	}, slog.Default(), 1)
+
+	t.Cleanup(func() {
+		close(release)
+		assert.NoError(t, transport.Close(t.Context()))
+	})
+
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}))
+	require.ErrorIs(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/2"}), ErrWarmUpQueueFull)
+	require.ErrorIs(t, transport.DispatchGroup(t.Context(), []*Update{{Topic: "https://example.com/books/3"}}), ErrWarmUpQueueFull)
+}
+
+func TestWarmUpTransportClose(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	inner := NewLocalTransport(NewSubscriberList(0))
+	transport := NewWarmUpTransport(func(context.Context) (Transport, error) {
+		<-release
+
+		return inner, nil
+	}, slog.Default(), 0)
+
+	s := newTestSubscriber("", "https://example.com/books/1")
+	require.NoError(t, transport.AddSubscriber(t.Context(), s))
+	require.NoError(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}))
+
+	closed := make(chan error)
+	go func() {
+		closed <- transport.Close(t.Context())
+	}()
+
+	_, ok := <-s.Receive()
+	assert.False(t, ok)
+	assert.Equal(t, DisconnectReasonTransportClosed, s.disconnectReason)
+
+	// The transport opened after closing is closed too.
+	close(release)
+	require.NoError(t, <-closed)
+	require.ErrorIs(t, inner.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}), ErrClosedTransport)
+
+	require.ErrorIs(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}), ErrClosedTransport)
+	require.ErrorIs(t, transport.AddSubscriber(t.Context(), newTestSubscriber("", "https://example.com/books/1")), ErrClosedTransport)
+	require.NoError(t, transport.Close(t.Context()))
+}
+
+func TestWarmUpTransportRetry(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		attempts := 0
+		transport := NewWarmUpTransport(func(context.Context) (Transport, error) {
+			attempts++
+			if attempts < 3 {
+				return nil, errTestWarmUp
+			}
+
+			return NewLocalTransport(NewSubscriberList(0)), nil
+		}, slog.Default(), 0)
+
+		synctest.Wait()
+		require.ErrorIs(t, transport.Ready(t.Context()), errTestWarmUp)
+		require.NoError(t, transport.Live(t.Context()))
+
+		synctest.Wait()
+		assert.False(t, transport.IsWarmedUp())
+
+		// The delay doubles between the attempts.
+		time.Sleep(3 * time.Second)
+		synctest.Wait()
+
+		assert.Equal(t, 3, attempts)
+		assert.True(t, transport.IsWarmedUp())
+		require.NoError(t, transport.Ready(t.Context()))
+		require.NoError(t, transport.Close(t.Context()))
+	})
+}
+
+func TestWarmUpTransportFatal(t *testing.T) {
+	t.Parallel()
+
+	synctest.Test(t, func(t *testing.T) {
+		transport := NewWarmUpTransport(func(context.Context) (Transport, error) {
+			return NewTransportFromDSN("foo://", slog.Default())
+		}, slog.Default(), 0)
+
+		synctest.Wait()
+
+		require.ErrorIs(t, transport.Live(t.Context()), ErrUnknownTransport)
+		require.ErrorIs(t, transport.Dispatch(t.Context(), &Update{Topic: "https://example.com/books/1"}), ErrUnknownTransport)
+		require.NoError(t, transport.Close(t.Context()))
+	})
+}
+
+func TestWarmUpTransportHub(t *testing.T) {
+	t.Parallel()
+
+	release := make(chan struct{})
+	hub := createDummy(t, WithTransport(NewWarmUpTransport(func(context.Context) (Transport, error) {
+		<-release
+
+		return NewLocalTransport(NewSubscriberList(0)), nil
+	}, slog.Default(), 0)))
+
+	updates, err := hub.Subscribe(t.Context(), stringsToExactMatchers([]string{"https://example.com/books/1"}), nil)
+	require.NoError(t, err)
+
+	u := &Update{Topic: "https://example.com/books/1", Event: Event{Data: "published during the warm-up"}}
+	require.NoError(t, hub.Publish(t.Context(), u))
+
+	close(release)
+	assert.Equal(t, u.ID, (<-updates).ID)
+}
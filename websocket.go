@@ -0,0 +1,891 @@
+package mercure
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1" //nolint:gosec // mandated by RFC 6455
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// webSocketURL is the endpoint streaming the updates over WebSocket.
+	webSocketURL = defaultHubURL + "/ws"
+
+	// WebSocketProtocol is the WebSocket subprotocol of the hub. Clients
+	// passing their access token in a subprotocol must request it too.
+	WebSocketProtocol = "mercure"
+	// WebSocketTokenProtocolPrefix prefixes the subprotocol carrying the
+	// access token of the clients that can't set the Authorization header,
+	// browsers for instance.
+	WebSocketTokenProtocolPrefix = "mercure.bearer."
+
+	webSocketAcceptGUID  = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	webSocketVersion     = "13"
+	webSocketMaxControl  = 125
+	webSocketMaxReceived = 4096
+	// webSocketCloseTimeout is how long the hub waits for the client to
+	// answer its close frame.
+	webSocketCloseTimeout = time.Second
+)
+
+// WebSocket opcodes (RFC 6455, section 5.2).
+const (
+	wsOpContinuation byte = 0x0
+	wsOpText         byte = 0x1
+	wsOpBinary       byte = 0x2
+	wsOpClose        byte = 0x8
+	wsOpPing         byte = 0x9
+	wsOpPong         byte = 0xa
+)
+
+// WebSocket close codes (RFC 6455, section 7.4).
+const (
+	wsCloseNormal          uint16 = 1000
+	wsCloseGoingAway       uint16 = 1001
+	wsCloseProtocolError   uint16 = 1002
+	wsClosePolicyViolation uint16 = 1008
+	wsCloseTooBig          uint16 = 1009
+	wsCloseTryAgainLater   uint16 = 1013
+)
+
+var (
+	errWebSocketHandshake = errors.New("invalid WebSocket handshake")
+	errWebSocketVersion   = errors.New("unsupported WebSocket version")
+	errWebSocketProtocol  = errors.New("WebSocket protocol error")
+	errWebSocketTooBig    = errors.New("WebSocket message too big")
+)
+
+// WithWebSocket enables the WebSocket subscribe endpoint,
+// /.well-known/mercure/ws, for the clients behind proxies or middleboxes
+// breaking SSE. See WebSocketHandler.
+func WithWebSocket() Option {
+	return func(o *opt) error {
+		o.webSocket = true
+
+		return nil
+	}
+}
+
+// WithWebSocketPublishing enables the WebSocket subscribe endpoint, see
+// WithWebSocket, and lets its clients publish updates on the connection,
+// with the publish claims of their JWT, to spare chat-like applications an
+// HTTP request per message. A publisher must be configured. See
+// WebSocketHandler.
+func WithWebSocketPublishing() Option {
+	return func(o *opt) error {
+		o.webSocket = true
+		o.webSocketPublishing = true
+
+		return nil
+	}
+}
+
+// WebSocketHandler streams the updates to a subscriber over WebSocket. The
+// subscription is the one of the subscribe endpoint: the same query
+// parameters select the topics and the updates to replay (last_event_id), and
+// the same authorization applies. As browsers can't set the Authorization
+// header of WebSocket connections, the access token can also be passed in a
+// subprotocol, WebSocketTokenProtocolPrefix followed by the token, requested
+// along with WebSocketProtocol. It is never read from the query string, which
+// RFC 9700 section 4.3.2 forbids and which ends up in the logs. The
+// authorization cookie is only accepted from the same origin and the CORS
+// allowed origins, as WebSocket connections aren't protected by CORS.
+//
+// Every update is sent in a text message, as a JSON object in the format of
+// the history endpoint. Disconnect events are sent the same way, with the
+// reserved mercure type, before the close frame. Heartbeats are ping frames.
+// JSON Patch deltas aren't supported.
+//
+// The messages of the client are ignored, unless publishing is enabled (see
+// WithWebSocketPublishing): text messages are then JSON-RPC 2.0 requests of
+// the publish method, having the params of the sidecar API, answered on the
+// connection. The token must grant publishing to the topic of the update, and
+// be valid for publishers.
+func (h *Hub) WebSocketHandler(w http.ResponseWriter, r *http.Request) { //nolint:funlen
+	key, protocols, err := checkWebSocketHandshake(r)
+	if err != nil {
+		if errors.Is(err, errWebSocketVersion) {
+			w.Header().Set("Sec-WebSocket-Version", webSocketVersion)
+			http.Error(w, err.Error(), http.StatusUpgradeRequired)
+
+			return
+		}
+
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if delta, _ := parseDelta(r.URL.Query()); delta {
+		http.Error(w, `The "`+paramDelta+`" parameter is not supported over WebSocket`, http.StatusBadRequest)
+
+		return
+	}
+
+	r, protocol, err := webSocketAuthorization(r, protocols)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+
+		return
+	}
+
+	if _, ok := r.Header["Authorization"]; !ok && !h.webSocketOriginAllowed(r) {
+		http.Error(w, ErrOriginNotAllowed.Error(), http.StatusForbidden)
+
+		return
+	}
+
+	ctx := r.Context()
+
+	s, _ := h.addSubscriber(ctx, w, r, false)
+	if s == nil {
+		return
+	}
+
+	ctx = context.WithValue(ctx, SubscriberContextKey, &s.Subscriber)
+
+	conn, rw, err := http.NewResponseController(w).Hijack() //nolint:bodyclose
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		h.shutdown(ctx, s, DisconnectReasonWriteFailed)
+
+		if h.logger.Enabled(ctx, slog.LevelError) {
+			h.logger.LogAttrs(ctx, slog.LevelError, "Unable to hijack the WebSocket connection", slog.Any("error", err))
+		}
+
+		return
+	}
+
+	ws := &webSocketConn{conn: conn, rw: rw, subscriber: s}
+	defer conn.Close()
+
+	writeDeadline, tokenExpiry := h.getWriteDeadline(s)
+	ws.writeDeadline = writeDeadline
+
+	// Closed when the client closes the connection.
+	clientDone := make(chan struct{})
+
+	reason := DisconnectReasonClient
+	defer func() {
+		if h.closeWebSocket(ctx, ws, s, reason) {
+			closeTimer := time.NewTimer(webSocketCloseTimeout)
+			defer closeTimer.Stop()
+
+			select {
+			case <-clientDone:
+			case <-closeTimer.C:
+			}
+		}
+
+		h.shutdown(ctx, s, reason)
+	}()
+
+	if !h.acceptWebSocket(ctx, w, ws, s, key, protocol) {
+		reason = DisconnectReasonWriteFailed
+		close(clientDone)
+
+		return
+	}
+
+	h.subscriberConnected(ctx, s, "New WebSocket subscriber")
+
+	if h.webSocketPublishing && h.publisherConfigured {
+		// Clients whose token isn't valid for publishers can still
+		// subscribe, their publish requests are rejected.
+		c, _ := h.authorize(r, true)
+
+		// Browsers send the cookie whatever the page opening the connection:
+		// like for the POST requests, only the publish origins can publish
+		// with it.
+		if c != nil && h.authorizedWithCookie(r) && h.checkPublishOrigin(r) != nil {
+			c = nil
+		}
+		caller := h.httpCaller(r)
+
+		ws.maxMessage = uint64(DefaultMaxRequestBodySize)
+		if h.maxRequestBodySize > 0 {
+			ws.maxMessage = uint64(h.maxRequestBodySize)
+		}
+
+		ws.onMessage = func(message []byte) error {
+			return h.webSocketPublish(ctx, ws, caller, c, message)
+		}
+	}
+
+	// The connection must be read, to answer the pings and the close frame.
+	go func() {
+		defer close(clientDone)
+
+		if err := ws.read(); err != nil && h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelDebug, "WebSocket connection closed", slog.Any("error", err))
+		}
+	}()
+
+	var (
+		heartbeatTimer      *time.Timer
+		heartbeatTimerC     <-chan time.Time
+		disconnectionTimerC <-chan time.Time
+		hubCtxDoneC         <-chan struct{}
+		snapshot            snapshotFilter
+	)
+
+	if h.heartbeat != 0 {
+		heartbeatTimer = time.NewTimer(h.heartbeat)
+		defer heartbeatTimer.Stop()
+
+		heartbeatTimerC = heartbeatTimer.C
+	}
+
+	if !writeDeadline.IsZero() {
+		disconnectionTimer := time.NewTimer(time.Until(writeDeadline.Add(-h.dispatchTimeout)))
+		defer disconnectionTimer.Stop()
+
+		disconnectionTimerC = disconnectionTimer.C
+	}
+
+	if h.writeTimeout == 0 {
+		hubCtxDoneC = h.ctx.Done()
+	}
+
+	if s.WithSnapshot && !s.RequestLastEventIDSet {
+		updates := h.snapshot(s)
+		for _, u := range updates {
+			if !h.writeWebSocket(ctx, ws, wsOpText, webSocketMessage(s, u)) {
+				reason = DisconnectReasonWriteFailed
+
+				return
+			}
+		}
+
+		snapshot = newSnapshotFilter(updates)
+	}
+
+	for {
+		select {
+		case <-hubCtxDoneC:
+			reason = DisconnectReasonHubShutdown
+
+			return
+		case <-clientDone:
+			return
+		case <-heartbeatTimerC:
+			if !h.writeWebSocket(ctx, ws, wsOpPing, nil) {
+				reason = DisconnectReasonWriteFailed
+
+				return
+			}
+
+			heartbeatTimer.Reset(h.heartbeat)
+		case <-disconnectionTimerC:
+			switch {
+			case tokenExpiry:
+				reason = DisconnectReasonTokenExpired
+			case h.ctx.Err() != nil:
+				reason = DisconnectReasonHubShutdown
+			default:
+				reason = DisconnectReasonDeadline
+			}
+
+			return
+		case update, ok := <-s.Receive():
+			if !ok {
+				// Disconnected by the transport.
+				return
+			}
+
+			if snapshot.skip(update) {
+				continue
+			}
+
+			if !h.writeWebSocket(ctx, ws, wsOpText, webSocketMessage(s, update)) {
+				reason = DisconnectReasonWriteFailed
+
+				return
+			}
+
+			if heartbeatTimer != nil {
+				if !heartbeatTimer.Stop() {
+					<-heartbeatTimer.C
+				}
+
+				heartbeatTimer.Reset(h.heartbeat)
+			}
+		}
+	}
+}
+
+// checkWebSocketHandshake checks the opening handshake of the client (RFC
+// 6455, section 4.2.1), and returns its key and the subprotocols it requests.
+func checkWebSocketHandshake(r *http.Request) (string, []string, error) {
+	if !headerContainsToken(r.Header, "Upgrade", "websocket") || !headerContainsToken(r.Header, "Connection", "upgrade") {
+		return "", nil, fmt.Errorf("%w: not an upgrade to WebSocket", errWebSocketHandshake)
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != webSocketVersion {
+		return "", nil, errWebSocketVersion
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if k, err := base64.StdEncoding.DecodeString(key); err != nil || len(k) != 16 {
+		return "", nil, fmt.Errorf("%w: invalid key", errWebSocketHandshake)
+	}
+
+	var protocols []string
+
+	for _, v := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for p := range strings.SplitSeq(v, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				protocols = append(protocols, p)
+			}
+		}
+	}
+
+	return key, protocols, nil
+}
+
+// headerContainsToken reports whether the comma-separated list of the header
+// contains the token, compared case-insensitively.
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, v := range header.Values(name) {
+		for t := range strings.SplitSeq(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// webSocketAuthorization moves the access token given in a subprotocol to the
+// Authorization header of the returned request, and returns
+// the subprotocol to select. Several tokens are rejected by the authorization.
+func webSocketAuthorization(r *http.Request, protocols []string) (*http.Request, string, error) {
+	var (
+		protocol string
+		tokens   []string
+	)
+
+	for _, p := range protocols {
+		if p == WebSocketProtocol {
+			protocol = p
+		} else if token, ok := strings.CutPrefix(p, WebSocketTokenProtocolPrefix); ok {
+			tokens = append(tokens, token)
+		}
+	}
+
+	if len(tokens) != 0 && protocol == "" {
+		return nil, "", fmt.Errorf("%w: the %q subprotocol must be requested along with the token", errWebSocketHandshake, WebSocketProtocol)
+	}
+
+	if len(tokens) == 0 {
+		return r, protocol, nil
+	}
+
+	r = r.Clone(r.Context())
+	for _, t := range tokens {
+		r.Header.Add("Authorization", bearerPrefix+t)
+	}
+
+	return r, protocol, nil
+}
+
+// webSocketOriginAllowed reports whether the page opening the connection can
+// use the authorization cookie. Unlike SSE responses, the messages of
+// WebSocket connections can be read by any origin: without this check, any
+// site could read the private updates of its visitors (cross-site WebSocket
+// hijacking).
+func (h *Hub) webSocketOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if _, err := h.readCookie(r); err != nil {
+		// Anonymous
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	return slices.Contains(h.corsOrigins, origin)
+}
+
+// acceptWebSocket writes the response of the opening handshake, with the
+// headers of the subscribe endpoint.
+func (h *Hub) acceptWebSocket(ctx context.Context, w http.ResponseWriter, ws *webSocketConn, s *LocalSubscriber, key, protocol string) bool {
+	accept := sha1.Sum([]byte(key + webSocketAcceptGUID)) //nolint:gosec
+
+	// The headers set by the middlewares, the guest session cookie for
+	// instance.
+	header := w.Header().Clone()
+	header["Upgrade"] = []string{"websocket"}
+	header["Connection"] = []string{"Upgrade"}
+	header["Sec-Websocket-Accept"] = []string{base64.StdEncoding.EncodeToString(accept[:])}
+
+	if protocol != "" {
+		header["Sec-Websocket-Protocol"] = []string{protocol}
+	}
+
+	if s.RequestLastEventIDSet {
+		header["Mercure-Last-Event-Id"] = []string{<-s.responseLastEventID}
+	}
+
+	h.setResponseHeaders(header, EndpointSubscribe, s.SubscribedMatchers)
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if err := ws.setWriteDeadline(h.dispatchTimeout); err != nil {
+		h.handleWriterError(ctx, err, "Error while setting WebSocket write deadline")
+
+		return false
+	}
+
+	if _, err := ws.rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n"); err != nil {
+		return false
+	}
+
+	if err := header.Write(ws.rw); err != nil {
+		return false
+	}
+
+	if _, err := ws.rw.WriteString("\r\n"); err != nil {
+		return false
+	}
+
+	if err := ws.rw.Flush(); err != nil {
+		h.handleWriterError(ctx, err, "Error while writing WebSocket handshake")
+
+		return false
+	}
+
+	return true
+}
+
+// webSocketMessage returns the message holding the update, in the format of
+// the history endpoint.
+func webSocketMessage(s *LocalSubscriber, u *Update) []byte {
+	j, err := json.Marshal(newSubscriberUpdate(s, u))
+	if err != nil {
+		// Can't happen
+		panic(err)
+	}
+
+	return j
+}
+
+// newSubscriberUpdate returns the representation of an update received by
+// the subscriber, in the format of the history endpoint.
+func newSubscriberUpdate(s *LocalSubscriber, u *Update) historyUpdate {
+	m := newHistoryUpdate(u, s.Languages)
+	if len(m.Topics) == 1 && m.Topics[0] == "" {
+		// Events of the hub, not published on a topic.
+		m.Topics = []string{}
+	}
+
+	return m
+}
+
+// writeWebSocket sends a frame to the client. It returns false if the
+// subscriber has been disconnected.
+func (h *Hub) writeWebSocket(ctx context.Context, ws *webSocketConn, opcode byte, payload []byte) bool {
+	if !h.throttleWrite(ctx, ws.subscriber, len(payload)) {
+		return false
+	}
+
+	if err := ws.writeFrame(opcode, payload, h.dispatchTimeout); err != nil {
+		if h.logger.Enabled(ctx, slog.LevelDebug) {
+			h.logger.LogAttrs(ctx, slog.LevelDebug, "Failed to write WebSocket frame", slog.Any("error", err))
+		}
+
+		return false
+	}
+
+	h.countWritten(ws.subscriber, len(payload))
+
+	return true
+}
+
+// webSocketPublish publishes the update of a publish request sent by the
+// client, and answers the request unless it is a notification.
+func (h *Hub) webSocketPublish(ctx context.Context, ws *webSocketConn, caller authorizationCaller, c *claims, message []byte) error {
+	var req sidecarRequestJSON
+	if err := json.Unmarshal(message, &req); err != nil {
+		return h.answerWebSocket(ws, sidecarResponseJSON{Error: &sidecarErrorJSON{sidecarParseError, "parse error"}})
+	}
+
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return h.answerWebSocket(ws, sidecarResponseJSON{ID: req.ID, Error: &sidecarErrorJSON{sidecarInvalidRequest, "invalid request"}})
+	}
+
+	var (
+		result any
+		rpcErr *sidecarErrorJSON
+	)
+
+	if req.Method == "publish" {
+		result, rpcErr = h.webSocketPublishUpdate(ctx, caller, c, req.Params)
+	} else {
+		rpcErr = &sidecarErrorJSON{sidecarMethodNotFound, "method not found"}
+	}
+
+	// Notifications get no response.
+	if req.ID == nil {
+		return nil
+	}
+
+	return h.answerWebSocket(ws, sidecarResponseJSON{ID: req.ID, Result: result, Error: rpcErr})
+}
+
+// webSocketPublishUpdate runs the publish method, authorized like the
+// publish endpoint.
+func (h *Hub) webSocketPublishUpdate(ctx context.Context, caller authorizationCaller, c *claims, params json.RawMessage) (any, *sidecarErrorJSON) {
+	if c == nil {
+		return nil, &sidecarErrorJSON{sidecarUnauthorized, "publishing not allowed"}
+	}
+
+	// The claims are the ones of the upgrade request: the token may have
+	// expired since.
+	if c.ExpiresAt != nil && !time.Now().Before(c.ExpiresAt.Time) {
+		return nil, &sidecarErrorJSON{sidecarUnauthorized, "token expired"}
+	}
+
+	var p publishHookJSON
+	if err := json.Unmarshal(params, &p); err != nil || p.Topic == "" {
+		return nil, &sidecarErrorJSON{sidecarInvalidParams, "invalid params"}
+	}
+
+	// Validated before reaching the shared match cache, see PublishHandler.
+	if !validProtocolString(p.Topic) {
+		return nil, &sidecarErrorJSON{sidecarInvalidParams, ErrInvalidTopic.Error()}
+	}
+
+	c, err := h.authorizePublication(ctx, caller, c, []string{p.Topic}, p.Private)
+	if err != nil {
+		if errors.Is(err, errAuthorizationDenied) {
+			return nil, &sidecarErrorJSON{sidecarUnauthorized, "insufficient scope"}
+		}
+
+		return nil, &sidecarErrorJSON{sidecarServerError, http.StatusText(http.StatusServiceUnavailable)}
+	}
+
+	if err := h.checkPublishRate(ctx, c, []string{p.Topic}); err != nil {
+		return nil, &sidecarErrorJSON{sidecarServerError, err.Error()}
+	}
+
+	u := &Update{
+		Private:       p.Private,
+		Debug:         h.debug,
+		StateVersion:  p.StateVersion,
+		Event:         Event{Data: p.Data, ID: p.ID, Type: p.Type, Retry: p.Retry},
+		LocalizedData: p.LocalizedData,
+		CompactionKey: p.CompactionKey,
+		Expires:       p.Expires,
+		Priority:      p.Priority,
+		Publisher:     publisherID(c),
+		Tenant:        h.tenantName(c),
+	}
+	u.setTopics([]string{p.Topic})
+
+	if err := h.Publish(context.WithoutCancel(ctx), u); err != nil && !errors.Is(err, ErrPartialDispatch) {
+		if status := publishErrorStatus(err); status != http.StatusBadRequest {
+			return nil, &sidecarErrorJSON{sidecarServerError, http.StatusText(status)}
+		}
+
+		return nil, &sidecarErrorJSON{sidecarInvalidParams, err.Error()}
+	}
+
+	return map[string]string{"id": u.ID}, nil
+}
+
+// answerWebSocket sends a JSON-RPC 2.0 response to the client.
+func (h *Hub) answerWebSocket(ws *webSocketConn, m sidecarResponseJSON) error {
+	m.JSONRPC = "2.0"
+
+	payload, err := json.Marshal(m)
+	if err != nil {
+		// Can't happen
+		panic(err)
+	}
+
+	return ws.writeFrame(wsOpText, payload, h.dispatchTimeout)
+}
+
+// closeWebSocket disconnects the subscriber and, unless the connection is
+// broken, sends it the disconnect event, when enabled, and the close frame.
+// It reports whether the close frame has been sent.
+func (h *Hub) closeWebSocket(ctx context.Context, ws *webSocketConn, s *LocalSubscriber, reason DisconnectReason) bool {
+	s.DisconnectWithReason(reason)
+
+	code := wsCloseNormal
+
+	switch s.disconnectReason {
+	case DisconnectReasonWriteFailed:
+		return false
+	case DisconnectReasonHubShutdown, DisconnectReasonTransportClosed:
+		code = wsCloseGoingAway
+	case DisconnectReasonSlowConsumer:
+		code = wsCloseTryAgainLater
+	case DisconnectReasonTokenExpired:
+		code = wsClosePolicyViolation
+	default:
+	}
+
+	if d, ok := h.disconnection(s.disconnectReason); ok && h.disconnectEvents {
+		data, err := json.Marshal(d)
+		if err != nil {
+			panic(err)
+		}
+
+		m := &Update{Event: Event{Data: string(data), Type: reservedEventType}}
+		if !h.writeWebSocket(ctx, ws, wsOpText, webSocketMessage(s, m)) {
+			return false
+		}
+	}
+
+	sent, err := ws.close(code, string(s.disconnectReason), h.dispatchTimeout)
+	if err != nil && h.logger.Enabled(ctx, slog.LevelDebug) {
+		h.logger.LogAttrs(ctx, slog.LevelDebug, "Failed to close WebSocket connection", slog.Any("error", err))
+	}
+
+	return sent
+}
+
+// webSocketConn is the server side of a WebSocket connection. It implements
+// the subset of RFC 6455 the hub needs: sending unfragmented messages, pings
+// and the closing handshake, and reading the frames of the client to answer
+// its pings and its close frame. Extensions aren't supported.
+type webSocketConn struct {
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	// writeDeadline is the JWT expiration date or the write timeout, the
+	// zero time meaning none.
+	writeDeadline time.Time
+	// onMessage, when set, receives the text messages of the client, up to
+	// maxMessage bytes long.
+	onMessage  func(message []byte) error
+	maxMessage uint64
+	// subscriber is the subscriber the hub writes the updates of, its
+	// bandwidth being accounted (see WithSubscriberBandwidth).
+	subscriber *LocalSubscriber
+
+	// mu serializes the writes of the hub and of the reading goroutine.
+	mu        sync.Mutex
+	closeSent bool
+}
+
+// setWriteDeadline bounds the next write to timeout, and to writeDeadline.
+// The lock must be held.
+func (c *webSocketConn) setWriteDeadline(timeout time.Duration) error {
+	deadline := c.writeDeadline
+	if timeout != 0 {
+		if d := time.Now().Add(timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+
+	return c.conn.SetWriteDeadline(deadline) //nolint:wrapcheck
+}
+
+// writeFrame sends an unmasked frame.
+func (c *webSocketConn) writeFrame(opcode byte, payload []byte, timeout time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closeSent {
+		return net.ErrClosed
+	}
+
+	if opcode == wsOpClose {
+		c.closeSent = true
+	}
+
+	if err := c.setWriteDeadline(timeout); err != nil {
+		return err
+	}
+
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | opcode
+
+	switch l := len(payload); {
+	case l <= 125:
+		header[1] = byte(l)
+	case l <= 0xffff:
+		header[1] = 126
+		header = binary.BigEndian.AppendUint16(header, uint16(l))
+	default:
+		header[1] = 127
+		header = binary.BigEndian.AppendUint64(header, uint64(l))
+	}
+
+	if _, err := c.rw.Write(header); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	if _, err := c.rw.Write(payload); err != nil {
+		return err //nolint:wrapcheck
+	}
+
+	return c.rw.Flush() //nolint:wrapcheck
+}
+
+// close starts, or completes, the closing handshake. It reports whether the
+// close frame has been sent by this call.
+func (c *webSocketConn) close(code uint16, reason string, timeout time.Duration) (bool, error) {
+	payload := binary.BigEndian.AppendUint16(nil, code)
+	if len(reason) <= webSocketMaxControl-2 {
+		payload = append(payload, reason...)
+	}
+
+	err := c.writeFrame(wsOpClose, payload, timeout)
+	if errors.Is(err, net.ErrClosed) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// read reads the frames of the client until it closes the connection. The
+// text messages are passed to onMessage, if set, the other data messages are
+// discarded.
+func (c *webSocketConn) read() error { //nolint:gocognit
+	r := c.rw.Reader
+
+	maxMessage := uint64(webSocketMaxReceived)
+	if c.onMessage != nil && c.maxMessage != 0 {
+		maxMessage = c.maxMessage
+	}
+
+	var (
+		header     [2]byte
+		message    []byte
+		fragmented bool
+		text       bool
+	)
+
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		opcode := header[0] & 0x0f
+		control := opcode&0x8 != 0
+
+		// No extension is negotiated, and clients must mask their frames.
+		if header[0]&0x70 != 0 || header[1]&0x80 == 0 {
+			return c.fail(wsCloseProtocolError, errWebSocketProtocol)
+		}
+
+		length := uint64(header[1] & 0x7f)
+
+		switch length {
+		case 126:
+			var l [2]byte
+			if _, err := io.ReadFull(r, l[:]); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			length = uint64(binary.BigEndian.Uint16(l[:]))
+		case 127:
+			var l [8]byte
+			if _, err := io.ReadFull(r, l[:]); err != nil {
+				return err //nolint:wrapcheck
+			}
+
+			length = binary.BigEndian.Uint64(l[:])
+		}
+
+		if control && (length > webSocketMaxControl || header[0]&0x80 == 0) {
+			return c.fail(wsCloseProtocolError, errWebSocketProtocol)
+		}
+
+		// Only the kept messages grow across fragments.
+		if length > maxMessage-uint64(len(message)) {
+			return c.fail(wsCloseTooBig, errWebSocketTooBig)
+		}
+
+		var mask [4]byte
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return err //nolint:wrapcheck
+		}
+
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+
+		switch opcode {
+		case wsOpContinuation, wsOpText, wsOpBinary:
+			if (opcode == wsOpContinuation) != fragmented {
+				return c.fail(wsCloseProtocolError, errWebSocketProtocol)
+			}
+
+			if opcode != wsOpContinuation {
+				text = opcode == wsOpText
+			}
+
+			fragmented = header[0]&0x80 == 0
+
+			if c.onMessage == nil || !text {
+				continue
+			}
+
+			message = append(message, payload...)
+			if fragmented {
+				continue
+			}
+
+			if err := c.onMessage(message); err != nil {
+				return err
+			}
+
+			message = nil
+		case wsOpPong:
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload, 0); err != nil {
+				return err
+			}
+		case wsOpClose:
+			// Echo the status code.
+			code := wsCloseNormal
+			if len(payload) >= 2 {
+				code = binary.BigEndian.Uint16(payload)
+			}
+
+			_, err := c.close(code, "", 0)
+
+			return err
+		default:
+			return c.fail(wsCloseProtocolError, errWebSocketProtocol)
+		}
+	}
+}
+
+// fail closes the connection because of an error of the client.
+func (c *webSocketConn) fail(code uint16, err error) error {
+	if _, cErr := c.close(code, "", 0); cErr != nil {
+		return errors.Join(err, cErr)
+	}
+
+	return err
+}
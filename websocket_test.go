@@ -0,0 +1,609 @@
+package mercure
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webSocketClient is a minimal WebSocket client.
+type webSocketClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dialWebSocket opens a WebSocket connection to the path of the server. The
+// response is returned, and the client is nil, when the handshake fails.
+func dialWebSocket(t *testing.T, srv *httptest.Server, path string, header http.Header) (*webSocketClient, *http.Response) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil) //nolint:noctx
+	require.NoError(t, err)
+
+	for k, v := range header {
+		req.Header[k] = v
+	}
+
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+
+	if req.Header.Get("Sec-WebSocket-Version") == "" {
+		req.Header.Set("Sec-WebSocket-Version", webSocketVersion)
+	}
+
+	require.NoError(t, req.Write(conn))
+
+	r := bufio.NewReader(conn)
+
+	resp, err := http.ReadResponse(r, req)
+	require.NoError(t, err)
+
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, resp
+	}
+
+	return &webSocketClient{conn: conn, r: r}, resp
+}
+
+// readFrame reads a frame sent by the hub.
+func (c *webSocketClient) readFrame(t *testing.T) (byte, []byte) {
+	t.Helper()
+
+	var header [2]byte
+	_, err := io.ReadFull(c.r, header[:])
+	require.NoError(t, err)
+
+	require.NotZero(t, header[0]&0x80, "fragmented frame")
+	require.Zero(t, header[1]&0x80, "masked frame")
+
+	length := uint64(header[1] & 0x7f)
+
+	switch length {
+	case 126:
+		var l [2]byte
+		_, err = io.ReadFull(c.r, l[:])
+		length = uint64(binary.BigEndian.Uint16(l[:]))
+	case 127:
+		var l [8]byte
+		_, err = io.ReadFull(c.r, l[:])
+		length = binary.BigEndian.Uint64(l[:])
+	}
+
+	require.NoError(t, err)
+
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.r, payload)
+	require.NoError(t, err)
+
+	return header[0] & 0x0f, payload
+}
+
+// readMessage reads the next text message, skipping the pings.
+func (c *webSocketClient) readMessage(t *testing.T) historyUpdate {
+	t.Helper()
+
+	for {
+		opcode, payload := c.readFrame(t)
+		if opcode == wsOpPing {
+			continue
+		}
+
+		require.Equal(t, wsOpText, opcode, string(payload))
+
+		var m historyUpdate
+		require.NoError(t, json.Unmarshal(payload, &m))
+
+		return m
+	}
+}
+
+// writeFrame sends a masked frame to the hub.
+func (c *webSocketClient) writeFrame(t *testing.T, opcode byte, payload []byte) {
+	t.Helper()
+
+	c.writeFragment(t, opcode, payload, true)
+}
+
+// writeFragment sends a masked frame to the hub, the last one of the message
+// if fin is true.
+func (c *webSocketClient) writeFragment(t *testing.T, opcode byte, payload []byte, fin bool) {
+	t.Helper()
+
+	require.LessOrEqual(t, len(payload), 0xffff)
+
+	frame := []byte{opcode}
+	if fin {
+		frame[0] |= 0x80
+	}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = binary.BigEndian.AppendUint16(append(frame, 0x80|126), uint16(len(payload)))
+	}
+
+	mask := []byte{1, 2, 3, 4}
+
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func TestWebSocket(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket(), WithHeartbeat(10*time.Millisecond))
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	c, resp := dialWebSocket(t, srv, webSocketURL+"?match=https://example.com/books/1", nil)
+	require.NotNil(t, c, resp.Status)
+	assert.Empty(t, resp.Header.Get("Sec-WebSocket-Protocol"))
+	assert.Equal(t, "nosniff", resp.Header.Get("X-Content-Type-Options"))
+
+	// The heartbeats are pings.
+	opcode, _ := c.readFrame(t)
+	assert.Equal(t, wsOpPing, opcode)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{
+		Topic: "https://example.com/books/1",
+		Event: Event{ID: "1", Type: "book", Data: "first\nsecond"},
+	}))
+
+	assert.Equal(t, historyUpdate{ID: "1", Type: "book", Topics: []string{"https://example.com/books/1"}, Data: "first\nsecond"}, c.readMessage(t))
+
+	c.writeFrame(t, wsOpPing, []byte("hello"))
+
+	for {
+		opcode, payload := c.readFrame(t)
+		if opcode == wsOpPing {
+			continue
+		}
+
+		assert.Equal(t, wsOpPong, opcode)
+		assert.Equal(t, "hello", string(payload))
+
+		break
+	}
+
+	// The messages of the client are ignored.
+	c.writeFrame(t, wsOpText, []byte("ignored"))
+
+	c.writeFrame(t, wsOpClose, binary.BigEndian.AppendUint16(nil, wsCloseNormal))
+
+	for {
+		opcode, payload := c.readFrame(t)
+		if opcode == wsOpPing {
+			continue
+		}
+
+		assert.Equal(t, wsOpClose, opcode)
+		assert.Equal(t, wsCloseNormal, binary.BigEndian.Uint16(payload))
+
+		break
+	}
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+}
+
+func TestWebSocketAuthorization(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithWebSocket())
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	path := webSocketURL + "?match=https://example.com/books/1"
+	token := createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"})
+
+	_, resp := dialWebSocket(t, srv, path, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	// The token protocol must be requested with the mercure one.
+	_, resp = dialWebSocket(t, srv, path, http.Header{"Sec-Websocket-Protocol": {WebSocketTokenProtocolPrefix + token}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Only one token is accepted.
+	_, resp = dialWebSocket(t, srv, path, http.Header{"Authorization": {bearerPrefix + token}, "Sec-Websocket-Protocol": {WebSocketProtocol + ", " + WebSocketTokenProtocolPrefix + token}})
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	// Tokens in the query string are ignored (RFC 9700, section 4.3.2).
+	_, resp = dialWebSocket(t, srv, path+"&access_token="+token, nil)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	subprotocol, resp := dialWebSocket(t, srv, path, http.Header{"Sec-Websocket-Protocol": {WebSocketProtocol + ", " + WebSocketTokenProtocolPrefix + token}})
+	require.NotNil(t, subprotocol, resp.Status)
+	assert.Equal(t, WebSocketProtocol, resp.Header.Get("Sec-WebSocket-Protocol"))
+
+	header, resp := dialWebSocket(t, srv, path, http.Header{"Authorization": {bearerPrefix + token}})
+	require.NotNil(t, header, resp.Status)
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 2)
+
+	require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Private: true, Event: Event{ID: "1", Data: "Dune"}}))
+
+	for _, c := range []*webSocketClient{subprotocol, header} {
+		assert.Equal(t, historyUpdate{ID: "1", Topics: []string{"https://example.com/books/1"}, Data: "Dune", Private: true}, c.readMessage(t))
+	}
+}
+
+func TestWebSocketCookieOrigin(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithWebSocket(), WithCORSOrigins([]string{"https://allowed.example.com"}))
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	path := webSocketURL + "?match=https://example.com/books/1"
+	cookie := defaultCookieName + "=" + createDummyAuthorizedJWT(roleSubscriber, []string{"https://example.com/books/1"})
+
+	_, resp := dialWebSocket(t, srv, path, http.Header{"Cookie": {cookie}, "Origin": {"https://evil.example.com"}})
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	for _, origin := range []string{"https://allowed.example.com", srv.URL} {
+		c, resp := dialWebSocket(t, srv, path, http.Header{"Cookie": {cookie}, "Origin": {origin}})
+		assert.NotNil(t, c, "%s: %s", origin, resp.Status)
+	}
+}
+
+func TestWebSocketInvalidHandshake(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket())
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	path := webSocketURL + "?match=https://example.com/books/1"
+
+	resp, err := http.Get(srv.URL + path) //nolint:noctx
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	_, resp = dialWebSocket(t, srv, path, http.Header{"Sec-Websocket-Version": {"8"}})
+	assert.Equal(t, http.StatusUpgradeRequired, resp.StatusCode)
+	assert.Equal(t, webSocketVersion, resp.Header.Get("Sec-WebSocket-Version"))
+
+	_, resp = dialWebSocket(t, srv, path+"&delta="+deltaJSONPatch, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	_, resp = dialWebSocket(t, srv, webSocketURL, nil)
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestWebSocketNotEnabled(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(createAnonymousDummy(t))
+	defer srv.Close()
+
+	_, resp := dialWebSocket(t, srv, webSocketURL+"?match=https://example.com/books/1", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestWebSocketReplay(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket(), WithTransport(createBoltTransport(t, 0, 0)))
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	for _, id := range []string{"1", "2", "3"} {
+		require.NoError(t, hub.Publish(t.Context(), &Update{Topic: "https://example.com/books/1", Event: Event{ID: id}}))
+	}
+
+	c, resp := dialWebSocket(t, srv, webSocketURL+"?"+url.Values{"match": {"https://example.com/books/1"}, "last_event_id": {"1"}}.Encode(), nil)
+	require.NotNil(t, c, resp.Status)
+	assert.Equal(t, "1", resp.Header.Get("Mercure-Last-Event-Id"))
+
+	assert.Equal(t, "2", c.readMessage(t).ID)
+	assert.Equal(t, "3", c.readMessage(t).ID)
+}
+
+func TestWebSocketDisconnectEvent(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket(), WithDisconnectEvents(0))
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	c, resp := dialWebSocket(t, srv, webSocketURL+"?match=https://example.com/books/1", nil)
+	require.NotNil(t, c, resp.Status)
+
+	n, err := hub.DisconnectSubscribers(t.Context(), &SubscriberSelector{Topics: []string{"https://example.com/books/1"}}, false)
+	require.NoError(t, err)
+	assert.Equal(t, 1, n)
+
+	m := c.readMessage(t)
+	assert.Equal(t, reservedEventType, m.Type)
+	assert.Empty(t, m.Topics)
+	assert.JSONEq(t, `{"type":"Disconnection","reason":"kicked"}`, m.Data)
+
+	opcode, payload := c.readFrame(t)
+	require.Equal(t, wsOpClose, opcode)
+	assert.Equal(t, wsCloseNormal, binary.BigEndian.Uint16(payload))
+	assert.Equal(t, string(DisconnectReasonKicked), string(payload[2:]))
+
+	// Complete the closing handshake.
+	c.writeFrame(t, wsOpClose, payload[:2])
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+
+	_, err = c.r.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestWebSocketProtocolError(t *testing.T) {
+	t.Parallel()
+
+	hub := createAnonymousDummy(t, WithWebSocket())
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	c, resp := dialWebSocket(t, srv, webSocketURL+"?match=https://example.com/books/1", nil)
+	require.NotNil(t, c, resp.Status)
+
+	// Unmasked frame.
+	_, err := c.conn.Write([]byte{0x80 | wsOpText, 1, 'a'})
+	require.NoError(t, err)
+
+	opcode, payload := c.readFrame(t)
+	require.Equal(t, wsOpClose, opcode)
+	assert.Equal(t, wsCloseProtocolError, binary.BigEndian.Uint16(payload))
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 0)
+}
+
+// createWebSocketPublishingDummy creates a hub accepting the tokens signed
+// with the same key from publishers and subscribers.
+func createWebSocketPublishingDummy(t *testing.T) *Hub {
+	t.Helper()
+
+	key := Static{Key: []byte("chat"), Algorithm: "HS256"}
+
+	hub, err := NewHub(t.Context(),
+		WithIssuers([]Issuer{{Identifier: testIssuer, Publisher: key, Subscriber: key}}),
+		WithResourceIdentifier(testResourceIdentifier),
+		WithWebSocketPublishing(),
+	)
+	require.NoError(t, err)
+
+	return hub
+}
+
+// readRPCResponse reads the next JSON-RPC response, collecting the updates
+// received meanwhile.
+func (c *webSocketClient) readRPCResponse(t *testing.T, updates *[]historyUpdate) sidecarResponseJSON {
+	t.Helper()
+
+	for {
+		opcode, payload := c.readFrame(t)
+		if opcode == wsOpPing {
+			continue
+		}
+
+		require.Equal(t, wsOpText, opcode, string(payload))
+
+		var m struct {
+			JSONRPC string `json:"jsonrpc"`
+		}
+		require.NoError(t, json.Unmarshal(payload, &m))
+
+		if m.JSONRPC == "" {
+			var u historyUpdate
+			require.NoError(t, json.Unmarshal(payload, &u))
+			*updates = append(*updates, u)
+
+			continue
+		}
+
+		var resp sidecarResponseJSON
+		require.NoError(t, json.Unmarshal(payload, &resp))
+
+		return resp
+	}
+}
+
+func TestWebSocketPublishing(t *testing.T) {
+	t.Parallel()
+
+	hub := createWebSocketPublishingDummy(t)
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	token := mintAccessToken([]byte("chat"), testResourceIdentifier, []authorizationDetail{{
+		Type:    authorizationDetailTypeMercure,
+		Actions: []mercureAction{actionSubscribe, actionPublish},
+		Topics:  stringsToDetailTopics([]string{"https://example.com/rooms/1"}),
+	}})
+	header := http.Header{"Authorization": {bearerPrefix + token}}
+
+	path := webSocketURL + "?match=https://example.com/rooms/1"
+
+	publisher, resp := dialWebSocket(t, srv, path, header)
+	require.NotNil(t, publisher, resp.Status)
+
+	subscriber, resp := dialWebSocket(t, srv, path, header)
+	require.NotNil(t, subscriber, resp.Status)
+
+	waitSubscribers(t, hub.transport.(*LocalTransport), 2)
+
+	publisher.writeFrame(t, wsOpText, []byte(`{"jsonrpc":"2.0","id":1,"method":"publish","params":{"topic":"https://example.com/rooms/1","id":"m1","data":"hello","private":true}}`))
+
+	var updates []historyUpdate
+
+	rpcResp := publisher.readRPCResponse(t, &updates)
+	assert.JSONEq(t, "1", string(rpcResp.ID))
+	assert.Nil(t, rpcResp.Error)
+	assert.Equal(t, map[string]any{"id": "m1"}, rpcResp.Result)
+
+	expected := historyUpdate{ID: "m1", Topics: []string{"https://example.com/rooms/1"}, Data: "hello", Private: true}
+	assert.Equal(t, expected, subscriber.readMessage(t))
+
+	if len(updates) == 0 {
+		updates = append(updates, publisher.readMessage(t))
+	}
+
+	assert.Equal(t, []historyUpdate{expected}, updates)
+
+	// Notifications get no response.
+	publisher.writeFrame(t, wsOpText, []byte(`{"jsonrpc":"2.0","method":"publish","params":{"topic":"https://example.com/rooms/1","id":"m2","private":true}}`))
+	assert.Equal(t, "m2", subscriber.readMessage(t).ID)
+	assert.Equal(t, "m2", publisher.readMessage(t).ID)
+
+	for message, code := range map[string]int{
+		`{"jsonrpc":"2.0","id":2,"method":"publish","params":{"topic":"https://example.com/rooms/2"}}`: sidecarUnauthorized,
+		`{"jsonrpc":"2.0","id":2,"method":"publish","params":{}}`:                                      sidecarInvalidParams,
+		`{"jsonrpc":"2.0","id":2,"method":"subscribe"}`:                                                sidecarMethodNotFound,
+		`{"id":2,"method":"publish"}`:                                                                  sidecarInvalidRequest,
+		`{`:                                                                                            sidecarParseError,
+	} {
+		publisher.writeFrame(t, wsOpText, []byte(message))
+
+		rpcResp := publisher.readRPCResponse(t, &updates)
+		require.NotNil(t, rpcResp.Error, message)
+		assert.Equal(t, code, rpcResp.Error.Code, message)
+	}
+
+	// Messages of any size up to the limit of the request bodies.
+	data := strings.Repeat("x", webSocketMaxReceived)
+	publisher.writeFrame(t, wsOpText, []byte(`{"jsonrpc":"2.0","id":3,"method":"publish","params":{"topic":"https://example.com/rooms/1","data":"`+data+`"}}`))
+
+	rpcResp = publisher.readRPCResponse(t, &updates)
+	require.Nil(t, rpcResp.Error)
+	assert.Equal(t, data, subscriber.readMessage(t).Data)
+}
+
+func TestWebSocketPublishingFragmented(t *testing.T) {
+	t.Parallel()
+
+	hub := createWebSocketPublishingDummy(t)
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	token := mintAccessToken([]byte("chat"), testResourceIdentifier, []authorizationDetail{{
+		Type:    authorizationDetailTypeMercure,
+		Actions: []mercureAction{actionSubscribe, actionPublish},
+		Topics:  stringsToDetailTopics([]string{"https://example.com/rooms/1"}),
+	}})
+
+	c, resp := dialWebSocket(t, srv, webSocketURL+"?match=https://example.com/rooms/2", http.Header{"Authorization": {bearerPrefix + token}})
+	require.NotNil(t, c, resp.Status)
+
+	message := []byte(`{"jsonrpc":"2.0","id":1,"method":"publish","params":{"topic":"https://example.com/rooms/1"}}`)
+
+	c.writeFragment(t, wsOpText, message[:10], false)
+	// Control frames can be interleaved.
+	c.writeFrame(t, wsOpPing, nil)
+	c.writeFragment(t, wsOpContinuation, message[10:50], false)
+	c.writeFragment(t, wsOpContinuation, message[50:], true)
+
+	opcode, _ := c.readFrame(t)
+	assert.Equal(t, wsOpPong, opcode)
+
+	var updates []historyUpdate
+
+	rpcResp := c.readRPCResponse(t, &updates)
+	assert.Nil(t, rpcResp.Error)
+}
+
+func TestWebSocketPublishingCookieOrigin(t *testing.T) {
+	t.Parallel()
+
+	key := Static{Key: []byte("chat"), Algorithm: "HS256"}
+
+	hub, err := NewHub(t.Context(),
+		WithIssuers([]Issuer{{Identifier: testIssuer, Publisher: key, Subscriber: key}}),
+		WithResourceIdentifier(testResourceIdentifier),
+		WithWebSocketPublishing(),
+		WithCORSOrigins([]string{"https://subscriber.example.com", "https://publisher.example.com"}),
+		WithPublishOrigins([]string{"https://publisher.example.com"}),
+	)
+	require.NoError(t, err)
+
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	token := mintAccessToken([]byte("chat"), testResourceIdentifier, []authorizationDetail{{
+		Type:    authorizationDetailTypeMercure,
+		Actions: []mercureAction{actionSubscribe, actionPublish},
+		Topics:  stringsToDetailTopics([]string{"https://example.com/rooms/1"}),
+	}})
+
+	publish := func(origin string) *sidecarErrorJSON {
+		c, resp := dialWebSocket(t, srv, webSocketURL+"?match=https://example.com/rooms/1", http.Header{"Cookie": {defaultCookieName + "=" + token}, "Origin": {origin}})
+		require.NotNil(t, c, resp.Status)
+
+		c.writeFrame(t, wsOpText, []byte(`{"jsonrpc":"2.0","id":1,"method":"publish","params":{"topic":"https://example.com/rooms/1"}}`))
+
+		var updates []historyUpdate
+
+		return c.readRPCResponse(t, &updates).Error
+	}
+
+	// The subscribe origins can't publish with the cookie.
+	rpcErr := publish("https://subscriber.example.com")
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, sidecarUnauthorized, rpcErr.Code)
+
+	assert.Nil(t, publish("https://publisher.example.com"))
+}
+
+func TestWebSocketPublishingExpiredToken(t *testing.T) {
+	t.Parallel()
+
+	hub := createWebSocketPublishingDummy(t)
+	c := &claims{RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Second))}}
+
+	_, rpcErr := hub.webSocketPublishUpdate(t.Context(), authorizationCaller{}, c, json.RawMessage(`{"topic":"https://example.com/rooms/1"}`))
+	require.NotNil(t, rpcErr)
+	assert.Equal(t, sidecarUnauthorized, rpcErr.Code)
+}
+
+func TestWebSocketPublishingSubscriberToken(t *testing.T) {
+	t.Parallel()
+
+	hub := createDummy(t, WithWebSocketPublishing())
+	srv := httptest.NewServer(hub)
+	defer srv.Close()
+
+	token := createDummyAuthorizedJWT(roleSubscriber, []string{"*"})
+
+	c, resp := dialWebSocket(t, srv, webSocketURL+"?match=https://example.com/rooms/1", http.Header{"Authorization": {bearerPrefix + token}})
+	require.NotNil(t, c, resp.Status)
+
+	c.writeFrame(t, wsOpText, []byte(`{"jsonrpc":"2.0","id":1,"method":"publish","params":{"topic":"https://example.com/rooms/1"}}`))
+
+	var updates []historyUpdate
+
+	rpcResp := c.readRPCResponse(t, &updates)
+	require.NotNil(t, rpcResp.Error)
+	assert.Equal(t, sidecarUnauthorized, rpcResp.Error.Code)
+	assert.Empty(t, updates)
+}